@@ -0,0 +1,89 @@
+package main
+
+import (
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "os"
+
+        "kube-browser/pkg/handlers"
+        "kube-browser/pkg/store"
+)
+
+const configUsage = `usage: kube-browser config export [-o file]
+       kube-browser config import [--replace] file`
+
+// runConfig implements "kube-browser config export" and "kube-browser
+// config import", which move saved searches and the other portable state
+// between machines in a single JSON file. The running server picks up an
+// import after a restart.
+func runConfig(args []string) int {
+        if len(args) == 0 {
+                fmt.Fprintln(os.Stderr, configUsage)
+                return 2
+        }
+        switch args[0] {
+        case "export":
+                fs := flag.NewFlagSet("config export", flag.ContinueOnError)
+                out := fs.String("o", "", "file to write (default: standard output)")
+                if err := fs.Parse(args[1:]); err != nil {
+                        return 2
+                }
+                bundle, err := store.Export(handlers.PortableStateFiles()...)
+                if err != nil {
+                        fmt.Fprintf(os.Stderr, "config export: %v\n", err)
+                        return 1
+                }
+                data, _ := json.MarshalIndent(bundle, "", "  ")
+                data = append(data, '\n')
+                if *out == "" {
+                        os.Stdout.Write(data)
+                        return 0
+                }
+                if err := os.WriteFile(*out, data, 0o600); err != nil {
+                        fmt.Fprintf(os.Stderr, "config export: %v\n", err)
+                        return 1
+                }
+                return 0
+        case "import":
+                fs := flag.NewFlagSet("config import", flag.ContinueOnError)
+                replace := fs.Bool("replace", false, "replace the saved searches instead of merging them by id")
+                if err := fs.Parse(args[1:]); err != nil {
+                        return 2
+                }
+                if fs.NArg() != 1 {
+                        fmt.Fprintln(os.Stderr, configUsage)
+                        return 2
+                }
+                var in io.Reader = os.Stdin
+                if name := fs.Arg(0); name != "-" {
+                        f, err := os.Open(name)
+                        if err != nil {
+                                fmt.Fprintf(os.Stderr, "config import: %v\n", err)
+                                return 1
+                        }
+                        defer f.Close()
+                        in = f
+                }
+                var bundle store.Bundle
+                if err := json.NewDecoder(in).Decode(&bundle); err != nil {
+                        fmt.Fprintf(os.Stderr, "config import: invalid configuration file: %v\n", err)
+                        return 1
+                }
+                imported, err := store.Import(&bundle, *replace, handlers.PortableStateFiles()...)
+                for _, name := range imported {
+                        fmt.Printf("imported %s\n", name)
+                }
+                if err != nil {
+                        fmt.Fprintf(os.Stderr, "config import: %v\n", err)
+                        return 1
+                }
+                if len(bundle.Browser) > 0 {
+                        fmt.Println("browser preferences are imported from the web UI (Import settings)")
+                }
+                return 0
+        }
+        fmt.Fprintln(os.Stderr, configUsage)
+        return 2
+}
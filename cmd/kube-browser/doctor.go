@@ -0,0 +1,135 @@
+package main
+
+import (
+        "context"
+        "encoding/json"
+        "flag"
+        "fmt"
+        "io"
+        "os"
+        "os/signal"
+        "syscall"
+        "time"
+
+        "kube-browser/pkg/k8s"
+)
+
+// runDoctor implements "kube-browser doctor", a readiness report for one
+// kubeconfig context: kubeconfig loading, API reachability, RBAC, helper
+// image pull and exec transport.
+func runDoctor(args []string) int {
+        fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+        kubeconfig := fs.String("kubeconfig", k8s.DefaultKubeconfigPath(), "kubeconfig file to check")
+        contextName := fs.String("context", "", "kubeconfig context (default: current context, or in-cluster credentials when running in a pod)")
+        namespace := fs.String("namespace", "default", "namespace to check RBAC in and run the test pod")
+        skipPod := fs.Bool("skip-pod", false, "do not start a test pod (skips the helper image and exec checks)")
+        timeout := fs.Duration("pod-timeout", 90*time.Second, "how long the test pod may take to start")
+        mirror := fs.String("registry-mirror", os.Getenv("KUBE_BROWSER_REGISTRY_MIRROR"), "registry mirror for the helper image")
+        pullSecrets := fs.String("image-pull-secrets", os.Getenv("KUBE_BROWSER_IMAGE_PULL_SECRET"), "comma-separated Secrets to pull the helper image with")
+        asJSON := fs.Bool("json", false, "print the report as JSON")
+        if err := fs.Parse(args); err != nil {
+                return 2
+        }
+
+        report := &k8s.DoctorReport{Context: *contextName, Namespace: *namespace}
+        client := doctorClient(report, *kubeconfig, *contextName)
+        if client != nil {
+                if err := client.SetRegistryMirror(*mirror); err != nil {
+                        report.Add("Registry mirror", k8s.CheckFail, "%v", err)
+                } else if err := client.SetImagePullSecrets(*pullSecrets); err != nil {
+                        report.Add("Image pull secrets", k8s.CheckFail, "%v", err)
+                } else {
+                        ctx, cancel := signalContext()
+                        defer cancel()
+                        r := client.Doctor(ctx, k8s.DoctorOptions{Namespace: *namespace, SkipPod: *skipPod, PodTimeout: *timeout})
+                        report.Context = r.Context
+                        report.Checks = append(report.Checks, r.Checks...)
+                }
+        }
+
+        if *asJSON {
+                enc := json.NewEncoder(os.Stdout)
+                enc.SetIndent("", "  ")
+                enc.Encode(struct {
+                        *k8s.DoctorReport
+                        Ready bool `json:"ready"`
+                }{report, report.Ready()})
+        } else {
+                printDoctorReport(os.Stdout, report)
+        }
+        if !report.Ready() {
+                return 1
+        }
+        return 0
+}
+
+// doctorClient loads the kubeconfig (or in-cluster credentials) and
+// records the outcome as the first check. It returns nil when there is
+// nothing to connect with.
+func doctorClient(report *k8s.DoctorReport, kubeconfig, contextName string) *k8s.Client {
+        inCluster := contextName == k8s.InClusterContext
+        if contextName == "" && k8s.RunningInCluster() {
+                // Inside a pod without a kubeconfig, check what the server
+                // itself would use.
+                if _, err := os.Stat(kubeconfig); err != nil {
+                        inCluster = true
+                }
+        }
+        if inCluster {
+                client, err := k8s.NewInClusterClient()
+                if err != nil {
+                        report.Add("Kubeconfig", k8s.CheckFail, "in-cluster credentials: %v", err)
+                        return nil
+                }
+                report.Context = k8s.InClusterContext
+                report.Add("Kubeconfig", k8s.CheckPass, "using in-cluster service account credentials")
+                return client
+        }
+
+        info, err := k8s.ReadKubeconfig(kubeconfig)
+        if err != nil {
+                report.Add("Kubeconfig", k8s.CheckFail, "%v", err)
+                return nil
+        }
+        if contextName == "" {
+                contextName = info.CurrentContext
+        }
+        found := false
+        for _, c := range info.Contexts {
+                found = found || c.Name == contextName
+        }
+        if !found {
+                report.Add("Kubeconfig", k8s.CheckFail, "%s has no context %q", kubeconfig, contextName)
+                return nil
+        }
+        client, err := k8s.NewClientWithContext(kubeconfig, contextName)
+        if err != nil {
+                report.Add("Kubeconfig", k8s.CheckFail, "%v", err)
+                return nil
+        }
+        report.Context = contextName
+        report.Add("Kubeconfig", k8s.CheckPass, "loaded %s, context %q", kubeconfig, contextName)
+        return client
+}
+
+func printDoctorReport(w io.Writer, report *k8s.DoctorReport) {
+        fmt.Fprintf(w, "KubeBrowser readiness report — context %q, namespace %q\n\n", report.Context, report.Namespace)
+        width := 0
+        for _, c := range report.Checks {
+                if len(c.Name) > width {
+                        width = len(c.Name)
+                }
+        }
+        for _, c := range report.Checks {
+                fmt.Fprintf(w, "  [%-4s] %-*s  %s\n", c.Status, width, c.Name, c.Detail)
+        }
+        if report.Ready() {
+                fmt.Fprintln(w, "\nReady.")
+        } else {
+                fmt.Fprintln(w, "\nNot ready: fix the failed checks above.")
+        }
+}
+
+func signalContext() (context.Context, context.CancelFunc) {
+        return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
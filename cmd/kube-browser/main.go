@@ -3,6 +3,7 @@ package main
 import (
         "context"
         "embed"
+        "flag"
         "fmt"
         "log"
         "net/http"
@@ -14,6 +15,7 @@ import (
 
         "kube-browser/pkg/browser"
         "kube-browser/pkg/handlers"
+        "kube-browser/pkg/k8s"
 )
 
 //go:embed all:static
@@ -32,6 +34,20 @@ func envDuration(key string, defaultSec int) time.Duration {
 }
 
 func main() {
+        if len(os.Args) > 1 && os.Args[1] == "rbac" {
+                os.Exit(runRBAC(os.Args[2:]))
+        }
+        if len(os.Args) > 1 && os.Args[1] == "doctor" {
+                os.Exit(runDoctor(os.Args[2:]))
+        }
+        if len(os.Args) > 1 && os.Args[1] == "config" {
+                os.Exit(runConfig(os.Args[2:]))
+        }
+
+        minimal := flag.Bool("minimal", false, "read-only exec listing and downloads only: never create helper pods or run background cluster scans")
+        demo := flag.Bool("demo", false, "serve a built-in in-memory cluster instead of connecting to one, for demos and end-to-end tests")
+        flag.Parse()
+
         port := os.Getenv("PORT")
         if port == "" {
                 port = "5000"
@@ -48,6 +64,21 @@ func main() {
         shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", 10)
 
         h := handlers.New(staticFiles, templateFiles)
+        if *minimal {
+                h.EnableMinimalMode()
+        }
+        if *demo {
+                h.EnableDemoMode(k8s.NewSampleDemoCluster())
+        }
+        if err := h.LoadAuthzConfig(); err != nil {
+                log.Fatalf("Error: %v", err)
+        }
+        if err := h.LoadQuotas(); err != nil {
+                log.Fatalf("Error: %v", err)
+        }
+        if err := h.LoadPVCWebhook(); err != nil {
+                log.Fatalf("Error: %v", err)
+        }
 
         mux := http.NewServeMux()
 
@@ -59,16 +90,68 @@ func main() {
         mux.HandleFunc("/api/disconnect", h.DisconnectHandler)
         mux.HandleFunc("/api/namespaces", h.ListNamespacesHandler)
         mux.HandleFunc("/api/pvcs", h.ListPVCsHandler)
-        mux.HandleFunc("/api/files", h.ListFilesHandler)
-        mux.HandleFunc("/api/download", h.DownloadFileHandler)
-        mux.HandleFunc("/api/upload", h.UploadFileHandler)
+        mux.Handle("/api/files", h.Cancelable("list", http.HandlerFunc(h.ListFilesHandler)))
+        mux.HandleFunc("/api/files/operation", h.ListOperationHandler)
+        mux.HandleFunc("/api/complete", h.CompletePathHandler)
+        mux.HandleFunc("/api/resolve-path", h.ResolvePathHandler)
+        mux.Handle("/api/search", h.Cancelable("search", http.HandlerFunc(h.SearchHandler)))
+        mux.HandleFunc("/api/saved-searches", h.SavedSearchesHandler)
+        mux.Handle("/api/saved-searches/run", h.Cancelable("search", http.HandlerFunc(h.RunSavedSearchHandler)))
+        mux.HandleFunc("/api/config/export", h.ConfigExportHandler)
+        mux.HandleFunc("/api/config/import", h.ConfigImportHandler)
+        mux.HandleFunc("/api/pods", h.ListPodsHandler)
+        mux.HandleFunc("/api/container-files", h.ListContainerFilesHandler)
+        mux.HandleFunc("/api/container-file", h.ContainerFileHandler)
+        mux.Handle("/api/download", h.Cancelable("download", http.HandlerFunc(h.DownloadFileHandler)))
+        mux.Handle("/api/download-dir", h.Cancelable("download", http.HandlerFunc(h.DownloadDirHandler)))
+        mux.Handle("/api/download-batch", h.Cancelable("download", http.HandlerFunc(h.DownloadBatchHandler)))
+        mux.HandleFunc("/api/preview", h.PreviewHandler)
+        mux.Handle("/api/checksum", h.Cancelable("checksum", http.HandlerFunc(h.ChecksumHandler)))
+        mux.Handle("/api/compare", h.Cancelable("compare", http.HandlerFunc(h.CompareHandler)))
+        mux.Handle("/api/archive-contents", h.Cancelable("archive-contents", http.HandlerFunc(h.ArchiveContentsHandler)))
+        mux.HandleFunc("/api/archive-member", h.ArchiveMemberHandler)
+        mux.Handle("/api/archive-extract", h.Activity("extract", http.HandlerFunc(h.ArchiveExtractHandler)))
+        mux.HandleFunc("/api/download-archive", h.DownloadArchiveHandler)
+        mux.Handle("/api/delete", h.Activity("delete", http.HandlerFunc(h.DeleteHandler)))
+        mux.HandleFunc("/api/trash", h.TrashHandler)
+        mux.Handle("/api/trash/restore", h.Activity("restore", http.HandlerFunc(h.TrashRestoreHandler)))
+        mux.Handle("/api/trash/purge", h.Activity("delete", http.HandlerFunc(h.TrashPurgeHandler)))
+        mux.Handle("/api/chmod", h.Activity("chmod", http.HandlerFunc(h.ChmodHandler)))
+        mux.Handle("/api/chown", h.Activity("chown", http.HandlerFunc(h.ChownHandler)))
+        mux.Handle("/api/estimate", h.Cancelable("estimate", http.HandlerFunc(h.EstimateHandler)))
+        mux.Handle("/api/du", h.Cancelable("du", http.HandlerFunc(h.DiskUsageHandler)))
+        mux.Handle("/api/move", h.Activity("move", http.HandlerFunc(h.MoveHandler)))
+        mux.Handle("/api/transfer", h.Activity("transfer", http.HandlerFunc(h.TransferHandler)))
+        mux.HandleFunc("/api/panes", h.PanesHandler)
+        mux.Handle("/api/migrate", h.Activity("migrate", http.HandlerFunc(h.MigrateHandler)))
+        mux.Handle("/api/maintenance", h.Activity("maintenance", http.HandlerFunc(h.MaintenanceHandler)))
+        mux.Handle("/api/clone", h.Activity("clone", http.HandlerFunc(h.CloneHandler)))
+        mux.Handle("/api/snapshots", h.Activity("snapshot", http.HandlerFunc(h.SnapshotsHandler)))
+        mux.Handle("/api/snapshots/restore", h.Activity("restore", http.HandlerFunc(h.SnapshotRestoreHandler)))
+        mux.HandleFunc("/api/storage-classes", h.StorageClassesHandler)
+        mux.Handle("/api/jobs", h.Activity("job", http.HandlerFunc(h.JobsHandler)))
+        mux.HandleFunc("/api/cleanup", h.CleanupHandler)
+        mux.HandleFunc("/api/helper-events", h.HelperEventsHandler)
+        mux.HandleFunc("/api/pvc-events", h.PVCEventsHandler)
+        mux.HandleFunc("/api/activity", h.ActivityHandler)
+        mux.Handle("/api/operations", h.Activity("cancel", http.HandlerFunc(h.OperationsHandler)))
+        mux.Handle("/api/file/content", h.Activity("edit", http.HandlerFunc(h.FileContentHandler)))
+        mux.Handle("/api/upload", h.Activity("upload", http.HandlerFunc(h.UploadFileHandler)))
+        mux.Handle("/api/upload-url", h.Activity("upload-url", http.HandlerFunc(h.UploadFromURLHandler)))
+        mux.HandleFunc("/api/kubectl", h.KubectlCommandHandler)
+        mux.HandleFunc("/api/raw-url", h.RawURLHandler)
+        mux.Handle("/raw/", h.Cancelable("download", http.HandlerFunc(h.RawFileHandler)))
         mux.Handle("/api/browse", h.LocalhostOnly(http.HandlerFunc(h.BrowseLocalHandler)))
+        mux.Handle("/api/download-local", h.LocalhostOnly(h.Activity("save-to-server", http.HandlerFunc(h.DownloadToLocalHandler))))
+        mux.Handle("/api/upload-local-dir", h.LocalhostOnly(h.Activity("upload-local-dir", http.HandlerFunc(h.UploadLocalDirHandler))))
+        mux.Handle("/api/tokens", h.LocalhostOnly(http.HandlerFunc(h.APITokensHandler)))
+        mux.Handle("/api/admin/bulk", h.LocalhostOnly(h.Activity("bulk", http.HandlerFunc(h.BulkHandler))))
         mux.Handle("/static/", http.FileServer(http.FS(staticFiles)))
 
         addr := host + ":" + port
         srv := &http.Server{
                 Addr:         addr,
-                Handler:      mux,
+                Handler:      h.TokenAuth(h.GroupAuthz(h.Quotas(mux))),
                 ReadTimeout:  readTimeout,
                 WriteTimeout: writeTimeout,
                 IdleTimeout:  idleTimeout,
@@ -104,4 +187,7 @@ func main() {
         } else {
                 log.Println("Server stopped cleanly")
         }
+        if err := h.DrainCleanup(ctx); err != nil {
+                log.Printf("Warning: %v", err)
+        }
 }
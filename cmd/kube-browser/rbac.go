@@ -0,0 +1,57 @@
+package main
+
+import (
+        "flag"
+        "fmt"
+        "os"
+        "strings"
+
+        "kube-browser/pkg/k8s"
+)
+
+// runRBAC implements "kube-browser rbac generate", which prints the
+// ServiceAccount and least-privilege roles for running in-cluster.
+func runRBAC(args []string) int {
+        if len(args) == 0 || args[0] != "generate" {
+                fmt.Fprintln(os.Stderr, "usage: kube-browser rbac generate [flags]")
+                return 2
+        }
+
+        fs := flag.NewFlagSet("rbac generate", flag.ContinueOnError)
+        name := fs.String("name", "kube-browser", "name of the ServiceAccount, role and binding")
+        namespace := fs.String("namespace", "kube-browser", "namespace KubeBrowser is deployed in")
+        targets := fs.String("target-namespaces", "", "comma-separated namespaces to grant PVC access in (default: all namespaces)")
+        helperPods := fs.Bool("helper-pods", true, "allow creating and deleting helper pods (disable when running with --minimal)")
+        ephemeral := fs.Bool("ephemeral-containers", false, "allow the ephemeral access strategy (add ephemeral containers to the pods mounting a PVC)")
+        migrations := fs.Bool("migrations", false, "allow storage-class migrations (create PVCs and Jobs, read workloads and storage classes)")
+        maintenance := fs.Bool("maintenance", false, "allow maintenance mode (scale Deployments and StatefulSets down and back up)")
+        clone := fs.Bool("clone", false, "allow cloning PVCs (create, watch and delete the target claims; needs --helper-pods)")
+        snapshots := fs.Bool("snapshots", false, "allow browsing snapshots (read VolumeSnapshots, create and delete the claims they are restored to)")
+        if err := fs.Parse(args[1:]); err != nil {
+                return 2
+        }
+
+        opts := k8s.RBACOptions{
+                Name:                *name,
+                Namespace:           *namespace,
+                HelperPods:          *helperPods,
+                EphemeralContainers: *ephemeral,
+                Migrations:          *migrations,
+                Maintenance:         *maintenance,
+                Snapshots:           *snapshots,
+                Clone:               *clone,
+        }
+        for _, ns := range strings.Split(*targets, ",") {
+                if ns = strings.TrimSpace(ns); ns != "" {
+                        opts.TargetNamespaces = append(opts.TargetNamespaces, ns)
+                }
+        }
+
+        manifests, err := k8s.RBACManifests(opts)
+        if err != nil {
+                fmt.Fprintf(os.Stderr, "rbac generate: %v\n", err)
+                return 1
+        }
+        os.Stdout.Write(manifests)
+        return 0
+}
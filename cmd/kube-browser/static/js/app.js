@@ -1,12 +1,74 @@
 const state = {
     connected: false,
     readOnly: false,
+    demo: false,
+    trash: null,
+    apiDegraded: false,
+    // claimEvents streams /api/pvc-events while connected.
+    claimEvents: null,
     namespace: '',
     pvc: '',
     currentPath: '/',
     files: [],
+    // selected holds the paths checked in the file list, for a batch
+    // download.
+    selected: new Set(),
+    credentialWarning: '',
+    sort: loadSortPrefs(),
+    // filter is a glob the server narrows listings to; it is not saved.
+    filter: '',
+    // snapshot is the VolumeSnapshot being browsed instead of the live
+    // claim: {name, claim, source}, where claim is the PVC restored from it.
+    snapshot: null,
+    // largeDirs holds the "pvc:path" of directories found too large to
+    // wait for; they are streamed when opened again.
+    largeDirs: new Set(),
 };
 
+// Listing order is computed server-side; the choice is remembered per browser.
+function loadSortPrefs() {
+    const defaults = { sort: 'natural', caseInsensitive: true, dirsFirst: true, desc: false };
+    try {
+        return { ...defaults, ...JSON.parse(localStorage.getItem('kube-browser.sort') || '{}') };
+    } catch (_) {
+        return defaults;
+    }
+}
+
+function saveSortPrefs() {
+    try {
+        localStorage.setItem('kube-browser.sort', JSON.stringify(state.sort));
+    } catch (_) {}
+}
+
+// Registry mirrors, and the pull secrets that go with them, are remembered
+// per kubeconfig context, since clusters that block docker.io each have
+// their own mirror.
+function loadPerContext(key) {
+    try {
+        return JSON.parse(localStorage.getItem(key) || '{}');
+    } catch (_) {
+        return {};
+    }
+}
+
+function fillRegistryMirror() {
+    $('#registry-mirror').value = loadPerContext('kube-browser.mirrors')[$('#context-select').value] || '';
+    $('#image-pull-secrets').value = loadPerContext('kube-browser.pull-secrets')[$('#context-select').value] || '';
+}
+
+function savePerContext(key, context, value) {
+    const values = loadPerContext(key);
+    if (value) {
+        values[context] = value;
+    } else {
+        delete values[context];
+    }
+    try {
+        localStorage.setItem(key, JSON.stringify(values));
+    } catch (_) {}
+}
+
 const $ = (sel) => document.querySelector(sel);
 const $$ = (sel) => document.querySelectorAll(sel);
 
@@ -24,7 +86,10 @@ async function api(url, options = {}) {
         const res = await fetch(url, options);
         const data = await res.json();
         if (!res.ok) {
-            throw new Error(data.error || 'Request failed');
+            const err = new Error(data.error || 'Request failed');
+            err.kind = data.kind;
+            err.status = res.status;
+            throw err;
         }
         return data;
     } catch (err) {
@@ -53,10 +118,42 @@ async function fetchStatus() {
         if (res.ok) {
             const data = await res.json();
             applyReadOnlyMode(!!data.readOnly);
+            applyCredentialStatus(data.credentials);
+            applyAPIHealth(data.apiServer);
+            applyDemoMode(!!data.demo);
+            state.trash = data.trash || null;
+            $('#trash-btn').classList.toggle('hidden', !state.trash);
         }
     } catch (_) {}
 }
 
+function applyDemoMode(demo) {
+    const wasDemo = state.demo;
+    state.demo = demo;
+    $('#demo-badge').classList.toggle('hidden', !demo);
+    $('#backend-type-group').classList.toggle('hidden', demo);
+    // There is no kubeconfig to pick in demo mode: offer the demo context
+    // straight away.
+    if (demo && !wasDemo && !state.connected) loadKubeconfig();
+}
+
+function applyCredentialStatus(credentials) {
+    const warning = credentials && credentials.warning;
+    if (warning && warning !== state.credentialWarning) {
+        showToast(warning, credentials.expired ? 'error' : 'warning');
+    }
+    state.credentialWarning = warning || '';
+}
+
+// applyAPIHealth warns once when list calls start needing retries, and
+// once more when they have stopped.
+function applyAPIHealth(health) {
+    const degraded = !!(health && health.degraded);
+    if (degraded && !state.apiDegraded) showToast(health.warning, 'warning');
+    if (!degraded && state.apiDegraded) showToast('The Kubernetes API server is answering normally again.', 'info');
+    state.apiDegraded = degraded;
+}
+
 function setConnected(connected) {
     state.connected = connected;
     const indicator = $('#status-indicator');
@@ -70,12 +167,33 @@ function setConnected(connected) {
     if (connected) {
         mainContent.classList.remove('hidden');
         connectionModal.classList.add('hidden');
+        followClaims();
     } else {
         mainContent.classList.add('hidden');
         connectionModal.classList.remove('hidden');
+        if (state.claimEvents) state.claimEvents.close();
+        state.claimEvents = null;
     }
 }
 
+// followClaims reports the claims KubeBrowser created (clones, restored
+// snapshots, migration targets) as they finish provisioning, and reloads
+// the PVC list when one is in the namespace shown.
+function followClaims() {
+    if (!window.EventSource || state.claimEvents) return;
+    // Only events from now on: start after the latest one already reported.
+    fetch('/api/pvc-events').then(r => r.json()).catch(() => ({ last: 0 })).then(({ last }) => {
+        if (!state.connected || state.claimEvents) return;
+        const source = new EventSource(`/api/pvc-events?since=${last || 0}`);
+        source.onmessage = (e) => {
+            const ev = JSON.parse(e.data);
+            showToast(ev.message, ev.phase === 'Bound' ? 'success' : 'warning');
+            if (ev.namespace === state.namespace) loadPVCs(state.namespace);
+        };
+        state.claimEvents = source;
+    });
+}
+
 async function loadKubeconfig() {
     const pathInput = $('#kubeconfig-path');
     const contextSelect = $('#context-select');
@@ -107,6 +225,7 @@ async function loadKubeconfig() {
             });
             contextSelect.disabled = false;
             connectBtn.disabled = false;
+            fillRegistryMirror();
 
             nsSelect.innerHTML = '<option value="">All namespaces</option>';
             const selectedCtx = data.contexts.find(c => c.name === data.current) || data.contexts[0];
@@ -128,9 +247,49 @@ async function loadKubeconfig() {
     }
 }
 
+// Besides clusters, a connection can serve local directories, S3 buckets or
+// SFTP directories; each is browsed like a namespace of PVCs.
+function selectBackendType() {
+    const type = $('#backend-type').value;
+    $$('.backend-fields').forEach(el => el.classList.toggle('hidden', el.id !== `${type}-fields`));
+    $('#connect-btn').disabled = type === 'kubernetes' && !$('#context-select').value;
+}
+
+function splitList(value) {
+    return value.split(',').map(v => v.trim()).filter(Boolean);
+}
+
+function backendConfig(type) {
+    switch (type) {
+    case 'local':
+        return { type, roots: splitList($('#local-roots').value) };
+    case 's3':
+        return { type, s3: {
+            endpoint: $('#s3-endpoint').value.trim(),
+            region: $('#s3-region').value.trim(),
+            accessKey: $('#s3-access-key').value.trim(),
+            secretKey: $('#s3-secret-key').value,
+            buckets: splitList($('#s3-buckets').value),
+        } };
+    case 'sftp':
+        return { type, sftp: {
+            address: $('#sftp-address').value.trim(),
+            user: $('#sftp-user').value.trim(),
+            password: $('#sftp-password').value,
+            privateKey: $('#sftp-private-key').value.trim(),
+            roots: splitList($('#sftp-roots').value),
+        } };
+    }
+    return null;
+}
+
 async function connect() {
     const kubeconfigPath = $('#kubeconfig-path').value;
     const context = $('#context-select').value;
+    const registryMirror = $('#registry-mirror').value.trim();
+    const imagePullSecrets = $('#image-pull-secrets').value.trim();
+    const scope = $('#connect-scope').checked ? $('#connect-namespace-select').value : '';
+    const backend = backendConfig($('#backend-type').value);
     const errorDiv = $('#connection-error');
     const connectBtn = $('#connect-btn');
 
@@ -142,27 +301,29 @@ async function connect() {
         const data = await api('/api/connect', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
+            body: JSON.stringify(backend ? { backend } : {
                 kubeconfigPath: kubeconfigPath,
                 context: context,
+                registryMirror,
+                imagePullSecrets,
+                namespace: scope,
             }),
         });
+        if (!backend) {
+            savePerContext('kube-browser.mirrors', context, registryMirror);
+            savePerContext('kube-browser.pull-secrets', context, imagePullSecrets);
+        }
 
         setConnected(true);
-        showToast('Connected to Kubernetes cluster', 'success');
+        showToast(backend ? `Connected to ${data.context}` : 'Connected to Kubernetes cluster', 'success');
 
         const nsSelect = $('#namespace-select');
-        nsSelect.innerHTML = '<option value="">Select namespace...</option>';
-        if (data.namespaces) {
-            data.namespaces.forEach(ns => {
-                const opt = document.createElement('option');
-                opt.value = ns;
-                opt.textContent = ns;
-                nsSelect.appendChild(opt);
-            });
-        }
+        fillNamespaceSelect(nsSelect, data.namespaces, data.namespacesRestricted);
+        if (data.namespacesRestricted) showToast(data.message, 'info');
 
-        const selectedNs = $('#connect-namespace-select').value;
+        // Storage backends have a single namespace: open it right away.
+        const selectedNs = $('#connect-namespace-select').value ||
+            (backend && data.namespaces && data.namespaces.length === 1 ? data.namespaces[0] : '');
         if (selectedNs) {
             nsSelect.value = selectedNs;
             state.namespace = selectedNs;
@@ -183,6 +344,7 @@ async function connect() {
 
 async function disconnect() {
     try {
+        leaveSnapshot();
         await api('/api/disconnect', { method: 'POST' });
         setConnected(false);
         showToast('Disconnected from cluster', 'info');
@@ -195,6 +357,8 @@ async function disconnect() {
         $('#pvc-list').innerHTML = '<div class="empty-state">Select a namespace</div>';
         $('#upload-btn').disabled = true;
         $('#refresh-btn').disabled = true;
+        state.selected.clear();
+        updateBatchDownload();
 
         $('#disconnect-btn').classList.add('hidden');
         $('#connect-btn').classList.remove('hidden');
@@ -203,19 +367,34 @@ async function disconnect() {
     }
 }
 
+// OTHER_NAMESPACE is the option that asks for a namespace by name, offered
+// when the account may not list namespaces but can work within some.
+const OTHER_NAMESPACE = '\u0000other';
+
+function addNamespaceOption(select, ns) {
+    const opt = document.createElement('option');
+    opt.value = ns;
+    opt.textContent = ns;
+    const other = select.querySelector(`option[value="${OTHER_NAMESPACE}"]`);
+    select.insertBefore(opt, other);
+}
+
+function fillNamespaceSelect(select, namespaces, restricted) {
+    select.innerHTML = '<option value="">Select namespace...</option>';
+    if (restricted) {
+        const other = document.createElement('option');
+        other.value = OTHER_NAMESPACE;
+        other.textContent = 'Other namespace…';
+        select.appendChild(other);
+    }
+    (namespaces || []).forEach(ns => addNamespaceOption(select, ns));
+}
+
 async function loadNamespaces() {
     const select = $('#namespace-select');
     try {
         const data = await api('/api/namespaces');
-        select.innerHTML = '<option value="">Select namespace...</option>';
-        if (data.namespaces) {
-            data.namespaces.forEach(ns => {
-                const opt = document.createElement('option');
-                opt.value = ns;
-                opt.textContent = ns;
-                select.appendChild(opt);
-            });
-        }
+        fillNamespaceSelect(select, data.namespaces, data.namespacesRestricted);
     } catch (e) {
         select.innerHTML = '<option value="">Failed to load</option>';
     }
@@ -226,23 +405,39 @@ async function loadPVCs(namespace) {
     list.innerHTML = '<div class="loading"><div class="spinner"></div></div>';
 
     try {
-        const data = await api(`/api/pvcs?namespace=${encodeURIComponent(namespace)}`);
+        const [data, maintenance] = await Promise.all([
+            api(`/api/pvcs?namespace=${encodeURIComponent(namespace)}`),
+            // Listing sessions needs access to Deployments and StatefulSets;
+            // without it the PVCs are listed all the same.
+            fetch(`/api/maintenance?namespace=${encodeURIComponent(namespace)}`).then(r => r.ok ? r.json() : {}).catch(() => ({})),
+        ]);
         if (!data.pvcs || data.pvcs.length === 0) {
             list.innerHTML = '<div class="empty-state">No PVCs found</div>';
             return;
         }
+        const sessions = {};
+        (maintenance.sessions || []).forEach(m => { sessions[m.pvc] = m; });
 
         list.innerHTML = '';
         data.pvcs.forEach(pvc => {
             const item = document.createElement('div');
             item.className = 'pvc-item';
             item.dataset.name = pvc.name;
+            // Reloads (a claim got bound) keep the open PVC highlighted.
+            if (pvc.name === state.pvc) item.classList.add('active');
 
             const statusClass = pvc.status === 'Bound' ? 'bound' : 'pending';
             const mountInfo = pvc.mountedBy ? `Pod: ${pvc.mountedBy}` : 'Not mounted';
+            const ephemeral = pvc.ownerPod
+                ? `<span class="pvc-ephemeral" title="Ephemeral volume of pod ${escapeHtml(pvc.ownerPod)}, deleted with it">ephemeral</span>`
+                : '';
+            const session = sessions[pvc.name];
+            const inMaintenance = session
+                ? `<span class="pvc-ephemeral pvc-maintenance" title="${escapeHtml(maintenanceSummary(session))}">maintenance until ${new Date(session.until).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}</span>`
+                : '';
 
             item.innerHTML = `
-                <div class="pvc-item-name">${pvc.name}</div>
+                <div class="pvc-item-name">${pvc.name}${ephemeral}${inMaintenance}</div>
                 <div class="pvc-item-meta">
                     <span class="pvc-status">
                         <span class="pvc-status-dot ${statusClass}"></span>
@@ -252,8 +447,35 @@ async function loadPVCs(namespace) {
                 </div>
                 <div class="pvc-item-meta" style="margin-top:2px">
                     <span>${mountInfo}</span>
+                    <span>${pvc.storageClass || ''}</span>
                 </div>
             `;
+            if (!state.readOnly) {
+                const actions = document.createElement('div');
+                actions.className = 'pvc-actions';
+                const cloneBtn = document.createElement('button');
+                cloneBtn.className = 'btn btn-icon btn-small';
+                cloneBtn.textContent = '⧉';
+                cloneBtn.title = 'Clone into another namespace';
+                cloneBtn.addEventListener('click', (e) => { e.stopPropagation(); clonePVC(pvc); });
+                actions.appendChild(cloneBtn);
+                const migrateBtn = document.createElement('button');
+                migrateBtn.className = 'btn btn-icon btn-small';
+                migrateBtn.textContent = '⇄';
+                migrateBtn.title = 'Migrate to another storage class';
+                migrateBtn.addEventListener('click', (e) => { e.stopPropagation(); migratePVC(pvc); });
+                if (!pvc.ownerPod) actions.appendChild(migrateBtn);
+                const maintenanceBtn = document.createElement('button');
+                maintenanceBtn.className = 'btn btn-icon btn-small';
+                maintenanceBtn.textContent = session ? '▶' : '⏸';
+                maintenanceBtn.title = session ? 'End maintenance and scale the workloads back up' : 'Maintenance mode: scale down the workloads for exclusive access';
+                maintenanceBtn.addEventListener('click', (e) => {
+                    e.stopPropagation();
+                    if (session) endMaintenance(session); else startMaintenance(pvc);
+                });
+                if (!pvc.ownerPod) actions.appendChild(maintenanceBtn);
+                item.appendChild(actions);
+            }
 
             item.addEventListener('click', () => selectPVC(pvc.name));
             list.appendChild(item);
@@ -264,6 +486,7 @@ async function loadPVCs(namespace) {
 }
 
 function selectPVC(pvcName) {
+    leaveSnapshot();
     state.pvc = pvcName;
     state.currentPath = '/';
 
@@ -275,27 +498,298 @@ function selectPVC(pvcName) {
         $('#upload-btn').disabled = false;
     }
     $('#refresh-btn').disabled = false;
+    $('#save-search-btn').disabled = false;
+    $('#compare-btn').disabled = false;
+    $('#export-select').disabled = false;
+    $('#trash-btn').disabled = false;
+    $('#path-input').disabled = false;
 
     loadFiles();
+    loadSnapshots();
+}
+
+// Snapshots of the open claim fill the toolbar's Live/snapshot picker,
+// which stays hidden when there are none or the cluster has no
+// VolumeSnapshot API.
+async function loadSnapshots() {
+    const select = $('#snapshot-select');
+    select.innerHTML = '<option value="">Live</option>';
+    select.classList.add('hidden');
+    const pvc = state.pvc;
+    try {
+        const res = await fetch(`/api/snapshots?namespace=${encodeURIComponent(state.namespace)}&pvc=${encodeURIComponent(pvc)}`);
+        if (!res.ok) return;
+        const data = await res.json();
+        if (state.pvc !== pvc || !data.snapshots.length) return;
+        data.snapshots.forEach(snap => {
+            const option = document.createElement('option');
+            option.value = snap.name;
+            option.textContent = `${snap.name} — ${new Date(snap.created).toLocaleString()}${snap.readyToUse ? '' : ' (not ready)'}`;
+            option.disabled = !snap.readyToUse;
+            select.appendChild(option);
+        });
+        select.classList.remove('hidden');
+    } catch (_) {}
+}
+
+// switchSnapshot flips the browser between the live claim ('') and a
+// snapshot, restored into a claim of its own on the first visit. The path
+// stays the same, to compare a file across points in time.
+async function switchSnapshot(name) {
+    const select = $('#snapshot-select');
+    const source = state.snapshot ? state.snapshot.source : state.pvc;
+    if (!name) {
+        leaveSnapshot();
+        state.pvc = source;
+        if (!state.readOnly) $('#upload-btn').disabled = false;
+        loadFiles();
+        return;
+    }
+    select.disabled = true;
+    try {
+        const claim = await api('/api/snapshots', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, snapshot: name }),
+        });
+        leaveSnapshot();
+        state.snapshot = { name, claim: claim.pvc, source };
+        state.pvc = claim.pvc;
+        $('#upload-btn').disabled = true;
+        showToast(`Browsing ${source} as of snapshot ${name}; the first listing waits for the volume to be restored`, 'info');
+        loadFiles();
+    } catch (_) {
+        select.value = state.snapshot ? state.snapshot.name : '';
+    } finally {
+        select.disabled = false;
+    }
+}
+
+// leaveSnapshot deletes the claim restored for the snapshot being browsed.
+function leaveSnapshot() {
+    if (!state.snapshot) return;
+    const { claim } = state.snapshot;
+    state.snapshot = null;
+    fetch(`/api/snapshots?namespace=${encodeURIComponent(state.namespace)}&pvc=${encodeURIComponent(claim)}`, { method: 'DELETE' }).catch(() => {});
+}
+
+// Shows what a helper pod is doing (scheduling, pulling its image) under
+// the spinner while a listing waits on one. Returns a function that stops.
+function followHelperEvents(container) {
+    if (!window.EventSource) return () => {};
+    const log = document.createElement('div');
+    log.className = 'helper-log';
+    container.appendChild(log);
+    let source = null;
+    let stopped = false;
+    const params = new URLSearchParams({ namespace: state.namespace, pvc: state.pvc });
+    // Only events from now on: start after the latest one already reported.
+    fetch(`/api/helper-events?${params}`).then(r => r.json()).catch(() => ({ last: 0 })).then(({ last }) => {
+        if (stopped) return;
+        params.set('since', last || 0);
+        source = new EventSource(`/api/helper-events?${params}`);
+        source.onmessage = (e) => {
+            const ev = JSON.parse(e.data);
+            const line = document.createElement('div');
+            if (ev.warning) line.className = 'warning';
+            line.textContent = ev.message;
+            log.appendChild(line);
+        };
+    });
+    return () => {
+        stopped = true;
+        if (source) source.close();
+    };
+}
+
+// listFiles fetches a listing that may be answered with an operation to
+// poll, when a helper pod has to start first.
+async function listFiles(params) {
+    let data = await api(`/api/files?${params}`);
+    while (data.status === 'running') {
+        await new Promise(resolve => setTimeout(resolve, 1000));
+        data = await api(`/api/files/operation?id=${encodeURIComponent(data.operation.id)}`);
+    }
+    return data;
+}
+
+// Directories with at least this many entries are streamed the next time
+// they are opened, so rows show up while the pod is still listing.
+const STREAM_LISTING_THRESHOLD = 5000;
+
+// streamFiles reads /api/files as NDJSON, handing each batch of entries to
+// onFiles as it arrives, and returns the last line ({done, count, total,
+// filesystem}).
+async function streamFiles(params, onFiles) {
+    params = new URLSearchParams(params);
+    params.delete('async');
+    params.set('stream', 'true');
+    return streamLines(`/api/files?${params}`, onFiles);
 }
 
-async function loadFiles() {
+// streamLines reads an NDJSON answer (a listing, a search, a du run),
+// handing each batch of lines to onLines as it arrives, and returns the
+// last line, which has "done". A line with "error" fails it; the lines
+// before it were already handed over.
+async function streamLines(url, onLines) {
+    const res = await fetch(url);
+    if (!res.ok) {
+        const data = await res.json().catch(() => ({}));
+        const err = new Error(data.error || 'Request failed');
+        err.kind = data.kind;
+        showToast(err.message, err.kind === 'Canceled' ? 'warning' : 'error');
+        throw err;
+    }
+    const reader = res.body.getReader();
+    const decoder = new TextDecoder();
+    let buffered = '';
+    for (;;) {
+        const { done, value } = await reader.read();
+        buffered += decoder.decode(value || new Uint8Array(), { stream: !done });
+        const lines = buffered.split('\n');
+        buffered = done ? '' : lines.pop();
+        const batch = [];
+        for (const line of lines) {
+            if (!line) continue;
+            const entry = JSON.parse(line);
+            if (entry.error) {
+                if (batch.length) onLines(batch);
+                const err = new Error(entry.error);
+                err.kind = entry.kind;
+                showToast(err.message, entry.canceled ? 'warning' : 'error');
+                throw err;
+            }
+            if (entry.done) {
+                if (batch.length) onLines(batch);
+                return entry;
+            }
+            batch.push(entry);
+        }
+        if (batch.length) onLines(batch);
+        if (done) throw new Error('The answer ended early');
+    }
+}
+
+// loadStreamedFiles lists a large directory, appending rows as they come.
+// The rows stay in the order the pod lists them.
+async function loadStreamedFiles(params) {
+    const container = $('#file-table-container');
+    const current = () => state.pvc === params.get('pvc') && state.currentPath === params.get('path');
+    let tbody = null;
+    const trailer = await streamFiles(params, files => {
+        if (!current()) return;
+        if (!tbody) {
+            state.selected.clear();
+            updateBatchDownload();
+            container.innerHTML = fileTableHtml('');
+            tbody = container.querySelector('tbody');
+        }
+        tbody.insertAdjacentHTML('beforeend', files.map(fileRowHtml).join(''));
+    });
+    if (!current()) return null;
+    if (!tbody) renderFiles([]);
+    return trailer;
+}
+
+// Error kinds for a volume whose filesystem is failing, with a heading.
+const FILESYSTEM_ERROR_KINDS = new Map([
+    ['IOError', 'The volume returned I/O errors'],
+    ['ReadOnlyFS', 'The volume is mounted read-only'],
+    ['StaleHandle', 'The volume\'s network filesystem is unreachable'],
+]);
+
+// refresh skips the server's cache of recent listings, to see changes made
+// from inside the pods.
+async function loadFiles({ refresh = false } = {}) {
     const container = $('#file-table-container');
     container.innerHTML = '<div class="loading"><div class="spinner"></div></div>';
+    const stopHelperEvents = followHelperEvents(container);
 
     try {
         const params = new URLSearchParams({
             namespace: state.namespace,
             pvc: state.pvc,
             path: state.currentPath,
+            sort: state.sort.sort,
+            caseInsensitive: state.sort.caseInsensitive,
+            dirsFirst: state.sort.dirsFirst,
+            desc: state.sort.desc,
+            async: true,
+            df: true,
         });
-
-        const data = await api(`/api/files?${params}`);
-        renderFiles(data.files || []);
+        if (state.filter) params.set('filter', state.filter);
+        if (refresh) params.set('refresh', 'true');
+
+        const dirKey = `${state.pvc}:${state.currentPath}`;
+        if (state.largeDirs.has(dirKey)) {
+            const trailer = await loadStreamedFiles(params);
+            if (!trailer) return;
+            renderFilesystemUsage(trailer.filesystem);
+            $('#listing-filter').title = (trailer.total === undefined ? '' : `${trailer.count} of ${trailer.total} entries match · `) +
+                'Streamed in the order the volume lists them';
+        } else {
+            const data = await listFiles(params);
+            if (state.pvc !== params.get('pvc') || state.currentPath !== params.get('path')) return;
+            renderFilesystemUsage(data.filesystem);
+            state.selected.clear();
+            updateBatchDownload();
+            renderFiles(data.files || []);
+            if (data.truncated) showMoreFiles(params, data);
+            $('#listing-filter').title = data.total === undefined ? '' : `${(data.files || []).length} of ${data.total} entries match`;
+            if ((data.total ?? (data.files || []).length + (data.remaining || 0)) >= STREAM_LISTING_THRESHOLD) state.largeDirs.add(dirKey);
+        }
         updateBreadcrumb();
+        $('#path-input').value = state.currentPath;
     } catch (e) {
+        if (FILESYSTEM_ERROR_KINDS.has(e.kind)) {
+            // The volume itself is failing: say how, not just that listing did.
+            container.innerHTML = `<div class="empty-state-large fs-error"><p>${escapeHtml(FILESYSTEM_ERROR_KINDS.get(e.kind))}</p><p class="fs-error-hint">${escapeHtml(e.message)}</p></div>`;
+            return;
+        }
         container.innerHTML = '<div class="empty-state-large"><p>Failed to load files</p></div>';
+    } finally {
+        stopHelperEvents();
+    }
+}
+
+// showMoreFiles puts the warning of a listing cut at the server's limit
+// under its table, with a button appending the next page.
+function showMoreFiles(params, data) {
+    const container = $('#file-table-container');
+    container.insertAdjacentHTML('beforeend', `<div class="listing-more"><span>${escapeHtml(data.warning)}</span><button class="btn btn-secondary">Load more</button></div>`);
+    const more = container.querySelector('.listing-more');
+    more.querySelector('button').onclick = async () => {
+        more.remove();
+        const next = new URLSearchParams(params);
+        next.delete('df');
+        next.delete('refresh');
+        next.set('continue', data.continue);
+        try {
+            const page = await listFiles(next);
+            if (state.pvc !== params.get('pvc') || state.currentPath !== params.get('path')) return;
+            container.querySelector('tbody').insertAdjacentHTML('beforeend', (page.files || []).map(fileRowHtml).join(''));
+            if (page.truncated) showMoreFiles(params, page);
+        } catch {
+            // api() reported the error; offer the same page again.
+            showMoreFiles(params, data);
+        }
+    };
+}
+
+// renderFilesystemUsage shows how full the volume's filesystem is, which
+// can differ from the capacity the claim requested.
+function renderFilesystemUsage(fs) {
+    const el = $('#fs-usage');
+    if (!fs || !fs.totalBytes) {
+        el.hidden = true;
+        return;
     }
+    const pct = Math.round(fs.usedBytes * 100 / fs.totalBytes);
+    el.textContent = `${formatSize(fs.usedBytes)} of ${formatSize(fs.totalBytes)} used (${pct}%)`;
+    el.title = `${formatSize(fs.availableBytes)} available` +
+        (fs.inodes ? ` · ${fs.inodesUsed} of ${fs.inodes} inodes used` : '');
+    el.classList.toggle('fs-usage-full', pct >= 90);
+    el.hidden = false;
 }
 
 function renderFiles(files) {
@@ -314,55 +808,217 @@ function renderFiles(files) {
         return;
     }
 
-    const folderIcon = `<svg class="file-icon folder" viewBox="0 0 20 20" fill="currentColor"><path d="M2 4a2 2 0 0 1 2-2h3.17a2 2 0 0 1 1.41.59l1.42 1.41H16a2 2 0 0 1 2 2v10a2 2 0 0 1-2 2H4a2 2 0 0 1-2-2V4z"/></svg>`;
-    const fileIcon = `<svg class="file-icon file" viewBox="0 0 20 20" fill="currentColor"><path fill-rule="evenodd" d="M4 2a2 2 0 0 0-2 2v12a2 2 0 0 0 2 2h12a2 2 0 0 0 2-2V7.414A2 2 0 0 0 17.414 6L14 2.586A2 2 0 0 0 12.586 2H4zm8 1.414L15.586 7H13a1 1 0 0 1-1-1V3.414zM4 4h6v2a3 3 0 0 0 3 3h2v7H4V4z"/></svg>`;
+    container.innerHTML = fileTableHtml(files.map(fileRowHtml).join(''));
+}
 
-    let html = `
+function fileTableHtml(rows) {
+    return `
         <table class="file-table">
             <thead>
                 <tr>
+                    <th class="select-col"><input type="checkbox" title="Select all" onchange="selectAllFiles(this.checked)"></th>
                     <th>Name</th>
                     <th>Size</th>
                     <th>Modified</th>
+                    <th>Permissions</th>
                     <th style="text-align:right">Actions</th>
                 </tr>
             </thead>
-            <tbody>
+            <tbody>${rows}</tbody>
+        </table>
     `;
+}
 
-    const sortedFiles = [...files].sort((a, b) => {
-        if (a.isDir !== b.isDir) return a.isDir ? -1 : 1;
-        return a.name.localeCompare(b.name);
-    });
+const FOLDER_ICON = `<svg class="file-icon folder" viewBox="0 0 20 20" fill="currentColor"><path d="M2 4a2 2 0 0 1 2-2h3.17a2 2 0 0 1 1.41.59l1.42 1.41H16a2 2 0 0 1 2 2v10a2 2 0 0 1-2 2H4a2 2 0 0 1-2-2V4z"/></svg>`;
+const FILE_ICON = `<svg class="file-icon file" viewBox="0 0 20 20" fill="currentColor"><path fill-rule="evenodd" d="M4 2a2 2 0 0 0-2 2v12a2 2 0 0 0 2 2h12a2 2 0 0 0 2-2V7.414A2 2 0 0 0 17.414 6L14 2.586A2 2 0 0 0 12.586 2H4zm8 1.414L15.586 7H13a1 1 0 0 1-1-1V3.414zM4 4h6v2a3 3 0 0 0 3 3h2v7H4V4z"/></svg>`;
+
+function fileRowHtml(file) {
+    const icon = file.isDir ? FOLDER_ICON : FILE_ICON;
+    const downloadBtn = `
+        <button class="btn btn-secondary" ${file.isDir ? 'title="Download the directory as a .tar.gz" ' : ''}onclick="event.stopPropagation(); ${file.isDir ? 'downloadDir' : 'downloadFile'}(${jsArg(file.path)})">
+            <svg viewBox="0 0 20 20" width="14" height="14" fill="currentColor">
+                <path d="M10 13l-5-5h3V3h4v5h3l-5 5zM3 16h14v2H3v-2z"/>
+            </svg>
+            Download
+        </button>
+    `;
+    const contentsBtn = file.isDir || !isListableArchive(file.name) ? '' : `
+        <button class="btn btn-secondary" title="List the archive's contents without extracting it" onclick="event.stopPropagation(); showArchiveContents(${jsArg(file.path)})">
+            Contents
+        </button>
+    `;
+    const previewBtn = file.isDir || !isPreviewable(file.name) ? '' : `
+        <button class="btn btn-secondary" title="Render the file here" onclick="event.stopPropagation(); showPreview(${jsArg(file.path)})">
+            Preview
+        </button>
+    `;
+    const moveBtn = state.readOnly ? '' : `
+        <button class="btn btn-secondary" title="Move to another PVC in this cluster" onclick="event.stopPropagation(); moveToPVC(${jsArg(file.path)})">
+            Move
+        </button>
+    `;
+    const renameBtn = state.readOnly ? '' : `
+        <button class="btn btn-secondary" title="Rename or move within this PVC" onclick="event.stopPropagation(); renameEntry(${jsArg(file.path)})">
+            Rename
+        </button>
+    `;
+    const permsBtn = state.readOnly ? '' : `
+        <button class="btn btn-secondary" title="Change mode or owner (chmod/chown)" onclick="event.stopPropagation(); changePermissions(${jsArg(file.path)}, ${file.isDir}, ${jsArg(file.uid !== undefined ? `${file.uid}:${file.gid || ''}` : '')})">
+            Permissions
+        </button>
+    `;
+    const deleteBtn = state.readOnly ? '' : `
+        <button class="btn btn-secondary" title="Delete from this PVC" onclick="event.stopPropagation(); deleteEntry(${jsArg(file.path)}, ${file.isDir})">
+            Delete
+        </button>
+    `;
+    const linkBtn = file.isDir ? '' : `
+        <button class="btn btn-secondary" title="Copy a URL other tools can open this file from" onclick="event.stopPropagation(); copyRawLink(${jsArg(file.path)})">
+            Copy link
+        </button>
+    `;
+    const restoreBtn = !state.snapshot || state.readOnly ? '' : `
+        <button class="btn btn-secondary" title="Copy back onto ${escapeHtml(state.snapshot.source)} as it is in this snapshot" onclick="event.stopPropagation(); restoreFromSnapshot(${jsArg(file.path)})">
+            Restore
+        </button>
+    `;
+    const saveLocalBtn = `
+        <button class="btn btn-secondary" title="Save into a directory on the KubeBrowser host" onclick="event.stopPropagation(); openSaveToServer(${jsArg(file.path)}, ${file.isDir})">
+            Save on server
+        </button>
+    `;
 
-    sortedFiles.forEach(file => {
-        const icon = file.isDir ? folderIcon : fileIcon;
-        const downloadBtn = file.isDir ? '' : `
-            <button class="btn btn-secondary" onclick="event.stopPropagation(); downloadFile('${escapeHtml(file.path)}')">
-                <svg viewBox="0 0 20 20" width="14" height="14" fill="currentColor">
-                    <path d="M10 13l-5-5h3V3h4v5h3l-5 5zM3 16h14v2H3v-2z"/>
-                </svg>
-                Download
-            </button>
-        `;
+    return `
+        <tr onclick="${file.isDir ? `navigateTo(${jsArg(file.path)})` : file.symlink ? `jumpToPath(${jsArg(file.path)})` : ''}"${file.symlink ? ' class="symlink-row" title="Open where the link leads"' : ''}>
+            <td class="select-col" onclick="event.stopPropagation()"><input type="checkbox" class="file-select" data-path="${escapeHtml(file.path)}" onchange="toggleFileSelection(this)"></td>
+            <td>
+                <div class="file-name">
+                    ${icon}
+                    <span>${escapeHtml(displayName(file.name))}</span>
+                    ${file.symlink ? `<span class="link-target" title="Symbolic link">→ ${escapeHtml(displayName(file.linkTarget || '?'))}</span>` : ''}
+                </div>
+            </td>
+            <td>${file.isDir ? '-' : formatSize(file.size)}</td>
+            <td title="${escapeHtml(file.modTime || '')}">${formatModTime(file.modTime)}</td>
+            <td class="file-mode" title="${file.uid !== undefined ? `owner ${escapeHtml(file.uid)}, group ${escapeHtml(file.gid || '?')}` : ''}">${escapeHtml(file.mode || '-')}${file.uid !== undefined ? ` ${escapeHtml(file.uid)}:${escapeHtml(file.gid || '?')}` : ''}</td>
+            <td class="file-actions">${previewBtn}${contentsBtn}${downloadBtn}${linkBtn}${saveLocalBtn}${restoreBtn}${renameBtn}${permsBtn}${moveBtn}${deleteBtn}</td>
+        </tr>
+    `;
+}
 
-        html += `
-            <tr onclick="${file.isDir ? `navigateTo('${escapeHtml(file.path)}')` : ''}">
-                <td>
-                    <div class="file-name">
-                        ${icon}
-                        <span>${escapeHtml(file.name)}</span>
-                    </div>
-                </td>
-                <td>${file.isDir ? '-' : formatSize(file.size)}</td>
-                <td>${file.modTime}</td>
-                <td class="file-actions">${downloadBtn}</td>
-            </tr>
-        `;
-    });
+// Mirrors the extensions accepted by /api/archive-contents.
+function isListableArchive(name) {
+    return /\.(tar|tar\.gz|tgz|tar\.bz2|tbz2?|tar\.xz|txz|zip|jar|war)$/i.test(name);
+}
+
+async function showArchiveContents(path) {
+    const modal = $('#details-modal');
+    const list = $('#details-list');
+    const extractBtn = $('#archive-extract-btn');
+    state.archivePath = path;
+    extractBtn.disabled = true;
+    extractBtn.classList.toggle('hidden', state.readOnly);
+    $('#archive-overwrite').parentElement.classList.toggle('hidden', state.readOnly);
+    $('#details-title').textContent = path.split('/').pop();
+    $('#details-summary').textContent = '';
+    $('#details-summary').classList.remove('details-error');
+    list.innerHTML = '<div class="loading"><div class="spinner"></div></div>';
+    modal.classList.remove('hidden');
+
+    try {
+        const params = new URLSearchParams({ namespace: state.namespace, pvc: state.pvc, path });
+        const data = await api(`/api/archive-contents?${params}`);
+        const entries = data.entries || [];
+        state.archiveEntries = entries;
+        const files = entries.filter(e => !e.isDir);
+        const total = files.reduce((sum, e) => sum + e.size, 0);
+        $('#details-summary').textContent = `${data.format} · ${files.length}${data.truncated ? '+' : ''} files · ${formatSize(total)} uncompressed` +
+            (data.truncated ? ' (first entries only)' : '');
+        if (entries.length === 0) {
+            list.innerHTML = '<div class="empty-state">The archive is empty</div>';
+            return;
+        }
+        list.innerHTML = `<table class="file-table"><thead><tr><th></th><th>Name</th><th>Size</th><th>Modified</th><th></th></tr></thead><tbody>` +
+            entries.map((e, i) => `<tr>
+                <td><input type="checkbox" class="archive-member" value="${i}"></td>
+                <td>${escapeHtml(displayName(e.name))}</td>
+                <td>${e.isDir ? '-' : formatSize(e.size)}</td>
+                <td>${formatModTime(e.modTime)}</td>
+                <td class="file-actions">${e.isDir ? '' : `<button class="btn btn-secondary btn-small" onclick="downloadArchiveMember(${jsArg(path)}, ${jsArg(e.name)})">Download</button>`}</td>
+            </tr>`).join('') +
+            '</tbody></table>';
+        list.querySelectorAll('.archive-member').forEach(cb => cb.addEventListener('change', () => {
+            extractBtn.disabled = !list.querySelector('.archive-member:checked');
+        }));
+    } catch (_) {
+        list.innerHTML = '<div class="empty-state">Could not read the archive</div>';
+    }
+}
+
+// Mirrors the extensions preview.KindFor gives a renderer.
+function isPreviewable(name) {
+    return /\.(md|markdown|json|ya?ml|ipynb)$/i.test(name);
+}
+
+// showPreview renders a file in the details modal. Markdown and notebooks
+// arrive as HTML the server already sanitized; everything else is text.
+async function showPreview(path) {
+    const list = $('#details-list');
+    $('#archive-extract-btn').classList.add('hidden');
+    $('#archive-overwrite').parentElement.classList.add('hidden');
+    $('#details-title').textContent = path.split('/').pop();
+    $('#details-summary').textContent = '';
+    list.innerHTML = '<div class="loading"><div class="spinner"></div></div>';
+    $('#details-modal').classList.remove('hidden');
+
+    try {
+        const params = new URLSearchParams({ namespace: state.namespace, pvc: state.pvc, path });
+        const data = await api(`/api/preview?${params}`);
+        const p = data.preview;
+        let summary = p.kind;
+        if (p.error) {
+            summary += ` · parse error at line ${p.error.line}${p.error.column ? `, column ${p.error.column}` : ''}: ${p.error.message}`;
+        }
+        if (data.truncated) summary += ' · first 1 MiB only';
+        $('#details-summary').textContent = summary;
+        $('#details-summary').classList.toggle('details-error', !!p.error);
+        if (p.html !== undefined && p.html !== '') {
+            list.innerHTML = `<div class="preview-markdown">${p.html}</div>`;
+        } else {
+            const pre = document.createElement('pre');
+            pre.className = 'preview-text';
+            pre.textContent = p.text || '';
+            list.replaceChildren(pre);
+        }
+    } catch (_) {
+        list.innerHTML = '<div class="empty-state">Could not preview the file</div>';
+    }
+}
 
-    html += '</tbody></table>';
-    container.innerHTML = html;
+function downloadArchiveMember(path, member) {
+    const params = new URLSearchParams({ namespace: state.namespace, pvc: state.pvc, path, member });
+    window.location.href = `/api/archive-member?${params}`;
+}
+
+async function extractArchiveMembers() {
+    const members = [...$$('#details-list .archive-member:checked')].map(cb => state.archiveEntries[cb.value].name);
+    if (members.length === 0) return;
+    try {
+        await api('/api/archive-extract', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                namespace: state.namespace,
+                pvc: state.pvc,
+                path: state.archivePath,
+                members,
+                overwrite: $('#archive-overwrite').checked,
+            }),
+        });
+        $('#details-modal').classList.add('hidden');
+        showToast(`Extracting ${members.length} item(s) — progress is shown under Jobs`, 'info');
+        loadJobs();
+    } catch (_) {}
 }
 
 function escapeHtml(str) {
@@ -371,6 +1027,35 @@ function escapeHtml(str) {
     return div.innerHTML.replace(/'/g, "\\'");
 }
 
+// jsArg renders a value as a JavaScript literal for an inline onclick
+// attribute. Unlike escapeHtml it is safe for paths containing newlines,
+// backslashes or quotes.
+function jsArg(value) {
+    return JSON.stringify(value)
+        .replace(/&/g, '&amp;')
+        .replace(/"/g, '&quot;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;');
+}
+
+// displayName shows control characters in file names (newlines, ANSI
+// escapes) as visible C-style escapes instead of letting them garble the
+// listing.
+function displayName(name) {
+    return name.replace(/[\x00-\x1f\x7f]/g, ch => {
+        const named = { '\n': '\\n', '\r': '\\r', '\t': '\\t' };
+        return named[ch] || '\\x' + ch.charCodeAt(0).toString(16).padStart(2, '0');
+    });
+}
+
+// formatModTime shows the server's UTC ISO 8601 timestamps in the
+// browser's local time.
+function formatModTime(modTime) {
+    if (!modTime) return '-';
+    const d = new Date(modTime);
+    return isNaN(d) ? escapeHtml(modTime) : d.toLocaleString();
+}
+
 function formatSize(size) {
     const num = parseInt(size);
     if (isNaN(num)) return size;
@@ -393,7 +1078,7 @@ function updateBreadcrumb() {
         if (i === parts.length - 1) {
             html += `<span class="breadcrumb-item">${escapeHtml(part)}</span>`;
         } else {
-            html += `<span class="breadcrumb-item clickable" onclick="navigateTo('${escapeHtml(currentPath)}')">${escapeHtml(part)}</span>`;
+            html += `<span class="breadcrumb-item clickable" onclick="navigateTo(${jsArg(currentPath)})">${escapeHtml(part)}</span>`;
         }
     });
 
@@ -405,103 +1090,642 @@ function navigateTo(path) {
     loadFiles();
 }
 
-function downloadFile(filePath) {
+async function completePath() {
+    const input = $('#path-input');
     const params = new URLSearchParams({
         namespace: state.namespace,
         pvc: state.pvc,
-        path: filePath,
+        prefix: input.value || '/',
     });
-    window.location.href = `/api/download?${params}`;
+    try {
+        const data = await api(`/api/complete?${params}`);
+        const matches = data.matches || [];
+        input.value = data.common;
+        const base = data.dir.endsWith('/') ? data.dir : data.dir + '/';
+        const list = $('#path-suggestions');
+        list.innerHTML = '';
+        if (matches.length > 1) {
+            matches.forEach(m => {
+                const opt = document.createElement('option');
+                opt.value = base + m.name + (m.isDir ? '/' : '');
+                list.appendChild(opt);
+            });
+        }
+    } catch (_) {}
 }
 
-function initUpload() {
-    const modal = $('#upload-modal');
-    const zone = $('#upload-zone');
-    const input = $('#file-input');
-    const closeBtn = $('#upload-modal-close');
-
-    $('#upload-btn').addEventListener('click', () => {
-        modal.classList.remove('hidden');
-        $('#upload-progress').classList.add('hidden');
-    });
-
-    closeBtn.addEventListener('click', () => {
-        modal.classList.add('hidden');
+async function jumpToPath(path) {
+    const params = new URLSearchParams({
+        namespace: state.namespace,
+        pvc: state.pvc,
+        path,
     });
+    let info;
+    try {
+        info = await api(`/api/resolve-path?${params}`);
+    } catch (_) {
+        return;
+    }
 
-    modal.addEventListener('click', (e) => {
-        if (e.target === modal) modal.classList.add('hidden');
-    });
+    if (!info.exists) {
+        showToast(`${info.path} does not exist; opened ${info.navigatePath} instead`, 'warning');
+    } else if (info.realPath && info.isDir) {
+        // Links are opened by their real path, so the breadcrumb shows
+        // where the files are and a link to an ancestor cannot nest.
+        showToast(`${info.path} is a link; opened ${info.realPath}`, 'info');
+    } else if (info.isDir && !(info.readable && info.executable)) {
+        showToast(`${info.path} is not readable (mode ${info.mode || 'unknown'})`, 'warning');
+    } else if (!info.isDir) {
+        showToast(`${info.fileName} is a file; opened its directory`, 'info');
+    }
+    navigateTo(info.navigatePath);
+}
 
-    zone.addEventListener('click', () => input.click());
+async function loadSavedSearches() {
+    const list = $('#saved-search-list');
+    try {
+        const data = await api('/api/saved-searches');
+        const searches = data.searches || [];
+        if (searches.length === 0) {
+            list.innerHTML = '<div class="empty-state">No saved searches</div>';
+            return;
+        }
+        list.innerHTML = '';
+        searches.forEach(search => {
+            const item = document.createElement('div');
+            item.className = 'pvc-item saved-search-item';
+            item.title = `${search.namespace}/${search.pvc}:${search.query.path} ${search.query.pattern || '*'}`;
+            const name = document.createElement('span');
+            name.className = 'pvc-item-name';
+            name.textContent = search.name;
+            const del = document.createElement('button');
+            del.className = 'btn btn-icon btn-small';
+            del.title = 'Delete saved search';
+            del.textContent = '×';
+            del.addEventListener('click', async (e) => {
+                e.stopPropagation();
+                try {
+                    await api(`/api/saved-searches?id=${encodeURIComponent(search.id)}`, { method: 'DELETE' });
+                    loadSavedSearches();
+                } catch (_) {}
+            });
+            item.appendChild(name);
+            item.appendChild(del);
+            item.addEventListener('click', () => runSavedSearch(search));
+            list.appendChild(item);
+        });
+    } catch (_) {}
+}
 
-    zone.addEventListener('dragover', (e) => {
-        e.preventDefault();
-        zone.classList.add('dragover');
+function initSortControls() {
+    const mode = $('#sort-mode');
+    const caseInsensitive = $('#sort-case-insensitive');
+    const dirsFirst = $('#sort-dirs-first');
+    const desc = $('#sort-desc');
+    mode.value = state.sort.sort;
+    caseInsensitive.checked = state.sort.caseInsensitive;
+    dirsFirst.checked = state.sort.dirsFirst;
+    desc.checked = state.sort.desc;
+
+    const apply = () => {
+        state.sort = { sort: mode.value, caseInsensitive: caseInsensitive.checked, dirsFirst: dirsFirst.checked, desc: desc.checked };
+        saveSortPrefs();
+        if (state.pvc) loadFiles();
+    };
+    [mode, caseInsensitive, dirsFirst, desc].forEach(el => el.addEventListener('change', apply));
+
+    // The filter is applied by the server, once typing pauses.
+    const filter = $('#listing-filter');
+    let timer;
+    filter.addEventListener('input', () => {
+        clearTimeout(timer);
+        timer = setTimeout(() => {
+            state.filter = filter.value.trim();
+            if (state.pvc) loadFiles();
+        }, 300);
     });
+}
 
-    zone.addEventListener('dragleave', () => {
-        zone.classList.remove('dragover');
-    });
+// Browser preferences travel with an exported configuration under
+// "browser", keyed by their localStorage names.
+const BROWSER_SETTINGS = ['kube-browser.sort', 'kube-browser.mirrors', 'kube-browser.pull-secrets'];
 
-    zone.addEventListener('drop', (e) => {
-        e.preventDefault();
-        zone.classList.remove('dragover');
-        if (e.dataTransfer.files.length > 0) {
-            uploadFile(e.dataTransfer.files[0]);
-        }
+async function exportSettings() {
+    const bundle = await api('/api/config/export');
+    bundle.browser = {};
+    BROWSER_SETTINGS.forEach(key => {
+        const value = localStorage.getItem(key);
+        if (value !== null) bundle.browser[key] = JSON.parse(value);
     });
+    const url = URL.createObjectURL(new Blob([JSON.stringify(bundle, null, 2)], { type: 'application/json' }));
+    const link = document.createElement('a');
+    link.href = url;
+    link.download = 'kube-browser-config.json';
+    link.click();
+    URL.revokeObjectURL(url);
+}
 
-    input.addEventListener('change', () => {
-        if (input.files.length > 0) {
-            uploadFile(input.files[0]);
-        }
+async function importSettings(file) {
+    const replace = confirm('Replace your saved searches with the imported ones?\n\nCancel merges them instead.');
+    const data = await api(`/api/config/import?replace=${replace}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: await file.text(),
+    });
+    Object.entries(data.browser || {}).forEach(([key, value]) => {
+        if (BROWSER_SETTINGS.includes(key)) localStorage.setItem(key, JSON.stringify(value));
     });
+    state.sort = loadSortPrefs();
+    $('#sort-mode').value = state.sort.sort;
+    $('#sort-case-insensitive').checked = state.sort.caseInsensitive;
+    $('#sort-dirs-first').checked = state.sort.dirsFirst;
+    $('#sort-desc').checked = state.sort.desc;
+    fillRegistryMirror();
+    loadSavedSearches();
+    showToast('Settings imported', 'success');
 }
 
-async function uploadFile(file) {
-    const progress = $('#upload-progress');
-    const progressFill = $('#progress-fill');
-    const statusText = $('#upload-status');
-
-    progress.classList.remove('hidden');
-    progressFill.style.width = '0%';
-    statusText.textContent = `Uploading ${file.name}...`;
-
-    const formData = new FormData();
-    formData.append('file', file);
-    formData.append('namespace', state.namespace);
-    formData.append('pvc', state.pvc);
-    formData.append('path', state.currentPath);
-
+// cancelOperation stops a request started with that operation ID, such
+// as a search running find on a huge volume.
+async function cancelOperation(id) {
     try {
-        const xhr = new XMLHttpRequest();
+        await api(`/api/operations?id=${encodeURIComponent(id)}`, { method: 'DELETE' });
+    } catch (_) {
+        // Already finished.
+    }
+}
 
-        xhr.upload.addEventListener('progress', (e) => {
-            if (e.lengthComputable) {
-                const pct = Math.round((e.loaded / e.total) * 100);
-                progressFill.style.width = pct + '%';
-                statusText.textContent = `Uploading ${file.name}... ${pct}%`;
+// runSavedSearch streams the matches in as find prints them, then sorts
+// them once it is done. Canceling keeps the matches found so far.
+async function runSavedSearch(search) {
+    const container = $('#file-table-container');
+    const operation = crypto.randomUUID();
+    container.innerHTML = `<div class="loading"><div class="spinner"></div></div>`;
+    state.namespace = search.namespace;
+    state.pvc = search.pvc;
+    state.currentPath = search.query.path;
+    const breadcrumb = (text) => {
+        $('#breadcrumb').innerHTML = `<span class="breadcrumb-item clickable" onclick="navigateTo(${jsArg(search.query.path)})">${escapeHtml(search.pvc)}</span>` +
+            `<span class="breadcrumb-separator">/</span><span class="breadcrumb-item">Search: ${escapeHtml(search.name)} (${text})</span>` +
+            (text.startsWith('searching') ? ` <button class="btn btn-secondary" onclick="cancelOperation(${jsArg(operation)})">Cancel search</button>` : '');
+    };
+    breadcrumb('searching…');
+    const files = [];
+    let tbody = null;
+    const current = () => state.pvc === search.pvc && state.currentPath === search.query.path;
+    const show = () => {
+        const collator = new Intl.Collator(undefined, {
+            numeric: state.sort.sort === 'natural',
+            sensitivity: state.sort.caseInsensitive ? 'accent' : 'variant',
+        });
+        renderFiles(files.sort((a, b) => collator.compare(a.name, b.name)));
+    };
+    try {
+        const params = new URLSearchParams({ id: search.id, stream: 'true', operation });
+        const trailer = await streamLines(`/api/saved-searches/run?${params}`, batch => {
+            if (!current()) return;
+            const rows = batch.map(f => ({ ...f, name: f.path }));
+            files.push(...rows);
+            if (!tbody) {
+                container.innerHTML = fileTableHtml('');
+                tbody = container.querySelector('tbody');
             }
+            tbody.insertAdjacentHTML('beforeend', rows.map(fileRowHtml).join(''));
+            breadcrumb(`searching… ${files.length} found`);
         });
+        if (!current()) return;
+        show();
+        breadcrumb(`${files.length}${trailer.truncated ? '+' : ''} results`);
+        if (trailer.truncated) showToast('Showing the first results only; narrow the search to see more', 'warning');
+    } catch (err) {
+        if (!current()) return;
+        if (files.length) {
+            show();
+            breadcrumb(`${files.length} results, ${err.kind === 'Canceled' ? 'canceled' : 'incomplete'}`);
+            return;
+        }
+        breadcrumb(err.kind === 'Canceled' ? 'canceled' : 'failed');
+        container.innerHTML = `<div class="empty-state-large"><p>${err.kind === 'Canceled' ? 'Search canceled' : 'Search failed'}</p></div>`;
+    }
+}
 
-        await new Promise((resolve, reject) => {
-            xhr.onload = () => {
-                if (xhr.status >= 200 && xhr.status < 300) {
-                    resolve(JSON.parse(xhr.responseText));
-                } else {
-                    const data = JSON.parse(xhr.responseText);
-                    reject(new Error(data.error || 'Upload failed'));
-                }
-            };
-            xhr.onerror = () => reject(new Error('Upload failed'));
-            xhr.open('POST', '/api/upload');
-            xhr.send(formData);
+async function saveSearch() {
+    const pattern = prompt(`File name pattern to find under ${state.currentPath} (e.g. *.log):`, '*');
+    if (pattern === null) return;
+    const within = prompt('Only files modified within (e.g. 24h, leave empty for any time):', '');
+    if (within === null) return;
+    const name = prompt('Name for this search:', `${pattern} in ${state.currentPath}`);
+    if (!name) return;
+    try {
+        await api('/api/saved-searches', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                name,
+                namespace: state.namespace,
+                pvc: state.pvc,
+                query: { path: state.currentPath, pattern, type: 'f', modifiedWithin: within.trim() },
+            }),
+        });
+        showToast('Search saved', 'success');
+        loadSavedSearches();
+    } catch (_) {}
+}
+
+let jobsPoll = null;
+let jobsChecked = false;
+// maintenanceStarted holds the maintenance jobs already seen succeed, so
+// the PVC list is refreshed once for each new session.
+const maintenanceStarted = new Set();
+
+async function loadJobs() {
+    let data;
+    try {
+        const res = await fetch('/api/jobs');
+        if (!res.ok) return;
+        data = await res.json();
+    } catch (_) {
+        return;
+    }
+    const jobs = data.jobs || [];
+    const interrupted = jobs.filter(j => j.state === 'interrupted');
+    if (!jobsChecked && interrupted.length > 0) {
+        showToast(`${interrupted.length} job(s) were interrupted by a restart — resume them from the Jobs list`, 'warning');
+    }
+    jobsChecked = true;
+    const started = jobs.filter(j => j.kind === 'maintenance' && j.state === 'succeeded' && !maintenanceStarted.has(j.id));
+    started.forEach(j => maintenanceStarted.add(j.id));
+    if (started.length > 0 && state.namespace) loadPVCs(state.namespace);
+
+    $('#jobs-section').classList.toggle('hidden', jobs.length === 0);
+    const list = $('#job-list');
+    list.innerHTML = '';
+    jobs.forEach(job => {
+        const item = document.createElement('div');
+        item.className = 'pvc-item saved-search-item';
+        item.title = job.error || job.description;
+
+        const label = document.createElement('div');
+        const name = document.createElement('div');
+        name.className = 'pvc-item-name';
+        name.textContent = job.description;
+        const meta = document.createElement('div');
+        meta.className = 'pvc-item-meta';
+        let progress = '';
+        if (job.state === 'running' && job.total > 0) {
+            progress = ` ${Math.min(100, Math.round(job.done * 100 / job.total))}%`;
+        } else if (job.state === 'running' && job.done > 0) {
+            progress = ` ${formatSize(job.done)}`;
+        }
+        if ((job.kind === 'move' || job.kind === 'migrate') && job.state === 'running' && job.result && job.result.stage) {
+            progress = ` (${job.result.stage})` + progress;
+        }
+        if (job.kind === 'clone' && job.state === 'succeeded' && job.result && job.result.target) {
+            progress = ` → ${job.result.target.namespace}/${job.result.target.pvc}` + (job.result.renamed ? ' (renamed)' : '');
+        }
+        if (job.kind === 'verify' && job.result && job.result.node) {
+            progress = ` on node ${job.result.node}`;
+        }
+        if (job.state === 'scheduled' && job.startAt) {
+            progress = ` for ${new Date(job.startAt).toLocaleString([], { dateStyle: 'short', timeStyle: 'short' })}`;
+        }
+        if (job.kind === 'maintenance' && job.state === 'succeeded' && job.result && job.result.until) {
+            progress = ` until ${new Date(job.result.until).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}`;
+        }
+        meta.textContent = job.state + progress;
+        label.appendChild(name);
+        label.appendChild(meta);
+        item.appendChild(label);
+
+        const actions = document.createElement('div');
+        const addAction = (text, title, fn) => {
+            const btn = document.createElement('button');
+            btn.className = 'btn btn-icon btn-small';
+            btn.textContent = text;
+            btn.title = title;
+            btn.addEventListener('click', (e) => { e.stopPropagation(); fn(); });
+            actions.appendChild(btn);
+        };
+        if (job.kind === 'migrate' && job.state === 'succeeded' && job.result && job.result.report) {
+            addAction('☰', 'Show how to switch workloads', () => showMigrationReport(job.result.report));
+        }
+        if (job.kind === 'archive' && job.state === 'succeeded') {
+            addAction('⤓', 'Download', () => { window.location.href = `/api/download-archive?id=${encodeURIComponent(job.id)}`; });
+        }
+        if (['interrupted', 'failed', 'canceled'].includes(job.state)) {
+            addAction('↻', 'Resume', () => jobAction(job.id, 'POST', '&action=resume'));
+        }
+        if (['running', 'queued', 'scheduled'].includes(job.state)) {
+            addAction('■', 'Cancel', () => jobAction(job.id, 'POST', '&action=cancel'));
+        }
+        addAction('×', 'Dismiss', () => jobAction(job.id, 'DELETE', ''));
+        item.appendChild(actions);
+        list.appendChild(item);
+    });
+
+    const active = jobs.some(j => ['running', 'queued', 'scheduled'].includes(j.state));
+    if (active && !jobsPoll) {
+        jobsPoll = setInterval(loadJobs, 3000);
+    } else if (!active && jobsPoll) {
+        clearInterval(jobsPoll);
+        jobsPoll = null;
+    }
+}
+
+async function jobAction(id, method, query) {
+    try {
+        await api(`/api/jobs?id=${encodeURIComponent(id)}${query}`, { method });
+    } catch (_) {}
+    loadJobs();
+}
+
+function initPathBar() {
+    const input = $('#path-input');
+    input.addEventListener('keydown', (e) => {
+        if (!state.pvc) return;
+        if (e.key === 'Tab') {
+            e.preventDefault();
+            completePath();
+        } else if (e.key === 'Enter') {
+            e.preventDefault();
+            $('#path-suggestions').innerHTML = '';
+            jumpToPath(input.value || '/');
+        } else if (e.key === 'Escape') {
+            input.value = state.currentPath;
+            input.blur();
+        }
+    });
+}
+
+function downloadFile(filePath) {
+    const params = new URLSearchParams({
+        namespace: state.namespace,
+        pvc: state.pvc,
+        path: filePath,
+    });
+    window.location.href = `/api/download?${params}`;
+}
+
+function toggleFileSelection(box) {
+    if (box.checked) {
+        state.selected.add(box.dataset.path);
+    } else {
+        state.selected.delete(box.dataset.path);
+    }
+    updateBatchDownload();
+}
+
+function selectAllFiles(checked) {
+    $$('.file-select').forEach(box => {
+        box.checked = checked;
+        toggleFileSelection(box);
+    });
+}
+
+function updateBatchDownload() {
+    const n = state.selected.size;
+    $('#batch-download').classList.toggle('hidden', n === 0);
+    $('#batch-download-label').textContent = `Download ${n} selected`;
+}
+
+// downloadSelected streams the checked entries as one archive. A form
+// submit, unlike fetch, lets the browser save the response as it arrives.
+function downloadSelected() {
+    if (state.selected.size === 0) return;
+    const form = document.createElement('form');
+    form.method = 'POST';
+    form.action = '/api/download-batch';
+    const field = document.createElement('input');
+    field.type = 'hidden';
+    field.name = 'request';
+    field.value = JSON.stringify({
+        namespace: state.namespace,
+        pvc: state.pvc,
+        paths: [...state.selected],
+        format: $('#batch-format').value,
+    });
+    form.appendChild(field);
+    document.body.appendChild(form);
+    form.submit();
+    form.remove();
+}
+
+// copyRawLink copies the /raw/ URL of a file, token included, for
+// editors, image viewers and BI tools.
+async function copyRawLink(filePath) {
+    const params = new URLSearchParams({
+        namespace: state.namespace,
+        pvc: state.pvc,
+        path: filePath,
+    });
+    let data;
+    try {
+        data = await api(`/api/raw-url?${params}`);
+    } catch (e) {
+        return;
+    }
+    try {
+        await navigator.clipboard.writeText(data.url);
+        showToast('Link copied', 'success');
+    } catch (e) {
+        // The clipboard needs a secure context; show the link instead.
+        window.prompt('Link to this file', data.url);
+    }
+}
+
+// downloadDir streams a directory as a .tar.gz. When the estimate says
+// the download would run for longer than an hour, the user confirms first.
+async function downloadDir(dirPath) {
+    try {
+        const est = await api('/api/estimate', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, pvc: state.pvc, paths: [dirPath] }),
+        });
+        if (est.recommendation === 'job' &&
+            !confirm(`${dirPath} holds ${est.files} files, ${formatSize(est.bytes)}. ${est.note}\n\nDownload anyway?`)) {
+            return;
+        }
+    } catch (_) {
+        // An estimate that fails should not block the download.
+    }
+    const params = new URLSearchParams({
+        namespace: state.namespace,
+        pvc: state.pvc,
+        path: dirPath,
+    });
+    window.location.href = `/api/download-dir?${params}`;
+}
+
+function initUpload() {
+    const modal = $('#upload-modal');
+    const zone = $('#upload-zone');
+    const input = $('#file-input');
+    const closeBtn = $('#upload-modal-close');
+
+    $('#upload-btn').addEventListener('click', () => {
+        modal.classList.remove('hidden');
+        $('#upload-progress').classList.add('hidden');
+    });
+
+    const folderInput = $('#folder-input');
+    $('#upload-folder-btn').addEventListener('click', () => {
+        folderInput.value = '';
+        folderInput.click();
+    });
+    folderInput.addEventListener('change', () => uploadFolder([...folderInput.files]));
+    $('#upload-server-folder-btn').addEventListener('click', openUploadFromServer);
+
+    closeBtn.addEventListener('click', () => {
+        modal.classList.add('hidden');
+    });
+
+    modal.addEventListener('click', (e) => {
+        if (e.target === modal) modal.classList.add('hidden');
+    });
+
+    zone.addEventListener('click', () => input.click());
+
+    zone.addEventListener('dragover', (e) => {
+        e.preventDefault();
+        zone.classList.add('dragover');
+    });
+
+    zone.addEventListener('dragleave', () => {
+        zone.classList.remove('dragover');
+    });
+
+    zone.addEventListener('drop', (e) => {
+        e.preventDefault();
+        zone.classList.remove('dragover');
+        if (e.dataTransfer.files.length > 1) {
+            uploadSeveralFiles([...e.dataTransfer.files]);
+        } else if (e.dataTransfer.files.length > 0) {
+            uploadFile(e.dataTransfer.files[0]);
+        }
+    });
+
+    input.addEventListener('change', () => {
+        if (input.files.length > 1) {
+            uploadSeveralFiles([...input.files]);
+        } else if (input.files.length > 0) {
+            uploadFile(input.files[0]);
+        }
+    });
+}
+
+// tarBlob packs the files of a folder input into a tar. The result is a
+// Blob whose file parts are only read as it uploads, so a large folder is
+// not loaded into memory. Names over 100 bytes get a PAX header.
+function tarBlob(files) {
+    const enc = new TextEncoder();
+    const header = (name, size, mtime, type) => {
+        const buf = new Uint8Array(512);
+        const put = (str, off, len) => buf.set(enc.encode(str).slice(0, len), off);
+        const oct = (n, off, len) => put(n.toString(8).padStart(len - 1, '0'), off, len - 1);
+        put(name, 0, 100);
+        oct(0o644, 100, 8);
+        oct(0, 108, 8);
+        oct(0, 116, 8);
+        oct(size, 124, 12);
+        oct(Math.floor(mtime / 1000), 136, 12);
+        buf.fill(32, 148, 156);
+        put(type, 156, 1);
+        put('ustar\0', 257, 6);
+        put('00', 263, 2);
+        const sum = buf.reduce((a, b) => a + b, 0);
+        put(sum.toString(8).padStart(6, '0') + '\0 ', 148, 8);
+        return buf;
+    };
+    const padding = size => new Uint8Array((512 - size % 512) % 512);
+    const parts = [];
+    for (const file of files) {
+        const name = file.webkitRelativePath || file.name;
+        if (enc.encode(name).length > 100) {
+            const body = ` path=${name}\n`;
+            const len = enc.encode(body).length;
+            let total = len + String(len).length;
+            total = len + String(total).length;
+            const record = enc.encode(`${total}${body}`);
+            parts.push(header('PaxHeader', record.length, file.lastModified, 'x'), record, padding(record.length));
+        }
+        parts.push(header(name, file.size, file.lastModified, '0'), file, padding(file.size));
+    }
+    parts.push(new Uint8Array(1024));
+    return new Blob(parts, { type: 'application/x-tar' });
+}
+
+// uploadFolder uploads a folder picked in the browser as a tar that the
+// server extracts into the current directory.
+function uploadFolder(files) {
+    if (files.length === 0) return;
+    const root = (files[0].webkitRelativePath || 'folder').split('/')[0];
+    uploadFile(new File([tarBlob(files)], `${root}.tar`), true);
+}
+
+let uploadFromServerDir = false;
+
+async function openUploadFromServer() {
+    uploadFromServerDir = true;
+    $('#file-browser-title').textContent = 'Upload a Folder from the Server';
+    if (await browseDir('')) {
+        $('#file-browser-modal').classList.remove('hidden');
+    } else {
+        uploadFromServerDir = false;
+    }
+}
+
+async function uploadFromServer(srcDir) {
+    uploadFromServerDir = false;
+    $('#upload-modal').classList.add('hidden');
+    showToast(`Uploading ${srcDir}…`, 'info');
+    try {
+        const data = await api('/api/upload-local-dir', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                namespace: state.namespace,
+                pvc: state.pvc,
+                srcDir,
+                destDir: state.currentPath,
+            }),
+        });
+        showToast(data.message, 'success');
+        loadFiles();
+    } catch (_) {}
+}
+
+async function uploadFile(file, forceExtract = false) {
+    const progress = $('#upload-progress');
+    const progressFill = $('#progress-fill');
+    const statusText = $('#upload-status');
+
+    progress.classList.remove('hidden');
+    progressFill.style.width = '0%';
+    statusText.textContent = `Uploading ${file.name}...`;
+
+    // The server streams the file part as it arrives, so every other
+    // field has to come before it.
+    const formData = new FormData();
+    formData.append('namespace', state.namespace);
+    formData.append('pvc', state.pvc);
+    formData.append('path', state.currentPath);
+    formData.append('size', file.size);
+    formData.append('mtime', file.lastModified);
+    formData.append('file', file);
+    const extract = forceExtract || ($('#upload-extract').checked && /\.(tar|tar\.gz|tgz|zip)$/i.test(file.name));
+
+    try {
+        const result = await postUpload(uploadURL(extract), formData, pct => {
+            progressFill.style.width = pct + '%';
+            statusText.textContent = `Uploading ${file.name}... ${pct}%`;
         });
 
         progressFill.style.width = '100%';
-        statusText.textContent = `${file.name} uploaded successfully!`;
-        showToast(`${file.name} uploaded successfully`, 'success');
+        const done = extract || result.renamed || result.skipped ? result.message : `${file.name} uploaded successfully`;
+        statusText.textContent = `${done}!`;
+        showToast(done, 'success');
+        if (result.verifyJob) loadJobs();
 
         setTimeout(() => {
             $('#upload-modal').classList.add('hidden');
@@ -513,7 +1737,595 @@ async function uploadFile(file) {
     }
 }
 
+// uploadSeveralFiles uploads files in one request, which the server
+// writes to the PVC a few at a time, and reports the ones that failed.
+async function uploadSeveralFiles(files) {
+    const progress = $('#upload-progress');
+    const progressFill = $('#progress-fill');
+    const statusText = $('#upload-status');
+
+    progress.classList.remove('hidden');
+    progressFill.style.width = '0%';
+    statusText.textContent = `Uploading ${files.length} files...`;
+
+    // Each file's size and mtime come right before it.
+    const formData = new FormData();
+    formData.append('namespace', state.namespace);
+    formData.append('pvc', state.pvc);
+    formData.append('path', state.currentPath);
+    for (const file of files) {
+        formData.append('size', file.size);
+        formData.append('mtime', file.lastModified);
+        formData.append('files', file);
+    }
+    const extract = $('#upload-extract').checked && files.every(f => /\.(tar|tar\.gz|tgz|zip)$/i.test(f.name));
+
+    try {
+        const result = await postUpload(uploadURL(extract), formData, pct => {
+            progressFill.style.width = pct + '%';
+            statusText.textContent = `Uploading ${files.length} files... ${pct}%`;
+        });
+
+        progressFill.style.width = '100%';
+        const failed = result.files.filter(f => !f.success);
+        statusText.textContent = failed.length === 0 ? `${result.message}!` :
+            `${result.message}. Failed: ${failed.map(f => `${f.filename} (${f.error})`).join(', ')}`;
+        showToast(result.message, failed.length === 0 ? 'success' : 'warning');
+        loadFiles();
+        if (result.verifyJob) loadJobs();
+        if (failed.length === 0) setTimeout(() => $('#upload-modal').classList.add('hidden'), 1500);
+    } catch (err) {
+        statusText.textContent = `Failed: ${err.message}`;
+        showToast(`Upload failed: ${err.message}`, 'error');
+    }
+}
+
+// uploadURL is where an upload is posted: with extract, archives are
+// unpacked, and unless "Keep modification times and permissions" is
+// unticked, files keep those they have here or in the archive. Files that
+// already exist are handled as "If a file exists" says; extracted
+// archives always overwrite. "Read back from another node" queues a job
+// that checks what was written, except for extracted archives.
+function uploadURL(extract) {
+    const params = new URLSearchParams();
+    if (extract) params.set('extract', 'true');
+    if (!$('#upload-preserve').checked) params.set('preserve', 'false');
+    const onConflict = $('#upload-conflict').value;
+    if (!extract && onConflict !== 'overwrite') params.set('onConflict', onConflict);
+    if (!extract && $('#upload-verify').checked) params.set('verify', 'true');
+    const query = params.toString();
+    return query ? `/api/upload?${query}` : '/api/upload';
+}
+
+// postUpload sends an upload form, reporting the percentage sent to
+// onProgress, and resolves with the server's answer.
+function postUpload(url, formData, onProgress) {
+    const xhr = new XMLHttpRequest();
+    xhr.upload.addEventListener('progress', (e) => {
+        if (e.lengthComputable) onProgress(Math.round((e.loaded / e.total) * 100));
+    });
+    return new Promise((resolve, reject) => {
+        xhr.onload = () => {
+            if (xhr.status >= 200 && xhr.status < 300) {
+                resolve(JSON.parse(xhr.responseText));
+            } else {
+                const data = JSON.parse(xhr.responseText);
+                reject(new Error(data.error || 'Upload failed'));
+            }
+        };
+        xhr.onerror = () => reject(new Error('Upload failed'));
+        xhr.open('POST', url);
+        xhr.send(formData);
+    });
+}
+
+// renameEntry renames a file or directory, or moves it elsewhere on the
+// same PVC when the new name is a path.
+async function renameEntry(filePath) {
+    const parent = filePath.substring(0, filePath.lastIndexOf('/')) || '/';
+    const name = filePath.substring(filePath.lastIndexOf('/') + 1);
+    const input = prompt(`New name for ${filePath} (or a full path starting with / to move it):`, name);
+    if (!input || input === name) return;
+    const to = input.startsWith('/') ? input : `${parent === '/' ? '' : parent}/${input}`;
+    try {
+        await api('/api/move', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, pvc: state.pvc, from: filePath, to }),
+        });
+        showToast(`Moved to ${to}`, 'success');
+        loadFiles();
+    } catch (_) {}
+}
+
+// changePermissions runs chmod and/or chown on an entry, and for a
+// directory optionally on everything below it. Symbolic modes such as
+// g+rwX fix a whole tree where no single octal mode fits.
+async function changePermissions(filePath, isDir, owner) {
+    const mode = prompt(`Mode for ${filePath} — octal (0664) or symbolic (g+rwX); leave empty to keep it:`, '');
+    if (mode === null) return;
+    const newOwner = prompt(`Owner for ${filePath} — uid, uid:gid or :gid; leave empty to keep ${owner || 'it'}:`, '');
+    if (newOwner === null || (!mode.trim() && !newOwner.trim())) return;
+    const recursive = isDir && confirm(`Apply to everything inside ${filePath} as well?`);
+    const base = { namespace: state.namespace, pvc: state.pvc, path: filePath, recursive };
+    try {
+        if (newOwner.trim()) {
+            await api('/api/chown', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ ...base, owner: newOwner.trim() }),
+            });
+        }
+        if (mode.trim()) {
+            await api('/api/chmod', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ ...base, mode: mode.trim() }),
+            });
+        }
+        showToast(`Permissions of ${filePath} changed`, 'success');
+    } catch (_) {}
+    loadFiles();
+}
+
+// deleteEntry deletes a file, or a directory with everything in it, after
+// the user confirms. With the trash on, it can be restored from there.
+async function deleteEntry(filePath, isDir) {
+    const what = isDir ? `the directory ${filePath} and everything in it` : filePath;
+    const toTrash = state.trash && !filePath.startsWith(TRASH_DIR);
+    const undo = !toTrash ? 'This cannot be undone.' :
+        state.trash.retentionDays > 0 ? `It can be restored from the trash for ${state.trash.retentionDays} days.` : 'It can be restored from the trash.';
+    if (!confirm(`Delete ${what} from ${state.namespace}/${state.pvc}? ${undo}`)) return;
+    try {
+        await api('/api/delete', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                namespace: state.namespace,
+                pvc: state.pvc,
+                path: filePath,
+                isDir,
+                recursive: isDir,
+            }),
+        });
+        showToast(toTrash ? `Moved ${filePath} to the trash` : `Deleted ${filePath}`, 'success');
+        loadFiles();
+    } catch (_) {}
+}
+
+// TRASH_DIR is where deleted entries go on each PVC while the trash is on.
+const TRASH_DIR = '/.kube-browser-trash';
+
+// showTrash lists what was deleted from the current PVC, newest first, to
+// restore it where it was or remove it for good.
+async function showTrash() {
+    let data;
+    try {
+        data = await api(`/api/trash?namespace=${encodeURIComponent(state.namespace)}&pvc=${encodeURIComponent(state.pvc)}`);
+    } catch (_) {
+        return;
+    }
+    const actions = state.readOnly ? () => '' : e =>
+        `<button class="btn btn-secondary trash-restore" data-id="${escapeHtml(e.id)}">Restore</button> ` +
+        `<button class="btn btn-secondary trash-purge" data-id="${escapeHtml(e.id)}">Delete forever</button>`;
+    const rows = data.entries.map(e =>
+        `<div class="activity-item"><strong>${escapeHtml(e.path || e.id)}</strong>${e.isDir ? '/' : ''} ` +
+        `<span class="activity-time">deleted ${escapeHtml(new Date(e.deletedAt).toLocaleString())}` +
+        `${e.deletedBy ? ' by ' + escapeHtml(e.deletedBy) : ''}` +
+        `${e.expiresAt ? ', purged ' + escapeHtml(new Date(e.expiresAt).toLocaleDateString()) : ''}</span> ${actions(e)}</div>`).join('');
+    $('#details-title').textContent = `Trash of ${state.pvc}`;
+    $('#details-summary').classList.remove('details-error');
+    $('#details-summary').textContent = data.retentionDays > 0
+        ? `Deleted entries are kept for ${data.retentionDays} days.` : 'Deleted entries are kept until the trash is emptied.';
+    $('#details-list').innerHTML = (rows && !state.readOnly ? '<div class="file-browser-actions"><button class="btn btn-secondary" id="trash-empty-btn">Empty trash</button></div>' : '') +
+        (rows || '<div class="empty-state">The trash is empty.</div>');
+    $('#archive-extract-btn').classList.add('hidden');
+    $('#archive-overwrite').parentElement.classList.add('hidden');
+    $('#details-modal').classList.remove('hidden');
+    document.querySelectorAll('.trash-restore').forEach(btn => btn.addEventListener('click', () => restoreFromTrash(btn.dataset.id)));
+    document.querySelectorAll('.trash-purge').forEach(btn => btn.addEventListener('click', () => purgeTrash({ id: btn.dataset.id })));
+    const empty = $('#trash-empty-btn');
+    if (empty) empty.addEventListener('click', () => purgeTrash({ all: true }));
+}
+
+// restoreFromTrash moves an entry back where it was deleted from, or to a
+// path the user picks when that has been taken since.
+async function restoreFromTrash(id, to) {
+    try {
+        const data = await api('/api/trash/restore', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, pvc: state.pvc, id, to }),
+        });
+        showToast(`Restored ${data.restored}`, 'success');
+        loadFiles();
+        showTrash();
+    } catch (err) {
+        if (err.status !== 409) return;
+        const other = prompt('Restore it to another path instead:');
+        if (other) restoreFromTrash(id, other);
+    }
+}
+
+async function purgeTrash(what) {
+    const question = what.all ? `Empty the trash of ${state.pvc}? Everything in it is deleted for good.` : 'Delete this entry for good?';
+    if (!confirm(question)) return;
+    try {
+        const data = await api('/api/trash/purge', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, pvc: state.pvc, ...what }),
+        });
+        showToast(`Deleted ${data.purged} entr${data.purged === 1 ? 'y' : 'ies'} for good`, 'info');
+        showTrash();
+    } catch (_) {}
+}
+
 let fileBrowserSelectedPath = '';
+let fileBrowserCurrentPath = '';
+let saveToServerTarget = null;
+
+// moveToPVC queues a move job: the data is copied to the other claim,
+// verified by checksum and only then deleted here.
+async function moveToPVC(filePath) {
+    const dest = prompt(`Move ${filePath} to which PVC? (name, or namespace/name)`, '');
+    if (!dest) return;
+    const [destNamespace, destPvc] = dest.includes('/') ? dest.split('/', 2) : [state.namespace, dest];
+    const parent = filePath.substring(0, filePath.lastIndexOf('/')) || '/';
+    const destDir = prompt(`Directory on ${destNamespace}/${destPvc} to move it into:`, parent);
+    if (destDir === null) return;
+    try {
+        await api('/api/move', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                namespace: state.namespace,
+                pvc: state.pvc,
+                paths: [filePath],
+                destNamespace,
+                destPvc,
+                destDir: destDir || '/',
+            }),
+        });
+        showToast('Move queued — the source is deleted only after the copy is verified', 'info');
+        loadJobs();
+    } catch (_) {}
+}
+
+// restoreFromSnapshot queues a job copying an entry of the snapshot being
+// browsed back onto the live claim, into the directory it was in.
+async function restoreFromSnapshot(filePath) {
+    const { name, source } = state.snapshot;
+    const mode = prompt(`Restore ${filePath} from snapshot ${name} onto ${source}.\n\n` +
+        'If it exists there: "fail" to stop, "rename" to restore it next to it as <name>.restored, ' +
+        'or "overwrite" to replace its files (a directory keeps files the snapshot lacks).', 'rename');
+    if (mode === null) return;
+    try {
+        await api('/api/snapshots/restore', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, snapshot: name, paths: [filePath], onConflict: mode.trim() }),
+        });
+        showToast(`Restore onto ${source} queued — follow it under Jobs`, 'info');
+        loadJobs();
+    } catch (_) {}
+}
+
+// migratePVC walks the user through a storage-class migration: pick the
+// class, confirm the workload is quiesced, then queue the migrate job.
+async function migratePVC(pvc) {
+    let classes;
+    try {
+        classes = (await api('/api/storage-classes')).storageClasses || [];
+    } catch (_) {
+        return;
+    }
+    const choices = classes.filter(c => c !== pvc.storageClass);
+    if (choices.length === 0) {
+        showToast('No other storage class is available', 'warning');
+        return;
+    }
+    const storageClass = prompt(`Migrate ${pvc.name} (${pvc.storageClass || 'no class'}) to which storage class?\n\nAvailable: ${choices.join(', ')}`, choices[0]);
+    if (!storageClass) return;
+    const target = prompt('Name of the new PVC:', `${pvc.name}-${storageClass}`);
+    if (!target) return;
+    if (!confirm(`Scale down the workloads using ${pvc.name} before continuing: writes made during the copy are not migrated.\n\n` +
+        `A new ${storageClass} PVC "${target}" will be created and filled by a Job. ${pvc.name} is not modified.`)) return;
+    try {
+        await api('/api/migrate', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, pvc: pvc.name, storageClass, target }),
+        });
+        showToast('Migration started — follow it under Jobs', 'info');
+        loadJobs();
+    } catch (_) {}
+}
+
+// maintenanceSummary lists what a maintenance session scaled down.
+function maintenanceSummary(session) {
+    const workloads = (session.workloads || []).map(w => `${w.kind} ${w.name} (${w.replicas} replica${w.replicas === 1 ? '' : 's'})`);
+    return `Scaled to zero: ${workloads.join(', ') || 'none'}`;
+}
+
+// startMaintenance scales down the Deployments and StatefulSets using a
+// PVC for a limited time so a helper pod has the volume to itself. The
+// server restores their replica counts when the time is up.
+async function startMaintenance(pvc) {
+    const minutes = prompt(`Maintenance mode for ${pvc.name}\n\n` +
+        'The Deployments and StatefulSets using it are scaled to zero and a helper pod gets exclusive access. ' +
+        'Their replica counts are restored when you end it or the time runs out.\n\nFor how many minutes?', '30');
+    if (!minutes) return;
+    const n = parseInt(minutes, 10);
+    if (!(n > 0)) {
+        showToast('Enter a number of minutes', 'warning');
+        return;
+    }
+    try {
+        await api('/api/maintenance', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace: state.namespace, pvc: pvc.name, minutes: n }),
+        });
+        showToast('Scaling down — follow it under Jobs', 'info');
+        loadJobs();
+    } catch (_) {}
+}
+
+async function endMaintenance(session) {
+    if (!confirm(`End maintenance of ${session.pvc}?\n\n${maintenanceSummary(session)}. They are scaled back up now.`)) return;
+    try {
+        await api(`/api/maintenance?namespace=${encodeURIComponent(session.namespace)}&pvc=${encodeURIComponent(session.pvc)}`, { method: 'DELETE' });
+        showToast(`Maintenance of ${session.pvc} ended`, 'success');
+        loadPVCs(state.namespace);
+    } catch (_) {}
+}
+
+// clonePVC copies a PVC, spec and data, into another namespace. The name
+// defaults to the source's; on a collision the server either fails or
+// picks "<name>-clone[-N]".
+async function clonePVC(pvc) {
+    const targetNamespace = prompt(`Clone ${pvc.name} into which namespace?`, '');
+    if (!targetNamespace) return;
+    const targetName = prompt('Name of the new PVC:', pvc.name);
+    if (!targetName) return;
+    const storageClass = prompt('Storage class (leave empty to keep the source class):', pvc.storageClass || '');
+    if (storageClass === null) return;
+    const rename = confirm(`If "${targetName}" already exists in ${targetNamespace}, pick a free name instead of failing?`);
+    const at = prompt('Start at (HH:MM, e.g. 02:00 for off-peak hours; leave empty to start now):', '');
+    if (at === null) return;
+    try {
+        await api(at.trim() ? `/api/clone?at=${encodeURIComponent(at.trim())}` : '/api/clone', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                namespace: state.namespace,
+                pvc: pvc.name,
+                targetNamespace,
+                targetName,
+                storageClass,
+                onConflict: rename ? 'rename' : 'fail',
+            }),
+        });
+        showToast(at.trim() ? `Clone scheduled for ${at.trim()} — follow it under Jobs` : 'Clone queued — follow it under Jobs', 'info');
+        loadJobs();
+    } catch (_) {}
+}
+
+// showActivity lists the latest operations on this server, newest first,
+// with who ran them and how they went.
+async function showActivity() {
+    let data;
+    try {
+        data = await api('/api/activity');
+    } catch (_) {
+        return;
+    }
+    const events = (data.events || []).slice().reverse();
+    const rows = events.map(ev => {
+        const where = ev.pvc ? `${ev.namespace}/${ev.pvc}${ev.path ? ':' + ev.path : ''}` : '';
+        const result = ev.error ? `${ev.result}: ${ev.error}` : ev.result;
+        return `<div class="activity-item activity-${escapeHtml(ev.result)}">` +
+            `<span class="activity-time">${escapeHtml(new Date(ev.time).toLocaleString())}</span> ` +
+            `<strong>${escapeHtml(ev.user || 'unknown')}</strong> ${escapeHtml(ev.action)} ` +
+            `<span class="activity-where">${escapeHtml(where)}</span>` +
+            (ev.detail ? ` — ${escapeHtml(ev.detail)}` : '') +
+            `<div class="activity-result">${escapeHtml(result)}</div></div>`;
+    }).join('');
+    $('#details-title').textContent = 'Recent activity';
+    $('#details-summary').classList.remove('details-error');
+    $('#details-summary').textContent = `${events.length} operation(s) since KubeBrowser started`;
+    $('#details-list').innerHTML = rows || '<div class="empty-state">Nothing has been changed yet.</div>';
+    $('#archive-extract-btn').classList.add('hidden');
+    $('#archive-overwrite').parentElement.classList.add('hidden');
+    $('#details-modal').classList.remove('hidden');
+}
+
+// parseCompareTarget reads what the open folder is compared with: a path
+// on the same PVC ("/data"), a PVC ("pvc", "pvc:/path",
+// "namespace/pvc:/path") or a snapshot of the open claim ("@nightly",
+// "@nightly:/path"). A missing path means the open one.
+function parseCompareTarget(text) {
+    const [where, ...rest] = text.trim().split(':');
+    const path = rest.length ? rest.join(':') || '/' : state.currentPath;
+    if (where.startsWith('/')) return { namespace: state.namespace, pvc: state.pvc, path: text.trim() };
+    if (where.startsWith('@')) return { namespace: state.namespace, snapshot: where.slice(1), path };
+    const [namespace, pvc] = where.includes('/') ? where.split('/', 2) : [state.namespace, where];
+    return { namespace, pvc, path };
+}
+
+// compareDirectory diffs the open folder with another one and lists what
+// was added, removed and changed on the other side.
+// exportListing downloads the open folder's listing, or the whole tree
+// under it, as CSV or JSON, with the current sort order and filter.
+function exportListing(e) {
+    const [format, recursive] = e.target.value.split('-');
+    e.target.value = '';
+    if (!format) return;
+    const params = new URLSearchParams({
+        namespace: state.namespace,
+        pvc: state.pvc,
+        path: state.currentPath,
+        sort: state.sort.sort,
+        caseInsensitive: state.sort.caseInsensitive,
+        dirsFirst: state.sort.dirsFirst,
+        desc: state.sort.desc,
+        export: format,
+    });
+    if (recursive) params.set('recursive', 'true');
+    if (state.filter) params.set('filter', state.filter);
+    window.location.href = `/api/files?${params}`;
+}
+
+async function compareDirectory() {
+    const text = prompt(`Compare ${state.pvc}:${state.currentPath} with…\n\n` +
+        'a path on this PVC (/other), a PVC (pvc, pvc:/path, namespace/pvc:/path) or a snapshot (@name, @name:/path)', '');
+    if (!text) return;
+    const right = parseCompareTarget(text);
+    const checksum = confirm('Also compare the checksums of files whose size is the same? This reads every such file.');
+    const left = { namespace: state.namespace, pvc: state.pvc, path: state.currentPath };
+    $('#details-title').textContent = 'Compare folders';
+    $('#details-summary').classList.remove('details-error');
+    $('#details-summary').textContent = 'Listing both folders…';
+    $('#details-list').innerHTML = '<div class="loading"><div class="spinner"></div></div>';
+    $('#archive-extract-btn').classList.add('hidden');
+    $('#archive-overwrite').parentElement.classList.add('hidden');
+    $('#details-modal').classList.remove('hidden');
+    let res;
+    try {
+        res = await api('/api/compare', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ left, right, checksum }),
+        });
+    } catch (e) {
+        $('#details-summary').textContent = e.message;
+        $('#details-summary').classList.add('details-error');
+        $('#details-list').innerHTML = '';
+        return;
+    }
+    const side = s => `${s.namespace}/${s.snapshot ? `${s.snapshot} (snapshot)` : s.pvc}:${s.path}`;
+    const row = (kind, sign, e, note) => `<div class="compare-item compare-${kind}"><span class="compare-sign">${sign}</span> ` +
+        `${escapeHtml(displayName(e.path))}${e.isDir ? '/' : ''}${note ? ` <span class="activity-where">${escapeHtml(note)}</span>` : ''}</div>`;
+    const changedNote = e => e.reason === 'size' ? `${formatSize(e.leftSize)} → ${formatSize(e.rightSize)}`
+        : e.reason === 'checksum' ? `same size, different ${res.algorithm}` : 'file on one side, folder or link on the other';
+    $('#details-summary').textContent = `${side(res.left)} → ${side(res.right)}: ${res.added.length} added, ` +
+        `${res.removed.length} removed, ${res.changed.length} changed, ${res.unchanged} unchanged` +
+        (res.unverified ? ` (${res.unverified} compared by size only)` : '');
+    const rows = res.added.map(e => row('added', '+', e, e.isDir ? '' : formatSize(e.rightSize))).join('') +
+        res.removed.map(e => row('removed', '−', e, e.isDir ? '' : formatSize(e.leftSize))).join('') +
+        res.changed.map(e => row('changed', '~', e, changedNote(e))).join('');
+    $('#details-list').innerHTML = rows || '<div class="empty-state">The folders are identical.</div>';
+}
+
+// showTokens lists the API tokens scripts use against this server, with
+// buttons to create and revoke them. A new token's secret is shown once.
+async function showTokens(created) {
+    let data;
+    try {
+        data = await api('/api/tokens');
+    } catch (_) {
+        return;
+    }
+    const rows = (data.tokens || []).map(tok =>
+        `<div class="activity-item"><strong>${escapeHtml(tok.name)}</strong> ` +
+        `${tok.scope === 'write' ? 'read-write' : 'read-only'} ` +
+        `<span class="activity-time">created ${escapeHtml(new Date(tok.created).toLocaleString())}, ` +
+        `${tok.lastUsed ? 'last used ' + escapeHtml(new Date(tok.lastUsed).toLocaleString()) : 'never used'}</span> ` +
+        `<button class="btn btn-secondary token-revoke" data-id="${escapeHtml(tok.id)}">Revoke</button></div>`).join('');
+    $('#details-title').textContent = 'API tokens';
+    $('#details-summary').classList.remove('details-error');
+    $('#details-summary').textContent = created
+        ? `Token for "${created.name}" — copy it now, it is not shown again: ${created.secret}`
+        : 'Send a token as "Authorization: Bearer <token>".' + (data.required ? ' Requests from other hosts need one.' : '');
+    $('#details-list').innerHTML = '<div class="file-browser-actions"><button class="btn btn-primary" id="token-create-btn">New token</button></div>' +
+        (rows || '<div class="empty-state">No API tokens yet.</div>');
+    $('#archive-extract-btn').classList.add('hidden');
+    $('#archive-overwrite').parentElement.classList.add('hidden');
+    $('#details-modal').classList.remove('hidden');
+    $('#token-create-btn').addEventListener('click', createToken);
+    document.querySelectorAll('.token-revoke').forEach(btn => btn.addEventListener('click', () => revokeToken(btn.dataset.id)));
+}
+
+async function createToken() {
+    const name = prompt('Token name, e.g. the pipeline that will use it:');
+    if (!name) return;
+    const write = confirm(`May "${name}" upload, change and delete files? Cancel for a read-only token.`);
+    try {
+        const data = await api('/api/tokens', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name, scope: write ? 'write' : 'read' }),
+        });
+        showTokens({ name, secret: data.secret });
+    } catch (_) {}
+}
+
+async function revokeToken(id) {
+    if (!confirm('Revoke this token? Scripts using it will be refused.')) return;
+    try {
+        await api(`/api/tokens?id=${encodeURIComponent(id)}`, { method: 'DELETE' });
+        showToast('Token revoked', 'info');
+        showTokens();
+    } catch (_) {}
+}
+
+function showMigrationReport(report) {
+    const steps = (report.workloads || []).map(w =>
+        `<div class="migration-step"><strong>${escapeHtml(w.kind)} ${escapeHtml(w.name)}</strong>` +
+        (w.command ? `<pre>${escapeHtml(w.command)}</pre>` : '') +
+        (w.note ? `<p>${escapeHtml(w.note)}</p>` : '') + '</div>').join('');
+    $('#details-title').textContent = `Migrated ${report.source}`;
+    $('#details-summary').classList.remove('details-error');
+    $('#details-summary').textContent = `${report.target} on ${report.storageClass} (${report.size}) — ${report.files} files verified`;
+    $('#details-list').innerHTML = steps || '<div class="empty-state">No running workload uses this PVC; point your manifests at the new claim.</div>';
+    $('#archive-extract-btn').classList.add('hidden');
+    $('#archive-overwrite').parentElement.classList.add('hidden');
+    $('#details-modal').classList.remove('hidden');
+}
+
+async function openSaveToServer(filePath, isDir) {
+    saveToServerTarget = { path: filePath, isDir };
+    $('#file-browser-title').textContent = 'Save to Directory on Server';
+    if (await browseDir('')) {
+        $('#file-browser-modal').classList.remove('hidden');
+    } else {
+        saveToServerTarget = null;
+    }
+}
+
+async function saveToServer(destDir, replace = false) {
+    const target = saveToServerTarget;
+    saveToServerTarget = null;
+    showToast(`Saving ${target.path} to ${destDir}…`, 'info');
+    try {
+        const data = await api('/api/download-local', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                namespace: state.namespace,
+                pvc: state.pvc,
+                path: target.path,
+                isDir: target.isDir,
+                destDir,
+                overwrite: replace,
+                delta: replace,
+            }),
+        });
+        const delta = data.delta
+            ? ` (${formatSize(data.delta.transferredBytes)} transferred, ${formatSize(data.delta.reusedBytes)} reused)`
+            : '';
+        showToast(data.message + delta, 'success');
+    } catch (err) {
+        // A file saved before is replaced by fetching only the blocks that
+        // changed since.
+        if (err.status === 409 && !target.isDir && !replace &&
+            confirm(`${err.message}.\n\nReplace it? Only the parts that changed are transferred.`)) {
+            saveToServerTarget = target;
+            saveToServer(destDir, true);
+        }
+    }
+}
 
 function openFileBrowser() {
     $('#kubeconfig-file-input').value = '';
@@ -558,6 +2370,7 @@ async function handleKubeconfigFileSelected(file) {
             });
             contextSelect.disabled = false;
             connectBtn.disabled = false;
+            fillRegistryMirror();
             nsSelect.innerHTML = '<option value="">All namespaces</option>';
             const selectedCtx = data.contexts.find(c => c.name === data.current) || data.contexts[0];
             if (selectedCtx && selectedCtx.namespace) {
@@ -592,6 +2405,7 @@ async function browseDir(dirPath, silent = false) {
         }
 
         fileBrowserSelectedPath = '';
+        fileBrowserCurrentPath = data.currentPath;
         $('#file-browser-current-path').textContent = data.currentPath;
 
         const driveDiv = $('#file-browser-drives');
@@ -626,7 +2440,7 @@ async function browseDir(dirPath, silent = false) {
                         item.classList.add('selected');
                         fileBrowserSelectedPath = entry.path;
                     });
-                } else {
+                } else if (!saveToServerTarget && !uploadFromServerDir) {
                     item.addEventListener('click', () => {
                         list.querySelectorAll('.file-browser-item').forEach(i => i.classList.remove('selected'));
                         item.classList.add('selected');
@@ -649,6 +2463,18 @@ async function browseDir(dirPath, silent = false) {
 }
 
 function selectBrowserFile() {
+    if (uploadFromServerDir) {
+        const srcDir = fileBrowserSelectedPath || fileBrowserCurrentPath;
+        $('#file-browser-modal').classList.add('hidden');
+        uploadFromServer(srcDir);
+        return;
+    }
+    if (saveToServerTarget) {
+        const destDir = fileBrowserSelectedPath || fileBrowserCurrentPath;
+        $('#file-browser-modal').classList.add('hidden');
+        saveToServer(destDir);
+        return;
+    }
     if (fileBrowserSelectedPath) {
         $('#kubeconfig-path').value = fileBrowserSelectedPath;
         $('#file-browser-modal').classList.add('hidden');
@@ -657,13 +2483,19 @@ function selectBrowserFile() {
 }
 
 function closeFileBrowser() {
+    saveToServerTarget = null;
+    uploadFromServerDir = false;
     $('#file-browser-modal').classList.add('hidden');
 }
 
 document.addEventListener('DOMContentLoaded', () => {
     fetchStatus();
+    setInterval(() => {
+        if (state.connected) fetchStatus();
+    }, 60000);
 
     $('#load-kubeconfig-btn').addEventListener('click', loadKubeconfig);
+    $('#context-select').addEventListener('change', fillRegistryMirror);
     $('#browse-kubeconfig-btn').addEventListener('click', openFileBrowser);
     $('#kubeconfig-file-input').addEventListener('change', (e) => {
         const file = e.target.files && e.target.files[0];
@@ -678,6 +2510,7 @@ document.addEventListener('DOMContentLoaded', () => {
         if (e.key === 'Enter') loadKubeconfig();
     });
 
+    $('#backend-type').addEventListener('change', selectBackendType);
     $('#connect-btn').addEventListener('click', connect);
     $('#disconnect-btn').addEventListener('click', disconnect);
 
@@ -688,11 +2521,31 @@ document.addEventListener('DOMContentLoaded', () => {
 
     const nsSelect = $('#namespace-select');
     nsSelect.addEventListener('change', (e) => {
+        if (e.target.value === OTHER_NAMESPACE) {
+            const ns = (prompt('Namespace to open:', '') || '').trim();
+            if (!ns) {
+                e.target.value = state.namespace;
+                return;
+            }
+            if (![...e.target.options].some(o => o.value === ns)) addNamespaceOption(e.target, ns);
+            e.target.value = ns;
+        }
+        leaveSnapshot();
         state.namespace = e.target.value;
         state.pvc = '';
         state.currentPath = '/';
+        $('#snapshot-select').classList.add('hidden');
         $('#upload-btn').disabled = true;
         $('#refresh-btn').disabled = true;
+        $('#save-search-btn').disabled = true;
+        $('#compare-btn').disabled = true;
+        $('#export-select').disabled = true;
+        $('#trash-btn').disabled = true;
+        $('#path-input').disabled = true;
+        $('#path-input').value = '';
+        $('#fs-usage').hidden = true;
+        state.selected.clear();
+        updateBatchDownload();
         $('#file-table-container').innerHTML = `
             <div class="empty-state-large">
                 <svg viewBox="0 0 64 64" width="64" height="64" fill="none" stroke="#666" stroke-width="2">
@@ -711,9 +2564,37 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
+    $('#batch-download-btn').addEventListener('click', downloadSelected);
+
     $('#refresh-btn').addEventListener('click', () => {
-        if (state.pvc) loadFiles();
+        if (state.pvc) loadFiles({ refresh: true });
+    });
+
+    $('#snapshot-select').addEventListener('change', (e) => switchSnapshot(e.target.value));
+    $('#save-search-btn').addEventListener('click', saveSearch);
+    $('#compare-btn').addEventListener('click', compareDirectory);
+    $('#export-select').addEventListener('change', exportListing);
+    $('#trash-btn').addEventListener('click', showTrash);
+    $('#export-settings-btn').addEventListener('click', () => exportSettings().catch(() => {}));
+    $('#import-settings-btn').addEventListener('click', () => $('#import-settings-input').click());
+    $('#import-settings-input').addEventListener('change', (e) => {
+        const file = e.target.files[0];
+        e.target.value = '';
+        if (file) importSettings(file).catch(() => {});
+    });
+
+    initSortControls();
+
+    $('#archive-extract-btn').addEventListener('click', extractArchiveMembers);
+    $('#details-modal-close').addEventListener('click', () => $('#details-modal').classList.add('hidden'));
+    $('#activity-btn').addEventListener('click', showActivity);
+    $('#tokens-btn').addEventListener('click', () => showTokens());
+    $('#details-modal').addEventListener('click', (e) => {
+        if (e.target === $('#details-modal')) $('#details-modal').classList.add('hidden');
     });
 
     initUpload();
+    initPathBar();
+    loadSavedSearches();
+    loadJobs();
 });
@@ -0,0 +1,221 @@
+// Package cleanup runs deferred cleanup (deleting helper pods, removing
+// temporary files) in the background with retries, and keeps a record of
+// recent tasks so failures are visible instead of only being logged.
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateRunning  State = "running"
+	StateRetrying State = "retrying"
+	StateDone     State = "done"
+	StateFailed   State = "failed"
+)
+
+// Func performs one attempt of a cleanup task.
+type Func func(ctx context.Context) error
+
+// Task is the status of one cleanup, as reported by /api/cleanup.
+type Task struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	State     State     `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+type task struct {
+	Task
+	fn Func
+}
+
+const (
+	workers = 4
+	// history is how many finished tasks are kept for the status view.
+	history = 100
+)
+
+// Worker runs cleanup tasks on a small pool of goroutines. Each attempt
+// gets its own timeout, independent of the request that scheduled it.
+type Worker struct {
+	mu          sync.Mutex
+	tasks       []*task
+	seq         int
+	queue       chan *task
+	wg          sync.WaitGroup
+	maxAttempts int
+	timeout     time.Duration
+	backoff     time.Duration
+}
+
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// NewWorker starts a worker. KUBE_BROWSER_CLEANUP_ATTEMPTS (default 5) and
+// KUBE_BROWSER_CLEANUP_TIMEOUT_SEC (default 120) bound each task.
+func NewWorker() *Worker {
+	w := &Worker{
+		queue:       make(chan *task, 256),
+		maxAttempts: envInt("KUBE_BROWSER_CLEANUP_ATTEMPTS", 5),
+		timeout:     time.Duration(envInt("KUBE_BROWSER_CLEANUP_TIMEOUT_SEC", 120)) * time.Second,
+		backoff:     2 * time.Second,
+	}
+	for i := 0; i < workers; i++ {
+		go w.loop()
+	}
+	return w
+}
+
+// Enqueue schedules fn. kind and target only describe the task, e.g.
+// "helper-pod" and "default/kube-browser-helper-abc".
+func (w *Worker) Enqueue(kind, target string, fn Func) {
+	now := time.Now()
+	w.mu.Lock()
+	w.seq++
+	t := &task{
+		Task: Task{
+			ID:      strconv.Itoa(w.seq),
+			Kind:    kind,
+			Target:  target,
+			State:   StatePending,
+			Created: now,
+			Updated: now,
+		},
+		fn: fn,
+	}
+	w.tasks = append(w.tasks, t)
+	w.pruneLocked()
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	w.submit(t)
+}
+
+func (w *Worker) submit(t *task) {
+	select {
+	case w.queue <- t:
+	default:
+		// Never block the caller on a full queue.
+		go func() { w.queue <- t }()
+	}
+}
+
+func (w *Worker) loop() {
+	for t := range w.queue {
+		w.runAttempt(t)
+	}
+}
+
+func (w *Worker) runAttempt(t *task) {
+	w.setState(t, StateRunning, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	err := t.fn(ctx)
+	cancel()
+
+	w.mu.Lock()
+	t.Attempts++
+	attempts := t.Attempts
+	w.mu.Unlock()
+
+	switch {
+	case err == nil:
+		w.setState(t, StateDone, "")
+		w.wg.Done()
+	case attempts >= w.maxAttempts:
+		log.Printf("Cleanup of %s %s failed after %d attempts: %v", t.Kind, t.Target, attempts, err)
+		w.setState(t, StateFailed, err.Error())
+		w.wg.Done()
+	default:
+		log.Printf("Cleanup of %s %s failed (attempt %d/%d), retrying: %v", t.Kind, t.Target, attempts, w.maxAttempts, err)
+		w.setState(t, StateRetrying, err.Error())
+		time.AfterFunc(time.Duration(attempts)*w.backoff, func() { w.submit(t) })
+	}
+}
+
+func (w *Worker) setState(t *task, state State, errMsg string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t.State = state
+	if errMsg != "" || state == StateDone {
+		t.LastError = errMsg
+	}
+	t.Updated = time.Now()
+}
+
+// pruneLocked drops the oldest finished tasks beyond the history limit.
+// Unfinished tasks are always kept.
+func (w *Worker) pruneLocked() {
+	finished := 0
+	for _, t := range w.tasks {
+		if t.State == StateDone || t.State == StateFailed {
+			finished++
+		}
+	}
+	if finished <= history {
+		return
+	}
+	drop := finished - history
+	kept := w.tasks[:0]
+	for _, t := range w.tasks {
+		if drop > 0 && (t.State == StateDone || t.State == StateFailed) {
+			drop--
+			continue
+		}
+		kept = append(kept, t)
+	}
+	w.tasks = kept
+}
+
+// List returns the tracked tasks, newest first.
+func (w *Worker) List() []Task {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]Task, 0, len(w.tasks))
+	for i := len(w.tasks) - 1; i >= 0; i-- {
+		out = append(out, w.tasks[i].Task)
+	}
+	return out
+}
+
+// Drain waits until every scheduled task has finished or failed, or ctx
+// is done. It is meant for graceful shutdown.
+func (w *Worker) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		pending := 0
+		for _, t := range w.List() {
+			if t.State != StateDone && t.State != StateFailed {
+				pending++
+			}
+		}
+		return fmt.Errorf("%d cleanup task(s) still pending: %w", pending, ctx.Err())
+	}
+}
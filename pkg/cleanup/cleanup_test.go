@@ -0,0 +1,87 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestWorker(attempts int) *Worker {
+	w := NewWorker()
+	w.maxAttempts = attempts
+	w.backoff = time.Millisecond
+	return w
+}
+
+func TestWorkerRetriesUntilSuccess(t *testing.T) {
+	w := newTestWorker(5)
+	var calls int32
+	w.Enqueue("helper-pod", "default/helper", func(context.Context) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("apiserver unavailable")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := w.List()
+	if len(tasks) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(tasks))
+	}
+	if tasks[0].State != StateDone || tasks[0].Attempts != 3 || tasks[0].LastError != "" {
+		t.Errorf("unexpected task status: %+v", tasks[0])
+	}
+}
+
+func TestWorkerGivesUpAfterMaxAttempts(t *testing.T) {
+	w := newTestWorker(2)
+	w.Enqueue("temp-file", "/tmp/x", func(context.Context) error {
+		return errors.New("permission denied")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	task := w.List()[0]
+	if task.State != StateFailed || task.Attempts != 2 || task.LastError != "permission denied" {
+		t.Errorf("unexpected task status: %+v", task)
+	}
+}
+
+func TestDrainReportsPendingTasks(t *testing.T) {
+	w := newTestWorker(1)
+	release := make(chan struct{})
+	defer close(release)
+	w.Enqueue("helper-pod", "default/stuck", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Drain to time out, got %v", err)
+	}
+}
+
+func TestListKeepsRecentHistory(t *testing.T) {
+	w := newTestWorker(1)
+	for i := 0; i < history+20; i++ {
+		w.Enqueue("temp-file", "f", func(context.Context) error { return nil })
+		// Let tasks finish so they become eligible for pruning.
+		w.Drain(context.Background())
+	}
+	if got := len(w.List()); got > history+1 {
+		t.Errorf("expected at most %d tracked tasks, got %d", history+1, got)
+	}
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/jobs"
+)
+
+// activityBacklog is how many operations the activity feed remembers.
+// The feed lives in memory only and starts empty after a restart.
+const activityBacklog = 500
+
+// activityErrorBytes is how much of a failed response is kept to find
+// its error message.
+const activityErrorBytes = 4096
+
+// Results of an activity. A request that starts a job is "started"; the
+// job's own entry follows with the state it finished in.
+const (
+	activitySucceeded = "succeeded"
+	activityFailed    = "failed"
+	activityStarted   = "started"
+)
+
+// activityUserHeaders name the user in requests that come through an
+// authenticating proxy (oauth2-proxy, an ingress with external auth).
+// They are taken as sent, so they only mean something behind such a proxy.
+var activityUserHeaders = []string{"X-Forwarded-User", "X-Auth-Request-User", "X-Remote-User", "X-Forwarded-Email", "X-Auth-Request-Email"}
+
+// activityEvent is one operation that changed, or tried to change, a
+// volume: who did what, on which PVC, when, and how it went.
+type activityEvent struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	Pane      string    `json:"pane,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	PVC       string    `json:"pvc,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	// Job is the background job the request started, or that finished.
+	Job        string `json:"job,omitempty"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// activityFeed keeps the latest operations and wakes up the clients
+// streaming them, like helperFeed.
+type activityFeed struct {
+	mu     sync.Mutex
+	events []activityEvent
+	lastID int64
+	wake   chan struct{}
+	// jobs holds the request that started each running job, so the job's
+	// entry can say who started it.
+	jobs map[string]activityEvent
+	// early holds jobs that finished before the request that started them
+	// was recorded.
+	early map[string]jobs.Job
+}
+
+func newActivityFeed() *activityFeed {
+	return &activityFeed{wake: make(chan struct{}), jobs: map[string]activityEvent{}, early: map[string]jobs.Job{}}
+}
+
+func (f *activityFeed) publish(ev activityEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.publishLocked(ev)
+	if ev.Result == activityStarted && ev.Job != "" {
+		if job, ok := f.early[ev.Job]; ok {
+			delete(f.early, ev.Job)
+			f.publishLocked(jobActivity(ev, job))
+		} else {
+			f.jobs[ev.Job] = ev
+		}
+	}
+}
+
+func (f *activityFeed) publishLocked(ev activityEvent) {
+	f.lastID++
+	ev.ID = f.lastID
+	f.events = append(f.events, ev)
+	if len(f.events) > activityBacklog {
+		f.events = f.events[len(f.events)-activityBacklog:]
+	}
+	close(f.wake)
+	f.wake = make(chan struct{})
+}
+
+// jobFinished publishes the entry of a finished job, attributed to the
+// request that started it. A job can finish before that request is
+// recorded; its entry then waits for the request's.
+func (f *activityFeed) jobFinished(job jobs.Job) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ev, ok := f.jobs[job.ID]
+	if !ok {
+		if len(f.early) >= activityBacklog {
+			// Jobs nobody recorded starting, e.g. in tests.
+			f.early = map[string]jobs.Job{}
+		}
+		f.early[job.ID] = job
+		return
+	}
+	delete(f.jobs, job.ID)
+	f.publishLocked(jobActivity(ev, job))
+}
+
+// jobActivity is the entry of a finished job started by the request
+// recorded as ev.
+func jobActivity(ev activityEvent, job jobs.Job) activityEvent {
+	ev.Time = job.Finished
+	ev.Job = job.ID
+	ev.Detail = job.Description
+	ev.Result = string(job.State)
+	ev.Error = job.Error
+	ev.DurationMS = 0
+	if !job.Started.IsZero() {
+		ev.DurationMS = job.Finished.Sub(job.Started).Milliseconds()
+	}
+	return ev
+}
+
+// since returns the events after id that match the namespace and PVC
+// filters (empty matches all), the id of the latest event, and a channel
+// closed on the next publish.
+func (f *activityFeed) since(id int64, namespace, pvc string) ([]activityEvent, int64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []activityEvent
+	for _, ev := range f.events {
+		if ev.ID <= id || (namespace != "" && ev.Namespace != namespace) || (pvc != "" && ev.PVC != pvc) {
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out, f.lastID, f.wake
+}
+
+func (h *Handler) getActivity() *activityFeed {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.activity == nil {
+		h.activity = newActivityFeed()
+	}
+	return h.activity
+}
+
+// requestUser names who sent r: the API token it was sent with, the user
+// an authenticating proxy passed on, the basic-auth user name, or else the
+// client's address.
+func requestUser(r *http.Request) string {
+	if tok, ok := requestToken(r); ok {
+		return "token:" + tok.Name
+	}
+	for _, name := range activityUserHeaders {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+type activityKey struct{}
+
+// noteActivity fills in what a recorded request is about, once the
+// handler knows. Requests that are not recorded ignore it.
+func noteActivity(r *http.Request, namespace, pvc, path, detail string) {
+	if ev, ok := r.Context().Value(activityKey{}).(*activityEvent); ok {
+		ev.Namespace, ev.PVC, ev.Path, ev.Detail = namespace, pvc, path, detail
+	}
+}
+
+// noteActivityJob records that a request started job.
+func noteActivityJob(r *http.Request, job jobs.Job) {
+	if ev, ok := r.Context().Value(activityKey{}).(*activityEvent); ok {
+		ev.Job = job.ID
+		if ev.Detail == "" {
+			ev.Detail = job.Description
+		}
+	}
+}
+
+// activityRecorder notes a response's status and keeps the start of an
+// error body for its message.
+type activityRecorder struct {
+	http.ResponseWriter
+	status  int
+	errBody []byte
+}
+
+func (rw *activityRecorder) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *activityRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if rw.status >= 400 && len(rw.errBody) < activityErrorBytes {
+		rw.errBody = append(rw.errBody, b[:min(len(b), activityErrorBytes-len(rw.errBody))]...)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (rw *activityRecorder) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
+// Activity records the requests next serves in the activity feed under
+// action, except GET and HEAD, which change nothing. Handlers say what a
+// request is about with noteActivity. Cached listings are forgotten once
+// such a request is served, whether or not it succeeded.
+func (h *Handler) Activity(action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ev := &activityEvent{
+			Time:   time.Now(),
+			User:   requestUser(r),
+			Action: action,
+			Pane:   r.URL.Query().Get("pane"),
+		}
+		rec := &activityRecorder{ResponseWriter: w}
+		defer func() {
+			h.getListingCache().invalidate()
+			ev.DurationMS = time.Since(ev.Time).Milliseconds()
+			switch p := recover(); {
+			case p != nil:
+				// An aborted stream: the client saw the connection drop.
+				ev.Result, ev.Error = activityFailed, "interrupted"
+				h.getActivity().publish(*ev)
+				panic(p)
+			case rec.status >= 400:
+				ev.Result, ev.Error = activityFailed, http.StatusText(rec.status)
+				var body struct {
+					Error string `json:"error"`
+				}
+				if json.Unmarshal(rec.errBody, &body) == nil && body.Error != "" {
+					ev.Error = body.Error
+				}
+			case ev.Job != "":
+				ev.Result = activityStarted
+			default:
+				ev.Result = activitySucceeded
+			}
+			h.getActivity().publish(*ev)
+		}()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), activityKey{}, ev)))
+	})
+}
+
+// ActivityHandler reports recent operations across the server, whoever
+// ran them and in whichever pane, so people sharing one instance can see
+// what changed on which volume:
+//
+//	GET /api/activity[?since=<id>&namespace=&pvc=]
+//
+// It answers with {"events": [...], "last": <id of the latest event>}, or,
+// when the request accepts text/event-stream, streams each event as it
+// happens, resuming after Last-Event-ID, like /api/helper-events.
+func (h *Handler) ActivityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	since := q.Get("since")
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		since = last
+	}
+	var after int64
+	if since != "" {
+		n, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || n < 0 {
+			h.jsonError(w, "since must be an event id", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	feed := h.getActivity()
+	namespace, pvc := q.Get("namespace"), q.Get("pvc")
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		events, last, _ := feed.since(after, namespace, pvc)
+		if events == nil {
+			events = []activityEvent{}
+		}
+		h.jsonResponse(w, map[string]interface{}{"events": events, "last": last})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepalive := time.NewTicker(helperEventKeepalive)
+	defer keepalive.Stop()
+	for {
+		events, _, wake := feed.since(after, namespace, pvc)
+		for _, ev := range events {
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.ID, data)
+			after = ev.ID
+		}
+		if len(events) > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
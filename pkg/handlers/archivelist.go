@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	gopath "path"
+	"strconv"
+	"strings"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// ArchiveContentsHandler lists the members of a tar or zip archive on the
+// PVC without extracting or downloading it.
+func (h *Handler) ArchiveContentsHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pvc := r.URL.Query().Get("pvc")
+	path := r.URL.Query().Get("path")
+
+	if namespace == "" || pvc == "" || path == "" {
+		h.jsonError(w, "namespace, pvc, and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	path = sanitizePath(path)
+	if !k8s.IsListableArchive(path) {
+		h.jsonError(w, fmt.Sprintf("%s is not a supported archive (.tar, .tar.gz, .tgz, .tar.bz2, .tar.xz, .zip)", path), http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			h.jsonError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	listing, err := client.ListArchive(r.Context(), namespace, pvc, path, limit)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, listing)
+}
+
+// headerOnWrite sets the download headers just before the first byte is
+// written, so a failure that happens before any output can still be
+// reported as a JSON error.
+type headerOnWrite struct {
+	w           http.ResponseWriter
+	disposition string
+	written     bool
+}
+
+func (hw *headerOnWrite) Write(p []byte) (int, error) {
+	if !hw.written {
+		hw.w.Header().Set("Content-Disposition", hw.disposition)
+		hw.w.Header().Set("Content-Type", "application/octet-stream")
+		hw.written = true
+	}
+	return hw.w.Write(p)
+}
+
+// ArchiveMemberHandler downloads a single member of a tar or zip archive
+// on the PVC: GET /api/archive-member?namespace=&pvc=&path=&member=
+func (h *Handler) ArchiveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pvc := r.URL.Query().Get("pvc")
+	path := r.URL.Query().Get("path")
+	member := r.URL.Query().Get("member")
+
+	if namespace == "" || pvc == "" || path == "" || member == "" {
+		h.jsonError(w, "namespace, pvc, path, and member parameters are required", http.StatusBadRequest)
+		return
+	}
+	path = sanitizePath(path)
+	if !k8s.IsListableArchive(path) {
+		h.jsonError(w, fmt.Sprintf("%s is not a supported archive", path), http.StatusBadRequest)
+		return
+	}
+	if strings.HasSuffix(member, "/") {
+		h.jsonError(w, "member is a directory; extract it instead", http.StatusBadRequest)
+		return
+	}
+
+	hw := &headerOnWrite{w: w, disposition: attachmentDisposition(gopath.Base(member))}
+	if err := client.StreamArchiveMember(r.Context(), namespace, pvc, path, member, hw); err != nil {
+		if !hw.written {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Download of %s from %s failed mid-stream: %v", member, path, err)
+	}
+}
+
+// jobKindExtract extracts selected members of an archive on a PVC into a
+// directory of the same PVC. tar reads the archive sequentially, so even a
+// single member of a multi-gigabyte archive can take minutes.
+const jobKindExtract = "extract"
+
+type extractParams struct {
+	Namespace string   `json:"namespace"`
+	PVC       string   `json:"pvc"`
+	Path      string   `json:"path"`
+	Members   []string `json:"members"`
+	DestDir   string   `json:"destDir"`
+	Overwrite bool     `json:"overwrite"`
+}
+
+func (h *Handler) runExtractJob(ctx context.Context, jh *jobs.Handle) error {
+	var p extractParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+	return client.ExtractArchiveMembers(ctx, p.Namespace, p.PVC, p.Path, p.Members, p.DestDir, p.Overwrite)
+}
+
+// ArchiveExtractHandler queues the extraction of selected archive members:
+// POST /api/archive-extract {namespace, pvc, path, members, destDir, overwrite}.
+// destDir defaults to the archive's directory. Progress is reported by
+// /api/jobs.
+func (h *Handler) ArchiveExtractHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	if h.getClient() == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req extractParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || req.Path == "" || len(req.Members) == 0 {
+		h.jsonError(w, "namespace, pvc, path and members are required", http.StatusBadRequest)
+		return
+	}
+	req.Path = sanitizePath(req.Path)
+	if !k8s.IsListableArchive(req.Path) {
+		h.jsonError(w, fmt.Sprintf("%s is not a supported archive", req.Path), http.StatusBadRequest)
+		return
+	}
+	if req.DestDir == "" {
+		req.DestDir = gopath.Dir(req.Path)
+	}
+	req.DestDir = sanitizePath(req.DestDir)
+	if h.refuseTrashWrite(w, req.DestDir) {
+		return
+	}
+
+	noteActivity(r, req.Namespace, req.PVC, req.Path, "")
+	job, err := h.submitJob(r, jobKindExtract, fmt.Sprintf("Extract %d item(s) from %s in %s/%s", len(req.Members), gopath.Base(req.Path), req.Namespace, req.PVC), req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
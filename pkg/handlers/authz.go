@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// authzFileEnv names the JSON file mapping identity-provider groups to
+// roles (see authzConfig). Without it every request may do everything.
+const authzFileEnv = "KUBE_BROWSER_AUTHZ_FILE"
+
+// authzMaxBody bounds the JSON body read to find the namespaces a request
+// names.
+const authzMaxBody = 1 << 20
+
+// Roles a group can be given.
+const (
+	// roleAdmin may do everything, including connecting the server.
+	roleAdmin = "admin"
+	// roleReadWrite may read and change volumes in its namespaces.
+	roleReadWrite = "read-write"
+	// roleReadOnly may only read volumes in its namespaces.
+	roleReadOnly = "read-only"
+)
+
+// defaultGroupsHeaders carry the user's groups as oauth2-proxy passes them
+// on, with --pass-user-headers or --set-xauthrequest.
+var defaultGroupsHeaders = []string{"X-Forwarded-Groups", "X-Auth-Request-Groups"}
+
+// adminPaths change the server itself rather than a volume: its cluster
+// connection, its state and the local filesystem. Opening and closing
+// panes is the admin's too (see adminOnly).
+var adminPaths = map[string]bool{
+	"/api/kubeconfig":        true,
+	"/api/kubeconfig-upload": true,
+	"/api/connect":           true,
+	"/api/disconnect":        true,
+	"/api/cleanup":           true,
+	"/api/config/import":     true,
+	"/api/tokens":            true,
+	"/api/browse":            true,
+	"/api/download-local":    true,
+	"/api/upload-local-dir":  true,
+}
+
+// readingPaths are POST and DELETE endpoints that only read volumes, or
+// only touch state of the requester's own: packing a selection, estimating
+// a transfer, saving a search, cancelling a listing or another operation,
+// comparing two directories.
+var readingPaths = map[string]bool{
+	"/api/download-batch":   true,
+	"/api/download-archive": true,
+	"/api/estimate":         true,
+	"/api/saved-searches":   true,
+	"/api/files/operation":  true,
+	"/api/operations":       true,
+	"/api/compare":          true,
+}
+
+// adminOnly reports whether r needs the admin role.
+func adminOnly(r *http.Request) bool {
+	if r.URL.Path == "/api/panes" {
+		return r.Method != http.MethodGet
+	}
+	return adminPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/api/admin/")
+}
+
+// changesVolumes reports whether r may change what is on a volume.
+func changesVolumes(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+	return !readingPaths[r.URL.Path]
+}
+
+// roleGrant is a role, in every namespace or only in Namespaces.
+type roleGrant struct {
+	Role       string   `json:"role"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// authzConfig is the file KUBE_BROWSER_AUTHZ_FILE names:
+//
+//	{
+//	  "groupsHeader": "X-Forwarded-Groups",
+//	  "groups": {
+//	    "platform": {"role": "admin"},
+//	    "payments-devs": {"role": "read-write", "namespaces": ["payments", "billing"]},
+//	    "auditors": {"role": "read-only"}
+//	  },
+//	  "default": {"role": "read-only", "namespaces": ["sandbox"]}
+//	}
+//
+// A user gets the grants of every group they are in, or default when none
+// of them is listed; without default such a user is refused.
+type authzConfig struct {
+	GroupsHeader string               `json:"groupsHeader,omitempty"`
+	Groups       map[string]roleGrant `json:"groups"`
+	Default      *roleGrant           `json:"default,omitempty"`
+}
+
+func (g roleGrant) validate(name string) error {
+	switch g.Role {
+	case roleAdmin:
+		if len(g.Namespaces) > 0 {
+			return fmt.Errorf("%s: the admin role applies to every namespace", name)
+		}
+	case roleReadWrite, roleReadOnly:
+	default:
+		return fmt.Errorf("%s: role must be %q, %q or %q, not %q", name, roleAdmin, roleReadWrite, roleReadOnly, g.Role)
+	}
+	for _, ns := range g.Namespaces {
+		if strings.TrimSpace(ns) == "" {
+			return fmt.Errorf("%s: empty namespace", name)
+		}
+	}
+	return nil
+}
+
+func (c *authzConfig) validate() error {
+	if len(c.Groups) == 0 && c.Default == nil {
+		return fmt.Errorf("no groups and no default role")
+	}
+	for group, g := range c.Groups {
+		if err := g.validate(fmt.Sprintf("group %q", group)); err != nil {
+			return err
+		}
+	}
+	if c.Default != nil {
+		return c.Default.validate("default")
+	}
+	return nil
+}
+
+// LoadAuthzConfig reads the group mapping KUBE_BROWSER_AUTHZ_FILE names,
+// if any. GroupAuthz enforces it from then on.
+func (h *Handler) LoadAuthzConfig() error {
+	path := os.Getenv(authzFileEnv)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", authzFileEnv, err)
+	}
+	var c authzConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return fmt.Errorf("%s: invalid %s: %w", authzFileEnv, path, err)
+	}
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("%s: invalid %s: %w", authzFileEnv, path, err)
+	}
+	h.authz = &c
+	log.Printf("Group authorization enabled: %d group(s) mapped from %s", len(c.Groups), path)
+	return nil
+}
+
+// access is what a request's groups grant.
+type access struct {
+	User   string      `json:"user"`
+	Groups []string    `json:"groups"`
+	Grants []roleGrant `json:"grants"`
+}
+
+// accessFor collects the grants of the groups r's user is in.
+func (c *authzConfig) accessFor(r *http.Request) access {
+	a := access{User: requestUser(r)}
+	headers := defaultGroupsHeaders
+	if c.GroupsHeader != "" {
+		headers = []string{c.GroupsHeader}
+	}
+	for _, name := range headers {
+		for _, v := range r.Header.Values(name) {
+			for _, group := range strings.Split(v, ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					a.Groups = append(a.Groups, group)
+				}
+			}
+		}
+	}
+	for _, group := range a.Groups {
+		if g, ok := c.Groups[group]; ok {
+			a.Grants = append(a.Grants, g)
+		}
+	}
+	if len(a.Grants) == 0 && c.Default != nil {
+		a.Grants = []roleGrant{*c.Default}
+	}
+	return a
+}
+
+func (a access) admin() bool {
+	return slices.ContainsFunc(a.Grants, func(g roleGrant) bool { return g.Role == roleAdmin })
+}
+
+// allows reports whether a grant lets the user read namespace or, with
+// write, change it. An empty namespace asks about any namespace at all.
+func (a access) allows(namespace string, write bool) bool {
+	for _, g := range a.Grants {
+		if g.Role == roleReadOnly && write {
+			continue
+		}
+		if g.Role == roleAdmin || namespace == "" || len(g.Namespaces) == 0 || slices.Contains(g.Namespaces, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleNamespaces keeps the namespaces a grant lets the user read.
+func (a access) visibleNamespaces(namespaces []string) []string {
+	var out []string
+	for _, ns := range namespaces {
+		if a.allows(ns, false) {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+type accessKey struct{}
+
+// requestAccess returns what r's groups grant, when group authorization
+// is enabled.
+func requestAccess(r *http.Request) (access, bool) {
+	a, ok := r.Context().Value(accessKey{}).(access)
+	return a, ok
+}
+
+// isNamespaceKey reports whether a query parameter or JSON field names a
+// namespace: "namespace", "targetNamespace", "destNamespace", ...
+func isNamespaceKey(key string) bool {
+	return key == "namespace" || strings.HasSuffix(key, "Namespace")
+}
+
+// jsonNamespaces collects the string values of namespace fields at any
+// depth of a JSON document, such as both ends of a transfer.
+func jsonNamespaces(v interface{}, out []string) []string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && isNamespaceKey(key) {
+				out = append(out, s)
+			} else {
+				out = jsonNamespaces(value, out)
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			out = jsonNamespaces(value, out)
+		}
+	}
+	return out
+}
+
+// requestNamespaces returns the namespaces r names: in its query, in the
+// path of a /raw/ URL, in a JSON body, which is put back for the handler
+// to read, and in the parameters of the job, the namespaces of the
+// operation or the namespace of the saved search it names by id. Multipart
+// forms are left to their handler (see checkAccess); plain forms are read
+// field by field.
+func (h *Handler) requestNamespaces(r *http.Request) ([]string, error) {
+	var out []string
+	for key, values := range r.URL.Query() {
+		if isNamespaceKey(key) {
+			out = append(out, values...)
+		}
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/raw/"); ok {
+		if parts := strings.SplitN(rest, "/", 3); len(parts) >= 2 {
+			ns, err := url.PathUnescape(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ns)
+		}
+	}
+	if id := r.URL.Query().Get("id"); id != "" && (r.URL.Path == "/api/jobs" || r.URL.Path == "/api/download-archive") {
+		if job, ok := h.getJobs().Get(id); ok {
+			var params interface{}
+			if json.Unmarshal(job.Params, &params) == nil {
+				out = jsonNamespaces(params, out)
+			}
+		}
+	}
+	if id := r.URL.Query().Get("id"); id != "" && r.URL.Path == "/api/operations" {
+		if op, ok := h.getOperations().get(id); ok {
+			out = append(out, op.Namespaces...)
+		}
+	}
+	if id := r.URL.Query().Get("id"); id != "" && (r.URL.Path == "/api/saved-searches" || r.URL.Path == "/api/saved-searches/run") {
+		if search, ok := h.getSavedSearches().get(id); ok {
+			out = append(out, search.Namespace)
+		}
+	}
+
+	if r.Body == nil || r.Body == http.NoBody || strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return out, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, authzMaxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		// A form field may hold a JSON request of its own, as the one
+		// download-batch takes from a plain form post.
+		form, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range form {
+			for _, value := range values {
+				var field interface{}
+				if isNamespaceKey(key) {
+					out = append(out, value)
+				} else if json.Unmarshal([]byte(value), &field) == nil {
+					out = jsonNamespaces(field, out)
+				}
+			}
+		}
+		return out, nil
+	}
+	var body interface{}
+	if json.Unmarshal(data, &body) == nil {
+		out = jsonNamespaces(body, out)
+	} else if trimmed := bytes.TrimSpace(data); len(data) > authzMaxBody && len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return nil, fmt.Errorf("request body is too large to check which namespaces it names")
+	}
+	return out, nil
+}
+
+// readCloser reads from one reader and closes another, for a body that
+// was partly read ahead.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// GroupAuthz enforces the roles KUBE_BROWSER_AUTHZ_FILE gives the groups
+// an authenticating proxy passes on. Every /api/ and /raw/ request needs
+// a grant: admin for the server's own settings, otherwise one allowing
+// each namespace the request names, read-write for those that change a
+// volume. Requests made with an API token were authorized by TokenAuth.
+func (h *Handler) GroupAuthz(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.authz == nil || !(strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/raw/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := requestToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		a := h.authz.accessFor(r)
+		if len(a.Grants) == 0 {
+			h.jsonError(w, fmt.Sprintf("none of %s's groups has a KubeBrowser role", a.User), http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), accessKey{}, a)
+		if a.admin() {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		if adminOnly(r) {
+			h.jsonError(w, fmt.Sprintf("%s needs the %s role", r.URL.Path, roleAdmin), http.StatusForbidden)
+			return
+		}
+		namespaces, err := h.requestNamespaces(r)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		write := changesVolumes(r)
+		if len(namespaces) == 0 {
+			namespaces = []string{""}
+		}
+		for _, ns := range namespaces {
+			if !a.allows(ns, write) {
+				h.jsonError(w, accessDenied(a, ns, write), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func accessDenied(a access, namespace string, write bool) string {
+	verb := "read"
+	if write {
+		verb = "change"
+	}
+	if namespace == "" {
+		return fmt.Sprintf("%s's groups may not %s volumes", a.User, verb)
+	}
+	return fmt.Sprintf("%s's groups may not %s volumes in namespace %q", a.User, verb, namespace)
+}
+
+// checkAccess refuses a request whose namespaces GroupAuthz could not see,
+// such as the fields of a multipart upload, when the user's groups do not
+// allow changing them. It reports whether it wrote the error.
+func (h *Handler) checkAccess(w http.ResponseWriter, r *http.Request, namespaces ...string) bool {
+	a, ok := requestAccess(r)
+	if !ok {
+		return false
+	}
+	for _, ns := range namespaces {
+		if !a.allows(ns, changesVolumes(r)) {
+			h.jsonError(w, accessDenied(a, ns, changesVolumes(r)), http.StatusForbidden)
+			return true
+		}
+	}
+	return false
+}
+
+// accessStatus describes r's grants for /api/status, or nil without group
+// authorization.
+func accessStatus(r *http.Request) interface{} {
+	a, ok := requestAccess(r)
+	if !ok {
+		return nil
+	}
+	sort.Strings(a.Groups)
+	return map[string]interface{}{"user": a.User, "groups": a.Groups, "grants": a.Grants, "admin": a.admin()}
+}
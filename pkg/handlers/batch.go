@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// maxBatchPaths bounds the selection of a batch download, which ends up
+// on tar's command line.
+const maxBatchPaths = 1000
+
+type batchDownloadRequest struct {
+	Namespace string   `json:"namespace"`
+	PVC       string   `json:"pvc"`
+	Paths     []string `json:"paths"`
+	Exclude   []string `json:"exclude"`
+	// Format is "tar" (a .tar.gz, the default) or "zip".
+	Format string `json:"format"`
+	// Name is the file name offered to the browser, without extension.
+	Name string `json:"name"`
+}
+
+// batchArchiveName is the download's file name: the request's name, the
+// single path's base name, or the PVC's.
+func batchArchiveName(req batchDownloadRequest) string {
+	name := strings.TrimSuffix(archiveName(req.PVC, req.Paths), ".tar.gz")
+	if n := path.Base(sanitizePath(req.Name)); n != "/" && n != "." {
+		name = n
+	}
+	if req.Format == "zip" {
+		return name + ".zip"
+	}
+	return name + ".tar.gz"
+}
+
+// tarToZip rewrites a gzip-compressed tar as a zip, entry by entry, so a
+// zip can be streamed from tar in the pod without spooling it. Zip entries
+// are deflated and carry their mode and modification time; symlinks are
+// kept as links.
+func tarToZip(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	zw := zip.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var body io.Reader
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir:
+			body = tr
+		case tar.TypeSymlink:
+			body = strings.NewReader(hdr.Linkname)
+		default:
+			// Hard links, devices and FIFOs have no zip equivalent.
+			continue
+		}
+		zh, err := zip.FileInfoHeader(hdr.FileInfo())
+		if err != nil {
+			return err
+		}
+		zh.Name = strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag == tar.TypeDir {
+			zh.Name = strings.TrimSuffix(zh.Name, "/") + "/"
+		} else {
+			zh.Method = zip.Deflate
+		}
+		zh.Modified = hdr.ModTime
+		fw, err := zw.CreateHeader(zh)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			if _, err := io.Copy(fw, body); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// DownloadBatchHandler streams several files and directories of a PVC as
+// one archive, for a selection in the file list:
+//
+//	POST /api/download-batch {namespace, pvc, paths, exclude, format, name}
+//
+// format is "tar" (.tar.gz, default) or "zip". The body is JSON, or a form
+// with the JSON in its request field so a plain form submit can start a
+// browser download. Like /api/download-dir, nothing is spooled: the
+// archive has no Content-Length, and an error partway drops the
+// connection. For very large selections use /api/download-archive.
+func (h *Handler) DownloadBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req batchDownloadRequest
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body = strings.NewReader(r.PostFormValue("request"))
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || len(req.Paths) == 0 {
+		h.jsonError(w, "namespace, pvc and paths are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Paths) > maxBatchPaths {
+		h.jsonError(w, fmt.Sprintf("at most %d paths can be downloaded at once; use /api/download-archive for more", maxBatchPaths), http.StatusBadRequest)
+		return
+	}
+	switch req.Format {
+	case "":
+		req.Format = "tar"
+	case "tar", "zip":
+	default:
+		h.jsonError(w, `format must be "tar" or "zip"`, http.StatusBadRequest)
+		return
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = sanitizePath(p)
+	}
+	exclude, err := k8s.CleanExcludes(req.Exclude)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(client.StreamArchive(r.Context(), req.Namespace, req.PVC, req.Paths, exclude, pw))
+	}()
+	var archive io.Reader = pr
+	contentType := "application/gzip"
+	if req.Format == "zip" {
+		zr, zw := io.Pipe()
+		defer zr.Close()
+		go func() {
+			err := tarToZip(pr, zw)
+			if err == nil {
+				// tar reports a failure only after the archive ends.
+				_, err = io.Copy(io.Discard, pr)
+			}
+			pr.CloseWithError(err)
+			zw.CloseWithError(err)
+		}()
+		archive, contentType = zr, "application/zip"
+	}
+
+	br := bufio.NewReaderSize(archive, downloadBufferSize)
+	if _, err := br.Peek(1); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Disposition", attachmentDisposition(batchArchiveName(req)))
+	w.Header().Set("Content-Type", contentType)
+	n, err := br.WriteTo(w)
+	if err != nil {
+		log.Printf("Batch download of %d paths from %s/%s interrupted: %v", len(req.Paths), req.Namespace, req.PVC, err)
+		panic(http.ErrAbortHandler)
+	}
+	h.throughput.record(client, n, time.Since(start))
+}
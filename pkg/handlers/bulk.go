@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindBulk runs a report or a backup on every PVC matching a label
+// selector, across namespaces, a few claims at a time.
+const jobKindBulk = "bulk"
+
+// Bulk actions.
+const (
+	// bulkReport runs df on each claim.
+	bulkReport = "report"
+	// bulkBackup saves each claim as a .tar.gz on the KubeBrowser host.
+	bulkBackup = "backup"
+)
+
+type bulkParams struct {
+	Selector    string   `json:"selector"`
+	Action      string   `json:"action"`
+	DestDir     string   `json:"destDir,omitempty"`
+	Exclude     []string `json:"exclude,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"`
+}
+
+// bulkItem is how one claim fared.
+type bulkItem struct {
+	Namespace    string               `json:"namespace"`
+	PVC          string               `json:"pvc"`
+	Status       string               `json:"status"`
+	Capacity     string               `json:"capacity,omitempty"`
+	StorageClass string               `json:"storageClass,omitempty"`
+	Usage        *k8s.FilesystemUsage `json:"usage,omitempty"`
+	File         string               `json:"file,omitempty"`
+	Size         int64                `json:"size,omitempty"`
+	Error        string               `json:"error,omitempty"`
+	DurationMS   int64                `json:"durationMs"`
+}
+
+// bulkResult is the consolidated outcome of a bulk job, one item per
+// matching claim in namespace and name order.
+type bulkResult struct {
+	Action    string     `json:"action"`
+	Selector  string     `json:"selector"`
+	PVCs      []bulkItem `json:"pvcs"`
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	// UsedBytes adds up a report's usage; BackupBytes a backup's files.
+	UsedBytes   int64 `json:"usedBytes,omitempty"`
+	BackupBytes int64 `json:"backupBytes,omitempty"`
+}
+
+// bulkMaxConcurrency reads KUBE_BROWSER_BULK_CONCURRENCY, the most claims
+// a bulk job works on at once; it is also the default. Every claim still
+// takes its exec sessions from the shared limit.
+func bulkMaxConcurrency() int {
+	if v := os.Getenv("KUBE_BROWSER_BULK_CONCURRENCY"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("Warning: invalid KUBE_BROWSER_BULK_CONCURRENCY %q, using 4", v)
+	}
+	return 4
+}
+
+func (h *Handler) runBulkJob(ctx context.Context, jh *jobs.Handle) error {
+	var p bulkParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+	pvcs, err := client.SelectPVCs(ctx, p.Selector)
+	if err != nil {
+		return err
+	}
+	if len(pvcs) == 0 {
+		return fmt.Errorf("no PVCs match %q", p.Selector)
+	}
+
+	// One stamp for the whole run, so a night's backups sort together.
+	stamp := time.Now().UTC().Format("20060102-150405")
+	res := bulkResult{Action: p.Action, Selector: p.Selector, PVCs: make([]bulkItem, len(pvcs))}
+	var mu sync.Mutex
+	var done int64
+	jh.SetProgress(0, int64(len(pvcs)))
+
+	sem := make(chan struct{}, max(p.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, pvc := range pvcs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			item := h.bulkOne(ctx, client, p, pvc, stamp)
+			mu.Lock()
+			defer mu.Unlock()
+			res.PVCs[i] = item
+			done++
+			jh.SetProgress(done, int64(len(pvcs)))
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range res.PVCs {
+		if item.Error != "" {
+			res.Failed++
+			continue
+		}
+		res.Succeeded++
+		if item.Usage != nil {
+			res.UsedBytes += item.Usage.UsedBytes
+		}
+		res.BackupBytes += item.Size
+	}
+	if err := jh.SetResult(res); err != nil {
+		return err
+	}
+	if res.Failed > 0 {
+		return fmt.Errorf("%d of %d PVCs failed; see the result for each", res.Failed, len(pvcs))
+	}
+	return nil
+}
+
+// bulkOne runs p's action on one claim.
+func (h *Handler) bulkOne(ctx context.Context, client KubeClient, p bulkParams, pvc k8s.PVCInfo, stamp string) bulkItem {
+	start := time.Now()
+	item := bulkItem{Namespace: pvc.Namespace, PVC: pvc.Name, Status: pvc.Status, Capacity: pvc.Capacity, StorageClass: pvc.StorageClass}
+	var err error
+	switch {
+	case pvc.Status != "" && pvc.Status != "Bound":
+		err = fmt.Errorf("PVC is %s, not Bound", pvc.Status)
+	case p.Action == bulkReport:
+		item.Usage, err = client.FilesystemUsage(ctx, pvc.Namespace, pvc.Name)
+	default:
+		item.File, item.Size, err = h.bulkBackupOne(ctx, client, p, pvc, stamp)
+	}
+	if err != nil {
+		item.Error = err.Error()
+		log.Printf("Bulk %s of %s/%s failed: %v", p.Action, pvc.Namespace, pvc.Name, err)
+	}
+	item.DurationMS = time.Since(start).Milliseconds()
+	return item
+}
+
+// bulkBackupOne saves the whole claim as <destDir>/<namespace>/<pvc>-<stamp>.tar.gz.
+// The archive is written under a temporary name and renamed once complete,
+// so a file with the final name is never partial.
+func (h *Handler) bulkBackupOne(ctx context.Context, client KubeClient, p bulkParams, pvc k8s.PVCInfo, stamp string) (string, int64, error) {
+	dir := filepath.Join(p.DestDir, pvc.Namespace)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(dir, ".kube-browser-*.part")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer h.removeLocalFile(tmp.Name())
+
+	cw := &countingFileWriter{f: tmp}
+	err = client.StreamArchive(ctx, pvc.Namespace, pvc.Name, []string{"/"}, p.Exclude, cw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	target := filepath.Join(dir, fmt.Sprintf("%s-%s.tar.gz", pvc.Name, stamp))
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, err
+	}
+	log.Printf("Backed up %s/%s to %s (%d bytes)", pvc.Namespace, pvc.Name, target, cw.n)
+	return target, cw.n, nil
+}
+
+// BulkHandler starts a report or backup of every PVC matching a label
+// selector, cluster-wide:
+//
+//	POST /api/admin/bulk {selector, action, destDir, exclude, concurrency}
+//
+// action is "report", which runs df on each claim, or "backup", which
+// saves each claim as a .tar.gz under destDir on the KubeBrowser host.
+// The job's result lists every claim with its outcome; one that fails does
+// not stop the others. Backups write to the local filesystem, so the
+// endpoint is registered behind LocalhostOnly.
+func (h *Handler) BulkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req bulkParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Selector == "" {
+		h.jsonError(w, "selector is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := k8s.ParseSelector(req.Selector); err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusBadRequest)
+		return
+	}
+	desc := fmt.Sprintf("Report on PVCs matching %s", req.Selector)
+	switch req.Action {
+	case bulkReport:
+	case bulkBackup:
+		if req.DestDir == "" {
+			h.jsonError(w, "destDir is required for a backup", http.StatusBadRequest)
+			return
+		}
+		req.DestDir = filepath.Clean(req.DestDir)
+		if !filepath.IsAbs(req.DestDir) {
+			h.jsonError(w, "destDir must be an absolute path", http.StatusBadRequest)
+			return
+		}
+		if info, err := os.Stat(req.DestDir); err != nil || !info.IsDir() {
+			h.jsonError(w, fmt.Sprintf("destDir %s is not an existing directory", req.DestDir), http.StatusBadRequest)
+			return
+		}
+		exclude, err := k8s.CleanExcludes(req.Exclude)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Exclude = exclude
+		desc = fmt.Sprintf("Back up PVCs matching %s to %s", req.Selector, req.DestDir)
+	default:
+		h.jsonError(w, `action must be "report" or "backup"`, http.StatusBadRequest)
+		return
+	}
+	max := bulkMaxConcurrency()
+	if req.Concurrency == 0 {
+		req.Concurrency = max
+	}
+	if req.Concurrency < 0 || req.Concurrency > max {
+		h.jsonError(w, fmt.Sprintf("concurrency must be between 1 and %d", max), http.StatusBadRequest)
+		return
+	}
+
+	noteActivity(r, "", "", "", desc)
+	job, err := h.submitJob(r, jobKindBulk, desc, req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// ChecksumHandler computes the digest of a file on the PVC, to compare an
+// upload or a download with the local copy:
+//
+//	GET /api/checksum?namespace=&pvc=&path=&algo=sha256
+//
+// algo is sha256 (the default), sha1, sha512 or md5. The file is hashed
+// in the pod by sha256sum and friends, BusyBox's applets or openssl, and
+// in a helper pod when the container has none. It takes ?pane=<id>.
+func (h *Handler) ChecksumHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	namespace, pvc := q.Get("namespace"), q.Get("pvc")
+	if namespace == "" || pvc == "" || q.Get("path") == "" {
+		h.jsonError(w, "namespace, pvc and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	filePath := sanitizePath(q.Get("path"))
+	algo := q.Get("algo")
+	if algo == "" {
+		algo = "sha256"
+	}
+	if _, err := k8s.NewHash(algo); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Hashing a multi-gigabyte file outlasts the server's WriteTimeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	sum, err := client.FileChecksum(r.Context(), namespace, pvc, filePath, algo)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, sum)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"kube-browser/pkg/cleanup"
+)
+
+func (h *Handler) getCleanup() *cleanup.Worker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cleanup == nil {
+		h.cleanup = cleanup.NewWorker()
+	}
+	return h.cleanup
+}
+
+// removeLocalFile deletes a temporary local file in the background. A file
+// that is already gone counts as removed.
+func (h *Handler) removeLocalFile(path string) {
+	h.getCleanup().Enqueue("temp-file", path, func(context.Context) error {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// DrainCleanup waits for scheduled cleanup to finish, for graceful
+// shutdown.
+func (h *Handler) DrainCleanup(ctx context.Context) error {
+	return h.getCleanup().Drain(ctx)
+}
+
+// CleanupHandler reports deferred cleanup tasks (helper pod deletions,
+// temporary files) and whether any have failed for good:
+//
+//	GET /api/cleanup
+func (h *Handler) CleanupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tasks := h.getCleanup().List()
+	counts := map[cleanup.State]int{}
+	for _, t := range tasks {
+		counts[t.State]++
+	}
+	h.jsonResponse(w, map[string]interface{}{
+		"tasks":   tasks,
+		"pending": counts[cleanup.StatePending] + counts[cleanup.StateRunning] + counts[cleanup.StateRetrying],
+		"failed":  counts[cleanup.StateFailed],
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindClone replicates a PVC, spec and data, into another namespace.
+const jobKindClone = "clone"
+
+type cloneParams struct {
+	k8s.CloneRequest
+	Estimated int64 `json:"estimatedBytes"`
+}
+
+func (h *Handler) runCloneJob(ctx context.Context, jh *jobs.Handle) error {
+	var p cloneParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+	result, err := client.ClonePVC(ctx, p.CloneRequest, func(n int64) { jh.SetProgress(n, p.Estimated) })
+	if err != nil {
+		return err
+	}
+	log.Printf("Cloned %s/%s to %s", p.Namespace, p.PVC, result.Target)
+	return jh.SetResult(result)
+}
+
+// CloneHandler queues a clone of a PVC into another namespace:
+// POST /api/clone {namespace, pvc, targetNamespace, targetName,
+// storageClass, onConflict}. The job's result names the claim created,
+// which differs from targetName when onConflict is "rename".
+func (h *Handler) CloneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req cloneParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	estimated, err := client.DiskUsage(r.Context(), req.Namespace, req.PVC, []string{"/"})
+	if err != nil {
+		log.Printf("Could not estimate clone size for %s/%s: %v", req.Namespace, req.PVC, err)
+		estimated = 0
+	}
+	req.Estimated = estimated
+
+	noteActivity(r, req.Namespace, req.PVC, "", "")
+	job, err := h.submitJob(r, jobKindClone, fmt.Sprintf("Clone %s/%s into namespace %s", req.Namespace, req.PVC, req.TargetNamespace), req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
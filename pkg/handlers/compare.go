@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+const (
+	// compareMaxEntries bounds the entries listed on each side; a larger
+	// tree is refused rather than compared in part.
+	compareMaxEntries = 100000
+	// compareMaxChecksums bounds the pairs of same-size files hashed; the
+	// rest are compared by size only and counted as unverified.
+	compareMaxChecksums = 2000
+	// compareChecksumConcurrency is how many files are hashed at once on
+	// each side. Every hash is an exec, drawn from the shared limit.
+	compareChecksumConcurrency = 4
+)
+
+// compareSide is one of the trees compared: a directory on a PVC, or on
+// the claim restored from one of its VolumeSnapshots.
+type compareSide struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+	Path      string `json:"path"`
+	// Snapshot, when set, compares the directory as it was in this
+	// snapshot of PVC's namespace instead; PVC is then filled in with
+	// the claim it was restored into.
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+type compareRequest struct {
+	Left  compareSide `json:"left"`
+	Right compareSide `json:"right"`
+	// Checksum also hashes files whose size is the same on both sides.
+	Checksum bool   `json:"checksum"`
+	Algo     string `json:"algo,omitempty"`
+}
+
+// compareEntry is a path below the compared directories that is only on
+// one side, or differs between them.
+type compareEntry struct {
+	Path      string `json:"path"`
+	IsDir     bool   `json:"isDir"`
+	LeftSize  int64  `json:"leftSize,omitempty"`
+	RightSize int64  `json:"rightSize,omitempty"`
+	// Reason says how a changed entry differs: "type", "size" or
+	// "checksum".
+	Reason string `json:"reason,omitempty"`
+}
+
+// compareResult lists what is on the right and not the left (added), on
+// the left and not the right (removed), and on both but different
+// (changed), each sorted by path.
+type compareResult struct {
+	Left      compareSide    `json:"left"`
+	Right     compareSide    `json:"right"`
+	Added     []compareEntry `json:"added"`
+	Removed   []compareEntry `json:"removed"`
+	Changed   []compareEntry `json:"changed"`
+	Unchanged int            `json:"unchanged"`
+	// Checksummed counts the pairs of files hashed; Unverified those of
+	// the same size left unhashed past compareMaxChecksums.
+	Checksummed int    `json:"checksummed,omitempty"`
+	Unverified  int    `json:"unverified,omitempty"`
+	Algorithm   string `json:"algorithm,omitempty"`
+}
+
+// CompareHandler compares two directory trees, on the same PVC, on two
+// PVCs, or on a PVC and one of its snapshots:
+//
+//	POST /api/compare {"left": {namespace, pvc, path, snapshot}, "right": {...}, "checksum": true, "algo": "sha256"}
+//
+// Entries are matched by their path below each directory and compared by
+// type and size, and with checksum also by digest when the sizes agree.
+// Each tree is listed with one recursive search; a snapshot side is
+// restored for browsing first (see SnapshotsHandler) and left for the
+// snapshot picker to release, or released when it expires. It only reads,
+// so it is allowed in read-only mode. It takes ?pane=<id>.
+func (h *Handler) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	var req compareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, side := range []*compareSide{&req.Left, &req.Right} {
+		if side.Namespace == "" || (side.PVC == "" && side.Snapshot == "") {
+			h.jsonError(w, "left and right each need a namespace and a pvc or snapshot", http.StatusBadRequest)
+			return
+		}
+		if side.Snapshot != "" && h.minimal {
+			h.jsonError(w, "minimal mode: browsing snapshots needs helper pods", http.StatusMethodNotAllowed)
+			return
+		}
+		side.Path = sanitizePath(side.Path)
+	}
+	if req.Algo == "" {
+		req.Algo = "sha256"
+	}
+	if _, err := k8s.NewHash(req.Algo); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, side := range []*compareSide{&req.Left, &req.Right} {
+		if side.Snapshot == "" {
+			continue
+		}
+		claim, err := client.BrowseSnapshot(r.Context(), side.Namespace, side.Snapshot)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.releaseSnapshotAt(client, claim)
+		side.PVC = claim.PVC
+	}
+
+	// Listing two large trees, and hashing their files, outlasts the
+	// server's WriteTimeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	res, err := compareTrees(r.Context(), client, req)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, res)
+}
+
+func compareTrees(ctx context.Context, client KubeClient, req compareRequest) (*compareResult, error) {
+	var left, right map[string]k8s.FileInfo
+	var leftErr, rightErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); left, leftErr = listTree(ctx, client, &req.Left) }()
+	go func() { defer wg.Done(); right, rightErr = listTree(ctx, client, &req.Right) }()
+	wg.Wait()
+	if leftErr != nil {
+		return nil, leftErr
+	}
+	if rightErr != nil {
+		return nil, rightErr
+	}
+
+	res := &compareResult{Left: req.Left, Right: req.Right, Added: []compareEntry{}, Removed: []compareEntry{}, Changed: []compareEntry{}}
+	var sameSize []string
+	for rel, l := range left {
+		r, ok := right[rel]
+		switch {
+		case !ok:
+			res.Removed = append(res.Removed, compareEntry{Path: rel, IsDir: l.IsDir, LeftSize: fileSize(l)})
+		case l.IsDir != r.IsDir || l.Symlink != r.Symlink:
+			res.Changed = append(res.Changed, compareEntry{Path: rel, LeftSize: fileSize(l), RightSize: fileSize(r), Reason: "type"})
+		case l.IsDir:
+			res.Unchanged++
+		case fileSize(l) != fileSize(r):
+			res.Changed = append(res.Changed, compareEntry{Path: rel, LeftSize: fileSize(l), RightSize: fileSize(r), Reason: "size"})
+		case req.Checksum && !l.Symlink:
+			sameSize = append(sameSize, rel)
+		default:
+			res.Unchanged++
+		}
+	}
+	for rel, r := range right {
+		if _, ok := left[rel]; !ok {
+			res.Added = append(res.Added, compareEntry{Path: rel, IsDir: r.IsDir, RightSize: fileSize(r)})
+		}
+	}
+
+	if req.Checksum {
+		res.Algorithm = req.Algo
+		sort.Strings(sameSize)
+		if len(sameSize) > compareMaxChecksums {
+			res.Unverified = len(sameSize) - compareMaxChecksums
+			res.Unchanged += res.Unverified
+			sameSize = sameSize[:compareMaxChecksums]
+		}
+		differ, err := compareChecksums(ctx, client, req, sameSize)
+		if err != nil {
+			return nil, err
+		}
+		res.Checksummed = len(sameSize)
+		for _, rel := range sameSize {
+			if differ[rel] {
+				res.Changed = append(res.Changed, compareEntry{Path: rel, LeftSize: fileSize(left[rel]), RightSize: fileSize(right[rel]), Reason: "checksum"})
+			} else {
+				res.Unchanged++
+			}
+		}
+	}
+
+	for _, entries := range [][]compareEntry{res.Added, res.Removed, res.Changed} {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	}
+	return res, nil
+}
+
+// listTree lists everything below side's directory, keyed by the path
+// below it. A snapshot side's PVC is the claim it was restored into.
+func listTree(ctx context.Context, client KubeClient, side *compareSide) (map[string]k8s.FileInfo, error) {
+	result, err := client.SearchFiles(ctx, side.Namespace, side.PVC, k8s.SearchQuery{Path: side.Path, Limit: compareMaxEntries})
+	if err != nil {
+		return nil, err
+	}
+	if result.Truncated {
+		return nil, fmt.Errorf("%s/%s:%s has more than %d entries; compare smaller directories", side.Namespace, side.PVC, side.Path, compareMaxEntries)
+	}
+	root := gopath.Clean("/" + side.Path)
+	tree := make(map[string]k8s.FileInfo, len(result.Files))
+	for _, f := range result.Files {
+		rel := strings.TrimPrefix(strings.TrimPrefix(gopath.Clean("/"+f.Path), root), "/")
+		if rel != "" {
+			tree[rel] = f
+		}
+	}
+	return tree, nil
+}
+
+// compareChecksums hashes each of rels on both sides and reports those
+// whose digests differ.
+func compareChecksums(ctx context.Context, client KubeClient, req compareRequest, rels []string) (map[string]bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var firstErr error
+	differ := map[string]bool{}
+	sem := make(chan struct{}, compareChecksumConcurrency)
+	var wg sync.WaitGroup
+	for _, rel := range rels {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			l, err := client.FileChecksum(ctx, req.Left.Namespace, req.Left.PVC, gopath.Join(req.Left.Path, rel), req.Algo)
+			var r *k8s.FileChecksum
+			if err == nil {
+				r, err = client.FileChecksum(ctx, req.Right.Namespace, req.Right.PVC, gopath.Join(req.Right.Path, rel), req.Algo)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			if l.Checksum != r.Checksum {
+				differ[rel] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return differ, ctx.Err()
+}
+
+// fileSize is the size of f in bytes, 0 for a directory or an unknown
+// size.
+func fileSize(f k8s.FileInfo) int64 {
+	if f.IsDir {
+		return 0
+	}
+	n, _ := strconv.ParseInt(f.Size, 10, 64)
+	return n
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CompletePathHandler returns the entries matching a partially typed remote
+// path, for address-bar style navigation with Tab completion.
+func (h *Handler) CompletePathHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pvc := r.URL.Query().Get("pvc")
+	prefix := r.URL.Query().Get("prefix")
+
+	if namespace == "" || pvc == "" {
+		h.jsonError(w, "namespace and pvc parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	// sanitizePath drops the trailing slash that distinguishes "/logs/"
+	// (complete inside logs) from "/logs" (complete names starting with
+	// logs), so it is re-added after cleaning.
+	trailing := strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, "\\")
+	prefix = sanitizePath(prefix)
+	if trailing && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	completion, err := client.CompletePath(r.Context(), namespace, pvc, prefix)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, completion)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"kube-browser/pkg/store"
+)
+
+// PortableStateFiles are the state files that describe how KubeBrowser is
+// set up, and move with an exported configuration. Job records stay
+// behind: they describe work done on this machine.
+func PortableStateFiles() []string {
+	return []string{savedSearchesFile}
+}
+
+// configBundleMaxBytes bounds an imported configuration.
+const configBundleMaxBytes = 8 << 20
+
+// ConfigExportHandler downloads the configuration as a single JSON file:
+//
+//	GET /api/config/export
+//
+// It holds the portable state files (saved searches); the UI adds its own
+// preferences under "browser" before saving it.
+func (h *Handler) ConfigExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bundle, err := store.Export(PortableStateFiles()...)
+	if err != nil {
+		h.jsonError(w, "Failed to export configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="kube-browser-config.json"`)
+	h.jsonResponse(w, bundle)
+}
+
+// ConfigImportHandler loads a file made by ConfigExportHandler or
+// "kube-browser config export":
+//
+//	POST /api/config/import[?replace=true]
+//
+// Saved searches are merged with the existing ones by id, or replace them
+// with replace=true. The response lists the files imported and returns the
+// bundle's browser preferences for the UI to apply. Like saved searches,
+// it works in read-only mode, since nothing is written to the cluster.
+func (h *Handler) ConfigImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+	var bundle store.Bundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, configBundleMaxBytes)).Decode(&bundle); err != nil {
+		h.jsonError(w, "Invalid configuration file", http.StatusBadRequest)
+		return
+	}
+	imported, err := store.Import(&bundle, replace, PortableStateFiles()...)
+	if len(imported) > 0 {
+		// Reload what was cached from the old files on next use.
+		h.mu.Lock()
+		h.savedSearches = nil
+		h.mu.Unlock()
+	}
+	if err != nil {
+		h.jsonError(w, "Failed to import configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if imported == nil {
+		imported = []string{}
+	}
+	h.jsonResponse(w, map[string]interface{}{
+		"imported": imported,
+		"browser":  bundle.Browser,
+	})
+}
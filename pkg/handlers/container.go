@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"kube-browser/pkg/k8s"
+)
+
+func (h *Handler) ListPodsHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		h.jsonError(w, "namespace parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	pods, err := client.ListPods(r.Context(), namespace)
+	if err != nil {
+		h.jsonError(w, fmt.Sprintf("Failed to list pods: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"pods": pods,
+	})
+}
+
+// ListContainerFilesHandler browses a container's own filesystem from "/",
+// which is where ephemeral-storage usage (logs, caches, temp files written
+// outside any volume) accumulates.
+func (h *Handler) ListContainerFilesHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pod := r.URL.Query().Get("pod")
+	container := r.URL.Query().Get("container")
+	path := r.URL.Query().Get("path")
+
+	if namespace == "" || pod == "" {
+		h.jsonError(w, "namespace and pod parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	path = sanitizePath(path)
+
+	order, err := sortOptionsFromQuery(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := filterFromQuery(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(r, namespace+"/"+pod+"/"+container+":"+path, filter, order)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	listing, err := client.ListContainerFiles(r.Context(), namespace, pod, container, path)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	k8s.SortFiles(listing.Files, order)
+
+	resp := map[string]interface{}{
+		"path":      path,
+		"pod":       listing.Pod,
+		"container": listing.Container,
+		"scope":     listing.Scope,
+		"label":     fmt.Sprintf("Container filesystem of %s/%s (writable layer — counts toward ephemeral storage)", listing.Pod, listing.Container),
+		"mounts":    listing.Mounts,
+	}
+	if err := addFiles(resp, listing.Files, filter, order, page); err != nil {
+		h.jsonPageError(w, err)
+		return
+	}
+	h.jsonResponse(w, resp)
+}
+
+// ContainerFileHandler previews a file of a container's filesystem:
+// GET /api/container-file?namespace=&pod=&container=&path=[&reveal=true].
+// Files from Secret-backed volumes are refused with 403 unless reveal is
+// set, and every reveal is written to the log.
+func (h *Handler) ContainerFileHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	namespace, pod, container := q.Get("namespace"), q.Get("pod"), q.Get("container")
+	if namespace == "" || pod == "" || q.Get("path") == "" {
+		h.jsonError(w, "namespace, pod and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	path := sanitizePath(q.Get("path"))
+	reveal, err := queryBool(q.Get("reveal"), false)
+	if err != nil {
+		h.jsonError(w, "reveal: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := client.ReadContainerFile(r.Context(), namespace, pod, container, path, reveal)
+	if err != nil {
+		code := http.StatusInternalServerError
+		var ke *k8s.K8sError
+		if errors.As(err, &ke) && (ke.Kind == k8s.ErrKindSecretHidden || ke.Kind == k8s.ErrKindPermDenied) {
+			code = http.StatusForbidden
+		}
+		h.jsonErrorFromErr(w, err, code)
+		return
+	}
+	if file.Secret {
+		log.Printf("Audit: secret file %s (volume %s) of %s/%s revealed to %s", path, file.Volume, namespace, pod, r.RemoteAddr)
+	}
+	h.jsonResponse(w, file)
+}
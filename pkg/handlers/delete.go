@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// DeleteHandler removes a file or a directory from a PVC:
+//
+//	POST /api/delete {namespace, pvc, path, isDir, recursive}
+//
+// A directory is only removed when isDir is set, and only if it is empty
+// unless recursive is set too, so a stale listing cannot turn a file
+// delete into a tree delete. The root of a PVC is never deleted.
+//
+// With KUBE_BROWSER_TRASH set the entry is moved into the PVC's trash
+// instead, and its trash id answered as "trashed"; permanent skips the
+// trash, as does deleting inside it (see moveToTrash).
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Namespace string `json:"namespace"`
+		PVC       string `json:"pvc"`
+		Path      string `json:"path"`
+		IsDir     bool   `json:"isDir"`
+		Recursive bool   `json:"recursive"`
+		Permanent bool   `json:"permanent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || req.Path == "" {
+		h.jsonError(w, "namespace, pvc and path are required", http.StatusBadRequest)
+		return
+	}
+	p := sanitizePath(req.Path)
+	noteActivity(r, req.Namespace, req.PVC, p, "")
+	if p == "/" {
+		h.jsonError(w, "cannot delete the root of a PVC; select the entries inside it", http.StatusBadRequest)
+		return
+	}
+
+	if trashEnabled() && !req.Permanent && !inTrash(p) {
+		entry, err := moveToTrash(r.Context(), client, req.Namespace, req.PVC, p, req.IsDir, req.Recursive, requestUser(r))
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		resp := map[string]interface{}{"deleted": p}
+		if entry != nil {
+			log.Printf("Moved %s of %s/%s to the trash as %s (client %s)", p, req.Namespace, req.PVC, entry.ID, r.RemoteAddr)
+			resp["trashed"] = entry.ID
+			purgeTrashLater(client, req.Namespace, req.PVC)
+		}
+		h.jsonResponse(w, resp)
+		return
+	}
+
+	var err error
+	if req.IsDir {
+		err = client.DeleteDirectory(r.Context(), req.Namespace, req.PVC, p, req.Recursive)
+	} else {
+		err = client.DeleteFile(r.Context(), req.Namespace, req.PVC, p)
+	}
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Deleted %s from %s/%s (client %s)", p, req.Namespace, req.PVC, r.RemoteAddr)
+	h.jsonResponse(w, map[string]interface{}{"deleted": p})
+}
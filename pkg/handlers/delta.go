@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// deltaDownloader is implemented by clients that can describe a file block
+// by block and read some of its blocks, which is all a delta download
+// needs from the pod (see k8s.MatchBlocks).
+type deltaDownloader interface {
+	FileSignature(ctx context.Context, namespace, pvcName, filePath string, blockSize int64) (*k8s.BlockSignature, error)
+	ReadFileBlocks(ctx context.Context, namespace, pvcName, filePath string, blockSize, first, count int64, w io.Writer) error
+}
+
+// errDeltaStale is the error of a delta download whose file changed
+// between its signature and the reading of its blocks.
+var errDeltaStale = errors.New("the file changed during the delta download")
+
+// deltaBlockSize is the block size of a delta download against a local
+// copy of size bytes: 1 MiB, doubled until the signature has at most 8192
+// blocks. Smaller blocks find more of an edited file but cost the pod a
+// dd per block.
+func deltaBlockSize(size int64) int64 {
+	bs := int64(1 << 20)
+	for size/bs > 8192 {
+		bs *= 2
+	}
+	return bs
+}
+
+// deltaResult is a finished delta download: stats for the response, the
+// file's size, and its modification time in the pod when known.
+type deltaResult struct {
+	stats   map[string]interface{}
+	size    int64
+	modTime time.Time
+}
+
+// deltaDownload writes a file of the PVC to tmp, copying from old, the
+// local copy it replaces, every block found there and reading only the
+// others from the pod. Its stats say how much of the file each side gave.
+func deltaDownload(ctx context.Context, client deltaDownloader, namespace, pvc, filePath string, old *os.File, tmp io.Writer) (*deltaResult, error) {
+	info, err := old.Stat()
+	if err != nil {
+		return nil, err
+	}
+	bs := deltaBlockSize(info.Size())
+	sig, err := client.FileSignature(ctx, namespace, pvc, filePath, bs)
+	if err != nil {
+		return nil, err
+	}
+	found, err := k8s.MatchBlocks(old, info.Size(), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	var reused, fetched int64
+	for i := 0; i < len(sig.Blocks); {
+		if found[i] >= 0 {
+			n, err := io.Copy(tmp, io.NewSectionReader(old, found[i], bs))
+			if err != nil {
+				return nil, err
+			}
+			reused += n
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(sig.Blocks) && found[j] < 0 {
+			j++
+		}
+		vw := &blockVerifier{w: tmp, sig: sig, block: i, h: md5.New()}
+		err := client.ReadFileBlocks(ctx, namespace, pvc, filePath, bs, int64(i), int64(j-i), vw)
+		if vw.stale || err == nil && (vw.block != j || vw.n != 0) {
+			return nil, errDeltaStale
+		}
+		if err != nil {
+			return nil, err
+		}
+		fetched += vw.total
+		i = j
+	}
+	return &deltaResult{
+		stats: map[string]interface{}{
+			"blockSize":        bs,
+			"blocks":           len(sig.Blocks),
+			"reusedBytes":      reused,
+			"transferredBytes": fetched,
+		},
+		size:    reused + fetched,
+		modTime: sig.ModTime,
+	}, nil
+}
+
+// blockVerifier passes blocks read from the pod on to w, checking each one
+// against the MD5 of the signature. stale is set once one does not match,
+// however the client reports the failed write.
+type blockVerifier struct {
+	w     io.Writer
+	sig   *k8s.BlockSignature
+	block int
+	h     hash.Hash
+	n     int64 // bytes of the current block so far
+	total int64
+	stale bool
+}
+
+func (v *blockVerifier) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if v.block >= len(v.sig.Blocks) {
+			v.stale = true
+			return written, errDeltaStale
+		}
+		chunk := p[:min(int64(len(p)), v.sig.BlockLen(v.block)-v.n)]
+		n, err := v.w.Write(chunk)
+		v.h.Write(chunk[:n])
+		v.n += int64(n)
+		v.total += int64(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if v.n == v.sig.BlockLen(v.block) {
+			if hex.EncodeToString(v.h.Sum(nil)) != v.sig.Blocks[v.block].Strong {
+				v.stale = true
+				return written, errDeltaStale
+			}
+			v.h.Reset()
+			v.block, v.n = v.block+1, 0
+		}
+	}
+	return written, nil
+}
+
+// deltaSave is DownloadToLocalHandler's delta mode: target is the file
+// being replaced. It returns nil, leaving tmp untouched, when the client
+// cannot do delta downloads or target is empty or unreadable; when the
+// file changed under the download, tmp is emptied for a full download.
+func deltaSave(ctx context.Context, client KubeClient, namespace, pvc, filePath, target string, tmp *os.File) (*deltaResult, error) {
+	dd, ok := client.(deltaDownloader)
+	if !ok {
+		return nil, nil
+	}
+	old, err := os.Open(target)
+	if err != nil {
+		return nil, nil
+	}
+	defer old.Close()
+	if info, err := old.Stat(); err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return nil, nil
+	}
+	res, err := deltaDownload(ctx, dd, namespace, pvc, filePath, old, tmp)
+	if errors.Is(err, errDeltaStale) {
+		if err := tmp.Truncate(0); err != nil {
+			return nil, err
+		}
+		_, err := tmp.Seek(0, io.SeekStart)
+		return nil, err
+	}
+	return res, err
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// DownloadDirHandler streams a directory as a .tar.gz straight from tar in
+// the pod, like kubectl cp. Unlike /api/download-archive nothing is spooled,
+// so the download starts at once but has no Content-Length and cannot be
+// resumed. Repeated exclude parameters leave out matching entries.
+func (h *Handler) DownloadDirHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pvc := r.URL.Query().Get("pvc")
+	dirPath := r.URL.Query().Get("path")
+	if namespace == "" || pvc == "" || dirPath == "" {
+		h.jsonError(w, "namespace, pvc, and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	dirPath = sanitizePath(dirPath)
+	exclude, err := k8s.CleanExcludes(r.URL.Query()["exclude"])
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// tar still writes a (nearly empty) archive for a missing path, so
+	// check the path up front rather than by the first bytes.
+	info, err := client.ResolvePath(r.Context(), namespace, pvc, dirPath)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !info.Exists {
+		h.jsonErrorFromErr(w, &k8s.K8sError{Kind: k8s.ErrKindPathNotFound, Message: dirPath + " does not exist."}, http.StatusNotFound)
+		return
+	}
+	if !info.IsDir {
+		h.jsonError(w, dirPath+" is not a directory; use /api/download", http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(client.StreamArchive(r.Context(), namespace, pvc, []string{dirPath}, exclude, pw))
+	}()
+
+	br := bufio.NewReaderSize(pr, downloadBufferSize)
+	if _, err := br.Peek(1); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Disposition", attachmentDisposition(archiveName(pvc, []string{dirPath})))
+	w.Header().Set("Content-Type", "application/gzip")
+	n, err := br.WriteTo(w)
+	if err != nil {
+		log.Printf("Directory download of %s/%s:%s interrupted: %v", namespace, pvc, dirPath, err)
+		panic(http.ErrAbortHandler)
+	}
+	h.throughput.record(client, n, time.Since(start))
+}
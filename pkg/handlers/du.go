@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"kube-browser/pkg/k8s"
+)
+
+// DiskUsageHandler measures directories of a PVC with du:
+//
+//	GET /api/du?namespace=&pvc=&path=<dir>[&path=...][&maxDepth=1][&stream=true]
+//
+// It answers with the "directories" below each path, up to maxDepth levels
+// down (default 1; 0 for every level), each with "path" and "bytes", and
+// the "bytes" of the paths together. With ?stream=true, or an Accept of
+// application/x-ndjson, each directory is sent as a line as soon as du
+// finishes it, deepest first, then a last line with "done", "count" and
+// "bytes", like a streamed listing.
+func (h *Handler) DiskUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	namespace, pvc := q.Get("namespace"), q.Get("pvc")
+	if namespace == "" || pvc == "" || len(q["path"]) == 0 {
+		h.jsonError(w, "namespace, pvc and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	paths := make([]string, len(q["path"]))
+	for i, p := range q["path"] {
+		paths[i] = sanitizePath(p)
+	}
+	maxDepth := 1
+	if s := q.Get("maxDepth"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			h.jsonError(w, "maxDepth must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		maxDepth = n
+	}
+
+	if wantsStreamedListing(r) {
+		stream := h.newNDJSONStream(w, r)
+		total, err := client.StreamDiskUsage(r.Context(), namespace, pvc, paths, maxDepth, func(u k8s.DirUsage) error {
+			return stream.send(u)
+		})
+		if err != nil {
+			stream.fail(err)
+			return
+		}
+		stream.end(map[string]interface{}{"done": true, "count": stream.count, "bytes": total})
+		return
+	}
+
+	dirs := []k8s.DirUsage{}
+	total, err := client.StreamDiskUsage(r.Context(), namespace, pvc, paths, maxDepth, func(u k8s.DirUsage) error {
+		dirs = append(dirs, u)
+		return nil
+	})
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, map[string]interface{}{"directories": dirs, "bytes": total})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// assumedThroughput is used for estimates until a transfer on the
+	// connection has been measured: a conservative rate for exec streams
+	// through the API server.
+	assumedThroughput = 20 << 20
+	// minThroughputSample is the smallest transfer worth measuring; small
+	// ones are dominated by exec setup rather than bandwidth.
+	minThroughputSample = 1 << 20
+	// jobModeThreshold is the predicted duration above which estimates
+	// suggest an in-cluster Job instead of streaming through KubeBrowser.
+	jobModeThreshold = time.Hour
+)
+
+// throughput keeps a moving average of the transfer rate measured on each
+// connection, so estimates reflect what the exec path actually delivers
+// rather than a nominal figure.
+type throughput struct {
+	mu    sync.Mutex
+	rates map[string]*measuredRate
+}
+
+type measuredRate struct {
+	bytesPerSec float64
+	samples     int
+}
+
+func throughputKey(c KubeClient) string {
+	_, name := c.Connection()
+	return connectionType(c) + ":" + name
+}
+
+// record adds a finished transfer of n bytes that took d.
+func (t *throughput) record(c KubeClient, n int64, d time.Duration) {
+	if c == nil || n < minThroughputSample || d <= 0 {
+		return
+	}
+	rate := float64(n) / d.Seconds()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rates == nil {
+		t.rates = make(map[string]*measuredRate)
+	}
+	key := throughputKey(c)
+	m, ok := t.rates[key]
+	if !ok {
+		t.rates[key] = &measuredRate{bytesPerSec: rate, samples: 1}
+		return
+	}
+	// Recent transfers weigh more: the cluster's load and the path to it
+	// change over a session.
+	m.bytesPerSec = 0.7*m.bytesPerSec + 0.3*rate
+	m.samples++
+}
+
+// rate returns the measured rate for c and the number of transfers it is
+// based on, or assumedThroughput and 0.
+func (t *throughput) rate(c KubeClient) (float64, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m, ok := t.rates[throughputKey(c)]; ok {
+		return m.bytesPerSec, m.samples
+	}
+	return assumedThroughput, 0
+}
+
+type transferEstimate struct {
+	Bytes            int64   `json:"bytes"`
+	Files            int     `json:"files"`
+	BytesPerSecond   int64   `json:"bytesPerSecond"`
+	Samples          int     `json:"samples"`
+	Measured         bool    `json:"measured"`
+	EstimatedSeconds float64 `json:"estimatedSeconds"`
+	// Recommendation is "exec" or, for transfers that would stream for
+	// longer than jobModeThreshold on a cluster, "job".
+	Recommendation string `json:"recommendation"`
+	Note           string `json:"note,omitempty"`
+}
+
+// EstimateHandler reports what a copy or download of paths would cost
+// without running it:
+//
+//	POST /api/estimate {namespace, pvc, paths}
+//
+// The size and file count come from a single du/find exec, and the
+// duration from the throughput measured on earlier transfers over the same
+// connection.
+func (h *Handler) EstimateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Namespace string   `json:"namespace"`
+		PVC       string   `json:"pvc"`
+		Paths     []string `json:"paths"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || len(req.Paths) == 0 {
+		h.jsonError(w, "namespace, pvc and paths are required", http.StatusBadRequest)
+		return
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = sanitizePath(p)
+	}
+
+	usage, err := client.MeasurePaths(r.Context(), req.Namespace, req.PVC, req.Paths)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	rate, samples := h.throughput.rate(client)
+	est := transferEstimate{
+		Bytes:            usage.Bytes,
+		Files:            usage.Files,
+		BytesPerSecond:   int64(rate),
+		Samples:          samples,
+		Measured:         samples > 0,
+		EstimatedSeconds: math.Ceil(float64(usage.Bytes) / rate),
+		Recommendation:   "exec",
+	}
+	duration := time.Duration(est.EstimatedSeconds) * time.Second
+	if connectionType(client) == "kubernetes" && duration > jobModeThreshold {
+		est.Recommendation = "job"
+		est.Note = fmt.Sprintf("Streaming this through exec would take about %s. A migration or clone copies inside the cluster as a Job instead, without passing the data through KubeBrowser.", duration.Round(time.Minute))
+	}
+	h.jsonResponse(w, est)
+}
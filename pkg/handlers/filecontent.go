@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"unicode/utf8"
+)
+
+// editorMaxBytes is the largest file the inline editor opens or saves.
+const editorMaxBytes = 1 << 20
+
+// contentETag identifies a version of a file's contents.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// editableText reports whether data can be edited as text: valid UTF-8
+// without NUL bytes.
+func editableText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// FileContentHandler reads and writes small text files for the inline
+// editor:
+//
+//	GET /api/file/content?namespace=&pvc=&path=
+//	PUT /api/file/content?namespace=&pvc=&path=   (body: the new text)
+//
+// GET returns the raw text with an ETag; files over 1 MiB and binary files
+// are refused. PUT replaces the file atomically (a temporary file renamed
+// over it in the pod, keeping its mode) and answers with the new ETag.
+// With If-Match, the save is refused with 412 when the file has changed
+// since it was opened. Both take ?pane=<id>.
+func (h *Handler) FileContentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	namespace, pvc := q.Get("namespace"), q.Get("pvc")
+	if namespace == "" || pvc == "" || q.Get("path") == "" {
+		h.jsonError(w, "namespace, pvc and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	filePath := sanitizePath(q.Get("path"))
+	if filePath == "/" {
+		h.jsonError(w, "path must name a file", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && h.refuseTrashWrite(w, filePath) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		data, truncated, err := client.ReadFileHead(r.Context(), namespace, pvc, filePath, editorMaxBytes)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		if truncated {
+			h.jsonError(w, "File is larger than 1 MiB; download it instead", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !editableText(data) {
+			h.jsonError(w, "File is not text and cannot be edited", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("ETag", contentETag(data))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(data)
+		return
+	}
+
+	noteActivity(r, namespace, pvc, filePath, "Edit")
+	if h.checkReadOnly(w) {
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, editorMaxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.jsonError(w, "Text is larger than 1 MiB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !editableText(data) {
+		h.jsonError(w, "Text must be UTF-8 without NUL bytes", http.StatusBadRequest)
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" {
+		current, _, err := client.ReadFileHead(r.Context(), namespace, pvc, filePath, editorMaxBytes+1)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		if match != "*" && contentETag(current) != match {
+			h.jsonError(w, "The file has changed since it was opened; reload it before saving", http.StatusPreconditionFailed)
+			return
+		}
+	}
+	if err := client.SaveFile(r.Context(), namespace, pvc, filePath, data); err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	etag := contentETag(data)
+	w.Header().Set("ETag", etag)
+	h.jsonResponse(w, map[string]interface{}{
+		"path": filePath,
+		"size": len(data),
+		"etag": etag,
+	})
+}
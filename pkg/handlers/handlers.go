@@ -1,6 +1,7 @@
 package handlers
 
 import (
+        "bufio"
         "context"
         "embed"
         "encoding/json"
@@ -8,18 +9,23 @@ import (
         "fmt"
         "io"
         "log"
+        "mime"
         "net"
         "net/http"
         "os"
         "path"
         "path/filepath"
         "runtime"
+        "strconv"
         "strings"
         "sync"
         "text/template"
         "time"
 
+        "kube-browser/pkg/cleanup"
+        "kube-browser/pkg/jobs"
         "kube-browser/pkg/k8s"
+        "kube-browser/pkg/storage"
 )
 
 func sanitizePath(p string) string {
@@ -33,10 +39,50 @@ func sanitizePath(p string) string {
 
 type Handler struct {
         mu        sync.RWMutex
-        client    *k8s.Client
+        client    KubeClient
         static    embed.FS
         templates embed.FS
         readOnly  bool
+        minimal   bool
+        jobs      *jobs.Manager
+        cleanup   *cleanup.Worker
+        // backend, when set, replaces every connection (see UseBackend).
+        backend KubeClient
+        // panes are the connections opened next to client (see panes.go).
+        panes map[string]KubeClient
+        // throughput is measured on transfers for /api/estimate.
+        throughput throughput
+        // helperEvents collects helper pod startup events for the UI.
+        helperEvents *helperFeed
+        // pvcEvents reports claims KubeBrowser created as they get bound,
+        // and pvcNotifiers are told too (see pvcwatch.go).
+        pvcEvents    *pvcFeed
+        pvcNotifiers []PVCNotifier
+        // listOps are the listings started with /api/files?async=true.
+        listOps *listOperations
+        // operations are the cancelable requests running (see Cancelable).
+        operations *operations
+        // rawToken authorizes the /raw/ URLs (see raw.go).
+        rawToken string
+        // activity is the feed of operations served by /api/activity.
+        activity *activityFeed
+        // apiTokens authorize API requests without a browser (see tokens.go).
+        apiTokens *apiTokens
+        // requireToken makes /api/ requests from other hosts send a token.
+        requireToken bool
+        // listings caches recent directory listings (see listcache.go).
+        listings *listingCache
+        // authz maps SSO groups to roles, when configured (see authz.go).
+        authz *authzConfig
+        // quotas limit what each user may transfer, when configured, and
+        // quotaUsage is what they have transferred (see quotas.go).
+        quotas     *quotaConfig
+        quotaUsage *quotaUsage
+
+        savedSearches *savedSearches
+        // snapshotExpiry release claims restored from snapshots once they
+        // expire (see snapshots.go).
+        snapshotExpiry map[k8s.PVCRef]*time.Timer
 }
 
 func parseReadOnlyEnv() bool {
@@ -44,16 +90,45 @@ func parseReadOnlyEnv() bool {
         return v == "true" || v == "1"
 }
 
+func parseMinimalEnv() bool {
+        v := os.Getenv("KUBE_BROWSER_MINIMAL")
+        return v == "true" || v == "1"
+}
+
 func New(static, templates embed.FS) *Handler {
         ro := parseReadOnlyEnv()
         if ro {
                 log.Printf("Read-only mode enabled: upload endpoints will return 405")
         }
-        return &Handler{
-                static:    static,
-                templates: templates,
-                readOnly:  ro,
+        h := &Handler{
+                static:       static,
+                templates:    templates,
+                readOnly:     ro,
+                requireToken: parseRequireTokenEnv(),
+        }
+        if h.requireToken {
+                log.Printf("API tokens required: /api/ requests from other hosts must send one")
+        }
+        if parseMinimalEnv() {
+                h.EnableMinimalMode()
+        }
+        // Load persisted jobs now so work interrupted by the last shutdown
+        // is reported at startup rather than on the first jobs request.
+        h.getJobs()
+        h.getRawToken()
+        h.sweepUploadSpool()
+        return h
+}
+
+// EnableMinimalMode restricts the server to read-only exec listing and
+// downloads: helper pods are never created, background pod scans are
+// skipped, and every write endpoint is disabled.
+func (h *Handler) EnableMinimalMode() {
+        if !h.minimal {
+                log.Printf("Minimal mode enabled: helper pods, background cleanup and write operations are disabled")
         }
+        h.minimal = true
+        h.readOnly = true
 }
 
 func (h *Handler) checkReadOnly(w http.ResponseWriter) bool {
@@ -64,26 +139,45 @@ func (h *Handler) checkReadOnly(w http.ResponseWriter) bool {
         return false
 }
 
-func (h *Handler) getClient() *k8s.Client {
+// UseBackend serves every connection from c instead of a kubeconfig: the
+// connection dialog offers c's context only, and connecting installs c.
+func (h *Handler) UseBackend(c KubeClient) {
+        h.backend = c
+}
+
+// EnableDemoMode serves every connection from an in-memory cluster, so the
+// UI can be shown without any cluster.
+func (h *Handler) EnableDemoMode(demo *k8s.DemoCluster) {
+        log.Printf("Demo mode enabled: serving an in-memory cluster, no kubeconfig is used")
+        h.UseBackend(demo)
+}
+
+func (h *Handler) demoMode() bool {
+        _, ok := h.backend.(*k8s.DemoCluster)
+        return ok
+}
+
+func (h *Handler) getClient() KubeClient {
         h.mu.RLock()
         defer h.mu.RUnlock()
         return h.client
 }
 
-func (h *Handler) setClient(c *k8s.Client) {
+// setClient installs c, closing the connection it replaces if that holds
+// one open (an SFTP session, say) and was not installed by UseBackend.
+func (h *Handler) setClient(c KubeClient) {
         h.mu.Lock()
-        defer h.mu.Unlock()
+        old := h.client
         h.client = c
+        h.mu.Unlock()
+        if closer, ok := old.(io.Closer); ok && old != c && old != h.backend {
+                closer.Close()
+        }
 }
 
 func (h *Handler) LocalhostOnly(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-                ip, _, err := net.SplitHostPort(r.RemoteAddr)
-                if err != nil {
-                        http.Error(w, "Forbidden", http.StatusForbidden)
-                        return
-                }
-                if ip != "127.0.0.1" && ip != "::1" {
+                if !isLocalRequest(r) {
                         http.Error(w, "Forbidden: only accessible from localhost", http.StatusForbidden)
                         return
                 }
@@ -91,6 +185,11 @@ func (h *Handler) LocalhostOnly(next http.Handler) http.Handler {
         })
 }
 
+func isLocalRequest(r *http.Request) bool {
+        ip, _, err := net.SplitHostPort(r.RemoteAddr)
+        return err == nil && (ip == "127.0.0.1" || ip == "::1")
+}
+
 func (h *Handler) jsonResponse(w http.ResponseWriter, data interface{}) {
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(data)
@@ -148,11 +247,35 @@ func (h *Handler) StatusHandler(w http.ResponseWriter, r *http.Request) {
         resp := map[string]interface{}{
                 "connected": connected,
                 "readOnly":  h.readOnly,
+                "minimal":   h.minimal,
+                "demo":      h.demoMode(),
+        }
+        if a := accessStatus(r); a != nil {
+                resp["access"] = a
+        }
+        if trashEnabled() {
+                resp["trash"] = map[string]interface{}{"retentionDays": int64(trashRetention() / (24 * time.Hour))}
+        }
+        if q := h.quotaStatus(r); q != nil {
+                resp["quota"] = q
         }
         if connected {
-                resp["kubeconfigPath"] = client.KubeconfigPath
-                resp["context"] = client.ContextName
+                resp["kubeconfigPath"], resp["context"] = client.Connection()
+                resp["backend"] = connectionType(client)
+                resp["registryMirror"] = client.RegistryMirror()
+                if secrets, ok := client.(interface{ ImagePullSecrets() []string }); ok {
+                        resp["imagePullSecrets"] = secrets.ImagePullSecrets()
+                }
+                if scoped, ok := client.(interface{ Namespace() string }); ok && scoped.Namespace() != "" {
+                        resp["scope"] = scoped.Namespace()
+                }
                 resp["message"] = "Connected to Kubernetes cluster"
+                resp["credentials"] = client.CredentialStatus()
+                if health, ok := client.(interface{ APIHealth() k8s.APIHealth }); ok {
+                        resp["apiServer"] = health.APIHealth()
+                }
+                inUse, limit := client.ExecSessions()
+                resp["execSessions"] = map[string]int{"inUse": inUse, "limit": limit}
         } else {
                 resp["message"] = "Not connected"
                 resp["defaultKubeconfig"] = k8s.DefaultKubeconfigPath()
@@ -199,7 +322,7 @@ func (h *Handler) LoadKubeconfigUploadHandler(w http.ResponseWriter, r *http.Req
 
         info, err := k8s.ReadKubeconfig(tmpPath)
         if err != nil {
-                os.Remove(tmpPath)
+                h.removeLocalFile(tmpPath)
                 h.jsonError(w, "Invalid kubeconfig: "+err.Error(), http.StatusBadRequest)
                 return
         }
@@ -225,15 +348,33 @@ func (h *Handler) LoadKubeconfigHandler(w http.ResponseWriter, r *http.Request)
                 return
         }
 
+        if h.backend != nil {
+                _, name := h.backend.Connection()
+                h.jsonResponse(w, map[string]interface{}{
+                        "path":     req.Path,
+                        "contexts": []k8s.ContextInfo{{Name: name, Cluster: name}},
+                        "current":  name,
+                })
+                return
+        }
+
         if req.Path == "" {
                 req.Path = k8s.DefaultKubeconfigPath()
         }
 
         info, err := k8s.ReadKubeconfig(req.Path)
-        if err != nil {
+        if err != nil && !k8s.RunningInCluster() {
                 h.jsonError(w, fmt.Sprintf("Failed to load kubeconfig: %v", err), http.StatusBadRequest)
                 return
         }
+        if k8s.RunningInCluster() {
+                // Offer the pod's ServiceAccount alongside any kubeconfig
+                // contexts; it is the default when there is no kubeconfig.
+                if info == nil {
+                        info = &k8s.KubeconfigInfo{CurrentContext: k8s.InClusterContext}
+                }
+                info.Contexts = append(info.Contexts, k8s.ContextInfo{Name: k8s.InClusterContext})
+        }
 
         h.jsonResponse(w, map[string]interface{}{
                 "path":     req.Path,
@@ -249,35 +390,198 @@ func (h *Handler) ConnectHandler(w http.ResponseWriter, r *http.Request) {
         }
 
         var req struct {
-                KubeconfigPath string `json:"kubeconfigPath"`
-                Context        string `json:"context"`
+                clusterConfig
+                // Backend, when set, connects to a local directory, S3
+                // or SFTP instead of a cluster.
+                Backend *storage.Config `json:"backend"`
         }
         if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
                 h.jsonError(w, "Invalid request body", http.StatusBadRequest)
                 return
         }
-
-        client, err := k8s.NewClientWithContext(req.KubeconfigPath, req.Context)
-        if err != nil {
-                h.jsonError(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusBadRequest)
+        if err := k8s.ValidateRegistryMirror(req.RegistryMirror); err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if _, err := k8s.ParseImagePullSecrets(req.ImagePullSecrets); err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if h.backend != nil {
+                h.connectBackend(w, r)
+                return
+        }
+        if req.Backend != nil {
+                h.connectStorage(w, r, *req.Backend)
                 return
         }
 
-        namespaces, err := client.ListNamespaces(r.Context())
+        client, namespaces, code, err := h.openCluster(r.Context(), req.clusterConfig)
         if err != nil {
-                h.jsonError(w, fmt.Sprintf("Connected but failed to list namespaces: %v", err), http.StatusInternalServerError)
+                h.jsonError(w, err.Error(), code)
                 return
         }
 
         h.setClient(client)
 
-        cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
-        defer cleanupCancel()
-        client.CleanupOrphanedHelperPods(cleanupCtx)
+        message := "Connected successfully"
+        if namespaces.restricted {
+                message = "Connected, but your account cannot list namespaces: type the namespace to open"
+        }
+        h.jsonResponse(w, map[string]interface{}{
+                "connected":            true,
+                "context":              req.Context,
+                "namespaces":           namespaces.names,
+                "namespacesRestricted": namespaces.restricted,
+                "scope":                client.Namespace(),
+                "message":              message,
+        })
+}
 
+// clusterConfig names a cluster to connect to, as in the connection
+// dialog.
+type clusterConfig struct {
+        KubeconfigPath string `json:"kubeconfigPath"`
+        Context        string `json:"context"`
+        // RegistryMirror rewrites the helper image for this connection, see
+        // k8s.MirrorImage.
+        RegistryMirror string `json:"registryMirror"`
+        // ImagePullSecrets names the Secrets, comma-separated, helper pods
+        // pull their image with, see k8s.Client.SetImagePullSecrets.
+        ImagePullSecrets string `json:"imagePullSecrets"`
+        // Namespace scopes the connection to one namespace (see
+        // k8s.Client.SetNamespace); with ContextNamespace, the one the
+        // kubeconfig context sets.
+        Namespace        string `json:"namespace"`
+        ContextNamespace bool   `json:"contextNamespace"`
+}
+
+// namespaceList is what a connection's user may know of its namespaces.
+type namespaceList struct {
+        names []string
+        // restricted is set when RBAC forbids listing namespaces. names then
+        // holds at most the kubeconfig context's namespace, and the UI asks
+        // for the namespace to open.
+        restricted bool
+}
+
+// listNamespaces lists the namespaces of c. Working within a namespace does
+// not need the right to list them all, so a Forbidden answer is not an
+// error.
+func listNamespaces(ctx context.Context, c KubeClient) (namespaceList, error) {
+        names, err := c.ListNamespaces(ctx)
+        var ke *k8s.K8sError
+        if !errors.As(err, &ke) || ke.Kind != k8s.ErrKindRBAC {
+                return namespaceList{names: names}, err
+        }
+        list := namespaceList{names: []string{}, restricted: true}
+        kubeconfigPath, contextName := c.Connection()
+        if ns, err := k8s.ContextNamespace(kubeconfigPath, contextName); err == nil && ns != "" {
+                list.names = []string{ns}
+        }
+        log.Printf("Namespaces of %s cannot be listed (%v); they will be typed in", contextName, err)
+        return list, nil
+}
+
+// openCluster connects to the cluster cfg names, for the main connection or
+// a pane, and returns its namespaces. The status code goes with the error.
+func (h *Handler) openCluster(ctx context.Context, cfg clusterConfig) (*k8s.Client, namespaceList, int, error) {
+        if err := k8s.ValidateRegistryMirror(cfg.RegistryMirror); err != nil {
+                return nil, namespaceList{}, http.StatusBadRequest, err
+        }
+        if _, err := k8s.ParseImagePullSecrets(cfg.ImagePullSecrets); err != nil {
+                return nil, namespaceList{}, http.StatusBadRequest, err
+        }
+        var client *k8s.Client
+        var err error
+        if cfg.Context == k8s.InClusterContext && k8s.RunningInCluster() {
+                client, err = k8s.NewInClusterClient()
+        } else {
+                client, err = k8s.NewClientWithContext(cfg.KubeconfigPath, cfg.Context)
+        }
+        if err != nil {
+                return nil, namespaceList{}, http.StatusBadRequest, fmt.Errorf("Failed to connect: %v", err)
+        }
+
+        scope := cfg.Namespace
+        if scope == "" && cfg.ContextNamespace {
+                scope, err = k8s.ContextNamespace(cfg.KubeconfigPath, cfg.Context)
+                if err != nil {
+                        return nil, namespaceList{}, http.StatusBadRequest, err
+                }
+                if scope == "" {
+                        return nil, namespaceList{}, http.StatusBadRequest, fmt.Errorf("Context %q sets no namespace to scope the connection to", cfg.Context)
+                }
+        }
+        client.SetNamespace(scope)
+
+        namespaces, err := listNamespaces(ctx, client)
+        if err != nil {
+                return nil, namespaceList{}, http.StatusInternalServerError, fmt.Errorf("Connected but failed to list namespaces: %v", err)
+        }
+
+        if h.minimal {
+                client.DisableHelperPods()
+        }
+        client.SetRegistryMirror(cfg.RegistryMirror)
+        client.SetImagePullSecrets(cfg.ImagePullSecrets)
+        client.SetCleanupWorker(h.getCleanup())
+        client.SetHelperEvents(h.getHelperFeed().publish)
+        client.SetClaimCreated(h.claimWatcher(client))
+
+        if !h.minimal {
+                cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
+                defer cleanupCancel()
+                client.CleanupOrphanedHelperPods(cleanupCtx)
+        }
+        return client, namespaces, 0, nil
+}
+
+// openStorage opens a storage backend for r. Local directories are only
+// served to the KubeBrowser host itself, like /api/browse. The status code
+// goes with the error.
+func openStorage(r *http.Request, cfg storage.Config) (*storage.Backend, int, error) {
+        if cfg.Type == "local" && !isLocalRequest(r) {
+                return nil, http.StatusForbidden, errors.New("Local directories can only be opened from localhost")
+        }
+        ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+        defer cancel()
+        backend, err := storage.Open(ctx, cfg)
+        if err != nil {
+                return nil, http.StatusBadRequest, fmt.Errorf("Failed to connect: %v", err)
+        }
+        return backend, 0, nil
+}
+
+// connectStorage makes a storage backend the main connection.
+func (h *Handler) connectStorage(w http.ResponseWriter, r *http.Request, cfg storage.Config) {
+        backend, code, err := openStorage(r, cfg)
+        if err != nil {
+                h.jsonError(w, err.Error(), code)
+                return
+        }
+        namespaces, _ := backend.ListNamespaces(r.Context())
+        h.setClient(backend)
+        _, name := backend.Connection()
+        h.jsonResponse(w, map[string]interface{}{
+                "connected":  true,
+                "context":    name,
+                "namespaces": namespaces,
+                "message":    "Connected successfully",
+        })
+}
+
+func (h *Handler) connectBackend(w http.ResponseWriter, r *http.Request) {
+        namespaces, err := h.backend.ListNamespaces(r.Context())
+        if err != nil {
+                h.jsonError(w, fmt.Sprintf("Connected but failed to list namespaces: %v", err), http.StatusInternalServerError)
+                return
+        }
+        h.setClient(h.backend)
+        _, name := h.backend.Connection()
         h.jsonResponse(w, map[string]interface{}{
                 "connected":  true,
-                "context":    req.Context,
+                "context":    name,
                 "namespaces": namespaces,
                 "message":    "Connected successfully",
         })
@@ -298,25 +602,33 @@ func (h *Handler) DisconnectHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListNamespacesHandler(w http.ResponseWriter, r *http.Request) {
-        client := h.getClient()
+        client := h.clientFor(r)
         if client == nil {
                 h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
                 return
         }
 
-        namespaces, err := client.ListNamespaces(r.Context())
+        namespaces, err := listNamespaces(r.Context(), client)
         if err != nil {
                 h.jsonError(w, fmt.Sprintf("Failed to list namespaces: %v", err), http.StatusInternalServerError)
                 return
         }
 
+        if a, ok := requestAccess(r); ok {
+                namespaces.names = a.visibleNamespaces(namespaces.names)
+        }
+        if l, ok := requestQuota(r); ok {
+                namespaces.names = l.visibleNamespaces(namespaces.names)
+        }
+
         h.jsonResponse(w, map[string]interface{}{
-                "namespaces": namespaces,
+                "namespaces":           namespaces.names,
+                "namespacesRestricted": namespaces.restricted,
         })
 }
 
 func (h *Handler) ListPVCsHandler(w http.ResponseWriter, r *http.Request) {
-        client := h.getClient()
+        client := h.clientFor(r)
         if client == nil {
                 h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
                 return
@@ -340,7 +652,7 @@ func (h *Handler) ListPVCsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListFilesHandler(w http.ResponseWriter, r *http.Request) {
-        client := h.getClient()
+        client := h.clientFor(r)
         if client == nil {
                 h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
                 return
@@ -360,20 +672,66 @@ func (h *Handler) ListFilesHandler(w http.ResponseWriter, r *http.Request) {
         }
         path = sanitizePath(path)
 
-        files, err := client.ListFiles(r.Context(), namespace, pvc, path)
+        order, err := sortOptionsFromQuery(r)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        filter, err := filterFromQuery(r)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        export, err := exportFormatFromQuery(r)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if export != "" {
+                h.exportListing(w, r, client, namespace, pvc, path, export, order, filter)
+                return
+        }
+
+        df, _ := strconv.ParseBool(r.URL.Query().Get("df"))
+        if wantsStreamedListing(r) {
+                h.streamListing(w, r, client, namespace, pvc, path, order, filter, df)
+                return
+        }
+        page, err := pageFromQuery(r, namespace+"/"+pvc+":"+path, filter, order)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+                h.listFilesAsync(w, r, client, namespace, pvc, path, order, filter, page, df)
+                return
+        }
+
+        refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+        filesystem := h.startFilesystemUsage(r.Context(), client, namespace, pvc, df, refresh)
+        files, err := h.listFilesCached(r.Context(), client, namespace, pvc, path, refresh)
         if err != nil {
                 h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
                 return
         }
+        k8s.SortFiles(files, order)
 
-        h.jsonResponse(w, map[string]interface{}{
-                "files": files,
-                "path":  path,
-        })
+        resp := map[string]interface{}{
+                "path": path,
+        }
+        if err := addFiles(resp, files, filter, order, page); err != nil {
+                h.jsonPageError(w, err)
+                return
+        }
+        if usage := filesystem(); usage != nil {
+                resp["filesystem"] = usage
+        }
+        h.jsonResponse(w, resp)
 }
 
 func (h *Handler) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
-        client := h.getClient()
+        client := h.clientFor(r)
         if client == nil {
                 h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
                 return
@@ -389,16 +747,67 @@ func (h *Handler) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
         }
 
         filePath = sanitizePath(filePath)
+        compression, err := transferCompressionFromQuery(r)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
 
-        reader, fileName, err := client.DownloadFile(r.Context(), namespace, pvc, filePath)
+        start := time.Now()
+        reader, fileName, err := downloadFile(r.Context(), client, namespace, pvc, filePath, compression)
         if err != nil {
                 h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
                 return
         }
+        defer reader.Close()
+
+        // Errors such as a missing file only show up once the exec runs, so
+        // wait for the first bytes before committing to a 200.
+        br := bufio.NewReaderSize(reader, downloadBufferSize)
+        if _, err := br.Peek(1); err != nil && err != io.EOF {
+                h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+                return
+        }
 
-        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+        // The file streams at the browser's pace, so a large one outlives
+        // the server's WriteTimeout.
+        http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+        w.Header().Set("Content-Disposition", attachmentDisposition(fileName))
         w.Header().Set("Content-Type", "application/octet-stream")
-        io.Copy(w, reader)
+        setTransferCompression(w, reader)
+        if fh, ok := reader.(k8s.FileHeader); ok && fh.Header() != nil {
+                w.Header().Set("Content-Length", strconv.FormatInt(fh.Header().Size, 10))
+                w.Header().Set("Last-Modified", fh.Header().ModTime.UTC().Format(http.TimeFormat))
+        }
+        n, err := br.WriteTo(w)
+        if err != nil {
+                log.Printf("Download of %s/%s:%s interrupted: %v", namespace, pvc, filePath, err)
+                // Drop the connection so the browser reports a failed
+                // download rather than saving a truncated file.
+                panic(http.ErrAbortHandler)
+        }
+        h.throughput.record(client, n, time.Since(start))
+}
+
+// downloadBufferSize is how much of a download is held between the exec
+// and the response writer.
+const downloadBufferSize = 64 << 10
+
+// attachmentDisposition builds a Content-Disposition header for a download.
+// Control characters (newlines, ANSI escapes) cannot appear in a header and
+// are replaced; non-ASCII names are encoded per RFC 2231.
+func attachmentDisposition(name string) string {
+        name = strings.Map(func(r rune) rune {
+                if r < 0x20 || r == 0x7f {
+                        return '_'
+                }
+                return r
+        }, name)
+        if v := mime.FormatMediaType("attachment", map[string]string{"filename": name}); v != "" {
+                return v
+        }
+        return "attachment"
 }
 
 func maxUploadSize() int64 {
@@ -447,6 +856,17 @@ func (l *limitEnforcingReader) Read(p []byte) (int, error) {
 
 const maxMetaFieldSize = 4096
 
+// UploadFileHandler writes a multipart upload to the PVC. The form is read
+// part by part with r.MultipartReader rather than ParseMultipartForm, and
+// the file part is handed to the client as it arrives, so neither memory
+// nor temporary files grow with the upload. Only when namespace or pvc come
+// after the file is it spooled to disk first (see spoolUpload).
+// Several file parts named "files" upload several files at once: they are
+// spooled as they arrive and written concurrently (see uploadFiles).
+// onConflict says what happens to a file that already exists (see
+// planUploads), and verify=true queues a read-after-write check of what was
+// written (see queueVerify), and compress=gzip|zstd|none how the files
+// are sent on to the pod (see k8s.WithTransferCompression).
 func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
         if r.Method != http.MethodPost {
                 h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -457,12 +877,26 @@ func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        client := h.getClient()
+        client := h.clientFor(r)
         if client == nil {
                 h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
                 return
         }
 
+        // compress sends the files on to the pod compressed.
+        compression, err := transferCompressionFromQuery(r)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        r = r.WithContext(k8s.WithTransferCompression(r.Context(), compression))
+
+        // The body streams into the pod at the cluster's pace, so a large
+        // upload outlives both the server's ReadTimeout and WriteTimeout.
+        rc := http.NewResponseController(w)
+        rc.SetReadDeadline(time.Time{})
+        rc.SetWriteDeadline(time.Time{})
+
         mr, err := r.MultipartReader()
         if err != nil {
                 h.jsonError(w, "Failed to parse upload", http.StatusBadRequest)
@@ -471,6 +905,18 @@ func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 
         var namespace, pvc, destPath, fileName string
         var filePart io.Reader
+        var spooled *spooledUpload
+        var many []*uploadItem
+        extract, _ := strconv.ParseBool(r.URL.Query().Get("extract"))
+        // preserve=false drops mtime and the modes of extracted members.
+        preserve := r.URL.Query().Get("preserve") != "false"
+        onConflict := r.URL.Query().Get("onConflict")
+        // verify reads the uploaded files back from another node afterwards.
+        verify, _ := strconv.ParseBool(r.URL.Query().Get("verify"))
+        perms := k8s.DefaultUploadPermissions()
+        // size and mtime (milliseconds since the epoch, like a browser
+        // File's lastModified) must precede the file part.
+        size, mtime := int64(-1), int64(0)
 
         for {
                 part, partErr := mr.NextPart()
@@ -483,11 +929,58 @@ func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
                 }
 
                 fieldName := part.FormName()
+                if part.FileName() != "" && fieldName == "files" {
+                        // Several files: each is spooled, and they are
+                        // uploaded together once the form has been read.
+                        if spooled != nil {
+                                h.jsonError(w, "Send either one file part named file or several named files", http.StatusBadRequest)
+                                return
+                        }
+                        item, err := h.spoolUploadItem(part, size, mtime)
+                        if err != nil {
+                                if errors.Is(err, errSpoolDiskFull) {
+                                        h.jsonError(w, err.Error(), http.StatusInsufficientStorage)
+                                } else {
+                                        h.jsonError(w, "Failed to read upload", http.StatusBadRequest)
+                                }
+                                return
+                        }
+                        if item.spooled != nil {
+                                defer h.removeSpooledUpload(item.spooled)
+                        }
+                        many = append(many, item)
+                        size, mtime = -1, 0
+                        continue
+                }
                 if part.FileName() != "" {
+                        if spooled != nil || filePart != nil || len(many) > 0 {
+                                h.jsonError(w, "Only one file part named file can be uploaded per request; send several as parts named files", http.StatusBadRequest)
+                                return
+                        }
                         rawName := part.FileName()
                         fileName = path.Base(strings.ReplaceAll(rawName, "\\", "/"))
-                        filePart = part
-                        break
+                        if namespace != "" && pvc != "" {
+                                filePart = part
+                                break
+                        }
+                        // The fields the upload needs come after the file,
+                        // so it cannot be streamed: keep it on disk until
+                        // they have been read.
+                        var limited *limitEnforcingReader
+                        spooled, limited, err = h.spoolUpload(part, maxUploadSize())
+                        if err != nil {
+                                switch {
+                                case limited != nil && limited.exceeded:
+                                        h.jsonError(w, fmt.Sprintf("file too large: maximum upload size is %d bytes", maxUploadSize()), http.StatusRequestEntityTooLarge)
+                                case errors.Is(err, errSpoolDiskFull):
+                                        h.jsonError(w, err.Error(), http.StatusInsufficientStorage)
+                                default:
+                                        h.jsonError(w, "Failed to read upload", http.StatusBadRequest)
+                                }
+                                return
+                        }
+                        defer h.removeSpooledUpload(spooled)
+                        continue
                 }
 
                 limited := io.LimitReader(part, maxMetaFieldSize)
@@ -503,6 +996,28 @@ func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
                         pvc = string(b)
                 case "path":
                         destPath = string(b)
+                case "mode":
+                        perms.Mode = string(b)
+                case "owner":
+                        perms.Owner = string(b)
+                case "extract":
+                        extract, _ = strconv.ParseBool(string(b))
+                case "preserve":
+                        preserve = string(b) != "false"
+                case "onConflict":
+                        onConflict = string(b)
+                case "verify":
+                        verify, _ = strconv.ParseBool(string(b))
+                case "size":
+                        if size, err = strconv.ParseInt(string(b), 10, 64); err != nil || size < 0 {
+                                h.jsonError(w, "size must be a non-negative number of bytes", http.StatusBadRequest)
+                                return
+                        }
+                case "mtime":
+                        if mtime, err = strconv.ParseInt(string(b), 10, 64); err != nil {
+                                h.jsonError(w, "mtime must be milliseconds since the epoch", http.StatusBadRequest)
+                                return
+                        }
                 }
         }
 
@@ -510,22 +1025,124 @@ func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
                 h.jsonError(w, "namespace and pvc are required", http.StatusBadRequest)
                 return
         }
-        if filePart == nil {
+        if h.checkAccess(w, r, namespace) || h.checkQuotaNamespaces(w, r, namespace) {
+                return
+        }
+        if spooled != nil {
+                filePart, size = spooled.f, spooled.size
+        }
+        if filePart == nil && len(many) == 0 {
                 h.jsonError(w, "No file provided", http.StatusBadRequest)
                 return
         }
+        if err := perms.Validate(); err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        policy, err := parseUploadConflict(onConflict)
+        if err != nil {
+                h.jsonError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if extract && policy != uploadConflictOverwrite {
+                h.jsonError(w, "onConflict does not apply to extracted archives, which overwrite existing files", http.StatusBadRequest)
+                return
+        }
+        if verify && !h.canVerifyUpload(w, client, extract) {
+                return
+        }
+        if len(many) > 0 {
+                h.uploadFiles(w, r, client, namespace, pvc, sanitizePath(destPath), perms, extract, preserve, verify, policy, many)
+                return
+        }
+        if _, ok := uploadArchiveFormat(fileName); extract && !ok {
+                h.jsonError(w, "extract needs a .tar, .tar.gz, .tgz or .zip file", http.StatusBadRequest)
+                return
+        }
 
         maxSize := maxUploadSize()
+        if size > maxSize {
+                h.jsonError(w, fmt.Sprintf("file too large: maximum upload size is %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+                return
+        }
         limitedFile := &limitEnforcingReader{r: filePart, limit: maxSize}
+        var data io.Reader = limitedFile
+        hasher := newUploadHasher()
+        if verify {
+                data = hasher.wrap(limitedFile)
+        }
+        if size >= 0 {
+                // A declared size lets the client frame the upload, so a
+                // body that ends early fails instead of leaving a short file.
+                src := &k8s.UploadSource{Reader: data, Size: size}
+                if mtime > 0 && preserve {
+                        src.ModTime = time.UnixMilli(mtime)
+                }
+                data = src
+        }
 
         destPath = sanitizePath(destPath)
+        if h.refuseTrashWrite(w, destPath, path.Join(destPath, fileName)) {
+                return
+        }
+        if extract {
+                noteActivity(r, namespace, pvc, destPath, "Extract "+fileName)
+                start := time.Now()
+                files, err := h.extractUpload(r.Context(), client, namespace, pvc, destPath, fileName, limitedFile, spooled, preserve)
+                if limitedFile.exceeded {
+                        err = errUploadTooLarge
+                }
+                if err != nil {
+                        if code := extractStatus(err); code != http.StatusInternalServerError {
+                                h.jsonError(w, err.Error(), code)
+                        } else {
+                                h.jsonErrorFromErr(w, err, code)
+                        }
+                        return
+                }
+                h.throughput.record(client, limitedFile.read, time.Since(start))
+                h.jsonResponse(w, map[string]interface{}{
+                        "success":   true,
+                        "message":   fmt.Sprintf("Extracted %d files from %s into %s", files, fileName, destPath),
+                        "filename":  fileName,
+                        "extracted": files,
+                        "path":      destPath,
+                })
+                return
+        }
         if destPath == "" || destPath == "/" {
                 destPath = "/" + fileName
         } else {
                 destPath = destPath + "/" + fileName
         }
 
-        err = client.UploadFile(r.Context(), namespace, pvc, destPath, limitedFile)
+        noteActivity(r, namespace, pvc, destPath, "")
+        targets, err := planUploads(r.Context(), client, namespace, pvc, []string{destPath}, policy)
+        if err != nil {
+                h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+                return
+        }
+        target := targets[0]
+        if target.err != nil {
+                h.jsonError(w, target.err.Error(), http.StatusConflict)
+                return
+        }
+        if target.skip {
+                h.jsonResponse(w, map[string]interface{}{
+                        "success":  true,
+                        "skipped":  true,
+                        "message":  fmt.Sprintf("%s already exists; skipped", destPath),
+                        "filename": fileName,
+                        "path":     destPath,
+                })
+                return
+        }
+        if target.renamed {
+                destPath, fileName = target.path, path.Base(target.path)
+        }
+
+        start := time.Now()
+        err = client.UploadFile(r.Context(), namespace, pvc, destPath, data)
         if limitedFile.exceeded {
                 w.Header().Set("Content-Type", "application/json")
                 w.WriteHeader(http.StatusRequestEntityTooLarge)
@@ -536,12 +1153,37 @@ func (h *Handler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
                 h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
                 return
         }
+        h.throughput.record(client, limitedFile.read, time.Since(start))
 
-        h.jsonResponse(w, map[string]interface{}{
+        resp := map[string]interface{}{
                 "success":  true,
                 "message":  fmt.Sprintf("File %s uploaded successfully", fileName),
                 "filename": fileName,
-        })
+                "path":     destPath,
+        }
+        if target.renamed {
+                resp["renamed"] = true
+        }
+        h.applyUploadPermissions(r.Context(), client, namespace, pvc, destPath, perms, resp)
+        if verify {
+                h.queueVerify(r, namespace, pvc, []k8s.ReadBackFile{{Path: destPath, Expected: hasher.sum()}}, resp)
+        }
+        h.jsonResponse(w, resp)
+}
+
+// applyUploadPermissions sets the configured mode/owner on a freshly
+// uploaded file. The upload itself already succeeded, so a failure here is
+// reported as a warning rather than an error.
+func (h *Handler) applyUploadPermissions(ctx context.Context, client KubeClient, namespace, pvc, destPath string, perms k8s.FilePermissions, resp map[string]interface{}) {
+        applied, err := client.ApplyPermissions(ctx, namespace, pvc, destPath, perms, false)
+        if err != nil {
+                log.Printf("Uploaded %s but could not set permissions: %v", destPath, err)
+                resp["permissionsWarning"] = err.Error()
+                return
+        }
+        if applied != (k8s.FilePermissions{}) {
+                resp["permissions"] = applied
+        }
 }
 
 func (h *Handler) BrowseLocalHandler(w http.ResponseWriter, r *http.Request) {
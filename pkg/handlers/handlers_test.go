@@ -1,13 +1,29 @@
 package handlers
 
 import (
+        "archive/tar"
+        "archive/zip"
+        "bytes"
+        "compress/gzip"
+        "context"
         "embed"
         "encoding/json"
+        "errors"
+        "fmt"
+        "io"
+        "math/rand"
         "net/http"
+        "net/url"
         "net/http/httptest"
         "os"
+        "path/filepath"
         "strings"
+        "sync"
         "testing"
+        "time"
+
+        "kube-browser/pkg/jobs"
+        "kube-browser/pkg/k8s"
 )
 
 func TestSanitizePath(t *testing.T) {
@@ -148,6 +164,7 @@ func TestParseReadOnlyEnv(t *testing.T) {
                 {"random value disables read-only", "yes", false},
         }
 
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
         for _, tt := range tests {
                 t.Run(tt.name, func(t *testing.T) {
                         os.Setenv("KUBE_BROWSER_READ_ONLY", tt.envVal)
@@ -226,3 +243,3322 @@ func TestStatusHandlerReadOnlyFalseByDefault(t *testing.T) {
                 t.Errorf("expected readOnly=false, got %v", resp["readOnly"])
         }
 }
+
+func TestMinimalModeImpliesReadOnly(t *testing.T) {
+        h := &Handler{}
+        h.EnableMinimalMode()
+        if !h.readOnly {
+                t.Error("expected minimal mode to force read-only")
+        }
+
+        req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+        rr := httptest.NewRecorder()
+        h.StatusHandler(rr, req)
+
+        var resp map[string]interface{}
+        json.NewDecoder(rr.Body).Decode(&resp)
+        if resp["minimal"] != true || resp["readOnly"] != true {
+                t.Errorf("expected minimal=true and readOnly=true, got %v / %v", resp["minimal"], resp["readOnly"])
+        }
+}
+
+func TestParseMinimalEnv(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_MINIMAL", "1")
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        var fs1, fs2 embed.FS
+        h := New(fs1, fs2)
+        if !h.minimal || !h.readOnly {
+                t.Errorf("KUBE_BROWSER_MINIMAL=1: minimal=%v readOnly=%v, want both true", h.minimal, h.readOnly)
+        }
+}
+
+func TestUploadFromURLBlockedInReadOnlyMode(t *testing.T) {
+        h := &Handler{readOnly: true}
+
+        req := httptest.NewRequest(http.MethodPost, "/api/upload-url", strings.NewReader(`{"namespace":"default","pvc":"data","url":"https://example.com/a.bin"}`))
+        rr := httptest.NewRecorder()
+
+        h.UploadFromURLHandler(rr, req)
+
+        if rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected 405, got %d", rr.Code)
+        }
+}
+
+func TestURLFetchRefusesInternalAddresses(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secret")
+	}))
+	defer internal.Close()
+
+	t.Setenv(urlFetchAllowEnv, "")
+	allow, err := loadURLFetchAllowList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"169.254.169.254", "127.0.0.1", "10.0.0.5", "api.default.svc", "db.prod.svc.cluster.local"} {
+		if allow.checkFetchHost(host) == nil {
+			t.Errorf("expected %s to be refused", host)
+		}
+	}
+	if err := allow.checkFetchHost("example.com"); err != nil {
+		t.Errorf("expected a public host to be allowed, got %v", err)
+	}
+	// A name is only checked once resolved, when the connection is made.
+	if _, err := urlFetchClient(allow).Get(strings.Replace(internal.URL, "127.0.0.1", "localhost.", 1)); err == nil {
+		t.Error("expected the dial to a loopback address to be refused")
+	}
+
+	// A public server redirecting to an internal one is refused too.
+	via := []*http.Request{httptest.NewRequest(http.MethodGet, "http://example.com/", nil)}
+	if err := urlFetchClient(allow).CheckRedirect(httptest.NewRequest(http.MethodGet, internal.URL, nil), via); err == nil {
+		t.Error("expected a redirect to a loopback address to be refused")
+	}
+
+	t.Setenv(urlFetchAllowEnv, "127.0.0.0/8")
+	allow, err = loadURLFetchAllowList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := urlFetchClient(allow).Get(internal.URL)
+	if err != nil {
+		t.Fatalf("expected an allowed address to be fetched, got %v", err)
+	}
+	resp.Body.Close()
+
+	t.Setenv(urlFetchAllowEnv, "10.0.0.0/99")
+	if _, err := loadURLFetchAllowList(); err == nil {
+		t.Error("expected an invalid CIDR to be rejected")
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+        sha256Hex := strings.Repeat("ab", 32)
+        tests := []struct {
+                input   string
+                wantErr bool
+        }{
+                {"sha256:" + sha256Hex, false},
+                {"SHA256:" + strings.ToUpper(sha256Hex), false},
+                {sha256Hex, false},
+                {strings.Repeat("0", 32), false},
+                {"sha512:" + sha256Hex, true},
+                {"crc32:deadbeef", true},
+                {"sha256:" + strings.Repeat("zz", 32), true},
+                {"abc", true},
+        }
+
+        for _, tt := range tests {
+                _, digest, err := parseChecksum(tt.input)
+                if (err != nil) != tt.wantErr {
+                        t.Errorf("parseChecksum(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+                }
+                if err == nil && digest != strings.ToLower(digest) {
+                        t.Errorf("parseChecksum(%q) digest not normalized: %q", tt.input, digest)
+                }
+        }
+}
+
+func TestDownloadToLocalRequiresConnection(t *testing.T) {
+        h := &Handler{}
+
+        req := httptest.NewRequest(http.MethodPost, "/api/download-local", strings.NewReader(`{"namespace":"default","pvc":"data","path":"/a.txt","destDir":"/tmp"}`))
+        rr := httptest.NewRecorder()
+
+        h.DownloadToLocalHandler(rr, req)
+
+        if rr.Code != http.StatusServiceUnavailable {
+                t.Errorf("expected 503, got %d", rr.Code)
+        }
+}
+
+func TestSavedSearchesPersist(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        h := &Handler{}
+
+        body := `{"name":"failed jobs","namespace":"batch","pvc":"outputs","query":{"path":"/jobs/../jobs","pattern":"*.err","modifiedWithin":"24h"}}`
+        rr := httptest.NewRecorder()
+        h.SavedSearchesHandler(rr, httptest.NewRequest(http.MethodPost, "/api/saved-searches", strings.NewReader(body)))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+        }
+        var created SavedSearch
+        if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+                t.Fatalf("failed to decode response: %v", err)
+        }
+        if created.ID == "" || created.Query.Path != "/jobs" {
+                t.Errorf("unexpected saved search: %+v", created)
+        }
+
+        // A fresh handler (i.e. after a restart) must see the saved search.
+        h2 := &Handler{}
+        rr = httptest.NewRecorder()
+        h2.SavedSearchesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/saved-searches", nil))
+        var listed struct {
+                Searches []SavedSearch `json:"searches"`
+        }
+        json.NewDecoder(rr.Body).Decode(&listed)
+        if len(listed.Searches) != 1 || listed.Searches[0].Name != "failed jobs" {
+                t.Fatalf("expected saved search to persist, got %+v", listed.Searches)
+        }
+
+        rr = httptest.NewRecorder()
+        h2.SavedSearchesHandler(rr, httptest.NewRequest(http.MethodDelete, "/api/saved-searches?id="+created.ID, nil))
+        if rr.Code != http.StatusOK {
+                t.Errorf("expected 200 on delete, got %d", rr.Code)
+        }
+        if len(h2.getSavedSearches().list()) != 0 {
+                t.Error("expected saved search to be deleted")
+        }
+}
+
+func TestConfigExportImport(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        h := &Handler{}
+        body := `{"name":"failed jobs","namespace":"batch","pvc":"outputs","query":{"path":"/jobs","pattern":"*.err"}}`
+        h.SavedSearchesHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/saved-searches", strings.NewReader(body)))
+
+        rr := httptest.NewRecorder()
+        h.ConfigExportHandler(rr, httptest.NewRequest(http.MethodGet, "/api/config/export", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Disposition"), "attachment") {
+                t.Fatalf("unexpected export %d %v", rr.Code, rr.Header())
+        }
+        exported := strings.Replace(rr.Body.String(), `"files"`, `"browser":{"kube-browser.sort":{"sort":"name"}},"files"`, 1)
+
+        // Another machine, which has already listed its (no) searches.
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        h2 := &Handler{}
+        h2.SavedSearchesHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/saved-searches", nil))
+        rr = httptest.NewRecorder()
+        h2.ConfigImportHandler(rr, httptest.NewRequest(http.MethodPost, "/api/config/import", strings.NewReader(exported)))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"kube-browser.sort"`) {
+                t.Fatalf("unexpected import %d %s", rr.Code, rr.Body.String())
+        }
+        if got := h2.getSavedSearches().list(); len(got) != 1 || got[0].Name != "failed jobs" {
+                t.Errorf("expected the imported search, got %+v", got)
+        }
+
+        rr = httptest.NewRecorder()
+        h2.ConfigImportHandler(rr, httptest.NewRequest(http.MethodPost, "/api/config/import", strings.NewReader(`{"version":1,"files":{"jobs.json":[]}}`)))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected job records to be refused, got %d", rr.Code)
+        }
+}
+
+func TestSavedSearchesRejectsInvalidQuery(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        h := &Handler{}
+
+        body := `{"name":"bad","namespace":"ns","pvc":"p","query":{"modifiedWithin":"yesterday"}}`
+        rr := httptest.NewRecorder()
+        h.SavedSearchesHandler(rr, httptest.NewRequest(http.MethodPost, "/api/saved-searches", strings.NewReader(body)))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected 400, got %d", rr.Code)
+        }
+}
+
+func TestSearchHandler(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/logs/a.log", []byte("0123456789"))
+        demo.WriteFile("default", "data", "/logs/b.txt", []byte("0123456789"))
+        demo.WriteFile("default", "data", "/logs/c.log", []byte("01"))
+        demo.WriteFile("default", "data", "/logs/old/d.csv", []byte("0123456789"))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.SearchHandler(rr, httptest.NewRequest(http.MethodGet, "/api/search?namespace=default&pvc=data&path=/logs&name=*.log&name=*.csv&minSize=5", nil))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+        }
+        var resp struct {
+                Files     []k8s.FileInfo `json:"files"`
+                Truncated bool           `json:"truncated"`
+        }
+        json.NewDecoder(rr.Body).Decode(&resp)
+        var names []string
+        for _, f := range resp.Files {
+                names = append(names, f.Name)
+        }
+        if got := strings.Join(names, ","); got != "a.log,d.csv" || resp.Truncated {
+                t.Errorf("unexpected matches %q (truncated=%v)", got, resp.Truncated)
+        }
+
+        for _, query := range []string{"namespace=default", "namespace=default&pvc=data&minSize=big", "namespace=default&pvc=data&maxDepth=-1"} {
+                rr = httptest.NewRecorder()
+                h.SearchHandler(rr, httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil))
+                if rr.Code != http.StatusBadRequest {
+                        t.Errorf("%s: expected 400, got %d", query, rr.Code)
+                }
+        }
+}
+
+// slowListing holds ListFiles until release is closed, like a listing that
+// waits for a helper pod.
+type slowListing struct {
+        KubeClient
+        release chan struct{}
+}
+
+func (s *slowListing) ListFiles(ctx context.Context, namespace, pvc, path string) ([]k8s.FileInfo, error) {
+        select {
+        case <-s.release:
+        case <-ctx.Done():
+                return nil, ctx.Err()
+        }
+        return s.KubeClient.ListFiles(ctx, namespace, pvc, path)
+}
+
+func TestListFilesAsync(t *testing.T) {
+        defer func(d time.Duration) { listGrace = d }(listGrace)
+        listGrace = 20 * time.Millisecond
+
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/a.txt", []byte("a"))
+        slow := &slowListing{KubeClient: demo, release: make(chan struct{})}
+        h := &Handler{client: slow}
+
+        close(slow.release)
+        rr := httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&async=true", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "a.txt") {
+                t.Fatalf("expected a quick listing to be answered directly, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        slow.release = make(chan struct{})
+        rr = httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&async=true&refresh=true", nil))
+        var started struct {
+                Status    string `json:"status"`
+                Operation struct {
+                        ID string `json:"id"`
+                } `json:"operation"`
+        }
+        json.NewDecoder(rr.Body).Decode(&started)
+        if rr.Code != http.StatusAccepted || started.Status != "running" || started.Operation.ID == "" {
+                t.Fatalf("expected 202 with an operation, got %d %+v", rr.Code, started)
+        }
+        if loc := rr.Header().Get("Location"); loc != "/api/files/operation?id="+started.Operation.ID {
+                t.Errorf("unexpected Location %q", loc)
+        }
+
+        poll := "/api/files/operation?id=" + started.Operation.ID
+        rr = httptest.NewRecorder()
+        h.ListOperationHandler(rr, httptest.NewRequest(http.MethodGet, poll, nil))
+        if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"events":[]`) {
+                t.Errorf("expected the operation to be running, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        close(slow.release)
+        deadline := time.Now().Add(5 * time.Second)
+        for {
+                rr = httptest.NewRecorder()
+                h.ListOperationHandler(rr, httptest.NewRequest(http.MethodGet, poll, nil))
+                if rr.Code != http.StatusAccepted || time.Now().After(deadline) {
+                        break
+                }
+                time.Sleep(5 * time.Millisecond)
+        }
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "a.txt") {
+                t.Errorf("expected the listing once done, got %d %s", rr.Code, rr.Body.String())
+        }
+}
+
+func TestListFilesCached(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/a.txt", []byte("a"))
+        counting := &countingListing{KubeClient: demo}
+        h := &Handler{client: counting}
+        list := func(query string) string {
+                rr := httptest.NewRecorder()
+                h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data"+query, nil))
+                if rr.Code != http.StatusOK {
+                        t.Fatalf("listing failed: %d %s", rr.Code, rr.Body.String())
+                }
+                return rr.Body.String()
+        }
+
+        list("")
+        list("&sort=name")
+        if counting.lists != 1 {
+                t.Fatalf("expected the second listing to come from the cache, listed %d times", counting.lists)
+        }
+        list("&refresh=true")
+        if counting.lists != 2 {
+                t.Errorf("expected refresh to list again, listed %d times", counting.lists)
+        }
+
+        // A write through Activity forgets the listing.
+        write := h.Activity("upload", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                demo.WriteFile("default", "data", "/b.txt", []byte("b"))
+        }))
+        write.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/upload", nil))
+        if body := list(""); !strings.Contains(body, "b.txt") || counting.lists != 3 {
+                t.Errorf("expected the upload to show up, listed %d times: %s", counting.lists, body)
+        }
+}
+
+// countingListing counts the listings that reach the cluster.
+type countingListing struct {
+        KubeClient
+        lists int
+}
+
+func (c *countingListing) ListFiles(ctx context.Context, namespace, pvcName, path string) ([]k8s.FileInfo, error) {
+        c.lists++
+        return c.KubeClient.ListFiles(ctx, namespace, pvcName, path)
+}
+
+func TestListFilesSortedAndFiltered(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/small.log", []byte("a"))
+        demo.WriteFile("default", "data", "/big.log", []byte("aaaaaaaa"))
+        demo.WriteFile("default", "data", "/notes.txt", []byte("aaaa"))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&sort=size&desc=true&filter=*.LOG", nil))
+        var resp struct {
+                Files []k8s.FileInfo `json:"files"`
+                Total int            `json:"total"`
+        }
+        json.NewDecoder(rr.Body).Decode(&resp)
+        if rr.Code != http.StatusOK || len(resp.Files) != 2 || resp.Files[0].Name != "big.log" || resp.Files[1].Name != "small.log" || resp.Total != 3 {
+                t.Fatalf("expected the logs, largest first, of 3 entries, got %d %+v", rr.Code, resp)
+        }
+
+        rr = httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&filter=[a-", nil))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected a malformed filter to be rejected, got %d", rr.Code)
+        }
+}
+
+func TestListFilesPaged(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_LISTING_LIMIT", "2")
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+                demo.WriteFile("default", "data", "/"+name, []byte(name))
+        }
+        h := &Handler{client: demo}
+        type page struct {
+                Files     []k8s.FileInfo `json:"files"`
+                Truncated bool           `json:"truncated"`
+                Remaining int            `json:"remaining"`
+                Continue  string         `json:"continue"`
+                Warning   string         `json:"warning"`
+        }
+        list := func(query string) (int, page) {
+                rr := httptest.NewRecorder()
+                h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&sort=name"+query, nil))
+                var p page
+                json.NewDecoder(rr.Body).Decode(&p)
+                return rr.Code, p
+        }
+
+        code, p := list("")
+        if code != http.StatusOK || len(p.Files) != 2 || p.Files[0].Name != "a.txt" || !p.Truncated || p.Remaining != 3 || p.Continue == "" || p.Warning == "" {
+                t.Fatalf("expected the first 2 of 5 entries with a token, got %d %+v", code, p)
+        }
+        var names []string
+        for p.Continue != "" {
+                for _, f := range p.Files {
+                        names = append(names, f.Name)
+                }
+                token := p.Continue
+                if code, p = list("&continue=" + token); code != http.StatusOK {
+                        t.Fatalf("continuing failed: %d", code)
+                }
+        }
+        for _, f := range p.Files {
+                names = append(names, f.Name)
+        }
+        if strings.Join(names, ",") != "a.txt,b.txt,c.txt,d.txt,e.txt" || p.Truncated {
+                t.Errorf("expected every entry once across the pages, got %v", names)
+        }
+
+        if code, p = list("&limit=10"); len(p.Files) != 2 {
+                t.Errorf("expected limit not to raise the configured limit, got %d entries", len(p.Files))
+        }
+        _, first := list("")
+        if code, _ = list("&filter=*.txt&continue=" + first.Continue); code != http.StatusBadRequest {
+                t.Errorf("expected a token of another filter to be refused, got %d", code)
+        }
+        demo.DeleteFile(context.Background(), "default", "data", "/b.txt")
+        if code, _ = list("&refresh=true&continue=" + first.Continue); code != http.StatusConflict {
+                t.Errorf("expected a changed directory to be reported, got %d", code)
+        }
+}
+
+func TestListFilesStreamed(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data", Capacity: "1Mi"})
+        demo.WriteFile("default", "data", "/a.log", []byte("a"))
+        demo.WriteFile("default", "data", "/b.log", []byte("b"))
+        demo.WriteFile("default", "data", "/notes.txt", []byte("c"))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&stream=true&filter=*.log&df=true", nil))
+        if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+                t.Fatalf("expected an NDJSON stream, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+        }
+        lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+        if len(lines) != 3 {
+                t.Fatalf("expected two entries and a last line, got %q", lines)
+        }
+        names := map[string]bool{}
+        for _, line := range lines[:2] {
+                var f k8s.FileInfo
+                if err := json.Unmarshal([]byte(line), &f); err != nil {
+                        t.Fatalf("bad entry %q: %v", line, err)
+                }
+                names[f.Name] = true
+        }
+        if !names["a.log"] || !names["b.log"] {
+                t.Errorf("expected the logs, got %q", lines)
+        }
+        var trailer struct {
+                Done       bool                 `json:"done"`
+                Count      int                  `json:"count"`
+                Total      int                  `json:"total"`
+                Filesystem *k8s.FilesystemUsage `json:"filesystem"`
+        }
+        json.Unmarshal([]byte(lines[2]), &trailer)
+        if !trailer.Done || trailer.Count != 2 || trailer.Total != 3 || trailer.Filesystem == nil {
+                t.Errorf("unexpected last line %q", lines[2])
+        }
+
+        rr = httptest.NewRecorder()
+        req := httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&path=/missing", nil)
+        req.Header.Set("Accept", "application/x-ndjson")
+        h.ListFilesHandler(rr, req)
+        if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), `"error"`) {
+                t.Errorf("expected an error before any entry to be answered as JSON, got %d %s", rr.Code, rr.Body.String())
+        }
+}
+
+func TestListFilesWithFilesystemUsage(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data", Capacity: "1Mi"})
+        demo.WriteFile("default", "data", "/a.txt", []byte("hello"))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&df=true", nil))
+        var resp struct {
+                Filesystem *k8s.FilesystemUsage `json:"filesystem"`
+        }
+        json.NewDecoder(rr.Body).Decode(&resp)
+        if rr.Code != http.StatusOK || resp.Filesystem == nil {
+                t.Fatalf("expected filesystem usage, got %d", rr.Code)
+        }
+        if resp.Filesystem.TotalBytes != 1<<20 || resp.Filesystem.UsedBytes != 4096+5 || resp.Filesystem.InodesUsed != 2 {
+                t.Errorf("unexpected usage %+v", *resp.Filesystem)
+        }
+
+        rr = httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data", nil))
+        if strings.Contains(rr.Body.String(), "filesystem") {
+                t.Errorf("expected no filesystem usage unless asked for, got %s", rr.Body.String())
+        }
+}
+
+func TestListOperationCancel(t *testing.T) {
+        defer func(d time.Duration) { listGrace = d }(listGrace)
+        listGrace = 20 * time.Millisecond
+
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        h := &Handler{client: &slowListing{KubeClient: demo, release: make(chan struct{})}}
+
+        rr := httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&async=1", nil))
+        var started struct {
+                Operation struct {
+                        ID string `json:"id"`
+                } `json:"operation"`
+        }
+        json.NewDecoder(rr.Body).Decode(&started)
+        op, ok := h.getListOperations().get(started.Operation.ID)
+        if !ok {
+                t.Fatalf("expected a running operation, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.ListOperationHandler(rr, httptest.NewRequest(http.MethodDelete, "/api/files/operation?id="+op.ID, nil))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d", rr.Code)
+        }
+        select {
+        case <-op.done:
+        case <-time.After(5 * time.Second):
+                t.Fatal("expected the listing to be canceled")
+        }
+        rr = httptest.NewRecorder()
+        h.ListOperationHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files/operation?id="+op.ID, nil))
+        if rr.Code != http.StatusNotFound {
+                t.Errorf("expected a canceled operation to be gone, got %d", rr.Code)
+        }
+}
+
+func TestChecksumHandler(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/hello.txt", []byte("hello"))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.ChecksumHandler(rr, httptest.NewRequest(http.MethodGet, "/api/checksum?namespace=default&pvc=data&path=/hello.txt", nil))
+        var sum k8s.FileChecksum
+        json.NewDecoder(rr.Body).Decode(&sum)
+        if rr.Code != http.StatusOK || sum.Algorithm != "sha256" || sum.Checksum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+                t.Errorf("unexpected response %d %+v", rr.Code, sum)
+        }
+
+        rr = httptest.NewRecorder()
+        h.ChecksumHandler(rr, httptest.NewRequest(http.MethodGet, "/api/checksum?namespace=default&pvc=data&path=/hello.txt&algo=crc32", nil))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected 400 for an unknown algorithm, got %d", rr.Code)
+        }
+}
+
+func TestJobsHandlerReportsInterruptedJobs(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        state := `[{"id":"j1","kind":"archive","description":"Archive data.tar.gz","params":{},"state":"running","created":"2026-01-01T00:00:00Z"}]`
+        if err := os.WriteFile(os.Getenv("KUBE_BROWSER_STATE_DIR")+"/jobs.json", []byte(state), 0o600); err != nil {
+                t.Fatal(err)
+        }
+
+        h := &Handler{}
+        rr := httptest.NewRecorder()
+        h.JobsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+
+        var resp struct {
+                Jobs []struct {
+                        ID    string `json:"id"`
+                        State string `json:"state"`
+                } `json:"jobs"`
+        }
+        if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+                t.Fatalf("failed to decode response: %v", err)
+        }
+        if len(resp.Jobs) != 1 || resp.Jobs[0].State != "interrupted" {
+                t.Fatalf("expected the running job to be reported as interrupted, got %+v", resp.Jobs)
+        }
+
+        rr = httptest.NewRecorder()
+        h.JobsHandler(rr, httptest.NewRequest(http.MethodDelete, "/api/jobs?id=j1", nil))
+        if rr.Code != http.StatusOK {
+                t.Errorf("expected dismiss to succeed, got %d", rr.Code)
+        }
+}
+
+func TestCleanupHandlerReportsFailedTasks(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_CLEANUP_ATTEMPTS", "1")
+
+        h := &Handler{}
+        h.getCleanup().Enqueue("temp-file", "/tmp/locked", func(context.Context) error {
+                return errors.New("permission denied")
+        })
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := h.DrainCleanup(ctx); err != nil {
+                t.Fatal(err)
+        }
+
+        rr := httptest.NewRecorder()
+        h.CleanupHandler(rr, httptest.NewRequest(http.MethodGet, "/api/cleanup", nil))
+
+        var resp struct {
+                Tasks []struct {
+                        Target    string `json:"target"`
+                        State     string `json:"state"`
+                        LastError string `json:"lastError"`
+                } `json:"tasks"`
+                Pending int `json:"pending"`
+                Failed  int `json:"failed"`
+        }
+        if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+                t.Fatalf("failed to decode response: %v", err)
+        }
+        if resp.Failed != 1 || resp.Pending != 0 || len(resp.Tasks) != 1 {
+                t.Fatalf("unexpected cleanup status: %+v", resp)
+        }
+        if task := resp.Tasks[0]; task.Target != "/tmp/locked" || task.State != "failed" || task.LastError != "permission denied" {
+                t.Errorf("unexpected task: %+v", task)
+        }
+}
+
+func TestAttachmentDisposition(t *testing.T) {
+        tests := []struct {
+                name string
+                want string
+        }{
+                {"report.csv", "attachment; filename=report.csv"},
+                {"two\nlines.txt", "attachment; filename=two_lines.txt"},
+                {"\x1b[31mred.log", `attachment; filename="_[31mred.log"`},
+                {"résumé.pdf", "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf"},
+        }
+        for _, tt := range tests {
+                if got := attachmentDisposition(tt.name); got != tt.want {
+                        t.Errorf("attachmentDisposition(%q) = %q, want %q", tt.name, got, tt.want)
+                }
+        }
+}
+
+func TestSortOptionsFromQuery(t *testing.T) {
+        r := httptest.NewRequest(http.MethodGet, "/api/files", nil)
+        o, err := sortOptionsFromQuery(r)
+        if err != nil || o.Mode != k8s.SortNatural || !o.CaseInsensitive || !o.DirsFirst {
+                t.Fatalf("defaults: got %+v, %v", o, err)
+        }
+
+        r = httptest.NewRequest(http.MethodGet, "/api/files?sort=name&caseInsensitive=false&dirsFirst=0", nil)
+        o, err = sortOptionsFromQuery(r)
+        if err != nil || o.Mode != k8s.SortName || o.CaseInsensitive || o.DirsFirst {
+                t.Fatalf("explicit: got %+v, %v", o, err)
+        }
+
+        r = httptest.NewRequest(http.MethodGet, "/api/files?sort=mtime&desc=true", nil)
+        o, err = sortOptionsFromQuery(r)
+        if err != nil || o.Mode != k8s.SortModTime || !o.Descending {
+                t.Fatalf("newest first: got %+v, %v", o, err)
+        }
+
+        for _, q := range []string{"sort=color", "dirsFirst=maybe", "desc=maybe"} {
+                r = httptest.NewRequest(http.MethodGet, "/api/files?"+q, nil)
+                if _, err := sortOptionsFromQuery(r); err == nil {
+                        t.Errorf("%s: expected error", q)
+                }
+        }
+}
+
+func TestArchiveExtractBlockedInReadOnlyMode(t *testing.T) {
+        h := &Handler{readOnly: true}
+        req := httptest.NewRequest(http.MethodPost, "/api/archive-extract", strings.NewReader(`{}`))
+        rr := httptest.NewRecorder()
+
+        h.ArchiveExtractHandler(rr, req)
+
+        if rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected 405, got %d", rr.Code)
+        }
+}
+
+func TestMoveBlockedInReadOnlyMode(t *testing.T) {
+        h := &Handler{readOnly: true}
+        req := httptest.NewRequest(http.MethodPost, "/api/move", strings.NewReader(`{}`))
+        rr := httptest.NewRecorder()
+
+        h.MoveHandler(rr, req)
+
+        if rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected 405, got %d", rr.Code)
+        }
+}
+
+func TestMigrateBlockedInReadOnlyMode(t *testing.T) {
+        h := &Handler{readOnly: true}
+        req := httptest.NewRequest(http.MethodPost, "/api/migrate", strings.NewReader(`{}`))
+        rr := httptest.NewRecorder()
+
+        h.MigrateHandler(rr, req)
+
+        if rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected 405, got %d", rr.Code)
+        }
+}
+
+func TestCloneBlockedInReadOnlyMode(t *testing.T) {
+        h := &Handler{readOnly: true}
+        req := httptest.NewRequest(http.MethodPost, "/api/clone", strings.NewReader(`{}`))
+        rr := httptest.NewRecorder()
+
+        h.CloneHandler(rr, req)
+
+        if rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected 405, got %d", rr.Code)
+        }
+}
+
+func TestMaintenanceBlockedInReadOnlyMode(t *testing.T) {
+        h := &Handler{readOnly: true}
+        for _, method := range []string{http.MethodPost, http.MethodDelete} {
+                req := httptest.NewRequest(method, "/api/maintenance?namespace=default&pvc=data", strings.NewReader(`{"namespace":"default","pvc":"data"}`))
+                rr := httptest.NewRecorder()
+
+                h.MaintenanceHandler(rr, req)
+
+                if rr.Code != http.StatusMethodNotAllowed {
+                        t.Errorf("%s: expected 405, got %d", method, rr.Code)
+                }
+        }
+}
+
+func TestMaintenanceLimitsDuration(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_MAINTENANCE_MAX_MINUTES", "60")
+        h := &Handler{client: k8s.NewSampleDemoCluster()}
+        req := httptest.NewRequest(http.MethodPost, "/api/maintenance", strings.NewReader(`{"namespace":"default","pvc":"web-content","minutes":90}`))
+        rr := httptest.NewRecorder()
+
+        h.MaintenanceHandler(rr, req)
+
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.MaintenanceHandler(rr, httptest.NewRequest(http.MethodGet, "/api/maintenance?namespace=default", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"sessions":[]`) {
+                t.Errorf("GET = %d %s, want no sessions", rr.Code, rr.Body.String())
+        }
+}
+
+func TestChmodAndChown(t *testing.T) {
+        demo := k8s.NewSampleDemoCluster()
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.ChmodHandler(rr, httptest.NewRequest(http.MethodPost, "/api/chmod", strings.NewReader(`{"namespace":"default","pvc":"web-content","path":"/html","mode":"g+w","recursive":true}`)))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("chmod: expected 200, got %d: %s", rr.Code, rr.Body.String())
+        }
+        rr = httptest.NewRecorder()
+        h.ChownHandler(rr, httptest.NewRequest(http.MethodPost, "/api/chown", strings.NewReader(`{"namespace":"default","pvc":"web-content","path":"/html/index.html","owner":"1000:2000"}`)))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("chown: expected 200, got %d: %s", rr.Code, rr.Body.String())
+        }
+
+        files, err := demo.ListFiles(context.Background(), "default", "web-content", "/html")
+        if err != nil || len(files) != 2 {
+                t.Fatalf("ListFiles = %+v, %v", files, err)
+        }
+        for _, f := range files {
+                owner := "0:0"
+                if f.Name == "index.html" {
+                        owner = "1000:2000"
+                }
+                if f.Mode != "-rw-rw-r--" || f.UID+":"+f.GID != owner {
+                        t.Errorf("%s: mode %q, owner %s:%s", f.Name, f.Mode, f.UID, f.GID)
+                }
+        }
+
+        for _, body := range []string{
+                `{"namespace":"default","pvc":"web-content","path":"/html"}`,
+                `{"namespace":"default","pvc":"web-content","path":"/html","mode":"-w"}`,
+        } {
+                rr = httptest.NewRecorder()
+                h.ChmodHandler(rr, httptest.NewRequest(http.MethodPost, "/api/chmod", strings.NewReader(body)))
+                if rr.Code != http.StatusBadRequest {
+                        t.Errorf("%s: expected 400, got %d", body, rr.Code)
+                }
+        }
+}
+
+func TestConnectRejectsInvalidRegistryMirror(t *testing.T) {
+        h := &Handler{}
+        req := httptest.NewRequest(http.MethodPost, "/api/connect", strings.NewReader(`{"context":"dev","registryMirror":"https://mirror.example.com"}`))
+        rr := httptest.NewRecorder()
+
+        h.ConnectHandler(rr, req)
+
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected 400, got %d", rr.Code)
+        }
+        if !strings.Contains(rr.Body.String(), "scheme") {
+                t.Errorf("expected the mirror error, got %s", rr.Body.String())
+        }
+}
+
+func TestConnectScopedToNamespace(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "config")
+        kubeconfig := "apiVersion: v1\nkind: Config\ncurrent-context: team\n" +
+                "clusters:\n- name: c\n  cluster: {server: \"https://127.0.0.1:1\"}\n" +
+                "users:\n- name: u\n  user: {token: t}\n" +
+                "contexts:\n- name: team\n  context: {cluster: c, user: u, namespace: team-a}\n"
+        if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+                t.Fatal(err)
+        }
+        // Minimal mode skips the helper pod sweep, which would need the API
+        // server.
+        h := &Handler{minimal: true}
+
+        for _, tc := range [][2]string{
+                {`{"kubeconfigPath":"` + path + `","context":"team","namespace":"team-b"}`, "team-b"},
+                {`{"kubeconfigPath":"` + path + `","context":"team","contextNamespace":true}`, "team-a"},
+        } {
+                body, want := tc[0], tc[1]
+                rr := httptest.NewRecorder()
+                h.ConnectHandler(rr, httptest.NewRequest(http.MethodPost, "/api/connect", strings.NewReader(body)))
+                var resp struct {
+                        Namespaces []string `json:"namespaces"`
+                        Scope      string   `json:"scope"`
+                }
+                if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || rr.Code != http.StatusOK {
+                        t.Fatalf("expected %s to connect without listing namespaces, got %d (%v)", body, rr.Code, err)
+                }
+                if resp.Scope != want || len(resp.Namespaces) != 1 || resp.Namespaces[0] != want {
+                        t.Errorf("expected the connection scoped to %s, got %+v", want, resp)
+                }
+        }
+
+        rr := httptest.NewRecorder()
+        h.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+        if !strings.Contains(rr.Body.String(), `"scope":"team-a"`) {
+                t.Errorf("expected the status to report the scope, got %s", rr.Body.String())
+        }
+}
+
+func TestDemoModeConnectAndBrowse(t *testing.T) {
+        h := &Handler{}
+        h.EnableDemoMode(k8s.NewSampleDemoCluster())
+
+        rr := httptest.NewRecorder()
+        h.LoadKubeconfigHandler(rr, httptest.NewRequest(http.MethodPost, "/api/kubeconfig", strings.NewReader(`{"path":"/nonexistent"}`)))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"current":"demo"`) {
+                t.Fatalf("expected the demo context, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.ConnectHandler(rr, httptest.NewRequest(http.MethodPost, "/api/connect", strings.NewReader(`{"context":"demo"}`)))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("connect: expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=web-content&path=/", nil))
+        var listing struct {
+                Files []k8s.FileInfo `json:"files"`
+        }
+        if err := json.NewDecoder(rr.Body).Decode(&listing); err != nil {
+                t.Fatalf("failed to decode listing: %v", err)
+        }
+        var names []string
+        for _, f := range listing.Files {
+                names = append(names, f.Name)
+        }
+        if got := strings.Join(names, ","); got != "config,html,README.md" {
+                t.Errorf("unexpected listing %q", got)
+        }
+
+        rr = httptest.NewRecorder()
+        h.DownloadFileHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download?namespace=default&pvc=web-content&path=/html/index.html", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Hello from KubeBrowser") {
+                t.Errorf("unexpected download: %d %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+        var status map[string]interface{}
+        json.NewDecoder(rr.Body).Decode(&status)
+        if status["demo"] != true || status["context"] != "demo" {
+                t.Errorf("unexpected status %v", status)
+        }
+}
+
+func TestUploadToDemoCluster(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        h := &Handler{client: demo}
+
+        body := strings.NewReader("--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"path\"\r\n\r\n/in\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nhello\r\n--boundary--\r\n")
+        req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+        req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+        rr := httptest.NewRecorder()
+
+        h.UploadFileHandler(rr, req)
+
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/in/a.txt", 100)
+        if err != nil || string(data) != "hello" {
+                t.Errorf("expected the uploaded file, got %q, %v", data, err)
+        }
+}
+
+func TestUploadSeveralFiles(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_UPLOAD_CONCURRENCY", "2")
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        slow := &concurrentUploads{KubeClient: demo}
+        h := &Handler{client: slow}
+
+        body := strings.NewReader("--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"path\"\r\n\r\n/in\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"files\"; filename=\"a.txt\"\r\n\r\naaa\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"size\"\r\n\r\n10\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"files\"; filename=\"short.txt\"\r\n\r\nshort\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"files\"; filename=\"b.txt\"\r\n\r\nbbb\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"files\"; filename=\"c.txt\"\r\n\r\nccc\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"files\"; filename=\"a.txt\"\r\n\r\nagain\r\n--boundary--\r\n")
+        req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+        req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+        rr := httptest.NewRecorder()
+        h.UploadFileHandler(rr, req)
+
+        var resp struct {
+                Success  bool `json:"success"`
+                Uploaded int  `json:"uploaded"`
+                Failed   int  `json:"failed"`
+                Files    []struct {
+                        Filename string `json:"filename"`
+                        Success  bool   `json:"success"`
+                        Path     string `json:"path"`
+                        Error    string `json:"error"`
+                } `json:"files"`
+        }
+        json.NewDecoder(rr.Body).Decode(&resp)
+        if rr.Code != http.StatusOK || resp.Success || resp.Uploaded != 3 || resp.Failed != 2 || len(resp.Files) != 5 {
+                t.Fatalf("expected 3 of 5 files uploaded, got %d %+v", rr.Code, resp)
+        }
+        if f := resp.Files[1]; f.Filename != "short.txt" || f.Success || !strings.Contains(f.Error, "5 of its 10 bytes") {
+                t.Errorf("expected the truncated file to fail, got %+v", f)
+        }
+        if f := resp.Files[4]; f.Success || !strings.Contains(f.Error, "another file") {
+                t.Errorf("expected the second a.txt to be refused, got %+v", f)
+        }
+        if f := resp.Files[3]; !f.Success || f.Path != "/in/c.txt" {
+                t.Errorf("expected c.txt to be uploaded, got %+v", f)
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/in/a.txt", 100)
+        if err != nil || string(data) != "aaa" {
+                t.Errorf("expected the first a.txt, got %q, %v", data, err)
+        }
+        if slow.max != 2 {
+                t.Errorf("expected 2 uploads at once, got %d", slow.max)
+        }
+}
+
+func TestUploadConflictPolicy(t *testing.T) {
+	demo := k8s.NewDemoCluster()
+	demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+	demo.WriteFile("default", "data", "/in/a.txt", []byte("old"))
+	demo.WriteFile("default", "data", "/in/a (1).txt", []byte("older"))
+	h := &Handler{client: demo}
+	upload := func(onConflict string, files ...string) *httptest.ResponseRecorder {
+		body := "--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"path\"\r\n\r\n/in\r\n--boundary"
+		part := "file"
+		if len(files) > 1 {
+			part = "files"
+		}
+		for _, f := range files {
+			body += "\r\nContent-Disposition: form-data; name=\"" + part + "\"; filename=\"" + f + "\"\r\n\r\nnew\r\n--boundary"
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/upload?onConflict="+onConflict, strings.NewReader(body+"--\r\n"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+		rr := httptest.NewRecorder()
+		h.UploadFileHandler(rr, req)
+		return rr
+	}
+	content := func(p string) string {
+		data, _, _ := demo.ReadFileHead(context.Background(), "default", "data", p, 100)
+		return string(data)
+	}
+
+	if rr := upload("fail", "a.txt"); rr.Code != http.StatusConflict || content("/in/a.txt") != "old" {
+		t.Errorf("expected the upload to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := upload("skip", "a.txt"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"skipped":true`) || content("/in/a.txt") != "old" {
+		t.Errorf("expected the upload to be skipped, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr := upload("rename", "a.txt")
+	var resp struct {
+		Filename string `json:"filename"`
+		Path     string `json:"path"`
+		Renamed  bool   `json:"renamed"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || !resp.Renamed || resp.Path != "/in/a (2).txt" || content("/in/a (2).txt") != "new" || content("/in/a.txt") != "old" {
+		t.Errorf("expected the upload to land next to the others, got %d %+v", rr.Code, resp)
+	}
+	if rr := upload("overwrite", "a.txt"); rr.Code != http.StatusOK || content("/in/a.txt") != "new" {
+		t.Errorf("expected a.txt to be overwritten, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := upload("clobber", "a.txt"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown policy to be refused, got %d", rr.Code)
+	}
+
+	// Two files renamed at once never take the same name.
+	demo.WriteFile("default", "data", "/in/b", []byte("old"))
+	rr = upload("rename", "b", "b (3)", "c")
+	var many struct {
+		Uploaded int `json:"uploaded"`
+		Files    []struct {
+			Path string `json:"path"`
+		} `json:"files"`
+	}
+	json.NewDecoder(rr.Body).Decode(&many)
+	if many.Uploaded != 3 || many.Files[0].Path != "/in/b (1)" || many.Files[1].Path != "/in/b (3)" || many.Files[2].Path != "/in/c" {
+		t.Errorf("unexpected uploads %+v", many)
+	}
+	rr = upload("fail", "b", "d")
+	many.Uploaded = 0
+	json.NewDecoder(rr.Body).Decode(&many)
+	if many.Uploaded != 1 || content("/in/b") != "old" || content("/in/d") != "new" {
+		t.Errorf("expected only d to be uploaded, got %+v", many)
+	}
+}
+
+// lostWrite stands for a network filesystem whose other clients do not
+// see what was written: every upload lands as something else.
+type lostWrite struct {
+	*k8s.DemoCluster
+}
+
+func (l lostWrite) UploadFile(ctx context.Context, namespace, pvc, destPath string, data io.Reader) error {
+	io.Copy(io.Discard, data)
+	return l.DemoCluster.UploadFile(ctx, namespace, pvc, destPath, strings.NewReader("stale"))
+}
+
+func TestUploadVerify(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	t.Setenv("KUBE_BROWSER_VERIFY_WAIT_SEC", "0")
+	demo := k8s.NewDemoCluster()
+	demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+	upload := func(h *Handler, query string, files ...string) (int, map[string]interface{}) {
+		body := "--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary"
+		part := "file"
+		if len(files) > 1 {
+			part = "files"
+		}
+		for _, f := range files {
+			body += "\r\nContent-Disposition: form-data; name=\"" + part + "\"; filename=\"" + f + "\"\r\n\r\nhello\r\n--boundary"
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/upload?"+query, strings.NewReader(body+"--\r\n"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+		rr := httptest.NewRecorder()
+		h.UploadFileHandler(rr, req)
+		var resp map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+
+	h := &Handler{client: demo}
+	code, resp := upload(h, "verify=true", "a.txt")
+	id, _ := resp["verifyJob"].(string)
+	if code != http.StatusOK || id == "" {
+		t.Fatalf("expected a read-back job to be queued, got %d %v", code, resp)
+	}
+	job := waitForJob(t, h, id)
+	if job.State != jobs.StateSucceeded || !strings.Contains(string(job.Result), `"match":true`) {
+		t.Errorf("expected the file to read back as written, got %s %s %s", job.State, job.Error, job.Result)
+	}
+	if code, resp := upload(h, "verify=true&extract=true", "a.tar"); code != http.StatusBadRequest {
+		t.Errorf("expected verify to be refused for an extracted archive, got %d %v", code, resp)
+	}
+	if _, resp := upload(h, "", "b.txt"); resp["verifyJob"] != nil {
+		t.Errorf("expected no read-back job unless asked, got %v", resp)
+	}
+
+	// Every file of a multi-file upload is read back by one job, which
+	// fails when any of them differs.
+	h = &Handler{client: lostWrite{demo}}
+	code, resp = upload(h, "verify=true", "c.txt", "d.txt")
+	id, _ = resp["verifyJob"].(string)
+	if code != http.StatusOK || id == "" {
+		t.Fatalf("expected a read-back job to be queued, got %d %v", code, resp)
+	}
+	job = waitForJob(t, h, id)
+	var report k8s.ReadBackReport
+	json.Unmarshal(job.Result, &report)
+	if job.State != jobs.StateFailed || len(report.Files) != 2 || len(report.Mismatched()) != 2 {
+		t.Errorf("expected both files to be reported as differing, got %s %s %s", job.State, job.Error, job.Result)
+	}
+}
+
+// concurrentUploads holds each upload for a moment and records how many
+// ran at once.
+type concurrentUploads struct {
+        KubeClient
+        mu       sync.Mutex
+        inFlight int
+        max      int
+}
+
+func (c *concurrentUploads) UploadFile(ctx context.Context, namespace, pvc, destPath string, data io.Reader) error {
+        c.mu.Lock()
+        c.inFlight++
+        c.max = max(c.max, c.inFlight)
+        c.mu.Unlock()
+        time.Sleep(50 * time.Millisecond)
+        c.mu.Lock()
+        c.inFlight--
+        c.mu.Unlock()
+        return c.KubeClient.UploadFile(ctx, namespace, pvc, destPath, data)
+}
+
+// uploadRecorder passes uploads on to a demo cluster and keeps the reader
+// the handler handed over.
+type uploadRecorder struct {
+        KubeClient
+        data io.Reader
+}
+
+func (u *uploadRecorder) UploadFile(ctx context.Context, namespace, pvc, destPath string, data io.Reader) error {
+        u.data = data
+        return u.KubeClient.UploadFile(ctx, namespace, pvc, destPath, data)
+}
+
+func TestUploadWithDeclaredSize(t *testing.T) {
+        t.Setenv("MAX_UPLOAD_SIZE", "8")
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        rec := &uploadRecorder{KubeClient: demo}
+        h := &Handler{client: rec}
+
+        upload := func(size string) *httptest.ResponseRecorder {
+                body := strings.NewReader("--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"size\"\r\n\r\n" + size + "\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"mtime\"\r\n\r\n1700000000000\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nhello\r\n--boundary--\r\n")
+                req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+                req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+                rr := httptest.NewRecorder()
+                h.UploadFileHandler(rr, req)
+                return rr
+        }
+
+        if rr := upload("20"); rr.Code != http.StatusRequestEntityTooLarge || rec.data != nil {
+                t.Fatalf("expected a declared size above the limit to be refused up front, got %d %s", rr.Code, rr.Body.String())
+        }
+        if rr := upload("5"); rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        src, ok := rec.data.(*k8s.UploadSource)
+        if !ok || src.Size != 5 || !src.ModTime.Equal(time.Unix(1700000000, 0)) {
+                t.Errorf("expected a framed upload, got %#v", rec.data)
+        }
+}
+
+// streamingUpload signals once it has read the start of an upload, before
+// passing it on to a demo cluster.
+type streamingUpload struct {
+        KubeClient
+        started chan struct{}
+}
+
+func (u *streamingUpload) UploadFile(ctx context.Context, namespace, pvc, destPath string, data io.Reader) error {
+        head := make([]byte, len("first-"))
+        if _, err := io.ReadFull(data, head); err != nil {
+                return err
+        }
+        close(u.started)
+        return u.KubeClient.UploadFile(ctx, namespace, pvc, destPath, io.MultiReader(bytes.NewReader(head), data))
+}
+
+func TestUploadStreamsFilePart(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        stream := &streamingUpload{KubeClient: demo, started: make(chan struct{})}
+        h := &Handler{client: stream}
+
+        // The rest of the file is only sent once the client has the start
+        // of it, which would never happen if the handler buffered the part.
+        pr, pw := io.Pipe()
+        buffered := make(chan bool, 1)
+        go func() {
+                io.WriteString(pw, "--boundary\r\n"+
+                        "Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n"+
+                        "Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n"+
+                        "Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nfirst-")
+                select {
+                case <-stream.started:
+                        buffered <- false
+                case <-time.After(5 * time.Second):
+                        buffered <- true
+                }
+                io.WriteString(pw, "second\r\n--boundary--\r\n")
+                pw.Close()
+        }()
+        req := httptest.NewRequest(http.MethodPost, "/api/upload", pr)
+        req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+        rr := httptest.NewRecorder()
+        h.UploadFileHandler(rr, req)
+
+        if <-buffered {
+                t.Error("expected the file part to reach the client before the request body ended")
+        }
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/a.txt", 100)
+        if err != nil || string(data) != "first-second" {
+                t.Errorf("expected the uploaded file, got %q, %v", data, err)
+        }
+}
+
+func TestUploadSpoolsFileBeforeFields(t *testing.T) {
+        dir := t.TempDir()
+        t.Setenv("KUBE_BROWSER_SPOOL_DIR", dir)
+        t.Setenv("KUBE_BROWSER_SPOOL_MIN_FREE_MB", "0")
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        rec := &uploadRecorder{KubeClient: demo}
+        h := &Handler{client: rec}
+
+        stale := filepath.Join(dir, "kube-browser-upload-123")
+        os.WriteFile(stale, []byte("left over"), 0o600)
+        old := time.Now().Add(-2 * spoolTTL())
+        os.Chtimes(stale, old, old)
+        h.sweepUploadSpool()
+
+        body := strings.NewReader("--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nhello\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n" +
+                "Content-Disposition: form-data; name=\"path\"\r\n\r\n/in\r\n--boundary--\r\n")
+        req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+        req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+        rr := httptest.NewRecorder()
+        h.UploadFileHandler(rr, req)
+
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        if src, ok := rec.data.(*k8s.UploadSource); !ok || src.Size != 5 {
+                t.Errorf("expected the spooled file to be framed with its size, got %#v", rec.data)
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/in/a.txt", 100)
+        if err != nil || string(data) != "hello" {
+                t.Errorf("expected the uploaded file, got %q, %v", data, err)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := h.DrainCleanup(ctx); err != nil {
+                t.Fatal(err)
+        }
+        if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+                t.Errorf("expected the spool directory to be emptied, found %v", left)
+        }
+}
+
+func TestUploadAndExtract(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_SPOOL_DIR", t.TempDir())
+        t.Setenv("KUBE_BROWSER_SPOOL_MIN_FREE_MB", "0")
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        h := &Handler{client: demo}
+
+        upload := func(name string, archive []byte) *httptest.ResponseRecorder {
+                body := "--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"namespace\"\r\n\r\ndefault\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"pvc\"\r\n\r\ndata\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"path\"\r\n\r\n/restore\r\n--boundary\r\n" +
+                        "Content-Disposition: form-data; name=\"file\"; filename=\"" + name + "\"\r\n\r\n" + string(archive) + "\r\n--boundary--\r\n"
+                req := httptest.NewRequest(http.MethodPost, "/api/upload?extract=true", strings.NewReader(body))
+                req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+                rr := httptest.NewRecorder()
+                h.UploadFileHandler(rr, req)
+                return rr
+        }
+        tarGz := func(names ...string) []byte {
+                var buf bytes.Buffer
+                gz := gzip.NewWriter(&buf)
+                tw := tar.NewWriter(gz)
+                for _, name := range names {
+                        tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(name))})
+                        tw.Write([]byte(name))
+                }
+                tw.Close()
+                gz.Close()
+                return buf.Bytes()
+        }
+
+        rr := upload("backup.tar.gz", tarGz("site/index.html", "./site/css/app.css"))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"extracted":2`) {
+                t.Fatalf("expected 2 extracted files, got %d %s", rr.Code, rr.Body.String())
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/restore/site/css/app.css", 100)
+        if err != nil || string(data) != "./site/css/app.css" {
+                t.Errorf("expected the extracted file, got %q, %v", data, err)
+        }
+
+        var zipped bytes.Buffer
+        zw := zip.NewWriter(&zipped)
+        f, _ := zw.Create("docs/readme.txt")
+        f.Write([]byte("from zip"))
+        zw.Close()
+        if rr := upload("docs.zip", zipped.Bytes()); rr.Code != http.StatusOK {
+                t.Fatalf("expected the zip to be extracted, got %d %s", rr.Code, rr.Body.String())
+        }
+        data, _, err = demo.ReadFileHead(context.Background(), "default", "data", "/restore/docs/readme.txt", 100)
+        if err != nil || string(data) != "from zip" {
+                t.Errorf("expected the extracted zip member, got %q, %v", data, err)
+        }
+
+        if rr := upload("evil.tar.gz", tarGz("../escape.txt")); rr.Code != http.StatusBadRequest {
+                t.Errorf("expected a member outside the destination to be refused, got %d %s", rr.Code, rr.Body.String())
+        }
+        if _, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/escape.txt", 100); err == nil {
+                t.Error("expected nothing to be written outside the destination")
+        }
+        if rr := upload("notes.txt", []byte("plain")); rr.Code != http.StatusBadRequest {
+                t.Errorf("expected a non-archive to be refused, got %d", rr.Code)
+        }
+}
+
+func TestPreviewFromDemoCluster(t *testing.T) {
+        h := &Handler{client: k8s.NewSampleDemoCluster()}
+
+        rr := httptest.NewRecorder()
+        h.PreviewHandler(rr, httptest.NewRequest(http.MethodGet, "/api/preview?namespace=default&pvc=web-content&path=/config/site.json", nil))
+
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        if !strings.Contains(rr.Body.String(), `"kind":"json"`) || !strings.Contains(rr.Body.String(), `\"ttl\": 300`) {
+                t.Errorf("expected a pretty-printed JSON preview, got %s", rr.Body.String())
+        }
+}
+
+// failingClient serves everything from a demo cluster except the methods
+// overridden here, which fail with err.
+type failingClient struct {
+        KubeClient
+        err error
+}
+
+func (f *failingClient) ListPVCs(context.Context, string) ([]k8s.PVCInfo, error) {
+        return nil, f.err
+}
+
+func (f *failingClient) ListFiles(context.Context, string, string, string) ([]k8s.FileInfo, error) {
+        return nil, f.err
+}
+
+func (f *failingClient) ResolvePath(context.Context, string, string, string) (*k8s.PathInfo, error) {
+        return nil, f.err
+}
+
+// DownloadFile fails like the real client does: on the first read.
+func (f *failingClient) DownloadFile(context.Context, string, string, string) (io.ReadCloser, string, error) {
+        pr, pw := io.Pipe()
+        pw.CloseWithError(f.err)
+        return pr, "file", nil
+}
+
+func TestReadHandlersWithDemoClient(t *testing.T) {
+        h := &Handler{client: k8s.NewSampleDemoCluster()}
+
+        tests := []struct {
+                name    string
+                handler http.HandlerFunc
+                url     string
+                want    string
+        }{
+                {"namespaces", h.ListNamespacesHandler, "/api/namespaces", `"analytics"`},
+                {"pvcs", h.ListPVCsHandler, "/api/pvcs?namespace=analytics", `"postgres-data"`},
+                {"files", h.ListFilesHandler, "/api/files?namespace=analytics&pvc=notebooks&path=/reports", `"summary.md"`},
+                {"complete", h.CompletePathHandler, "/api/complete?namespace=default&pvc=web-content&prefix=/ht", `"common":"/html/"`},
+                {"resolve", h.ResolvePathHandler, "/api/resolve-path?namespace=default&pvc=web-content&path=/config/site.json", `"navigatePath":"/config"`},
+                {"kubectl", h.KubectlCommandHandler, "/api/kubectl?namespace=default&pvc=web-content&path=/README.md", `--context demo`},
+                {"pods", h.ListPodsHandler, "/api/pods?namespace=default", `"web-content-0"`},
+                {"storage classes", h.StorageClassesHandler, "/api/storage-classes", `"fast-ssd"`},
+                {"preview", h.PreviewHandler, "/api/preview?namespace=analytics&pvc=notebooks&path=/reports/summary.md", `"kind":"markdown"`},
+        }
+        for _, tt := range tests {
+                rr := httptest.NewRecorder()
+                tt.handler(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+                if rr.Code != http.StatusOK {
+                        t.Errorf("%s: expected 200, got %d %s", tt.name, rr.Code, rr.Body.String())
+                        continue
+                }
+                if !strings.Contains(rr.Body.String(), tt.want) {
+                        t.Errorf("%s: expected %s in %s", tt.name, tt.want, rr.Body.String())
+                }
+        }
+}
+
+// forbiddenNamespaces is a client whose user may not list namespaces.
+type forbiddenNamespaces struct {
+        KubeClient
+}
+
+func (forbiddenNamespaces) ListNamespaces(context.Context) ([]string, error) {
+        return nil, &k8s.K8sError{Kind: k8s.ErrKindRBAC, Message: "Permission denied: your kubeconfig cannot list namespaces."}
+}
+
+func TestListNamespacesForbidden(t *testing.T) {
+        h := &Handler{client: forbiddenNamespaces{k8s.NewSampleDemoCluster()}}
+
+        rr := httptest.NewRecorder()
+        h.ListNamespacesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/namespaces", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"namespacesRestricted":true`) || !strings.Contains(rr.Body.String(), `"namespaces":[]`) {
+                t.Fatalf("expected an empty, restricted list, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        // The namespaces can still be used once typed in.
+        rr = httptest.NewRecorder()
+        h.ListPVCsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/pvcs?namespace=default", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "web-content") {
+                t.Errorf("expected the PVCs of a typed-in namespace, got %d %s", rr.Code, rr.Body.String())
+        }
+}
+
+func TestHandlersReportClientErrors(t *testing.T) {
+        notFound := &k8s.K8sError{Kind: k8s.ErrKindPathNotFound, Message: "Path not found inside container."}
+        h := &Handler{client: &failingClient{KubeClient: k8s.NewSampleDemoCluster(), err: notFound}}
+
+        tests := []struct {
+                name    string
+                handler http.HandlerFunc
+                url     string
+        }{
+                {"files", h.ListFilesHandler, "/api/files?namespace=default&pvc=web-content&path=/x"},
+                {"resolve", h.ResolvePathHandler, "/api/resolve-path?namespace=default&pvc=web-content&path=/x"},
+                {"download", h.DownloadFileHandler, "/api/download?namespace=default&pvc=web-content&path=/x"},
+        }
+        for _, tt := range tests {
+                rr := httptest.NewRecorder()
+                tt.handler(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+                if rr.Code == http.StatusOK {
+                        t.Errorf("%s: expected an error status, got 200", tt.name)
+                        continue
+                }
+                var resp map[string]string
+                if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+                        t.Errorf("%s: expected a JSON error: %v", tt.name, err)
+                        continue
+                }
+                if resp["kind"] != string(k8s.ErrKindPathNotFound) {
+                        t.Errorf("%s: expected kind PathNotFound, got %v", tt.name, resp)
+                }
+        }
+
+        rr := httptest.NewRecorder()
+        h.ListPVCsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/pvcs?namespace=default", nil))
+        if rr.Code != http.StatusInternalServerError {
+                t.Errorf("pvcs: expected 500, got %d", rr.Code)
+        }
+}
+
+func TestUseBackendServesConnections(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddNamespace("team-a")
+        h := &Handler{}
+        h.UseBackend(demo)
+
+        rr := httptest.NewRecorder()
+        h.ConnectHandler(rr, httptest.NewRequest(http.MethodPost, "/api/connect", strings.NewReader(`{"context":"whatever"}`)))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"team-a"`) {
+                t.Fatalf("expected to connect to the backend, got %d %s", rr.Code, rr.Body.String())
+        }
+        if h.getClient() != KubeClient(demo) {
+                t.Error("expected the backend to be the current client")
+        }
+}
+
+func TestConnectToLocalDirectories(t *testing.T) {
+        dir := t.TempDir()
+        if err := os.WriteFile(dir+"/notes.txt", []byte("hello"), 0o644); err != nil {
+                t.Fatal(err)
+        }
+        body := `{"backend":{"type":"local","roots":["exports=` + dir + `"]}}`
+        h := &Handler{}
+
+        rr := httptest.NewRecorder()
+        h.ConnectHandler(rr, httptest.NewRequest(http.MethodPost, "/api/connect", strings.NewReader(body)))
+        if rr.Code != http.StatusForbidden || h.getClient() != nil {
+                t.Fatalf("expected remote clients to be refused local directories, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        req := httptest.NewRequest(http.MethodPost, "/api/connect", strings.NewReader(body))
+        req.RemoteAddr = "127.0.0.1:50000"
+        rr = httptest.NewRecorder()
+        h.ConnectHandler(rr, req)
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"local"`) {
+                t.Fatalf("expected to connect, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=local&pvc=exports&path=/", nil))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"notes.txt"`) {
+                t.Errorf("expected the directory listing, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        rr = httptest.NewRecorder()
+        h.StatusHandler(rr, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+        if !strings.Contains(rr.Body.String(), `"backend":"local"`) {
+                t.Errorf("expected the status to report the backend, got %s", rr.Body.String())
+        }
+}
+
+func TestDownloadCompressed(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/a.txt", []byte("hello"))
+        rec := &compressionRecorder{KubeClient: demo}
+        h := &Handler{client: rec}
+
+        rr := httptest.NewRecorder()
+        h.DownloadFileHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download?namespace=default&pvc=data&path=/a.txt&compress=zstd", nil))
+        if rr.Code != http.StatusOK || rr.Body.String() != "hello" || rec.asked != k8s.CompressionZstd {
+                t.Fatalf("expected the file over zstd, got %d %q (%s)", rr.Code, rr.Body.String(), rec.asked)
+        }
+
+        t.Setenv("KUBE_BROWSER_TRANSFER_COMPRESSION", "gzip")
+        rr = httptest.NewRecorder()
+        h.DownloadFileHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download?namespace=default&pvc=data&path=/a.txt", nil))
+        if rec.asked != k8s.CompressionGzip {
+                t.Errorf("expected the configured compression, got %s", rec.asked)
+        }
+
+        rr = httptest.NewRecorder()
+        h.DownloadFileHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download?namespace=default&pvc=data&path=/a.txt&compress=brotli", nil))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected an unknown compression to be refused, got %d", rr.Code)
+        }
+}
+
+// compressionRecorder notes the compression a download asked for.
+type compressionRecorder struct {
+        KubeClient
+        asked k8s.TransferCompression
+}
+
+func (c *compressionRecorder) DownloadFileCompressed(ctx context.Context, namespace, pvcName, filePath string, compression k8s.TransferCompression) (io.ReadCloser, string, error) {
+        c.asked = compression
+        return c.KubeClient.DownloadFile(ctx, namespace, pvcName, filePath)
+}
+
+func TestDownloadToLocalDelta(t *testing.T) {
+        old := make([]byte, 5<<19)
+        rand.New(rand.NewSource(1)).Read(old)
+        // Ten bytes inserted at the start shift every block of the new
+        // file: only the first and the short last one are not in the old.
+        remote := append([]byte("0123456789"), old...)
+        remote = append(remote, "appended"...)
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/dump.sql", remote)
+        destDir := t.TempDir()
+        target := filepath.Join(destDir, "dump.sql")
+        body := fmt.Sprintf(`{"namespace":"default","pvc":"data","path":"/dump.sql","destDir":%q,"overwrite":true,"delta":true}`, destDir)
+
+        save := func(h *Handler) map[string]interface{} {
+                t.Helper()
+                if err := os.WriteFile(target, old, 0o644); err != nil {
+                        t.Fatal(err)
+                }
+                longAgo := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+                os.Chtimes(target, longAgo, longAgo)
+                rr := httptest.NewRecorder()
+                h.DownloadToLocalHandler(rr, httptest.NewRequest(http.MethodPost, "/api/download-local", strings.NewReader(body)))
+                if rr.Code != http.StatusOK {
+                        t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+                }
+                if got, _ := os.ReadFile(target); !bytes.Equal(got, remote) {
+                        t.Fatalf("saved file differs from the remote one (%d bytes)", len(got))
+                }
+                var resp map[string]interface{}
+                json.Unmarshal(rr.Body.Bytes(), &resp)
+                return resp
+        }
+
+        resp := save(&Handler{client: demo})
+        delta, _ := resp["delta"].(map[string]interface{})
+        if delta == nil || delta["blocks"] != 3.0 || delta["reusedBytes"] != float64(1<<20) || delta["transferredBytes"] != float64(len(remote)-1<<20) {
+                t.Errorf("unexpected delta stats %v", resp["delta"])
+        }
+        if info, _ := os.Stat(target); time.Since(info.ModTime()) > time.Minute {
+                t.Errorf("expected the file to get its modification time in the PVC, got %s", info.ModTime())
+        }
+
+        // A file that changes after its signature was read is downloaded
+        // in full instead.
+        resp = save(&Handler{client: &changingBlocks{DemoCluster: demo}})
+        if resp["delta"] != nil || resp["size"] != float64(len(remote)) {
+                t.Errorf("expected a full download, got %v", resp)
+        }
+}
+
+// changingBlocks reads blocks of a file that has changed since its
+// signature.
+type changingBlocks struct {
+        *k8s.DemoCluster
+}
+
+func (c *changingBlocks) ReadFileBlocks(ctx context.Context, namespace, pvcName, filePath string, blockSize, first, count int64, w io.Writer) error {
+        _, err := w.Write(bytes.Repeat([]byte("x"), int(blockSize)))
+        return err
+}
+
+func TestDownloadDirStreamsArchive(t *testing.T) {
+        h := &Handler{client: k8s.NewSampleDemoCluster()}
+
+        rr := httptest.NewRecorder()
+        h.DownloadDirHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download-dir?namespace=default&pvc=web-content&path=/html", nil))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, `html.tar.gz`) {
+                t.Errorf("unexpected Content-Disposition %q", got)
+        }
+        gz, err := gzip.NewReader(rr.Body)
+        if err != nil {
+                t.Fatalf("expected a gzip stream: %v", err)
+        }
+        tr := tar.NewReader(gz)
+        var names []string
+        for {
+                hdr, err := tr.Next()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        t.Fatal(err)
+                }
+                names = append(names, hdr.Name)
+        }
+        if got := strings.Join(names, ","); got != "html/,html/about.html,html/index.html" {
+                t.Errorf("unexpected entries %q", got)
+        }
+
+        rr = httptest.NewRecorder()
+        h.DownloadDirHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download-dir?namespace=default&pvc=web-content&path=/html&exclude=about.*", nil))
+        gz, err = gzip.NewReader(rr.Body)
+        if err != nil {
+                t.Fatalf("expected a gzip stream: %v", err)
+        }
+        tr = tar.NewReader(gz)
+        names = nil
+        for {
+                hdr, err := tr.Next()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        t.Fatal(err)
+                }
+                names = append(names, hdr.Name)
+        }
+        if got := strings.Join(names, ","); got != "html/,html/index.html" {
+                t.Errorf("expected about.html to be excluded, got %q", got)
+        }
+
+        for url, want := range map[string]int{
+                "/api/download-dir?namespace=default&pvc=web-content&path=/missing":   http.StatusNotFound,
+                "/api/download-dir?namespace=default&pvc=web-content&path=/README.md": http.StatusBadRequest,
+                "/api/download-dir?namespace=default&pvc=web-content&path=/html&exclude=!keep": http.StatusBadRequest,
+        } {
+                rr := httptest.NewRecorder()
+                h.DownloadDirHandler(rr, httptest.NewRequest(http.MethodGet, url, nil))
+                if rr.Code != want {
+                        t.Errorf("%s: expected %d, got %d", url, want, rr.Code)
+                }
+        }
+}
+
+// waitForJob polls a job until it finishes.
+func waitForJob(t *testing.T, h *Handler, id string) jobs.Job {
+        t.Helper()
+        deadline := time.Now().Add(5 * time.Second)
+        for time.Now().Before(deadline) {
+                if job, ok := h.getJobs().Get(id); ok && job.State.Finished() {
+                        return job
+                }
+                time.Sleep(10 * time.Millisecond)
+        }
+        t.Fatalf("job %s did not finish", id)
+        return jobs.Job{}
+}
+
+func TestTransferBetweenPanes(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        dir := t.TempDir()
+        demo := k8s.NewSampleDemoCluster()
+        h := &Handler{client: demo}
+
+        req := httptest.NewRequest(http.MethodPost, "/api/panes", strings.NewReader(`{"backend":{"type":"local","roots":["backup=`+dir+`"]}}`))
+        req.RemoteAddr = "127.0.0.1:50000"
+        rr := httptest.NewRecorder()
+        h.PanesHandler(rr, req)
+        var opened struct {
+                Pane paneInfo `json:"pane"`
+        }
+        if err := json.NewDecoder(rr.Body).Decode(&opened); err != nil || rr.Code != http.StatusOK || opened.Pane.Type != "local" {
+                t.Fatalf("expected a local pane, got %d %+v (%v)", rr.Code, opened, err)
+        }
+        pane := opened.Pane.ID
+
+        rr = httptest.NewRecorder()
+        h.PanesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/panes", nil))
+        if !strings.Contains(rr.Body.String(), `"id":"main","type":"kubernetes"`) || !strings.Contains(rr.Body.String(), pane) {
+                t.Errorf("expected both panes to be listed, got %s", rr.Body.String())
+        }
+
+        transfer := func(body string) jobs.Job {
+                t.Helper()
+                rr := httptest.NewRecorder()
+                h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer", strings.NewReader(body)))
+                var job jobs.Job
+                if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+                        t.Fatalf("expected the transfer to be queued, got %d (%v)", rr.Code, err)
+                }
+                return waitForJob(t, h, job.ID)
+        }
+
+        job := transfer(`{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},
+                "destination":{"pane":"` + pane + `","namespace":"local","pvc":"backup","dir":"/site"},"compress":"zstd"}`)
+        if job.State != jobs.StateSucceeded || !strings.Contains(string(job.Result), `"files":2`) {
+                t.Fatalf("expected the copy to succeed, got %+v", job)
+        }
+        if got, err := os.ReadFile(dir + "/site/html/about.html"); err != nil || !strings.Contains(string(got), "About this demo") {
+                t.Fatalf("expected the directory under its own name in the pane, got %q, %v", got, err)
+        }
+
+        rr = httptest.NewRecorder()
+        h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?pane="+pane+"&namespace=local&pvc=backup&path=/site/html", nil))
+        if !strings.Contains(rr.Body.String(), `"index.html"`) {
+                t.Errorf("expected the pane to be browsable, got %d %s", rr.Code, rr.Body.String())
+        }
+
+        job = transfer(`{"source":{"pane":"` + pane + `","namespace":"local","pvc":"backup","paths":["/site/html/index.html"]},
+                "destination":{"namespace":"analytics","pvc":"notebooks","dir":"/imported"}}`)
+        if job.State != jobs.StateSucceeded {
+                t.Fatalf("expected the copy back to succeed, got %+v", job)
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "analytics", "notebooks", "/imported/index.html", 100)
+        if err != nil || !strings.Contains(string(data), "Hello from KubeBrowser") {
+                t.Errorf("expected the file in the cluster, got %q, %v", data, err)
+        }
+
+        for _, body := range []string{
+                `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},"destination":{"pane":"` + pane + `","namespace":"local","pvc":"backup"},"mode":"move"}`,
+                `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},"destination":{"namespace":"default","pvc":"web-content","dir":"/html/copy"}}`,
+                `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},"destination":{"pane":"p-closed","namespace":"local","pvc":"backup"}}`,
+                `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},"destination":{"namespace":"analytics","pvc":"notebooks"},"mode":"move","exclude":["*.tmp"]}`,
+                `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},"destination":{"namespace":"analytics","pvc":"notebooks"},"compress":"brotli"}`,
+        } {
+                rr := httptest.NewRecorder()
+                h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer", strings.NewReader(body)))
+                if rr.Code == http.StatusAccepted {
+                        t.Errorf("expected %s to be refused", body)
+                }
+        }
+
+        rr = httptest.NewRecorder()
+        h.PanesHandler(rr, httptest.NewRequest(http.MethodDelete, "/api/panes?id="+pane, nil))
+        if rr.Code != http.StatusOK || h.paneClient(pane) != nil {
+                t.Errorf("expected the pane to be closed, got %d %s", rr.Code, rr.Body.String())
+        }
+}
+
+func TestTransferBetweenClusters(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	source := k8s.NewSampleDemoCluster()
+	target := k8s.NewSampleDemoCluster()
+	h := &Handler{client: source, panes: map[string]KubeClient{"p-target": target}}
+
+	rr := httptest.NewRecorder()
+	h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer", strings.NewReader(
+		`{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},
+		"destination":{"pane":"p-target","namespace":"analytics","pvc":"notebooks","dir":"/migrated"}}`)))
+	var job jobs.Job
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the transfer to be queued, got %d (%v)", rr.Code, err)
+	}
+	if job = waitForJob(t, h, job.ID); job.State != jobs.StateSucceeded {
+		t.Fatalf("expected the copy to succeed, got %+v", job)
+	}
+	data, _, err := target.ReadFileHead(context.Background(), "analytics", "notebooks", "/migrated/html/index.html", 100)
+	if err != nil || !strings.Contains(string(data), "Hello from KubeBrowser") {
+		t.Errorf("expected the file in the other cluster, got %q, %v", data, err)
+	}
+	if _, _, err := source.ReadFileHead(context.Background(), "analytics", "notebooks", "/migrated/html/index.html", 100); err == nil {
+		t.Error("expected the source cluster to be left alone")
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"cluster":{"context":"other"},"backend":{"type":"local"}}`,
+		`{"cluster":{"context":"other","registryMirror":"not a mirror"}}`,
+	} {
+		rr := httptest.NewRecorder()
+		h.PanesHandler(rr, httptest.NewRequest(http.MethodPost, "/api/panes", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused, got %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestTransferPreservesMetadata(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	src, dst := t.TempDir(), t.TempDir()
+	stamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0o644)
+	os.Chmod(filepath.Join(src, "run.sh"), 0o750)
+	os.Chtimes(filepath.Join(src, "run.sh"), stamp, stamp)
+	demo := k8s.NewSampleDemoCluster()
+	h := &Handler{client: demo}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/panes", strings.NewReader(`{"backend":{"type":"local","roots":["src=`+src+`","dst=`+dst+`"]}}`))
+	req.RemoteAddr = "127.0.0.1:50000"
+	rr := httptest.NewRecorder()
+	h.PanesHandler(rr, req)
+	var opened struct {
+		Pane paneInfo `json:"pane"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&opened); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected a local pane, got %d (%v)", rr.Code, err)
+	}
+	pane := opened.Pane.ID
+
+	copyTo := func(dest, extra string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer", strings.NewReader(
+			`{"source":{"pane":"`+pane+`","namespace":"local","pvc":"src","paths":["/run.sh"]},"destination":`+dest+extra+`}`)))
+		var job jobs.Job
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+			t.Fatalf("expected the transfer to be queued, got %d (%v)", rr.Code, err)
+		}
+		if job = waitForJob(t, h, job.ID); job.State != jobs.StateSucceeded {
+			t.Fatalf("expected the copy to succeed, got %+v", job)
+		}
+	}
+
+	copyTo(`{"pane":"`+pane+`","namespace":"local","pvc":"dst","dir":"/kept"}`, "")
+	if info, err := os.Stat(filepath.Join(dst, "kept", "run.sh")); err != nil || info.Mode().Perm() != 0o750 || !info.ModTime().Equal(stamp) {
+		t.Errorf("expected the mode and mtime to be kept, got %v", info)
+	}
+	copyTo(`{"pane":"`+pane+`","namespace":"local","pvc":"dst","dir":"/plain"}`, `,"preserve":false`)
+	if info, err := os.Stat(filepath.Join(dst, "plain", "run.sh")); err != nil || info.Mode().Perm() != 0o644 || time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("expected a plain copy, got %v", info)
+	}
+
+	copyTo(`{"namespace":"analytics","pvc":"notebooks","dir":"/bin"}`, "")
+	files, err := demo.ListFiles(context.Background(), "analytics", "notebooks", "/bin")
+	if err != nil || len(files) != 1 || files[0].Mode != "-rwxr-x---" || !strings.HasPrefix(files[0].ModTime, "2024-03-01") {
+		t.Errorf("expected the mode and mtime in the PVC, got %+v, %v", files, err)
+	}
+
+	rr = httptest.NewRecorder()
+	h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer", strings.NewReader(
+		`{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},"destination":{"namespace":"analytics","pvc":"notebooks"},"mode":"move","preserve":false}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a move without preserve to be refused, got %d", rr.Code)
+	}
+}
+
+func TestScheduledTransfer(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	source := k8s.NewSampleDemoCluster()
+	target := k8s.NewSampleDemoCluster()
+	h := &Handler{client: source, panes: map[string]KubeClient{"p-target": target}}
+	const body = `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},
+		"destination":{"pane":"p-target","namespace":"analytics","pvc":"notebooks","dir":"/nightly"}}`
+
+	rr := httptest.NewRecorder()
+	h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer?at=02:00", strings.NewReader(body)))
+	var job jobs.Job
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the transfer to be scheduled, got %d (%v)", rr.Code, err)
+	}
+	if job.State != jobs.StateScheduled || job.StartAt.Hour() != 2 || time.Until(job.StartAt) > 24*time.Hour {
+		t.Errorf("expected the transfer to wait for the next 02:00, got %s at %s", job.State, job.StartAt)
+	}
+	if _, _, err := target.ReadFileHead(context.Background(), "analytics", "notebooks", "/nightly/html/index.html", 100); err == nil {
+		t.Error("expected nothing to be copied before the start time")
+	}
+
+	rr = httptest.NewRecorder()
+	h.JobsHandler(rr, httptest.NewRequest(http.MethodPost, "/api/jobs?id="+job.ID+"&action=cancel", nil))
+	if job = waitForJob(t, h, job.ID); job.State != jobs.StateCanceled {
+		t.Errorf("expected the scheduled transfer to be canceled, got %s", job.State)
+	}
+
+	for _, at := range []string{"25:00", "tonight", "2001-01-01T02:00:00Z"} {
+		rr := httptest.NewRecorder()
+		h.TransferHandler(rr, httptest.NewRequest(http.MethodPost, "/api/transfer?at="+at, strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected at=%s to be refused, got %d %s", at, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestFileContentHandler(t *testing.T) {
+	demo := k8s.NewSampleDemoCluster()
+	h := &Handler{client: demo}
+	const url = "/api/file/content?namespace=default&pvc=web-content&path=/html/index.html"
+
+	rr := httptest.NewRecorder()
+	h.FileContentHandler(rr, httptest.NewRequest(http.MethodGet, url, nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" || !strings.Contains(rr.Body.String(), "Hello from KubeBrowser") {
+		t.Fatalf("expected the file text, got %d %q (etag %q)", rr.Code, rr.Body.String(), etag)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, url, strings.NewReader("<h1>edited</h1>\n"))
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	h.FileContentHandler(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Fatalf("expected the save to succeed with a new etag, got %d %s", rr.Code, rr.Body.String())
+	}
+	data, _, _ := demo.ReadFileHead(context.Background(), "default", "web-content", "/html/index.html", 100)
+	if string(data) != "<h1>edited</h1>\n" {
+		t.Errorf("expected the edited text on the PVC, got %q", data)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, url, strings.NewReader("stale"))
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	h.FileContentHandler(rr, req)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected a stale save to be refused, got %d", rr.Code)
+	}
+
+	demo.WriteFile("default", "web-content", "/blob.bin", []byte{0x89, 'P', 'N', 'G', 0})
+	rr = httptest.NewRecorder()
+	h.FileContentHandler(rr, httptest.NewRequest(http.MethodGet, "/api/file/content?namespace=default&pvc=web-content&path=/blob.bin", nil))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a binary file to be refused, got %d", rr.Code)
+	}
+
+	h.readOnly = true
+	rr = httptest.NewRecorder()
+	h.FileContentHandler(rr, httptest.NewRequest(http.MethodPut, url, strings.NewReader("x")))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected saves to be refused in read-only mode, got %d", rr.Code)
+	}
+}
+
+func TestDeleteHandler(t *testing.T) {
+        demo := k8s.NewSampleDemoCluster()
+        h := &Handler{client: demo}
+
+        del := func(body string) *httptest.ResponseRecorder {
+                rr := httptest.NewRecorder()
+                h.DeleteHandler(rr, httptest.NewRequest(http.MethodPost, "/api/delete", strings.NewReader(body)))
+                return rr
+        }
+
+        if rr := del(`{"namespace":"default","pvc":"web-content","path":"/html/about.html"}`); rr.Code != http.StatusOK {
+                t.Fatalf("expected the file to be deleted, got %d %s", rr.Code, rr.Body.String())
+        }
+        if _, _, err := demo.ReadFileHead(context.Background(), "default", "web-content", "/html/about.html", 10); err == nil {
+                t.Error("expected the file to be gone")
+        }
+
+        for body, want := range map[string]int{
+                `{"namespace":"default","pvc":"web-content","path":"/html"}`:                            http.StatusInternalServerError,
+                `{"namespace":"default","pvc":"web-content","path":"/html","isDir":true}`:               http.StatusInternalServerError,
+                `{"namespace":"default","pvc":"web-content","path":"/","isDir":true,"recursive":true}`:  http.StatusBadRequest,
+                `{"namespace":"default","pvc":"web-content","path":"/..","isDir":true,"recursive":true}`: http.StatusBadRequest,
+        } {
+                if rr := del(body); rr.Code != want {
+                        t.Errorf("%s: expected %d, got %d %s", body, want, rr.Code, rr.Body.String())
+                }
+        }
+
+        if rr := del(`{"namespace":"default","pvc":"web-content","path":"/html","isDir":true,"recursive":true}`); rr.Code != http.StatusOK {
+                t.Fatalf("expected the directory to be deleted, got %d %s", rr.Code, rr.Body.String())
+        }
+        if files, err := demo.ListFiles(context.Background(), "default", "web-content", "/"); err != nil || len(files) != 2 {
+                t.Errorf("expected README.md and config to remain, got %+v, %v", files, err)
+        }
+
+        h.readOnly = true
+        if rr := del(`{"namespace":"default","pvc":"web-content","path":"/README.md"}`); rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected read-only mode to refuse deletes, got %d", rr.Code)
+        }
+}
+
+func TestTrash(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_TRASH", "true")
+	demo := k8s.NewSampleDemoCluster()
+	h := &Handler{client: demo}
+	ctx := context.Background()
+	post := func(handler http.HandlerFunc, url, body string) (int, map[string]interface{}) {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		var resp map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+	list := func() []trashEntry {
+		rr := httptest.NewRecorder()
+		h.TrashHandler(rr, httptest.NewRequest(http.MethodGet, "/api/trash?namespace=default&pvc=web-content", nil))
+		var resp struct {
+			Entries []trashEntry `json:"entries"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return resp.Entries
+	}
+
+	if entries := list(); len(entries) != 0 {
+		t.Fatalf("expected an empty trash, got %+v", entries)
+	}
+	code, resp := post(h.DeleteHandler, "/api/delete", `{"namespace":"default","pvc":"web-content","path":"/html","isDir":true,"recursive":true}`)
+	if code != http.StatusOK || resp["trashed"] == nil {
+		t.Fatalf("expected /html to go to the trash, got %d %v", code, resp)
+	}
+	if _, _, err := demo.ReadFileHead(ctx, "default", "web-content", "/html/about.html", 10); err == nil {
+		t.Error("expected /html to be gone")
+	}
+	// A stale listing still cannot trash a directory as a file.
+	if code, _ := post(h.DeleteHandler, "/api/delete", `{"namespace":"default","pvc":"web-content","path":"/config"}`); code != http.StatusInternalServerError {
+		t.Errorf("expected a directory deleted as a file to be refused, got %d", code)
+	}
+	entries := list()
+	if len(entries) != 1 || entries[0].Path != "/html" || !entries[0].IsDir || entries[0].ExpiresAt == nil {
+		t.Fatalf("expected /html in the trash, got %+v", entries)
+	}
+
+	// Restoring onto a path taken since is refused, and works elsewhere.
+	demo.WriteFile("default", "web-content", "/html/new.html", []byte("new"))
+	restore := `{"namespace":"default","pvc":"web-content","id":"` + entries[0].ID + `"}`
+	if code, resp := post(h.TrashRestoreHandler, "/api/trash/restore", restore); code != http.StatusConflict {
+		t.Errorf("expected the restore to be refused, got %d %v", code, resp)
+	}
+	restore = `{"namespace":"default","pvc":"web-content","id":"` + entries[0].ID + `","to":"/html-old"}`
+	if code, resp := post(h.TrashRestoreHandler, "/api/trash/restore", restore); code != http.StatusOK || resp["restored"] != "/html-old" {
+		t.Fatalf("expected /html to be restored as /html-old, got %d %v", code, resp)
+	}
+	if _, _, err := demo.ReadFileHead(ctx, "default", "web-content", "/html-old/about.html", 10); err != nil {
+		t.Errorf("expected about.html back, got %v", err)
+	}
+	if entries := list(); len(entries) != 0 {
+		t.Errorf("expected the restored entry to leave the trash, got %+v", entries)
+	}
+
+	// Deleting inside the trash, or with permanent, removes for good.
+	post(h.DeleteHandler, "/api/delete", `{"namespace":"default","pvc":"web-content","path":"/README.md"}`)
+	if code, resp := post(h.DeleteHandler, "/api/delete", `{"namespace":"default","pvc":"web-content","path":"/html/new.html","permanent":true}`); code != http.StatusOK || resp["trashed"] != nil {
+		t.Errorf("expected a permanent delete, got %d %v", code, resp)
+	}
+	if entries := list(); len(entries) != 1 || entries[0].Path != "/README.md" {
+		t.Fatalf("expected only README.md in the trash, got %+v", entries)
+	}
+	if code, resp := post(h.TrashPurgeHandler, "/api/trash/purge", `{"namespace":"default","pvc":"web-content","id":"../html-old"}`); code != http.StatusBadRequest {
+		t.Errorf("expected an id outside the trash to be refused, got %d %v", code, resp)
+	}
+	if code, resp := post(h.TrashPurgeHandler, "/api/trash/purge", `{"namespace":"default","pvc":"web-content"}`); code != http.StatusOK || resp["purged"] != float64(0) {
+		t.Errorf("expected nothing to have expired, got %d %v", code, resp)
+	}
+	if code, resp := post(h.TrashPurgeHandler, "/api/trash/purge", `{"namespace":"default","pvc":"web-content","all":true}`); code != http.StatusOK || resp["purged"] != float64(1) {
+		t.Errorf("expected the trash to be emptied, got %d %v", code, resp)
+	}
+	if entries := list(); len(entries) != 0 {
+		t.Errorf("expected an empty trash, got %+v", entries)
+	}
+
+	// Listing leaves entries past the retention alone; a purge removes them.
+	demo.WriteFile("default", "web-content", trashDir+"/20200101T000000Z-0123abcd/item", []byte("old"))
+	demo.WriteFile("default", "web-content", trashDir+"/20200101T000000Z-0123abcd/info.json", []byte(`{"path":"/old"}`))
+	if entries := list(); len(entries) != 1 {
+		t.Errorf("expected the expired entry to be listed until purged, got %+v", entries)
+	}
+	if code, resp := post(h.TrashPurgeHandler, "/api/trash/purge", `{"namespace":"default","pvc":"web-content"}`); code != http.StatusOK || resp["purged"] != float64(1) {
+		t.Errorf("expected the expired entry to be purged, got %d %v", code, resp)
+	}
+
+	// A planted info.json cannot send a restore out of the volume, and
+	// nothing but a delete writes into the trash.
+	demo.WriteFile("default", "web-content", trashDir+"/20990101T000000Z-0123abcd/item", []byte("planted"))
+	demo.WriteFile("default", "web-content", trashDir+"/20990101T000000Z-0123abcd/info.json", []byte(`{"path":"/../../../etc/cron.d/x"}`))
+	restore = `{"namespace":"default","pvc":"web-content","id":"20990101T000000Z-0123abcd"}`
+	if code, resp := post(h.TrashRestoreHandler, "/api/trash/restore", restore); code != http.StatusOK || resp["restored"] != "/etc/cron.d/x" {
+		t.Errorf("expected the restore to stay on the volume, got %d %v", code, resp)
+	}
+	rr := httptest.NewRecorder()
+	h.FileContentHandler(rr, httptest.NewRequest(http.MethodPut, "/api/file/content?namespace=default&pvc=web-content&path="+trashDir+"/20990101T000000Z-0123abcd/info.json", strings.NewReader("{}")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a write into the trash to be refused, got %d", rr.Code)
+	}
+	if code, _ := post(h.MoveHandler, "/api/move", `{"namespace":"default","pvc":"web-content","from":"/etc","to":"/.kube-browser-trash/20990101T000000Z-0123abcd"}`); code != http.StatusBadRequest {
+		t.Errorf("expected a rename into the trash to be refused, got %d", code)
+	}
+}
+
+func TestEstimateHandler(t *testing.T) {
+        demo := k8s.NewSampleDemoCluster()
+        h := &Handler{client: demo}
+
+        estimate := func() transferEstimate {
+                t.Helper()
+                rr := httptest.NewRecorder()
+                h.EstimateHandler(rr, httptest.NewRequest(http.MethodPost, "/api/estimate",
+                        strings.NewReader(`{"namespace":"default","pvc":"web-content","paths":["/html","/README.md"]}`)))
+                var est transferEstimate
+                if err := json.NewDecoder(rr.Body).Decode(&est); err != nil || rr.Code != http.StatusOK {
+                        t.Fatalf("expected an estimate, got %d (%v)", rr.Code, err)
+                }
+                return est
+        }
+
+        est := estimate()
+        if est.Files != 3 || est.Bytes == 0 || est.Measured || est.BytesPerSecond != assumedThroughput || est.Recommendation != "exec" {
+                t.Errorf("unexpected estimate before any transfer: %+v", est)
+        }
+
+        // Small transfers say little about bandwidth and are ignored.
+        h.throughput.record(demo, 1024, time.Millisecond)
+        if est := estimate(); est.Measured {
+                t.Errorf("expected a tiny transfer not to count, got %+v", est)
+        }
+
+        demo.WriteFile("default", "web-content", "/html/video.mp4", make([]byte, 8<<20))
+        h.throughput.record(demo, 1<<20, time.Hour)
+        est = estimate()
+        if !est.Measured || est.Samples != 1 || est.Recommendation != "job" || est.Note == "" {
+                t.Errorf("expected a slow connection to recommend a Job, got %+v", est)
+        }
+}
+
+func TestMoveHandlerRenames(t *testing.T) {
+        demo := k8s.NewSampleDemoCluster()
+        h := &Handler{client: demo}
+
+        move := func(body string) *httptest.ResponseRecorder {
+                rr := httptest.NewRecorder()
+                h.MoveHandler(rr, httptest.NewRequest(http.MethodPost, "/api/move", strings.NewReader(body)))
+                return rr
+        }
+
+        if rr := move(`{"namespace":"default","pvc":"web-content","from":"/html","to":"/public/site"}`); rr.Code != http.StatusOK {
+                t.Fatalf("expected the rename to succeed, got %d %s", rr.Code, rr.Body.String())
+        }
+        if data, _, err := demo.ReadFileHead(context.Background(), "default", "web-content", "/public/site/index.html", 100); err != nil || !strings.Contains(string(data), "Hello") {
+                t.Errorf("expected the directory under its new name, got %q, %v", data, err)
+        }
+        if _, err := demo.ListFiles(context.Background(), "default", "web-content", "/html"); err == nil {
+                t.Error("expected the old name to be gone")
+        }
+
+        for body, want := range map[string]int{
+                `{"namespace":"default","pvc":"web-content","from":"/README.md","to":"/config"}`:  http.StatusInternalServerError,
+                `{"namespace":"default","pvc":"web-content","from":"/","to":"/backup"}`:           http.StatusBadRequest,
+                `{"namespace":"default","pvc":"web-content","from":"/config"}`:                    http.StatusBadRequest,
+                `{"namespace":"default","pvc":"web-content","from":"/config","to":"/config/old"}`: http.StatusInternalServerError,
+        } {
+                if rr := move(body); rr.Code != want {
+                        t.Errorf("%s: expected %d, got %d %s", body, want, rr.Code, rr.Body.String())
+                }
+        }
+}
+
+func TestHelperEventsHandler(t *testing.T) {
+        h := &Handler{}
+        feed := h.getHelperFeed()
+        feed.publish(k8s.HelperEvent{Namespace: "default", PVC: "data", Reason: "Pulling", Message: `Pulling image "alpine:3.19"`})
+        feed.publish(k8s.HelperEvent{Namespace: "default", PVC: "other", Reason: "Scheduled"})
+
+        rr := httptest.NewRecorder()
+        h.HelperEventsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/helper-events?pvc=data", nil))
+        var got struct {
+                Events []helperEvent `json:"events"`
+                Last   int64         `json:"last"`
+        }
+        if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || len(got.Events) != 1 || got.Events[0].Reason != "Pulling" || got.Last != 2 {
+                t.Fatalf("expected the PVC's event, got %+v (%v)", got, err)
+        }
+
+        ctx, cancel := context.WithCancel(context.Background())
+        req := httptest.NewRequest(http.MethodGet, "/api/helper-events?since=1", nil).WithContext(ctx)
+        req.Header.Set("Accept", "text/event-stream")
+        rr = httptest.NewRecorder()
+        done := make(chan struct{})
+        go func() {
+                h.HelperEventsHandler(rr, req)
+                close(done)
+        }()
+        time.Sleep(20 * time.Millisecond)
+        feed.publish(k8s.HelperEvent{Namespace: "default", PVC: "data", Reason: "Started"})
+        time.Sleep(20 * time.Millisecond)
+        cancel()
+        <-done
+        body := rr.Body.String()
+        if !strings.Contains(body, "id: 2\ndata: ") || !strings.Contains(body, "id: 3\ndata: ") || strings.Contains(body, "Pulling") {
+                t.Errorf("expected events 2 and 3 to be streamed, got %q", body)
+        }
+
+        rr = httptest.NewRecorder()
+        h.HelperEventsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/helper-events?since=x", nil))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected 400 for a bad id, got %d", rr.Code)
+        }
+}
+
+func TestPVCEvents(t *testing.T) {
+	var posted []pvcWebhookPayload
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p pvcWebhookPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		posted = append(posted, p)
+	}))
+	defer hook.Close()
+
+	h := &Handler{}
+	t.Setenv(pvcWebhookEnv, "ftp://example.com/hook")
+	if err := h.LoadPVCWebhook(); err == nil {
+		t.Error("expected a non-HTTP webhook to be refused")
+	}
+	t.Setenv(pvcWebhookEnv, hook.URL)
+	if err := h.LoadPVCWebhook(); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := h.getPVCFeed()
+	if !feed.watch("prod", "apps", "data-clone") || feed.watch("prod", "apps", "data-clone") {
+		t.Error("expected a claim to be watched once")
+	}
+	rr := httptest.NewRecorder()
+	h.PVCEventsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/pvc-events?namespace=apps", nil))
+	var got struct {
+		Events  []pvcEvent     `json:"events"`
+		Last    int64          `json:"last"`
+		Pending []pendingClaim `json:"pending"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || len(got.Events) != 0 || len(got.Pending) != 1 || got.Pending[0].PVC != "data-clone" {
+		t.Fatalf("expected the claim to be pending, got %+v (%v)", got, err)
+	}
+
+	h.reportClaim("prod", "apps", "data-clone", &k8s.PVCBinding{Context: "prod", Namespace: "apps", PVC: "data-clone", Phase: "Bound", Volume: "pvc-123"})
+	rr = httptest.NewRecorder()
+	h.PVCEventsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/pvc-events?namespace=apps", nil))
+	got.Pending = nil
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || len(got.Events) != 1 || got.Events[0].Volume != "pvc-123" || got.Last != 1 || len(got.Pending) != 0 {
+		t.Fatalf("expected the claim to be reported bound, got %+v (%v)", got, err)
+	}
+	if len(posted) != 1 || posted[0].Event != "pvc.bound" || posted[0].PVC != "data-clone" || !strings.Contains(posted[0].Message, "bound to pvc-123") {
+		t.Errorf("expected the webhook to be told, got %+v", posted)
+	}
+
+	rr = httptest.NewRecorder()
+	h.PVCEventsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/pvc-events?namespace=other", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || len(got.Events) != 0 {
+		t.Errorf("expected other namespaces to be filtered out, got %+v", got)
+	}
+}
+
+func TestExportListing(t *testing.T) {
+	demo := k8s.NewDemoCluster()
+	demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+	demo.WriteFile("default", "data", "/reports/q1.csv", []byte("a,b\n"))
+	demo.WriteFile("default", "data", "/reports/2024/=SUM(A1).txt", []byte("x"))
+	demo.WriteFile("default", "data", "/notes.txt", []byte("hello"))
+	h := &Handler{client: demo}
+
+	rr := httptest.NewRecorder()
+	h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&path=/reports&export=csv&recursive=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the export, got %d %s", rr.Code, rr.Body.String())
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, "data-reports-listing.csv") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 4 || lines[0] != "path,name,type,size,modTime,mode,uid,gid,linkTarget" ||
+		!strings.HasPrefix(lines[1], "/reports/2024,2024,dir,") || !strings.HasPrefix(lines[2], "/reports/2024/=SUM(A1).txt,'=SUM(A1).txt,file,1,") ||
+		!strings.HasPrefix(lines[3], "/reports/q1.csv,q1.csv,file,4,") {
+		t.Errorf("unexpected CSV %q", lines)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&path=/&export=json&filter=*.txt", nil))
+	var got listingExport
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || got.Recursive || got.Count != 1 || got.Files[0].Name != "notes.txt" {
+		t.Errorf("expected the root's text files, got %+v (%v)", got, err)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ListFilesHandler(rr, httptest.NewRequest(http.MethodGet, "/api/files?namespace=default&pvc=data&export=xml", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rr.Code)
+	}
+}
+
+func TestRawFile(t *testing.T) {
+        t.Setenv(rawTokenEnv, "s3cret")
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/reports/q 1.json", []byte(`{"a":1}`))
+        demo.WriteFile("default", "data", "/reports/blob", []byte("%PDF-1.4 ..."))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.RawFileHandler(rr, httptest.NewRequest(http.MethodGet, "/raw/main/default/data/reports/q%201.json", nil))
+        if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+                t.Fatalf("expected 401 without a token, got %d", rr.Code)
+        }
+
+        req := httptest.NewRequest(http.MethodGet, "/raw/main/default/data/reports/q%201.json", nil)
+        req.Header.Set("Authorization", "Bearer s3cret")
+        rr = httptest.NewRecorder()
+        h.RawFileHandler(rr, req)
+        if rr.Code != http.StatusOK || rr.Body.String() != `{"a":1}` {
+                t.Fatalf("expected the file, got %d %s", rr.Code, rr.Body.String())
+        }
+        if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+                t.Errorf("unexpected Content-Type %q", ct)
+        }
+        if cd := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "inline") {
+                t.Errorf("unexpected Content-Disposition %q", cd)
+        }
+
+        req = httptest.NewRequest(http.MethodHead, "/raw/main/default/data/reports/blob", nil)
+        req.SetBasicAuth("any", "s3cret")
+        rr = httptest.NewRecorder()
+        h.RawFileHandler(rr, req)
+        if rr.Code != http.StatusOK || rr.Body.Len() != 0 || rr.Header().Get("Content-Type") != "application/pdf" {
+                t.Errorf("expected a sniffed type and no body, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+        }
+
+        rr = httptest.NewRecorder()
+        h.RawURLHandler(rr, httptest.NewRequest(http.MethodGet, "/api/raw-url?namespace=default&pvc=data&path=/reports/q%201.json", nil))
+        var resp struct {
+                URL string `json:"url"`
+        }
+        json.NewDecoder(rr.Body).Decode(&resp)
+        if resp.URL != "http://example.com/raw/main/default/data/reports/q%201.json?token=s3cret" {
+                t.Fatalf("unexpected URL %q", resp.URL)
+        }
+        rr = httptest.NewRecorder()
+        h.RawFileHandler(rr, httptest.NewRequest(http.MethodGet, resp.URL, nil))
+        if rr.Code != http.StatusOK {
+                t.Errorf("expected the copied URL to work, got %d", rr.Code)
+        }
+}
+
+func TestDownloadBatch(t *testing.T) {
+        h := &Handler{client: k8s.NewSampleDemoCluster()}
+
+        rr := httptest.NewRecorder()
+        h.DownloadBatchHandler(rr, httptest.NewRequest(http.MethodPost, "/api/download-batch", strings.NewReader(`{"namespace":"default","pvc":"web-content","paths":["/html/index.html","/html/about.html"]}`)))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+        }
+        if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, `web-content.tar.gz`) {
+                t.Errorf("unexpected Content-Disposition %q", got)
+        }
+        gz, err := gzip.NewReader(rr.Body)
+        if err != nil {
+                t.Fatalf("expected a gzip stream: %v", err)
+        }
+        tr := tar.NewReader(gz)
+        var names []string
+        for {
+                hdr, err := tr.Next()
+                if err == io.EOF {
+                        break
+                }
+                if err != nil {
+                        t.Fatal(err)
+                }
+                names = append(names, hdr.Name)
+        }
+        if got := strings.Join(names, ","); got != "html/index.html,html/about.html" {
+                t.Errorf("unexpected entries %q", got)
+        }
+
+        // The UI submits a form so the browser handles the download.
+        form := url.Values{"request": {`{"namespace":"default","pvc":"web-content","paths":["/html"],"format":"zip","name":"site"}`}}
+        req := httptest.NewRequest(http.MethodPost, "/api/download-batch", strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        rr = httptest.NewRecorder()
+        h.DownloadBatchHandler(rr, req)
+        if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+                t.Fatalf("expected a zip, got %d %s", rr.Code, rr.Body.String())
+        }
+        if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, `site.zip`) {
+                t.Errorf("unexpected Content-Disposition %q", got)
+        }
+        zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+        if err != nil {
+                t.Fatalf("expected a zip archive: %v", err)
+        }
+        names = nil
+        for _, f := range zr.File {
+                names = append(names, f.Name)
+        }
+        if got := strings.Join(names, ","); got != "html/,html/about.html,html/index.html" {
+                t.Errorf("unexpected zip entries %q", got)
+        }
+        rc, err := zr.File[2].Open()
+        if err != nil {
+                t.Fatal(err)
+        }
+        data, _ := io.ReadAll(rc)
+        if !strings.Contains(string(data), "Hello from KubeBrowser") {
+                t.Errorf("unexpected index.html contents %q", data)
+        }
+
+        for _, body := range []string{
+                `{"namespace":"default","pvc":"web-content","paths":[]}`,
+                `{"namespace":"default","pvc":"web-content","paths":["/html"],"format":"rar"}`,
+        } {
+                rr = httptest.NewRecorder()
+                h.DownloadBatchHandler(rr, httptest.NewRequest(http.MethodPost, "/api/download-batch", strings.NewReader(body)))
+                if rr.Code != http.StatusBadRequest {
+                        t.Errorf("expected 400 for %s, got %d", body, rr.Code)
+                }
+        }
+}
+
+func TestArchiveMemberChecks(t *testing.T) {
+        for _, name := range []string{"a.txt", "./dir/b", "dir/../c"} {
+                if _, err := cleanMemberName(name); err != nil {
+                        t.Errorf("expected %q to be accepted: %v", name, err)
+                }
+        }
+        for _, name := range []string{"/etc/passwd", "../x", "dir/../../x", `..\x`} {
+                if _, err := cleanMemberName(name); err == nil {
+                        t.Errorf("expected %q to be refused", name)
+                }
+        }
+        if err := checkSymlink("dir/link", "../other/file"); err != nil {
+                t.Errorf("expected a link inside the destination to be accepted: %v", err)
+        }
+        for _, target := range []string{"/etc", "../../etc"} {
+                if err := checkSymlink("dir/link", target); err == nil {
+                        t.Errorf("expected a link to %q to be refused", target)
+                }
+        }
+}
+
+func TestUploadLocalDir(t *testing.T) {
+        src := filepath.Join(t.TempDir(), "build")
+        os.MkdirAll(filepath.Join(src, "assets"), 0o755)
+        os.MkdirAll(filepath.Join(src, "node_modules", "dep"), 0o755)
+        os.WriteFile(filepath.Join(src, "index.html"), []byte("<h1>hi</h1>"), 0o644)
+        os.WriteFile(filepath.Join(src, "assets", "app.js"), []byte("run()"), 0o644)
+        os.WriteFile(filepath.Join(src, "node_modules", "dep", "x.js"), []byte("x"), 0o644)
+
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        h := &Handler{client: demo}
+
+        body, _ := json.Marshal(map[string]interface{}{
+                "namespace": "default", "pvc": "data", "srcDir": src, "destDir": "/www", "exclude": []string{"node_modules"},
+        })
+        rr := httptest.NewRecorder()
+        h.UploadLocalDirHandler(rr, httptest.NewRequest(http.MethodPost, "/api/upload-local-dir", bytes.NewReader(body)))
+        if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"files":2`) {
+                t.Fatalf("expected 2 files uploaded, got %d %s", rr.Code, rr.Body.String())
+        }
+        data, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/www/build/assets/app.js", 100)
+        if err != nil || string(data) != "run()" {
+                t.Errorf("expected the uploaded file, got %q, %v", data, err)
+        }
+        if _, _, err := demo.ReadFileHead(context.Background(), "default", "data", "/www/build/node_modules/dep/x.js", 100); err == nil {
+                t.Error("expected node_modules to be excluded")
+        }
+
+        rr = httptest.NewRecorder()
+        h.UploadLocalDirHandler(rr, httptest.NewRequest(http.MethodPost, "/api/upload-local-dir", strings.NewReader(`{"namespace":"default","pvc":"data","srcDir":"relative/dir"}`)))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected a relative srcDir to be refused, got %d", rr.Code)
+        }
+}
+
+func TestActivityFeed(t *testing.T) {
+        demo := k8s.NewSampleDemoCluster()
+        h := &Handler{client: demo}
+        move := h.Activity("move", http.HandlerFunc(h.MoveHandler))
+
+        req := httptest.NewRequest(http.MethodPost, "/api/move", strings.NewReader(`{"namespace":"default","pvc":"web-content","from":"/html","to":"/site"}`))
+        req.Header.Set("X-Forwarded-User", "alice")
+        move.ServeHTTP(httptest.NewRecorder(), req)
+        req = httptest.NewRequest(http.MethodPost, "/api/move", strings.NewReader(`{"namespace":"default","pvc":"web-content","from":"/missing","to":"/other"}`))
+        move.ServeHTTP(httptest.NewRecorder(), req)
+        move.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/move", nil))
+
+        rr := httptest.NewRecorder()
+        h.ActivityHandler(rr, httptest.NewRequest(http.MethodGet, "/api/activity?pvc=web-content", nil))
+        var resp struct {
+                Events []activityEvent `json:"events"`
+                Last   int64           `json:"last"`
+        }
+        if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+                t.Fatalf("failed to decode response: %v", err)
+        }
+        if len(resp.Events) != 2 || resp.Last != 2 {
+                t.Fatalf("expected the two moves, got %+v", resp)
+        }
+        if ev := resp.Events[0]; ev.User != "alice" || ev.Action != "move" || ev.Path != "/html" || ev.Result != activitySucceeded {
+                t.Errorf("unexpected first event: %+v", ev)
+        }
+        if ev := resp.Events[1]; ev.User != "192.0.2.1" || ev.Result != activityFailed || ev.Error == "" {
+                t.Errorf("expected a failed move with its error, got %+v", ev)
+        }
+
+        // A job's entry follows the request's, whichever finishes first.
+        feed := h.getActivity()
+        feed.publish(activityEvent{User: "bob", Action: "clone", Job: "j1", Result: activityStarted})
+        feed.jobFinished(jobs.Job{ID: "j1", State: jobs.StateSucceeded, Description: "Clone"})
+        feed.jobFinished(jobs.Job{ID: "j2", State: jobs.StateFailed, Error: "boom"})
+        feed.publish(activityEvent{User: "carol", Action: "move", Job: "j2", Result: activityStarted})
+        events, _, _ := feed.since(2, "", "")
+        if len(events) != 4 || events[1].User != "bob" || events[1].Result != "succeeded" || events[3].User != "carol" || events[3].Error != "boom" {
+                t.Errorf("unexpected job events: %+v", events)
+        }
+}
+
+func TestBulkBackupAndReport(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        dir := t.TempDir()
+        h := &Handler{client: k8s.NewSampleDemoCluster()}
+
+        for body, want := range map[string]int{
+                `{"action":"report"}`: http.StatusBadRequest,
+                `{"selector":"team in (","action":"report"}`: http.StatusBadRequest,
+                `{"selector":"team=data","action":"delete"}`: http.StatusBadRequest,
+                `{"selector":"team=data","action":"backup"}`: http.StatusBadRequest,
+                `{"selector":"team=data","action":"backup","destDir":"rel"}`: http.StatusBadRequest,
+                `{"selector":"team=data","action":"report","concurrency":1000}`: http.StatusBadRequest,
+        } {
+                rr := httptest.NewRecorder()
+                h.BulkHandler(rr, httptest.NewRequest(http.MethodPost, "/api/admin/bulk", strings.NewReader(body)))
+                if rr.Code != want {
+                        t.Errorf("%s: expected %d, got %d", body, want, rr.Code)
+                }
+        }
+
+        rr := httptest.NewRecorder()
+        h.BulkHandler(rr, httptest.NewRequest(http.MethodPost, "/api/admin/bulk", strings.NewReader(`{"selector":"team=data","action":"backup","destDir":"`+dir+`","concurrency":1}`)))
+        var job jobs.Job
+        if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+                t.Fatalf("expected a job, got %d (%v)", rr.Code, err)
+        }
+        job = waitForJob(t, h, job.ID)
+        var res bulkResult
+        if err := json.Unmarshal(job.Result, &res); err != nil || job.State != jobs.StateSucceeded {
+                t.Fatalf("expected the backup to succeed, got %+v (%v)", job, err)
+        }
+        if len(res.PVCs) != 2 || res.Succeeded != 2 || res.PVCs[0].PVC != "notebooks" || res.PVCs[1].PVC != "postgres-data" {
+                t.Fatalf("unexpected result: %+v", res)
+        }
+        for _, item := range res.PVCs {
+                info, err := os.Stat(item.File)
+                if err != nil || info.Size() != item.Size || filepath.Dir(item.File) != filepath.Join(dir, "analytics") {
+                        t.Errorf("expected %s with %d bytes, got %v", item.File, item.Size, err)
+                }
+        }
+        if res.BackupBytes != res.PVCs[0].Size+res.PVCs[1].Size {
+                t.Errorf("expected the sizes to add up, got %d", res.BackupBytes)
+        }
+
+        rr = httptest.NewRecorder()
+        h.BulkHandler(rr, httptest.NewRequest(http.MethodPost, "/api/admin/bulk", strings.NewReader(`{"selector":"team","action":"report"}`)))
+        var report jobs.Job
+        json.NewDecoder(rr.Body).Decode(&report)
+        report = waitForJob(t, h, report.ID)
+        var reportRes bulkResult
+        json.Unmarshal(report.Result, &reportRes)
+        if len(reportRes.PVCs) != 3 || reportRes.PVCs[0].Usage == nil || reportRes.UsedBytes == 0 {
+                t.Errorf("expected a report on every labelled PVC, got %+v", reportRes)
+        }
+
+        rr = httptest.NewRecorder()
+        h.BulkHandler(rr, httptest.NewRequest(http.MethodPost, "/api/admin/bulk", strings.NewReader(`{"selector":"team=nobody","action":"report"}`)))
+        var none jobs.Job
+        json.NewDecoder(rr.Body).Decode(&none)
+        if none = waitForJob(t, h, none.ID); none.State != jobs.StateFailed || !strings.Contains(none.Error, "no PVCs match") {
+                t.Errorf("expected a selector matching nothing to fail, got %+v", none)
+        }
+}
+
+func TestAPITokens(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        h := &Handler{}
+        create := func(body string) string {
+                rr := httptest.NewRecorder()
+                h.APITokensHandler(rr, httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(body)))
+                var resp struct {
+                        Token  APIToken `json:"token"`
+                        Secret string   `json:"secret"`
+                }
+                json.NewDecoder(rr.Body).Decode(&resp)
+                if rr.Code != http.StatusOK || !strings.HasPrefix(resp.Secret, apiTokenPrefix) {
+                        t.Fatalf("create %s: %d %+v", body, rr.Code, resp)
+                }
+                return resp.Secret
+        }
+        readSecret := create(`{"name":"dashboards"}`)
+        writeSecret := create(`{"name":"ci","scope":"write"}`)
+
+        var seen string
+        api := h.TokenAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                seen = requestUser(r)
+        }))
+        send := func(method, path, secret, remote string) int {
+                req := httptest.NewRequest(method, path, nil)
+                req.RemoteAddr = remote
+                if secret != "" {
+                        req.Header.Set("Authorization", "Bearer "+secret)
+                }
+                rr := httptest.NewRecorder()
+                api.ServeHTTP(rr, req)
+                return rr.Code
+        }
+        const remote, local = "192.0.2.7:4321", "127.0.0.1:4321"
+
+        if code := send(http.MethodGet, "/api/files", readSecret, remote); code != http.StatusOK || seen != "token:dashboards" {
+                t.Errorf("a read token should list, got %d as %q", code, seen)
+        }
+        if code := send(http.MethodPost, "/api/upload", readSecret, remote); code != http.StatusForbidden {
+                t.Errorf("a read token must not upload, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/upload", writeSecret, remote); code != http.StatusOK {
+                t.Errorf("a write token should upload, got %d", code)
+        }
+        if code := send(http.MethodGet, "/api/files", "kbt_guess", remote); code != http.StatusUnauthorized {
+                t.Errorf("an unknown token must be refused, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/tokens", writeSecret, local); code != http.StatusForbidden {
+                t.Errorf("a token must not create tokens, got %d", code)
+        }
+
+        if code := send(http.MethodGet, "/api/files", "", remote); code != http.StatusOK {
+                t.Errorf("without KUBE_BROWSER_REQUIRE_TOKEN a token is optional, got %d", code)
+        }
+        h.requireToken = true
+        if code := send(http.MethodGet, "/api/files", "", remote); code != http.StatusUnauthorized {
+                t.Errorf("a remote request without a token should be refused, got %d", code)
+        }
+        if code := send(http.MethodGet, "/api/files", "", local); code != http.StatusOK {
+                t.Errorf("the local UI should not need a token, got %d", code)
+        }
+        if code := send(http.MethodGet, "/static/js/app.js", "", remote); code != http.StatusOK {
+                t.Errorf("only /api/ needs a token, got %d", code)
+        }
+
+        // Tokens survive a restart; their secrets are never listed.
+        h2 := &Handler{}
+        rr := httptest.NewRecorder()
+        h2.APITokensHandler(rr, httptest.NewRequest(http.MethodGet, "/api/tokens", nil))
+        if strings.Contains(rr.Body.String(), readSecret) || strings.Contains(rr.Body.String(), `"hash"`) {
+                t.Fatalf("the listing leaks secrets: %s", rr.Body.String())
+        }
+        var list struct {
+                Tokens []APIToken `json:"tokens"`
+        }
+        json.NewDecoder(rr.Body).Decode(&list)
+        if len(list.Tokens) != 2 || list.Tokens[0].LastUsed == nil {
+                t.Fatalf("expected both tokens, the first with its use recorded, got %+v", list.Tokens)
+        }
+
+        rr = httptest.NewRecorder()
+        h.APITokensHandler(rr, httptest.NewRequest(http.MethodDelete, "/api/tokens?id="+list.Tokens[1].ID, nil))
+        if rr.Code != http.StatusOK {
+                t.Fatalf("revoke: %d %s", rr.Code, rr.Body.String())
+        }
+        if code := send(http.MethodPost, "/api/upload", writeSecret, remote); code != http.StatusUnauthorized {
+                t.Errorf("a revoked token must be refused, got %d", code)
+        }
+
+        rr = httptest.NewRecorder()
+        h.APITokensHandler(rr, httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"name":"x","scope":"admin"}`)))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected an unknown scope to be rejected, got %d", rr.Code)
+        }
+}
+
+func TestGroupAuthz(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "authz.json")
+        os.WriteFile(path, []byte(`{
+                "groups": {
+                        "platform": {"role": "admin"},
+                        "payments": {"role": "read-write", "namespaces": ["payments"]},
+                        "auditors": {"role": "read-only"}
+                }
+        }`), 0o600)
+        t.Setenv(authzFileEnv, path)
+        h := &Handler{}
+        if err := h.LoadAuthzConfig(); err != nil {
+                t.Fatal(err)
+        }
+
+        var body string
+        api := h.TokenAuth(h.GroupAuthz(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                b, _ := io.ReadAll(r.Body)
+                body = string(b)
+        })))
+        send := func(method, target, groups, payload string) int {
+                req := httptest.NewRequest(method, target, strings.NewReader(payload))
+                req.Header.Set("X-Forwarded-User", "alice")
+                if groups != "" {
+                        req.Header.Set("X-Forwarded-Groups", groups)
+                }
+                if payload != "" {
+                        req.Header.Set("Content-Type", "application/json")
+                }
+                rr := httptest.NewRecorder()
+                api.ServeHTTP(rr, req)
+                return rr.Code
+        }
+
+        if code := send(http.MethodPost, "/api/connect", "platform", `{}`); code != http.StatusOK {
+                t.Errorf("an admin should connect, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/connect", "payments", `{}`); code != http.StatusForbidden {
+                t.Errorf("a read-write group must not connect, got %d", code)
+        }
+        if code := send(http.MethodGet, "/api/files?namespace=payments&pvc=data", "payments", ""); code != http.StatusOK {
+                t.Errorf("payments should read its namespace, got %d", code)
+        }
+        if code := send(http.MethodGet, "/api/files?namespace=billing&pvc=data", "payments", ""); code != http.StatusForbidden {
+                t.Errorf("payments must not read another namespace, got %d", code)
+        }
+        if code := send(http.MethodGet, "/api/files?namespace=billing&pvc=data", "auditors", ""); code != http.StatusOK {
+                t.Errorf("auditors should read every namespace, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/delete", "auditors", `{"namespace":"payments","pvc":"data","path":"/x"}`); code != http.StatusForbidden {
+                t.Errorf("auditors must not write, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/estimate", "auditors", `{"namespace":"payments"}`); code != http.StatusOK {
+                t.Errorf("an estimate only reads, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/snapshots", "auditors", `{"namespace":"payments","snapshot":"nightly"}`); code != http.StatusForbidden {
+                t.Errorf("restoring a snapshot creates a claim, got %d", code)
+        }
+
+        // Both ends of a transfer are checked, and the handler still gets
+        // the body.
+        transfer := `{"source":{"namespace":"payments","pvc":"a"},"destination":{"namespace":"billing","pvc":"b"}}`
+        if code := send(http.MethodPost, "/api/transfer", "payments", transfer); code != http.StatusForbidden {
+                t.Errorf("payments must not copy into billing, got %d", code)
+        }
+        if code := send(http.MethodPost, "/api/transfer", "payments,auditors", strings.ReplaceAll(transfer, "billing", "payments")); code != http.StatusOK || body == "" {
+                t.Errorf("a transfer within payments should pass its body on, got %d %q", code, body)
+        }
+        if code := send(http.MethodGet, "/raw/token/billing/data/f", "payments", ""); code != http.StatusForbidden {
+                t.Errorf("raw URLs must be checked too, got %d", code)
+        }
+        if code := send(http.MethodGet, "/api/status", "interns", ""); code != http.StatusForbidden {
+                t.Errorf("a user without a mapped group should be refused, got %d", code)
+        }
+
+        // Only namespaces a grant reads are listed.
+        a := access{Grants: []roleGrant{{Role: roleReadWrite, Namespaces: []string{"payments"}}}}
+        if got := a.visibleNamespaces([]string{"billing", "payments"}); len(got) != 1 || got[0] != "payments" {
+                t.Errorf("unexpected namespaces %v", got)
+        }
+
+        os.WriteFile(path, []byte(`{"groups": {"ops": {"role": "owner"}}}`), 0o600)
+        if err := (&Handler{}).LoadAuthzConfig(); err == nil {
+                t.Error("expected an unknown role to be rejected")
+        }
+}
+
+func TestQuotas(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	os.WriteFile(path, []byte(`{
+		"users": {"alice": {"maxConcurrentTransfers": 1, "namespaces": ["default", "analytics"]}},
+		"default": {"maxBytesPerDay": 10}
+	}`), 0o600)
+	t.Setenv(quotasFileEnv, path)
+	source := k8s.NewSampleDemoCluster()
+	h := &Handler{client: source, panes: map[string]KubeClient{"p-target": k8s.NewSampleDemoCluster()}}
+	if err := h.LoadQuotas(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/transfer", h.TransferHandler)
+	mux.HandleFunc("/api/jobs", h.JobsHandler)
+	mux.HandleFunc("/api/files", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/api/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789abc"))
+	})
+	api := h.TokenAuth(h.GroupAuthz(h.Quotas(mux)))
+	send := func(method, target, user, payload string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(payload))
+		req.Header.Set("X-Forwarded-User", user)
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(http.MethodGet, "/api/files?namespace=payments&pvc=data", "alice", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("alice must not use another namespace, got %d", rr.Code)
+	}
+	if rr := send(http.MethodGet, "/api/files?namespace=default&pvc=data", "alice", ""); rr.Code != http.StatusOK {
+		t.Errorf("alice should use the namespaces listed, got %d", rr.Code)
+	}
+
+	// A saved search counts against the namespace it runs in.
+	h.getSavedSearches().add(SavedSearch{ID: "s-payments", Name: "ledgers", Namespace: "payments", PVC: "data"})
+	mux.HandleFunc("/api/saved-searches", h.SavedSearchesHandler)
+	mux.HandleFunc("/api/saved-searches/run", h.RunSavedSearchHandler)
+	if rr := send(http.MethodGet, "/api/saved-searches/run?id=s-payments", "alice", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("alice must not run a search in another namespace, got %d", rr.Code)
+	}
+	if rr := send(http.MethodGet, "/api/saved-searches", "alice", ""); strings.Contains(rr.Body.String(), "s-payments") {
+		t.Errorf("alice must not see searches in another namespace, got %s", rr.Body.String())
+	}
+
+	// A job under way takes alice's only transfer until it is canceled.
+	rr := send(http.MethodPost, "/api/transfer?at=02:00", "alice", `{"source":{"namespace":"default","pvc":"web-content","paths":["/html"]},
+		"destination":{"pane":"p-target","namespace":"analytics","pvc":"notebooks","dir":"/nightly"}}`)
+	var job jobs.Job
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the transfer to be scheduled, got %d (%v)", rr.Code, err)
+	}
+	if rr := send(http.MethodGet, "/api/download?namespace=default&pvc=data&path=/f", "alice", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a second transfer to be refused, got %d", rr.Code)
+	}
+	send(http.MethodPost, "/api/jobs?id="+job.ID+"&action=cancel", "alice", "")
+	waitForJob(t, h, job.ID)
+	if rr := send(http.MethodGet, "/api/download?namespace=default&pvc=data&path=/f", "alice", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected the transfer once the job was canceled, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Anyone else gets the default: 10 bytes a day, so the first download
+	// goes through and uses them up.
+	if rr := send(http.MethodGet, "/api/download?namespace=billing&pvc=data&path=/f", "bob", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected bob's first download, got %d", rr.Code)
+	}
+	if rr := send(http.MethodGet, "/api/download?namespace=billing&pvc=data&path=/f", "bob", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected bob's day to be used up, got %d", rr.Code)
+	}
+	if rr := send(http.MethodGet, "/api/download?namespace=billing&pvc=data&path=/f", "carol", ""); rr.Code != http.StatusOK {
+		t.Errorf("carol has a day of their own, got %d", rr.Code)
+	}
+
+	os.WriteFile(path, []byte(`{"default": {"maxBytesPerDay": -1}}`), 0o600)
+	if err := (&Handler{}).LoadQuotas(); err == nil {
+		t.Error("expected a negative limit to be rejected")
+	}
+}
+
+func TestSnapshotsHandler(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data", Capacity: "1Gi"})
+        demo.WriteFile("default", "data", "/app.conf", []byte("good"))
+        demo.AddSnapshot("default", "data", "nightly", time.Now().Add(-time.Hour))
+        demo.WriteFile("default", "data", "/app.conf", []byte("bad"))
+        h := &Handler{client: demo}
+        serve := func(method, target, body string) *httptest.ResponseRecorder {
+                rr := httptest.NewRecorder()
+                h.SnapshotsHandler(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+                return rr
+        }
+
+        rr := serve(http.MethodGet, "/api/snapshots?namespace=default&pvc=data", "")
+        var list struct {
+                Snapshots []k8s.Snapshot `json:"snapshots"`
+        }
+        json.NewDecoder(rr.Body).Decode(&list)
+        if rr.Code != http.StatusOK || len(list.Snapshots) != 1 || list.Snapshots[0].Name != "nightly" {
+                t.Fatalf("expected the snapshot, got %d %+v", rr.Code, list)
+        }
+
+        rr = serve(http.MethodPost, "/api/snapshots", `{"namespace":"default","snapshot":"nightly"}`)
+        var claim k8s.SnapshotClaim
+        json.NewDecoder(rr.Body).Decode(&claim)
+        if rr.Code != http.StatusOK || claim.PVC == "" || claim.Source != "data" {
+                t.Fatalf("expected a restored claim, got %d %+v", rr.Code, claim)
+        }
+        ref := k8s.PVCRef{Namespace: "default", PVC: claim.PVC}
+        if h.snapshotExpiry[ref] == nil || time.Until(claim.Expires) < 5*time.Hour {
+                t.Errorf("expected the claim to be released when it expires, got %v", claim.Expires)
+        }
+        body, _, err := demo.ReadFileHead(context.Background(), "default", claim.PVC, "/app.conf", 100)
+        if err != nil || string(body) != "good" {
+                t.Errorf("expected the snapshot's content, got %q, %v", body, err)
+        }
+
+        if rr := serve(http.MethodDelete, "/api/snapshots?namespace=default&pvc=data", ""); rr.Code == http.StatusOK {
+                t.Error("expected the live claim not to be released")
+        }
+        // Restoring and releasing create and delete claims.
+        h.readOnly = true
+        if rr := serve(http.MethodPost, "/api/snapshots", `{"namespace":"default","snapshot":"nightly"}`); rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected read-only mode to refuse restoring, got %d", rr.Code)
+        }
+        if rr := serve(http.MethodDelete, "/api/snapshots?namespace=default&pvc="+claim.PVC, ""); rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected read-only mode to refuse releasing, got %d", rr.Code)
+        }
+        h.readOnly = false
+        if rr := serve(http.MethodDelete, "/api/snapshots?namespace=default&pvc="+claim.PVC, ""); rr.Code != http.StatusOK {
+                t.Errorf("release: %d %s", rr.Code, rr.Body.String())
+        }
+        if h.snapshotExpiry[ref] != nil {
+                t.Error("expected a released claim's timer to be stopped")
+        }
+
+        h.EnableMinimalMode()
+        if rr := serve(http.MethodPost, "/api/snapshots", `{"namespace":"default","snapshot":"nightly"}`); rr.Code != http.StatusMethodNotAllowed {
+                t.Errorf("expected minimal mode to refuse restoring, got %d", rr.Code)
+        }
+}
+
+func TestSnapshotRestoreHandler(t *testing.T) {
+        t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data", Capacity: "1Gi"})
+        demo.WriteFile("default", "data", "/conf/app.conf", []byte("good"))
+        demo.WriteFile("default", "data", "/conf/extra/b.txt", []byte("b"))
+        demo.AddSnapshot("default", "data", "nightly", time.Now().Add(-time.Hour))
+        demo.WriteFile("default", "data", "/conf/app.conf", []byte("bad"))
+        h := &Handler{client: demo}
+        restore := func(body string) (int, k8s.SnapshotRestoreResult, jobs.Job) {
+                rr := httptest.NewRecorder()
+                h.SnapshotRestoreHandler(rr, httptest.NewRequest(http.MethodPost, "/api/snapshots/restore", strings.NewReader(body)))
+                var job jobs.Job
+                var res k8s.SnapshotRestoreResult
+                if rr.Code != http.StatusAccepted {
+                        return rr.Code, res, job
+                }
+                json.NewDecoder(rr.Body).Decode(&job)
+                job = waitForJob(t, h, job.ID)
+                json.Unmarshal(job.Result, &res)
+                return rr.Code, res, job
+        }
+        read := func(path string) string {
+                body, _, err := demo.ReadFileHead(context.Background(), "default", "data", path, 100)
+                if err != nil {
+                        return ""
+                }
+                return string(body)
+        }
+
+        if code, _, _ := restore(`{"namespace":"default","snapshot":"nightly","paths":["/"]}`); code != http.StatusBadRequest {
+                t.Errorf("expected the root to be refused, got %d", code)
+        }
+
+        // By default an existing file is left alone and the restore fails.
+        _, _, job := restore(`{"namespace":"default","snapshot":"nightly","paths":["/conf/app.conf"]}`)
+        if job.State != jobs.StateFailed || read("/conf/app.conf") != "bad" {
+                t.Errorf("expected a conflict to fail the restore, got %s %q", job.State, read("/conf/app.conf"))
+        }
+
+        _, res, job := restore(`{"namespace":"default","snapshot":"nightly","paths":["/conf/app.conf"],"onConflict":"rename"}`)
+        if job.State != jobs.StateSucceeded || len(res.Restored) != 1 || res.Restored[0].Target != "/conf/app.conf.restored" || !res.Restored[0].Renamed {
+                t.Fatalf("expected a renamed restore, got %s %+v", job.State, res)
+        }
+        if read("/conf/app.conf.restored") != "good" || read("/conf/app.conf") != "bad" {
+                t.Errorf("expected the snapshot's file next to the live one")
+        }
+
+        _, res, job = restore(`{"namespace":"default","snapshot":"nightly","paths":["/conf"],"onConflict":"overwrite"}`)
+        if job.State != jobs.StateSucceeded || res.PVC != "data" || !res.Restored[0].Overwritten {
+                t.Fatalf("expected an overwriting restore, got %s %+v", job.State, res)
+        }
+        if read("/conf/app.conf") != "good" || read("/conf/extra/b.txt") != "b" || read("/conf/app.conf.restored") != "good" {
+                t.Errorf("expected the directory to be merged with the snapshot's")
+        }
+        if _, err := demo.ListFiles(context.Background(), "default", k8s.SnapshotClaimName("nightly"), "/"); err == nil {
+                t.Error("expected the claim restored for the copy to be deleted")
+        }
+
+        h.readOnly = true
+        if code, _, _ := restore(`{"namespace":"default","snapshot":"nightly","paths":["/conf/app.conf"]}`); code != http.StatusMethodNotAllowed {
+                t.Errorf("expected read-only mode to refuse restoring, got %d", code)
+        }
+}
+
+func TestCompareHandler(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data", Capacity: "1Gi"})
+        demo.WriteFile("default", "data", "/conf/app.conf", []byte("good"))
+        demo.WriteFile("default", "data", "/conf/same.txt", []byte("aaaa"))
+        demo.WriteFile("default", "data", "/conf/kept.txt", []byte("kept"))
+        demo.WriteFile("default", "data", "/conf/old/a.txt", []byte("a"))
+        demo.AddSnapshot("default", "data", "nightly", time.Now().Add(-time.Hour))
+        demo.WriteFile("default", "data", "/conf/app.conf", []byte("broken"))
+        demo.WriteFile("default", "data", "/conf/same.txt", []byte("bbbb"))
+        demo.WriteFile("default", "data", "/conf/new.txt", []byte("new"))
+        demo.DeleteDirectory(context.Background(), "default", "data", "/conf/old", true)
+        h := &Handler{client: demo, readOnly: true}
+        compare := func(body string) (*httptest.ResponseRecorder, compareResult) {
+                rr := httptest.NewRecorder()
+                h.CompareHandler(rr, httptest.NewRequest(http.MethodPost, "/api/compare", strings.NewReader(body)))
+                var res compareResult
+                json.NewDecoder(rr.Body).Decode(&res)
+                return rr, res
+        }
+        paths := func(entries []compareEntry) string {
+                var out []string
+                for _, e := range entries {
+                        out = append(out, e.Path+":"+e.Reason)
+                }
+                return strings.Join(out, ",")
+        }
+
+        rr, res := compare(`{"left":{"namespace":"default","snapshot":"nightly","path":"/conf"},"right":{"namespace":"default","pvc":"data","path":"/conf"}}`)
+        if rr.Code != http.StatusOK {
+                t.Fatalf("compare: %d %s", rr.Code, rr.Body.String())
+        }
+        if paths(res.Added) != "new.txt:" || paths(res.Removed) != "old:,old/a.txt:" || paths(res.Changed) != "app.conf:size" || res.Unchanged != 2 {
+                t.Errorf("unexpected comparison by size: %+v", res)
+        }
+        if res.Left.PVC == "" || res.Left.PVC == "data" {
+                t.Errorf("expected the snapshot side to name its restored claim, got %+v", res.Left)
+        }
+
+        _, res = compare(`{"left":{"namespace":"default","snapshot":"nightly","path":"/conf"},"right":{"namespace":"default","pvc":"data","path":"/conf"},"checksum":true}`)
+        if paths(res.Changed) != "app.conf:size,same.txt:checksum" || res.Unchanged != 1 || res.Checksummed != 2 || res.Algorithm != "sha256" {
+                t.Errorf("unexpected comparison by checksum: %+v", res)
+        }
+
+        if rr, _ := compare(`{"left":{"namespace":"default","pvc":"data"},"right":{"namespace":"default"}}`); rr.Code != http.StatusBadRequest {
+                t.Errorf("expected a side without a claim to be rejected, got %d", rr.Code)
+        }
+}
+
+func TestCancelableOperations(t *testing.T) {
+        h := &Handler{}
+        started := make(chan struct{})
+        slow := h.Cancelable("search", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                close(started)
+                <-r.Context().Done()
+                h.jsonErrorFromErr(w, r.Context().Err(), http.StatusInternalServerError)
+        }))
+
+        rr := httptest.NewRecorder()
+        done := make(chan struct{})
+        go func() {
+                defer close(done)
+                req := httptest.NewRequest(http.MethodGet, "/api/search?namespace=default&pvc=data&path=/logs", nil)
+                req.Header.Set(operationIDHeader, "search-1")
+                slow.ServeHTTP(rr, req)
+        }()
+        <-started
+
+        list := httptest.NewRecorder()
+        h.OperationsHandler(list, httptest.NewRequest(http.MethodGet, "/api/operations", nil))
+        var listed struct {
+                Operations []operation `json:"operations"`
+        }
+        json.NewDecoder(list.Body).Decode(&listed)
+        if len(listed.Operations) != 1 || listed.Operations[0].ID != "search-1" || listed.Operations[0].Kind != "search" ||
+                listed.Operations[0].PVC != "data" || listed.Operations[0].Namespaces[0] != "default" {
+                t.Fatalf("unexpected operations: %s", list.Body.String())
+        }
+
+        dup := httptest.NewRecorder()
+        req := httptest.NewRequest(http.MethodGet, "/api/search?operation=search-1", nil)
+        slow.ServeHTTP(dup, req)
+        if dup.Code != http.StatusConflict {
+                t.Errorf("expected a running ID to be refused, got %d", dup.Code)
+        }
+        bad := httptest.NewRecorder()
+        slow.ServeHTTP(bad, httptest.NewRequest(http.MethodGet, "/api/search?operation=a/b", nil))
+        if bad.Code != http.StatusBadRequest {
+                t.Errorf("expected an invalid ID to be refused, got %d", bad.Code)
+        }
+
+        // A user who may not read the namespace cannot cancel it, even
+        // knowing its ID.
+        denied := httptest.NewRecorder()
+        other := access{User: "bob", Grants: []roleGrant{{Role: roleReadWrite, Namespaces: []string{"other"}}}}
+        req = httptest.NewRequest(http.MethodDelete, "/api/operations?id=search-1", nil)
+        h.OperationsHandler(denied, req.WithContext(context.WithValue(req.Context(), accessKey{}, other)))
+        if denied.Code != http.StatusNotFound {
+                t.Errorf("expected the cancel to be refused, got %d: %s", denied.Code, denied.Body.String())
+        }
+        if _, ok := h.getOperations().get("search-1"); !ok {
+                t.Fatal("expected the search to keep running")
+        }
+
+        cancel := httptest.NewRecorder()
+        h.OperationsHandler(cancel, httptest.NewRequest(http.MethodDelete, "/api/operations?id=search-1", nil))
+        if cancel.Code != http.StatusOK {
+                t.Fatalf("expected the cancel to succeed, got %d: %s", cancel.Code, cancel.Body.String())
+        }
+        <-done
+        if rr.Code != statusCanceled || !strings.Contains(rr.Body.String(), `"kind":"Canceled"`) || rr.Header().Get(operationIDHeader) != "search-1" {
+                t.Errorf("expected the search to answer as canceled, got %d: %s", rr.Code, rr.Body.String())
+        }
+
+        gone := httptest.NewRecorder()
+        h.OperationsHandler(gone, httptest.NewRequest(http.MethodDelete, "/api/operations?id=search-1", nil))
+        if gone.Code != http.StatusNotFound {
+                t.Errorf("expected a finished operation to be gone, got %d", gone.Code)
+        }
+}
+
+func TestStreamedSearchAndDiskUsage(t *testing.T) {
+        demo := k8s.NewDemoCluster()
+        demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+        demo.WriteFile("default", "data", "/logs/a.log", []byte("0123456789"))
+        demo.WriteFile("default", "data", "/logs/b.log", []byte("01"))
+        demo.WriteFile("default", "data", "/logs/c.txt", []byte("0123"))
+        h := &Handler{client: demo}
+
+        rr := httptest.NewRecorder()
+        h.SearchHandler(rr, httptest.NewRequest(http.MethodGet, "/api/search?namespace=default&pvc=data&path=/logs&name=*.log&limit=1&stream=true", nil))
+        if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+                t.Fatalf("expected an NDJSON answer, got %d: %s", rr.Code, rr.Body.String())
+        }
+        lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+        if len(lines) != 2 || !strings.Contains(lines[0], `"name":"a.log"`) || lines[1] != `{"count":1,"done":true,"truncated":true}` {
+                t.Errorf("unexpected stream %q", lines)
+        }
+
+        rr = httptest.NewRecorder()
+        h.DiskUsageHandler(rr, httptest.NewRequest(http.MethodGet, "/api/du?namespace=default&pvc=data&path=/logs", nil))
+        var du struct {
+                Directories []k8s.DirUsage `json:"directories"`
+                Bytes       int64          `json:"bytes"`
+        }
+        json.NewDecoder(rr.Body).Decode(&du)
+        if rr.Code != http.StatusOK || du.Bytes != 16 || len(du.Directories) != 1 || du.Directories[0].Path != "/logs" {
+                t.Errorf("unexpected du answer %d: %+v", rr.Code, du)
+        }
+        rr = httptest.NewRecorder()
+        h.DiskUsageHandler(rr, httptest.NewRequest(http.MethodGet, "/api/du?namespace=default&pvc=data", nil))
+        if rr.Code != http.StatusBadRequest {
+                t.Errorf("expected a missing path to be refused, got %d", rr.Code)
+        }
+}
+
+func TestSpooledZipArchive(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	t.Setenv("KUBE_BROWSER_SPOOL_DIR", t.TempDir())
+	t.Setenv("KUBE_BROWSER_SPOOL_MIN_FREE_MB", "0")
+	h := &Handler{client: k8s.NewSampleDemoCluster()}
+
+	rr := httptest.NewRecorder()
+	h.DownloadArchiveHandler(rr, httptest.NewRequest(http.MethodPost, "/api/download-archive",
+		strings.NewReader(`{"namespace":"default","pvc":"web-content","paths":["/html"],"format":"zip"}`)))
+	var job jobs.Job
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the archive to be queued, got %d (%v)", rr.Code, err)
+	}
+	if job = waitForJob(t, h, job.ID); job.State != jobs.StateSucceeded {
+		t.Fatalf("expected the archive to be built, got %+v", job)
+	}
+
+	rr = httptest.NewRecorder()
+	h.DownloadArchiveHandler(rr, httptest.NewRequest(http.MethodGet, "/api/download-archive?id="+job.ID, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" ||
+		!strings.Contains(rr.Header().Get("Content-Disposition"), "html.zip") {
+		t.Fatalf("unexpected answer %d %v", rr.Code, rr.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if !strings.Contains(" "+strings.Join(names, " ")+" ", " html/index.html ") {
+		t.Errorf("expected the directory's files in the zip, got %v", names)
+	}
+
+	rr = httptest.NewRecorder()
+	h.DownloadArchiveHandler(rr, httptest.NewRequest(http.MethodPost, "/api/download-archive",
+		strings.NewReader(`{"namespace":"default","pvc":"web-content","paths":["/html"],"format":"rar"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown format to be refused, got %d", rr.Code)
+	}
+}
+
+func TestSavedSearchesFollowGroupAuthz(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	path := filepath.Join(t.TempDir(), "authz.json")
+	os.WriteFile(path, []byte(`{"groups": {"payments": {"role": "read-write", "namespaces": ["payments"]}}}`), 0o600)
+	t.Setenv(authzFileEnv, path)
+	demo := k8s.NewDemoCluster()
+	demo.AddPVC(k8s.PVCInfo{Namespace: "billing", Name: "data"})
+	demo.WriteFile("billing", "data", "/invoices/2024.csv", []byte("1"))
+	h := &Handler{client: demo}
+	if err := h.LoadAuthzConfig(); err != nil {
+		t.Fatal(err)
+	}
+	billing := SavedSearch{ID: "s-billing", Name: "invoices", Namespace: "billing", PVC: "data", Query: k8s.SearchQuery{Path: "/invoices"}}
+	payments := SavedSearch{ID: "s-payments", Name: "ledgers", Namespace: "payments", PVC: "data", Query: k8s.SearchQuery{Path: "/"}}
+	h.getSavedSearches().add(billing)
+	h.getSavedSearches().add(payments)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/saved-searches", h.SavedSearchesHandler)
+	mux.HandleFunc("/api/saved-searches/run", h.RunSavedSearchHandler)
+	api := h.GroupAuthz(mux)
+	send := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		req.Header.Set("X-Forwarded-Groups", "payments")
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(http.MethodGet, "/api/saved-searches"); strings.Contains(rr.Body.String(), "s-billing") || !strings.Contains(rr.Body.String(), "s-payments") {
+		t.Errorf("expected only the payments search to be listed, got %s", rr.Body.String())
+	}
+	if rr := send(http.MethodGet, "/api/saved-searches/run?id=s-billing"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected running a billing search to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := send(http.MethodDelete, "/api/saved-searches?id=s-billing"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected deleting a billing search to be refused, got %d", rr.Code)
+	}
+	if _, ok := h.getSavedSearches().get("s-billing"); !ok {
+		t.Error("expected the billing search to be kept")
+	}
+	if rr := send(http.MethodDelete, "/api/saved-searches?id=s-payments"); rr.Code != http.StatusOK {
+		t.Errorf("expected deleting a payments search to succeed, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUploadFromURLKeepsExistingFile(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	}))
+	defer remote.Close()
+	t.Setenv("KUBE_BROWSER_URL_UPLOAD_ALLOW", "127.0.0.1")
+
+	demo := k8s.NewDemoCluster()
+	demo.AddPVC(k8s.PVCInfo{Namespace: "default", Name: "data"})
+	demo.WriteFile("default", "data", "/in/a.txt", []byte("old"))
+	h := &Handler{client: demo}
+	fetch := func(extra string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"namespace":"default","pvc":"data","path":"/in","fileName":"a.txt","url":%q%s}`, remote.URL+"/a.txt", extra)
+		rr := httptest.NewRecorder()
+		h.UploadFromURLHandler(rr, httptest.NewRequest(http.MethodPost, "/api/upload-url", strings.NewReader(body)))
+		return rr
+	}
+	content := func(p string) string {
+		data, _, _ := demo.ReadFileHead(context.Background(), "default", "data", p, 100)
+		return string(data)
+	}
+
+	if rr := fetch(`,"checksum":"sha256:` + strings.Repeat("0", 64) + `"`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := content("/in/a.txt"); got != "old" {
+		t.Errorf("expected a failed checksum to leave the file alone, got %q", got)
+	}
+	if rr := fetch(`,"onConflict":"fail"`); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := fetch(`,"onConflict":"skip"`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"skipped":true`) {
+		t.Errorf("expected the file to be skipped, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := fetch(`,"onConflict":"rename"`); rr.Code != http.StatusOK || content("/in/a (1).txt") != "new" {
+		t.Errorf("expected the file to be renamed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := content("/in/a.txt"); got != "old" {
+		t.Errorf("expected the file to be kept, got %q", got)
+	}
+	if rr := fetch(""); rr.Code != http.StatusOK || content("/in/a.txt") != "new" {
+		t.Errorf("expected the file to be overwritten, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// helperEventBacklog is how many helper pod events are kept for clients
+// that ask after they happened.
+const helperEventBacklog = 200
+
+// helperEventKeepalive is how often an idle event stream sends a comment,
+// so proxies do not close it.
+const helperEventKeepalive = 15 * time.Second
+
+// helperEvent is a k8s.HelperEvent numbered in the order it was reported.
+type helperEvent struct {
+	ID int64 `json:"id"`
+	k8s.HelperEvent
+}
+
+// helperFeed keeps the latest helper pod events of the connection and
+// wakes up the clients streaming them.
+type helperFeed struct {
+	mu     sync.Mutex
+	events []helperEvent
+	lastID int64
+	// wake is closed and replaced whenever an event arrives.
+	wake chan struct{}
+}
+
+func newHelperFeed() *helperFeed {
+	return &helperFeed{wake: make(chan struct{})}
+}
+
+func (f *helperFeed) publish(ev k8s.HelperEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastID++
+	f.events = append(f.events, helperEvent{ID: f.lastID, HelperEvent: ev})
+	if len(f.events) > helperEventBacklog {
+		f.events = f.events[len(f.events)-helperEventBacklog:]
+	}
+	close(f.wake)
+	f.wake = make(chan struct{})
+}
+
+// since returns the events after id that match the namespace and PVC
+// filters (empty matches all), the id of the latest event, and a channel
+// closed on the next publish.
+func (f *helperFeed) since(id int64, namespace, pvc string) ([]helperEvent, int64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []helperEvent
+	for _, ev := range f.events {
+		if ev.ID <= id || (namespace != "" && ev.Namespace != namespace) || (pvc != "" && ev.PVC != pvc) {
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out, f.lastID, f.wake
+}
+
+func (h *Handler) getHelperFeed() *helperFeed {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.helperEvents == nil {
+		h.helperEvents = newHelperFeed()
+	}
+	return h.helperEvents
+}
+
+// HelperEventsHandler reports what helper pods are doing while operations
+// wait on them: their Kubernetes events (scheduling, image pulls), waiting
+// reasons and, when one fails, its last log lines.
+//
+//	GET /api/helper-events[?since=<id>&namespace=&pvc=]
+//
+// It answers with {"events": [...], "last": <id of the latest event>}, so
+// a client can ask for only what comes next, or, when the request
+// accepts text/event-stream, streams each event as it happens until the
+// client goes away. A stream resumes after Last-Event-ID.
+func (h *Handler) HelperEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	since := q.Get("since")
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		since = last
+	}
+	var after int64
+	if since != "" {
+		n, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || n < 0 {
+			h.jsonError(w, "since must be an event id", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	feed := h.getHelperFeed()
+	namespace, pvc := q.Get("namespace"), q.Get("pvc")
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		events, last, _ := feed.since(after, namespace, pvc)
+		if events == nil {
+			events = []helperEvent{}
+		}
+		h.jsonResponse(w, map[string]interface{}{"events": events, "last": last})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	// The stream stays open for as long as the UI shows the log panel.
+	rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepalive := time.NewTicker(helperEventKeepalive)
+	defer keepalive.Stop()
+	for {
+		events, _, wake := feed.since(after, namespace, pvc)
+		for _, ev := range events {
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.ID, data)
+			after = ev.ID
+		}
+		if len(events) > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"kube-browser/pkg/jobs"
+)
+
+const jobsFile = "jobs.json"
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// getJobs returns the job manager, loading persisted jobs and registering
+// the job kinds on first use.
+func (h *Handler) getJobs() *jobs.Manager {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.jobs == nil {
+		h.jobs = jobs.NewManager(jobsFile)
+		h.jobs.Register(jobKindArchive, h.runArchiveJob)
+		h.jobs.Register(jobKindExtract, h.runExtractJob)
+		h.jobs.Register(jobKindMove, h.runMoveJob)
+		h.jobs.Register(jobKindMigrate, h.runMigrateJob)
+		h.jobs.Register(jobKindClone, h.runCloneJob)
+		h.jobs.Register(jobKindSnapshotRestore, h.runSnapshotRestoreJob)
+		h.jobs.Register(jobKindTransfer, h.runTransferJob)
+		h.jobs.Register(jobKindMaintenance, h.runMaintenanceJob)
+		h.jobs.Register(jobKindBulk, h.runBulkJob)
+		h.jobs.Register(jobKindVerify, h.runVerifyJob)
+		h.jobs.OnFinish(func(job jobs.Job) {
+			h.getListingCache().invalidate()
+			h.getActivity().jobFinished(job)
+			h.getQuotaUsage().jobFinished(job)
+		})
+	}
+	return h.jobs
+}
+
+// removeJob forgets a job and deletes any local file it produced.
+func (h *Handler) removeJob(m *jobs.Manager, id string) error {
+	job, err := m.Remove(id)
+	if err != nil {
+		return err
+	}
+	if job.Kind == jobKindArchive {
+		if f := archiveFile(job); f != "" {
+			h.removeLocalFile(f)
+		}
+	}
+	return nil
+}
+
+// JobsHandler lists background jobs, including those interrupted by a
+// restart, and lets the user resume, cancel or dismiss them:
+//
+//	GET    /api/jobs[?id=]
+//	POST   /api/jobs?id=&action=resume|cancel
+//	DELETE /api/jobs?id=
+func (h *Handler) JobsHandler(w http.ResponseWriter, r *http.Request) {
+	m := h.getJobs()
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			h.jsonResponse(w, map[string]interface{}{"jobs": m.List()})
+			return
+		}
+		job, ok := m.Get(id)
+		if !ok {
+			h.jsonError(w, jobs.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		h.jsonResponse(w, job)
+	case http.MethodPost:
+		var job jobs.Job
+		var err error
+		switch r.URL.Query().Get("action") {
+		case "resume":
+			if job, err = m.Resume(id); err == nil {
+				noteActivityJob(r, job)
+			}
+		case "cancel":
+			noteActivity(r, "", "", "", "Cancel job "+id)
+			if err = m.Cancel(id); err == nil {
+				job, _ = m.Get(id)
+			}
+		default:
+			h.jsonError(w, "action must be resume or cancel", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, jobs.ErrNotFound) {
+			h.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		h.jsonResponse(w, job)
+	case http.MethodDelete:
+		noteActivity(r, "", "", "", "Dismiss job "+id)
+		if err := h.removeJob(m, id); err != nil {
+			h.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.jsonResponse(w, map[string]interface{}{"deleted": true, "id": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"kube-browser/pkg/k8s"
+	"kube-browser/pkg/storage"
+)
+
+// KubeClient is everything the handlers need from a connection.
+// *k8s.Client implements it against a real cluster and *k8s.DemoCluster in
+// memory, for --demo and tests; *storage.Backend serves local
+// directories, S3 and SFTP. Other backends can be served with
+// Handler.UseBackend. Errors should be *k8s.K8sError where a kind applies,
+// so responses carry it.
+type KubeClient interface {
+	Connection() (kubeconfigPath, contextName string)
+	RegistryMirror() string
+	CredentialStatus() k8s.CredentialStatus
+	ExecSessions() (inUse, limit int)
+
+	ListNamespaces(ctx context.Context) ([]string, error)
+	ListPVCs(ctx context.Context, namespace string) ([]k8s.PVCInfo, error)
+	SelectPVCs(ctx context.Context, selector string) ([]k8s.PVCInfo, error)
+	StorageClasses(ctx context.Context) ([]string, error)
+
+	ListFiles(ctx context.Context, namespace, pvcName, path string) ([]k8s.FileInfo, error)
+	StreamFiles(ctx context.Context, namespace, pvcName, path string, fn func(k8s.FileInfo) error) error
+	DownloadFile(ctx context.Context, namespace, pvcName, filePath string) (io.ReadCloser, string, error)
+	ReadFileHead(ctx context.Context, namespace, pvcName, filePath string, limit int) ([]byte, bool, error)
+	UploadFile(ctx context.Context, namespace, pvcName, destPath string, data io.Reader) error
+	SaveFile(ctx context.Context, namespace, pvcName, filePath string, data []byte) error
+	FileChecksum(ctx context.Context, namespace, pvcName, filePath, algo string) (*k8s.FileChecksum, error)
+	RemoveFile(ctx context.Context, namespace, pvcName, filePath string) error
+	DeleteFile(ctx context.Context, namespace, pvcName, filePath string) error
+	DeleteDirectory(ctx context.Context, namespace, pvcName, dirPath string, recursive bool) error
+	ApplyPermissions(ctx context.Context, namespace, pvcName, filePath string, perms k8s.FilePermissions, isDir bool) (k8s.FilePermissions, error)
+	ChangePermissions(ctx context.Context, namespace, pvcName, filePath string, perms k8s.FilePermissions, recursive bool) error
+	ResolvePath(ctx context.Context, namespace, pvcName, filePath string) (*k8s.PathInfo, error)
+	PathsExist(ctx context.Context, namespace, pvcName string, paths []string) ([]bool, error)
+	CompletePath(ctx context.Context, namespace, pvcName, prefix string) (*k8s.PathCompletion, error)
+	SearchFiles(ctx context.Context, namespace, pvcName string, q k8s.SearchQuery) (*k8s.SearchResult, error)
+	StreamSearch(ctx context.Context, namespace, pvcName string, q k8s.SearchQuery, fn func(k8s.FileInfo) error) (bool, error)
+	DiskUsage(ctx context.Context, namespace, pvcName string, paths []string) (int64, error)
+	StreamDiskUsage(ctx context.Context, namespace, pvcName string, paths []string, maxDepth int, fn func(k8s.DirUsage) error) (int64, error)
+	MeasurePaths(ctx context.Context, namespace, pvcName string, paths []string) (*k8s.PathUsage, error)
+	FilesystemUsage(ctx context.Context, namespace, pvcName string) (*k8s.FilesystemUsage, error)
+
+	StreamArchive(ctx context.Context, namespace, pvcName string, paths, exclude []string, w io.Writer) error
+	UnpackArchive(ctx context.Context, namespace, pvcName, destDir string, r io.Reader) error
+	ListArchive(ctx context.Context, namespace, pvcName, filePath string, limit int) (*k8s.ArchiveListing, error)
+	StreamArchiveMember(ctx context.Context, namespace, pvcName, archivePath, member string, w io.Writer) error
+	ExtractArchiveMembers(ctx context.Context, namespace, pvcName, archivePath string, members []string, destDir string, overwrite bool) error
+
+	Move(ctx context.Context, namespace, pvcName, src, dst string) error
+	MoveBetweenPVCs(ctx context.Context, src k8s.PVCRef, paths []string, dst k8s.PVCRef, destDir string, stage func(k8s.MoveStage), progress func(int64)) (int, error)
+	ClonePVC(ctx context.Context, req k8s.CloneRequest, progress func(int64)) (*k8s.CloneResult, error)
+	MigratePVC(ctx context.Context, req k8s.MigrationRequest, stage func(k8s.MigrationStage)) (*k8s.MigrationReport, error)
+	StartMaintenance(ctx context.Context, namespace, pvcName string, d time.Duration) (*k8s.Maintenance, error)
+	EndMaintenance(ctx context.Context, namespace, pvcName string) (*k8s.Maintenance, error)
+	ListMaintenance(ctx context.Context, namespace string) ([]k8s.Maintenance, error)
+	ListSnapshots(ctx context.Context, namespace, pvcName string) ([]k8s.Snapshot, error)
+	BrowseSnapshot(ctx context.Context, namespace, snapshotName string) (*k8s.SnapshotClaim, error)
+	ReleaseSnapshot(ctx context.Context, namespace, claimName string) error
+	RestoreFromSnapshot(ctx context.Context, req k8s.SnapshotRestoreRequest, progress func(int64)) (*k8s.SnapshotRestoreResult, error)
+
+	ResolvePVCPath(ctx context.Context, namespace, pvcName, filePath string) (*k8s.PVCTarget, error)
+	KubectlCommands(target *k8s.PVCTarget, isDir bool) k8s.KubectlCommands
+
+	ListPods(ctx context.Context, namespace string) ([]k8s.PodInfo, error)
+	ListContainerFiles(ctx context.Context, namespace, podName, containerName, path string) (*k8s.ContainerListing, error)
+	ReadContainerFile(ctx context.Context, namespace, podName, containerName, path string, reveal bool) (*k8s.ContainerFile, error)
+}
+
+var (
+	_ KubeClient = (*k8s.Client)(nil)
+	_ KubeClient = (*k8s.DemoCluster)(nil)
+	_ KubeClient = (*storage.Backend)(nil)
+)
+
+// connectionType is "kubernetes", or the type of a storage backend, so the
+// UI can hide what only clusters offer.
+func connectionType(c KubeClient) string {
+	if b, ok := c.(*storage.Backend); ok {
+		return b.Kind()
+	}
+	return "kubernetes"
+}
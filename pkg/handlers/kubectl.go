@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// KubectlCommandHandler returns the kubectl commands that reproduce an
+// operation on a remote path, for use in scripts or to share with others.
+func (h *Handler) KubectlCommandHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pvc := r.URL.Query().Get("pvc")
+	filePath := r.URL.Query().Get("path")
+	isDir := r.URL.Query().Get("isDir") == "true"
+
+	if namespace == "" || pvc == "" || filePath == "" {
+		h.jsonError(w, "namespace, pvc, and path parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	filePath = sanitizePath(filePath)
+
+	target, err := client.ResolvePVCPath(r.Context(), namespace, pvc, filePath)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"target":   target,
+		"commands": client.KubectlCommands(target, isDir),
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// listingCacheTTL is how long a directory listing, and the df that goes
+// with it, is served again without an exec: KUBE_BROWSER_LISTING_CACHE_SEC
+// seconds, 10 by default, 0 to list every time.
+func listingCacheTTL() time.Duration {
+	return time.Duration(envInt64("KUBE_BROWSER_LISTING_CACHE_SEC", 10)) * time.Second
+}
+
+// listingCacheMax bounds the entries kept; past it, expired ones are
+// dropped and then the cache starts over.
+const listingCacheMax = 1000
+
+type listingKey struct {
+	client    KubeClient
+	namespace string
+	pvc       string
+	// path is the directory listed, or empty for the PVC's df.
+	path string
+}
+
+type cachedListing struct {
+	files   []k8s.FileInfo
+	usage   *k8s.FilesystemUsage
+	expires time.Time
+}
+
+// listingCache remembers recent listings so navigating back and forth
+// does not exec in the pod every time. Anything a request through
+// Activity or a finishing job may have changed is forgotten at once (see
+// invalidate); changes made from inside the pods show up when the entry
+// expires, or with ?refresh=true.
+type listingCache struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	// generation counts invalidations, so a listing that was running
+	// across one is not cached.
+	generation uint64
+	entries    map[listingKey]cachedListing
+}
+
+func (h *Handler) getListingCache() *listingCache {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listings == nil {
+		h.listings = &listingCache{ttl: listingCacheTTL(), entries: map[listingKey]cachedListing{}}
+	}
+	return h.listings
+}
+
+// lookup returns a live entry, and the generation to store a fresh one
+// under otherwise.
+func (c *listingCache) lookup(key listingKey) (cachedListing, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return cachedListing{}, c.generation, false
+	}
+	return entry, c.generation, true
+}
+
+func (c *listingCache) store(key listingKey, generation uint64, entry cachedListing) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	if len(c.entries) >= listingCacheMax {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= listingCacheMax {
+			c.entries = map[listingKey]cachedListing{}
+		}
+	}
+	entry.expires = now.Add(c.ttl)
+	c.entries[key] = entry
+}
+
+// invalidate forgets every listing. Writes are rare next to browsing, and
+// one may touch several PVCs (a transfer, a clone) or a whole subtree (a
+// delete, a move), so nothing finer is worth tracking.
+func (c *listingCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if len(c.entries) > 0 {
+		c.entries = map[listingKey]cachedListing{}
+	}
+}
+
+// listFilesCached lists path like client.ListFiles, from the cache unless
+// refresh is set. The files returned are the caller's to sort.
+func (h *Handler) listFilesCached(ctx context.Context, client KubeClient, namespace, pvc, path string, refresh bool) ([]k8s.FileInfo, error) {
+	cache := h.getListingCache()
+	key := listingKey{client: client, namespace: namespace, pvc: pvc, path: path}
+	entry, generation, ok := cache.lookup(key)
+	if ok && !refresh {
+		return append([]k8s.FileInfo(nil), entry.files...), nil
+	}
+	files, err := client.ListFiles(ctx, namespace, pvc, path)
+	if err != nil {
+		return nil, err
+	}
+	cache.store(key, generation, cachedListing{files: append([]k8s.FileInfo(nil), files...)})
+	return files, nil
+}
+
+// filesystemUsageCached is client.FilesystemUsage through the cache.
+func (h *Handler) filesystemUsageCached(ctx context.Context, client KubeClient, namespace, pvc string, refresh bool) (*k8s.FilesystemUsage, error) {
+	cache := h.getListingCache()
+	key := listingKey{client: client, namespace: namespace, pvc: pvc}
+	entry, generation, ok := cache.lookup(key)
+	if ok && !refresh {
+		return entry.usage, nil
+	}
+	usage, err := client.FilesystemUsage(ctx, namespace, pvc)
+	if err != nil {
+		return nil, err
+	}
+	cache.store(key, generation, cachedListing{usage: usage})
+	return usage, nil
+}
+
+// listingCacheMaxFiles bounds the entries a streamed listing keeps to
+// cache; a larger directory is streamed from the pod every time.
+const listingCacheMaxFiles = 50000
+
+// streamFilesCached is client.StreamFiles through the cache: a cached
+// listing is handed to fn at once, and a streamed one is cached when it
+// completes, unless it is too large.
+func (h *Handler) streamFilesCached(ctx context.Context, client KubeClient, namespace, pvc, path string, refresh bool, fn func(k8s.FileInfo) error) error {
+	cache := h.getListingCache()
+	key := listingKey{client: client, namespace: namespace, pvc: pvc, path: path}
+	entry, generation, ok := cache.lookup(key)
+	if ok && !refresh {
+		for _, f := range entry.files {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	files, keep := []k8s.FileInfo{}, true
+	err := client.StreamFiles(ctx, namespace, pvc, path, func(f k8s.FileInfo) error {
+		if keep = keep && len(files) < listingCacheMaxFiles; keep {
+			files = append(files, f)
+		} else {
+			files = nil
+		}
+		return fn(f)
+	})
+	if err != nil {
+		return err
+	}
+	if keep {
+		cache.store(key, generation, cachedListing{files: files})
+	}
+	return nil
+}
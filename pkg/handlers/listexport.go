@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// listingExportMaxEntries bounds a recursive export; a larger tree is
+// refused rather than exported in part, since an inventory with holes is
+// worse than none.
+const listingExportMaxEntries = 100000
+
+// Listing export formats, for ?export= on /api/files.
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+)
+
+// listingExportColumns are the CSV columns, in order.
+var listingExportColumns = []string{"path", "name", "type", "size", "modTime", "mode", "uid", "gid", "linkTarget"}
+
+// exportFormatFromQuery reads ?export=, empty when the listing is not
+// exported.
+func exportFormatFromQuery(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("export"); f {
+	case "", exportCSV, exportJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("export must be %q or %q", exportCSV, exportJSON)
+}
+
+// listingExport is the JSON form of an export.
+type listingExport struct {
+	Namespace  string         `json:"namespace"`
+	PVC        string         `json:"pvc"`
+	Path       string         `json:"path"`
+	Recursive  bool           `json:"recursive"`
+	Filter     string         `json:"filter,omitempty"`
+	ExportedAt time.Time      `json:"exportedAt"`
+	Count      int            `json:"count"`
+	Files      []k8s.FileInfo `json:"files"`
+}
+
+// exportListing answers /api/files?export=csv|json with the listing as an
+// attachment, for inventories and audits. With ?recursive=true (and
+// optionally ?maxDepth=) the whole tree under path is listed with one
+// search, in path order; otherwise the directory is listed as usual, in
+// the requested order. ?filter= applies to entry names either way.
+func (h *Handler) exportListing(w http.ResponseWriter, r *http.Request, client KubeClient, namespace, pvc, path, format string, order k8s.SortOptions, filter string) {
+	recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive"))
+	var files []k8s.FileInfo
+	if recursive {
+		maxDepth := 0
+		if s := r.URL.Query().Get("maxDepth"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				h.jsonError(w, "maxDepth must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			maxDepth = n
+		}
+		result, err := client.SearchFiles(r.Context(), namespace, pvc, k8s.SearchQuery{Path: path, MaxDepth: maxDepth, Limit: listingExportMaxEntries})
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		if result.Truncated {
+			h.jsonError(w, fmt.Sprintf("%s has more than %d entries; export a smaller directory or limit maxDepth", path, listingExportMaxEntries), http.StatusRequestEntityTooLarge)
+			return
+		}
+		root := gopath.Clean("/" + path)
+		for _, f := range result.Files {
+			if gopath.Clean("/"+f.Path) != root {
+				files = append(files, f)
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	} else {
+		listed, err := h.listFilesCached(r.Context(), client, namespace, pvc, path, false)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		files = listed
+		k8s.SortFiles(files, order)
+	}
+	files = k8s.FilterFiles(files, filter, order.CaseInsensitive)
+	if files == nil {
+		files = []k8s.FileInfo{}
+	}
+
+	name := pvc
+	if base := gopath.Base(path); base != "/" && base != "." {
+		name += "-" + base
+	}
+	name += "-listing." + format
+	w.Header().Set("Content-Disposition", attachmentDisposition(name))
+	if format == exportJSON {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(listingExport{
+			Namespace: namespace, PVC: pvc, Path: path, Recursive: recursive, Filter: filter,
+			ExportedAt: time.Now().UTC(), Count: len(files), Files: files,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write(listingExportColumns)
+	for _, f := range files {
+		cw.Write([]string{csvText(f.Path), csvText(f.Name), entryType(f), f.Size, f.ModTime, f.Mode, f.UID, f.GID, csvText(f.LinkTarget)})
+	}
+	cw.Flush()
+}
+
+// entryType names the kind of entry for the CSV type column.
+func entryType(f k8s.FileInfo) string {
+	switch {
+	case f.Symlink:
+		return "symlink"
+	case f.IsDir:
+		return "dir"
+	}
+	return "file"
+}
+
+// csvText keeps a name that starts like a formula (=, +, -, @) from being
+// evaluated by the spreadsheet the export is opened in, by prefixing a
+// quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// listGrace is how long an asynchronous listing is waited for before the
+// request is answered with an operation ID. A listing from a pod that
+// mounts the PVC finishes well within it; one that has to start a helper
+// pod does not.
+var listGrace = 2 * time.Second
+
+// listOperationTTL is how long a finished listing stays available to be
+// polled.
+const listOperationTTL = 5 * time.Minute
+
+// listOperationTimeout bounds a listing no one waits on anymore.
+const listOperationTimeout = 10 * time.Minute
+
+// listOperation is a directory listing running in the background.
+type listOperation struct {
+	ID        string    `json:"id"`
+	Namespace string    `json:"namespace"`
+	PVC       string    `json:"pvc"`
+	Path      string    `json:"path"`
+	Started   time.Time `json:"started"`
+	// FirstEvent is the latest helper event reported before the listing
+	// started; the events of its helper pod come after it.
+	FirstEvent int64 `json:"eventsSince"`
+
+	// filter, order and page pick the entries the listing answers with
+	// (see addFiles).
+	filter string
+	order  k8s.SortOptions
+	page   listingPage
+
+	cancel     context.CancelFunc
+	done       chan struct{}
+	files      []k8s.FileInfo
+	filesystem *k8s.FilesystemUsage
+	err        error
+	finished   time.Time
+}
+
+type listOperations struct {
+	mu  sync.Mutex
+	ops map[string]*listOperation
+}
+
+func (h *Handler) getListOperations() *listOperations {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listOps == nil {
+		h.listOps = &listOperations{ops: map[string]*listOperation{}}
+	}
+	return h.listOps
+}
+
+// start runs list in the background and records it, dropping the finished
+// operations that expired.
+func (l *listOperations) start(namespace, pvc, path, filter string, order k8s.SortOptions, page listingPage, firstEvent int64, list func(ctx context.Context) ([]k8s.FileInfo, *k8s.FilesystemUsage, error)) *listOperation {
+	ctx, cancel := context.WithTimeout(context.Background(), listOperationTimeout)
+	op := &listOperation{
+		ID:         newID(),
+		Namespace:  namespace,
+		PVC:        pvc,
+		Path:       path,
+		Started:    time.Now(),
+		FirstEvent: firstEvent,
+		filter:     filter,
+		order:      order,
+		page:       page,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+
+	l.mu.Lock()
+	for id, old := range l.ops {
+		if !old.finished.IsZero() && time.Since(old.finished) > listOperationTTL {
+			delete(l.ops, id)
+		}
+	}
+	l.ops[op.ID] = op
+	l.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		files, filesystem, err := list(ctx)
+		l.mu.Lock()
+		op.files, op.filesystem, op.err, op.finished = files, filesystem, err, time.Now()
+		l.mu.Unlock()
+		close(op.done)
+	}()
+	return op
+}
+
+func (l *listOperations) get(id string) (*listOperation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	op, ok := l.ops[id]
+	return op, ok
+}
+
+func (l *listOperations) remove(id string) (*listOperation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	op, ok := l.ops[id]
+	delete(l.ops, id)
+	return op, ok
+}
+
+// writeListing answers with the files of a listing, or its error.
+func (h *Handler) writeListing(w http.ResponseWriter, op *listOperation) {
+	if op.err != nil {
+		h.jsonErrorFromErr(w, op.err, http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]interface{}{
+		"status": "done",
+		"path":   op.Path,
+	}
+	if err := addFiles(resp, op.files, op.filter, op.order, op.page); err != nil {
+		h.jsonPageError(w, err)
+		return
+	}
+	if op.filesystem != nil {
+		resp["filesystem"] = op.filesystem
+	}
+	h.jsonResponse(w, resp)
+}
+
+// startFilesystemUsage runs df on the PVC in the background when asked
+// to, and returns a function waiting for the result. A failing df leaves
+// the result nil rather than failing the listing it goes with. A recent
+// result is reused unless refresh is set (see listingCache).
+func (h *Handler) startFilesystemUsage(ctx context.Context, client KubeClient, namespace, pvc string, df, refresh bool) func() *k8s.FilesystemUsage {
+	if !df {
+		return func() *k8s.FilesystemUsage { return nil }
+	}
+	result := make(chan *k8s.FilesystemUsage, 1)
+	go func() {
+		usage, err := h.filesystemUsageCached(ctx, client, namespace, pvc, refresh)
+		if err != nil {
+			log.Printf("Could not measure the filesystem of PVC %s/%s: %v", namespace, pvc, err)
+		}
+		result <- usage
+	}()
+	return func() *k8s.FilesystemUsage { return <-result }
+}
+
+// listFilesAsync serves /api/files?async=true: the listing is answered
+// like a blocking one when it finishes within listGrace, and otherwise
+// with 202 and the operation to poll, so no request sits open for the
+// minute a helper pod can take to start.
+func (h *Handler) listFilesAsync(w http.ResponseWriter, r *http.Request, client KubeClient, namespace, pvc, path string, order k8s.SortOptions, filter string, page listingPage, df bool) {
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	_, firstEvent, _ := h.getHelperFeed().since(0, namespace, pvc)
+	op := h.getListOperations().start(namespace, pvc, path, filter, order, page, firstEvent, func(ctx context.Context) ([]k8s.FileInfo, *k8s.FilesystemUsage, error) {
+		filesystem := h.startFilesystemUsage(ctx, client, namespace, pvc, df, refresh)
+		files, err := h.listFilesCached(ctx, client, namespace, pvc, path, refresh)
+		if err != nil {
+			return nil, nil, err
+		}
+		k8s.SortFiles(files, order)
+		return files, filesystem(), nil
+	})
+
+	select {
+	case <-op.done:
+		h.getListOperations().remove(op.ID)
+		h.writeListing(w, op)
+	case <-time.After(listGrace):
+		w.Header().Set("Location", "/api/files/operation?id="+op.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    "running",
+			"operation": op,
+		})
+	case <-r.Context().Done():
+		// The operation keeps running; a reload finds the helper pod
+		// already started.
+	}
+}
+
+// ListOperationHandler follows a listing started with
+// /api/files?async=true:
+//
+//	GET    /api/files/operation?id=<id>[&since=<event id>]
+//	DELETE /api/files/operation?id=<id>
+//
+// While it runs, GET answers 202 with the helper pod events reported for
+// the PVC since the listing started (or since the given event), like
+// /api/helper-events, which can also stream them. Once it finishes, GET
+// answers exactly as /api/files would have. DELETE cancels it.
+func (h *Handler) ListOperationHandler(w http.ResponseWriter, r *http.Request) {
+	ops := h.getListOperations()
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		op, ok := ops.get(id)
+		if !ok {
+			h.jsonError(w, "listing operation not found or expired", http.StatusNotFound)
+			return
+		}
+		select {
+		case <-op.done:
+			h.writeListing(w, op)
+			return
+		default:
+		}
+		after := op.FirstEvent
+		if since := r.URL.Query().Get("since"); since != "" {
+			if n, err := strconv.ParseInt(since, 10, 64); err == nil && n > after {
+				after = n
+			}
+		}
+		events, last, _ := h.getHelperFeed().since(after, op.Namespace, op.PVC)
+		if events == nil {
+			events = []helperEvent{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    "running",
+			"operation": op,
+			"events":    events,
+			"last":      last,
+		})
+	case http.MethodDelete:
+		op, ok := ops.remove(id)
+		if !ok {
+			h.jsonError(w, "listing operation not found or expired", http.StatusNotFound)
+			return
+		}
+		op.cancel()
+		h.jsonResponse(w, map[string]interface{}{"canceled": true, "id": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"kube-browser/pkg/k8s"
+)
+
+// listingLimit is the most entries a listing answers with at once, set by
+// KUBE_BROWSER_LISTING_LIMIT (10000 by default, 0 for no limit). A bigger
+// directory is answered a page at a time, so a browser is never handed
+// half a million rows in one response; streamed listings are not limited.
+func listingLimit() int {
+	return int(envInt64("KUBE_BROWSER_LISTING_LIMIT", 10000))
+}
+
+// errListingChanged is the error of a continuation token whose listing no
+// longer has the entry the previous page ended with.
+var errListingChanged = errors.New("the directory changed since the previous page; list it again")
+
+// listingPage is the part of a listing a request asks for: up to limit
+// entries (0 for all of them) after the offset entries a continuation
+// token says were already sent, the last of which was after.
+type listingPage struct {
+	limit  int
+	offset int
+	after  string
+	key    string
+}
+
+// pageToken is a continuation token, base64url-encoded JSON. Key ties it
+// to the directory, filter and order of the listing it continues.
+type pageToken struct {
+	Offset int    `json:"o"`
+	After  string `json:"a"`
+	Key    string `json:"k"`
+}
+
+// pageFromQuery reads ?limit=, which may only lower listingLimit, and
+// ?continue=, the token of a previous page, for a listing of scope (the
+// directory listed) with filter and order.
+func pageFromQuery(r *http.Request, scope, filter string, order k8s.SortOptions) (listingPage, error) {
+	q := r.URL.Query()
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%+v", scope, filter, order)))
+	page := listingPage{limit: listingLimit(), key: hex.EncodeToString(sum[:8])}
+	if page.limit < 0 {
+		page.limit = 0
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return page, fmt.Errorf("limit must be a positive integer")
+		}
+		if page.limit == 0 || n < page.limit {
+			page.limit = n
+		}
+	}
+	if s := q.Get("continue"); s != "" {
+		var token pageToken
+		raw, err := base64.RawURLEncoding.DecodeString(s)
+		if err == nil {
+			err = json.Unmarshal(raw, &token)
+		}
+		if err != nil || token.Offset <= 0 || token.Key != page.key {
+			return page, fmt.Errorf("continue token does not belong to this listing; list it again")
+		}
+		page.offset, page.after = token.Offset, token.After
+	}
+	return page, nil
+}
+
+// addFiles puts a page of a listing's files in resp, keeping those whose
+// name matches filter. A filtered listing also says under "total" how many
+// entries the directory has. When more entries match than the page holds,
+// resp says so under "truncated" and "warning", with how many are left
+// under "remaining" and the token for the next page under "continue".
+func addFiles(resp map[string]interface{}, files []k8s.FileInfo, filter string, order k8s.SortOptions, page listingPage) error {
+	matched := k8s.FilterFiles(files, filter, order.CaseInsensitive)
+	if filter != "" {
+		resp["total"] = len(files)
+	}
+	start := page.offset
+	if start > 0 {
+		if start > len(matched) || matched[start-1].Path != page.after {
+			return errListingChanged
+		}
+		resp["offset"] = start
+	}
+	end := len(matched)
+	if page.limit > 0 && end-start > page.limit {
+		end = start + page.limit
+	}
+	resp["files"] = matched[start:end]
+	if end < len(matched) {
+		raw, _ := json.Marshal(pageToken{Offset: end, After: matched[end-1].Path, Key: page.key})
+		resp["truncated"] = true
+		resp["remaining"] = len(matched) - end
+		resp["continue"] = base64.RawURLEncoding.EncodeToString(raw)
+		resp["warning"] = fmt.Sprintf("This directory has %d entries; showing %d to %d. Load the next page, narrow it with a filter, or stream it.", len(matched), start+1, end)
+	}
+	return nil
+}
+
+// jsonPageError answers a continuation token the listing no longer
+// matches with 409, and any other error as jsonErrorFromErr does.
+func (h *Handler) jsonPageError(w http.ResponseWriter, err error) {
+	if err == errListingChanged {
+		h.jsonError(w, "The directory changed since the previous page; list it again", http.StatusConflict)
+		return
+	}
+	h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+}
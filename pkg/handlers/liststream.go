@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// streamFlushInterval is how often a streamed listing is flushed to the
+// client while entries keep coming.
+const streamFlushInterval = 200 * time.Millisecond
+
+// wantsStreamedListing reports whether /api/files was asked for NDJSON,
+// with ?stream=true or an Accept of application/x-ndjson.
+func wantsStreamedListing(r *http.Request) bool {
+	if stream, _ := strconv.ParseBool(r.URL.Query().Get("stream")); stream {
+		return true
+	}
+	return r.Header.Get("Accept") == "application/x-ndjson"
+}
+
+// streamListing serves /api/files?stream=true as NDJSON: one FileInfo per
+// line, in the order the pod lists them, then a last line with "done",
+// the number of entries sent under "count", "total" when a filter is
+// applied and "filesystem" when df was asked for. The entries are not
+// sorted; sorting needs the whole directory, which is what streaming
+// avoids waiting for.
+//
+// An error before the first entry is answered like any other; one after
+// it ends the stream with a line holding "error" and "kind" instead.
+func (h *Handler) streamListing(w http.ResponseWriter, r *http.Request, client KubeClient, namespace, pvc, path string, order k8s.SortOptions, filter string, df bool) {
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	filesystem := h.startFilesystemUsage(r.Context(), client, namespace, pvc, df, refresh)
+
+	stream := h.newNDJSONStream(w, r)
+	total := 0
+	err := h.streamFilesCached(r.Context(), client, namespace, pvc, path, refresh, func(f k8s.FileInfo) error {
+		total++
+		if !k8s.MatchFilter(f, filter, order.CaseInsensitive) {
+			return nil
+		}
+		return stream.send(f)
+	})
+	if err != nil {
+		stream.fail(err)
+		return
+	}
+
+	trailer := map[string]interface{}{
+		"done":  true,
+		"path":  path,
+		"count": stream.count,
+	}
+	if filter != "" {
+		trailer["total"] = total
+	}
+	if usage := filesystem(); usage != nil {
+		trailer["filesystem"] = usage
+	}
+	stream.end(trailer)
+}
+
+// ndjsonStream answers a request with NDJSON lines as a remote command
+// produces them: listings, searches and du runs. The response starts with
+// the first line, so an error before it is still answered with a status.
+type ndjsonStream struct {
+	h       *Handler
+	w       http.ResponseWriter
+	r       *http.Request
+	rc      *http.ResponseController
+	enc     *json.Encoder
+	started bool
+	// count is the number of lines sent.
+	count     int
+	lastFlush time.Time
+}
+
+func (h *Handler) newNDJSONStream(w http.ResponseWriter, r *http.Request) *ndjsonStream {
+	return &ndjsonStream{h: h, w: w, r: r, rc: http.NewResponseController(w), enc: json.NewEncoder(w), lastFlush: time.Now()}
+}
+
+func (s *ndjsonStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/x-ndjson")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	// A directory of millions of entries outlives the server's
+	// WriteTimeout.
+	s.rc.SetWriteDeadline(time.Time{})
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// send writes one line, flushing at most every streamFlushInterval.
+func (s *ndjsonStream) send(v interface{}) error {
+	s.start()
+	s.count++
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	if time.Since(s.lastFlush) >= streamFlushInterval {
+		s.lastFlush = time.Now()
+		return s.rc.Flush()
+	}
+	return nil
+}
+
+// fail answers err like any other error before the first line, and ends
+// the stream with a line holding "error" and "kind" after it. A stream
+// canceled through /api/operations ends with "canceled" and the number of
+// lines sent, which stand as partial results.
+func (s *ndjsonStream) fail(err error) {
+	if !s.started {
+		s.h.jsonErrorFromErr(s.w, err, http.StatusInternalServerError)
+		return
+	}
+	if errors.Is(s.r.Context().Err(), context.Canceled) {
+		s.enc.Encode(map[string]interface{}{"error": "Operation canceled", "kind": "Canceled", "canceled": true, "count": s.count})
+	} else {
+		s.enc.Encode(streamError(err))
+	}
+	s.rc.Flush()
+}
+
+// end writes the last line.
+func (s *ndjsonStream) end(trailer interface{}) {
+	s.start()
+	s.enc.Encode(trailer)
+	s.rc.Flush()
+}
+
+// streamError is the last line of a stream that failed, with the fields
+// jsonErrorFromErr answers with.
+func streamError(err error) map[string]string {
+	var k8sErr *k8s.K8sError
+	if errors.As(err, &k8sErr) {
+		return map[string]string{"error": k8sErr.Message, "kind": string(k8sErr.Kind)}
+	}
+	return map[string]string{"error": err.Error(), "kind": string(k8s.ErrKindUnknown)}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// DownloadToLocalHandler saves a PVC file (or a directory, as a .tar.gz)
+// into a directory on the KubeBrowser host instead of streaming it to the
+// browser. This is what you want when KubeBrowser runs on a jump host and
+// the browser is on another machine. Like /api/browse it touches the local
+// filesystem, so it is registered behind LocalhostOnly.
+func (h *Handler) DownloadToLocalHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Namespace string   `json:"namespace"`
+		PVC       string   `json:"pvc"`
+		Path      string   `json:"path"`
+		IsDir     bool     `json:"isDir"`
+		DestDir   string   `json:"destDir"`
+		Overwrite bool     `json:"overwrite"`
+		Exclude   []string `json:"exclude"`
+		Delta     bool     `json:"delta"`
+		Preserve  *bool    `json:"preserve"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMetaFieldSize)).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || req.Path == "" || req.DestDir == "" {
+		h.jsonError(w, "namespace, pvc, path and destDir are required", http.StatusBadRequest)
+		return
+	}
+
+	destDir := filepath.Clean(req.DestDir)
+	noteActivity(r, req.Namespace, req.PVC, sanitizePath(req.Path), "Save to "+destDir)
+	if !filepath.IsAbs(destDir) {
+		h.jsonError(w, "destDir must be an absolute path", http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Stat(destDir); err != nil || !info.IsDir() {
+		h.jsonError(w, fmt.Sprintf("destDir %s is not an existing directory", destDir), http.StatusBadRequest)
+		return
+	}
+
+	exclude, err := k8s.CleanExcludes(req.Exclude)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filePath := sanitizePath(req.Path)
+	name := path.Base(filePath)
+	if req.IsDir {
+		name = archiveName(req.PVC, []string{filePath})
+	}
+	target := filepath.Join(destDir, name)
+	if _, err := os.Stat(target); err == nil && !req.Overwrite {
+		h.jsonError(w, fmt.Sprintf("%s already exists", target), http.StatusConflict)
+		return
+	}
+
+	tmp, err := os.CreateTemp(destDir, ".kube-browser-*.part")
+	if err != nil {
+		h.jsonError(w, "Failed to create local file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer h.removeLocalFile(tmp.Name())
+
+	// The copy runs at cluster speed rather than browser speed, but large
+	// files still outlive the server's WriteTimeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	var size int64
+	var delta *deltaResult
+	// The file's mode and modification time in the pod, when known.
+	var mode int64
+	var modTime time.Time
+	if req.Delta && req.Overwrite && !req.IsDir {
+		// Only the blocks the file being replaced lacks are read from the
+		// pod; anything that rules a delta out falls back to a full copy.
+		delta, err = deltaSave(r.Context(), client, req.Namespace, req.PVC, filePath, target, tmp)
+	}
+	switch {
+	case delta != nil:
+		size, modTime = delta.size, delta.modTime
+		// The signature has no mode; the copy being replaced has the one
+		// it was saved with.
+		if info, statErr := os.Stat(target); statErr == nil {
+			mode = int64(info.Mode().Perm())
+		}
+	case err != nil:
+	case req.IsDir:
+		cw := &countingFileWriter{f: tmp}
+		err = client.StreamArchive(r.Context(), req.Namespace, req.PVC, []string{filePath}, exclude, cw)
+		size = cw.n
+	default:
+		var reader io.ReadCloser
+		reader, _, err = client.DownloadFile(r.Context(), req.Namespace, req.PVC, filePath)
+		if err == nil {
+			size, err = io.Copy(tmp, reader)
+			if fh, ok := reader.(k8s.FileHeader); ok && fh.Header() != nil {
+				mode, modTime = fh.Header().Mode, fh.Header().ModTime
+			}
+			reader.Close()
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && preserveOption(req.Preserve) {
+		err = setLocalMetadata(tmp.Name(), mode, modTime)
+	}
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		h.jsonError(w, "Failed to save local file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Saved %s/%s:%s to %s (%d bytes)", req.Namespace, req.PVC, filePath, target, size)
+
+	resp := map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Saved to %s", target),
+		"path":    target,
+		"size":    size,
+	}
+	if delta != nil {
+		resp["delta"] = delta.stats
+	}
+	h.jsonResponse(w, resp)
+}
+
+type countingFileWriter struct {
+	f *os.File
+	n int64
+}
+
+func (cw *countingFileWriter) Write(p []byte) (int, error) {
+	n, err := cw.f.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// localDirTar writes srcDir, a directory on the KubeBrowser host, to w as
+// a tar whose names start with the directory's own name, leaving out
+// entries matching exclude. Symlinks are kept as links and not followed;
+// other special files are skipped. It returns the number of regular files
+// and their bytes.
+func localDirTar(w io.Writer, srcDir string, exclude []string) (int, int64, error) {
+	base := filepath.Base(srcDir)
+	tw := tar.NewWriter(w)
+	var files int
+	var written int64
+	err := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(base, filepath.ToSlash(rel))
+		if rel != "." && k8s.ExcludedPath(exclude, name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		switch {
+		case d.IsDir(), info.Mode().IsRegular():
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		// Local owners mean nothing in the pod.
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(tw, io.LimitReader(f, hdr.Size))
+		written += n
+		if err != nil {
+			return err
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return files, written, err
+	}
+	return files, written, tw.Close()
+}
+
+// UploadLocalDirHandler copies a directory on the KubeBrowser host onto a
+// PVC, for pushing a website build or a dataset from a jump host in one
+// operation:
+//
+//	POST /api/upload-local-dir {namespace, pvc, srcDir, destDir, exclude}
+//
+// The directory lands in destDir (default /) under its own name. It is
+// read and sent as a tar stream, so nothing is staged on either side, and
+// unpacked by tar in the pod. Like /api/download-local it reads the local
+// filesystem, so it is registered behind LocalhostOnly.
+func (h *Handler) UploadLocalDirHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Namespace string   `json:"namespace"`
+		PVC       string   `json:"pvc"`
+		SrcDir    string   `json:"srcDir"`
+		DestDir   string   `json:"destDir"`
+		Exclude   []string `json:"exclude"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMetaFieldSize)).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || req.SrcDir == "" {
+		h.jsonError(w, "namespace, pvc and srcDir are required", http.StatusBadRequest)
+		return
+	}
+	srcDir := filepath.Clean(req.SrcDir)
+	noteActivity(r, req.Namespace, req.PVC, sanitizePath(req.DestDir), "From "+srcDir)
+	if !filepath.IsAbs(srcDir) {
+		h.jsonError(w, "srcDir must be an absolute path", http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		h.jsonError(w, fmt.Sprintf("srcDir %s is not an existing directory", srcDir), http.StatusBadRequest)
+		return
+	}
+	if filepath.Dir(srcDir) == srcDir {
+		h.jsonError(w, "srcDir cannot be a filesystem root", http.StatusBadRequest)
+		return
+	}
+	exclude, err := k8s.CleanExcludes(req.Exclude)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	destDir := sanitizePath(req.DestDir)
+	if h.refuseTrashWrite(w, destDir) {
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	start := time.Now()
+	pr, pw := io.Pipe()
+	type result struct {
+		files int
+		bytes int64
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		files, n, err := localDirTar(pw, srcDir, exclude)
+		pw.CloseWithError(err)
+		done <- result{files, n, err}
+	}()
+	unpackErr := client.UnpackArchive(r.Context(), req.Namespace, req.PVC, destDir, pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	res := <-done
+	if res.err != nil && !errors.Is(res.err, io.ErrClosedPipe) {
+		h.jsonError(w, fmt.Sprintf("reading %s: %v", srcDir, res.err), http.StatusInternalServerError)
+		return
+	}
+	if unpackErr != nil {
+		h.jsonErrorFromErr(w, unpackErr, http.StatusInternalServerError)
+		return
+	}
+	h.throughput.record(client, res.bytes, time.Since(start))
+
+	target := path.Join(destDir, filepath.Base(srcDir))
+	log.Printf("Uploaded %s to %s/%s:%s (%d files, %d bytes)", srcDir, req.Namespace, req.PVC, target, res.files, res.bytes)
+	h.jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Uploaded %d files to %s", res.files, target),
+		"path":    target,
+		"files":   res.files,
+		"bytes":   res.bytes,
+	})
+}
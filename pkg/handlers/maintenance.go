@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindMaintenance scales down the workloads using a claim and starts a
+// helper pod with exclusive access to it (see k8s.Client.StartMaintenance).
+// Waiting for the workloads' pods to go away can take minutes.
+const jobKindMaintenance = "maintenance"
+
+// maintenanceDefaultMinutes is how long a session lasts when the request
+// does not say.
+const maintenanceDefaultMinutes = 30
+
+type maintenanceRequest struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+	Minutes   int    `json:"minutes,omitempty"`
+}
+
+// maintenanceMaxMinutes reads KUBE_BROWSER_MAINTENANCE_MAX_MINUTES, the
+// longest session anyone can start. Workloads stay down that long if
+// nobody ends it.
+func maintenanceMaxMinutes() int {
+	if v := os.Getenv("KUBE_BROWSER_MAINTENANCE_MAX_MINUTES"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("Warning: invalid KUBE_BROWSER_MAINTENANCE_MAX_MINUTES %q, using 240", v)
+	}
+	return 240
+}
+
+func (h *Handler) runMaintenanceJob(ctx context.Context, jh *jobs.Handle) error {
+	var req maintenanceRequest
+	if err := jh.Params(&req); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+	m, err := client.StartMaintenance(ctx, req.Namespace, req.PVC, time.Duration(req.Minutes)*time.Minute)
+	if err != nil {
+		return err
+	}
+	h.scheduleMaintenanceEnd(client, m.Namespace, m.Until)
+	return jh.SetResult(m)
+}
+
+// scheduleMaintenanceEnd ends the sessions of namespace that are over at
+// until. A session extended meanwhile is left running; its own timer ends
+// it. Timers do not survive a restart: the next listing ends what expired
+// while KubeBrowser was down.
+func (h *Handler) scheduleMaintenanceEnd(client KubeClient, namespace string, until time.Time) {
+	time.AfterFunc(time.Until(until), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if _, err := h.endExpiredMaintenance(ctx, client, namespace); err != nil {
+			log.Printf("Warning: ending maintenance in %s: %v", namespace, err)
+		}
+	})
+}
+
+// endExpiredMaintenance ends the sessions of namespace whose time is up,
+// records each in the activity feed, and returns those still running.
+func (h *Handler) endExpiredMaintenance(ctx context.Context, client KubeClient, namespace string) ([]k8s.Maintenance, error) {
+	sessions, err := client.ListMaintenance(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	running := []k8s.Maintenance{}
+	for _, m := range sessions {
+		if time.Now().Before(m.Until) {
+			running = append(running, m)
+			continue
+		}
+		start := time.Now()
+		ev := activityEvent{
+			Time:      start,
+			User:      "kube-browser",
+			Action:    jobKindMaintenance,
+			Namespace: m.Namespace,
+			PVC:       m.PVC,
+			Detail:    "Ended at its time limit",
+			Result:    activitySucceeded,
+		}
+		if _, err := client.EndMaintenance(ctx, m.Namespace, m.PVC); err != nil {
+			log.Printf("Warning: ending maintenance of %s/%s: %v", m.Namespace, m.PVC, err)
+			ev.Result, ev.Error = activityFailed, err.Error()
+		}
+		ev.DurationMS = time.Since(start).Milliseconds()
+		h.getActivity().publish(ev)
+	}
+	return running, nil
+}
+
+// MaintenanceHandler manages maintenance sessions, in which the
+// Deployments and StatefulSets using a claim are scaled to zero so a
+// helper pod can have a ReadWriteOnce volume to itself:
+//
+//	GET    /api/maintenance?namespace=
+//	POST   /api/maintenance {namespace, pvc, minutes}
+//	DELETE /api/maintenance?namespace=&pvc=
+//
+// POST starts a session, or extends a running one, as a background job.
+// DELETE ends it early; either way the workloads get their replica counts
+// back.
+func (h *Handler) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if (r.Method == http.MethodPost || r.Method == http.MethodDelete) && h.checkReadOnly(w) {
+		return
+	}
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		namespace := r.URL.Query().Get("namespace")
+		if namespace == "" {
+			h.jsonError(w, "namespace is required", http.StatusBadRequest)
+			return
+		}
+		sessions, err := h.endExpiredMaintenance(r.Context(), client, namespace)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, map[string]interface{}{"sessions": sessions})
+
+	case http.MethodPost:
+		var req maintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Namespace == "" || req.PVC == "" {
+			h.jsonError(w, "namespace and pvc are required", http.StatusBadRequest)
+			return
+		}
+		if req.Minutes == 0 {
+			req.Minutes = maintenanceDefaultMinutes
+		}
+		if max := maintenanceMaxMinutes(); req.Minutes < 0 || req.Minutes > max {
+			h.jsonError(w, fmt.Sprintf("minutes must be between 1 and %d", max), http.StatusBadRequest)
+			return
+		}
+
+		desc := fmt.Sprintf("Maintenance of %s/%s for %d min", req.Namespace, req.PVC, req.Minutes)
+		noteActivity(r, req.Namespace, req.PVC, "", desc)
+		job, err := h.getJobs().Submit(jobKindMaintenance, desc, req)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		noteActivityJob(r, job)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+
+	case http.MethodDelete:
+		namespace, pvc := r.URL.Query().Get("namespace"), r.URL.Query().Get("pvc")
+		if namespace == "" || pvc == "" {
+			h.jsonError(w, "namespace and pvc are required", http.StatusBadRequest)
+			return
+		}
+		noteActivity(r, namespace, pvc, "", "End maintenance")
+		m, err := client.EndMaintenance(r.Context(), namespace, pvc)
+		if err != nil {
+			code := http.StatusInternalServerError
+			var kerr *k8s.K8sError
+			if errors.As(err, &kerr) && kerr.Kind == k8s.ErrKindPathNotFound {
+				code = http.StatusNotFound
+			}
+			h.jsonErrorFromErr(w, err, code)
+			return
+		}
+		h.jsonResponse(w, m)
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindMigrate copies a PVC onto a new claim of another storage class
+// with an in-cluster Job and reports the patches that switch its workloads
+// over. The source claim is left untouched.
+const jobKindMigrate = "migrate"
+
+type migrateResult struct {
+	Stage  k8s.MigrationStage   `json:"stage"`
+	Report *k8s.MigrationReport `json:"report,omitempty"`
+}
+
+func (h *Handler) runMigrateJob(ctx context.Context, jh *jobs.Handle) error {
+	var req k8s.MigrationRequest
+	if err := jh.Params(&req); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+	report, err := client.MigratePVC(ctx, req, func(s k8s.MigrationStage) {
+		jh.SetResult(migrateResult{Stage: s})
+	})
+	if err != nil {
+		return err
+	}
+	return jh.SetResult(migrateResult{Stage: "done", Report: report})
+}
+
+// MigrateHandler starts a storage-class migration:
+// POST /api/migrate {namespace, pvc, storageClass, target, size}.
+// The job's result carries the current stage and, once done, the report
+// with the kubectl patch for each workload.
+func (h *Handler) MigrateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	if h.getClient() == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req k8s.MigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || req.StorageClass == "" {
+		h.jsonError(w, "namespace, pvc and storageClass are required", http.StatusBadRequest)
+		return
+	}
+
+	noteActivity(r, req.Namespace, req.PVC, "", "")
+	job, err := h.submitJob(r, jobKindMigrate, fmt.Sprintf("Migrate %s/%s to storage class %s", req.Namespace, req.PVC, req.StorageClass), req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// StorageClassesHandler lists the cluster's storage classes for the
+// migration assistant.
+func (h *Handler) StorageClassesHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	names, err := client.StorageClasses(r.Context())
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, map[string]interface{}{"storageClasses": names})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindMove moves paths from one PVC to another: the data is streamed
+// between two execs, verified by checksum, and only then deleted from the
+// source. It is meant for rebalancing data between storage classes.
+const jobKindMove = "move"
+
+type moveParams struct {
+	Namespace     string   `json:"namespace"`
+	PVC           string   `json:"pvc"`
+	Paths         []string `json:"paths"`
+	DestNamespace string   `json:"destNamespace"`
+	DestPVC       string   `json:"destPvc"`
+	DestDir       string   `json:"destDir"`
+	// Compress is as for a transfer.
+	Compress  string `json:"compress,omitempty"`
+	Estimated int64  `json:"estimatedBytes"`
+}
+
+type moveResult struct {
+	Stage k8s.MoveStage `json:"stage"`
+	Files int           `json:"files,omitempty"`
+}
+
+func (h *Handler) runMoveJob(ctx context.Context, jh *jobs.Handle) error {
+	var p moveParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+
+	src := k8s.PVCRef{Namespace: p.Namespace, PVC: p.PVC}
+	dst := k8s.PVCRef{Namespace: p.DestNamespace, PVC: p.DestPVC}
+	ctx = withTransferCompression(ctx, p.Compress)
+	start := time.Now()
+	var copied int64
+	files, err := client.MoveBetweenPVCs(ctx, src, p.Paths, dst, p.DestDir,
+		func(s k8s.MoveStage) { jh.SetResult(moveResult{Stage: s}) },
+		func(n int64) { copied = n; jh.SetProgress(n, p.Estimated) })
+	if err != nil {
+		return err
+	}
+	h.throughput.record(client, copied, time.Since(start))
+	log.Printf("Moved %d file(s) from %s to %s:%s", files, src, dst, p.DestDir)
+	return jh.SetResult(moveResult{Stage: "done", Files: files})
+}
+
+// MoveHandler renames a path within a PVC, or queues a move between two
+// PVCs of the connected cluster:
+//
+//	POST /api/move {namespace, pvc, from, to}
+//	POST /api/move {namespace, pvc, paths, destNamespace, destPvc, destDir}
+//
+// A rename runs mv in the pod and answers when it is done; to is the full
+// new path. For a move between PVCs, destNamespace defaults to namespace
+// and destDir to "/", and progress and the current stage are reported by
+// /api/jobs.
+func (h *Handler) MoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+
+	var body struct {
+		moveParams
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.From != "" || body.To != "" {
+		h.rename(w, r, body.Namespace, body.PVC, body.From, body.To)
+		return
+	}
+
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	req := body.moveParams
+	if req.DestNamespace == "" {
+		req.DestNamespace = req.Namespace
+	}
+	if req.Namespace == "" || req.PVC == "" || req.DestPVC == "" || len(req.Paths) == 0 {
+		h.jsonError(w, "namespace, pvc, destPvc and paths are required", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == req.DestNamespace && req.PVC == req.DestPVC {
+		h.jsonError(w, "source and destination are the same PVC", http.StatusBadRequest)
+		return
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = sanitizePath(p)
+		if req.Paths[i] == "/" {
+			h.jsonError(w, "cannot move the root of a PVC; select the entries inside it", http.StatusBadRequest)
+			return
+		}
+	}
+	req.DestDir = sanitizePath(req.DestDir)
+	if h.refuseTrashWrite(w, req.DestDir) {
+		return
+	}
+	if err := checkTransferCompression(req.Compress); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	estimated, err := client.DiskUsage(r.Context(), req.Namespace, req.PVC, req.Paths)
+	if err != nil {
+		log.Printf("Could not estimate move size for %s/%s: %v", req.Namespace, req.PVC, err)
+		estimated = 0
+	}
+	req.Estimated = estimated
+
+	desc := fmt.Sprintf("Move %s from %s/%s to %s/%s", path.Base(req.Paths[0]), req.Namespace, req.PVC, req.DestNamespace, req.DestPVC)
+	if len(req.Paths) > 1 {
+		desc = fmt.Sprintf("Move %d items from %s/%s to %s/%s", len(req.Paths), req.Namespace, req.PVC, req.DestNamespace, req.DestPVC)
+	}
+	noteActivity(r, req.Namespace, req.PVC, req.Paths[0], "")
+	job, err := h.submitJob(r, jobKindMove, desc, req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// rename moves from to to within one PVC of the connection r addresses.
+func (h *Handler) rename(w http.ResponseWriter, r *http.Request, namespace, pvc, from, to string) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	if namespace == "" || pvc == "" || from == "" || to == "" {
+		h.jsonError(w, "namespace, pvc, from and to are required", http.StatusBadRequest)
+		return
+	}
+	from, to = sanitizePath(from), sanitizePath(to)
+	noteActivity(r, namespace, pvc, from, "Rename to "+to)
+	if from == "/" || to == "/" {
+		h.jsonError(w, "cannot move the root of a PVC, or onto it", http.StatusBadRequest)
+		return
+	}
+	if h.refuseTrashWrite(w, to) {
+		return
+	}
+
+	if err := client.Move(r.Context(), namespace, pvc, from, to); err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Moved %s to %s on %s/%s", from, to, namespace, pvc)
+	h.jsonResponse(w, map[string]interface{}{"from": from, "to": to})
+}
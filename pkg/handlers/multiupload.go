@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// uploadConcurrency reads KUBE_BROWSER_UPLOAD_CONCURRENCY, the most files
+// of one multi-file upload written to the PVC at once (default 4). Every
+// file still takes its exec session from the shared limit.
+func uploadConcurrency() int {
+	if v := os.Getenv("KUBE_BROWSER_UPLOAD_CONCURRENCY"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("Warning: invalid KUBE_BROWSER_UPLOAD_CONCURRENCY %q, using 4", v)
+	}
+	return 4
+}
+
+// uploadItem is one file of a multi-file upload, spooled while the rest
+// of the form is read. err is set, and spooled nil, when the file itself
+// was refused; the other files are uploaded regardless.
+type uploadItem struct {
+	name    string
+	spooled *spooledUpload
+	mtime   int64
+	err     error
+}
+
+// spoolUploadItem spools a file part named "files". size and mtime are
+// the fields that preceded it, -1 and 0 when there were none. Only an
+// error that ends the whole upload is returned.
+func (h *Handler) spoolUploadItem(part *multipart.Part, size, mtime int64) (*uploadItem, error) {
+	item := &uploadItem{name: path.Base(strings.ReplaceAll(part.FileName(), "\\", "/")), mtime: mtime}
+	if size > maxUploadSize() {
+		item.err = fmt.Errorf("file too large: maximum upload size is %d bytes", maxUploadSize())
+		return item, nil
+	}
+	spooled, limited, err := h.spoolUpload(part, maxUploadSize())
+	switch {
+	case limited != nil && limited.exceeded:
+		item.err = fmt.Errorf("file too large: maximum upload size is %d bytes", maxUploadSize())
+		return item, nil
+	case err != nil:
+		return nil, err
+	}
+	if size >= 0 && spooled.size != size {
+		h.removeSpooledUpload(spooled)
+		item.err = fmt.Errorf("the file ended after %d of its %d bytes", spooled.size, size)
+		return item, nil
+	}
+	item.spooled = spooled
+	return item, nil
+}
+
+// uploadFiles writes the files of a multi-file upload into destDir, up to
+// uploadConcurrency at a time, and answers with how each one fared under
+// "files", in the order they were sent: each entry is what a single-file
+// upload would have answered, or its "error" and "kind". Files that
+// already exist are handled as policy says, all checked at once before any
+// is written. With verify, the files uploaded are read back from another
+// node by a single job, named under "verifyJob". The request succeeds as
+// long as it could be read; "success" is only true when every file was
+// uploaded or skipped.
+func (h *Handler) uploadFiles(w http.ResponseWriter, r *http.Request, client KubeClient, namespace, pvc, destDir string, perms k8s.FilePermissions, extract, preserve, verify bool, policy string, items []*uploadItem) {
+	if destDir == "" {
+		destDir = "/"
+	}
+	noteActivity(r, namespace, pvc, destDir, fmt.Sprintf("Upload %d files", len(items)))
+	if h.refuseTrashWrite(w, destDir) {
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, item := range items {
+		if item.err == nil && seen[item.name] {
+			item.err = fmt.Errorf("another file of this upload is named %s", item.name)
+		}
+		if item.err == nil && inTrash(path.Join("/", destDir, item.name)) {
+			item.err = fmt.Errorf("cannot write into %s; only deleting puts entries there", trashDir)
+		}
+		seen[item.name] = true
+	}
+
+	targets := make([]uploadTarget, len(items))
+	if !extract {
+		paths := make([]string, len(items))
+		for i, item := range items {
+			paths[i] = path.Join("/", destDir, item.name)
+		}
+		planned, err := planUploads(r.Context(), client, namespace, pvc, paths, policy)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		targets = planned
+	}
+
+	results := make([]map[string]interface{}, len(items))
+	sem := make(chan struct{}, uploadConcurrency())
+	var wg sync.WaitGroup
+	for i, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.uploadItem(r.Context(), client, namespace, pvc, destDir, perms, extract, preserve, verify, targets[i], item)
+		}()
+	}
+	wg.Wait()
+
+	uploaded, skipped := 0, 0
+	var written []k8s.ReadBackFile
+	for _, res := range results {
+		if res["skipped"] == true {
+			skipped++
+		} else if res["success"] == true {
+			uploaded++
+			if sum, ok := res["sha256"].(string); ok {
+				written = append(written, k8s.ReadBackFile{Path: res["path"].(string), Expected: sum})
+			}
+		}
+	}
+	resp := map[string]interface{}{
+		"success":  uploaded+skipped == len(items),
+		"message":  fmt.Sprintf("Uploaded %d of %d files to %s", uploaded, len(items), destDir),
+		"files":    results,
+		"uploaded": uploaded,
+		"skipped":  skipped,
+		"failed":   len(items) - uploaded - skipped,
+	}
+	if verify {
+		h.queueVerify(r, namespace, pvc, written, resp)
+	}
+	h.jsonResponse(w, resp)
+}
+
+// uploadItem writes, or with extract unpacks, one file of a multi-file
+// upload, with its mtime when preserve is set. Unless extracting, the file
+// goes where target says; with verify, its sha256 is kept under "sha256".
+func (h *Handler) uploadItem(ctx context.Context, client KubeClient, namespace, pvc, destDir string, perms k8s.FilePermissions, extract, preserve, verify bool, target uploadTarget, item *uploadItem) map[string]interface{} {
+	res := map[string]interface{}{"success": false, "filename": item.name}
+	fail := func(err error) map[string]interface{} {
+		res["error"], res["kind"] = err.Error(), string(k8s.ErrKindUnknown)
+		var k8sErr *k8s.K8sError
+		if errors.As(err, &k8sErr) {
+			res["error"], res["kind"] = k8sErr.Message, string(k8sErr.Kind)
+		}
+		return res
+	}
+	if item.err != nil {
+		return fail(item.err)
+	}
+
+	start := time.Now()
+	if extract {
+		if _, ok := uploadArchiveFormat(item.name); !ok {
+			return fail(errors.New("extract needs a .tar, .tar.gz, .tgz or .zip file"))
+		}
+		files, err := h.extractUpload(ctx, client, namespace, pvc, destDir, item.name, item.spooled.f, item.spooled, preserve)
+		if err != nil {
+			return fail(err)
+		}
+		h.throughput.record(client, item.spooled.size, time.Since(start))
+		res["success"], res["extracted"], res["path"] = true, files, destDir
+		res["message"] = fmt.Sprintf("Extracted %d files from %s into %s", files, item.name, destDir)
+		return res
+	}
+
+	if target.err != nil {
+		return fail(target.err)
+	}
+	destPath := target.path
+	if target.skip {
+		res["success"], res["skipped"], res["path"] = true, true, destPath
+		res["message"] = fmt.Sprintf("%s already exists; skipped", destPath)
+		return res
+	}
+	if target.renamed {
+		res["filename"], res["renamed"] = path.Base(destPath), true
+	}
+	hasher := newUploadHasher()
+	src := &k8s.UploadSource{Reader: item.spooled.f, Size: item.spooled.size}
+	if verify {
+		src.Reader = hasher.wrap(item.spooled.f)
+	}
+	if item.mtime > 0 && preserve {
+		src.ModTime = time.UnixMilli(item.mtime)
+	}
+	if err := client.UploadFile(ctx, namespace, pvc, destPath, src); err != nil {
+		return fail(err)
+	}
+	h.throughput.record(client, item.spooled.size, time.Since(start))
+	res["success"], res["path"] = true, destPath
+	res["message"] = fmt.Sprintf("File %s uploaded successfully", res["filename"])
+	if verify {
+		res["sha256"] = hasher.sum()
+	}
+	h.applyUploadPermissions(ctx, client, namespace, pvc, destPath, perms, res)
+	return res
+}
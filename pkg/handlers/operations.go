@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// operationIDHeader carries the ID of a cancelable request. A client may
+// choose it, to be able to cancel a request whose response has not
+// started yet; it is always sent back.
+const operationIDHeader = "X-Operation-Id"
+
+// statusCanceled answers a request canceled through /api/operations
+// before it answered, as nginx logs a request its client closed.
+const statusCanceled = 499
+
+// validOperationID is what a client-chosen operation ID may look like.
+var validOperationID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// operation is a long-running request that can be canceled from another
+// one: a search, a download, a checksum, a size estimate.
+type operation struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	User       string    `json:"user"`
+	Namespaces []string  `json:"namespaces,omitempty"`
+	PVC        string    `json:"pvc,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Started    time.Time `json:"started"`
+
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+type operations struct {
+	mu  sync.Mutex
+	ops map[string]*operation
+}
+
+func (h *Handler) getOperations() *operations {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.operations == nil {
+		h.operations = &operations{ops: map[string]*operation{}}
+	}
+	return h.operations
+}
+
+// add records op unless its ID is taken.
+func (o *operations) add(op *operation) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.ops[op.ID]; ok {
+		return false
+	}
+	o.ops[op.ID] = op
+	return true
+}
+
+func (o *operations) remove(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.ops, id)
+}
+
+func (o *operations) get(id string) (*operation, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	op, ok := o.ops[id]
+	return op, ok
+}
+
+// cancel stops the operation id, reporting whether it was running.
+func (o *operations) cancel(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	op, ok := o.ops[id]
+	if !ok {
+		return false
+	}
+	op.canceled = true
+	op.cancel()
+	return true
+}
+
+func (o *operations) isCanceled(op *operation) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return op.canceled
+}
+
+// list returns the running operations, oldest first.
+func (o *operations) list() []operation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make([]operation, 0, len(o.ops))
+	for _, op := range o.ops {
+		out = append(out, *op)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+	return out
+}
+
+// cancelableWriter drops what the handler of a canceled operation writes
+// before its response started, so Cancelable can answer for it instead of
+// the handler reporting a timeout.
+type cancelableWriter struct {
+	http.ResponseWriter
+	ops     *operations
+	op      *operation
+	started bool
+	dropped bool
+}
+
+func (cw *cancelableWriter) WriteHeader(code int) {
+	if cw.started || cw.dropped {
+		return
+	}
+	if cw.ops.isCanceled(cw.op) {
+		cw.dropped = true
+		return
+	}
+	cw.started = true
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cancelableWriter) Write(b []byte) (int, error) {
+	if !cw.started {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.dropped {
+		return len(b), nil
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (cw *cancelableWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+// Cancelable records the requests next serves as operations of kind that
+// DELETE /api/operations can cancel, for the searches, downloads and du
+// runs a user would otherwise have to wait out. Canceling ends the
+// request's context, which closes its exec stream; a request canceled
+// before it answered gets statusCanceled with kind "Canceled". The
+// operation's ID is the one the client sent in X-Operation-Id or the
+// operation query parameter, or a new one, and is sent back in
+// X-Operation-Id.
+func (h *Handler) Cancelable(kind string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(operationIDHeader)
+		if id == "" {
+			id = r.URL.Query().Get("operation")
+		}
+		if id == "" {
+			id = newID()
+		} else if !validOperationID.MatchString(id) {
+			h.jsonError(w, "operation ID must be 1 to 64 letters, digits, '-' or '_'", http.StatusBadRequest)
+			return
+		}
+		namespaces, _ := h.requestNamespaces(r)
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		q := r.URL.Query()
+		op := &operation{
+			ID:         id,
+			Kind:       kind,
+			User:       requestUser(r),
+			Namespaces: uniqueStrings(namespaces),
+			PVC:        q.Get("pvc"),
+			Path:       q.Get("path"),
+			Started:    time.Now(),
+			cancel:     cancel,
+		}
+		ops := h.getOperations()
+		if !ops.add(op) {
+			h.jsonError(w, "an operation with this ID is already running", http.StatusConflict)
+			return
+		}
+		defer ops.remove(id)
+
+		w.Header().Set(operationIDHeader, id)
+		cw := &cancelableWriter{ResponseWriter: w, ops: ops, op: op}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+		if cw.dropped || (!cw.started && ops.isCanceled(op)) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCanceled)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Operation canceled", "kind": "Canceled"})
+		}
+	})
+}
+
+// uniqueStrings drops repeated values, keeping the first of each.
+func uniqueStrings(values []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// OperationsHandler lists and cancels the cancelable requests running on
+// the server (see Cancelable):
+//
+//	GET    /api/operations
+//	DELETE /api/operations?id=<id>
+//
+// GET only lists, and DELETE only cancels, the operations in namespaces
+// the user may read; any other is answered as not found.
+func (h *Handler) OperationsHandler(w http.ResponseWriter, r *http.Request) {
+	ops := h.getOperations()
+	switch r.Method {
+	case http.MethodGet:
+		a, limited := requestAccess(r)
+		list := []operation{}
+		for _, op := range ops.list() {
+			if limited && !a.admin() && !allowsAll(a, op.Namespaces) {
+				continue
+			}
+			list = append(list, op)
+		}
+		h.jsonResponse(w, map[string]interface{}{"operations": list})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			h.jsonError(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		if a, limited := requestAccess(r); limited && !a.admin() {
+			if op, ok := ops.get(id); ok && !allowsAll(a, op.Namespaces) {
+				h.jsonError(w, "operation not found or already finished", http.StatusNotFound)
+				return
+			}
+		}
+		if !ops.cancel(id) {
+			h.jsonError(w, "operation not found or already finished", http.StatusNotFound)
+			return
+		}
+		noteActivity(r, "", "", "", "Cancel operation "+id)
+		h.jsonResponse(w, map[string]interface{}{"canceled": true, "id": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// allowsAll reports whether a may read every one of namespaces.
+func allowsAll(a access, namespaces []string) bool {
+	for _, ns := range namespaces {
+		if !a.allows(ns, false) {
+			return false
+		}
+	}
+	return true
+}
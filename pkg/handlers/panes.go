@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+
+	"kube-browser/pkg/storage"
+)
+
+// mainPane is the pane ID of the connection made with /api/connect. Other
+// panes are storage backends or further clusters opened next to it with
+// /api/panes, so two connections can be browsed side by side and data
+// copied between them with /api/transfer.
+const mainPane = "main"
+
+type paneInfo struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Context string `json:"context"`
+}
+
+// clientFor returns the connection a request addresses with its pane query
+// parameter: the main connection when there is none, nil when the pane is
+// not open.
+func (h *Handler) clientFor(r *http.Request) KubeClient {
+	return h.paneClient(r.URL.Query().Get("pane"))
+}
+
+func (h *Handler) paneClient(id string) KubeClient {
+	if id == "" || id == mainPane {
+		return h.getClient()
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if c, ok := h.panes[id]; ok {
+		return c
+	}
+	return nil
+}
+
+func (h *Handler) listPanes() []paneInfo {
+	var panes []paneInfo
+	if c := h.getClient(); c != nil {
+		_, name := c.Connection()
+		panes = append(panes, paneInfo{ID: mainPane, Type: connectionType(c), Context: name})
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.panes))
+	for id := range h.panes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		c := h.panes[id]
+		_, name := c.Connection()
+		panes = append(panes, paneInfo{ID: id, Type: connectionType(c), Context: name})
+	}
+	return panes
+}
+
+// PanesHandler lists, opens and closes the panes next to the main
+// connection:
+//
+//	GET    /api/panes
+//	POST   /api/panes {"backend": {...}}
+//	POST   /api/panes {"cluster": {kubeconfigPath, context, registryMirror, imagePullSecrets}}
+//	DELETE /api/panes?id=
+//
+// backend takes the same object as /api/connect; cluster connects to
+// another kubeconfig context, for copies between clusters. The file
+// endpoints address a pane with ?pane=<id>.
+func (h *Handler) PanesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.jsonResponse(w, map[string]interface{}{"panes": h.listPanes()})
+	case http.MethodPost:
+		var req struct {
+			Backend *storage.Config `json:"backend"`
+			Cluster *clusterConfig  `json:"cluster"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var client KubeClient
+		var namespaces namespaceList
+		switch {
+		case req.Backend != nil && req.Cluster != nil:
+			h.jsonError(w, "give either backend or cluster", http.StatusBadRequest)
+			return
+		case req.Backend != nil:
+			backend, code, err := openStorage(r, *req.Backend)
+			if err != nil {
+				h.jsonError(w, err.Error(), code)
+				return
+			}
+			namespaces.names, _ = backend.ListNamespaces(r.Context())
+			client = backend
+		case req.Cluster != nil:
+			if h.backend != nil {
+				h.jsonError(w, "only the built-in connection is available in this mode", http.StatusBadRequest)
+				return
+			}
+			cluster, ns, code, err := h.openCluster(r.Context(), *req.Cluster)
+			if err != nil {
+				h.jsonError(w, err.Error(), code)
+				return
+			}
+			client, namespaces = cluster, ns
+		default:
+			h.jsonError(w, "backend or cluster is required", http.StatusBadRequest)
+			return
+		}
+		id := "p-" + newID()
+		h.mu.Lock()
+		if h.panes == nil {
+			h.panes = make(map[string]KubeClient)
+		}
+		h.panes[id] = client
+		h.mu.Unlock()
+
+		_, name := client.Connection()
+		h.jsonResponse(w, map[string]interface{}{
+			"pane":                 paneInfo{ID: id, Type: connectionType(client), Context: name},
+			"namespaces":           namespaces.names,
+			"namespacesRestricted": namespaces.restricted,
+		})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == mainPane {
+			h.jsonError(w, "the main pane is closed with /api/disconnect", http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		c, ok := h.panes[id]
+		delete(h.panes, id)
+		h.mu.Unlock()
+		if !ok {
+			h.jsonError(w, "pane not found", http.StatusNotFound)
+			return
+		}
+		if closer, ok := c.(io.Closer); ok {
+			closer.Close()
+		}
+		h.jsonResponse(w, map[string]interface{}{"closed": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"kube-browser/pkg/k8s"
+)
+
+// ChmodHandler changes the mode of a file or directory:
+// POST /api/chmod {namespace, pvc, path, mode, recursive}. mode is octal
+// ("0664", "2775") or symbolic ("g+rwX"), as chmod takes it.
+func (h *Handler) ChmodHandler(w http.ResponseWriter, r *http.Request) {
+	h.changePermissions(w, r, "mode")
+}
+
+// ChownHandler changes the owner of a file or directory:
+// POST /api/chown {namespace, pvc, path, owner, recursive}. owner is
+// "user", "user:group" or ":group", by name or number.
+func (h *Handler) ChownHandler(w http.ResponseWriter, r *http.Request) {
+	h.changePermissions(w, r, "owner")
+}
+
+// changePermissions serves /api/chmod and /api/chown; field is the one
+// the request must set. Both run in the pod mounting the claim, so a
+// chown needs that container, or the helper pod, to run as root.
+func (h *Handler) changePermissions(w http.ResponseWriter, r *http.Request, field string) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Namespace string `json:"namespace"`
+		PVC       string `json:"pvc"`
+		Path      string `json:"path"`
+		Mode      string `json:"mode"`
+		Owner     string `json:"owner"`
+		Recursive bool   `json:"recursive"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	perms := k8s.FilePermissions{Mode: req.Mode}
+	if field == "owner" {
+		perms = k8s.FilePermissions{Owner: req.Owner}
+	}
+	if req.Namespace == "" || req.PVC == "" || req.Path == "" || perms == (k8s.FilePermissions{}) {
+		h.jsonError(w, "namespace, pvc, path and "+field+" are required", http.StatusBadRequest)
+		return
+	}
+	if err := perms.ValidateChange(); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := sanitizePath(req.Path)
+	detail := "Mode " + perms.Mode
+	if field == "owner" {
+		detail = "Owner " + perms.Owner
+	}
+	if req.Recursive {
+		detail += ", recursive"
+	}
+	noteActivity(r, req.Namespace, req.PVC, p, detail)
+
+	if err := client.ChangePermissions(r.Context(), req.Namespace, req.PVC, p, perms, req.Recursive); err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Changed %s in %s/%s: %s (client %s)", p, req.Namespace, req.PVC, detail, r.RemoteAddr)
+	h.jsonResponse(w, map[string]interface{}{"path": p, "mode": perms.Mode, "owner": perms.Owner, "recursive": req.Recursive})
+}
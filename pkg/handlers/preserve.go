@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"archive/tar"
+	"os"
+	"time"
+)
+
+// Uploads, extractions, copies between panes and saves on the server keep
+// each file's modification time and mode bits, so a sync or a backup is a
+// faithful copy: the tar streams they travel as carry both, and every
+// destination applies them. Turning preserve off makes files land with the
+// time they were written and the default modes, like a plain copy.
+
+// preserveOption reads an optional "preserve" setting, on unless false.
+func preserveOption(p *bool) bool {
+	return p == nil || *p
+}
+
+// stripMetadata gives hdr the time now and the default mode, 0755 for a
+// directory and 0644 for anything else.
+func stripMetadata(hdr *tar.Header, now time.Time) {
+	hdr.ModTime = now
+	hdr.Mode = 0o644
+	if hdr.Typeflag == tar.TypeDir {
+		hdr.Mode = 0o755
+	}
+}
+
+// setLocalMetadata gives a file saved on the KubeBrowser host the mode
+// bits and modification time it has in the pod, skipping those unknown.
+func setLocalMetadata(p string, mode int64, mtime time.Time) error {
+	if mode&0o777 != 0 {
+		if err := os.Chmod(p, os.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if !mtime.IsZero() {
+		return os.Chtimes(p, mtime, mtime)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"kube-browser/pkg/preview"
+)
+
+// previewMaxBytes caps how much of a file /api/preview reads. Notebooks
+// get more room since their outputs embed images.
+const (
+	previewMaxBytes  = 1 << 20
+	notebookMaxBytes = 16 << 20
+)
+
+// PreviewHandler renders a file for inline display:
+// GET /api/preview?namespace=&pvc=&path=[&as=markdown|json|yaml|notebook|text].
+// The renderer is picked from the extension unless "as" overrides it.
+// Markdown and notebooks come back as sanitized HTML; JSON and YAML are
+// pretty-printed, or returned unchanged with the location of the first
+// parse error.
+func (h *Handler) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	namespace, pvc := q.Get("namespace"), q.Get("pvc")
+	if namespace == "" || pvc == "" || q.Get("path") == "" {
+		h.jsonError(w, "namespace, pvc and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	filePath := sanitizePath(q.Get("path"))
+
+	kind := preview.KindFor(filePath)
+	if as := q.Get("as"); as != "" {
+		switch kind = preview.Kind(as); kind {
+		case preview.KindMarkdown, preview.KindJSON, preview.KindYAML, preview.KindNotebook, preview.KindText:
+		default:
+			h.jsonError(w, "as must be markdown, json, yaml, notebook or text", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := previewMaxBytes
+	if kind == preview.KindNotebook {
+		limit = notebookMaxBytes
+	}
+	data, truncated, err := client.ReadFileHead(r.Context(), namespace, pvc, filePath, limit)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	if truncated && kind == preview.KindNotebook {
+		h.jsonError(w, "Notebook is larger than 16 MiB; download it instead", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// A cut-off document cannot be validated: show what was read as text.
+	if truncated && (kind == preview.KindJSON || kind == preview.KindYAML) {
+		kind = preview.KindText
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"path":      filePath,
+		"truncated": truncated,
+		"preview":   preview.Render(kind, data),
+	})
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// pvcWebhookEnv names a URL every claim notification is POSTed to.
+const pvcWebhookEnv = "KUBE_BROWSER_PVC_WEBHOOK_URL"
+
+// pvcWebhookTimeout bounds one webhook delivery.
+const pvcWebhookTimeout = 10 * time.Second
+
+// pvcBindTimeout is how long a claim KubeBrowser created is watched before
+// the wait is given up: KUBE_BROWSER_PVC_BIND_TIMEOUT_MIN minutes, 60 by
+// default.
+func pvcBindTimeout() time.Duration {
+	return time.Duration(envInt64("KUBE_BROWSER_PVC_BIND_TIMEOUT_MIN", 60)) * time.Minute
+}
+
+// PVCNotifier is told how waiting for a claim KubeBrowser created ended:
+// bound, lost, deleted or timed out. The /api/pvc-events feed is always
+// told; AddPVCNotifier plugs in more.
+type PVCNotifier interface {
+	NotifyPVC(ctx context.Context, b k8s.PVCBinding) error
+}
+
+// AddPVCNotifier adds n to the notifiers of claim bindings.
+func (h *Handler) AddPVCNotifier(n PVCNotifier) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pvcNotifiers = append(h.pvcNotifiers, n)
+}
+
+// LoadPVCWebhook adds a webhook notifier for the URL in
+// KUBE_BROWSER_PVC_WEBHOOK_URL, if set.
+func (h *Handler) LoadPVCWebhook() error {
+	raw := os.Getenv(pvcWebhookEnv)
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL", pvcWebhookEnv)
+	}
+	h.AddPVCNotifier(&webhookNotifier{url: raw, client: &http.Client{Timeout: pvcWebhookTimeout}})
+	log.Printf("Claim provisioning notifications will be posted to %s", u.Redacted())
+	return nil
+}
+
+// webhookNotifier POSTs each binding as JSON, with an "event" such as
+// "pvc.bound" and a readable "message".
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+type pvcWebhookPayload struct {
+	Event string `json:"event"`
+	k8s.PVCBinding
+	Message string `json:"message"`
+}
+
+func (n *webhookNotifier) NotifyPVC(ctx context.Context, b k8s.PVCBinding) error {
+	body, err := json.Marshal(pvcWebhookPayload{Event: "pvc." + strings.ToLower(b.Phase), PVCBinding: b, Message: b.String()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// pvcEvent is a binding numbered in the order it was reported.
+type pvcEvent struct {
+	ID int64 `json:"id"`
+	k8s.PVCBinding
+	Message string `json:"message"`
+}
+
+// pendingClaim is a claim still being watched.
+type pendingClaim struct {
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace"`
+	PVC       string    `json:"pvc"`
+	Since     time.Time `json:"since"`
+}
+
+// pvcFeed keeps the latest bindings and the claims still watched, and
+// wakes up the clients streaming them, like helperFeed.
+type pvcFeed struct {
+	mu      sync.Mutex
+	events  []pvcEvent
+	lastID  int64
+	wake    chan struct{}
+	pending map[pendingClaim]time.Time
+}
+
+func newPVCFeed() *pvcFeed {
+	return &pvcFeed{wake: make(chan struct{}), pending: map[pendingClaim]time.Time{}}
+}
+
+func (h *Handler) getPVCFeed() *pvcFeed {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pvcEvents == nil {
+		h.pvcEvents = newPVCFeed()
+	}
+	return h.pvcEvents
+}
+
+// watch records a claim as watched, and reports false when it already is.
+func (f *pvcFeed) watch(contextName, namespace, pvc string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := pendingClaim{Context: contextName, Namespace: namespace, PVC: pvc}
+	if _, ok := f.pending[key]; ok {
+		return false
+	}
+	f.pending[key] = time.Now()
+	return true
+}
+
+// publish reports b, or only forgets the claim when b is nil.
+func (f *pvcFeed) publish(contextName, namespace, pvc string, b *k8s.PVCBinding) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pending, pendingClaim{Context: contextName, Namespace: namespace, PVC: pvc})
+	if b == nil {
+		return
+	}
+	f.lastID++
+	f.events = append(f.events, pvcEvent{ID: f.lastID, PVCBinding: *b, Message: b.String()})
+	if len(f.events) > helperEventBacklog {
+		f.events = f.events[len(f.events)-helperEventBacklog:]
+	}
+	close(f.wake)
+	f.wake = make(chan struct{})
+}
+
+// since returns the events after id in namespace (empty matches all), the
+// id of the latest event, and a channel closed on the next publish.
+func (f *pvcFeed) since(id int64, namespace string) ([]pvcEvent, int64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []pvcEvent
+	for _, ev := range f.events {
+		if ev.ID <= id || (namespace != "" && ev.Namespace != namespace) {
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out, f.lastID, f.wake
+}
+
+// watching lists the claims still watched in namespace, oldest first.
+func (f *pvcFeed) watching(namespace string) []pendingClaim {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := []pendingClaim{}
+	for key, since := range f.pending {
+		if namespace == "" || key.Namespace == namespace {
+			key.Since = since
+			out = append(out, key)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Since.Before(out[j].Since) })
+	return out
+}
+
+// claimWatcher returns the function client calls with each claim it
+// creates: the claim is watched in the background until it settles, and
+// the outcome goes to the feed and the notifiers.
+func (h *Handler) claimWatcher(client *k8s.Client) func(namespace, pvc string) {
+	return func(namespace, pvc string) {
+		if !h.getPVCFeed().watch(client.ContextName, namespace, pvc) {
+			return
+		}
+		go h.awaitClaim(client, namespace, pvc)
+	}
+}
+
+func (h *Handler) awaitClaim(client *k8s.Client, namespace, pvc string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pvcBindTimeout())
+	defer cancel()
+	b, err := client.WaitForBound(ctx, namespace, pvc)
+	if err != nil {
+		log.Printf("Cannot watch PVC %s/%s until it is bound: %v", namespace, pvc, err)
+		h.getPVCFeed().publish(client.ContextName, namespace, pvc, nil)
+		return
+	}
+	h.reportClaim(client.ContextName, namespace, pvc, b)
+}
+
+// reportClaim publishes how waiting for a claim ended and tells the
+// notifiers, one after the other.
+func (h *Handler) reportClaim(contextName, namespace, pvc string, b *k8s.PVCBinding) {
+	log.Print(b.String())
+	h.getPVCFeed().publish(contextName, namespace, pvc, b)
+
+	h.mu.RLock()
+	notifiers := append([]PVCNotifier(nil), h.pvcNotifiers...)
+	h.mu.RUnlock()
+	for _, n := range notifiers {
+		nctx, ncancel := context.WithTimeout(context.Background(), pvcWebhookTimeout)
+		if err := n.NotifyPVC(nctx, *b); err != nil {
+			log.Printf("Notifying that PVC %s/%s is %s failed: %v", namespace, pvc, b.Phase, err)
+		}
+		ncancel()
+	}
+}
+
+// PVCEventsHandler reports how claims KubeBrowser created (clones,
+// restored snapshots, migration targets) finished provisioning:
+//
+//	GET /api/pvc-events[?since=<id>&namespace=]
+//
+// It answers with {"events": [...], "last": <id>, "pending": [...]}, the
+// claims still waited on being pending, or, when the request accepts
+// text/event-stream, streams each event as it happens, resuming after
+// Last-Event-ID, like /api/helper-events.
+func (h *Handler) PVCEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	since := q.Get("since")
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		since = last
+	}
+	var after int64
+	if since != "" {
+		n, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || n < 0 {
+			h.jsonError(w, "since must be an event id", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	feed := h.getPVCFeed()
+	namespace := q.Get("namespace")
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		events, last, _ := feed.since(after, namespace)
+		if events == nil {
+			events = []pvcEvent{}
+		}
+		h.jsonResponse(w, map[string]interface{}{"events": events, "last": last, "pending": feed.watching(namespace)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepalive := time.NewTicker(helperEventKeepalive)
+	defer keepalive.Stop()
+	for {
+		events, _, wake := feed.since(after, namespace)
+		for _, ev := range events {
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.ID, data)
+			after = ev.ID
+		}
+		if len(events) > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
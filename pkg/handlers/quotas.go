@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/jobs"
+)
+
+// quotasFileEnv names the JSON file setting per-user and per-token limits
+// (see quotaConfig). Without it nobody is limited.
+const quotasFileEnv = "KUBE_BROWSER_QUOTAS_FILE"
+
+// errQuotaExceeded is the error of a transfer refused by a quota.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// quotaTransferPaths move file data between a client and a volume: each
+// request to them is one transfer, and the bytes it sends and receives
+// count towards the user's day. /raw/ URLs are transfers too. Jobs count
+// as transfers from when they are submitted until they finish, so
+// /api/download-archive, whose job builds the archive, is not listed.
+var quotaTransferPaths = map[string]bool{
+	"/api/download":         true,
+	"/api/download-dir":     true,
+	"/api/download-batch":   true,
+	"/api/container-file":   true,
+	"/api/upload":           true,
+	"/api/upload-url":       true,
+	"/api/download-local":   true,
+	"/api/upload-local-dir": true,
+}
+
+// quotaLimits are what one user or token may do. Zero values do not
+// limit.
+type quotaLimits struct {
+	// MaxConcurrentTransfers bounds the transfers under way at once.
+	MaxConcurrentTransfers int `json:"maxConcurrentTransfers,omitempty"`
+	// MaxBytesPerDay bounds the bytes transferred per UTC day.
+	MaxBytesPerDay int64 `json:"maxBytesPerDay,omitempty"`
+	// Namespaces, when set, are the only namespaces that may be used.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// quotaConfig is the file KUBE_BROWSER_QUOTAS_FILE names:
+//
+//	{
+//	  "users": {"alice@example.com": {"maxConcurrentTransfers": 4}},
+//	  "tokens": {"nightly-backup": {"maxBytesPerDay": 500000000000, "namespaces": ["backups"]}},
+//	  "default": {"maxConcurrentTransfers": 2, "maxBytesPerDay": 50000000000}
+//	}
+//
+// Users are named as the activity feed names them (see requestUser) and
+// tokens by their name. Anyone not listed gets default, or no limits
+// without it.
+type quotaConfig struct {
+	Users   map[string]quotaLimits `json:"users,omitempty"`
+	Tokens  map[string]quotaLimits `json:"tokens,omitempty"`
+	Default *quotaLimits           `json:"default,omitempty"`
+}
+
+func (l quotaLimits) validate(name string) error {
+	if l.MaxConcurrentTransfers < 0 || l.MaxBytesPerDay < 0 {
+		return fmt.Errorf("%s: limits must not be negative", name)
+	}
+	for _, ns := range l.Namespaces {
+		if strings.TrimSpace(ns) == "" {
+			return fmt.Errorf("%s: empty namespace", name)
+		}
+	}
+	return nil
+}
+
+func (c *quotaConfig) validate() error {
+	for user, l := range c.Users {
+		if err := l.validate(fmt.Sprintf("user %q", user)); err != nil {
+			return err
+		}
+	}
+	for token, l := range c.Tokens {
+		if err := l.validate(fmt.Sprintf("token %q", token)); err != nil {
+			return err
+		}
+	}
+	if c.Default != nil {
+		return c.Default.validate("default")
+	}
+	return nil
+}
+
+// limitsFor returns the limits of r's user or token, if any apply.
+func (c *quotaConfig) limitsFor(r *http.Request) (quotaLimits, bool) {
+	if tok, ok := requestToken(r); ok {
+		if l, ok := c.Tokens[tok.Name]; ok {
+			return l, true
+		}
+	} else if l, ok := c.Users[requestUser(r)]; ok {
+		return l, true
+	}
+	if c.Default != nil {
+		return *c.Default, true
+	}
+	return quotaLimits{}, false
+}
+
+// allowsNamespace reports whether the limits let namespace be used. An
+// empty namespace names none.
+func (l quotaLimits) allowsNamespace(namespace string) bool {
+	return namespace == "" || len(l.Namespaces) == 0 || slices.Contains(l.Namespaces, namespace)
+}
+
+// visibleNamespaces keeps the namespaces the limits let be used.
+func (l quotaLimits) visibleNamespaces(namespaces []string) []string {
+	if len(l.Namespaces) == 0 {
+		return namespaces
+	}
+	var out []string
+	for _, ns := range namespaces {
+		if l.allowsNamespace(ns) {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+// LoadQuotas reads the limits KUBE_BROWSER_QUOTAS_FILE names, if any.
+// Quotas enforces them from then on.
+func (h *Handler) LoadQuotas() error {
+	path := os.Getenv(quotasFileEnv)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", quotasFileEnv, err)
+	}
+	var c quotaConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return fmt.Errorf("%s: invalid %s: %w", quotasFileEnv, path, err)
+	}
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("%s: invalid %s: %w", quotasFileEnv, path, err)
+	}
+	h.quotas = &c
+	log.Printf("Quotas enabled: %d user(s) and %d token(s) listed in %s", len(c.Users), len(c.Tokens), path)
+	return nil
+}
+
+// quotaUsage is what each user has transferred today and has under way.
+// It lives in memory only, so a restart starts the day over.
+type quotaUsage struct {
+	mu  sync.Mutex
+	day string
+	// bytes are the bytes each user transferred on day.
+	bytes map[string]int64
+	// streams count the transfer requests each user has in flight.
+	streams map[string]int
+	// jobs maps the jobs users submitted to them, until they finish.
+	jobs map[string]string
+}
+
+func newQuotaUsage() *quotaUsage {
+	return &quotaUsage{bytes: map[string]int64{}, streams: map[string]int{}, jobs: map[string]string{}}
+}
+
+func (h *Handler) getQuotaUsage() *quotaUsage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.quotaUsage == nil {
+		h.quotaUsage = newQuotaUsage()
+	}
+	return h.quotaUsage
+}
+
+// todayLocked returns the bytes user transferred today, starting a new
+// day's count at UTC midnight.
+func (u *quotaUsage) todayLocked(user string) int64 {
+	if day := time.Now().UTC().Format(time.DateOnly); day != u.day {
+		u.day = day
+		u.bytes = map[string]int64{}
+	}
+	return u.bytes[user]
+}
+
+// activeLocked counts the transfers user has under way: requests in
+// flight and jobs not finished yet. Jobs removed before finishing are
+// forgotten.
+func (u *quotaUsage) activeLocked(user string, m *jobs.Manager) int {
+	n := u.streams[user]
+	for id, owner := range u.jobs {
+		if owner != user {
+			continue
+		}
+		job, ok := m.Get(id)
+		if !ok {
+			delete(u.jobs, id)
+		} else if !job.State.Finished() {
+			n++
+		}
+	}
+	return n
+}
+
+// admitLocked refuses another transfer to user once the limits are
+// reached.
+func (u *quotaUsage) admitLocked(user string, l quotaLimits, m *jobs.Manager) error {
+	if l.MaxBytesPerDay > 0 && u.todayLocked(user) >= l.MaxBytesPerDay {
+		return fmt.Errorf("%w: %s has transferred the %d bytes allowed today", errQuotaExceeded, user, l.MaxBytesPerDay)
+	}
+	if l.MaxConcurrentTransfers > 0 && u.activeLocked(user, m) >= l.MaxConcurrentTransfers {
+		return fmt.Errorf("%w: %s already has %d transfer(s) under way", errQuotaExceeded, user, l.MaxConcurrentTransfers)
+	}
+	return nil
+}
+
+// startStream counts a transfer request of user in flight, if allowed.
+func (u *quotaUsage) startStream(user string, l quotaLimits, m *jobs.Manager) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.admitLocked(user, l, m); err != nil {
+		return err
+	}
+	u.streams[user]++
+	return nil
+}
+
+// endStream records a finished transfer request of user that moved n
+// bytes.
+func (u *quotaUsage) endStream(user string, n int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.streams[user]--
+	if u.streams[user] <= 0 {
+		delete(u.streams, user)
+	}
+	u.todayLocked(user)
+	u.bytes[user] += n
+}
+
+// submitJob submits a job for user with submit, if allowed.
+func (u *quotaUsage) submitJob(user string, l quotaLimits, m *jobs.Manager, submit func() (jobs.Job, error)) (jobs.Job, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.admitLocked(user, l, m); err != nil {
+		return jobs.Job{}, err
+	}
+	job, err := submit()
+	if err == nil {
+		u.jobs[job.ID] = user
+	}
+	return job, err
+}
+
+// jobFinished adds the bytes a job reported moving to the day of the user
+// who submitted it.
+func (u *quotaUsage) jobFinished(job jobs.Job) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.jobs[job.ID]
+	if !ok {
+		return
+	}
+	delete(u.jobs, job.ID)
+	u.todayLocked(user)
+	u.bytes[user] += job.Done
+}
+
+type quotaKey struct{}
+
+// requestQuota returns the limits r's user or token is held to, when
+// quotas are enabled.
+func requestQuota(r *http.Request) (quotaLimits, bool) {
+	l, ok := r.Context().Value(quotaKey{}).(quotaLimits)
+	return l, ok
+}
+
+// quotaRecorder counts the bytes of a transfer request's response.
+type quotaRecorder struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (rw *quotaRecorder) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (rw *quotaRecorder) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
+// quotaBody counts the bytes of a transfer request's body.
+type quotaBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *quotaBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// Quotas enforces the limits KUBE_BROWSER_QUOTAS_FILE sets on /api/ and
+// /raw/ requests: namespaces outside a user's list are refused, and a
+// transfer is refused with HTTP 429 while the user has as many under way
+// as allowed, or has used up the day's bytes. A transfer already under
+// way when the day's bytes run out still finishes. Jobs are checked as
+// they are submitted (see submitJob).
+func (h *Handler) Quotas(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.quotas == nil || !(strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/raw/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l, ok := h.quotas.limitsFor(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), quotaKey{}, l))
+		user := requestUser(r)
+		if len(l.Namespaces) > 0 {
+			namespaces, err := h.requestNamespaces(r)
+			if err != nil {
+				h.jsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, ns := range namespaces {
+				if !l.allowsNamespace(ns) {
+					h.jsonError(w, fmt.Sprintf("%s may not use namespace %q", user, ns), http.StatusForbidden)
+					return
+				}
+			}
+		}
+		if !quotaTransferPaths[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/raw/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		usage := h.getQuotaUsage()
+		if err := usage.startStream(user, l, h.getJobs()); err != nil {
+			h.jsonError(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		rec := &quotaRecorder{ResponseWriter: w}
+		var body *quotaBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &quotaBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+		defer func() {
+			n := rec.n
+			if body != nil {
+				n += body.n
+			}
+			usage.endStream(user, n)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// checkQuotaNamespaces refuses a request naming a namespace Quotas could
+// not see, such as a field of a multipart upload, outside the user's
+// list. It reports whether it wrote the error.
+func (h *Handler) checkQuotaNamespaces(w http.ResponseWriter, r *http.Request, namespaces ...string) bool {
+	l, ok := requestQuota(r)
+	if !ok {
+		return false
+	}
+	for _, ns := range namespaces {
+		if !l.allowsNamespace(ns) {
+			h.jsonError(w, fmt.Sprintf("%s may not use namespace %q", requestUser(r), ns), http.StatusForbidden)
+			return true
+		}
+	}
+	return false
+}
+
+// quotaStatus describes r's limits and what is left of them for
+// /api/status, or nil when none apply.
+func (h *Handler) quotaStatus(r *http.Request) interface{} {
+	l, ok := requestQuota(r)
+	if !ok {
+		return nil
+	}
+	user := requestUser(r)
+	u := h.getQuotaUsage()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return map[string]interface{}{
+		"user":            user,
+		"limits":          l,
+		"bytesToday":      u.todayLocked(user),
+		"activeTransfers": u.activeLocked(user, h.getJobs()),
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// rawTokenEnv sets the token of the /raw/ URLs. Without it a token is
+// generated at startup, so links copied before a restart stop working.
+const rawTokenEnv = "KUBE_BROWSER_RAW_TOKEN"
+
+// rawSniffBytes is how much of a file is looked at to guess its type when
+// its extension says nothing.
+const rawSniffBytes = 512
+
+// getRawToken returns the token /raw/ URLs are checked against.
+func (h *Handler) getRawToken() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rawToken == "" {
+		if h.rawToken = os.Getenv(rawTokenEnv); h.rawToken == "" {
+			b := make([]byte, 16)
+			rand.Read(b)
+			h.rawToken = hex.EncodeToString(b)
+			log.Printf("Raw file URLs use a token generated for this run; set %s to keep them working across restarts", rawTokenEnv)
+		}
+	}
+	return h.rawToken
+}
+
+// rawAuthorized reports whether a request carries the raw token, as a
+// bearer token, the password of basic auth (http://x:<token>@host/raw/...,
+// which most tools accept) or ?token=.
+func (h *Handler) rawAuthorized(r *http.Request) bool {
+	given := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	} else if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(h.getRawToken())) == 1
+}
+
+// rawURLPath builds the /raw/ path of a file.
+func rawURLPath(pane, namespace, pvc, filePath string) string {
+	if pane == "" {
+		pane = mainPane
+	}
+	parts := []string{"/raw", url.PathEscape(pane), url.PathEscape(namespace), url.PathEscape(pvc)}
+	for _, seg := range strings.Split(strings.TrimPrefix(filePath, "/"), "/") {
+		parts = append(parts, url.PathEscape(seg))
+	}
+	return strings.Join(parts, "/")
+}
+
+// rawContentType guesses a file's MIME type from its name, then from its
+// first bytes.
+func rawContentType(name string, head []byte) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// RawFileHandler serves the bytes of a file at a stable URL, for tools
+// that open URLs rather than talk to the API (editors, image viewers, BI
+// tools):
+//
+//	GET|HEAD /raw/<pane>/<namespace>/<pvc>/<path>
+//
+// pane is "main" for the main connection, or the ID of a pane opened with
+// /api/panes. The response has the file's MIME type and is shown inline.
+// Every request needs the raw token (see rawAuthorized), since the URL
+// is meant to leave the browser. HTML and SVG from a volume are sandboxed
+// so they cannot script this origin.
+func (h *Handler) RawFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.rawAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="kube-browser raw files"`)
+		h.jsonError(w, "a valid raw token is required", http.StatusUnauthorized)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/raw/"), "/", 4)
+	if len(parts) < 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		h.jsonError(w, "expected /raw/<pane>/<namespace>/<pvc>/<path>", http.StatusBadRequest)
+		return
+	}
+	pane, namespace, pvc := parts[0], parts[1], parts[2]
+	filePath := sanitizePath(parts[3])
+	if filePath == "/" {
+		h.jsonError(w, "path must name a file", http.StatusBadRequest)
+		return
+	}
+	client := h.paneClient(pane)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	compression, err := transferCompressionFromQuery(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader, fileName, err := downloadFile(r.Context(), client, namespace, pvc, filePath, compression)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	br := bufio.NewReaderSize(reader, downloadBufferSize)
+	head, err := br.Peek(rawSniffBytes)
+	if err != nil && err != io.EOF {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", rawContentType(fileName, head))
+	w.Header().Set("Content-Disposition", strings.Replace(attachmentDisposition(fileName), "attachment", "inline", 1))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "no-store")
+	setTransferCompression(w, reader)
+	if fh, ok := reader.(k8s.FileHeader); ok && fh.Header() != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(fh.Header().Size, 10))
+		w.Header().Set("Last-Modified", fh.Header().ModTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := br.WriteTo(w); err != nil {
+		log.Printf("Raw read of %s/%s:%s interrupted: %v", namespace, pvc, filePath, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// RawURLHandler returns the /raw/ URL of a file, token included, for the
+// UI's "Copy link":
+//
+//	GET /api/raw-url?namespace=&pvc=&path=[&pane=]
+func (h *Handler) RawURLHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("namespace") == "" || q.Get("pvc") == "" || q.Get("path") == "" {
+		h.jsonError(w, "namespace, pvc and path parameters are required", http.StatusBadRequest)
+		return
+	}
+	if h.clientFor(r) == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		RawPath:  rawURLPath(q.Get("pane"), q.Get("namespace"), q.Get("pvc"), sanitizePath(q.Get("path"))),
+		RawQuery: url.Values{"token": {h.getRawToken()}}.Encode(),
+	}
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	h.jsonResponse(w, map[string]interface{}{"url": u.String()})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import "net/http"
+
+// ResolvePathHandler validates a typed PVC path so the UI can jump straight
+// to it instead of clicking through every directory level.
+func (h *Handler) ResolvePathHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	pvc := r.URL.Query().Get("pvc")
+	path := r.URL.Query().Get("path")
+
+	if namespace == "" || pvc == "" || path == "" {
+		h.jsonError(w, "namespace, pvc, and path parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	info, err := client.ResolvePath(r.Context(), namespace, pvc, sanitizePath(path))
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, info)
+}
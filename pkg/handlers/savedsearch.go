@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"kube-browser/pkg/k8s"
+	"kube-browser/pkg/store"
+)
+
+const savedSearchesFile = "saved-searches.json"
+
+// SavedSearch is a named search ("smart folder") bound to a PVC that can be
+// re-run from the UI, e.g. *.err under /jobs modified within 24h.
+type SavedSearch struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace"`
+	PVC       string          `json:"pvc"`
+	Query     k8s.SearchQuery `json:"query"`
+	Created   time.Time       `json:"created"`
+}
+
+type savedSearches struct {
+	mu    sync.Mutex
+	items []SavedSearch
+}
+
+func (h *Handler) getSavedSearches() *savedSearches {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.savedSearches == nil {
+		s := &savedSearches{}
+		if err := store.Load(savedSearchesFile, &s.items); err != nil {
+			log.Printf("Warning: could not load saved searches: %v", err)
+		}
+		h.savedSearches = s
+	}
+	return h.savedSearches
+}
+
+func (s *savedSearches) list() []SavedSearch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]SavedSearch, len(s.items))
+	copy(out, s.items)
+	return out
+}
+
+func (s *savedSearches) get(id string) (SavedSearch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.items {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return SavedSearch{}, false
+}
+
+func (s *savedSearches) add(item SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := append(append([]SavedSearch{}, s.items...), item)
+	if err := store.Save(savedSearchesFile, items); err != nil {
+		return err
+	}
+	s.items = items
+	return nil
+}
+
+func (s *savedSearches) remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]SavedSearch, 0, len(s.items))
+	for _, item := range s.items {
+		if item.ID != id {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(s.items) {
+		return false, nil
+	}
+	if err := store.Save(savedSearchesFile, items); err != nil {
+		return false, err
+	}
+	s.items = items
+	return true, nil
+}
+
+// SavedSearchesHandler lists (GET), creates (POST) and deletes (DELETE ?id=)
+// saved searches. They are stored in the state directory, not on the
+// cluster, so they work in read-only mode too. With group authorization or
+// quotas, only the searches in namespaces the user may read and use are
+// listed; GroupAuthz and Quotas check the namespace of the one deleted or
+// run.
+func (h *Handler) SavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	searches := h.getSavedSearches()
+
+	switch r.Method {
+	case http.MethodGet:
+		a, limited := requestAccess(r)
+		l, quota := requestQuota(r)
+		list := []SavedSearch{}
+		for _, search := range searches.list() {
+			if (limited && !a.allows(search.Namespace, false)) || (quota && !l.allowsNamespace(search.Namespace)) {
+				continue
+			}
+			list = append(list, search)
+		}
+		h.jsonResponse(w, map[string]interface{}{
+			"searches": list,
+		})
+	case http.MethodPost:
+		var req SavedSearch
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || req.Namespace == "" || req.PVC == "" {
+			h.jsonError(w, "name, namespace and pvc are required", http.StatusBadRequest)
+			return
+		}
+		if err := req.Query.Validate(); err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Query.Path = sanitizePath(req.Query.Path)
+		req.ID = newID()
+		req.Created = time.Now()
+		if err := searches.add(req); err != nil {
+			h.jsonError(w, "Failed to save search: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, req)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		removed, err := searches.remove(id)
+		if err != nil {
+			h.jsonError(w, "Failed to delete search: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			h.jsonError(w, "saved search not found", http.StatusNotFound)
+			return
+		}
+		h.jsonResponse(w, map[string]interface{}{"deleted": true, "id": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RunSavedSearchHandler re-runs a saved search against its PVC. It takes
+// ?pane=<id>, and with ?stream=true it answers like a streamed /api/search.
+func (h *Handler) RunSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	search, ok := h.getSavedSearches().get(r.URL.Query().Get("id"))
+	if !ok {
+		h.jsonError(w, "saved search not found", http.StatusNotFound)
+		return
+	}
+
+	if wantsStreamedListing(r) {
+		h.streamSearch(w, r, client, search.Namespace, search.PVC, search.Query)
+		return
+	}
+	result, err := client.SearchFiles(r.Context(), search.Namespace, search.PVC, search.Query)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"search":    search,
+		"files":     result.Files,
+		"truncated": result.Truncated,
+	})
+}
+
+// streamSearch serves a search as NDJSON: one FileInfo per match, in the
+// order find prints them, then a last line with "done", the number of
+// matches under "count" and "truncated", like streamListing.
+func (h *Handler) streamSearch(w http.ResponseWriter, r *http.Request, client KubeClient, namespace, pvc string, query k8s.SearchQuery) {
+	stream := h.newNDJSONStream(w, r)
+	truncated, err := client.StreamSearch(r.Context(), namespace, pvc, query, func(f k8s.FileInfo) error {
+		return stream.send(f)
+	})
+	if err != nil {
+		stream.fail(err)
+		return
+	}
+	stream.end(map[string]interface{}{"done": true, "count": stream.count, "truncated": truncated})
+}
+
+// searchQueryFromURL reads a search from query parameters: path, name
+// (repeatable glob), maxDepth, type, minSize and maxSize (bytes or a
+// quantity such as 10Mi), modifiedWithin, olderThan and limit.
+func searchQueryFromURL(v url.Values) (k8s.SearchQuery, error) {
+	q := k8s.SearchQuery{
+		Path:           sanitizePath(v.Get("path")),
+		Patterns:       v["name"],
+		Type:           v.Get("type"),
+		ModifiedWithin: v.Get("modifiedWithin"),
+		OlderThan:      v.Get("olderThan"),
+	}
+	for _, f := range []struct {
+		name string
+		dst  *int
+	}{{"maxDepth", &q.MaxDepth}, {"limit", &q.Limit}} {
+		if s := v.Get(f.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a non-negative integer", f.name)
+			}
+			*f.dst = n
+		}
+	}
+	for _, f := range []struct {
+		name string
+		dst  *int64
+	}{{"minSize", &q.MinSize}, {"maxSize", &q.MaxSize}} {
+		if s := v.Get(f.name); s != "" {
+			size, err := resource.ParseQuantity(s)
+			if err != nil || size.Sign() < 0 {
+				return q, fmt.Errorf("invalid %s %q: expected bytes or a size such as 10Mi", f.name, s)
+			}
+			*f.dst = size.Value()
+		}
+	}
+	return q, q.Validate()
+}
+
+// SearchHandler searches a PVC recursively:
+//
+//	GET /api/search?namespace=&pvc=&path=&name=*.log&name=*.txt&maxDepth=&type=&minSize=&maxSize=&modifiedWithin=&olderThan=&limit=
+//
+// It runs find under path in the pod (a helper pod when none mounts the
+// PVC) and returns the matching files and whether more than limit (default
+// 1000) matched. It takes ?pane=<id>. With ?stream=true, or an Accept of
+// application/x-ndjson, the matches are streamed as find prints them (see
+// streamSearch).
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	namespace, pvc := r.URL.Query().Get("namespace"), r.URL.Query().Get("pvc")
+	if namespace == "" || pvc == "" {
+		h.jsonError(w, "namespace and pvc parameters are required", http.StatusBadRequest)
+		return
+	}
+	query, err := searchQueryFromURL(r.URL.Query())
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if wantsStreamedListing(r) {
+		h.streamSearch(w, r, client, namespace, pvc, query)
+		return
+	}
+	result, err := client.SearchFiles(r.Context(), namespace, pvc, query)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, map[string]interface{}{
+		"query":     query,
+		"files":     result.Files,
+		"truncated": result.Truncated,
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"kube-browser/pkg/jobs"
+)
+
+// errJobStart is the error of an unusable ?at=.
+var errJobStart = errors.New("invalid start time")
+
+// jobStartFromQuery reads ?at=, when a job should start: an RFC 3339 time,
+// or HH:MM for the next time the server's clock shows it, so "02:00" runs
+// a transfer in the coming night. Empty means now.
+func jobStartFromQuery(r *http.Request, now time.Time) (time.Time, error) {
+	at := r.URL.Query().Get("at")
+	if at == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("%w: %s is in the past", errJobStart, at)
+		}
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", at, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: at must be an RFC 3339 time or HH:MM", errJobStart)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// submitJob queues a job, scheduled for ?at= when the request has one. A
+// user held to a quota may only submit it while within their limits.
+func (h *Handler) submitJob(r *http.Request, kind, description string, params interface{}) (jobs.Job, error) {
+	at, err := jobStartFromQuery(r, time.Now())
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	m := h.getJobs()
+	submit := func() (jobs.Job, error) { return m.SubmitAt(kind, description, params, at) }
+	if l, ok := requestQuota(r); ok {
+		return h.getQuotaUsage().submitJob(requestUser(r), l, m, submit)
+	}
+	return submit()
+}
+
+// jobSubmitStatus is the status of a submitJob error: a bad ?at= is the
+// client's fault, and a quota makes them wait.
+func jobSubmitStatus(err error) int {
+	if errors.Is(err, errJobStart) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, errQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindSnapshotRestore copies entries of a snapshot back onto the claim
+// it was taken of.
+const jobKindSnapshotRestore = "snapshot-restore"
+
+type snapshotRestoreParams struct {
+	k8s.SnapshotRestoreRequest
+	Estimated int64 `json:"estimatedBytes"`
+}
+
+func (h *Handler) runSnapshotRestoreJob(ctx context.Context, jh *jobs.Handle) error {
+	var p snapshotRestoreParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+	result, err := client.RestoreFromSnapshot(ctx, p.SnapshotRestoreRequest, func(n int64) { jh.SetProgress(n, p.Estimated) })
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored %d entries of snapshot %s/%s onto %s", len(result.Restored), p.Namespace, p.Snapshot, result.PVC)
+	return jh.SetResult(result)
+}
+
+// SnapshotRestoreHandler queues a restore of entries of a snapshot onto
+// the live claim: POST /api/snapshots/restore {namespace, snapshot, paths,
+// destDir, onConflict}. Paths are as listed in the snapshot claim; the
+// job's result says where each one landed, which differs from its own
+// path when onConflict is "rename". It writes to the live claim, so
+// read-only mode refuses it, and it needs helper pods for the restored
+// claim, so minimal mode does too.
+func (h *Handler) SnapshotRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	if h.minimal {
+		h.jsonError(w, "minimal mode: restoring from snapshots needs helper pods", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req snapshotRestoreParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = sanitizePath(p)
+	}
+	if req.DestDir != "" {
+		req.DestDir = sanitizePath(req.DestDir)
+	}
+	if err := req.Validate(); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The snapshot is normally being browsed, so its claim is there to
+	// measure; otherwise the job runs without a total.
+	claim := k8s.SnapshotClaimName(req.Snapshot)
+	estimated, err := client.DiskUsage(r.Context(), req.Namespace, claim, req.Paths)
+	if err != nil {
+		log.Printf("Could not estimate restore size from %s/%s: %v", req.Namespace, claim, err)
+		estimated = 0
+	}
+	req.Estimated = estimated
+
+	noteActivity(r, req.Namespace, "", "", fmt.Sprintf("Restore %d entries from snapshot %s", len(req.Paths), req.Snapshot))
+	job, err := h.submitJob(r, jobKindSnapshotRestore, fmt.Sprintf("Restore %d entries of snapshot %s/%s", len(req.Paths), req.Namespace, req.Snapshot), req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
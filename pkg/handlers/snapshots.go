@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// SnapshotsHandler browses a claim as it was when one of its
+// VolumeSnapshots was taken:
+//
+//	GET    /api/snapshots?namespace=&pvc=          the claim's snapshots, newest first
+//	POST   /api/snapshots {namespace, snapshot}    restore one into a claim to browse
+//	DELETE /api/snapshots?namespace=&pvc=<claim>   delete such a claim
+//
+// The claim POST returns is listed, previewed and downloaded from with the
+// usual endpoints, and released when it expires if nobody deletes it first
+// (see releaseSnapshotAt). Restoring and deleting create and delete claims,
+// so read-only mode refuses them; restoring needs a helper pod to mount the
+// restored claim, so minimal mode refuses it too.
+func (h *Handler) SnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet && h.checkReadOnly(w) {
+		return
+	}
+	if r.Method != http.MethodGet && h.minimal {
+		h.jsonError(w, "minimal mode: browsing snapshots needs helper pods", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		namespace, pvc := q.Get("namespace"), q.Get("pvc")
+		if namespace == "" || pvc == "" {
+			h.jsonError(w, "namespace and pvc parameters are required", http.StatusBadRequest)
+			return
+		}
+		snapshots, err := client.ListSnapshots(r.Context(), namespace, pvc)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, map[string]interface{}{"snapshots": snapshots})
+	case http.MethodPost:
+		var req struct {
+			Namespace string `json:"namespace"`
+			Snapshot  string `json:"snapshot"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Namespace == "" || req.Snapshot == "" {
+			h.jsonError(w, "namespace and snapshot are required", http.StatusBadRequest)
+			return
+		}
+		claim, err := client.BrowseSnapshot(r.Context(), req.Namespace, req.Snapshot)
+		if err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.releaseSnapshotAt(client, claim)
+		noteActivity(r, claim.Namespace, claim.Source, "", "Browse snapshot "+claim.Snapshot)
+		h.jsonResponse(w, claim)
+	case http.MethodDelete:
+		namespace, pvc := q.Get("namespace"), q.Get("pvc")
+		if namespace == "" || pvc == "" {
+			h.jsonError(w, "namespace and pvc parameters are required", http.StatusBadRequest)
+			return
+		}
+		if err := client.ReleaseSnapshot(r.Context(), namespace, pvc); err != nil {
+			h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.stopSnapshotExpiry(k8s.PVCRef{Namespace: namespace, PVC: pvc})
+		noteActivity(r, namespace, pvc, "", "Release snapshot claim")
+		h.jsonResponse(w, map[string]interface{}{"released": true, "pvc": pvc})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// releaseSnapshotAt releases a claim restored from a snapshot once it
+// expires, through the cleanup queue. Each claim has one timer; like
+// maintenance timers they do not survive a restart, and a claim restored
+// before one is scheduled again when it is next opened.
+func (h *Handler) releaseSnapshotAt(client KubeClient, claim *k8s.SnapshotClaim) {
+	ref := k8s.PVCRef{Namespace: claim.Namespace, PVC: claim.PVC}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.snapshotExpiry[ref] != nil {
+		return
+	}
+	if h.snapshotExpiry == nil {
+		h.snapshotExpiry = map[k8s.PVCRef]*time.Timer{}
+	}
+	h.snapshotExpiry[ref] = time.AfterFunc(time.Until(claim.Expires), func() {
+		h.stopSnapshotExpiry(ref)
+		h.getCleanup().Enqueue("snapshot-claim", ref.Namespace+"/"+ref.PVC, func(ctx context.Context) error {
+			return client.ReleaseSnapshot(ctx, ref.Namespace, ref.PVC)
+		})
+	})
+}
+
+// stopSnapshotExpiry forgets the timer of a claim that was released.
+func (h *Handler) stopSnapshotExpiry(ref k8s.PVCRef) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t := h.snapshotExpiry[ref]; t != nil {
+		t.Stop()
+		delete(h.snapshotExpiry, ref)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"kube-browser/pkg/k8s"
+)
+
+// sortOptionsFromQuery reads the listing order from
+// ?sort=name|natural|size|mtime, ?caseInsensitive=, ?dirsFirst= and
+// ?desc=. Missing parameters keep the defaults (natural, case-insensitive,
+// directories first, ascending).
+func sortOptionsFromQuery(r *http.Request) (k8s.SortOptions, error) {
+	q := r.URL.Query()
+	o := k8s.DefaultSortOptions()
+	if v := q.Get("sort"); v != "" {
+		o.Mode = k8s.SortMode(v)
+	}
+	var err error
+	if o.CaseInsensitive, err = queryBool(q.Get("caseInsensitive"), o.CaseInsensitive); err != nil {
+		return o, fmt.Errorf("caseInsensitive: %w", err)
+	}
+	if o.DirsFirst, err = queryBool(q.Get("dirsFirst"), o.DirsFirst); err != nil {
+		return o, fmt.Errorf("dirsFirst: %w", err)
+	}
+	if o.Descending, err = queryBool(q.Get("desc"), o.Descending); err != nil {
+		return o, fmt.Errorf("desc: %w", err)
+	}
+	return o, o.Validate()
+}
+
+// filterFromQuery reads ?filter=, a glob such as *.log that listed names
+// must match.
+func filterFromQuery(r *http.Request) (string, error) {
+	pattern := r.URL.Query().Get("filter")
+	return pattern, k8s.ValidateFilter(pattern)
+}
+
+func queryBool(v string, def bool) (bool, error) {
+	switch v {
+	case "":
+		return def, nil
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
+	}
+	return def, fmt.Errorf("must be true or false")
+}
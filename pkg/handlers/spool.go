@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindArchive builds a .tar.gz or .zip of PVC paths on local disk. Spooling lets
+// a multi-gigabyte selection be served with a Content-Length and HTTP range
+// support (so interrupted downloads resume), without holding it in memory
+// or tying its creation to a single HTTP request.
+const jobKindArchive = "archive"
+
+type archiveParams struct {
+	Namespace string   `json:"namespace"`
+	PVC       string   `json:"pvc"`
+	Paths     []string `json:"paths"`
+	Exclude   []string `json:"exclude,omitempty"`
+	// Format is "tar" (a .tar.gz, the default) or "zip", as for
+	// /api/download-batch.
+	Format    string `json:"format,omitempty"`
+	Name      string `json:"name"`
+	Estimated int64  `json:"estimatedBytes"`
+}
+
+type archiveResult struct {
+	File string `json:"file"`
+	Size int64  `json:"size"`
+}
+
+func spoolDir() string {
+	if d := os.Getenv("KUBE_BROWSER_SPOOL_DIR"); d != "" {
+		return d
+	}
+	return os.TempDir()
+}
+
+func envInt64(key string, def int64) int64 {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// spoolReserve is the free space that must remain on the spool filesystem
+// after an archive is written.
+func spoolReserve() int64 {
+	return envInt64("KUBE_BROWSER_SPOOL_MIN_FREE_MB", 512) << 20
+}
+
+func spoolTTL() time.Duration {
+	return time.Duration(envInt64("KUBE_BROWSER_SPOOL_TTL_MIN", 60)) * time.Minute
+}
+
+func archiveFile(job jobs.Job) string {
+	var res archiveResult
+	if len(job.Result) > 0 && json.Unmarshal(job.Result, &res) == nil {
+		return res.File
+	}
+	return ""
+}
+
+// sweepArchives drops finished archives older than the spool TTL, along
+// with their spool files.
+func (h *Handler) sweepArchives(m *jobs.Manager) {
+	ttl := spoolTTL()
+	for _, job := range m.List() {
+		if job.Kind == jobKindArchive && job.State.Finished() && time.Since(job.Finished) > ttl {
+			log.Printf("Removing expired spooled archive %s", job.ID)
+			h.removeJob(m, job.ID)
+		}
+	}
+}
+
+var errSpoolDiskFull = errors.New("spool disk is nearly full; set KUBE_BROWSER_SPOOL_DIR to a larger volume")
+
+// spoolWriter writes to the spool file and periodically re-checks free
+// space, aborting before the local disk fills up when the estimate was
+// too low. job, when set, is told the progress.
+type spoolWriter struct {
+	f         *os.File
+	dir       string
+	job       *jobs.Handle
+	estimated int64
+	written   int64
+	sinceStat int64
+}
+
+const spoolStatInterval = 64 << 20
+
+func (sw *spoolWriter) Write(p []byte) (int, error) {
+	if sw.sinceStat >= spoolStatInterval {
+		sw.sinceStat = 0
+		if free, err := diskFree(sw.dir); err == nil && free < spoolReserve() {
+			return 0, errSpoolDiskFull
+		}
+	}
+	n, err := sw.f.Write(p)
+	sw.sinceStat += int64(n)
+	sw.written += int64(n)
+	if sw.job != nil {
+		sw.job.SetProgress(sw.written, sw.estimated)
+	}
+	return n, err
+}
+
+func archiveName(pvc string, paths []string) string {
+	if len(paths) == 1 && paths[0] != "/" {
+		return path.Base(paths[0]) + ".tar.gz"
+	}
+	return pvc + ".tar.gz"
+}
+
+// runArchiveJob streams the archive into a spool file. A previous attempt's
+// partial file (from before a restart) is discarded first.
+func (h *Handler) runArchiveJob(ctx context.Context, jh *jobs.Handle) error {
+	var p archiveParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client := h.getClient()
+	if client == nil {
+		return errors.New("not connected to Kubernetes cluster")
+	}
+
+	if job, ok := h.getJobs().Get(jh.ID()); ok {
+		if old := archiveFile(job); old != "" {
+			h.removeLocalFile(old)
+		}
+	}
+
+	dir := spoolDir()
+	if free, err := diskFree(dir); err == nil && free-p.Estimated < spoolReserve() {
+		return fmt.Errorf("not enough free space in %s to spool ~%d bytes (free: %d bytes)", dir, p.Estimated, free)
+	}
+
+	pattern := "kube-browser-archive-*.tar.gz"
+	if p.Format == "zip" {
+		pattern = "kube-browser-archive-*.zip"
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	// Record the file before writing so it can be cleaned up even if the
+	// process dies mid-archive.
+	jh.SetResult(archiveResult{File: f.Name()})
+
+	sw := &spoolWriter{f: f, dir: filepath.Dir(f.Name()), job: jh, estimated: p.Estimated}
+	if p.Format == "zip" {
+		err = spoolZip(ctx, client, p, sw)
+	} else {
+		err = client.StreamArchive(ctx, p.Namespace, p.PVC, p.Paths, p.Exclude, sw)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		h.removeLocalFile(f.Name())
+		return err
+	}
+	return jh.SetResult(archiveResult{File: f.Name(), Size: sw.written})
+}
+
+// spoolZip writes p's paths to w as a zip, rewriting the .tar.gz tar
+// streams from the pod with tarToZip.
+func spoolZip(ctx context.Context, client KubeClient, p archiveParams, w io.Writer) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(client.StreamArchive(ctx, p.Namespace, p.PVC, p.Paths, p.Exclude, pw))
+	}()
+	err := tarToZip(pr, w)
+	if err == nil {
+		// tar reports a failure only after the archive ends.
+		_, err = io.Copy(io.Discard, pr)
+	}
+	pr.CloseWithError(err)
+	return err
+}
+
+// DownloadArchiveHandler manages spooled archive downloads:
+//
+//	POST   /api/download-archive        start spooling {namespace, pvc, paths, exclude, format, name}
+//	GET    /api/download-archive?id=    job status while building, the archive once ready
+//	DELETE /api/download-archive?id=    cancel and discard
+func (h *Handler) DownloadArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	m := h.getJobs()
+	h.sweepArchives(m)
+
+	switch r.Method {
+	case http.MethodPost:
+		h.startArchiveJob(w, r)
+	case http.MethodGet:
+		h.serveArchive(w, r, m)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if job, ok := m.Get(id); !ok || job.Kind != jobKindArchive {
+			h.jsonError(w, "archive not found", http.StatusNotFound)
+			return
+		}
+		h.removeJob(m, id)
+		h.jsonResponse(w, map[string]interface{}{"deleted": true, "id": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) startArchiveJob(w http.ResponseWriter, r *http.Request) {
+	client := h.getClient()
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req archiveParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || len(req.Paths) == 0 {
+		h.jsonError(w, "namespace, pvc and paths are required", http.StatusBadRequest)
+		return
+	}
+	switch req.Format {
+	case "":
+		req.Format = "tar"
+	case "tar", "zip":
+	default:
+		h.jsonError(w, `format must be "tar" or "zip"`, http.StatusBadRequest)
+		return
+	}
+	for i, p := range req.Paths {
+		req.Paths[i] = sanitizePath(p)
+	}
+	exclude, err := k8s.CleanExcludes(req.Exclude)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Exclude = exclude
+	name := path.Base(strings.ReplaceAll(req.Name, "\\", "/"))
+	if name == "" || name == "." || name == "/" {
+		name = archiveName(req.PVC, req.Paths)
+		if req.Format == "zip" {
+			name = strings.TrimSuffix(name, ".tar.gz") + ".zip"
+		}
+	}
+	req.Name = name
+
+	dir := spoolDir()
+	estimated, err := client.DiskUsage(r.Context(), req.Namespace, req.PVC, req.Paths)
+	if err != nil {
+		log.Printf("Could not estimate archive size for %s/%s: %v", req.Namespace, req.PVC, err)
+		estimated = 0
+	}
+	if free, err := diskFree(dir); err == nil && free-estimated < spoolReserve() {
+		h.jsonError(w, fmt.Sprintf("not enough free space in %s to spool ~%d bytes (free: %d bytes)", dir, estimated, free), http.StatusInsufficientStorage)
+		return
+	}
+	req.Estimated = estimated
+
+	job, err := h.submitJob(r, jobKindArchive, fmt.Sprintf("Archive %s from %s/%s", name, req.Namespace, req.PVC), req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handler) serveArchive(w http.ResponseWriter, r *http.Request, m *jobs.Manager) {
+	job, ok := m.Get(r.URL.Query().Get("id"))
+	if !ok || job.Kind != jobKindArchive {
+		h.jsonError(w, "archive not found", http.StatusNotFound)
+		return
+	}
+
+	switch job.State {
+	case jobs.StateScheduled, jobs.StateQueued, jobs.StateRunning:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+		return
+	case jobs.StateSucceeded:
+	default:
+		h.jsonError(w, fmt.Sprintf("archive %s: %s", job.State, job.Error), http.StatusInternalServerError)
+		return
+	}
+
+	var p archiveParams
+	json.Unmarshal(job.Params, &p)
+	f, err := os.Open(archiveFile(job))
+	if err != nil {
+		h.jsonError(w, "spooled archive is no longer available", http.StatusGone)
+		return
+	}
+	defer f.Close()
+
+	// Large archives outlive the server's WriteTimeout; the spool file is
+	// local, so the only limit left is the client's own connection.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Disposition", attachmentDisposition(p.Name))
+	if p.Format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	http.ServeContent(w, r, p.Name, job.Finished, f)
+}
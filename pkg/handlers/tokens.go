@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/store"
+)
+
+const apiTokensFile = "api-tokens.json"
+
+// requireTokenEnv makes every /api/ request that does not come from
+// localhost present an API token.
+const requireTokenEnv = "KUBE_BROWSER_REQUIRE_TOKEN"
+
+// apiTokenPrefix starts every API token, so one is easy to recognise in a
+// CI secret or a leaked log.
+const apiTokenPrefix = "kbt_"
+
+// tokenUseSaveInterval is how stale a token's recorded last use may get
+// before it is written to the state directory again.
+const tokenUseSaveInterval = time.Minute
+
+// Token scopes.
+const (
+	// tokenScopeRead allows GET and HEAD only.
+	tokenScopeRead = "read"
+	// tokenScopeWrite allows every method.
+	tokenScopeWrite = "write"
+)
+
+// APIToken authorizes REST API requests that send it as a bearer token,
+// for scripts and CI pipelines that have no browser session.
+type APIToken struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Scope    string     `json:"scope"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// storedToken is an APIToken as it is saved. Only the SHA-256 of the token
+// is kept; the token itself is shown once, when it is created.
+type storedToken struct {
+	APIToken
+	Hash string `json:"hash"`
+}
+
+type apiTokens struct {
+	mu    sync.Mutex
+	items []storedToken
+	saved time.Time
+}
+
+func parseRequireTokenEnv() bool {
+	v := os.Getenv(requireTokenEnv)
+	return v == "true" || v == "1"
+}
+
+func (h *Handler) getAPITokens() *apiTokens {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.apiTokens == nil {
+		t := &apiTokens{}
+		if err := store.Load(apiTokensFile, &t.items); err != nil {
+			log.Printf("Warning: could not load API tokens: %v", err)
+		}
+		h.apiTokens = t
+	}
+	return h.apiTokens
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *apiTokens) list() []APIToken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]APIToken, len(t.items))
+	for i, item := range t.items {
+		out[i] = item.APIToken
+	}
+	return out
+}
+
+// create adds a token and returns it with its secret.
+func (t *apiTokens) create(name, scope string) (APIToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return APIToken{}, "", err
+	}
+	secret := apiTokenPrefix + hex.EncodeToString(b)
+	tok := storedToken{
+		APIToken: APIToken{ID: newID(), Name: name, Scope: scope, Created: time.Now()},
+		Hash:     hashToken(secret),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	items := append(append([]storedToken{}, t.items...), tok)
+	if err := store.Save(apiTokensFile, items); err != nil {
+		return APIToken{}, "", err
+	}
+	t.items = items
+	return tok.APIToken, secret, nil
+}
+
+func (t *apiTokens) revoke(id string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	items := make([]storedToken, 0, len(t.items))
+	for _, item := range t.items {
+		if item.ID != id {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(t.items) {
+		return false, nil
+	}
+	if err := store.Save(apiTokensFile, items); err != nil {
+		return false, err
+	}
+	t.items = items
+	return true, nil
+}
+
+// check returns the token whose secret was sent, and records its use.
+func (t *apiTokens) check(secret string) (APIToken, bool) {
+	hash := []byte(hashToken(secret))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.items {
+		if subtle.ConstantTimeCompare(hash, []byte(t.items[i].Hash)) != 1 {
+			continue
+		}
+		now := time.Now()
+		t.items[i].LastUsed = &now
+		if now.Sub(t.saved) > tokenUseSaveInterval {
+			t.saved = now
+			if err := store.Save(apiTokensFile, t.items); err != nil {
+				log.Printf("Warning: could not record API token use: %v", err)
+			}
+		}
+		return t.items[i].APIToken, true
+	}
+	return APIToken{}, false
+}
+
+type apiTokenKey struct{}
+
+// requestToken returns the API token r was authorized with, if any.
+func requestToken(r *http.Request) (APIToken, bool) {
+	tok, ok := r.Context().Value(apiTokenKey{}).(APIToken)
+	return tok, ok
+}
+
+// TokenAuth checks the API tokens sent to /api/ as
+// "Authorization: Bearer <token>". A token that is unknown or revoked is
+// refused, and a read token may only GET and HEAD. Requests without one
+// are served as before, unless KUBE_BROWSER_REQUIRE_TOKEN is set and they
+// do not come from localhost. /raw/ URLs keep their own token.
+func (h *Handler) TokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			if h.requireToken && !isLocalRequest(r) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="kube-browser"`)
+				h.jsonError(w, "an API token is required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		tok, ok := h.getAPITokens().check(strings.TrimPrefix(auth, "Bearer "))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-browser", error="invalid_token"`)
+			h.jsonError(w, "invalid or revoked API token", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/api/tokens" {
+			h.jsonError(w, "API tokens cannot manage tokens", http.StatusForbidden)
+			return
+		}
+		if tok.Scope != tokenScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.jsonError(w, fmt.Sprintf("API token %q is read-only", tok.Name), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenKey{}, tok)))
+	})
+}
+
+// APITokensHandler lists (GET), creates (POST {name, scope}) and revokes
+// (DELETE ?id=) API tokens. scope is "read" or "write". The token itself
+// is only in the response to POST. Tokens are stored in the state
+// directory; the endpoint is registered behind LocalhostOnly, and
+// TokenAuth refuses it to requests made with a token.
+func (h *Handler) APITokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens := h.getAPITokens()
+
+	switch r.Method {
+	case http.MethodGet:
+		h.jsonResponse(w, map[string]interface{}{
+			"tokens":   tokens.list(),
+			"required": h.requireToken,
+		})
+	case http.MethodPost:
+		var req struct {
+			Name  string `json:"name"`
+			Scope string `json:"scope"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			h.jsonError(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if req.Scope == "" {
+			req.Scope = tokenScopeRead
+		}
+		if req.Scope != tokenScopeRead && req.Scope != tokenScopeWrite {
+			h.jsonError(w, `scope must be "read" or "write"`, http.StatusBadRequest)
+			return
+		}
+		tok, secret, err := tokens.create(req.Name, req.Scope)
+		if err != nil {
+			h.jsonError(w, "Failed to save token: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Created %s API token %q (%s)", tok.Scope, tok.Name, tok.ID)
+		h.jsonResponse(w, map[string]interface{}{"token": tok, "secret": secret})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		removed, err := tokens.revoke(id)
+		if err != nil {
+			h.jsonError(w, "Failed to revoke token: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			h.jsonError(w, "API token not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Revoked API token %s", id)
+		h.jsonResponse(w, map[string]interface{}{"revoked": true, "id": id})
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindTransfer copies (or, within one pane, moves) paths from one pane
+// to another. The data streams from the source's StreamArchive into the
+// destination's UnpackArchive, so any pair of connections works and
+// nothing is spooled on the KubeBrowser host.
+const jobKindTransfer = "transfer"
+
+// transferEnd is one side of a transfer. Paths are only read on the
+// source and Dir only on the destination.
+type transferEnd struct {
+	Pane      string   `json:"pane,omitempty"`
+	Namespace string   `json:"namespace"`
+	PVC       string   `json:"pvc"`
+	Paths     []string `json:"paths,omitempty"`
+	Dir       string   `json:"dir,omitempty"`
+}
+
+func (e transferEnd) String() string {
+	pane := e.Pane
+	if pane == "" {
+		pane = mainPane
+	}
+	return fmt.Sprintf("%s:%s/%s", pane, e.Namespace, e.PVC)
+}
+
+type transferParams struct {
+	Source      transferEnd `json:"source"`
+	Destination transferEnd `json:"destination"`
+	// Mode is "copy" (the default) or "move".
+	Mode string `json:"mode,omitempty"`
+	// Exclude leaves matching entries out of a copy (see k8s.CleanExcludes).
+	Exclude []string `json:"exclude,omitempty"`
+	// Preserve, unless false, keeps the modification times and modes of
+	// what is copied.
+	Preserve *bool `json:"preserve,omitempty"`
+	// Compress is how the data crosses the exec streams: none, gzip or
+	// zstd; empty follows KUBE_BROWSER_TRANSFER_COMPRESSION.
+	Compress  string `json:"compress,omitempty"`
+	Estimated int64  `json:"estimatedBytes"`
+}
+
+type transferResult struct {
+	Stage k8s.MoveStage `json:"stage,omitempty"`
+	Files int           `json:"files"`
+}
+
+func (h *Handler) runTransferJob(ctx context.Context, jh *jobs.Handle) error {
+	var p transferParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	src := h.paneClient(p.Source.Pane)
+	dst := h.paneClient(p.Destination.Pane)
+	if src == nil || dst == nil {
+		return errors.New("a pane of this transfer is no longer open")
+	}
+	ctx = withTransferCompression(ctx, p.Compress)
+
+	if p.Mode == "move" {
+		from := k8s.PVCRef{Namespace: p.Source.Namespace, PVC: p.Source.PVC}
+		to := k8s.PVCRef{Namespace: p.Destination.Namespace, PVC: p.Destination.PVC}
+		files, err := src.MoveBetweenPVCs(ctx, from, p.Source.Paths, to, p.Destination.Dir,
+			func(s k8s.MoveStage) { jh.SetResult(transferResult{Stage: s}) },
+			func(n int64) { jh.SetProgress(n, p.Estimated) })
+		if err != nil {
+			return err
+		}
+		log.Printf("Moved %d file(s) from %s to %s:%s", files, p.Source, p.Destination, p.Destination.Dir)
+		return jh.SetResult(transferResult{Stage: "done", Files: files})
+	}
+
+	start := time.Now()
+	var files int
+	var copied int64
+	for _, srcPath := range p.Source.Paths {
+		base := copied
+		n, size, err := copyBetweenPanes(ctx, src, p.Source, srcPath, p.Exclude, preserveOption(p.Preserve), dst, p.Destination,
+			func(n int64) { jh.SetProgress(base+n, p.Estimated) })
+		files += n
+		copied += size
+		if err != nil {
+			return err
+		}
+	}
+	h.throughput.record(src, copied, time.Since(start))
+	log.Printf("Copied %d file(s) from %s to %s:%s", files, p.Source, p.Destination, p.Destination.Dir)
+	return jh.SetResult(transferResult{Stage: "done", Files: files})
+}
+
+// execSlotReserver is implemented by clients that bound their concurrent
+// execs (see k8s.Client.ReserveExecSlots).
+type execSlotReserver interface {
+	ReserveExecSlots(ctx context.Context, n int) (context.Context, func(), error)
+}
+
+// copyBetweenPanes copies srcPath, a file or a directory, into to.Dir,
+// where it lands under its own name, leaving out entries matching exclude,
+// with its times and modes when preserve is set. It returns the number of
+// files and bytes copied.
+func copyBetweenPanes(ctx context.Context, src KubeClient, from transferEnd, srcPath string, exclude []string, preserve bool, dst KubeClient, to transferEnd, progress func(int64)) (int, int64, error) {
+	if r, ok := src.(execSlotReserver); ok && src == dst {
+		reserved, release, err := r.ReserveExecSlots(ctx, 2)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer release()
+		ctx = reserved
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	archive, archiveW := io.Pipe()
+	go func() {
+		archiveW.CloseWithError(src.StreamArchive(ctx, from.Namespace, from.PVC, []string{srcPath}, exclude, archiveW))
+	}()
+
+	type rebaseResult struct {
+		files int
+		bytes int64
+		err   error
+	}
+	rebased, rebasedW := io.Pipe()
+	done := make(chan rebaseResult, 1)
+	go func() {
+		files, n, err := rebaseArchive(rebasedW, archive, path.Dir(srcPath), preserve, progress)
+		rebasedW.CloseWithError(err)
+		// Stops the source if the copy gave up partway.
+		archive.CloseWithError(err)
+		done <- rebaseResult{files, n, err}
+	}()
+
+	dstErr := dst.UnpackArchive(ctx, to.Namespace, to.PVC, to.Dir, rebased)
+	rebased.CloseWithError(io.ErrClosedPipe)
+	res := <-done
+	if res.err != nil && !errors.Is(res.err, io.ErrClosedPipe) {
+		return res.files, res.bytes, fmt.Errorf("reading %s from %s: %w", srcPath, from, res.err)
+	}
+	if dstErr != nil {
+		return res.files, res.bytes, fmt.Errorf("writing to %s: %w", to, dstErr)
+	}
+	return res.files, res.bytes, nil
+}
+
+// rebaseArchive turns the gzip-compressed archive StreamArchive writes,
+// whose names are relative to the volume root, into a plain tar whose
+// names are relative to parent, so entries land in the destination
+// directory under their own names. Directories, regular files, symlinks
+// and hard links inside the copied tree are kept; other entries are
+// dropped. Unless preserve is set, times and modes are reset (see
+// stripMetadata). progress receives the file bytes written so far.
+func rebaseArchive(w io.Writer, gzipped io.Reader, parent string, preserve bool, progress func(int64)) (int, int64, error) {
+	gz, err := gzip.NewReader(gzipped)
+	if err != nil {
+		return 0, 0, err
+	}
+	prefix := strings.Trim(parent, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	rebase := func(name string) (string, bool) {
+		name = strings.TrimPrefix(name, "./")
+		if !strings.HasPrefix(name, prefix) {
+			return "", false
+		}
+		name = strings.TrimPrefix(name, prefix)
+		return name, name != "" && name != "/"
+	}
+
+	tr := tar.NewReader(gz)
+	tw := tar.NewWriter(w)
+	var files int
+	var written int64
+	now := time.Now()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, written, err
+		}
+		name, ok := rebase(hdr.Name)
+		if !ok {
+			continue
+		}
+		out := &tar.Header{
+			Typeflag: hdr.Typeflag,
+			Name:     name,
+			Mode:     hdr.Mode,
+			ModTime:  hdr.ModTime,
+			Uid:      hdr.Uid,
+			Gid:      hdr.Gid,
+			Uname:    hdr.Uname,
+			Gname:    hdr.Gname,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg:
+			out.Size = hdr.Size
+		case tar.TypeSymlink:
+			out.Linkname = hdr.Linkname
+		case tar.TypeLink:
+			if out.Linkname, ok = rebase(hdr.Linkname); !ok {
+				continue
+			}
+		default:
+			continue
+		}
+		if !preserve {
+			stripMetadata(out, now)
+		}
+		if err := tw.WriteHeader(out); err != nil {
+			return files, written, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		n, err := io.Copy(tw, tr)
+		written += n
+		if err != nil {
+			return files, written, err
+		}
+		files++
+		if progress != nil {
+			progress(written)
+		}
+	}
+	return files, written, tw.Close()
+}
+
+// TransferHandler queues a copy from one pane to another, or between two
+// PVCs of the same pane:
+//
+//	POST /api/transfer {"source": {pane, namespace, pvc, paths},
+//	                    "destination": {pane, namespace, pvc, dir},
+//	                    "mode": "copy"|"move", "exclude": [patterns],
+//	                    "preserve": true|false}
+//
+// pane defaults to the main connection and dir to "/". Copied paths land
+// in dir under their own names, without entries matching exclude, with
+// their modification times and modes unless preserve is false. "move" is
+// only available within one pane, where it runs like /api/move, and takes
+// no exclude patterns and always preserves. Progress is reported by
+// /api/jobs.
+func (h *Handler) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+
+	var req transferParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	src, dst := h.paneClient(req.Source.Pane), h.paneClient(req.Destination.Pane)
+	if src == nil || dst == nil {
+		h.jsonError(w, "Source or destination pane is not connected", http.StatusServiceUnavailable)
+		return
+	}
+	if req.Source.Namespace == "" || req.Source.PVC == "" || req.Destination.Namespace == "" || req.Destination.PVC == "" || len(req.Source.Paths) == 0 {
+		h.jsonError(w, "source namespace, pvc and paths, and destination namespace and pvc are required", http.StatusBadRequest)
+		return
+	}
+	for i, p := range req.Source.Paths {
+		req.Source.Paths[i] = sanitizePath(p)
+	}
+	req.Destination.Dir = sanitizePath(req.Destination.Dir)
+	if h.refuseTrashWrite(w, req.Destination.Dir) {
+		return
+	}
+	exclude, err := k8s.CleanExcludes(req.Exclude)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Exclude = exclude
+	if err := checkTransferCompression(req.Compress); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samePane := src == dst
+	sameVolume := samePane && req.Source.Namespace == req.Destination.Namespace && req.Source.PVC == req.Destination.PVC
+	switch req.Mode {
+	case "", "copy":
+		req.Mode = "copy"
+		if sameVolume {
+			for _, p := range req.Source.Paths {
+				if p == req.Destination.Dir || p == "/" || strings.HasPrefix(req.Destination.Dir, p+"/") {
+					h.jsonError(w, fmt.Sprintf("cannot copy %s into itself", p), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+	case "move":
+		if !samePane {
+			h.jsonError(w, "moving between panes is not supported; copy, then delete the source", http.StatusBadRequest)
+			return
+		}
+		if sameVolume {
+			h.jsonError(w, "source and destination are the same PVC", http.StatusBadRequest)
+			return
+		}
+		if len(req.Exclude) > 0 {
+			// The move deletes the source paths whole, excluded entries too.
+			h.jsonError(w, "exclude patterns are not supported when moving; copy, then delete the source", http.StatusBadRequest)
+			return
+		}
+		if !preserveOption(req.Preserve) {
+			h.jsonError(w, "a move always keeps modification times and modes; copy with preserve false, then delete the source", http.StatusBadRequest)
+			return
+		}
+	default:
+		h.jsonError(w, `mode must be "copy" or "move"`, http.StatusBadRequest)
+		return
+	}
+
+	estimated, err := src.DiskUsage(r.Context(), req.Source.Namespace, req.Source.PVC, req.Source.Paths)
+	if err != nil {
+		log.Printf("Could not estimate transfer size for %s: %v", req.Source, err)
+		estimated = 0
+	}
+	req.Estimated = estimated
+
+	verb := "Copy"
+	if req.Mode == "move" {
+		verb = "Move"
+	}
+	what := path.Base(req.Source.Paths[0])
+	if len(req.Source.Paths) > 1 {
+		what = fmt.Sprintf("%d items", len(req.Source.Paths))
+	}
+	noteActivity(r, req.Source.Namespace, req.Source.PVC, req.Source.Paths[0], "")
+	job, err := h.submitJob(r, jobKindTransfer, fmt.Sprintf("%s %s from %s to %s", verb, what, req.Source, req.Destination), req)
+	if err != nil {
+		h.jsonError(w, err.Error(), jobSubmitStatus(err))
+		return
+	}
+	noteActivityJob(r, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
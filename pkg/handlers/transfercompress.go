@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"kube-browser/pkg/k8s"
+)
+
+// transferCompressionHeader tells how a download crossed the exec stream:
+// none, gzip or zstd.
+const transferCompressionHeader = "X-Transfer-Compression"
+
+// compressedDownloader is implemented by clients whose downloads cross an
+// exec stream that can be compressed in the pod (see
+// k8s.Client.DownloadFileCompressed).
+type compressedDownloader interface {
+	DownloadFileCompressed(ctx context.Context, namespace, pvcName, filePath string, compression k8s.TransferCompression) (io.ReadCloser, string, error)
+}
+
+// transferCompressionFromQuery reads ?compress=none|gzip|zstd, falling
+// back to KUBE_BROWSER_TRANSFER_COMPRESSION.
+func transferCompressionFromQuery(r *http.Request) (k8s.TransferCompression, error) {
+	v := r.URL.Query().Get("compress")
+	if v == "" {
+		return k8s.DefaultTransferCompression(), nil
+	}
+	return k8s.ParseTransferCompression(v)
+}
+
+// withTransferCompression returns ctx with the compression a job asked
+// for, when it asked for one: s is its "compress" param, already checked
+// by checkTransferCompression.
+func withTransferCompression(ctx context.Context, s string) context.Context {
+	if s == "" {
+		return ctx
+	}
+	c, _ := k8s.ParseTransferCompression(s)
+	return k8s.WithTransferCompression(ctx, c)
+}
+
+// checkTransferCompression validates the "compress" param of a job.
+func checkTransferCompression(s string) error {
+	if s == "" {
+		return nil
+	}
+	_, err := k8s.ParseTransferCompression(s)
+	return err
+}
+
+// downloadFile opens a file of the PVC, compressed on its way out of the
+// pod as compression says when the client supports it.
+func downloadFile(ctx context.Context, client KubeClient, namespace, pvc, filePath string, compression k8s.TransferCompression) (io.ReadCloser, string, error) {
+	if cd, ok := client.(compressedDownloader); ok {
+		return cd.DownloadFileCompressed(ctx, namespace, pvc, filePath, compression)
+	}
+	return client.DownloadFile(ctx, namespace, pvc, filePath)
+}
+
+// setTransferCompression reports how reader crossed the exec stream, once
+// its first bytes have been read.
+func setTransferCompression(w http.ResponseWriter, reader io.Reader) {
+	if ti, ok := reader.(k8s.TransferInfo); ok {
+		w.Header().Set(transferCompressionHeader, string(ti.Compression()))
+	}
+}
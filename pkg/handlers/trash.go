@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// With KUBE_BROWSER_TRASH set, a delete moves the entry into trashDir on
+// the same PVC instead of removing it, from where it can be restored until
+// the retention runs out. Each deleted entry gets a directory of its own,
+// named after the time it was deleted:
+//
+//	/.kube-browser-trash/20261016T093000Z-1a2b3c4d/item       the entry
+//	/.kube-browser-trash/20261016T093000Z-1a2b3c4d/info.json  a trashEntry
+//
+// Moving within the volume is a rename, so trashing costs no copy and no
+// space until the trash is purged.
+const (
+	trashDir      = "/.kube-browser-trash"
+	trashItem     = "item"
+	trashInfoFile = "info.json"
+	trashIDTime   = "20060102T150405Z"
+)
+
+var trashIDPattern = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]+$`)
+
+// trashEnabled reads KUBE_BROWSER_TRASH.
+func trashEnabled() bool {
+	v := os.Getenv("KUBE_BROWSER_TRASH")
+	return v == "true" || v == "1"
+}
+
+// trashRetention reads KUBE_BROWSER_TRASH_RETENTION_DAYS, how long deleted
+// entries are kept (default 7). 0 keeps them until the trash is emptied.
+func trashRetention() time.Duration {
+	return time.Duration(envInt64("KUBE_BROWSER_TRASH_RETENTION_DAYS", 7)) * 24 * time.Hour
+}
+
+// trashEntry describes one deleted entry.
+type trashEntry struct {
+	ID        string     `json:"id"`
+	Path      string     `json:"path"`
+	IsDir     bool       `json:"isDir"`
+	DeletedAt time.Time  `json:"deletedAt"`
+	DeletedBy string     `json:"deletedBy,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// inTrash reports whether p is the trash or inside it. Deleting there
+// removes for good.
+func inTrash(p string) bool {
+	return p == trashDir || strings.HasPrefix(p, trashDir+"/")
+}
+
+// refuseTrashWrite answers 400 when one of paths is the trash or inside
+// it. Only a delete puts entries there, so an upload, a move or an
+// extraction cannot plant one for a restore to follow.
+func (h *Handler) refuseTrashWrite(w http.ResponseWriter, paths ...string) bool {
+	for _, p := range paths {
+		if inTrash(sanitizePath(p)) {
+			h.jsonError(w, fmt.Sprintf("cannot write into %s; only deleting puts entries there", trashDir), http.StatusBadRequest)
+			return true
+		}
+	}
+	return false
+}
+
+func trashEntryDir(id string) string {
+	return trashDir + "/" + id
+}
+
+// trashIDTimeOf returns when the entry id was deleted.
+func trashIDTimeOf(id string) (time.Time, bool) {
+	if !trashIDPattern.MatchString(id) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(trashIDTime, id[:len(trashIDTime)])
+	return t, err == nil
+}
+
+// moveToTrash deletes p by moving it into the trash. Like a real delete, a
+// file must not be a directory and a directory must be one; an empty
+// directory deleted without recursive is simply removed, as there is
+// nothing in it to restore.
+func moveToTrash(ctx context.Context, client KubeClient, namespace, pvc, p string, isDir, recursive bool, user string) (*trashEntry, error) {
+	if isDir && !recursive {
+		return nil, client.DeleteDirectory(ctx, namespace, pvc, p, false)
+	}
+	info, err := client.ResolvePath(ctx, namespace, pvc, p)
+	if err != nil {
+		return nil, err
+	}
+	symlink := info.LinkTarget != ""
+	switch {
+	case !info.Exists && !symlink:
+		return nil, &k8s.K8sError{Kind: k8s.ErrKindPathNotFound, Message: fmt.Sprintf("%s: No such file or directory.", p)}
+	case isDir && (!info.IsDir || symlink):
+		return nil, &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s: Not a directory.", p)}
+	case !isDir && info.IsDir && !symlink:
+		return nil, &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s: Is a directory.", p)}
+	}
+
+	now := time.Now().UTC()
+	entry := &trashEntry{
+		ID:        now.Format(trashIDTime) + "-" + newID()[:8],
+		Path:      p,
+		IsDir:     isDir,
+		DeletedAt: now,
+		DeletedBy: user,
+	}
+	dir := trashEntryDir(entry.ID)
+	if err := client.Move(ctx, namespace, pvc, p, dir+"/"+trashItem); err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(entry)
+	if err := client.SaveFile(ctx, namespace, pvc, dir+"/"+trashInfoFile, data); err != nil {
+		// Without its info the entry could not be restored: put it back.
+		if mvErr := client.Move(ctx, namespace, pvc, dir+"/"+trashItem, p); mvErr != nil {
+			log.Printf("Warning: %s of %s/%s is left in %s: %v", p, namespace, pvc, dir, mvErr)
+		}
+		return nil, err
+	}
+	entry.ExpiresAt = trashExpiry(entry.DeletedAt)
+	return entry, nil
+}
+
+func trashExpiry(deleted time.Time) *time.Time {
+	if trashRetention() <= 0 {
+		return nil
+	}
+	t := deleted.Add(trashRetention())
+	return &t
+}
+
+// listTrash returns the entries in the trash of a PVC, newest first. An
+// entry whose info cannot be read is listed with its id alone.
+func listTrash(ctx context.Context, client KubeClient, namespace, pvc string) ([]trashEntry, error) {
+	files, err := client.ListFiles(ctx, namespace, pvc, trashDir)
+	if err != nil {
+		var ke *k8s.K8sError
+		if errors.As(err, &ke) && ke.Kind == k8s.ErrKindPathNotFound {
+			return []trashEntry{}, nil
+		}
+		return nil, err
+	}
+	entries := []trashEntry{}
+	for _, f := range files {
+		deleted, ok := trashIDTimeOf(f.Name)
+		if !f.IsDir || !ok {
+			continue
+		}
+		entry := trashEntry{ID: f.Name, DeletedAt: deleted}
+		if data, _, err := client.ReadFileHead(ctx, namespace, pvc, trashEntryDir(f.Name)+"/"+trashInfoFile, maxMetaFieldSize); err == nil {
+			json.Unmarshal(data, &entry)
+			entry.ID = f.Name
+		}
+		entry.ExpiresAt = trashExpiry(entry.DeletedAt)
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries, nil
+}
+
+// purgeTrash removes the entries of a PVC's trash that have outlived the
+// retention, or all of them with all, and returns how many went. Expired
+// entries are found from their ids alone, without reading their info.
+func purgeTrash(ctx context.Context, client KubeClient, namespace, pvc string, all bool) (int, error) {
+	if all {
+		entries, err := listTrash(ctx, client, namespace, pvc)
+		if err != nil || len(entries) == 0 {
+			return 0, err
+		}
+		return len(entries), client.DeleteDirectory(ctx, namespace, pvc, trashDir, true)
+	}
+	retention := trashRetention()
+	if retention <= 0 {
+		return 0, nil
+	}
+	files, err := client.ListFiles(ctx, namespace, pvc, trashDir)
+	if err != nil {
+		var ke *k8s.K8sError
+		if errors.As(err, &ke) && ke.Kind == k8s.ErrKindPathNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	purged := 0
+	for _, f := range files {
+		deleted, ok := trashIDTimeOf(f.Name)
+		if !f.IsDir || !ok || time.Since(deleted) < retention {
+			continue
+		}
+		if err := client.DeleteDirectory(ctx, namespace, pvc, trashEntryDir(f.Name), true); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeTrashLater purges the expired entries of a PVC's trash in the
+// background after something was moved into it, so the trash of a volume
+// that sees deletes does not grow without end.
+func purgeTrashLater(client KubeClient, namespace, pvc string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if n, err := purgeTrash(ctx, client, namespace, pvc, false); err != nil {
+			log.Printf("Warning: purging the trash of %s/%s: %v", namespace, pvc, err)
+		} else if n > 0 {
+			log.Printf("Purged %d expired trash entries of %s/%s", n, namespace, pvc)
+		}
+	}()
+}
+
+type trashRequest struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+	ID        string `json:"id"`
+	To        string `json:"to"`
+	All       bool   `json:"all"`
+}
+
+// decodeTrashRequest reads the body of a trash request, answering 400 when
+// it is not one.
+func (h *Handler) decodeTrashRequest(w http.ResponseWriter, r *http.Request, needID bool) (*trashRequest, bool) {
+	var req trashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if req.Namespace == "" || req.PVC == "" {
+		h.jsonError(w, "namespace and pvc are required", http.StatusBadRequest)
+		return nil, false
+	}
+	if needID && req.ID == "" {
+		h.jsonError(w, "id is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if _, ok := trashIDTimeOf(req.ID); req.ID != "" && !ok {
+		h.jsonError(w, "id is not a trash entry", http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+// TrashHandler lists what was deleted from a PVC while the trash was on:
+//
+//	GET /api/trash?namespace=&pvc=
+//
+// Listing changes nothing: expired entries are listed until a delete or
+// POST /api/trash/purge purges them.
+func (h *Handler) TrashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	namespace, pvc := r.URL.Query().Get("namespace"), r.URL.Query().Get("pvc")
+	if namespace == "" || pvc == "" {
+		h.jsonError(w, "namespace and pvc are required", http.StatusBadRequest)
+		return
+	}
+	entries, err := listTrash(r.Context(), client, namespace, pvc)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]interface{}{
+		"enabled":       trashEnabled(),
+		"entries":       entries,
+		"retentionDays": int64(trashRetention() / (24 * time.Hour)),
+	}
+	h.jsonResponse(w, resp)
+}
+
+// TrashRestoreHandler moves an entry out of the trash, back where it was
+// deleted from or to another path of the PVC:
+//
+//	POST /api/trash/restore {namespace, pvc, id, to}
+//
+// A path that has since been taken is not written over: the restore
+// fails with 409 and can be retried with to.
+func (h *Handler) TrashRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	req, ok := h.decodeTrashRequest(w, r, true)
+	if !ok {
+		return
+	}
+	dir := trashEntryDir(req.ID)
+	var entry trashEntry
+	data, _, err := client.ReadFileHead(r.Context(), req.Namespace, req.PVC, dir+"/"+trashInfoFile, maxMetaFieldSize)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusNotFound)
+		return
+	}
+	json.Unmarshal(data, &entry)
+	if entry.Path == "" && req.To == "" {
+		h.jsonError(w, "the trash entry does not say where it was deleted from; give a path in to", http.StatusConflict)
+		return
+	}
+	// The info is a file on the volume anyone who may write there could
+	// have changed, so its path is cleaned like one from a request.
+	dest := sanitizePath(entry.Path)
+	if req.To != "" {
+		dest = sanitizePath(req.To)
+	}
+	if dest == "/" || inTrash(dest) {
+		h.jsonError(w, "cannot restore into the root of the PVC or the trash", http.StatusBadRequest)
+		return
+	}
+	noteActivity(r, req.Namespace, req.PVC, dest, "Restore "+path.Base(dest))
+
+	exists, err := client.PathsExist(r.Context(), req.Namespace, req.PVC, []string{dest})
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	if exists[0] {
+		h.jsonError(w, fmt.Sprintf("%s %v; restore it to another path", dest, errUploadExists), http.StatusConflict)
+		return
+	}
+	if err := client.Move(r.Context(), req.Namespace, req.PVC, dir+"/"+trashItem, dest); err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	if err := client.DeleteDirectory(r.Context(), req.Namespace, req.PVC, dir, true); err != nil {
+		log.Printf("Warning: %s restored, but its trash entry %s stays: %v", dest, req.ID, err)
+	}
+	log.Printf("Restored %s of %s/%s from the trash (client %s)", dest, req.Namespace, req.PVC, r.RemoteAddr)
+	h.jsonResponse(w, map[string]interface{}{"restored": dest, "isDir": entry.IsDir})
+}
+
+// TrashPurgeHandler removes entries from the trash for good:
+//
+//	POST /api/trash/purge {namespace, pvc, id}
+//	POST /api/trash/purge {namespace, pvc, all: true}
+//	POST /api/trash/purge {namespace, pvc}
+//
+// with id that one entry, with all everything, and otherwise those that
+// have outlived KUBE_BROWSER_TRASH_RETENTION_DAYS.
+func (h *Handler) TrashPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.checkReadOnly(w) {
+		return
+	}
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+	req, ok := h.decodeTrashRequest(w, r, false)
+	if !ok {
+		return
+	}
+	noteActivity(r, req.Namespace, req.PVC, trashDir, "")
+
+	purged := 1
+	var err error
+	if req.ID != "" {
+		err = client.DeleteDirectory(r.Context(), req.Namespace, req.PVC, trashEntryDir(req.ID), true)
+	} else {
+		purged, err = purgeTrash(r.Context(), client, req.Namespace, req.PVC, req.All)
+	}
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Purged %d trash entries of %s/%s (client %s)", purged, req.Namespace, req.PVC, r.RemoteAddr)
+	h.jsonResponse(w, map[string]interface{}{"purged": purged})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// What an upload does when its file already exists. Overwrite is the
+// default, as uploads always did.
+const (
+	uploadConflictFail      = "fail"
+	uploadConflictOverwrite = "overwrite"
+	uploadConflictRename    = "rename"
+	uploadConflictSkip      = "skip"
+)
+
+// uploadRenameTries bounds the "name (N).ext" tried for a renamed upload.
+const uploadRenameTries = 20
+
+// errUploadExists is the error of an upload refused because its file
+// already exists.
+var errUploadExists = errors.New("already exists")
+
+// parseUploadConflict checks an onConflict setting.
+func parseUploadConflict(s string) (string, error) {
+	switch s {
+	case "":
+		return uploadConflictOverwrite, nil
+	case uploadConflictFail, uploadConflictOverwrite, uploadConflictRename, uploadConflictSkip:
+		return s, nil
+	}
+	return "", fmt.Errorf("onConflict must be %q, %q, %q or %q", uploadConflictFail, uploadConflictOverwrite, uploadConflictRename, uploadConflictSkip)
+}
+
+// uploadTarget is where one uploaded file goes.
+type uploadTarget struct {
+	path    string
+	exists  bool
+	renamed bool
+	skip    bool
+	err     error
+}
+
+// renameCandidates returns the names tried, in order, for a file renamed
+// on upload: "report (1).pdf", "report (2).pdf", ...
+func renameCandidates(p string) []string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	out := make([]string, uploadRenameTries)
+	for i := range out {
+		out[i] = fmt.Sprintf("%s%s (%d)%s", dir, stem, i+1, ext)
+	}
+	return out
+}
+
+// planUploads works out, with a single pre-flight check in the pod, where
+// each of paths is written under policy. A file that exists is then
+// written over, renamed to the first free candidate, skipped, or refused
+// with errUploadExists. Every path is taken, so two files are never
+// renamed to the same name.
+func planUploads(ctx context.Context, client KubeClient, namespace, pvc string, paths []string, policy string) ([]uploadTarget, error) {
+	targets := make([]uploadTarget, len(paths))
+	if policy == uploadConflictOverwrite {
+		for i, p := range paths {
+			targets[i].path = p
+		}
+		return targets, nil
+	}
+
+	check := append([]string{}, paths...)
+	if policy == uploadConflictRename {
+		for _, p := range paths {
+			check = append(check, renameCandidates(p)...)
+		}
+	}
+	found, err := client.PathsExist(ctx, namespace, pvc, check)
+	if err != nil {
+		return nil, err
+	}
+	taken := map[string]bool{}
+	for i, p := range check {
+		if found[i] || i < len(paths) {
+			taken[p] = true
+		}
+	}
+
+	for i, p := range paths {
+		targets[i] = uploadTarget{path: p, exists: found[i]}
+		if !found[i] {
+			continue
+		}
+		switch policy {
+		case uploadConflictFail:
+			targets[i].err = fmt.Errorf("%s %w", p, errUploadExists)
+		case uploadConflictSkip:
+			targets[i].skip = true
+		case uploadConflictRename:
+			targets[i].err = fmt.Errorf("%s %w and no free name was found to rename it to", p, errUploadExists)
+			for _, candidate := range renameCandidates(p) {
+				if !taken[candidate] {
+					taken[candidate] = true
+					targets[i] = uploadTarget{path: candidate, exists: true, renamed: true}
+					break
+				}
+			}
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// uploadArchiveFormat returns the format of an archive upload from its
+// name: "tar", "tar.gz" or "zip".
+func uploadArchiveFormat(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", true
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", true
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", true
+	}
+	return "", false
+}
+
+// cleanMemberName makes an archive member's name relative and rejects one
+// that would land outside the destination directory.
+func cleanMemberName(name string) (string, error) {
+	n := strings.TrimPrefix(strings.ReplaceAll(name, "\\", "/"), "./")
+	clean := path.Clean(n)
+	if path.IsAbs(n) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("archive member %q is outside the destination", name)
+	}
+	return clean, nil
+}
+
+// checkSymlink rejects a symlink member pointing outside the destination,
+// which later members could be written through.
+func checkSymlink(name, target string) error {
+	resolved := path.Clean(path.Join(path.Dir(name), target))
+	if path.IsAbs(target) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("archive member %q links outside the destination (%s)", name, target)
+	}
+	return nil
+}
+
+// tarToTar copies a tar stream (gzip-compressed when gzipped) to w as a
+// plain tar of directories, regular files and links whose names all stay
+// below the destination, for UnpackArchive. Unless preserve is set, their
+// times and modes are reset (see stripMetadata). It returns the number of
+// regular files.
+func tarToTar(w io.Writer, r io.Reader, gzipped, preserve bool) (int, error) {
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	files := 0
+	now := time.Now()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		name, err := cleanMemberName(hdr.Name)
+		if err != nil {
+			return files, err
+		}
+		if name == "." {
+			continue
+		}
+		out := &tar.Header{Typeflag: hdr.Typeflag, Name: name, Mode: hdr.Mode, ModTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg:
+			out.Size = hdr.Size
+		case tar.TypeSymlink:
+			if err := checkSymlink(name, hdr.Linkname); err != nil {
+				return files, err
+			}
+			out.Linkname = hdr.Linkname
+		case tar.TypeLink:
+			if out.Linkname, err = cleanMemberName(hdr.Linkname); err != nil {
+				return files, err
+			}
+		default:
+			continue
+		}
+		if !preserve {
+			stripMetadata(out, now)
+		}
+		if err := tw.WriteHeader(out); err != nil {
+			return files, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tw, tr); err != nil {
+				return files, err
+			}
+			files++
+		}
+	}
+	return files, tw.Close()
+}
+
+// zipToTar writes the members of a zip archive to w as a plain tar, with
+// the same checks as tarToTar. A zip is read from its central directory at
+// the end, so it needs the whole file.
+func zipToTar(w io.Writer, ra io.ReaderAt, size int64, preserve bool) (int, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(w)
+	files := 0
+	now := time.Now()
+	for _, f := range zr.File {
+		name, err := cleanMemberName(f.Name)
+		if err != nil {
+			return files, err
+		}
+		if name == "." {
+			continue
+		}
+		mode := f.Mode()
+		out := &tar.Header{Name: name, Mode: int64(mode.Perm()), ModTime: f.Modified}
+		switch {
+		case mode.IsDir():
+			out.Typeflag = tar.TypeDir
+		case mode&os.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return files, err
+			}
+			target, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return files, err
+			}
+			if err := checkSymlink(name, string(target)); err != nil {
+				return files, err
+			}
+			out.Typeflag, out.Linkname = tar.TypeSymlink, string(target)
+		case mode.IsRegular():
+			out.Typeflag, out.Size = tar.TypeReg, int64(f.UncompressedSize64)
+			if out.Mode == 0 {
+				out.Mode = 0o644
+			}
+		default:
+			continue
+		}
+		if !preserve {
+			stripMetadata(out, now)
+		}
+		if err := tw.WriteHeader(out); err != nil {
+			return files, err
+		}
+		if out.Typeflag != tar.TypeReg {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return files, err
+		}
+		_, err = io.Copy(tw, rc)
+		rc.Close()
+		if err != nil {
+			return files, err
+		}
+		files++
+	}
+	return files, tw.Close()
+}
+
+// extractUpload unpacks an uploaded archive into destDir on the PVC. Tar
+// archives stream straight through; a zip is spooled first unless it
+// already was. Members are checked and repacked as a plain tar in
+// KubeBrowser, so the pod only needs tar, whatever the upload's format;
+// they keep their times and modes when preserve is set.
+func (h *Handler) extractUpload(ctx context.Context, client KubeClient, namespace, pvc, destDir, fileName string, data io.Reader, spooled *spooledUpload, preserve bool) (int, error) {
+	format, _ := uploadArchiveFormat(fileName)
+	if format == "zip" && spooled == nil {
+		var limited *limitEnforcingReader
+		var err error
+		spooled, limited, err = h.spoolUpload(data, maxUploadSize())
+		if err != nil {
+			if limited != nil && limited.exceeded {
+				return 0, errUploadTooLarge
+			}
+			return 0, err
+		}
+		defer h.removeSpooledUpload(spooled)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pr, pw := io.Pipe()
+	type result struct {
+		files int
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		switch format {
+		case "zip":
+			res.files, res.err = zipToTar(pw, spooled.f, spooled.size, preserve)
+		default:
+			res.files, res.err = tarToTar(pw, data, format == "tar.gz", preserve)
+		}
+		pw.CloseWithError(res.err)
+		done <- res
+	}()
+
+	unpackErr := client.UnpackArchive(ctx, namespace, pvc, destDir, pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	res := <-done
+	if res.err != nil && !errors.Is(res.err, io.ErrClosedPipe) {
+		// The archive's own error explains a failed unpack better than
+		// tar's complaint about the stream it was given.
+		return res.files, &badArchiveError{err: res.err}
+	}
+	return res.files, unpackErr
+}
+
+// badArchiveError is an upload that could not be read as the archive its
+// name promised, or that holds members outside the destination.
+type badArchiveError struct{ err error }
+
+func (e *badArchiveError) Error() string { return "invalid archive: " + e.err.Error() }
+func (e *badArchiveError) Unwrap() error { return e.err }
+
+// extractStatus is the HTTP status for a failed extraction.
+func extractStatus(err error) int {
+	var bad *badArchiveError
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errSpoolDiskFull):
+		return http.StatusInsufficientStorage
+	case errors.As(err, &bad):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// uploadSpoolPattern names the files uploads are spooled to, so ones left
+// behind by a crash can be found again.
+const uploadSpoolPattern = "kube-browser-upload-*"
+
+// spooledUpload is the file part of an upload that could not be streamed,
+// held in the spool directory until the rest of the form is read.
+type spooledUpload struct {
+	f    *os.File
+	size int64
+}
+
+// spoolUpload copies an upload's file part to the spool directory. It
+// refuses to start when the spool volume is already below its reserve and
+// stops when it gets there, or when the part exceeds limit; the partial
+// file is removed either way.
+func (h *Handler) spoolUpload(part io.Reader, limit int64) (*spooledUpload, *limitEnforcingReader, error) {
+	dir := spoolDir()
+	if free, err := diskFree(dir); err == nil && free < spoolReserve() {
+		return nil, nil, errSpoolDiskFull
+	}
+	f, err := os.CreateTemp(dir, uploadSpoolPattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	limited := &limitEnforcingReader{r: part, limit: limit}
+	sw := &spoolWriter{f: f, dir: dir}
+	if _, err := io.Copy(sw, limited); err != nil {
+		f.Close()
+		h.removeLocalFile(f.Name())
+		return nil, limited, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		h.removeLocalFile(f.Name())
+		return nil, limited, err
+	}
+	return &spooledUpload{f: f, size: sw.written}, limited, nil
+}
+
+func (h *Handler) removeSpooledUpload(s *spooledUpload) {
+	s.f.Close()
+	h.removeLocalFile(s.f.Name())
+}
+
+// sweepUploadSpool removes spooled uploads older than the spool TTL, left
+// behind when the process died mid-upload. Younger ones may belong to
+// another instance sharing the directory.
+func (h *Handler) sweepUploadSpool() {
+	matches, _ := filepath.Glob(filepath.Join(spoolDir(), uploadSpoolPattern))
+	for _, name := range matches {
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > spoolTTL() {
+			log.Printf("Removing stale spooled upload %s", name)
+			h.removeLocalFile(name)
+		}
+	}
+}
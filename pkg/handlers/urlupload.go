@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// parseChecksum accepts "algo:hex" (sha256, sha512, sha1, md5) or a bare
+// hex digest, whose algorithm is inferred from its length.
+func parseChecksum(s string) (hash.Hash, string, error) {
+	s = strings.TrimSpace(s)
+	algo, digest, found := strings.Cut(s, ":")
+	if !found {
+		digest = s
+		switch len(s) {
+		case 32:
+			algo = "md5"
+		case 40:
+			algo = "sha1"
+		case 64:
+			algo = "sha256"
+		case 128:
+			algo = "sha512"
+		default:
+			return nil, "", fmt.Errorf("cannot infer checksum algorithm from a %d-character digest; use algo:hex", len(s))
+		}
+	}
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil {
+		return nil, "", fmt.Errorf("checksum is not valid hex")
+	}
+
+	var hasher hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	case "sha512":
+		hasher = sha512.New()
+	default:
+		return nil, "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+	if len(digest) != hasher.Size()*2 {
+		return nil, "", fmt.Errorf("%s checksum must be %d hex characters", algo, hasher.Size()*2)
+	}
+	return hasher, digest, nil
+}
+
+// urlFileName picks the destination name for a fetched URL: the last path
+// segment of the final (post-redirect) URL.
+func urlFileName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "" || name == "." || name == "/" {
+		return "download"
+	}
+	return name
+}
+
+// urlFetchAllowEnv lists the internal hosts /api/upload-url may still fetch
+// from: host names, IP addresses or CIDR ranges, comma-separated.
+const urlFetchAllowEnv = "KUBE_BROWSER_URL_UPLOAD_ALLOW"
+
+// urlFetchMaxRedirects bounds the redirects followed for one fetch.
+const urlFetchMaxRedirects = 10
+
+// urlFetchAllowList is the parsed KUBE_BROWSER_URL_UPLOAD_ALLOW.
+type urlFetchAllowList struct {
+	hosts map[string]bool
+	nets  []*net.IPNet
+}
+
+func loadURLFetchAllowList() (*urlFetchAllowList, error) {
+	allow := &urlFetchAllowList{hosts: map[string]bool{}}
+	for _, entry := range strings.Split(os.Getenv(urlFetchAllowEnv), ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			_, n, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid CIDR %q", urlFetchAllowEnv, entry)
+			}
+			allow.nets = append(allow.nets, n)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			allow.nets = append(allow.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		default:
+			allow.hosts[strings.TrimSuffix(entry, ".")] = true
+		}
+	}
+	return allow, nil
+}
+
+func (a *urlFetchAllowList) allowsIP(ip net.IP) bool {
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// internalIP reports addresses a URL fetch must not reach unless allowed:
+// loopback, private, link-local (such as the 169.254.169.254 metadata
+// endpoint), carrier-grade NAT, unspecified and multicast.
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || cgnatRange.Contains(ip)
+}
+
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// internalHost reports cluster-internal DNS names, which are refused before
+// they are even resolved.
+func internalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".svc") || strings.Contains(host, ".svc.") ||
+		strings.HasSuffix(host, ".cluster.local") || strings.HasSuffix(host, ".internal")
+}
+
+// checkFetchHost refuses a URL host that names a cluster-internal service,
+// unless it is in the allow-list.
+func (a *urlFetchAllowList) checkFetchHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if a.hosts[host] {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if internalIP(ip) && !a.allowsIP(ip) {
+			return fmt.Errorf("%s is an internal address; add it to %s to allow it", host, urlFetchAllowEnv)
+		}
+		return nil
+	}
+	if internalHost(host) {
+		return fmt.Errorf("%s is a cluster-internal host; add it to %s to allow it", host, urlFetchAllowEnv)
+	}
+	return nil
+}
+
+// urlFetchClient returns the client /api/upload-url fetches with. It does
+// not use a proxy, checks the host of the URL and of every redirect, and
+// refuses at dial time to connect to an internal address, whatever the
+// name resolved to, so a public name pointing at 127.0.0.1 or the cloud
+// metadata endpoint is caught too. Hosts in KUBE_BROWSER_URL_UPLOAD_ALLOW
+// are exempt. The whole fetch is bounded by
+// KUBE_BROWSER_URL_UPLOAD_TIMEOUT_MIN minutes, 60 by default.
+func urlFetchClient(allow *urlFetchAllowList) *http.Client {
+	guarded := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || (internalIP(ip) && !allow.allowsIP(ip)) {
+				return fmt.Errorf("refusing to connect to internal address %s; add it to %s to allow it", host, urlFetchAllowEnv)
+			}
+			return nil
+		},
+	}
+	open := &net.Dialer{Timeout: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			if allow.hosts[strings.TrimSuffix(strings.ToLower(host), ".")] {
+				return open.DialContext(ctx, network, address)
+			}
+			return guarded.DialContext(ctx, network, address)
+		},
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(envInt64("KUBE_BROWSER_URL_UPLOAD_TIMEOUT_MIN", 60)) * time.Minute,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= urlFetchMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", urlFetchMaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to a %s URL refused", req.URL.Scheme)
+			}
+			return allow.checkFetchHost(req.URL.Hostname())
+		},
+	}
+}
+
+// UploadFromURLHandler fetches an HTTP(S) URL on the server and streams the
+// body onto the PVC, so large datasets never pass through the user's
+// browser. The transfer is capped at MAX_UPLOAD_SIZE (or a smaller maxBytes)
+// and optionally verified against a checksum. It is written to a temporary
+// file next to the destination and only renamed into place once verified,
+// so a download that fails leaves an existing file as it was. onConflict is
+// as for /api/upload (see planUploads), and ?compress= sets how the file is
+// sent on to the pod.
+func (h *Handler) UploadFromURLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.checkReadOnly(w) {
+		return
+	}
+
+	client := h.clientFor(r)
+	if client == nil {
+		h.jsonError(w, "Not connected to Kubernetes cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Namespace  string `json:"namespace"`
+		PVC        string `json:"pvc"`
+		Path       string `json:"path"`
+		URL        string `json:"url"`
+		FileName   string `json:"fileName"`
+		MaxBytes   int64  `json:"maxBytes"`
+		Checksum   string `json:"checksum"`
+		Mode       string `json:"mode"`
+		Owner      string `json:"owner"`
+		OnConflict string `json:"onConflict"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMetaFieldSize)).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.PVC == "" || req.URL == "" {
+		h.jsonError(w, "namespace, pvc and url are required", http.StatusBadRequest)
+		return
+	}
+
+	src, err := url.Parse(req.URL)
+	if err != nil || (src.Scheme != "http" && src.Scheme != "https") || src.Host == "" {
+		h.jsonError(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	allow, err := loadURLFetchAllowList()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := allow.checkFetchHost(src.Hostname()); err != nil {
+		h.jsonError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	noteActivity(r, req.Namespace, req.PVC, sanitizePath(req.Path), "From "+src.Host)
+
+	perms := k8s.DefaultUploadPermissions()
+	if req.Mode != "" {
+		perms.Mode = req.Mode
+	}
+	if req.Owner != "" {
+		perms.Owner = req.Owner
+	}
+	if err := perms.Validate(); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy, err := parseUploadConflict(req.OnConflict)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var hasher hash.Hash
+	var wantDigest string
+	if req.Checksum != "" {
+		hasher, wantDigest, err = parseChecksum(req.Checksum)
+		if err != nil {
+			h.jsonError(w, "Invalid checksum: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	compression, err := transferCompressionFromQuery(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxSize := maxUploadSize()
+	if req.MaxBytes > 0 && req.MaxBytes < maxSize {
+		maxSize = req.MaxBytes
+	}
+
+	fetchReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, src.String(), nil)
+	if err != nil {
+		h.jsonError(w, "Invalid url: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := urlFetchClient(allow).Do(fetchReq)
+	if err != nil {
+		h.jsonError(w, "Failed to fetch url: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		h.jsonError(w, fmt.Sprintf("Failed to fetch url: remote returned %s", resp.Status), http.StatusBadGateway)
+		return
+	}
+	if resp.ContentLength > maxSize {
+		h.jsonError(w, fmt.Sprintf("remote file is %d bytes; maximum upload size is %d bytes", resp.ContentLength, maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	fileName := path.Base(strings.ReplaceAll(req.FileName, "\\", "/"))
+	if fileName == "" || fileName == "." || fileName == "/" {
+		fileName = urlFileName(resp.Request.URL)
+	}
+	destPath := sanitizePath(req.Path)
+	if destPath == "" || destPath == "/" {
+		destPath = "/" + fileName
+	} else {
+		destPath = destPath + "/" + fileName
+	}
+	if h.refuseTrashWrite(w, destPath) {
+		return
+	}
+
+	targets, err := planUploads(r.Context(), client, req.Namespace, req.PVC, []string{destPath}, policy)
+	if err != nil {
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	target := targets[0]
+	if target.err != nil {
+		h.jsonError(w, target.err.Error(), http.StatusConflict)
+		return
+	}
+	if target.skip {
+		h.jsonResponse(w, map[string]interface{}{
+			"success":  true,
+			"skipped":  true,
+			"message":  fmt.Sprintf("%s already exists; skipped", destPath),
+			"filename": fileName,
+			"path":     destPath,
+		})
+		return
+	}
+	if target.renamed {
+		destPath, fileName = target.path, path.Base(target.path)
+	}
+	partPath := path.Join(path.Dir(destPath), ".kube-browser-url-"+newID()+".part")
+
+	// The transfer runs at the remote server's pace, which can easily exceed
+	// the server's WriteTimeout for large artifacts.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	limited := &limitEnforcingReader{r: resp.Body, limit: maxSize}
+	var body io.Reader = limited
+	if hasher != nil {
+		body = io.TeeReader(limited, hasher)
+	}
+	if resp.ContentLength >= 0 {
+		// A known length frames the upload, so a connection the remote
+		// drops early fails the upload instead of leaving a short file.
+		framed := &k8s.UploadSource{Reader: body, Size: resp.ContentLength}
+		if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			framed.ModTime = lm
+		}
+		body = framed
+	}
+
+	log.Printf("Fetching %s onto %s/%s:%s", src.Redacted(), req.Namespace, req.PVC, destPath)
+	err = client.UploadFile(k8s.WithTransferCompression(r.Context(), compression), req.Namespace, req.PVC, partPath, body)
+	if limited.exceeded {
+		h.removeUploadLeftover(client, req.Namespace, req.PVC, partPath)
+		h.jsonError(w, fmt.Sprintf("file too large: maximum upload size is %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		h.removeUploadLeftover(client, req.Namespace, req.PVC, partPath)
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	result := map[string]interface{}{
+		"success":  true,
+		"message":  fmt.Sprintf("File %s uploaded successfully", fileName),
+		"filename": fileName,
+		"path":     destPath,
+		"size":     limited.read,
+	}
+	if hasher != nil {
+		got := hex.EncodeToString(hasher.Sum(nil))
+		if got != wantDigest {
+			h.removeUploadLeftover(client, req.Namespace, req.PVC, partPath)
+			h.jsonError(w, fmt.Sprintf("checksum mismatch: expected %s, got %s; nothing was written to %s", wantDigest, got, destPath), http.StatusUnprocessableEntity)
+			return
+		}
+		result["checksum"] = got
+	}
+	if err := h.placeFetchedFile(r.Context(), client, req.Namespace, req.PVC, partPath, destPath); err != nil {
+		h.removeUploadLeftover(client, req.Namespace, req.PVC, partPath)
+		h.jsonErrorFromErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	if target.renamed {
+		result["renamed"] = true
+	}
+	h.applyUploadPermissions(r.Context(), client, req.Namespace, req.PVC, destPath, perms, result)
+	h.jsonResponse(w, result)
+}
+
+// placeFetchedFile renames a verified download from partPath to destPath.
+// A file already at destPath is moved aside first and only removed once the
+// new one is in place; if the rename fails, it is moved back.
+func (h *Handler) placeFetchedFile(ctx context.Context, client KubeClient, namespace, pvc, partPath, destPath string) error {
+	info, err := client.ResolvePath(ctx, namespace, pvc, destPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return fmt.Errorf("%s is a directory", destPath)
+	}
+	if !info.Exists {
+		return client.Move(ctx, namespace, pvc, partPath, destPath)
+	}
+
+	oldPath := path.Join(path.Dir(destPath), ".kube-browser-url-"+newID()+".old")
+	if err := client.Move(ctx, namespace, pvc, destPath, oldPath); err != nil {
+		return err
+	}
+	if err := client.Move(ctx, namespace, pvc, partPath, destPath); err != nil {
+		if rerr := client.Move(ctx, namespace, pvc, oldPath, destPath); rerr != nil {
+			log.Printf("Could not put %s back from %s: %v", destPath, oldPath, rerr)
+		}
+		return err
+	}
+	h.removeUploadLeftover(client, namespace, pvc, oldPath)
+	return nil
+}
+
+// removeUploadLeftover queues the removal of a temporary file an upload
+// left next to its destination.
+func (h *Handler) removeUploadLeftover(client KubeClient, namespace, pvc, p string) {
+	h.getCleanup().Enqueue("pvc-file", fmt.Sprintf("%s/%s:%s", namespace, pvc, p), func(ctx context.Context) error {
+		return client.RemoveFile(ctx, namespace, pvc, p)
+	})
+}
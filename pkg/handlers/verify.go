@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"kube-browser/pkg/jobs"
+	"kube-browser/pkg/k8s"
+)
+
+// jobKindVerify reads uploaded files back from another node than the one
+// that wrote them, to catch a network filesystem that acknowledged a write
+// other clients cannot see.
+const jobKindVerify = "verify"
+
+// verifyAlgorithm is the checksum uploads are hashed with on the way in.
+const verifyAlgorithm = "sha256"
+
+// readBackVerifier is implemented by clients that can read a claim from a
+// second node.
+type readBackVerifier interface {
+	VerifyReadBack(ctx context.Context, namespace, pvcName, algo string, files []k8s.ReadBackFile, wait time.Duration) (*k8s.ReadBackReport, error)
+}
+
+type verifyParams struct {
+	Pane      string             `json:"pane,omitempty"`
+	Namespace string             `json:"namespace"`
+	PVC       string             `json:"pvc"`
+	Algorithm string             `json:"algorithm"`
+	Files     []k8s.ReadBackFile `json:"files"`
+}
+
+// readBackWait reads KUBE_BROWSER_VERIFY_WAIT_SEC, how long a file that
+// reads back wrong is retried before the check fails (default 30).
+func readBackWait() time.Duration {
+	return time.Duration(envInt64("KUBE_BROWSER_VERIFY_WAIT_SEC", 30)) * time.Second
+}
+
+// uploadHasher hashes an upload as it streams to the pod, for the
+// read-after-write check to compare against.
+type uploadHasher struct {
+	h hash.Hash
+}
+
+func newUploadHasher() *uploadHasher {
+	return &uploadHasher{h: sha256.New()}
+}
+
+func (u *uploadHasher) wrap(r io.Reader) io.Reader {
+	return io.TeeReader(r, u.h)
+}
+
+func (u *uploadHasher) sum() string {
+	return hex.EncodeToString(u.h.Sum(nil))
+}
+
+func (h *Handler) runVerifyJob(ctx context.Context, jh *jobs.Handle) error {
+	var p verifyParams
+	if err := jh.Params(&p); err != nil {
+		return err
+	}
+	client, ok := h.paneClient(p.Pane).(readBackVerifier)
+	if !ok {
+		return errors.New("not connected to a Kubernetes cluster that can read files back")
+	}
+	report, err := client.VerifyReadBack(ctx, p.Namespace, p.PVC, p.Algorithm, p.Files, readBackWait())
+	if err != nil {
+		return err
+	}
+	if err := jh.SetResult(report); err != nil {
+		return err
+	}
+	if bad := report.Mismatched(); len(bad) > 0 {
+		log.Printf("Read-after-write check of %s/%s: %d of %d file(s) differ on node %s", p.Namespace, p.PVC, len(bad), len(report.Files), report.Node)
+		return fmt.Errorf("%d of %d file(s) did not read back as written from node %s, first %s", len(bad), len(report.Files), report.Node, bad[0].Path)
+	}
+	return nil
+}
+
+// canVerifyUpload reports whether the upload's client can run a
+// read-after-write check, answering 400 when it cannot.
+func (h *Handler) canVerifyUpload(w http.ResponseWriter, client KubeClient, extract bool) bool {
+	if extract {
+		h.jsonError(w, "verify does not apply to extracted archives", http.StatusBadRequest)
+		return false
+	}
+	if _, ok := client.(readBackVerifier); !ok {
+		h.jsonError(w, "this cluster connection cannot read files back from another node", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// queueVerify starts the read-after-write check of freshly uploaded files
+// and records its id in resp under "verifyJob". Like the permissions
+// applied after an upload, a failure to queue it does not undo the upload
+// and is reported under "verifyError" instead.
+func (h *Handler) queueVerify(r *http.Request, namespace, pvc string, files []k8s.ReadBackFile, resp map[string]interface{}) {
+	if len(files) == 0 {
+		return
+	}
+	p := verifyParams{Pane: r.URL.Query().Get("pane"), Namespace: namespace, PVC: pvc, Algorithm: verifyAlgorithm, Files: files}
+	job, err := h.getJobs().Submit(jobKindVerify, fmt.Sprintf("Read back %d uploaded file(s) in %s/%s", len(files), namespace, pvc), p)
+	if err != nil {
+		resp["verifyError"] = err.Error()
+		return
+	}
+	noteActivityJob(r, job)
+	resp["verifyJob"] = job.ID
+}
@@ -0,0 +1,432 @@
+// Package jobs runs long operations (archive builds, copies, backups) in
+// the background and records them in the state directory, so a restart of
+// KubeBrowser reports interrupted work and can re-run it instead of losing
+// it silently.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"kube-browser/pkg/store"
+)
+
+type State string
+
+const (
+	// StateScheduled marks a job waiting for its start time. Unlike queued
+	// and running jobs, it survives a restart and still starts on time.
+	StateScheduled State = "scheduled"
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+	// StateInterrupted marks a job that was queued or running when the
+	// process exited. It can be resumed, which re-runs it from its params.
+	StateInterrupted State = "interrupted"
+)
+
+// Finished reports whether the job will not change state on its own.
+func (s State) Finished() bool {
+	switch s {
+	case StateSucceeded, StateFailed, StateCanceled, StateInterrupted:
+		return true
+	}
+	return false
+}
+
+// Job is the persisted record of one operation. Params holds everything
+// needed to run it again; Result is whatever the runner reported.
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Description string          `json:"description"`
+	Params      json.RawMessage `json:"params"`
+	State       State           `json:"state"`
+	Done        int64           `json:"done"`
+	Total       int64           `json:"total"`
+	Error       string          `json:"error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Created     time.Time       `json:"created"`
+	StartAt     time.Time       `json:"startAt,omitempty"`
+	Started     time.Time       `json:"started,omitempty"`
+	Finished    time.Time       `json:"finished,omitempty"`
+}
+
+// RunFunc performs a job. It must honour ctx cancellation.
+type RunFunc func(ctx context.Context, h *Handle) error
+
+// Handle is a running job's view of the manager.
+type Handle struct {
+	m  *Manager
+	id string
+}
+
+func (h *Handle) ID() string { return h.id }
+
+// Params decodes the job's params into v.
+func (h *Handle) Params(v interface{}) error {
+	job, ok := h.m.Get(h.id)
+	if !ok {
+		return fmt.Errorf("job %s no longer exists", h.id)
+	}
+	return json.Unmarshal(job.Params, v)
+}
+
+// SetProgress records progress in arbitrary units (usually bytes). It is
+// kept in memory only; persisting every update would thrash the state file.
+func (h *Handle) SetProgress(done, total int64) {
+	h.m.update(h.id, false, func(j *Job) {
+		j.Done, j.Total = done, total
+	})
+}
+
+// SetResult stores v as the job's result and persists it immediately, so
+// e.g. the location of a partially built file survives a crash.
+func (h *Handle) SetResult(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	h.m.update(h.id, true, func(j *Job) { j.Result = data })
+	return nil
+}
+
+type entry struct {
+	job    Job
+	cancel context.CancelFunc
+	// active is set while a runner goroutine owns the job, including the
+	// time between Cancel and the runner returning.
+	active bool
+}
+
+// Manager owns all jobs. At most KUBE_BROWSER_MAX_JOBS (default 2) run at
+// once; the rest wait in StateQueued.
+type Manager struct {
+	mu      sync.Mutex
+	file    string
+	jobs    map[string]*entry
+	runners map[string]RunFunc
+	slots   chan struct{}
+	// onFinish is told about each job a runner is done with.
+	onFinish func(Job)
+}
+
+var ErrNotFound = errors.New("job not found")
+
+func maxConcurrent() int {
+	if v := os.Getenv("KUBE_BROWSER_MAX_JOBS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 2
+}
+
+// NewManager loads the jobs recorded in the named state file. Jobs that
+// were queued or running when the previous process exited are marked
+// interrupted; scheduled jobs are started again as their kind is
+// registered.
+func NewManager(file string) *Manager {
+	m := &Manager{
+		file:    file,
+		jobs:    make(map[string]*entry),
+		runners: make(map[string]RunFunc),
+		slots:   make(chan struct{}, maxConcurrent()),
+	}
+
+	var saved []Job
+	if file != "" {
+		if err := store.Load(file, &saved); err != nil {
+			log.Printf("Warning: could not load jobs: %v", err)
+		}
+	}
+	interrupted := 0
+	for _, job := range saved {
+		if !job.State.Finished() && job.State != StateScheduled {
+			job.State = StateInterrupted
+			job.Error = "interrupted by a restart of kube-browser"
+			job.Finished = time.Now()
+			interrupted++
+		}
+		m.jobs[job.ID] = &entry{job: job}
+	}
+	if interrupted > 0 {
+		log.Printf("%d job(s) were interrupted by the last shutdown and can be resumed", interrupted)
+		m.mu.Lock()
+		m.persistLocked()
+		m.mu.Unlock()
+	}
+	return m
+}
+
+// Register associates a job kind with the function that runs it. Kinds
+// must be registered before jobs of that kind are submitted or resumed.
+// Scheduled jobs of that kind loaded from the state file are armed again:
+// one whose start time passed while KubeBrowser was down starts at once.
+func (m *Manager) Register(kind string, run RunFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runners[kind] = run
+	for id, e := range m.jobs {
+		if e.job.Kind == kind && e.job.State == StateScheduled && e.cancel == nil {
+			ctx, cancel := context.WithCancel(context.Background())
+			e.cancel = cancel
+			go m.run(ctx, id, run)
+		}
+	}
+}
+
+// OnFinish makes the manager call fn with each job that succeeds, fails or
+// is canceled. fn is called from the job's goroutine.
+func (m *Manager) OnFinish(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onFinish = fn
+}
+
+// Submit queues a new job and starts it as soon as a slot is free.
+func (m *Manager) Submit(kind, description string, params interface{}) (Job, error) {
+	return m.SubmitAt(kind, description, params, time.Time{})
+}
+
+// SubmitAt is Submit for a job that must not start before at. Until then
+// it is scheduled; a zero or past at queues it right away.
+func (m *Manager) SubmitAt(kind, description string, params interface{}, at time.Time) (Job, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return Job{}, err
+	}
+
+	m.mu.Lock()
+	run, ok := m.runners[kind]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("unknown job kind %q", kind)
+	}
+	job := Job{
+		ID:          newID(),
+		Kind:        kind,
+		Description: description,
+		Params:      data,
+		State:       StateQueued,
+		Created:     time.Now(),
+	}
+	if at.After(job.Created) {
+		job.State, job.StartAt = StateScheduled, at
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.jobs[job.ID] = &entry{job: job, cancel: cancel}
+	m.persistLocked()
+	m.mu.Unlock()
+
+	go m.run(ctx, job.ID, run)
+	return job, nil
+}
+
+// Resume re-runs an interrupted, failed or canceled job with its original
+// params, keeping its ID.
+func (m *Manager) Resume(id string) (Job, error) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, ErrNotFound
+	}
+	if e.active || !e.job.State.Finished() || e.job.State == StateSucceeded {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("job %s is %s and cannot be resumed", id, e.job.State)
+	}
+	run, ok := m.runners[e.job.Kind]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("unknown job kind %q", e.job.Kind)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.job.State = StateQueued
+	e.job.Error = ""
+	e.job.Done = 0
+	e.job.Started = time.Time{}
+	e.job.Finished = time.Time{}
+	job := e.job
+	m.persistLocked()
+	m.mu.Unlock()
+
+	go m.run(ctx, id, run)
+	return job, nil
+}
+
+func (m *Manager) run(ctx context.Context, id string, run RunFunc) {
+	m.setActive(id, true)
+	defer m.setActive(id, false)
+	defer m.finished(id)
+
+	if job, ok := m.Get(id); ok && job.State == StateScheduled {
+		timer := time.NewTimer(time.Until(job.StartAt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		m.update(id, true, func(j *Job) {
+			if j.State == StateScheduled {
+				j.State = StateQueued
+			}
+		})
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-m.slots }()
+	if ctx.Err() != nil {
+		// Canceled while the slot was being taken.
+		return
+	}
+
+	m.update(id, true, func(j *Job) {
+		j.State = StateRunning
+		j.Started = time.Now()
+	})
+
+	err := run(ctx, &Handle{m: m, id: id})
+
+	m.update(id, true, func(j *Job) {
+		j.Finished = time.Now()
+		switch {
+		case ctx.Err() != nil && j.State == StateCanceled:
+		case err != nil:
+			j.State = StateFailed
+			j.Error = err.Error()
+		default:
+			j.State = StateSucceeded
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Job %s failed: %v", id, err)
+	}
+}
+
+// Cancel stops a scheduled, queued or running job.
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.job.State.Finished() {
+		return nil
+	}
+	e.job.State = StateCanceled
+	e.job.Finished = time.Now()
+	if e.cancel != nil {
+		e.cancel()
+	}
+	m.persistLocked()
+	return nil
+}
+
+// Remove cancels a job if needed and forgets it.
+func (m *Manager) Remove(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+	delete(m.jobs, id)
+	m.persistLocked()
+	return e.job, nil
+}
+
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// List returns all jobs, newest first.
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Job, 0, len(m.jobs))
+	for _, e := range m.jobs {
+		out = append(out, e.job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
+
+func (m *Manager) update(id string, persist bool, fn func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	fn(&e.job)
+	if persist {
+		m.persistLocked()
+	}
+}
+
+func (m *Manager) finished(id string) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	fn := m.onFinish
+	m.mu.Unlock()
+	if ok && fn != nil && e.job.State.Finished() {
+		fn(e.job)
+	}
+}
+
+func (m *Manager) setActive(id string, active bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.jobs[id]; ok {
+		e.active = active
+	}
+}
+
+func (m *Manager) persistLocked() {
+	if m.file == "" {
+		return
+	}
+	out := make([]Job, 0, len(m.jobs))
+	for _, e := range m.jobs {
+		out = append(out, e.job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	if err := store.Save(m.file, out); err != nil {
+		log.Printf("Warning: could not persist jobs: %v", err)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
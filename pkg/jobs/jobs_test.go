@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, m *Manager, id string, want State) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := m.Get(id); ok && job.State == want {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := m.Get(id)
+	t.Fatalf("job %s did not reach %s (state %s)", id, want, job.State)
+	return job
+}
+
+func TestSubmitRunsJob(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	m := NewManager("jobs.json")
+	m.Register("echo", func(ctx context.Context, h *Handle) error {
+		var p struct{ Msg string }
+		if err := h.Params(&p); err != nil {
+			return err
+		}
+		h.SetProgress(1, 1)
+		return h.SetResult(map[string]string{"echo": p.Msg})
+	})
+
+	job, err := m.Submit("echo", "say hi", struct{ Msg string }{"hi"})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	done := waitFor(t, m, job.ID, StateSucceeded)
+	if string(done.Result) != `{"echo":"hi"}` || done.Done != 1 {
+		t.Errorf("unexpected job: %+v", done)
+	}
+
+	if _, err := m.Submit("unknown", "", nil); err == nil {
+		t.Error("expected error for unregistered kind")
+	}
+}
+
+func TestFailedJobRecordsError(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	m := NewManager("jobs.json")
+	m.Register("fail", func(ctx context.Context, h *Handle) error { return errors.New("boom") })
+
+	job, _ := m.Submit("fail", "", nil)
+	if got := waitFor(t, m, job.ID, StateFailed); got.Error != "boom" {
+		t.Errorf("expected error to be recorded, got %q", got.Error)
+	}
+}
+
+func TestOnFinishReportsFinishedJobs(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	m := NewManager("jobs.json")
+	finished := make(chan Job, 2)
+	m.OnFinish(func(j Job) { finished <- j })
+	m.Register("ok", func(ctx context.Context, h *Handle) error { return nil })
+	m.Register("fail", func(ctx context.Context, h *Handle) error { return errors.New("boom") })
+
+	m.Submit("ok", "", nil)
+	m.Submit("fail", "", nil)
+	states := map[string]State{}
+	for i := 0; i < 2; i++ {
+		select {
+		case j := <-finished:
+			states[j.Kind] = j.State
+		case <-time.After(2 * time.Second):
+			t.Fatal("OnFinish was not called")
+		}
+	}
+	if states["ok"] != StateSucceeded || states["fail"] != StateFailed {
+		t.Errorf("unexpected states: %v", states)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	m := NewManager("jobs.json")
+	started := make(chan struct{})
+	m.Register("block", func(ctx context.Context, h *Handle) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	job, _ := m.Submit("block", "", nil)
+	<-started
+	if err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	waitFor(t, m, job.ID, StateCanceled)
+}
+
+func TestRestartMarksUnfinishedJobsInterruptedAndResumes(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+
+	m := NewManager("jobs.json")
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	m.OnFinish(func(Job) { close(stopped) })
+	m.Register("copy", func(ctx context.Context, h *Handle) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	job, _ := m.Submit("copy", "big copy", map[string]string{"src": "a"})
+	<-started
+
+	// A second manager reading the same state file simulates a restart
+	// while the job is still running.
+	restarted := NewManager("jobs.json")
+	got, ok := restarted.Get(job.ID)
+	if !ok || got.State != StateInterrupted || got.Description != "big copy" {
+		t.Fatalf("expected interrupted job after restart, got %+v", got)
+	}
+
+	var resumedSrc string
+	restarted.Register("copy", func(ctx context.Context, h *Handle) error {
+		var p map[string]string
+		h.Params(&p)
+		resumedSrc = p["src"]
+		return nil
+	})
+	if _, err := restarted.Resume(job.ID); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	waitFor(t, restarted, job.ID, StateSucceeded)
+	if resumedSrc != "a" {
+		t.Errorf("expected resumed job to get original params, got %q", resumedSrc)
+	}
+	if _, err := restarted.Resume(job.ID); err == nil {
+		t.Error("expected succeeded job not to be resumable")
+	}
+
+	// The first manager still writes jobs.json when its runner returns, so
+	// wait for that before the state directory is removed.
+	m.Cancel(job.ID)
+	waitFor(t, m, job.ID, StateCanceled)
+	<-stopped
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	t.Setenv("KUBE_BROWSER_MAX_JOBS", "1")
+	m := NewManager("")
+	release := make(chan struct{})
+	m.Register("wait", func(ctx context.Context, h *Handle) error {
+		<-release
+		return nil
+	})
+
+	first, _ := m.Submit("wait", "", nil)
+	second, _ := m.Submit("wait", "", nil)
+	time.Sleep(50 * time.Millisecond)
+	states := map[State]int{}
+	for _, job := range m.List() {
+		states[job.State]++
+	}
+	if states[StateRunning] != 1 || states[StateQueued] != 1 {
+		t.Errorf("expected one running and one queued job, got %v", states)
+	}
+	close(release)
+	waitFor(t, m, first.ID, StateSucceeded)
+	waitFor(t, m, second.ID, StateSucceeded)
+}
+
+func TestScheduledJobWaitsAndSurvivesRestart(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	m := NewManager("jobs.json")
+	m.Register("ok", func(ctx context.Context, h *Handle) error { return nil })
+
+	soon, err := m.SubmitAt("ok", "", nil, time.Now().Add(100*time.Millisecond))
+	if err != nil || soon.State != StateScheduled {
+		t.Fatalf("expected a scheduled job, got %+v, %v", soon, err)
+	}
+	later, _ := m.SubmitAt("ok", "", nil, time.Now().Add(time.Hour))
+	canceled, _ := m.SubmitAt("ok", "", nil, time.Now().Add(time.Hour))
+	if err := m.Cancel(canceled.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, m, soon.ID, StateSucceeded)
+	if job, _ := m.Get(later.ID); job.State != StateScheduled {
+		t.Errorf("expected the later job to wait, got %s", job.State)
+	}
+
+	// A restart keeps the job scheduled and arms it again once its kind
+	// is registered.
+	m2 := NewManager("jobs.json")
+	if job, _ := m2.Get(later.ID); job.State != StateScheduled || !job.StartAt.Equal(later.StartAt) {
+		t.Fatalf("expected the job to stay scheduled across a restart, got %+v", job)
+	}
+	m2.Register("ok", func(ctx context.Context, h *Handle) error { return nil })
+	if err := m2.Cancel(later.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, m2, later.ID, StateCanceled)
+	if job, _ := m2.Get(canceled.ID); job.State != StateCanceled {
+		t.Errorf("expected the canceled job to stay canceled, got %s", job.State)
+	}
+}
@@ -0,0 +1,271 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	gopath "path"
+	"strconv"
+	"strings"
+)
+
+// StreamArchive writes a gzip-compressed tar of paths (PVC-relative, as
+// returned in FileInfo.Path) to w, leaving out entries matching exclude
+// (see CleanExcludes). The archive is produced by tar inside the pod, so
+// nothing is buffered on the KubeBrowser side. A claim no running pod
+// mounts, such as one whose workload was scaled down for a migration, is
+// read through a helper pod.
+func (c *Client) StreamArchive(ctx context.Context, namespace, pvcName string, paths, exclude []string, w io.Writer) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths to archive")
+	}
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		rel[i] = relativePVCPath(p)
+	}
+	return c.streamOnClaim(ctx, PVCRef{Namespace: namespace, PVC: pvcName}, func(mountPath string) []string {
+		cmd := concatArgs([]string{"tar", "czf", "-"}, excludeArgs(exclude)...)
+		return concatArgs(append(cmd, "-C", mountPath, "--"), rel...)
+	}, nil, w)
+}
+
+// DiskUsage returns the total on-disk size in bytes of paths, as reported
+// by du. It is an estimate used to decide whether an operation fits.
+func (c *Client) DiskUsage(ctx context.Context, namespace, pvcName string, paths []string) (int64, error) {
+	if len(paths) == 0 {
+		return 0, nil
+	}
+	stdout, _, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		cmd := []string{"du", "-sk", "--"}
+		for _, p := range paths {
+			cmd = append(cmd, pvcPath(mountPath, p))
+		}
+		return cmd
+	})
+	if err != nil {
+		return 0, err
+	}
+	return parseDuOutput(stdout)
+}
+
+// DirUsage is the on-disk size of one directory below the paths measured
+// by StreamDiskUsage, as du reports it.
+type DirUsage struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// duLineDecoder parses du -k lines as the exec output arrives and hands
+// each directory, relative to the claim, to emit.
+type duLineDecoder struct {
+	mountPath string
+	emit      func(DirUsage) error
+
+	buf   []byte
+	lines int
+	err   error
+}
+
+func (d *duLineDecoder) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.buf = append(d.buf, p...)
+	for {
+		end := bytes.IndexByte(d.buf, '\n')
+		if end < 0 {
+			break
+		}
+		line := string(d.buf[:end])
+		d.buf = d.buf[end+1:]
+		kb, dir, ok := strings.Cut(line, "\t")
+		n, err := strconv.ParseInt(kb, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		d.lines++
+		rel := "/" + strings.TrimPrefix(strings.TrimPrefix(dir, strings.TrimSuffix(d.mountPath, "/")), "/")
+		if err := d.emit(DirUsage{Path: gopath.Clean(rel), Bytes: n * 1024}); err != nil {
+			d.err = err
+			return 0, err
+		}
+	}
+	d.buf = append([]byte(nil), d.buf...)
+	return len(p), nil
+}
+
+// StreamDiskUsage runs du on paths and hands each directory below them to
+// fn as du finishes it, deepest first, so the size of a huge tree builds
+// up while it is measured instead of after. maxDepth limits the
+// directories reported to that many levels below each path (0 reports
+// all of them); the totals always count everything. It returns the total
+// of paths. An error from fn stops du and is returned.
+//
+// On Windows nodes only the totals of paths are reported, once measured.
+func (c *Client) StreamDiskUsage(ctx context.Context, namespace, pvcName string, paths []string, maxDepth int, fn func(DirUsage) error) (int64, error) {
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return 0, err
+	}
+	roots := map[string]bool{}
+	var clean []string
+	for _, p := range paths {
+		p = gopath.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+		if !roots[p] {
+			roots[p] = true
+			clean = append(clean, p)
+		}
+	}
+	var total int64
+	emit := func(u DirUsage) error {
+		if roots[u.Path] {
+			total += u.Bytes
+		}
+		return fn(u)
+	}
+	if info.windows {
+		for _, p := range clean {
+			n, err := c.DiskUsage(ctx, namespace, pvcName, []string{p})
+			if err != nil {
+				return 0, err
+			}
+			if err := emit(DirUsage{Path: p, Bytes: n}); err != nil {
+				return 0, err
+			}
+		}
+		return total, nil
+	}
+
+	dec := &duLineDecoder{emit: emit}
+	err = c.streamOnPod(ctx, namespace, pvcName, info, func(mountPath string) []string {
+		dec.mountPath = mountPath
+		cmd := []string{"du", "-k"}
+		if maxDepth > 0 {
+			cmd = append(cmd, "-d", strconv.Itoa(maxDepth))
+		}
+		cmd = append(cmd, "--")
+		for _, p := range clean {
+			cmd = append(cmd, pvcPath(mountPath, p))
+		}
+		return cmd
+	}, nil, dec)
+	switch {
+	case dec.err != nil:
+		return 0, dec.err
+	case err != nil && (ctx.Err() != nil || dec.lines == 0):
+		return 0, err
+	case err != nil:
+		// du exits non-zero when it cannot read some subdirectory; the
+		// sizes it did print leave that one out.
+		log.Printf("  du on %s/%s finished with errors: %v", namespace, pvcName, err)
+	}
+	return total, nil
+}
+
+// PathUsage is the size and number of regular files below a set of paths.
+type PathUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+// measureScript prints du -sk for every argument and then a "files <n>"
+// line. Files are counted by their NUL terminators so names containing
+// newlines count once.
+const measureScript = `set -e
+du -sk -- "$@"
+n=$(find "$@" -type f -print0 | tr -cd '\000' | wc -c)
+echo "files $n"`
+
+// MeasurePaths returns the disk usage and file count of paths in a single
+// exec, for estimating how long a transfer of them would take.
+func (c *Client) MeasurePaths(ctx context.Context, namespace, pvcName string, paths []string) (*PathUsage, error) {
+	if len(paths) == 0 {
+		return &PathUsage{}, nil
+	}
+	stdout, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		cmd := []string{"sh", "-c", measureScript, "sh"}
+		for _, p := range paths {
+			cmd = append(cmd, pvcPath(mountPath, p))
+		}
+		return cmd
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, streamError(ke, stderr)
+		}
+		return nil, err
+	}
+	return parseMeasureOutput(stdout)
+}
+
+func parseMeasureOutput(stdout string) (*PathUsage, error) {
+	bytes, err := parseDuOutput(stdout)
+	if err != nil {
+		return nil, err
+	}
+	usage := &PathUsage{Bytes: bytes}
+	for _, line := range strings.Split(stdout, "\n") {
+		if n, ok := strings.CutPrefix(strings.TrimSpace(line), "files "); ok {
+			if usage.Files, err = strconv.Atoi(strings.TrimSpace(n)); err != nil {
+				return nil, fmt.Errorf("unexpected file count %q", n)
+			}
+			return usage, nil
+		}
+	}
+	return nil, fmt.Errorf("no file count in output")
+}
+
+func parseDuOutput(stdout string) (int64, error) {
+	var total int64
+	found := false
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		total += kb * 1024
+		found = true
+	}
+	if !found {
+		return 0, fmt.Errorf("unexpected du output: %q", strings.TrimSpace(stdout))
+	}
+	return total, nil
+}
+
+// ReadArchive calls fn for every directory and regular file in the tar
+// stream r, as UnpackArchive receives it. name is the entry's path without
+// a trailing slash; names that are absolute or contain ".." fail the read,
+// and other entry types, such as symlinks, are skipped. Backends that are
+// not pods unpack archives with it.
+func ReadArchive(r io.Reader, fn func(name string, hdr *tar.Header, body io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeDir && hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if name == "" || name == "." {
+			continue
+		}
+		if err := validateArchiveMember(name); err != nil {
+			return err
+		}
+		if err := fn(name, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
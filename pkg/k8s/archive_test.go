@@ -0,0 +1,178 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStreamArchiveCommand(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("TARDATA", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var buf bytes.Buffer
+	if err := c.StreamArchive(context.Background(), "default", "my-pvc", []string{"/logs", "/", "/a b/c.txt"}, nil, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "TARDATA" {
+		t.Errorf("expected archive bytes to be streamed, got %q", buf.String())
+	}
+	want := []string{"tar", "czf", "-", "-C", "/data", "--", "logs", ".", "a b/c.txt"}
+	if got := mock.streamCalls[0].cmd; !reflect.DeepEqual(got, want) {
+		t.Errorf("command = %v, want %v", got, want)
+	}
+}
+
+func TestStreamArchiveExcludes(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("TARDATA", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	if err := c.StreamArchive(context.Background(), "default", "my-pvc", []string{"/app"}, []string{"node_modules", "*.tmp"}, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"tar", "czf", "-", "--exclude=node_modules", "--exclude=*.tmp", "-C", "/data", "--", "app"}
+	if got := mock.streamCalls[0].cmd; !reflect.DeepEqual(got, want) {
+		t.Errorf("command = %v, want %v", got, want)
+	}
+}
+
+func TestStreamArchiveOfUnmountedClaimUsesHelper(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+	mock.pushStream("FROMHELPER", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(), executor: mock}
+
+	var buf bytes.Buffer
+	if err := c.StreamArchive(context.Background(), "default", "scaled-down", []string{"/"}, nil, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "FROMHELPER" {
+		t.Errorf("expected helper output, got %q", buf.String())
+	}
+	if call := mock.streamCalls[0]; call.podName != "kube-browser-helper-abc" || call.cmd[4] != helperMountPath {
+		t.Errorf("unexpected helper call: %+v", call)
+	}
+}
+
+func TestStreamArchiveFallsBackToHelperWhenTarMissing(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+	mock.pushStream("", "sh: tar: not found", fmt.Errorf("command terminated with exit code 127"))
+	mock.pushStream("FROMHELPER", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var buf bytes.Buffer
+	if err := c.StreamArchive(context.Background(), "default", "my-pvc", []string{"/x"}, nil, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "FROMHELPER" {
+		t.Errorf("expected helper output, got %q", buf.String())
+	}
+	if call := mock.streamCalls[1]; call.podName != "kube-browser-helper-abc" || call.cmd[4] != "/data" {
+		t.Errorf("unexpected helper call: %+v", call)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if mock.deleteCalled != 1 {
+		t.Errorf("expected helper pod to be deleted, got %d deletions", mock.deleteCalled)
+	}
+}
+
+func TestStreamArchiveNoFallbackAfterPartialOutput(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+	mock.pushStream("partial", "sh: tar: not found", fmt.Errorf("command terminated with exit code 127"))
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var buf bytes.Buffer
+	if err := c.StreamArchive(context.Background(), "default", "my-pvc", []string{"/x"}, nil, &buf); err == nil {
+		t.Fatal("expected error after partial output")
+	}
+	if mock.createCalled != 0 {
+		t.Error("must not restart a stream in a helper pod once bytes were written")
+	}
+}
+
+func TestParseDuOutput(t *testing.T) {
+	got, err := parseDuOutput("4\t/data/a\n1024\t/data/b c\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 1028*1024 {
+		t.Errorf("expected %d, got %d", 1028*1024, got)
+	}
+	if _, err := parseDuOutput("du: invalid option"); err == nil {
+		t.Error("expected error for unparseable output")
+	}
+}
+
+func TestMeasurePaths(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("4\t/data/logs\n1024\t/data/db\nfiles 12\n", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	usage, err := c.MeasurePaths(context.Background(), "default", "my-pvc", []string{"/logs", "/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *usage != (PathUsage{Bytes: 1028 * 1024, Files: 12}) {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	want := []string{"sh", "-c", measureScript, "sh", "/data/logs", "/data/db"}
+	if !reflect.DeepEqual(mock.execCalls[0].cmd, want) {
+		t.Errorf("unexpected command %q", mock.execCalls[0].cmd)
+	}
+	if _, err := parseMeasureOutput("4\t/data/logs\n"); err == nil {
+		t.Error("expected output without a file count to fail")
+	}
+}
+
+func TestReadArchiveRejectsEscapingNames(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./docs/", Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "docs/link", Linkname: "/etc/passwd"})
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "docs/../../evil", Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+
+	var names []string
+	err := ReadArchive(&buf, func(name string, hdr *tar.Header, body io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	if err == nil || strings.Join(names, ",") != "docs" {
+		t.Errorf("expected the symlink skipped and the escaping name refused, got %v, %v", names, err)
+	}
+}
+
+func TestStreamDiskUsage(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("4\t/data/logs/a\n8\t/data/logs/b\n16\t/data/logs\n", "du: cannot read directory '/data/logs/c': Permission denied", fmt.Errorf("command terminated with exit code 1"))
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var got []DirUsage
+	total, err := c.StreamDiskUsage(context.Background(), "default", "my-pvc", []string{"/logs"}, 1, func(u DirUsage) error {
+		got = append(got, u)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected unreadable directories to be left out, got %v", err)
+	}
+	want := []DirUsage{{"/logs/a", 4096}, {"/logs/b", 8192}, {"/logs", 16384}}
+	if !reflect.DeepEqual(got, want) || total != 16384 {
+		t.Errorf("expected %v totalling 16384, got %v totalling %d", want, got, total)
+	}
+	if cmd := strings.Join(mock.streamCalls[0].cmd, " "); cmd != "du -k -d 1 -- /data/logs" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+}
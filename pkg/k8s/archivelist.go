@@ -0,0 +1,277 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	gopath "path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultArchiveEntryLimit = 1000
+
+// ArchiveEntry is one member of a tar or zip archive. Name is the path
+// stored in the archive.
+type ArchiveEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"modTime"`
+	IsDir   bool   `json:"isDir"`
+}
+
+// ArchiveListing is the table of contents of an archive on a PVC.
+// Truncated is set when the archive holds more than the requested limit.
+type ArchiveListing struct {
+	Path      string         `json:"path"`
+	Format    string         `json:"format"`
+	Entries   []ArchiveEntry `json:"entries"`
+	Truncated bool           `json:"truncated"`
+}
+
+// archiveFormat picks the archive format from the file name. Compression
+// is passed to tar explicitly because BusyBox tar does not detect it.
+func archiveFormat(name string) (format string, tarFlag string, ok bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", "", true
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", "z", true
+	case strings.HasSuffix(lower, ".tar.bz2"), strings.HasSuffix(lower, ".tbz2"), strings.HasSuffix(lower, ".tbz"):
+		return "tar.bz2", "j", true
+	case strings.HasSuffix(lower, ".tar.xz"), strings.HasSuffix(lower, ".txz"):
+		return "tar.xz", "J", true
+	case strings.HasSuffix(lower, ".zip"), strings.HasSuffix(lower, ".jar"), strings.HasSuffix(lower, ".war"):
+		return "zip", "", true
+	}
+	return "", "", false
+}
+
+// IsListableArchive reports whether ListArchive supports the file name.
+func IsListableArchive(name string) bool {
+	_, _, ok := archiveFormat(name)
+	return ok
+}
+
+// ListArchive lists the members of a tar or zip archive on the PVC with
+// tar tv / unzip -l, without extracting anything.
+func (c *Client) ListArchive(ctx context.Context, namespace, pvcName, filePath string, limit int) (*ArchiveListing, error) {
+	filePath = gopath.Clean("/" + strings.ReplaceAll(filePath, "\\", "/"))
+	format, tarFlag, ok := archiveFormat(filePath)
+	if !ok {
+		return nil, fmt.Errorf("unsupported archive type: %s (expected .tar, .tar.gz, .tgz, .tar.bz2, .tar.xz or .zip)", gopath.Base(filePath))
+	}
+	if limit <= 0 {
+		limit = defaultArchiveEntryLimit
+	}
+
+	stdout, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		full := pvcPath(mountPath, filePath)
+		if format == "zip" {
+			return []string{"unzip", "-l", full}
+		}
+		return []string{"env", "TZ=UTC", "tar", "-tv" + tarFlag + "f", full}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, streamError(ke, stderr)
+		}
+		return nil, err
+	}
+
+	var entries []ArchiveEntry
+	if format == "zip" {
+		entries = parseUnzipList(stdout)
+	} else {
+		entries = parseTarList(stdout)
+	}
+	listing := &ArchiveListing{Path: filePath, Format: format, Entries: entries}
+	if len(entries) > limit {
+		listing.Entries = entries[:limit]
+		listing.Truncated = true
+	}
+	if listing.Entries == nil {
+		listing.Entries = []ArchiveEntry{}
+	}
+	return listing, nil
+}
+
+// parseTarList parses tar -tv output. GNU tar prints
+// "-rw-r--r-- user/group 123 2024-01-15 10:30 name" and BusyBox adds
+// seconds to the time; links carry a " -> target" or " link to target"
+// suffix.
+func parseTarList(stdout string) []ArchiveEntry {
+	var entries []ArchiveEntry
+	for _, line := range strings.Split(stdout, "\n") {
+		fields, rest := splitLsFields(line, 5)
+		// tar marks hard links with an "h" type, which ls never prints.
+		if len(fields) < 5 || rest == "" || !(looksLikeLsMode(fields[0]) || (len(fields[0]) >= 10 && fields[0][0] == 'h')) {
+			continue
+		}
+		name := rest
+		switch fields[0][0] {
+		case 'l':
+			if i := strings.Index(name, " -> "); i >= 0 {
+				name = name[:i]
+			}
+		case 'h':
+			if i := strings.Index(name, " link to "); i >= 0 {
+				name = name[:i]
+			}
+		}
+		// Device entries print "major,minor" instead of a size.
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		entries = append(entries, ArchiveEntry{
+			Name:    name,
+			Size:    size,
+			ModTime: formatModTime(parseArchiveTime(fields[3] + " " + fields[4])),
+			IsDir:   fields[0][0] == 'd' || strings.HasSuffix(name, "/"),
+		})
+	}
+	return entries
+}
+
+// parseUnzipList parses the table printed by unzip -l between its two
+// dashed rules: "length date time name". Info-ZIP prints dates as
+// MM-DD-YYYY or YYYY-MM-DD depending on the build.
+func parseUnzipList(stdout string) []ArchiveEntry {
+	var entries []ArchiveEntry
+	inTable := false
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "---") {
+			if inTable {
+				break
+			}
+			inTable = true
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		fields, rest := splitLsFields(line, 3)
+		if len(fields) < 3 || rest == "" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, ArchiveEntry{
+			Name:    rest,
+			Size:    size,
+			ModTime: formatModTime(parseArchiveTime(fields[1] + " " + fields[2])),
+			IsDir:   strings.HasSuffix(rest, "/"),
+		})
+	}
+	return entries
+}
+
+// parseArchiveTime parses the date and time columns of tar and unzip
+// listings. Archive times carry no zone; tar is run with TZ=UTC and zip
+// times are taken as UTC.
+func parseArchiveTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "01-02-2006 15:04", "01-02-06 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// validateArchiveMember rejects member names that would escape the
+// extraction directory. tar and unzip strip such names themselves, but not
+// every BusyBox build does.
+func validateArchiveMember(member string) error {
+	if member == "" {
+		return fmt.Errorf("empty archive member name")
+	}
+	if strings.HasPrefix(member, "/") {
+		return fmt.Errorf("invalid archive member %q: absolute paths are not allowed", member)
+	}
+	for _, part := range strings.Split(member, "/") {
+		if part == ".." {
+			return fmt.Errorf("invalid archive member %q: \"..\" is not allowed", member)
+		}
+	}
+	return nil
+}
+
+// unzipPattern escapes the wildcard characters unzip interprets in member
+// arguments so a name is matched literally.
+func unzipPattern(member string) string {
+	return strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(member)
+}
+
+// StreamArchiveMember writes the contents of a single member of a tar or
+// zip archive on the PVC to w, without extracting anything to disk.
+func (c *Client) StreamArchiveMember(ctx context.Context, namespace, pvcName, archivePath, member string, w io.Writer) error {
+	archivePath = gopath.Clean("/" + strings.ReplaceAll(archivePath, "\\", "/"))
+	format, tarFlag, ok := archiveFormat(archivePath)
+	if !ok {
+		return fmt.Errorf("unsupported archive type: %s", gopath.Base(archivePath))
+	}
+	if err := validateArchiveMember(member); err != nil {
+		return err
+	}
+	return c.streamOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		full := pvcPath(mountPath, archivePath)
+		if format == "zip" {
+			return []string{"unzip", "-p", full, unzipPattern(member)}
+		}
+		return []string{"tar", "-xO" + tarFlag + "f", full, "--", member}
+	}, nil, w)
+}
+
+// extractScript creates the destination directory ($1) and runs the
+// extraction command that follows it.
+const extractScript = `d="$1"; shift; mkdir -p -- "$d" && exec "$@"`
+
+// ExtractArchiveMembers extracts the named members of an archive on the PVC
+// into destDir on the same PVC, keeping their paths inside the archive.
+// Existing files are kept unless overwrite is set.
+func (c *Client) ExtractArchiveMembers(ctx context.Context, namespace, pvcName, archivePath string, members []string, destDir string, overwrite bool) error {
+	archivePath = gopath.Clean("/" + strings.ReplaceAll(archivePath, "\\", "/"))
+	format, tarFlag, ok := archiveFormat(archivePath)
+	if !ok {
+		return fmt.Errorf("unsupported archive type: %s", gopath.Base(archivePath))
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("no archive members to extract")
+	}
+	for _, m := range members {
+		if err := validateArchiveMember(m); err != nil {
+			return err
+		}
+	}
+
+	_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		full := pvcPath(mountPath, archivePath)
+		dest := pvcPath(mountPath, destDir)
+		cmd := []string{"sh", "-c", extractScript, "sh", dest}
+		if format == "zip" {
+			mode := "-n"
+			if overwrite {
+				mode = "-o"
+			}
+			cmd = append(cmd, "unzip", mode, full)
+			for _, m := range members {
+				cmd = append(cmd, unzipPattern(m))
+			}
+			return append(cmd, "-d", dest)
+		}
+		args := []string{"tar", "-x" + tarFlag + "f", full, "-C", dest}
+		if !overwrite {
+			args = append(args, "-k")
+		}
+		return concatArgs(append(cmd, append(args, "--")...), members...)
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return streamError(ke, stderr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTarList(t *testing.T) {
+	gnu := "drwxr-xr-x root/root         0 2024-01-15 10:30 app/\n" +
+		"-rw-r--r-- root/root       123 2024-01-15 10:30 app/my file.txt\n" +
+		"lrwxrwxrwx root/root         0 2024-01-15 10:30 app/latest -> my file.txt\n" +
+		"hrw-r--r-- root/root         0 2024-01-15 10:30 app/copy link to app/my file.txt\n" +
+		"crw-r--r-- root/root       1,3 2024-01-15 10:30 dev/null\n"
+	want := []ArchiveEntry{
+		{Name: "app/", ModTime: "2024-01-15T10:30:00Z", IsDir: true},
+		{Name: "app/my file.txt", Size: 123, ModTime: "2024-01-15T10:30:00Z"},
+		{Name: "app/latest", ModTime: "2024-01-15T10:30:00Z"},
+		{Name: "app/copy", ModTime: "2024-01-15T10:30:00Z"},
+		{Name: "dev/null", ModTime: "2024-01-15T10:30:00Z"},
+	}
+	if got := parseTarList(gnu); !reflect.DeepEqual(got, want) {
+		t.Errorf("GNU tar: got %+v, want %+v", got, want)
+	}
+
+	busybox := "-rw-r--r-- 0/0            5 2024-01-15 10:30:07 a.txt\n"
+	got := parseTarList(busybox)
+	if len(got) != 1 || got[0].Name != "a.txt" || got[0].Size != 5 || got[0].ModTime != "2024-01-15T10:30:07Z" {
+		t.Errorf("BusyBox tar: got %+v", got)
+	}
+}
+
+func TestParseUnzipList(t *testing.T) {
+	out := `Archive:  /data/backup.zip
+  Length      Date    Time    Name
+---------  ---------- -----   ----
+        0  2024-01-15 10:30   dir/
+      123  01-15-2024 10:30   dir/file name.txt
+---------                     -------
+      123                     2 files
+`
+	want := []ArchiveEntry{
+		{Name: "dir/", ModTime: "2024-01-15T10:30:00Z", IsDir: true},
+		{Name: "dir/file name.txt", Size: 123, ModTime: "2024-01-15T10:30:00Z"},
+	}
+	if got := parseUnzipList(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestListArchive(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("-rw-r--r-- root/root 1 2024-01-15 10:30 a\n-rw-r--r-- root/root 2 2024-01-15 10:30 b\n", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	listing, err := c.ListArchive(context.Background(), "default", "my-pvc", "/backups/db.TGZ", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listing.Format != "tar.gz" || !listing.Truncated || len(listing.Entries) != 1 || listing.Entries[0].Name != "a" {
+		t.Errorf("unexpected listing: %+v", listing)
+	}
+	if cmd := strings.Join(mock.execCalls[0].cmd, " "); cmd != "env TZ=UTC tar -tvzf /data/backups/db.TGZ" {
+		t.Errorf("unexpected command: %s", cmd)
+	}
+
+	if _, err := c.ListArchive(context.Background(), "default", "my-pvc", "/disk.img", 0); err == nil {
+		t.Error("expected unsupported archive type to be rejected")
+	}
+}
+
+func TestStreamArchiveMember(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("hello", "", nil)
+	mock.pushStream("world", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var buf strings.Builder
+	if err := c.StreamArchiveMember(context.Background(), "default", "my-pvc", "/b.tar.xz", "etc/app.conf", &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "hello" {
+		t.Errorf("got %q", buf.String())
+	}
+	if cmd := strings.Join(mock.streamCalls[0].cmd, " "); cmd != "tar -xOJf /data/b.tar.xz -- etc/app.conf" {
+		t.Errorf("unexpected tar command: %s", cmd)
+	}
+
+	buf.Reset()
+	if err := c.StreamArchiveMember(context.Background(), "default", "my-pvc", "/b.zip", "logs/[2024]*.log", &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cmd := strings.Join(mock.streamCalls[1].cmd, " "); cmd != "unzip -p /data/b.zip logs/[[]2024][*].log" {
+		t.Errorf("unexpected unzip command: %s", cmd)
+	}
+
+	if err := c.StreamArchiveMember(context.Background(), "default", "my-pvc", "/b.zip", "../etc/passwd", &buf); err == nil {
+		t.Error("expected member escaping the archive to be rejected")
+	}
+}
+
+func TestExtractArchiveMembers(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", nil)
+	mock.pushExec("", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	if err := c.ExtractArchiveMembers(context.Background(), "default", "my-pvc", "/dumps/db.tgz", []string{"a.sql", "dir/"}, "/restore", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cmd := mock.execCalls[0].cmd
+	if got := strings.Join(cmd[4:], " "); got != "/data/restore tar -xzf /data/dumps/db.tgz -C /data/restore -k -- a.sql dir/" {
+		t.Errorf("unexpected tar command: %s", got)
+	}
+
+	if err := c.ExtractArchiveMembers(context.Background(), "default", "my-pvc", "/a.zip", []string{"x.txt"}, "/", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(mock.execCalls[1].cmd[4:], " "); got != "/data unzip -o /data/a.zip x.txt -d /data" {
+		t.Errorf("unexpected unzip command: %s", got)
+	}
+
+	for _, members := range [][]string{nil, {"/etc/passwd"}, {"a/../../b"}} {
+		if err := c.ExtractArchiveMembers(context.Background(), "default", "my-pvc", "/a.zip", members, "/", false); err == nil {
+			t.Errorf("members %q: expected error", members)
+		}
+	}
+}
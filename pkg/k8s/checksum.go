@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ChecksumAlgorithms are the algorithms FileChecksum supports, each
+// computed by the coreutils or BusyBox tool of the same name plus "sum".
+var ChecksumAlgorithms = []string{"sha256", "sha1", "sha512", "md5"}
+
+// FileChecksum is the digest of one file on a PVC, as the hex string
+// sha256sum and friends print.
+type FileChecksum struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+}
+
+// NewHash returns a hash for one of ChecksumAlgorithms, for backends that
+// read the file themselves.
+func NewHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q: expected one of %s", algo, strings.Join(ChecksumAlgorithms, ", "))
+}
+
+// checksumFileScript hashes $1 with the $2sum tool, or BusyBox's applet,
+// or openssl dgst, whichever the container has. With none, it fails like
+// a missing tool, so the command is retried in a helper pod.
+const checksumFileScript = `if [ -d "$1" ]; then echo "$1: Is a directory" >&2; exit 1; fi
+if command -v "$2sum" >/dev/null 2>&1; then exec "$2sum" "$1"; fi
+if command -v busybox >/dev/null 2>&1 && busybox "$2sum" /dev/null >/dev/null 2>&1; then exec busybox "$2sum" "$1"; fi
+if command -v openssl >/dev/null 2>&1; then exec openssl dgst "-$2" "$1"; fi
+echo "$2sum: not found" >&2; exit 127`
+
+// parseChecksum finds the digest in the output of sha256sum ("<hex>  <path>")
+// or openssl dgst ("SHA2-256(<path>)= <hex>").
+func parseChecksum(output string, size int) (string, bool) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", false
+	}
+	// The sum tools print the digest first, openssl last.
+	for _, f := range []string{fields[0], fields[len(fields)-1]} {
+		f = strings.ToLower(f)
+		if _, err := hex.DecodeString(f); err == nil && len(f) == 2*size {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// FileChecksum computes the digest of a file on the PVC inside the pod, so
+// a file can be checked against a local copy without downloading it.
+func (c *Client) FileChecksum(ctx context.Context, namespace, pvcName, filePath, algo string) (*FileChecksum, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"sh", "-c", checksumFileScript, "sh", pvcPath(mountPath, filePath), algo}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, streamError(ke, stderr)
+		}
+		return nil, err
+	}
+	sum, ok := parseChecksum(stdout, h.Size())
+	if !ok {
+		return nil, fmt.Errorf("unexpected %ssum output: %q", algo, strings.TrimSpace(stdout))
+	}
+	return &FileChecksum{Path: filePath, Algorithm: algo, Checksum: sum}, nil
+}
@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestParseChecksum(t *testing.T) {
+	for _, out := range []string{
+		helloSHA256 + "  /data/hello.txt\n",
+		"SHA2-256(/data/hello.txt)= " + helloSHA256 + "\n",
+		"SHA256(/data/" + helloSHA256[:8] + ")= " + strings.ToUpper(helloSHA256) + "\n",
+	} {
+		if got, ok := parseChecksum(out, 32); !ok || got != helloSHA256 {
+			t.Errorf("parseChecksum(%q) = %q, %v", out, got, ok)
+		}
+	}
+	if _, ok := parseChecksum("5d41402abc4b2a76b9719d911017c592  /data/x", 32); ok {
+		t.Error("expected an md5 digest not to pass for sha256")
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec(helloSHA256+"  /data/in/hello.txt\n", "", nil)
+	c := newTransferClient(mock)
+
+	sum, err := c.FileChecksum(context.Background(), "default", "my-pvc", "/in/hello.txt", "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Checksum != helloSHA256 || sum.Algorithm != "sha256" || sum.Path != "/in/hello.txt" {
+		t.Errorf("unexpected checksum %+v", sum)
+	}
+	want := "sh -c " + checksumFileScript + " sh /data/in/hello.txt sha256"
+	if got := strings.Join(mock.execCalls[0].cmd, " "); got != want {
+		t.Errorf("unexpected command %q", got)
+	}
+
+	if _, err := c.FileChecksum(context.Background(), "default", "my-pvc", "/in/hello.txt", "crc32"); err == nil {
+		t.Error("expected an unsupported algorithm to be refused")
+	}
+}
+
+func TestFileChecksumFallsBackToHelper(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "helper-1"}
+	mock.pushExec("", "sha256sum: not found", fmt.Errorf("command terminated with exit code 127"))
+	mock.pushExec(helloSHA256+"  /data/hello.txt\n", "", nil)
+	c := newTransferClient(mock)
+
+	sum, err := c.FileChecksum(context.Background(), "default", "my-pvc", "/hello.txt", "sha256")
+	if err != nil || sum.Checksum != helloSHA256 {
+		t.Fatalf("expected the helper pod's checksum, got %+v, %v", sum, err)
+	}
+	if mock.createCalled != 1 || mock.execCalls[1].podName != "helper-1" {
+		t.Errorf("expected a retry in the helper pod, got %+v", mock.execCalls)
+	}
+}
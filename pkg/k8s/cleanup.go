@@ -0,0 +1,42 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"kube-browser/pkg/cleanup"
+)
+
+// SetCleanupWorker makes the client schedule helper pod deletions on w, so
+// they show up in the server's cleanup status. It must be called before
+// the client is used.
+func (c *Client) SetCleanupWorker(w *cleanup.Worker) {
+	c.cleaner = w
+}
+
+func (c *Client) cleanupWorker() *cleanup.Worker {
+	c.cleanerOnce.Do(func() {
+		if c.cleaner == nil {
+			c.cleaner = cleanup.NewWorker()
+		}
+	})
+	return c.cleaner
+}
+
+// scheduleHelperDeletion deletes a helper pod in the background, retrying
+// on failure. The deletion is not tied to the request that used the pod.
+func (c *Client) scheduleHelperDeletion(namespace, podName string) {
+	ex := c.getExecutor()
+	c.cleanupWorker().Enqueue("helper-pod", namespace+"/"+podName, func(ctx context.Context) error {
+		return ex.deleteHelperPod(ctx, namespace, podName)
+	})
+}
+
+// schedulePartialUploadRemoval deletes what a failed upload left on the PVC.
+// It runs in the background because the request that wrote the file may
+// have been cancelled.
+func (c *Client) schedulePartialUploadRemoval(namespace, pvcName, filePath string) {
+	c.cleanupWorker().Enqueue("pvc-file", fmt.Sprintf("%s/%s:%s", namespace, pvcName, filePath), func(ctx context.Context) error {
+		return c.RemoveFile(ctx, namespace, pvcName, filePath)
+	})
+}
@@ -4,21 +4,25 @@ import (
         "bytes"
         "context"
         "encoding/json"
+        "errors"
         "fmt"
         "io"
         "log"
         "os"
-        gopath "path"
         "path/filepath"
         "runtime"
         "strconv"
         "strings"
+        "sync"
         "time"
 
+        "kube-browser/pkg/cleanup"
+
         corev1 "k8s.io/api/core/v1"
         "k8s.io/apimachinery/pkg/api/resource"
         metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
         apierrors "k8s.io/apimachinery/pkg/api/errors"
+        "k8s.io/client-go/dynamic"
         "k8s.io/client-go/kubernetes"
         "k8s.io/client-go/kubernetes/scheme"
         "k8s.io/client-go/rest"
@@ -32,6 +36,35 @@ type Client struct {
         KubeconfigPath string
         ContextName    string
         executor       PodExecutor
+        credentials    *credentialTracker
+        helperDisabled bool
+        registryMirror string
+        // pullSecrets, when set, replace KUBE_BROWSER_IMAGE_PULL_SECRET; see
+        // SetImagePullSecrets.
+        pullSecrets    []string
+        execSlots      chan struct{}
+        // execReserveMu serializes ReserveExecSlots.
+        execReserveMu  sync.Mutex
+        helperEvents   func(HelperEvent)
+        // claimCreated is told about each PVC the client creates; see
+        // SetClaimCreated.
+        claimCreated   func(namespace, pvc string)
+        // namespace, when set, is the only namespace the client works in;
+        // see SetNamespace.
+        namespace string
+        // shellProbes caches which containers have a shell; see hasShell.
+        probeMu     sync.Mutex
+        shellProbes map[string]bool
+        // dynamic reaches resources without typed clients, such as
+        // VolumeSnapshots; see dynamicClient.
+        dynamicMu sync.Mutex
+        dynamic   dynamic.Interface
+
+        cleanerOnce sync.Once
+        cleaner     *cleanup.Worker
+
+        // apiHealth records the retries of list calls; see withListRetry.
+        apiHealth apiHealthTracker
 }
 
 func (c *Client) getExecutor() PodExecutor {
@@ -41,6 +74,36 @@ func (c *Client) getExecutor() PodExecutor {
         return c
 }
 
+// Connection returns the kubeconfig and context this client was created
+// from.
+func (c *Client) Connection() (kubeconfigPath, contextName string) {
+        return c.KubeconfigPath, c.ContextName
+}
+
+// DisableHelperPods prevents the client from ever creating pods. Operations
+// that would need a helper pod fail with ErrKindHelperDisabled instead.
+func (c *Client) DisableHelperPods() {
+        c.helperDisabled = true
+}
+
+func (c *Client) startHelperPod(ctx context.Context, namespace, pvcName, volumeName, nodeName string, directErr error) (string, error) {
+        if c.helperDisabled {
+                return "", &K8sError{
+                        Kind:    ErrKindHelperDisabled,
+                        Message: "The container could not be accessed directly and helper pods are disabled (minimal mode).",
+                        Cause:   directErr,
+                }
+        }
+        if !c.allows(namespace, StrategyHelper) {
+                return "", &K8sError{
+                        Kind:    ErrKindHelperDisabled,
+                        Message: fmt.Sprintf("Helper pods are not allowed in namespace %s (%s).", namespace, accessStrategiesEnv),
+                        Cause:   directErr,
+                }
+        }
+        return c.getExecutor().createHelperPod(ctx, namespace, pvcName, volumeName, nodeName)
+}
+
 type PVCInfo struct {
         Name         string `json:"name"`
         Namespace    string `json:"namespace"`
@@ -50,14 +113,34 @@ type PVCInfo struct {
         StorageClass string `json:"storageClass"`
         MountedBy    string `json:"mountedBy"`
         MountPath    string `json:"mountPath"`
+        // OwnerPod is set for the claim of a generic ephemeral volume: it
+        // belongs to that pod and is deleted with it.
+        OwnerPod     string `json:"ownerPod,omitempty"`
+        Labels       map[string]string `json:"labels,omitempty"`
 }
 
+// FileInfo is an entry of a listing. Size is in bytes and ModTime is
+// RFC 3339 in UTC; the JSON form adds typed and display forms of both (see
+// MarshalJSON).
 type FileInfo struct {
         Name    string `json:"name"`
         Size    string `json:"size"`
         ModTime string `json:"modTime"`
         IsDir   bool   `json:"isDir"`
         Path    string `json:"path"`
+        // Mode is the permission string as ls prints it ("-rw-r--r--",
+        // "drwxr-x---"), and UID and GID the numeric owner and group. They
+        // are empty when the listing tool does not report them.
+        Mode string `json:"mode,omitempty"`
+        UID  string `json:"uid,omitempty"`
+        GID  string `json:"gid,omitempty"`
+        // Symlink is set for a symbolic link, with its target when known.
+        // IsDir is not set for a link to a directory.
+        Symlink    bool   `json:"symlink,omitempty"`
+        LinkTarget string `json:"linkTarget,omitempty"`
+        // Secret is set on container listings for entries inside a volume
+        // sourced from a Secret, whose contents need an explicit reveal.
+        Secret bool `json:"secret,omitempty"`
 }
 
 type KubeconfigInfo struct {
@@ -129,6 +212,8 @@ func NewClientWithContext(kubeconfigPath, contextName string) (*Client, error) {
                 return nil, fmt.Errorf("failed to create kubernetes config: %w", err)
         }
 
+        credentials := trackCredentials(config)
+
         clientset, err := kubernetes.NewForConfig(config)
         if err != nil {
                 return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
@@ -139,12 +224,26 @@ func NewClientWithContext(kubeconfigPath, contextName string) (*Client, error) {
                 restConfig:     config,
                 KubeconfigPath: kubeconfigPath,
                 ContextName:    contextName,
+                credentials:    credentials,
+                execSlots:      newExecSlots(),
         }, nil
 }
 
 func (c *Client) ListNamespaces(ctx context.Context) ([]string, error) {
-        nsList, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+        if c.namespace != "" {
+                return []string{c.namespace}, nil
+        }
+        nsList, err := withListRetry(ctx, c, "namespaces", func(ctx context.Context) (*corev1.NamespaceList, error) {
+                return c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+        })
         if err != nil {
+                if apierrors.IsForbidden(err) {
+                        return nil, &K8sError{
+                                Kind:    ErrKindRBAC,
+                                Message: "Permission denied: your kubeconfig cannot list namespaces.",
+                                Cause:   err,
+                        }
+                }
                 return nil, err
         }
 
@@ -156,12 +255,17 @@ func (c *Client) ListNamespaces(ctx context.Context) ([]string, error) {
 }
 
 func (c *Client) ListPVCs(ctx context.Context, namespace string) ([]PVCInfo, error) {
-        pvcList, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+        if err := c.inScope(namespace); err != nil {
+                return nil, err
+        }
+        pvcList, err := withListRetry(ctx, c, "PVCs in "+namespace, func(ctx context.Context) (*corev1.PersistentVolumeClaimList, error) {
+                return c.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+        })
         if err != nil {
                 return nil, err
         }
 
-        podList, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+        podList, err := c.listPods(ctx, namespace)
         if err != nil {
                 return nil, err
         }
@@ -175,7 +279,7 @@ func (c *Client) ListPVCs(ctx context.Context, namespace string) ([]PVCInfo, err
                         continue
                 }
                 for _, vol := range pod.Spec.Volumes {
-                        if vol.PersistentVolumeClaim != nil {
+                        if claim := volumeClaimName(&pod, vol); claim != "" {
                                 mountPath := ""
                                 for _, container := range pod.Spec.Containers {
                                         for _, mount := range container.VolumeMounts {
@@ -188,7 +292,7 @@ func (c *Client) ListPVCs(ctx context.Context, namespace string) ([]PVCInfo, err
                                                 break
                                         }
                                 }
-                                pvcPodMap[vol.PersistentVolumeClaim.ClaimName] = struct {
+                                pvcPodMap[claim] = struct {
                                         podName   string
                                         mountPath string
                                 }{podName: pod.Name, mountPath: mountPath}
@@ -198,44 +302,48 @@ func (c *Client) ListPVCs(ctx context.Context, namespace string) ([]PVCInfo, err
 
         var pvcs []PVCInfo
         for _, pvc := range pvcList.Items {
-                capacity := ""
-                if qty, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
-                        capacity = qty.String()
+                info := pvcInfo(&pvc)
+                if mount, ok := pvcPodMap[pvc.Name]; ok {
+                        info.MountedBy = mount.podName
+                        info.MountPath = mount.mountPath
                 }
+                pvcs = append(pvcs, info)
+        }
 
-                accessModes := ""
-                for i, mode := range pvc.Spec.AccessModes {
-                        if i > 0 {
-                                accessModes += ", "
-                        }
-                        accessModes += string(mode)
-                }
+        return pvcs, nil
+}
 
-                storageClass := ""
-                if pvc.Spec.StorageClassName != nil {
-                        storageClass = *pvc.Spec.StorageClassName
-                }
+// pvcInfo describes a claim as far as the claim itself tells; which pod
+// mounts it is left for the caller to fill in.
+func pvcInfo(pvc *corev1.PersistentVolumeClaim) PVCInfo {
+        capacity := ""
+        if qty, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+                capacity = qty.String()
+        }
 
-                mountedBy := ""
-                mountPath := ""
-                if info, ok := pvcPodMap[pvc.Name]; ok {
-                        mountedBy = info.podName
-                        mountPath = info.mountPath
+        accessModes := ""
+        for i, mode := range pvc.Spec.AccessModes {
+                if i > 0 {
+                        accessModes += ", "
                 }
+                accessModes += string(mode)
+        }
 
-                pvcs = append(pvcs, PVCInfo{
-                        Name:         pvc.Name,
-                        Namespace:    pvc.Namespace,
-                        Status:       string(pvc.Status.Phase),
-                        Capacity:     capacity,
-                        AccessModes:  accessModes,
-                        StorageClass: storageClass,
-                        MountedBy:    mountedBy,
-                        MountPath:    mountPath,
-                })
+        storageClass := ""
+        if pvc.Spec.StorageClassName != nil {
+                storageClass = *pvc.Spec.StorageClassName
         }
 
-        return pvcs, nil
+        return PVCInfo{
+                Name:         pvc.Name,
+                Namespace:    pvc.Namespace,
+                Status:       string(pvc.Status.Phase),
+                Capacity:     capacity,
+                AccessModes:  accessModes,
+                StorageClass: storageClass,
+                OwnerPod:     ephemeralOwner(pvc),
+                Labels:       pvc.Labels,
+        }
 }
 
 type podPVCInfo struct {
@@ -244,10 +352,17 @@ type podPVCInfo struct {
         mountPath     string
         volumeName    string
         nodeName      string
+        fsGroup       *int64
+        // windows is set for pods scheduled on Windows nodes, which are
+        // browsed with PowerShell and never get a helper pod.
+        windows bool
 }
 
 func (c *Client) findPodForPVC(ctx context.Context, namespace, pvcName string) (*podPVCInfo, error) {
-        podList, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+        if err := c.inScope(namespace); err != nil {
+                return nil, err
+        }
+        podList, err := c.listPods(ctx, namespace)
         if err != nil {
                 return nil, err
         }
@@ -257,27 +372,42 @@ func (c *Client) findPodForPVC(ctx context.Context, namespace, pvcName string) (
                         continue
                 }
                 for _, vol := range pod.Spec.Volumes {
-                        if vol.PersistentVolumeClaim != nil && vol.PersistentVolumeClaim.ClaimName == pvcName {
-                                for _, container := range pod.Spec.Containers {
-                                        for _, mount := range container.VolumeMounts {
-                                                if mount.Name == vol.Name {
-                                                        return &podPVCInfo{
-                                                                podName:       pod.Name,
-                                                                containerName: container.Name,
-                                                                mountPath:     mount.MountPath,
-                                                                volumeName:    vol.Name,
-                                                                nodeName:      pod.Spec.NodeName,
-                                                        }, nil
-                                                }
-                                        }
-                                }
+                        if volumeClaimName(&pod, vol) != pvcName {
+                                continue
+                        }
+                        candidates := mountingContainers(&pod, vol.Name)
+                        if len(candidates) == 0 {
+                                continue
+                        }
+                        windows := podIsWindows(&pod)
+                        container := candidates[0]
+                        if !windows && c.allows(namespace, StrategyExec) {
+                                // Windows containers have no sh to probe for,
+                                // and probing is an exec.
+                                container = c.pickContainer(ctx, &pod, candidates)
                         }
+                        info := &podPVCInfo{
+                                podName:       pod.Name,
+                                containerName: container.name,
+                                mountPath:     container.mountPath,
+                                volumeName:    vol.Name,
+                                nodeName:      pod.Spec.NodeName,
+                                windows:       windows,
+                        }
+                        if pod.Spec.SecurityContext != nil {
+                                info.fsGroup = pod.Spec.SecurityContext.FSGroup
+                        }
+                        return info, nil
                 }
         }
 
-        return nil, fmt.Errorf("no running pod found mounting PVC %s", pvcName)
+        return nil, fmt.Errorf("%w %s", errNoMountingPod, pvcName)
 }
 
+// errNoMountingPod is returned by findPodForPVC when no running pod mounts
+// the claim.
+var errNoMountingPod = errors.New("no running pod found mounting PVC")
+
 func (c *Client) execInPod(ctx context.Context, namespace, podName, containerName string, command []string) (string, string, error) {
         execOpts := &corev1.PodExecOptions{
                 Command:   command,
@@ -293,7 +423,7 @@ func (c *Client) execInPod(ctx context.Context, namespace, podName, containerNam
                 SubResource("exec").
                 VersionedParams(execOpts, scheme.ParameterCodec)
 
-        exec, err := remotecommand.NewSPDYExecutor(c.restConfig, "POST", req.URL())
+        exec, err := c.newExecutor(req.URL())
         if err != nil {
                 return "", "", err
         }
@@ -324,8 +454,18 @@ func parseQuantityWithDefault(envKey, defaultVal string) resource.Quantity {
         return q
 }
 
+// Ephemeral storage is only part of the helper's resources when
+// HELPER_EPHEMERAL_STORAGE_REQUEST or HELPER_EPHEMERAL_STORAGE_LIMIT is
+// set, since helpers write nothing outside the claim. In a namespace whose
+// ResourceQuota requires it, these defaults are used instead (see
+// requireQuotaResources).
+const (
+        helperEphemeralRequestDefault = "64Mi"
+        helperEphemeralLimitDefault   = "1Gi"
+)
+
 func helperResourceRequirements() corev1.ResourceRequirements {
-        return corev1.ResourceRequirements{
+        res := corev1.ResourceRequirements{
                 Requests: corev1.ResourceList{
                         corev1.ResourceCPU:    parseQuantityWithDefault("HELPER_CPU_REQUEST", "10m"),
                         corev1.ResourceMemory: parseQuantityWithDefault("HELPER_MEM_REQUEST", "16Mi"),
@@ -335,6 +475,29 @@ func helperResourceRequirements() corev1.ResourceRequirements {
                         corev1.ResourceMemory: parseQuantityWithDefault("HELPER_MEM_LIMIT", "64Mi"),
                 },
         }
+        if os.Getenv("HELPER_EPHEMERAL_STORAGE_REQUEST") != "" {
+                res.Requests[corev1.ResourceEphemeralStorage] = parseQuantityWithDefault("HELPER_EPHEMERAL_STORAGE_REQUEST", helperEphemeralRequestDefault)
+        }
+        if os.Getenv("HELPER_EPHEMERAL_STORAGE_LIMIT") != "" {
+                res.Limits[corev1.ResourceEphemeralStorage] = parseQuantityWithDefault("HELPER_EPHEMERAL_STORAGE_LIMIT", helperEphemeralLimitDefault)
+        }
+        return res
+}
+
+// helperActiveDeadline reads KUBE_BROWSER_HELPER_ACTIVE_DEADLINE_SEC. With
+// activeDeadlineSeconds set, the kubelet terminates the helper on its own
+// even if KubeBrowser crashes or loses access before deleting it.
+func helperActiveDeadline() *int64 {
+        v := os.Getenv("KUBE_BROWSER_HELPER_ACTIVE_DEADLINE_SEC")
+        if v == "" {
+                return nil
+        }
+        parsed, err := strconv.ParseInt(v, 10, 64)
+        if err != nil || parsed <= 0 {
+                log.Printf("Warning: invalid KUBE_BROWSER_HELPER_ACTIVE_DEADLINE_SEC %q, ignoring", v)
+                return nil
+        }
+        return &parsed
 }
 
 func helperSecurityContext() *corev1.SecurityContext {
@@ -408,28 +571,91 @@ func parseTolerations(s string) []corev1.Toleration {
         return tolerations
 }
 
-func (c *Client) createHelperPod(ctx context.Context, namespace, pvcName, volumeName, nodeName string) (string, error) {
-        ts := strconv.FormatInt(time.Now().UnixNano(), 16)
-        helperName := fmt.Sprintf("kube-browser-helper-%s-%s", pvcName, ts)
-
-        image := getEnvWithDefault("HELPER_IMAGE", "alpine:3.19")
-
-        startupTimeout := 60 * time.Second
-        if v := os.Getenv("HELPER_STARTUP_TIMEOUT_SEC"); v != "" {
-                if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
-                        startupTimeout = time.Duration(parsed) * time.Second
-                }
-        }
-
+// helperLabels returns the labels KubeBrowser puts on the pods it creates,
+// including KUBE_BROWSER_EXTRA_LABELS.
+func helperLabels(app string) map[string]string {
         labels := map[string]string{
-                "app":        "kube-browser-helper",
+                "app":        app,
                 "managed-by": "kube-browser",
         }
         for k, v := range parseKeyValuePairs(os.Getenv("KUBE_BROWSER_EXTRA_LABELS")) {
                 labels[k] = v
         }
+        return labels
+}
+
+// applyHelperScheduling applies the cluster-specific settings shared by
+// every pod KubeBrowser creates: service account, pull secrets, node
+// selector, tolerations and priority class.
+func (c *Client) applyHelperScheduling(podSpec *corev1.PodSpec) {
+        if sa := os.Getenv("KUBE_BROWSER_SERVICE_ACCOUNT"); sa != "" {
+                podSpec.ServiceAccountName = sa
+        }
+
+        podSpec.ImagePullSecrets = c.pullSecretRefs()
+
+        if ns := parseKeyValuePairs(os.Getenv("KUBE_BROWSER_NODE_SELECTOR")); ns != nil {
+                podSpec.NodeSelector = ns
+        }
+
+        if tols := parseTolerations(os.Getenv("KUBE_BROWSER_TOLERATIONS")); tols != nil {
+                podSpec.Tolerations = tols
+        }
+
+        if pc := os.Getenv("KUBE_BROWSER_PRIORITY_CLASS"); pc != "" {
+                podSpec.PriorityClassName = pc
+        }
+}
+
+// helperPodLifetime is how long a helper pod sleeps before exiting on its
+// own.
+const helperPodLifetime = 300 * time.Second
+
+// helperPodOptions sets up a helper pod for something other than a single
+// operation. The zero value is an ordinary helper.
+type helperPodOptions struct {
+        // app is the pod's app label and name prefix.
+        app string
+        // lifetime replaces helperPodLifetime.
+        lifetime time.Duration
+        // annotations are added to KUBE_BROWSER_EXTRA_ANNOTATIONS.
+        annotations map[string]string
+        // avoidNode keeps the pod off a node, when the node it runs on is
+        // left to the scheduler.
+        avoidNode string
+}
+
+func (c *Client) createHelperPod(ctx context.Context, namespace, pvcName, volumeName, nodeName string) (string, error) {
+        return c.createHelperPodWith(ctx, namespace, pvcName, volumeName, nodeName, helperPodOptions{})
+}
+
+func (c *Client) createHelperPodWith(ctx context.Context, namespace, pvcName, volumeName, nodeName string, opts helperPodOptions) (string, error) {
+        if err := c.inScope(namespace); err != nil {
+                return "", err
+        }
+        if opts.app == "" {
+                opts.app = "kube-browser-helper"
+        }
+        lifetime := helperPodLifetime
+        if opts.lifetime > 0 {
+                lifetime = opts.lifetime
+        }
+        ts := strconv.FormatInt(time.Now().UnixNano(), 16)
+        helperName := fmt.Sprintf("%s-%s-%s", opts.app, pvcName, ts)
+
+        image := c.helperImage()
+
+        wait := helperWaitSettings()
+
+        labels := helperLabels(opts.app)
 
         annotations := parseKeyValuePairs(os.Getenv("KUBE_BROWSER_EXTRA_ANNOTATIONS"))
+        for k, v := range opts.annotations {
+                if annotations == nil {
+                        annotations = map[string]string{}
+                }
+                annotations[k] = v
+        }
 
         log.Printf("Creating helper pod %s on node %s for PVC %s (image: %s)", helperName, nodeName, pvcName, image)
 
@@ -439,7 +665,7 @@ func (c *Client) createHelperPod(ctx context.Context, namespace, pvcName, volume
                         {
                                 Name:            "helper",
                                 Image:           image,
-                                Command:         []string{"sleep", "300"},
+                                Command:         []string{"sleep", strconv.Itoa(int(lifetime.Seconds()))},
                                 Resources:       helperResourceRequirements(),
                                 SecurityContext: helperSecurityContext(),
                                 VolumeMounts: []corev1.VolumeMount{
@@ -463,20 +689,26 @@ func (c *Client) createHelperPod(ctx context.Context, namespace, pvcName, volume
                 RestartPolicy: corev1.RestartPolicyNever,
         }
 
-        if sa := os.Getenv("KUBE_BROWSER_SERVICE_ACCOUNT"); sa != "" {
-                podSpec.ServiceAccountName = sa
-        }
-
-        if ips := os.Getenv("KUBE_BROWSER_IMAGE_PULL_SECRET"); ips != "" {
-                podSpec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: ips}}
-        }
-
-        if ns := parseKeyValuePairs(os.Getenv("KUBE_BROWSER_NODE_SELECTOR")); ns != nil {
-                podSpec.NodeSelector = ns
+        c.applyHelperScheduling(&podSpec)
+        if opts.avoidNode != "" && nodeName == "" {
+                podSpec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+                        RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+                                NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+                                        MatchFields: []corev1.NodeSelectorRequirement{{
+                                                Key:      "metadata.name",
+                                                Operator: corev1.NodeSelectorOpNotIn,
+                                                Values:   []string{opts.avoidNode},
+                                        }},
+                                }},
+                        },
+                }}
         }
 
-        if tols := parseTolerations(os.Getenv("KUBE_BROWSER_TOLERATIONS")); tols != nil {
-                podSpec.Tolerations = tols
+        podSpec.ActiveDeadlineSeconds = helperActiveDeadline()
+        if d := int64(lifetime.Seconds()); opts.lifetime > 0 && podSpec.ActiveDeadlineSeconds != nil && *podSpec.ActiveDeadlineSeconds < d {
+                // The deadline is meant for helpers KubeBrowser forgot; it
+                // must not cut a longer-lived one short.
+                podSpec.ActiveDeadlineSeconds = &d
         }
 
         pod := &corev1.Pod{
@@ -489,8 +721,19 @@ func (c *Client) createHelperPod(ctx context.Context, namespace, pvcName, volume
                 Spec: podSpec,
         }
 
+        if err := c.fitHelperToNamespace(ctx, namespace, &pod.Spec); err != nil {
+                log.Printf("Not creating helper pod %s: %v", helperName, err)
+                return "", err
+        }
+
         _, err := c.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
         if err != nil {
+                if kerr := quotaRejection(err); kerr != nil {
+                        return "", kerr
+                }
+                if kerr := priorityClassRejection(err, pod.Spec.PriorityClassName); kerr != nil {
+                        return "", kerr
+                }
                 if apierrors.IsForbidden(err) {
                         return "", &K8sError{
                                 Kind:    ErrKindRBAC,
@@ -501,35 +744,65 @@ func (c *Client) createHelperPod(ctx context.Context, namespace, pvcName, volume
                 return "", classifyApiError(err)
         }
 
+        watch := c.watchHelper(namespace, helperName, pvcName)
+        watch.report("Creating", fmt.Sprintf("Creating helper pod %s (image: %s)", helperName, image), false)
+
         var lastPhase, lastReason string
-        deadline := time.Now().Add(startupTimeout)
+        deadline := time.Now().Add(wait.startup)
         for time.Now().Before(deadline) {
-                time.Sleep(2 * time.Second)
+                select {
+                case <-ctx.Done():
+                        c.scheduleHelperDeletion(namespace, helperName)
+                        return "", classifyExecError(ctx.Err(), "")
+                case <-time.After(wait.poll):
+                }
                 p, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, helperName, metav1.GetOptions{})
                 if err != nil {
                         log.Printf("Error polling helper pod %s: %v", helperName, err)
                         continue
                 }
+                watch.poll(ctx, p)
                 lastPhase = string(p.Status.Phase)
                 if len(p.Status.ContainerStatuses) > 0 && p.Status.ContainerStatuses[0].State.Waiting != nil {
                         lastReason = p.Status.ContainerStatuses[0].State.Waiting.Reason
+                } else if p.Status.Reason != "" {
+                        // Kubelet admission rejections (OutOfcpu, OutOfmemory)
+                        // and DeadlineExceeded are reported on the pod itself.
+                        lastReason = p.Status.Reason
+                } else if _, ok := unschedulable(p); ok {
+                        lastReason = corev1.PodReasonUnschedulable
                 }
                 if p.Status.Phase == corev1.PodRunning {
                         log.Printf("Helper pod %s is running", helperName)
+                        watch.report("Running", fmt.Sprintf("Helper pod %s is running", helperName), false)
                         return helperName, nil
                 }
                 if p.Status.Phase == corev1.PodFailed || p.Status.Phase == corev1.PodSucceeded {
-                        go c.deleteHelperPod(context.Background(), namespace, helperName)
-                        return "", classifyPodError(string(p.Status.Phase), lastReason)
+                        watch.reportLogs(ctx)
+                        c.scheduleHelperDeletion(namespace, helperName)
+                        return "", watch.explain(classifyPodError(string(p.Status.Phase), lastReason))
+                }
+                if watch.multiAttach != "" {
+                        return c.retryOnAttachedNode(ctx, watch, helperName, namespace, pvcName, volumeName, nodeName, opts)
+                }
+                if kerr := watch.terminal(p, wait, time.Now()); kerr != nil {
+                        log.Printf("Giving up on helper pod %s: %s", helperName, kerr.Message)
+                        watch.report("GaveUp", "Not waiting any longer: "+kerr.Message, true)
+                        c.scheduleHelperDeletion(namespace, helperName)
+                        return "", watch.explain(kerr)
                 }
                 log.Printf("Waiting for helper pod %s (phase: %s, reason: %s)", helperName, lastPhase, lastReason)
         }
 
-        go c.deleteHelperPod(context.Background(), namespace, helperName)
-        return "", classifyPodError(lastPhase, lastReason)
+        watch.report("Timeout", fmt.Sprintf("Helper pod %s did not start within %s (HELPER_STARTUP_TIMEOUT_SEC)", helperName, wait.startup), true)
+        c.scheduleHelperDeletion(namespace, helperName)
+        return "", watch.explain(classifyPodError(lastPhase, lastReason))
 }
 
-func (c *Client) deleteHelperPod(ctx context.Context, namespace, podName string) {
+// deleteHelperPod deletes a helper pod and waits up to
+// HELPER_DELETE_TIMEOUT_SEC for it to disappear. Retries are left to the
+// cleanup worker; see scheduleHelperDeletion.
+func (c *Client) deleteHelperPod(ctx context.Context, namespace, podName string) error {
         deleteTimeout := 60 * time.Second
         if v := os.Getenv("HELPER_DELETE_TIMEOUT_SEC"); v != "" {
                 if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
@@ -537,48 +810,41 @@ func (c *Client) deleteHelperPod(ctx context.Context, namespace, podName string)
                 }
         }
 
-        const maxRetries = 3
-        var lastErr error
-        for attempt := 1; attempt <= maxRetries; attempt++ {
-                err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
-                if err != nil {
-                        if apierrors.IsNotFound(err) {
-                                log.Printf("Helper pod %s already deleted", podName)
-                                return
-                        }
-                        log.Printf("Attempt %d: failed to delete helper pod %s: %v", attempt, podName, err)
-                        lastErr = err
-                        time.Sleep(time.Duration(attempt) * time.Second)
-                        continue
+        err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+        if err != nil {
+                if apierrors.IsNotFound(err) {
+                        log.Printf("Helper pod %s already deleted", podName)
+                        return nil
                 }
-                lastErr = nil
-                break
-        }
-        if lastErr != nil {
-                log.Printf("Warning: could not issue delete for helper pod %s after %d attempts: %v", podName, maxRetries, lastErr)
-                return
+                return fmt.Errorf("failed to delete helper pod %s: %w", podName, err)
         }
 
         deadline := time.Now().Add(deleteTimeout)
         for time.Now().Before(deadline) {
-                time.Sleep(2 * time.Second)
+                select {
+                case <-ctx.Done():
+                        return ctx.Err()
+                case <-time.After(2 * time.Second):
+                }
                 _, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
                 if err != nil {
                         if apierrors.IsNotFound(err) {
                                 log.Printf("Helper pod %s confirmed deleted", podName)
-                                return
+                                return nil
                         }
                         log.Printf("Transient error polling helper pod %s deletion: %v", podName, err)
                         continue
                 }
                 log.Printf("Waiting for helper pod %s to be fully deleted...", podName)
         }
-        log.Printf("Warning: helper pod %s was not confirmed deleted within %s", podName, deleteTimeout)
+        return fmt.Errorf("helper pod %s was not confirmed deleted within %s", podName, deleteTimeout)
 }
 
 func (c *Client) CleanupOrphanedHelperPods(ctx context.Context) {
         log.Printf("Scanning for orphaned helper pods with label managed-by=kube-browser...")
-        podList, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+        // A scoped client may not list pods cluster-wide; its own
+        // namespace is all it could have left pods in.
+        podList, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
                 LabelSelector: "managed-by=kube-browser",
         })
         if err != nil {
@@ -590,16 +856,31 @@ func (c *Client) CleanupOrphanedHelperPods(ctx context.Context) {
                 return
         }
         for _, pod := range podList.Items {
+                if maintenanceHelperActive(&pod, time.Now()) {
+                        log.Printf("Keeping helper pod %s/%s of a maintenance session", pod.Namespace, pod.Name)
+                        continue
+                }
                 log.Printf("Deleting orphaned helper pod %s/%s (phase: %s)", pod.Namespace, pod.Name, pod.Status.Phase)
-                c.deleteHelperPod(ctx, pod.Namespace, pod.Name)
+                if err := c.deleteHelperPod(ctx, pod.Namespace, pod.Name); err != nil {
+                        log.Printf("Warning: %v", err)
+                }
         }
         log.Printf("Orphaned helper pod cleanup complete (%d pods processed)", len(podList.Items))
 }
 
-func (c *Client) listFilesGNUls(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
-        fullPath := mountPath + "/" + path
+// listingPath is the directory ls and find are given to list path under
+// mountPath. The trailing slash makes them list what a symbolic link to a
+// directory points to, rather than the link itself.
+func listingPath(mountPath, path string) string {
+        return strings.TrimRight(mountPath+"/"+path, "/") + "/"
+}
+
+// listFilesFindPrintf lists with GNU find, whose -printf separates every
+// field with a NUL, so any file name round-trips unchanged.
+func (c *Client) listFilesFindPrintf(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
+        fullPath := listingPath(mountPath, path)
         stdout, stderr, err := c.getExecutor().execInPod(ctx, namespace, podName, containerName, []string{
-                "ls", "-la", "--time-style=long-iso", fullPath,
+                "env", "LC_ALL=C", "find", fullPath, "-mindepth", "1", "-maxdepth", "1", "-printf", findPrintfFormat,
         })
         if err != nil {
                 if stderr != "" {
@@ -607,13 +888,37 @@ func (c *Client) listFilesGNUls(ctx context.Context, namespace, podName, contain
                 }
                 return nil, classifyExecError(err, stderr)
         }
-        return parseGNUlsOutput(stdout, path), nil
+        files, perr := parseFindPrintfOutput(stdout, path)
+        if perr != nil {
+                return nil, &K8sError{Kind: ErrKindUnknown, Message: perr.Error()}
+        }
+        return files, nil
 }
 
-func (c *Client) listFilesBusybox(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
-        fullPath := mountPath + "/" + path
+// statListScript runs statListBatch ($2) on the entries of directory $1,
+// in batches as find -exec ... + forms them.
+const statListScript = `cd -- "$1" || exit
+exec find . -mindepth 1 -maxdepth 1 -exec sh -c "$2" sh {} +`
+
+// statListBatch prints a statBatchFormat line for each of its arguments, a
+// NUL, then each argument and its link target (empty for anything but a
+// link), NUL-terminated. Only names and targets can hold newlines, and
+// they are never split on one. An entry removed meanwhile fails the batch
+// as a mismatch rather than as a missing directory.
+const statListBatch = `stat -c '` + statBatchFormat + `' -- "$@" 2>/dev/null || exit
+printf '\0'
+for f; do
+  printf '%s\0' "$f"
+  if [ -L "$f" ]; then printf '%s\0' "$(readlink -- "$f")"; else printf '\0'; fi
+done`
+
+// listFilesStatBatch lists with find, stat and a POSIX shell, which BusyBox
+// images such as the helper pod's have but whose find lacks -printf. Names
+// are NUL-terminated as with listFilesFindPrintf.
+func (c *Client) listFilesStatBatch(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
+        fullPath := listingPath(mountPath, path)
         stdout, stderr, err := c.getExecutor().execInPod(ctx, namespace, podName, containerName, []string{
-                "ls", "-la", fullPath,
+                "env", "LC_ALL=C", "sh", "-c", statListScript, "sh", fullPath, statListBatch,
         })
         if err != nil {
                 if stderr != "" {
@@ -621,72 +926,101 @@ func (c *Client) listFilesBusybox(ctx context.Context, namespace, podName, conta
                 }
                 return nil, classifyExecError(err, stderr)
         }
-        return parseBusyboxOutput(stdout, path), nil
+        files, perr := parseStatBatchOutput(stdout, path)
+        if perr != nil {
+                return nil, &K8sError{Kind: ErrKindUnknown, Message: perr.Error()}
+        }
+        return files, nil
 }
 
-func (c *Client) listFilesFind(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
-        fullPath := mountPath + "/" + path
-
+// shellListScript lists directory $1 with nothing but a POSIX shell and
+// ls, for images whose find lacks -exec or that have no stat. The shell's
+// globs produce the names, so ls is only asked for the metadata columns of
+// one entry at a time and a name is never parsed out of its output. Each
+// entry is printed as the record findPrintfFormat describes; date -r, where
+// the image's date has it, supplies the mtime. An entry removed meanwhile
+// is skipped.
+const shellListScript = `cd -- "$1" || exit
+[ -r . ] || { echo "$1: Permission denied" >&2; exit 1; }
+for f in * .[!.]* ..?*; do
+  [ -e "$f" ] || [ -L "$f" ] || continue
+  l=$(ls -ldn -- "$f" 2>/dev/null) || continue
+  read -r mode links uid gid size rest <<EOF
+$l
+EOF
+  t=${mode%"${mode#?}"}
+  case $t in -) t=f ;; b|c) size=0 ;; esac
+  m=$(date -r "./$f" +%s 2>/dev/null) || m=
+  tg=
+  if [ "$t" = l ]; then tg=$(readlink -- "$f" 2>/dev/null); fi
+  printf '%s\0%s\0%s\0%s\0%s\0%s\0%s\0%s\0' "$t" "$mode" "$size" "$m" "$uid" "$gid" "$f" "$tg"
+done`
+
+// listFilesShell lists with shellListScript. It starts ls and date for
+// every entry, so it comes after the methods that list a directory at once.
+func (c *Client) listFilesShell(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
+        fullPath := listingPath(mountPath, path)
         stdout, stderr, err := c.getExecutor().execInPod(ctx, namespace, podName, containerName, []string{
-                "find", fullPath, "-maxdepth", "1", "-mindepth", "1",
-                "-exec", "stat", "-c", "%n|%s|%Y|%F", "{}", ";",
+                "env", "LC_ALL=C", "sh", "-c", shellListScript, "sh", fullPath,
         })
         if err != nil {
                 if stderr != "" {
                         log.Printf("  stderr: %s", strings.TrimSpace(stderr))
                 }
-                classifiedErr := classifyExecError(err, stderr)
-                switch classifiedErr.Kind {
-                case ErrKindPathNotFound, ErrKindRBAC, ErrKindTimeout, ErrKindPermDenied:
-                        return nil, classifiedErr
-                }
-                log.Printf("  stat unavailable or incompatible (kind=%s), retrying with find -print only", classifiedErr.Kind)
-                stdout2, stderr2, err2 := c.getExecutor().execInPod(ctx, namespace, podName, containerName, []string{
-                        "find", fullPath, "-maxdepth", "1", "-mindepth", "1", "-print",
-                })
-                if err2 != nil {
-                        if stderr2 != "" {
-                                log.Printf("  stderr (find fallback): %s", strings.TrimSpace(stderr2))
-                        }
-                        return nil, classifyExecError(err2, stderr2)
-                }
-                return parseFindOutput(stdout2, fullPath, path), nil
+                return nil, classifyExecError(err, stderr)
+        }
+        files, perr := parseFindPrintfOutput(stdout, path)
+        if perr != nil {
+                return nil, &K8sError{Kind: ErrKindUnknown, Message: perr.Error()}
         }
-        return parseFindOutput(stdout, fullPath, path), nil
+        return files, nil
 }
 
-func (c *Client) tryListFiles(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
-        log.Printf("Trying GNU ls on %s/%s (container: %s, mount: %s)", namespace, podName, containerName, mountPath)
+// listingMethod lists path under mountPath in a pod, one way.
+type listingMethod struct {
+        name string
+        list func(c *Client, ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error)
+}
 
-        var collectedErrs []*K8sError
+// listingMethods are tried in order until one works. Each prints the same
+// NUL-separated fields, so every legal file name lists exactly; they differ
+// only in the tools they need and in how many processes they start.
+var listingMethods = []listingMethod{
+        {"GNU find -printf", (*Client).listFilesFindPrintf},
+        {"find+stat batch", (*Client).listFilesStatBatch},
+        {"sh+ls", (*Client).listFilesShell},
+}
 
-        files, err := c.listFilesGNUls(ctx, namespace, podName, containerName, mountPath, path)
-        if err == nil {
-                return files, nil
-        }
-        log.Printf("GNU ls failed: %v", err)
-        if k, ok := err.(*K8sError); ok {
-                collectedErrs = append(collectedErrs, k)
+// isFinalListingError reports whether kind fails every listing method the
+// same way, so trying the rest is pointless.
+func isFinalListingError(kind ErrorKind) bool {
+        switch kind {
+        case ErrKindRBAC, ErrKindTimeout, ErrKindPathNotFound, ErrKindPermDenied:
+                return true
         }
+        return isFilesystemError(kind)
+}
 
-        log.Printf("Trying BusyBox ls")
-        files, err = c.listFilesBusybox(ctx, namespace, podName, containerName, mountPath, path)
-        if err == nil {
-                return files, nil
-        }
-        log.Printf("BusyBox ls failed: %v", err)
-        if k, ok := err.(*K8sError); ok {
-                collectedErrs = append(collectedErrs, k)
-        }
+func (c *Client) tryListFiles(ctx context.Context, namespace, podName, containerName, mountPath, path string) ([]FileInfo, error) {
+        log.Printf("Listing files on %s/%s (container: %s, mount: %s, path: %q)", namespace, podName, containerName, mountPath, path)
 
-        log.Printf("Trying find+stat")
-        files, err = c.listFilesFind(ctx, namespace, podName, containerName, mountPath, path)
-        if err == nil {
-                return files, nil
-        }
-        log.Printf("find+stat failed: %v", err)
-        if k, ok := err.(*K8sError); ok {
+        var collectedErrs []*K8sError
+        var err error
+        for _, m := range listingMethods {
+                var files []FileInfo
+                files, err = m.list(c, ctx, namespace, podName, containerName, mountPath, path)
+                if err == nil {
+                        return files, nil
+                }
+                log.Printf("%s failed: %v", m.name, err)
+                k, ok := err.(*K8sError)
+                if !ok {
+                        continue
+                }
                 collectedErrs = append(collectedErrs, k)
+                if isFinalListingError(k.Kind) {
+                        break
+                }
         }
 
         if best := mostActionableError(collectedErrs...); best != nil {
@@ -702,28 +1036,30 @@ func (c *Client) ListFiles(ctx context.Context, namespace, pvcName, path string)
         if err != nil {
                 return nil, err
         }
-
-        files, err := c.tryListFiles(ctx, namespace, info.podName, info.containerName, info.mountPath, path)
-        if err == nil {
-                return files, nil
+        if info.windows {
+                return c.listFilesWindows(ctx, namespace, info, path)
         }
 
-        log.Printf("Direct exec failed, creating helper pod for PVC %s on node %s", pvcName, info.nodeName)
-        ex := c.getExecutor()
-        helperName, helperErr := ex.createHelperPod(ctx, namespace, pvcName, info.volumeName, info.nodeName)
-        if helperErr != nil {
-                log.Printf("Direct exec error was: %v", err)
-                return nil, helperErr
-        }
-
-        files, helperErr = c.tryListFiles(ctx, namespace, helperName, "helper", "/data", path)
-
-        go ex.deleteHelperPod(context.Background(), namespace, helperName)
-
-        if helperErr != nil {
-                return nil, fmt.Errorf("failed to list files even with helper pod: %w", helperErr)
+        var files []FileInfo
+        err = c.withAccess(ctx, namespace, pvcName, info, func(ctx context.Context, t accessTarget) (bool, error) {
+                var err error
+                files, err = c.tryListFiles(ctx, namespace, t.pod, t.container, t.mountPath, path)
+                if err == nil {
+                        return false, nil
+                }
+                if t.strategy != StrategyExec {
+                        return false, fmt.Errorf("failed to list files even with %s: %w", t.strategy.describe(), err)
+                }
+                if k, ok := err.(*K8sError); ok && isFilesystemError(k.Kind) {
+                        // A helper pod would mount the same broken volume.
+                        return false, k
+                }
+                log.Printf("Direct exec failed, trying the next access strategy for PVC %s on node %s", pvcName, info.nodeName)
+                return true, err
+        })
+        if err != nil {
+                return nil, err
         }
-
         return files, nil
 }
 
@@ -736,142 +1072,29 @@ func (c *Client) execInPodWithContainer(ctx context.Context, namespace, podName,
                 SubResource("exec").
                 VersionedParams(opts, scheme.ParameterCodec)
 
-        return remotecommand.NewSPDYExecutor(c.restConfig, "POST", req.URL())
+        return c.newExecutor(req.URL())
 }
 
-func (c *Client) execInPodStreaming(ctx context.Context, namespace, podName, containerName string, command []string, w io.Writer) error {
-        execOpts := &corev1.PodExecOptions{
-                Command:   command,
-                Stdout:    true,
-                Stderr:    true,
-                Container: containerName,
-        }
-
-        req := c.clientset.CoreV1().RESTClient().Post().
-                Resource("pods").
-                Name(podName).
-                Namespace(namespace).
-                SubResource("exec").
-                VersionedParams(execOpts, scheme.ParameterCodec)
-
-        exec, err := remotecommand.NewSPDYExecutor(c.restConfig, "POST", req.URL())
-        if err != nil {
-                return err
-        }
-
-        var stderr bytes.Buffer
-        err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-                Stdout: w,
-                Stderr: &stderr,
-        })
-        if err != nil {
-                if stderr.Len() > 0 {
-                        return fmt.Errorf("%w: %s", err, stderr.String())
-                }
-                return err
-        }
-        return nil
-}
-
-func (c *Client) DownloadFile(ctx context.Context, namespace, pvcName, filePath string) (io.Reader, string, error) {
-        filePath = strings.ReplaceAll(filePath, "\\", "/")
-        info, err := c.findPodForPVC(ctx, namespace, pvcName)
-        if err != nil {
-                return nil, "", err
-        }
-
-        fullPath := info.mountPath + "/" + filePath
-        fileName := gopath.Base(filePath)
-        podName := info.podName
-        containerName := info.containerName
-        nodeName := info.nodeName
-        volumeName := info.volumeName
-
-        pr, pw := io.Pipe()
-
-        go func() {
-                err := c.execInPodStreaming(ctx, namespace, podName, containerName, []string{"cat", fullPath}, pw)
-                if err == nil {
-                        pw.Close()
-                        return
-                }
-
-                log.Printf("Direct download failed, trying helper pod on node %s", nodeName)
-                ex := c.getExecutor()
-                helperName, helperErr := ex.createHelperPod(ctx, namespace, pvcName, volumeName, nodeName)
-                if helperErr != nil {
-                        pw.CloseWithError(fmt.Errorf("download failed: %v", err))
-                        return
-                }
-                defer func() {
-                        go ex.deleteHelperPod(context.Background(), namespace, helperName)
-                }()
-
-                helperPath := "/data/" + filePath
-                helperErr = c.execInPodStreaming(ctx, namespace, helperName, "helper", []string{"cat", helperPath}, pw)
-                if helperErr != nil {
-                        pw.CloseWithError(fmt.Errorf("download failed even with helper pod: %v", helperErr))
-                        return
-                }
-                pw.Close()
-        }()
-
-        return pr, fileName, nil
-}
-
-func (c *Client) UploadFile(ctx context.Context, namespace, pvcName, destPath string, data io.Reader) error {
-        destPath = strings.ReplaceAll(destPath, "\\", "/")
-        info, err := c.findPodForPVC(ctx, namespace, pvcName)
-        if err != nil {
-                return err
-        }
-
-        fullPath := info.mountPath + "/" + destPath
-        podName := info.podName
-        containerName := info.containerName
-
-        exec, execErr := c.execInPodWithContainer(ctx, namespace, podName, containerName, &corev1.PodExecOptions{
-                Command: []string{"tee", fullPath},
-                Stdin:   true,
+func (c *Client) execInPodStream(ctx context.Context, namespace, podName, containerName string, command []string, stdin io.Reader, stdout io.Writer) (string, error) {
+        exec, err := c.execInPodWithContainer(ctx, namespace, podName, containerName, &corev1.PodExecOptions{
+                Command: command,
+                Stdin:   stdin != nil,
                 Stdout:  true,
                 Stderr:  true,
         })
-
-        if execErr != nil {
-                log.Printf("Direct upload failed, trying helper pod on node %s", info.nodeName)
-                ex := c.getExecutor()
-                helperName, helperErr := ex.createHelperPod(ctx, namespace, pvcName, info.volumeName, info.nodeName)
-                if helperErr != nil {
-                        return fmt.Errorf("upload failed: %v", execErr)
-                }
-                defer func() {
-                        go ex.deleteHelperPod(context.Background(), namespace, helperName)
-                }()
-
-                helperPath := "/data/" + destPath
-                exec, execErr = c.execInPodWithContainer(ctx, namespace, helperName, "helper", &corev1.PodExecOptions{
-                        Command: []string{"tee", helperPath},
-                        Stdin:   true,
-                        Stdout:  true,
-                        Stderr:  true,
-                })
-                if execErr != nil {
-                        return fmt.Errorf("upload failed even with helper pod: %v", execErr)
-                }
+        if err != nil {
+                return "", err
         }
 
+        if stdout == nil {
+                stdout = io.Discard
+        }
         var stderr bytes.Buffer
         err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-                Stdin:  data,
-                Stdout: io.Discard,
+                Stdin:  stdin,
+                Stdout: stdout,
                 Stderr: &stderr,
         })
-        if err != nil {
-                if stderr.Len() > 0 {
-                        return fmt.Errorf("failed to upload file: %w: %s", err, stderr.String())
-                }
-                return fmt.Errorf("failed to upload file: %w", err)
-        }
-
-        return nil
+        return stderr.String(), err
 }
+
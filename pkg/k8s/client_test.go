@@ -1,10 +1,14 @@
 package k8s
 
 import (
+        "archive/tar"
+        "bytes"
         "context"
         "errors"
         "fmt"
+        "io"
         "os"
+        "strings"
         "testing"
         "time"
 
@@ -58,40 +62,73 @@ func runningPodWithPVC(pvcName string) *corev1.Pod {
         }
 }
 
-func TestTryListFilesGNUlsSucceeds(t *testing.T) {
-        stdout := `total 4
--rw-r--r-- 1 root root 42 2024-01-15 10:30 hello.txt`
+// findPrintfRecord is one entry as find -printf findPrintfFormat prints it.
+func findPrintfRecord(kind, mode, size, name, target string) string {
+        return strings.Join([]string{kind, mode, size, "1705314600.5000000000", "0", "0", name, target}, "\x00") + "\x00"
+}
+
+// failNulListings makes the find listing methods fail the way they do in
+// an image whose find has no -printf and that has no stat, so the shell
+// listing gets to run.
+func failNulListings(mock *mockPodExecutor) {
+        exitErr := fmt.Errorf("command terminated with exit code 1")
+        mock.pushExec("", "find: unrecognized: -printf", exitErr)
+        mock.pushExec("", "sh: stat: not found", exitErr)
+}
+
+func TestTryListFilesFindPrintfSucceeds(t *testing.T) {
         mock := &mockPodExecutor{}
-        mock.pushExec(stdout, "", nil)
+        mock.pushExec(findPrintfRecord("f", "-rw-r--r--", "42", "two  spaces\tand\nnewline.txt", "")+
+                findPrintfRecord("l", "lrwxrwxrwx", "7", "current", "v2 -> v3"), "", nil)
         c := newMockClient(mock)
         files, err := c.tryListFiles(context.Background(), "ns", "pod", "container", "/data", "/")
         if err != nil {
                 t.Fatalf("unexpected error: %v", err)
         }
-        if len(files) != 1 {
-                t.Errorf("expected 1 file, got %d", len(files))
+        if len(files) != 2 || files[0].Name != "two  spaces\tand\nnewline.txt" || files[1].LinkTarget != "v2 -> v3" {
+                t.Errorf("unexpected files: %+v", files)
         }
-        if files[0].Name != "hello.txt" {
-                t.Errorf("expected name 'hello.txt', got %q", files[0].Name)
+        if len(mock.execCalls) != 1 {
+                t.Errorf("expected a single exec, got %d", len(mock.execCalls))
         }
 }
 
-func TestTryListFilesGNUlsFailsBusyboxSucceeds(t *testing.T) {
-        busyboxStdout := `total 4
--rw-r--r--    1 root     root           10 Jan 15 10:30 data.csv`
-        noShellErr := fmt.Errorf("command terminated with exit code 127")
-
+func TestTryListFilesStatBatchWithoutFindPrintf(t *testing.T) {
         mock := &mockPodExecutor{}
-        mock.pushExec("", "sh: ls: not found", noShellErr)
-        mock.pushExec(busyboxStdout, "", nil)
+        mock.pushExec("", "find: unrecognized: -printf", fmt.Errorf("command terminated with exit code 1"))
+        mock.pushExec("regular file|-rw-r--r--|10|1705314600|0|0\nsymbolic link|lrwxrwxrwx|4|1705314600|0|0\n\x00"+
+                "./a  b\x00\x00./ln\x00a  b\x00", "", nil)
         c := newMockClient(mock)
+        files, err := c.tryListFiles(context.Background(), "ns", "pod", "container", "/data", "/")
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if len(files) != 2 || files[0].Name != "a  b" || !files[1].Symlink || files[1].LinkTarget != "a  b" {
+                t.Errorf("unexpected files: %+v", files)
+        }
+        if cmd := mock.execCalls[1].cmd; cmd[2] != "sh" || cmd[6] != "/data/" {
+                t.Errorf("unexpected command: %q", cmd)
+        }
+}
 
+func TestTryListFilesShellWithoutFindOrStat(t *testing.T) {
+        mock := &mockPodExecutor{}
+        failNulListings(mock)
+        mock.pushExec(findPrintfRecord("f", "-rw-r--r--", "42", "-rw-r--r-- 1 0 0 9 fake", "")+
+                "p\x00prw-r--r--\x000\x00\x000\x000\x00no date\x00\x00", "", nil)
+        c := newMockClient(mock)
         files, err := c.tryListFiles(context.Background(), "ns", "pod", "container", "/data", "/")
         if err != nil {
                 t.Fatalf("unexpected error: %v", err)
         }
-        if len(files) != 1 || files[0].Name != "data.csv" {
-                t.Errorf("unexpected files: %v", files)
+        if len(files) != 2 || files[0].Name != "-rw-r--r-- 1 0 0 9 fake" || files[0].Size != "42" {
+                t.Fatalf("unexpected files: %+v", files)
+        }
+        if files[1].Name != "no date" || files[1].ModTime != "" {
+                t.Errorf("an entry whose mtime date -r could not tell should have none, got %+v", files[1])
+        }
+        if cmd := mock.execCalls[2].cmd; cmd[4] != shellListScript || cmd[6] != "/data/" {
+                t.Errorf("unexpected command: %q", cmd)
         }
 }
 
@@ -174,8 +211,7 @@ func TestTryListFilesPathNotFound(t *testing.T) {
 
 func TestListFilesDirectSucceeds(t *testing.T) {
         const pvcName = "my-pvc"
-        stdout := `total 4
--rw-r--r-- 1 root root 100 2024-01-15 10:30 direct.txt`
+        stdout := findPrintfRecord("f", "-rw-r--r--", "100", "direct.txt", "")
 
         fakeClient := fake.NewSimpleClientset(runningPodWithPVC(pvcName))
         mock := &mockPodExecutor{}
@@ -194,20 +230,32 @@ func TestListFilesDirectSucceeds(t *testing.T) {
         }
 }
 
+func TestListFilesListsThroughDirectoryLinks(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushExec("", "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        if _, err := c.ListFiles(context.Background(), "default", "my-pvc", "/current/"); err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        cmd := mock.execCalls[0].cmd
+        if got := cmd[3]; !strings.HasSuffix(got, "/current/") {
+                t.Errorf("listed %q; without the trailing slash find lists a link instead of its target", got)
+        }
+}
+
 func TestListFilesDirectFailsFallsBackToHelperPod(t *testing.T) {
         const pvcName = "my-pvc"
         noShellErr := fmt.Errorf("command terminated with exit code 127")
-        helperStdout := `total 4
--rw-r--r-- 1 root root 200 2024-01-15 10:30 from-helper.txt`
+        helperStdout := findPrintfRecord("f", "-rw-r--r--", "200", "from-helper.txt", "")
 
         fakeClient := fake.NewSimpleClientset(runningPodWithPVC(pvcName))
         mock := &mockPodExecutor{
                 createResult: "kube-browser-helper-abc",
         }
-        mock.pushExec("", "sh: ls: not found", noShellErr)
-        mock.pushExec("", "sh: ls: not found", noShellErr)
         mock.pushExec("", "sh: find: not found", noShellErr)
         mock.pushExec("", "sh: find: not found", noShellErr)
+        mock.pushExec("", "sh: ls: not found", noShellErr)
         mock.pushExec(helperStdout, "", nil)
 
         c := &Client{clientset: fakeClient, executor: mock}
@@ -231,6 +279,28 @@ func TestListFilesDirectFailsFallsBackToHelperPod(t *testing.T) {
         }
 }
 
+func TestListFilesFilesystemErrorSkipsHelperPod(t *testing.T) {
+        const pvcName = "my-pvc"
+        ioErr := fmt.Errorf("command terminated with exit code 1")
+
+        fakeClient := fake.NewSimpleClientset(runningPodWithPVC(pvcName))
+        mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+        mock.pushExec("", "find: '/data/': Input/output error", ioErr)
+
+        c := &Client{clientset: fakeClient, executor: mock}
+        _, err := c.ListFiles(context.Background(), "default", pvcName, "/")
+        var k8sErr *K8sError
+        if !errors.As(err, &k8sErr) || k8sErr.Kind != ErrKindIOError {
+                t.Fatalf("expected IOError, got %v", err)
+        }
+        if mock.createCalled != 0 {
+                t.Errorf("expected no helper pod for a failing volume, got %d", mock.createCalled)
+        }
+        if len(mock.execCalls) != 1 {
+                t.Errorf("expected the other listing methods to be skipped, got %d exec calls", len(mock.execCalls))
+        }
+}
+
 func TestListFilesDirectFailsHelperPodCreateFails(t *testing.T) {
         const pvcName = "my-pvc"
         noShellErr := fmt.Errorf("command terminated with exit code 127")
@@ -240,10 +310,9 @@ func TestListFilesDirectFailsHelperPodCreateFails(t *testing.T) {
         mock := &mockPodExecutor{
                 createErr: rbacErr,
         }
-        mock.pushExec("", "sh: ls: not found", noShellErr)
-        mock.pushExec("", "sh: ls: not found", noShellErr)
         mock.pushExec("", "sh: find: not found", noShellErr)
         mock.pushExec("", "sh: find: not found", noShellErr)
+        mock.pushExec("", "sh: ls: not found", noShellErr)
 
         c := &Client{clientset: fakeClient, executor: mock}
         _, err := c.ListFiles(context.Background(), "default", pvcName, "/")
@@ -340,3 +409,295 @@ func TestCreateHelperPodRunning(t *testing.T) {
                 t.Error("expected non-empty helper pod name")
         }
 }
+
+func TestCreateHelperPodPriorityAndDeadline(t *testing.T) {
+        t.Setenv("HELPER_STARTUP_TIMEOUT_SEC", "1")
+        t.Setenv("KUBE_BROWSER_PRIORITY_CLASS", "kube-browser-helper")
+        t.Setenv("KUBE_BROWSER_HELPER_ACTIVE_DEADLINE_SEC", "600")
+
+        fakeClient := fake.NewSimpleClientset()
+        var created *corev1.Pod
+        fakeClient.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+                created = action.(ktesting.CreateAction).GetObject().(*corev1.Pod)
+                return false, nil, nil
+        })
+        fakeClient.PrependReactor("get", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+                return true, &corev1.Pod{
+                        ObjectMeta: metav1.ObjectMeta{Name: action.(ktesting.GetAction).GetName()},
+                        Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+                }, nil
+        })
+
+        c := &Client{clientset: fakeClient}
+        if _, err := c.createHelperPod(context.Background(), "default", "my-pvc", "vol", "node1"); err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if created == nil {
+                t.Fatal("helper pod was not created")
+        }
+        if created.Spec.PriorityClassName != "kube-browser-helper" {
+                t.Errorf("PriorityClassName = %q, want kube-browser-helper", created.Spec.PriorityClassName)
+        }
+        if created.Spec.ActiveDeadlineSeconds == nil || *created.Spec.ActiveDeadlineSeconds != 600 {
+                t.Errorf("ActiveDeadlineSeconds = %v, want 600", created.Spec.ActiveDeadlineSeconds)
+        }
+}
+
+func TestHelperActiveDeadline(t *testing.T) {
+        for _, v := range []string{"", "0", "-5", "ten"} {
+                t.Setenv("KUBE_BROWSER_HELPER_ACTIVE_DEADLINE_SEC", v)
+                if got := helperActiveDeadline(); got != nil {
+                        t.Errorf("helperActiveDeadline(%q) = %d, want nil", v, *got)
+                }
+        }
+}
+
+func TestListFilesHelperDisabledInMinimalMode(t *testing.T) {
+        const pvcName = "my-pvc"
+        noShellErr := fmt.Errorf("command terminated with exit code 127")
+
+        fakeClient := fake.NewSimpleClientset(runningPodWithPVC(pvcName))
+        mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+        mock.pushExec("", "sh: find: not found", noShellErr)
+        mock.pushExec("", "sh: find: not found", noShellErr)
+        mock.pushExec("", "sh: ls: not found", noShellErr)
+
+        c := &Client{clientset: fakeClient, executor: mock}
+        c.DisableHelperPods()
+        _, err := c.ListFiles(context.Background(), "default", pvcName, "/")
+        var k8sErr *K8sError
+        if !errors.As(err, &k8sErr) {
+                t.Fatalf("expected *K8sError, got %T: %v", err, err)
+        }
+        if k8sErr.Kind != ErrKindHelperDisabled {
+                t.Errorf("expected HelperDisabled kind, got %q", k8sErr.Kind)
+        }
+        if mock.createCalled != 0 {
+                t.Errorf("expected no helper pod creation in minimal mode, got %d", mock.createCalled)
+        }
+}
+
+func TestReadFileHead(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushExec("0123456789", "", nil)
+        mock.pushExec("short", "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        data, truncated, err := c.ReadFileHead(context.Background(), "default", "my-pvc", "/docs/README.md", 4)
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if string(data) != "0123" || !truncated {
+                t.Errorf("got %q (truncated=%v), want \"0123\" truncated", data, truncated)
+        }
+        if got := strings.Join(mock.execCalls[0].cmd, " "); got != "head -c 5 -- /data/docs/README.md" {
+                t.Errorf("unexpected command: %s", got)
+        }
+
+        data, truncated, err = c.ReadFileHead(context.Background(), "default", "my-pvc", "/notes.txt", 10)
+        if err != nil || string(data) != "short" || truncated {
+                t.Errorf("got %q (truncated=%v, err=%v)", data, truncated, err)
+        }
+}
+
+func TestDownloadFileStreams(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushStream(tarFile(t, "app.log", "file contents", 0), "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        reader, name, err := c.DownloadFile(context.Background(), "default", "my-pvc", "/logs/app.log")
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        defer reader.Close()
+        data, err := io.ReadAll(reader)
+        if err != nil || string(data) != "file contents" || name != "app.log" {
+                t.Errorf("got %q (%s, err=%v)", data, name, err)
+        }
+        if got := strings.Join(mock.streamCalls[0].cmd, " "); got != "tar -chf - -C /data/logs -- app.log" {
+                t.Errorf("unexpected command: %s", got)
+        }
+        hdr := reader.(FileHeader).Header()
+        if hdr == nil || hdr.Size != 13 || hdr.Mode != 0o640 || !hdr.ModTime.Equal(time.Unix(1700000000, 0)) {
+                t.Errorf("expected the file's metadata, got %+v", hdr)
+        }
+}
+
+func TestDownloadFileNoFallbackAfterPartialOutput(t *testing.T) {
+        mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+        mock.pushStream(tarFile(t, "big.bin", "first half", 20), "tar: big.bin: Read error: Permission denied", fmt.Errorf("command terminated with exit code 1"))
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        reader, _, err := c.DownloadFile(context.Background(), "default", "my-pvc", "/big.bin")
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        defer reader.Close()
+        data, err := io.ReadAll(reader)
+        if err == nil {
+                t.Fatalf("expected the stream to fail, got %q", data)
+        }
+        if string(data) != "first half" {
+                t.Errorf("expected only the bytes sent before the failure, got %q", data)
+        }
+        if mock.createCalled != 0 {
+                t.Error("must not restart a download in a helper pod once bytes were sent")
+        }
+}
+
+func TestDownloadFileDetectsTruncation(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushStream(tarFile(t, "big.bin", "first half", 20), "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        reader, _, err := c.DownloadFile(context.Background(), "default", "my-pvc", "/big.bin")
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        defer reader.Close()
+        data, err := io.ReadAll(reader)
+        if err == nil || !strings.Contains(err.Error(), "ended after 10 of 20 bytes") {
+                t.Errorf("expected a short stream to fail even though the exec succeeded, got %q, %v", data, err)
+        }
+}
+
+func TestDownloadFileRejectsDirectories(t *testing.T) {
+        var buf bytes.Buffer
+        tw := tar.NewWriter(&buf)
+        tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "logs/", Mode: 0o755})
+        tw.Close()
+        mock := &mockPodExecutor{}
+        mock.pushStream(buf.String(), "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        reader, _, _ := c.DownloadFile(context.Background(), "default", "my-pvc", "/logs")
+        defer reader.Close()
+        if _, err := io.ReadAll(reader); err == nil || !strings.Contains(err.Error(), "is a directory") {
+                t.Errorf("expected a directory to be refused, got %v", err)
+        }
+}
+
+func TestUploadFileFramesKnownSizeAsTar(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushStream("", "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        content := "\x00\xff\r\n binary"
+        src := &UploadSource{Reader: strings.NewReader(content), Size: int64(len(content)), ModTime: time.Unix(1700000000, 0)}
+        if err := c.UploadFile(context.Background(), "default", "my-pvc", "/in box/photo.jpg", src); err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if got := strings.Join(mock.streamCalls[0].cmd, " "); got != "tar -xof - -C /data/in box -- photo.jpg" {
+                t.Errorf("unexpected command: %s", got)
+        }
+        tr := tar.NewReader(bytes.NewReader(mock.streamStdin[0]))
+        hdr, err := tr.Next()
+        if err != nil {
+                t.Fatal(err)
+        }
+        body, _ := io.ReadAll(tr)
+        if hdr.Name != "photo.jpg" || string(body) != content || !hdr.ModTime.Equal(time.Unix(1700000000, 0)) {
+                t.Errorf("unexpected entry %+v with %q", hdr, body)
+        }
+        if _, err := tr.Next(); err != io.EOF {
+                t.Errorf("expected a single entry, got %v", err)
+        }
+}
+
+func TestUploadFileRejectsSizeMismatch(t *testing.T) {
+        for _, tc := range []struct {
+                content string
+                want    string
+        }{
+                {"short", "ended after 5 of 8 bytes"},
+                {"too long!", "longer than the 8 bytes announced"},
+        } {
+                mock := &mockPodExecutor{}
+                mock.pushStream("", "", nil)
+                mock.pushExec("", "", nil)
+                c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+                src := &UploadSource{Reader: strings.NewReader(tc.content), Size: 8}
+                err := c.UploadFile(context.Background(), "default", "my-pvc", "/f.bin", src)
+                if err == nil || !strings.Contains(err.Error(), tc.want) {
+                        t.Errorf("%q: expected %q, got %v", tc.content, tc.want, err)
+                }
+                c.cleanupWorker().Drain(context.Background())
+                if len(mock.execCalls) != 1 || mock.execCalls[0].cmd[0] != "rm" {
+                        t.Errorf("%q: expected the file to be removed, got %+v", tc.content, mock.execCalls)
+                }
+        }
+}
+
+func TestUploadFileStreamsIntoTee(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushStream("", "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        if err := c.UploadFile(context.Background(), "default", "my-pvc", "/in box/photo.jpg", strings.NewReader("\xff\xd8 jpeg")); err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if got := strings.Join(mock.streamCalls[0].cmd, " "); got != "tee -- /data/in box/photo.jpg" {
+                t.Errorf("unexpected command: %s", got)
+        }
+        if string(mock.streamStdin[0]) != "\xff\xd8 jpeg" {
+                t.Errorf("unexpected stdin %q", mock.streamStdin[0])
+        }
+}
+
+func TestUploadFileRemovesPartialFile(t *testing.T) {
+        mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+        mock.pushStream("", "tee: write error: No space left on device", fmt.Errorf("command terminated with exit code 1"))
+        mock.pushExec("", "", nil)
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        err := c.UploadFile(context.Background(), "default", "my-pvc", "/big.bin", strings.NewReader("first half"))
+        if err == nil {
+                t.Fatal("expected the upload to fail")
+        }
+        if mock.createCalled != 0 {
+                t.Error("must not restart an upload in a helper pod once bytes were sent")
+        }
+        if err := c.cleanupWorker().Drain(context.Background()); err != nil {
+                t.Fatal(err)
+        }
+        if len(mock.execCalls) != 1 || strings.Join(mock.execCalls[0].cmd, " ") != "rm -f -- /data/big.bin" {
+                t.Errorf("expected the partial file to be removed, got %+v", mock.execCalls)
+        }
+}
+
+func TestDownloadFileMissingPathFailsOnRead(t *testing.T) {
+        mock := &mockPodExecutor{}
+        mock.pushStream("", "cat: /data/nope: No such file or directory", fmt.Errorf("command terminated with exit code 1"))
+        c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+        reader, _, err := c.DownloadFile(context.Background(), "default", "my-pvc", "/nope")
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        defer reader.Close()
+        _, err = reader.Read(make([]byte, 1))
+        var k8sErr *K8sError
+        if !errors.As(err, &k8sErr) || k8sErr.Kind != ErrKindPathNotFound {
+                t.Errorf("expected PathNotFound, got %v", err)
+        }
+}
+
+// tarFile is what tar -c sends for a single file. A size above
+// len(content) produces a stream cut off partway through the file.
+func tarFile(t *testing.T, name, content string, size int64) string {
+        t.Helper()
+        if size == 0 {
+                size = int64(len(content))
+        }
+        var buf bytes.Buffer
+        tw := tar.NewWriter(&buf)
+        if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o640, ModTime: time.Unix(1700000000, 0)}); err != nil {
+                t.Fatal(err)
+        }
+        tw.Write([]byte(content))
+        if int64(len(content)) == size {
+                tw.Close()
+        }
+        return buf.String()
+}
@@ -0,0 +1,207 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// clonedFromAnnotation marks a PVC created by ClonePVC with its source, as
+// "<namespace>/<pvc>", so a resumed clone reuses it. It is an annotation
+// because the value can exceed the 63-character limit of labels.
+const clonedFromAnnotation = "kube-browser/cloned-from"
+
+const (
+	// CloneConflictFail refuses to clone onto an existing claim name.
+	CloneConflictFail = "fail"
+	// CloneConflictRename picks the first free "<name>-clone[-N]".
+	CloneConflictRename = "rename"
+)
+
+// CloneRequest copies a PVC (spec and data) into another namespace.
+// TargetName defaults to the source name, StorageClass to the source's
+// class and OnConflict to CloneConflictFail.
+type CloneRequest struct {
+	Namespace       string `json:"namespace"`
+	PVC             string `json:"pvc"`
+	TargetNamespace string `json:"targetNamespace"`
+	TargetName      string `json:"targetName,omitempty"`
+	StorageClass    string `json:"storageClass,omitempty"`
+	OnConflict      string `json:"onConflict,omitempty"`
+}
+
+func (r CloneRequest) Validate() error {
+	if r.Namespace == "" || r.PVC == "" || r.TargetNamespace == "" {
+		return fmt.Errorf("namespace, pvc and targetNamespace are required")
+	}
+	switch r.OnConflict {
+	case "", CloneConflictFail, CloneConflictRename:
+	default:
+		return fmt.Errorf("onConflict must be %q or %q", CloneConflictFail, CloneConflictRename)
+	}
+	name := r.TargetName
+	if name == "" {
+		name = r.PVC
+	}
+	if r.TargetNamespace == r.Namespace && name == r.PVC && r.OnConflict != CloneConflictRename {
+		return fmt.Errorf("the clone needs a different namespace or name")
+	}
+	return nil
+}
+
+// CloneResult describes the claim a clone produced.
+type CloneResult struct {
+	Target       PVCRef `json:"target"`
+	Renamed      bool   `json:"renamed"`
+	StorageClass string `json:"storageClass"`
+	Size         string `json:"size"`
+}
+
+func (r CloneRequest) source() string {
+	return r.Namespace + "/" + r.PVC
+}
+
+// ClonePVC creates a copy of a claim's spec in the target namespace and
+// streams its data across with CopyBetweenPVCs. A claim it created is
+// deleted again if the copy fails; one left behind by an interrupted clone
+// is reused, and only files missing or different on it are sent again.
+func (c *Client) ClonePVC(ctx context.Context, req CloneRequest, progress func(int64)) (*CloneResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.inScope(req.Namespace, req.TargetNamespace); err != nil {
+		return nil, err
+	}
+	if req.TargetName == "" {
+		req.TargetName = req.PVC
+	}
+
+	src, err := c.clientset.CoreV1().PersistentVolumeClaims(req.Namespace).Get(ctx, req.PVC, metav1.GetOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	storageClass := req.StorageClass
+	if storageClass == "" && src.Spec.StorageClassName != nil {
+		storageClass = *src.Spec.StorageClassName
+	}
+	size, err := migrationSize(src, "")
+	if err != nil {
+		return nil, err
+	}
+
+	name, existing, renamed, err := c.cloneTargetName(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	result := &CloneResult{
+		Target:       PVCRef{Namespace: req.TargetNamespace, PVC: name},
+		Renamed:      renamed,
+		StorageClass: storageClass,
+		Size:         size.String(),
+	}
+
+	if !existing {
+		target := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   req.TargetNamespace,
+				Labels:      cloneLabels(src.Labels),
+				Annotations: map[string]string{clonedFromAnnotation: req.source()},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: src.Spec.AccessModes,
+				VolumeMode:  src.Spec.VolumeMode,
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+				},
+			},
+		}
+		if storageClass != "" {
+			target.Spec.StorageClassName = &storageClass
+		}
+		log.Printf("Creating clone %s/%s of %s/%s (%s, %s)", req.TargetNamespace, name, req.Namespace, req.PVC, storageClass, size.String())
+		if _, err := c.clientset.CoreV1().PersistentVolumeClaims(req.TargetNamespace).Create(ctx, target, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsForbidden(err) {
+				return nil, &K8sError{Kind: ErrKindRBAC, Message: fmt.Sprintf("Permission denied: your kubeconfig cannot create persistentvolumeclaims in %s.", req.TargetNamespace), Cause: err}
+			}
+			return nil, classifyApiError(err)
+		}
+		c.noteClaimCreated(req.TargetNamespace, name)
+	}
+
+	source := PVCRef{Namespace: req.Namespace, PVC: req.PVC}
+	if existing {
+		_, err = c.resumeCopy(ctx, source, []string{"/"}, result.Target, "/", progress)
+	} else {
+		err = c.CopyBetweenPVCs(ctx, source, []string{"/"}, result.Target, "/", progress)
+	}
+	if err != nil {
+		if !existing {
+			c.deleteClaim(req.TargetNamespace, name, "after a failed clone")
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// cloneTargetName resolves name collisions in the target namespace. A claim
+// already labeled as a clone of the same source is reused (existing=true),
+// which makes an interrupted clone resumable.
+func (c *Client) cloneTargetName(ctx context.Context, req CloneRequest) (name string, existing, renamed bool, err error) {
+	pvcs := c.clientset.CoreV1().PersistentVolumeClaims(req.TargetNamespace)
+	candidates := []string{req.TargetName}
+	if req.OnConflict == CloneConflictRename {
+		candidates = append(candidates, req.TargetName+"-clone")
+		for i := 2; i <= 20; i++ {
+			candidates = append(candidates, fmt.Sprintf("%s-clone-%d", req.TargetName, i))
+		}
+	}
+	for i, candidate := range candidates {
+		if req.TargetNamespace == req.Namespace && candidate == req.PVC {
+			continue
+		}
+		pvc, err := pvcs.Get(ctx, candidate, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return candidate, false, i > 0, nil
+		}
+		if err != nil {
+			return "", false, false, classifyApiError(err)
+		}
+		if pvc.Annotations[clonedFromAnnotation] == req.source() {
+			return candidate, true, i > 0, nil
+		}
+	}
+	if req.OnConflict == CloneConflictRename {
+		return "", false, false, fmt.Errorf("no free name for the clone of %s in %s", req.PVC, req.TargetNamespace)
+	}
+	return "", false, false, fmt.Errorf("PVC %s already exists in %s; choose another name or rename on conflict", req.TargetName, req.TargetNamespace)
+}
+
+// cloneLabels copies the source labels, minus ones that tie a claim to a
+// specific workload instance or to KubeBrowser's own bookkeeping.
+func cloneLabels(src map[string]string) map[string]string {
+	labels := map[string]string{"managed-by": "kube-browser"}
+	for k, v := range src {
+		if strings.HasPrefix(k, "kube-browser/") || k == "statefulset.kubernetes.io/pod-name" {
+			continue
+		}
+		labels[k] = v
+	}
+	return labels
+}
+
+// deleteClaim removes a claim KubeBrowser created for an operation;
+// reason says when, for the log should it fail.
+func (c *Client) deleteClaim(namespace, name, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Failed to delete PVC %s/%s %s: %v", namespace, name, reason, err)
+	}
+}
@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func cloneFixtures(extra ...runtime.Object) *fake.Clientset {
+	class := "standard"
+	src := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-pvc", Namespace: "default",
+			Labels: map[string]string{"app": "db", "statefulset.kubernetes.io/pod-name": "db-0"},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &class,
+			VolumeName:       "pv-123",
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")},
+		},
+	}
+	return fake.NewSimpleClientset(append([]runtime.Object{src, runningPodWithPVC("my-pvc")}, extra...)...)
+}
+
+func TestClonePVC(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "helper-1"}
+	mock.pushStream("data", "", nil)
+	mock.pushStream("data", "", nil)
+	cs := cloneFixtures()
+	c := &Client{clientset: cs, executor: mock}
+
+	result, err := c.ClonePVC(context.Background(), CloneRequest{Namespace: "default", PVC: "my-pvc", TargetNamespace: "perf", StorageClass: "fast"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Target != (PVCRef{Namespace: "perf", PVC: "my-pvc"}) || result.Renamed || result.StorageClass != "fast" || result.Size != "2Gi" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	clone, err := cs.CoreV1().PersistentVolumeClaims("perf").Get(context.Background(), "my-pvc", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("clone not created: %v", err)
+	}
+	if *clone.Spec.StorageClassName != "fast" || clone.Spec.VolumeName != "" || clone.Annotations[clonedFromAnnotation] != "default/my-pvc" {
+		t.Errorf("unexpected clone spec: %+v", clone)
+	}
+	if clone.Labels["app"] != "db" || clone.Labels["statefulset.kubernetes.io/pod-name"] != "" {
+		t.Errorf("unexpected clone labels: %v", clone.Labels)
+	}
+
+	// Nothing mounts the new claim, so the data goes through a helper pod.
+	if mock.createCalled != 1 {
+		t.Errorf("expected one helper pod for the clone, got %d", mock.createCalled)
+	}
+	toHelper := false
+	for _, call := range mock.streamCalls {
+		if call.podName == "helper-1" && call.namespace == "perf" {
+			toHelper = true
+		}
+	}
+	if !toHelper {
+		t.Errorf("data was not streamed into the helper pod: %+v", mock.streamCalls)
+	}
+}
+
+func TestClonePVCNameConflict(t *testing.T) {
+	taken := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "my-pvc", Namespace: "perf"}}
+
+	c := &Client{clientset: cloneFixtures(taken), executor: &mockPodExecutor{}}
+	if _, err := c.ClonePVC(context.Background(), CloneRequest{Namespace: "default", PVC: "my-pvc", TargetNamespace: "perf"}, nil); err == nil {
+		t.Fatal("expected a name conflict error")
+	}
+
+	mock := &mockPodExecutor{createResult: "helper-1"}
+	mock.pushStream("", "", nil)
+	mock.pushStream("", "", nil)
+	c = &Client{clientset: cloneFixtures(taken), executor: mock}
+	result, err := c.ClonePVC(context.Background(), CloneRequest{Namespace: "default", PVC: "my-pvc", TargetNamespace: "perf", OnConflict: CloneConflictRename}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Target.PVC != "my-pvc-clone" || !result.Renamed {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestClonePVCRemovesClaimOnFailure(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "helper-1"}
+	mock.pushStream("", "", errors.New("boom"))
+	mock.pushStream("", "", errors.New("boom"))
+	cs := cloneFixtures()
+	c := &Client{clientset: cs, executor: mock}
+
+	if _, err := c.ClonePVC(context.Background(), CloneRequest{Namespace: "default", PVC: "my-pvc", TargetNamespace: "perf"}, nil); err == nil {
+		t.Fatal("expected copy failure")
+	}
+	if _, err := cs.CoreV1().PersistentVolumeClaims("perf").Get(context.Background(), "my-pvc", metav1.GetOptions{}); err == nil {
+		t.Error("claim created for a failed clone was not deleted")
+	}
+}
+
+func TestCloneRequestValidate(t *testing.T) {
+	for _, req := range []CloneRequest{
+		{Namespace: "a", PVC: "p"},
+		{Namespace: "a", PVC: "p", TargetNamespace: "a"},
+		{Namespace: "a", PVC: "p", TargetNamespace: "b", OnConflict: "overwrite"},
+	} {
+		if err := req.Validate(); err == nil {
+			t.Errorf("%+v: expected error", req)
+		}
+	}
+	if err := (CloneRequest{Namespace: "a", PVC: "p", TargetNamespace: "a", TargetName: "q"}).Validate(); err != nil {
+		t.Errorf("same-namespace clone with a new name rejected: %v", err)
+	}
+}
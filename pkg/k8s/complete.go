@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"context"
+	gopath "path"
+	"sort"
+	"strings"
+)
+
+// PathCompletion is the result of completing a partially typed remote path.
+// Common is the longest prefix shared by every match, i.e. what pressing
+// Tab once should expand the input to.
+type PathCompletion struct {
+	Dir     string     `json:"dir"`
+	Matches []FileInfo `json:"matches"`
+	Common  string     `json:"common"`
+}
+
+// splitCompletionPrefix splits "/a/b/pa" into the directory to list ("/a/b")
+// and the partial name to match ("pa"). A trailing slash means "everything
+// in this directory".
+func splitCompletionPrefix(prefix string) (string, string) {
+	prefix = strings.ReplaceAll(prefix, "\\", "/")
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	i := strings.LastIndex(prefix, "/")
+	dir, partial := prefix[:i+1], prefix[i+1:]
+	return gopath.Clean(dir), partial
+}
+
+// CompletePath lists the directory part of prefix and returns the entries
+// whose name starts with the last path segment, directories first. Hidden
+// entries are only offered when the segment itself starts with a dot, as
+// shells do.
+func (c *Client) CompletePath(ctx context.Context, namespace, pvcName, prefix string) (*PathCompletion, error) {
+	return CompleteFromListing(prefix, func(dir string) ([]FileInfo, error) {
+		return c.ListFiles(ctx, namespace, pvcName, dir)
+	})
+}
+
+// CompleteFromListing completes prefix against list's entries for its
+// directory part, for connections that complete by listing rather than in
+// a shell.
+func CompleteFromListing(prefix string, list func(dir string) ([]FileInfo, error)) (*PathCompletion, error) {
+	dir, partial := splitCompletionPrefix(prefix)
+	files, err := list(dir)
+	if err != nil {
+		return nil, err
+	}
+	return completeFromListing(dir, partial, files), nil
+}
+
+func completeFromListing(dir, partial string, files []FileInfo) *PathCompletion {
+	matches := []FileInfo{}
+	for _, f := range files {
+		if f.Name == "." || f.Name == ".." {
+			continue
+		}
+		if strings.HasPrefix(f.Name, ".") && !strings.HasPrefix(partial, ".") {
+			continue
+		}
+		if strings.HasPrefix(f.Name, partial) {
+			matches = append(matches, f)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].IsDir != matches[j].IsDir {
+			return matches[i].IsDir
+		}
+		return matches[i].Name < matches[j].Name
+	})
+
+	base := strings.TrimSuffix(dir, "/") + "/"
+	result := &PathCompletion{Dir: dir, Matches: matches, Common: base + partial}
+	if len(matches) == 0 {
+		return result
+	}
+	common := matches[0].Name
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m.Name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	result.Common = base + common
+	if len(matches) == 1 && matches[0].IsDir {
+		result.Common += "/"
+	}
+	return result
+}
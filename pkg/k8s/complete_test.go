@@ -0,0 +1,58 @@
+package k8s
+
+import "testing"
+
+func TestSplitCompletionPrefix(t *testing.T) {
+	tests := []struct {
+		prefix, dir, partial string
+	}{
+		{"", "/", ""},
+		{"/", "/", ""},
+		{"/da", "/", "da"},
+		{"/data/", "/data", ""},
+		{"/data/lo", "/data", "lo"},
+		{"data\\lo", "/data", "lo"},
+	}
+	for _, tt := range tests {
+		dir, partial := splitCompletionPrefix(tt.prefix)
+		if dir != tt.dir || partial != tt.partial {
+			t.Errorf("splitCompletionPrefix(%q) = (%q, %q), want (%q, %q)", tt.prefix, dir, partial, tt.dir, tt.partial)
+		}
+	}
+}
+
+func TestCompleteFromListing(t *testing.T) {
+	files := []FileInfo{
+		{Name: "logs-old.txt"},
+		{Name: "logs", IsDir: true},
+		{Name: "logstash", IsDir: true},
+		{Name: ".logrc"},
+		{Name: "data", IsDir: true},
+	}
+
+	got := completeFromListing("/var", "lo", files)
+	if len(got.Matches) != 3 {
+		t.Fatalf("expected 3 matches, got %v", got.Matches)
+	}
+	if got.Matches[0].Name != "logs" || got.Matches[1].Name != "logstash" || got.Matches[2].Name != "logs-old.txt" {
+		t.Errorf("expected directories first, got %v", got.Matches)
+	}
+	if got.Common != "/var/logs" {
+		t.Errorf("expected common prefix /var/logs, got %q", got.Common)
+	}
+
+	single := completeFromListing("/", "da", files)
+	if single.Common != "/data/" {
+		t.Errorf("expected unique directory match to complete with a slash, got %q", single.Common)
+	}
+
+	hidden := completeFromListing("/", ".", files)
+	if len(hidden.Matches) != 1 || hidden.Matches[0].Name != ".logrc" {
+		t.Errorf("expected hidden entries when prefix starts with a dot, got %v", hidden.Matches)
+	}
+
+	none := completeFromListing("/", "zz", files)
+	if len(none.Matches) != 0 || none.Common != "/zz" {
+		t.Errorf("unexpected result for no matches: %+v", none)
+	}
+}
@@ -0,0 +1,331 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TransferCompression is how a download is compressed on its way out of
+// the pod, and how a copy or upload is compressed on its way in. Text
+// compresses several times over, which matters far more
+// than the CPU it costs when the cluster is at the other end of a slow
+// link.
+type TransferCompression string
+
+const (
+	CompressionNone TransferCompression = "none"
+	CompressionGzip TransferCompression = "gzip"
+	CompressionZstd TransferCompression = "zstd"
+)
+
+// transferCompressionEnv sets the compression of transfers that do not
+// ask for one.
+const transferCompressionEnv = "KUBE_BROWSER_TRANSFER_COMPRESSION"
+
+// ParseTransferCompression reads "none", "gzip" or "zstd"; empty is none.
+func ParseTransferCompression(s string) (TransferCompression, error) {
+	switch c := TransferCompression(strings.ToLower(strings.TrimSpace(s))); c {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return c, nil
+	}
+	return CompressionNone, fmt.Errorf("unknown compression %q; use none, gzip or zstd", s)
+}
+
+// DefaultTransferCompression returns the compression set by
+// KUBE_BROWSER_TRANSFER_COMPRESSION, none unless set.
+func DefaultTransferCompression() TransferCompression {
+	c, err := ParseTransferCompression(os.Getenv(transferCompressionEnv))
+	if err != nil {
+		log.Printf("Warning: invalid %s (%v); transfers are not compressed", transferCompressionEnv, err)
+	}
+	return c
+}
+
+type transferCompressionKey struct{}
+
+// WithTransferCompression returns a context under which copies between
+// claims and uploads are compressed with c rather than as
+// KUBE_BROWSER_TRANSFER_COMPRESSION says.
+func WithTransferCompression(ctx context.Context, c TransferCompression) context.Context {
+	return context.WithValue(ctx, transferCompressionKey{}, c)
+}
+
+// transferCompressionFrom returns the compression set on ctx, or the
+// default one.
+func transferCompressionFrom(ctx context.Context) TransferCompression {
+	if c, ok := ctx.Value(transferCompressionKey{}).(TransferCompression); ok {
+		return c
+	}
+	return DefaultTransferCompression()
+}
+
+// TransferInfo is implemented by the readers DownloadFile returns. Once
+// the first Read has returned, Compression is how the file crossed the
+// exec stream, which can be less than asked for when the pod lacks the
+// tool.
+type TransferInfo interface {
+	Compression() TransferCompression
+}
+
+// compressScript runs "$@" with its output piped through the first
+// compressor of $1 the pod has, after a byte saying which: z for zstd, g
+// for gzip, n for none. The exit status is the command's, not the
+// compressor's, so a missing file still fails the exec.
+const compressScript = `prefs=$1; shift
+c=cat; m=n
+for p in $prefs; do
+  case $p in
+  zstd) if command -v zstd >/dev/null 2>&1; then c="zstd -q -c -3"; m=z; break; fi ;;
+  gzip) if command -v gzip >/dev/null 2>&1; then c="gzip -c -1"; m=g; break; fi ;;
+  esac
+done
+printf %s "$m"
+exec 4>&1
+s=$( { { "$@"; echo $? >&3; } | $c >&4; } 3>&1 )
+exit ${s:-1}`
+
+// compressedCommand wraps cmd so that its output is compressed with c, or
+// with gzip when c is zstd and the pod has no zstd, or not at all. Its
+// output must be read with decompressTransfer.
+func compressedCommand(cmd []string, c TransferCompression) []string {
+	prefs := ""
+	switch c {
+	case CompressionZstd:
+		prefs = "zstd gzip"
+	case CompressionGzip:
+		prefs = "gzip"
+	}
+	return append([]string{"sh", "-c", compressScript, "sh", prefs}, cmd...)
+}
+
+// decompressTransfer reads the output of a compressedCommand, returning
+// the command's own output and the compression it crossed the stream
+// with.
+func decompressTransfer(r io.Reader) (io.Reader, TransferCompression, error) {
+	br := bufio.NewReader(r)
+	marker, err := br.ReadByte()
+	if err == io.EOF {
+		return nil, CompressionNone, fmt.Errorf("the transfer ended before it started")
+	}
+	if err != nil {
+		return nil, CompressionNone, err
+	}
+	switch marker {
+	case 'z':
+		// With one decoder nothing is decoded asynchronously, so the
+		// reader, which is never closed, leaves no goroutines behind.
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, CompressionZstd, err
+		}
+		return zr, CompressionZstd, nil
+	case 'g':
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, CompressionGzip, err
+		}
+		return gz, CompressionGzip, nil
+	case 'n':
+		return br, CompressionNone, nil
+	}
+	return nil, CompressionNone, fmt.Errorf("unexpected transfer marker %q", marker)
+}
+
+// decompressScript runs "$@" with its input decompressed. It first prints
+// a line listing the decompressors the pod has (z for zstd, g for gzip),
+// then reads a byte saying how the rest of its input is compressed, as
+// compressScript prints it. A pod without dd cannot read that byte alone,
+// so it lists nothing and takes its input as is.
+const decompressScript = `t=
+if command -v dd >/dev/null 2>&1; then
+  command -v zstd >/dev/null 2>&1 && t=${t}z
+  command -v gzip >/dev/null 2>&1 && t=${t}g
+fi
+echo "$t"
+[ -n "$t" ] || exec "$@"
+m=$(dd bs=1 count=1 2>/dev/null)
+case $m in
+z) zstd -q -dc | "$@" ;;
+g) gzip -dc | "$@" ;;
+n) "$@" ;;
+*) echo "unexpected transfer marker" >&2; exit 1 ;;
+esac`
+
+// decompressedCommand wraps cmd so that its input can arrive compressed.
+// It must be run with the stdin and stdout of a compressingStdin.
+func decompressedCommand(cmd []string) []string {
+	return append([]string{"sh", "-c", decompressScript, "sh"}, cmd...)
+}
+
+// podTools is what a decompressedCommand said it can decompress, known
+// once ready is closed.
+type podTools struct {
+	ready chan struct{}
+	tools string
+}
+
+// toolsWriter takes the line listing the pod's tools off the front of a
+// decompressedCommand's output and passes the rest on to w.
+type toolsWriter struct {
+	w     io.Writer
+	found *podTools
+	line  []byte
+	done  bool
+}
+
+func (tw *toolsWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if !tw.done {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			if len(tw.line)+len(p) > 16 {
+				return 0, fmt.Errorf("unexpected output before the transfer: %q", append(tw.line, p...))
+			}
+			tw.line = append(tw.line, p...)
+			return n, nil
+		}
+		tw.line = append(tw.line, p[:i]...)
+		tw.found.tools = string(tw.line)
+		tw.done = true
+		close(tw.found.ready)
+		p = p[i+1:]
+	}
+	if len(p) > 0 {
+		if _, err := tw.w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// compressingReader is the stdin of a decompressedCommand. It waits for
+// the pod to list its tools, then sends data gzip-compressed if the pod
+// has gzip, and as is otherwise. Go has no zstd encoder, so gzip is used
+// for zstd too.
+type compressingReader struct {
+	ctx    context.Context
+	data   io.Reader
+	found  *podTools
+	closed chan struct{}
+	once   sync.Once
+	r      io.Reader
+
+	mu sync.Mutex
+	gz *io.PipeReader
+}
+
+// compressingStdin returns the stdin and stdout to run a
+// decompressedCommand with, feeding it data and passing its own output on
+// to stdout. The reader must be closed once the command is done.
+func compressingStdin(ctx context.Context, data io.Reader, stdout io.Writer) (*compressingReader, io.Writer) {
+	found := &podTools{ready: make(chan struct{})}
+	return &compressingReader{ctx: ctx, data: data, found: found, closed: make(chan struct{})},
+		&toolsWriter{w: stdout, found: found}
+}
+
+func (cr *compressingReader) Read(p []byte) (int, error) {
+	if cr.r == nil {
+		select {
+		case <-cr.found.ready:
+		case <-cr.closed:
+			return 0, io.ErrClosedPipe
+		case <-cr.ctx.Done():
+			return 0, cr.ctx.Err()
+		}
+		cr.r = cr.open(cr.found.tools)
+	}
+	return cr.r.Read(p)
+}
+
+func (cr *compressingReader) open(tools string) io.Reader {
+	switch {
+	case tools == "":
+		return cr.data
+	case !strings.Contains(tools, "g"):
+		return io.MultiReader(strings.NewReader("n"), cr.data)
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	pr, pw := io.Pipe()
+	cr.gz = pr
+	select {
+	case <-cr.closed:
+		pr.CloseWithError(io.ErrClosedPipe)
+		return pr
+	default:
+	}
+	go func() {
+		gz, _ := gzip.NewWriterLevel(pw, gzip.BestSpeed)
+		_, err := io.Copy(gz, cr.data)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return io.MultiReader(strings.NewReader("g"), pr)
+}
+
+// Close stops a Read still waiting for the pod, and the compression of
+// data if it started.
+func (cr *compressingReader) Close() error {
+	cr.once.Do(func() { close(cr.closed) })
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.gz != nil {
+		cr.gz.CloseWithError(io.ErrClosedPipe)
+	}
+	return nil
+}
+
+// streamCompressedOut is streamOnClaim with the command's output
+// compressed in the pod with compression, when the pod has the tool, and
+// decompressed into w.
+func (c *Client) streamCompressedOut(ctx context.Context, ref PVCRef, build func(mountPath string) []string, stdin io.Reader, w io.Writer, compression TransferCompression) error {
+	if compression == CompressionNone {
+		return c.streamOnClaim(ctx, ref, build, stdin, w)
+	}
+	raw, rawW := io.Pipe()
+	execErr := make(chan error, 1)
+	go func() {
+		err := c.streamOnClaim(ctx, ref, func(mountPath string) []string {
+			return compressedCommand(build(mountPath), compression)
+		}, stdin, rawW)
+		rawW.CloseWithError(err)
+		execErr <- err
+	}()
+	plain, _, err := decompressTransfer(raw)
+	if err == nil {
+		_, err = io.Copy(w, plain)
+	}
+	// Stops the exec if the output was abandoned early.
+	raw.CloseWithError(err)
+	if eerr := <-execErr; eerr != nil {
+		return eerr
+	}
+	return err
+}
+
+// streamCompressedIn is streamOnClaim with data sent gzip-compressed when
+// compression asks for it and the pod has gzip.
+func (c *Client) streamCompressedIn(ctx context.Context, ref PVCRef, build func(mountPath string) []string, data io.Reader, stdout io.Writer, compression TransferCompression) error {
+	if compression == CompressionNone {
+		return c.streamOnClaim(ctx, ref, build, data, stdout)
+	}
+	in, out := compressingStdin(ctx, data, stdout)
+	defer in.Close()
+	return c.streamOnClaim(ctx, ref, func(mountPath string) []string {
+		return decompressedCommand(build(mountPath))
+	}, in, out)
+}
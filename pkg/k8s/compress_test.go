@@ -0,0 +1,194 @@
+package k8s
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// zstdTar is tarFile(t, "app.log", "file contents", 0) as zstd -3 writes
+// it.
+const zstdTar = "28b52ffd6400072d0300c4036170702e6c6f670030303030363430303030303135003134353234373730343130353232002030757374617200303066696c6520636f6e74656e74730f0020811f48800200e881130c2698f501b04160ae04003068012f66b8a12c05265e114c4e800b19272b91"
+
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.String()
+}
+
+func TestDownloadFileCompressed(t *testing.T) {
+	zstdBytes, _ := hex.DecodeString(zstdTar)
+	for _, tc := range []struct {
+		name   string
+		asked  TransferCompression
+		stream string
+		prefs  string
+	}{
+		{"zstd", CompressionZstd, "z" + string(zstdBytes), "zstd gzip"},
+		{"gzip", CompressionGzip, "g" + gzipString(t, tarFile(t, "app.log", "file contents", 0)), "gzip"},
+		{"none", CompressionZstd, "n" + tarFile(t, "app.log", "file contents", 0), "zstd gzip"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &mockPodExecutor{}
+			mock.pushStream(tc.stream, "", nil)
+			c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+			reader, _, err := c.DownloadFileCompressed(context.Background(), "default", "my-pvc", "/logs/app.log", tc.asked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			if err != nil || string(data) != "file contents" {
+				t.Fatalf("got %q, %v", data, err)
+			}
+			if got := reader.(TransferInfo).Compression(); got != TransferCompression(tc.name) {
+				t.Errorf("expected the transfer to be reported as %s, got %s", tc.name, got)
+			}
+			cmd := mock.streamCalls[0].cmd
+			if cmd[0] != "sh" || cmd[4] != tc.prefs || strings.Join(cmd[5:], " ") != "tar -chf - -C /data/logs -- app.log" {
+				t.Errorf("unexpected command %q", cmd)
+			}
+		})
+	}
+}
+
+func TestDownloadFileCompressedMissingPath(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("g"+gzipString(t, ""), "tar: can't open 'nope': No such file or directory", fmt.Errorf("command terminated with exit code 2"))
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	reader, _, err := c.DownloadFileCompressed(context.Background(), "default", "my-pvc", "/nope", CompressionGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	_, err = reader.Read(make([]byte, 1))
+	var k8sErr *K8sError
+	if !errors.As(err, &k8sErr) || k8sErr.Kind != ErrKindPathNotFound {
+		t.Errorf("expected PathNotFound, got %v", err)
+	}
+}
+
+func TestParseTransferCompression(t *testing.T) {
+	for in, want := range map[string]TransferCompression{"": CompressionNone, "ZSTD": CompressionZstd, " gzip ": CompressionGzip} {
+		if got, err := ParseTransferCompression(in); err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s, %v", in, want, got, err)
+		}
+	}
+	if _, err := ParseTransferCompression("brotli"); err == nil {
+		t.Error("expected an unknown compression to be refused")
+	}
+}
+
+// localExecutor runs stream commands on this machine, with the pod's
+// /data mount at dir, so the scripts wrapping them are tested for real. It
+// records the most bytes one of them received and sent.
+type localExecutor struct {
+	mockPodExecutor
+	dir             string
+	mu              sync.Mutex
+	mostIn, mostOut int64
+}
+
+func (e *localExecutor) execInPodStream(ctx context.Context, _, _, _ string, cmd []string, stdin io.Reader, stdout io.Writer) (string, error) {
+	args := make([]string, len(cmd))
+	for i, a := range cmd {
+		if a == "/data" || strings.HasPrefix(a, "/data/") {
+			a = e.dir + strings.TrimPrefix(a, "/data")
+		}
+		args[i] = a
+	}
+	var stderr bytes.Buffer
+	in, out := &countingReader{r: stdin}, &countingWriter{w: stdout}
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdout, c.Stderr = out, &stderr
+	if stdin != nil {
+		c.Stdin = in
+	}
+	err := c.Run()
+	e.mu.Lock()
+	e.mostIn, e.mostOut = max(e.mostIn, in.n), max(e.mostOut, out.n)
+	e.mu.Unlock()
+	return stderr.String(), err
+}
+
+func TestCompressedCopyAndUpload(t *testing.T) {
+	for _, tool := range []string{"sh", "dd", "gzip", "zstd", "tar"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src", "logs"), 0o755)
+	content := strings.Repeat("GET /index.html 200\n", 1000)
+	os.WriteFile(filepath.Join(dir, "src", "logs", "access.log"), []byte(content), 0o644)
+	local := &localExecutor{dir: dir}
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: local}
+	ref := PVCRef{Namespace: "default", PVC: "my-pvc"}
+
+	ctx := WithTransferCompression(context.Background(), CompressionZstd)
+	var copied int64
+	if err := c.CopyBetweenPVCs(ctx, ref, []string{"/src/logs"}, ref, "/dst", func(n int64) { copied = n }); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "dst", "src", "logs", "access.log")); string(got) != content {
+		t.Errorf("copy wrote %d bytes, want %d", len(got), len(content))
+	}
+	if copied < int64(len(content)) {
+		t.Errorf("progress should count uncompressed bytes, got %d", copied)
+	}
+	if local.mostIn > int64(len(content))/4 || local.mostOut > int64(len(content))/4 {
+		t.Errorf("expected both legs of the copy to be compressed, they took %d and %d bytes", local.mostOut, local.mostIn)
+	}
+	local.mostIn = 0
+
+	ctx = WithTransferCompression(context.Background(), CompressionGzip)
+	if err := c.UploadFile(ctx, "default", "my-pvc", "/upload.log", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "upload.log")); string(got) != content {
+		t.Errorf("upload wrote %d bytes, want %d", len(got), len(content))
+	}
+	if local.mostIn > int64(len(content))/4 {
+		t.Errorf("expected the upload to be compressed, it took %d bytes", local.mostIn)
+	}
+}
+
+func TestToolsWriter(t *testing.T) {
+	var out bytes.Buffer
+	in, w := compressingStdin(context.Background(), strings.NewReader("data"), &out)
+	io.WriteString(w, "z")
+	io.WriteString(w, "g\nrest")
+	if in.found.tools != "zg" || out.String() != "rest" {
+		t.Errorf("got tools %q and output %q", in.found.tools, out.String())
+	}
+	if b, _ := io.ReadAll(io.LimitReader(in, 1)); string(b) != "g" {
+		t.Errorf("expected the stream to be marked gzip, got %q", b)
+	}
+	in.Close()
+
+	in, w = compressingStdin(context.Background(), strings.NewReader("data"), io.Discard)
+	io.WriteString(w, "\n")
+	if b, _ := io.ReadAll(in); string(b) != "data" {
+		t.Errorf("a pod without dd should get the data as is, got %q", b)
+	}
+	if _, err := io.WriteString(&toolsWriter{w: io.Discard, found: &podTools{ready: make(chan struct{})}}, strings.Repeat("x", 20)); err == nil {
+		t.Error("expected output other than the tools line to be refused")
+	}
+}
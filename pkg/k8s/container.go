@@ -0,0 +1,310 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	gopath "path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type PodInfo struct {
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace"`
+	Phase      string   `json:"phase"`
+	NodeName   string   `json:"nodeName"`
+	Containers []string `json:"containers"`
+}
+
+// ContainerMount describes a volume mounted into a container, so listings of
+// the container root can tell volume-backed directories apart from the
+// writable container layer.
+type ContainerMount struct {
+	Path     string `json:"path"`
+	Volume   string `json:"volume"`
+	Source   string `json:"source"`
+	ReadOnly bool   `json:"readOnly"`
+	// Secret marks volumes whose files come from a Secret (directly or
+	// through a projected volume, including service account tokens).
+	Secret bool `json:"secret"`
+}
+
+// ContainerListing is the result of browsing a container filesystem rooted
+// at "/". Everything outside Mounts lives in the container's writable layer
+// and counts against its ephemeral-storage usage.
+type ContainerListing struct {
+	Pod       string           `json:"pod"`
+	Container string           `json:"container"`
+	Scope     string           `json:"scope"`
+	Files     []FileInfo       `json:"files"`
+	Mounts    []ContainerMount `json:"mounts"`
+}
+
+const ScopeContainerRoot = "container-root"
+
+func (c *Client) ListPods(ctx context.Context, namespace string) ([]PodInfo, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	podList, err := c.listPods(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []PodInfo
+	for _, pod := range podList.Items {
+		info := PodInfo{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Phase:     string(pod.Status.Phase),
+			NodeName:  pod.Spec.NodeName,
+		}
+		for _, container := range pod.Spec.Containers {
+			info.Containers = append(info.Containers, container.Name)
+		}
+		pods = append(pods, info)
+	}
+	return pods, nil
+}
+
+// ListContainerFiles lists a directory of a running container's own
+// filesystem (its writable layer plus whatever is mounted into it), rather
+// than a PVC. No helper pod fallback exists here: a helper cannot see
+// another container's layer.
+func (c *Client) ListContainerFiles(ctx context.Context, namespace, podName, containerName, path string) (*ContainerListing, error) {
+	path = strings.ReplaceAll(path, "\\", "/")
+	path = strings.TrimSuffix(path, "/")
+
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, fmt.Errorf("pod %s is not running (phase: %s)", podName, pod.Status.Phase)
+	}
+
+	container, err := resolveContainer(pod, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := c.tryListFiles(ctx, namespace, podName, container.Name, "", path)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := containerMounts(pod, container)
+	for i := range files {
+		if m := mountFor(mounts, files[i].Path); m != nil && m.Secret {
+			files[i].Secret = true
+		}
+	}
+
+	return &ContainerListing{
+		Pod:       podName,
+		Container: container.Name,
+		Scope:     ScopeContainerRoot,
+		Files:     files,
+		Mounts:    mounts,
+	}, nil
+}
+
+// maxContainerFileBytes caps how much of a container file
+// ReadContainerFile returns for preview.
+const maxContainerFileBytes = 1 << 20
+
+// ContainerFile is a preview of a file in a container's filesystem.
+type ContainerFile struct {
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated"`
+	Secret    bool   `json:"secret"`
+	Volume    string `json:"volume,omitempty"`
+}
+
+// realPathScript prints the path $1 leads to once every symbolic link
+// and ".." in it is followed.
+const realPathScript = `readlink -f -- "$1" 2>/dev/null || realpath -- "$1"`
+
+// resolveContainerPath returns the path p leads to in a container, so a
+// link or another name for a secret's file is judged by the file itself.
+func (c *Client) resolveContainerPath(ctx context.Context, namespace, podName, containerName, p string) (string, error) {
+	stdout, stderr, err := c.getExecutor().execInPod(ctx, namespace, podName, containerName,
+		[]string{"sh", "-c", realPathScript, "sh", p})
+	if err != nil {
+		return "", classifyExecError(err, stderr)
+	}
+	resolved := strings.TrimSuffix(stdout, "\n")
+	if !strings.HasPrefix(resolved, "/") {
+		return "", fmt.Errorf("cannot tell where %s leads in container %s", p, containerName)
+	}
+	return gopath.Clean(resolved), nil
+}
+
+// inProc reports whether p is under /proc, whose per-process root and fd
+// links reach any file by another name.
+func inProc(p string) bool {
+	return p == "/proc" || strings.HasPrefix(p, "/proc/")
+}
+
+// ReadContainerFile returns up to maxContainerFileBytes of a file in a
+// running container. Files inside a Secret-backed volume are only read
+// when reveal is set; otherwise an ErrKindSecretHidden error is returned,
+// so callers can audit each reveal. The path is judged both as given,
+// without exec'ing anything, and once resolved in the container, so a
+// symbolic link into a secret volume needs a reveal too; the resolved
+// path is what is read. Nothing under /proc is read.
+func (c *Client) ReadContainerFile(ctx context.Context, namespace, podName, containerName, path string, reveal bool) (*ContainerFile, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, fmt.Errorf("pod %s is not running (phase: %s)", podName, pod.Status.Phase)
+	}
+	container, err := resolveContainer(pod, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ContainerFile{Path: path}
+	mounts := containerMounts(pod, container)
+	check := func(p string) error {
+		if inProc(p) {
+			return &K8sError{Kind: ErrKindPermDenied, Message: fmt.Sprintf("%s is under /proc, which is not read", path)}
+		}
+		if m := mountFor(mounts, p); m != nil && m.Secret {
+			file.Secret = true
+			file.Volume = m.Volume
+			if !reveal {
+				return &K8sError{
+					Kind:    ErrKindSecretHidden,
+					Message: fmt.Sprintf("%s comes from secret volume %s; reveal it explicitly to read it", path, m.Volume),
+				}
+			}
+		}
+		return nil
+	}
+	if err := check(gopath.Clean("/" + path)); err != nil {
+		return nil, err
+	}
+	resolved, err := c.resolveContainerPath(ctx, namespace, podName, container.Name, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := check(resolved); err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := c.getExecutor().execInPod(ctx, namespace, podName, container.Name,
+		[]string{"head", "-c", fmt.Sprint(maxContainerFileBytes + 1), "--", resolved})
+	if err != nil {
+		return nil, classifyExecError(err, stderr)
+	}
+	if len(stdout) > maxContainerFileBytes {
+		stdout = stdout[:maxContainerFileBytes]
+		file.Truncated = true
+	}
+	file.Content = stdout
+	return file, nil
+}
+
+// mountFor returns the mount whose path contains p, preferring the
+// deepest one, or nil when p is on the container's own layer.
+func mountFor(mounts []ContainerMount, p string) *ContainerMount {
+	var best *ContainerMount
+	for i := range mounts {
+		mp := strings.TrimSuffix(mounts[i].Path, "/")
+		if p != mp && !strings.HasPrefix(p, mp+"/") {
+			continue
+		}
+		if best == nil || len(mp) > len(strings.TrimSuffix(best.Path, "/")) {
+			best = &mounts[i]
+		}
+	}
+	return best
+}
+
+func resolveContainer(pod *corev1.Pod, containerName string) (*corev1.Container, error) {
+	if containerName == "" {
+		if len(pod.Spec.Containers) == 0 {
+			return nil, fmt.Errorf("pod %s has no containers", pod.Name)
+		}
+		return &pod.Spec.Containers[0], nil
+	}
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			return &pod.Spec.Containers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("container %s not found in pod %s", containerName, pod.Name)
+}
+
+func containerMounts(pod *corev1.Pod, container *corev1.Container) []ContainerMount {
+	sources := make(map[string]string)
+	secrets := make(map[string]bool)
+	for _, vol := range pod.Spec.Volumes {
+		sources[vol.Name] = volumeSourceKind(vol)
+		secrets[vol.Name] = volumeHoldsSecrets(vol)
+	}
+
+	var mounts []ContainerMount
+	for _, m := range container.VolumeMounts {
+		mounts = append(mounts, ContainerMount{
+			Path:     m.MountPath,
+			Volume:   m.Name,
+			Source:   sources[m.Name],
+			ReadOnly: m.ReadOnly,
+			Secret:   secrets[m.Name],
+		})
+	}
+	return mounts
+}
+
+func volumeHoldsSecrets(vol corev1.Volume) bool {
+	if vol.Secret != nil {
+		return true
+	}
+	if vol.Projected == nil {
+		return false
+	}
+	for _, src := range vol.Projected.Sources {
+		if src.Secret != nil || src.ServiceAccountToken != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func volumeSourceKind(vol corev1.Volume) string {
+	switch {
+	case vol.PersistentVolumeClaim != nil:
+		return "persistentVolumeClaim"
+	case vol.Ephemeral != nil:
+		return "ephemeral"
+	case vol.EmptyDir != nil:
+		return "emptyDir"
+	case vol.Secret != nil:
+		return "secret"
+	case vol.ConfigMap != nil:
+		return "configMap"
+	case vol.Projected != nil:
+		return "projected"
+	case vol.DownwardAPI != nil:
+		return "downwardAPI"
+	case vol.HostPath != nil:
+		return "hostPath"
+	case vol.CSI != nil:
+		return "csi"
+	default:
+		return "other"
+	}
+}
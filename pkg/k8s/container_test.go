@@ -0,0 +1,168 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListContainerFilesRootScope(t *testing.T) {
+	pod := runningPodWithPVC("my-pvc")
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name:         "tmp",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "tmp", MountPath: "/tmp"})
+
+	mock := &mockPodExecutor{}
+	mock.pushExec(findPrintfRecord("d", "drwxr-xr-x", "4096", "var", ""), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(pod), executor: mock}
+
+	listing, err := c.ListContainerFiles(context.Background(), "default", "app-pod", "", "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listing.Container != "app" || listing.Scope != ScopeContainerRoot {
+		t.Errorf("unexpected listing metadata: %+v", listing)
+	}
+	if len(listing.Files) != 1 || listing.Files[0].Name != "var" {
+		t.Errorf("unexpected files: %v", listing.Files)
+	}
+	if len(listing.Mounts) != 2 || listing.Mounts[0].Source != "persistentVolumeClaim" || listing.Mounts[1].Source != "emptyDir" {
+		t.Errorf("unexpected mounts: %+v", listing.Mounts)
+	}
+
+	cmd := mock.execCalls[0].cmd
+	if got := cmd[3]; got != "/" {
+		t.Errorf("expected listing of container root, got path %q", got)
+	}
+	if mock.createCalled != 0 {
+		t.Error("container browsing must never create a helper pod")
+	}
+}
+
+func TestListContainerFilesUnknownContainer(t *testing.T) {
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: &mockPodExecutor{}}
+	if _, err := c.ListContainerFiles(context.Background(), "default", "app-pod", "sidecar", "/"); err == nil {
+		t.Fatal("expected error for unknown container")
+	}
+}
+
+func podWithSecretVolumes() *corev1.Pod {
+	pod := runningPodWithPVC("my-pvc")
+	pod.Spec.Volumes = append(pod.Spec.Volumes,
+		corev1.Volume{Name: "creds", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "db-creds"}}},
+		corev1.Volume{Name: "kube-api-access", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+			Sources: []corev1.VolumeProjection{{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token"}}},
+		}}},
+		corev1.Volume{Name: "settings", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}},
+	)
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "creds", MountPath: "/etc/creds"},
+		corev1.VolumeMount{Name: "kube-api-access", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"},
+		corev1.VolumeMount{Name: "settings", MountPath: "/etc/settings"},
+	)
+	return pod
+}
+
+func TestListContainerFilesMarksSecrets(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec(findPrintfRecord("l", "lrwxrwxrwx", "15", "password", "..data/password")+
+		findPrintfRecord("l", "lrwxrwxrwx", "15", "username", "..data/username"), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(podWithSecretVolumes()), executor: mock}
+
+	listing, err := c.ListContainerFiles(context.Background(), "default", "app-pod", "", "/etc/creds")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, f := range listing.Files {
+		if !f.Secret {
+			t.Errorf("%s should be marked as secret", f.Path)
+		}
+	}
+
+	secret := map[string]bool{}
+	for _, m := range listing.Mounts {
+		secret[m.Volume] = m.Secret
+	}
+	if !secret["creds"] || !secret["kube-api-access"] || secret["settings"] || secret["data"] {
+		t.Errorf("unexpected secret mounts: %v", secret)
+	}
+}
+
+func TestReadContainerFileRequiresReveal(t *testing.T) {
+	mock := &mockPodExecutor{}
+	c := &Client{clientset: fake.NewSimpleClientset(podWithSecretVolumes()), executor: mock}
+
+	_, err := c.ReadContainerFile(context.Background(), "default", "app-pod", "", "/etc/creds/password", false)
+	var ke *K8sError
+	if !errors.As(err, &ke) || ke.Kind != ErrKindSecretHidden {
+		t.Fatalf("expected SecretHidden error, got %v", err)
+	}
+	if len(mock.execCalls) != 0 {
+		t.Fatal("a hidden secret must not be read from the container")
+	}
+
+	mock.pushExec("/etc/creds/..2024_01_01/password\n", "", nil)
+	mock.pushExec("hunter2", "", nil)
+	file, err := c.ReadContainerFile(context.Background(), "default", "app-pod", "", "/etc/creds/password", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file.Content != "hunter2" || !file.Secret || file.Volume != "creds" {
+		t.Errorf("unexpected file: %+v", file)
+	}
+
+	if got := mock.execCalls[1].cmd; got[len(got)-1] != "/etc/creds/..2024_01_01/password" {
+		t.Errorf("expected the resolved path to be read, got %v", got)
+	}
+
+	mock.pushExec("/etc/settings/app.conf\n", "", nil)
+	mock.pushExec("debug=true", "", nil)
+	file, err = c.ReadContainerFile(context.Background(), "default", "app-pod", "", "/etc/settings/app.conf", false)
+	if err != nil || file.Secret || file.Content != "debug=true" {
+		t.Errorf("ordinary files must not need a reveal: %+v, %v", file, err)
+	}
+
+	// A link, or another name, leading into a secret volume needs a reveal
+	// too, and /proc is never read.
+	calls := len(mock.execCalls)
+	mock.pushExec("/etc/creds/..2024_01_01/password\n", "", nil)
+	if _, err := c.ReadContainerFile(context.Background(), "default", "app-pod", "", "/tmp/innocent", false); !errors.As(err, &ke) || ke.Kind != ErrKindSecretHidden {
+		t.Errorf("expected a link into the secret to be hidden, got %v", err)
+	}
+	if len(mock.execCalls) != calls+1 {
+		t.Error("a hidden secret must only be resolved, not read")
+	}
+	if _, err := c.ReadContainerFile(context.Background(), "default", "app-pod", "", "/proc/self/root/etc/creds/password", true); !errors.As(err, &ke) || ke.Kind != ErrKindPermDenied {
+		t.Errorf("expected /proc to be refused, got %v", err)
+	}
+	mock.pushExec("/proc/1/environ\n", "", nil)
+	if _, err := c.ReadContainerFile(context.Background(), "default", "app-pod", "", "/tmp/env", true); !errors.As(err, &ke) || ke.Kind != ErrKindPermDenied {
+		t.Errorf("expected a link into /proc to be refused, got %v", err)
+	}
+}
+
+func TestMountFor(t *testing.T) {
+	mounts := []ContainerMount{{Path: "/etc"}, {Path: "/etc/creds/"}}
+	tests := map[string]string{
+		"/etc/creds":     "/etc/creds/",
+		"/etc/creds/key": "/etc/creds/",
+		"/etc/credsx":    "/etc",
+		"/etc":           "/etc",
+		"/var/log":       "",
+	}
+	for p, want := range tests {
+		got := ""
+		if m := mountFor(mounts, p); m != nil {
+			got = m.Path
+		}
+		if got != want {
+			t.Errorf("mountFor(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// sidecarNames are the containers service meshes and agents inject. They
+// may mount the pod's volumes, but their images rarely have a shell and
+// the data belongs to the application next to them.
+var sidecarNames = map[string]bool{
+	"istio-proxy":      true,
+	"linkerd-proxy":    true,
+	"envoy":            true,
+	"envoy-sidecar":    true,
+	"consul-dataplane": true,
+	"daprd":            true,
+	"vault-agent":      true,
+	"cloud-sql-proxy":  true,
+	"cloudsql-proxy":   true,
+}
+
+// sidecarImages are image name fragments of the same sidecars, for when
+// the container was renamed.
+var sidecarImages = []string{"istio/proxyv2", "linkerd/proxy", "envoyproxy/envoy", "hashicorp/consul-dataplane", "daprio/daprd", "cloud-sql-proxy", "cloudsql-proxy"}
+
+// shellProbeTimeout bounds the exec that checks a container for a shell.
+const shellProbeTimeout = 10 * time.Second
+
+func isSidecar(container corev1.Container) bool {
+	if sidecarNames[container.Name] {
+		return true
+	}
+	for _, fragment := range sidecarImages {
+		if strings.Contains(container.Image, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountingContainer is a container of a pod that mounts a given volume.
+type mountingContainer struct {
+	name      string
+	mountPath string
+}
+
+// mountingContainers returns the containers of pod that mount the volume,
+// in spec order, leaving out sidecars unless only sidecars mount it.
+func mountingContainers(pod *corev1.Pod, volumeName string) []mountingContainer {
+	var apps, sidecars []mountingContainer
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != volumeName {
+				continue
+			}
+			m := mountingContainer{name: container.Name, mountPath: mount.MountPath}
+			if isSidecar(container) {
+				sidecars = append(sidecars, m)
+			} else {
+				apps = append(apps, m)
+			}
+			break
+		}
+	}
+	if len(apps) == 0 {
+		return sidecars
+	}
+	return apps
+}
+
+// pickContainer chooses which of the containers mounting a volume to exec
+// in. With several, the first one with a shell wins; when none has one, the
+// first is returned and the operation falls back to a helper pod as usual.
+func (c *Client) pickContainer(ctx context.Context, pod *corev1.Pod, candidates []mountingContainer) mountingContainer {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	for _, m := range candidates {
+		if c.hasShell(ctx, pod, m.name) {
+			return m
+		}
+	}
+	return candidates[0]
+}
+
+// hasShell reports whether a container can run sh. The answer is cached
+// for the pod's lifetime and image, so each container is probed once.
+// A probe that fails for another reason than a missing shell (a timeout,
+// RBAC) counts as no shell but is not cached.
+func (c *Client) hasShell(ctx context.Context, pod *corev1.Pod, containerName string) bool {
+	image := ""
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			image = container.Image
+		}
+	}
+	key := string(pod.UID) + "/" + pod.Namespace + "/" + pod.Name + "/" + containerName + "/" + image
+
+	c.probeMu.Lock()
+	known, ok := c.shellProbes[key]
+	c.probeMu.Unlock()
+	if ok {
+		return known
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, shellProbeTimeout)
+	defer cancel()
+	_, stderr, err := c.getExecutor().execInPod(ctx, pod.Namespace, pod.Name, containerName, []string{"sh", "-c", "true"})
+	if err != nil && classifyExecError(err, stderr).Kind != ErrKindNoShell {
+		log.Printf("Could not check container %s of pod %s for a shell: %v", containerName, pod.Name, err)
+		return false
+	}
+
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	if c.shellProbes == nil {
+		c.shellProbes = map[string]bool{}
+	}
+	c.shellProbes[key] = err == nil
+	return err == nil
+}
@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// podWithContainers is runningPodWithPVC with the given containers, all
+// mounting the claim.
+func podWithContainers(pvcName string, containers ...corev1.Container) *corev1.Pod {
+	pod := runningPodWithPVC(pvcName)
+	pod.UID = "uid-1"
+	for i := range containers {
+		containers[i].VolumeMounts = []corev1.VolumeMount{{Name: "data-vol", MountPath: "/mnt/" + containers[i].Name}}
+	}
+	pod.Spec.Containers = containers
+	return pod
+}
+
+func TestFindPodForPVCSkipsSidecars(t *testing.T) {
+	pod := podWithContainers("my-pvc",
+		corev1.Container{Name: "istio-proxy", Image: "docker.io/istio/proxyv2:1.22"},
+		corev1.Container{Name: "app", Image: "alpine"})
+	mock := &mockPodExecutor{}
+	c := &Client{clientset: fake.NewSimpleClientset(pod), executor: mock}
+
+	info, err := c.findPodForPVC(context.Background(), "default", "my-pvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.containerName != "app" || info.mountPath != "/mnt/app" {
+		t.Errorf("expected the app container, got %+v", info)
+	}
+	if len(mock.execCalls) != 0 {
+		t.Errorf("expected no probe for a single application container, got %v", mock.execCalls)
+	}
+}
+
+func TestFindPodForPVCPrefersShellAndCaches(t *testing.T) {
+	pod := podWithContainers("my-pvc",
+		corev1.Container{Name: "distroless", Image: "gcr.io/distroless/static"},
+		corev1.Container{Name: "tools", Image: "busybox"})
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", fmt.Errorf(`exec: "sh": executable file not found in $PATH`))
+	mock.pushExec("", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(pod), executor: mock}
+
+	for i := 0; i < 2; i++ {
+		info, err := c.findPodForPVC(context.Background(), "default", "my-pvc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.containerName != "tools" {
+			t.Errorf("expected the container with a shell, got %q", info.containerName)
+		}
+	}
+	if len(mock.execCalls) != 2 {
+		t.Errorf("expected each container to be probed once, got %d probes", len(mock.execCalls))
+	}
+}
+
+func TestPickContainerWithoutShellKeepsFirst(t *testing.T) {
+	pod := podWithContainers("my-pvc",
+		corev1.Container{Name: "a", Image: "scratch-a"},
+		corev1.Container{Name: "b", Image: "scratch-b"})
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", fmt.Errorf(`exec: "sh": executable file not found in $PATH`))
+	mock.pushExec("", "", fmt.Errorf("pods \"app-pod\" is forbidden"))
+	c := &Client{executor: mock}
+
+	got := c.pickContainer(context.Background(), pod, mountingContainers(pod, "data-vol"))
+	if got.name != "a" {
+		t.Errorf("expected the first container, got %q", got.name)
+	}
+	if _, cached := c.shellProbes["uid-1/default/app-pod/b/scratch-b"]; cached {
+		t.Error("expected a failed probe not to be cached")
+	}
+}
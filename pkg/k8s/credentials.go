@@ -0,0 +1,216 @@
+package k8s
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// credentialTracker records the expiry of the credential the client is
+// currently authenticating with. Static credentials (token, token file,
+// client certificate) are inspected once; tokens minted by exec plugins are
+// observed on the wire because client-go does not expose its plugin cache.
+type credentialTracker struct {
+	mu     sync.RWMutex
+	expiry time.Time
+	source string
+}
+
+func (t *credentialTracker) set(expiry time.Time, source string) {
+	if expiry.IsZero() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expiry = expiry
+	t.source = source
+}
+
+func (t *credentialTracker) get() (time.Time, string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.expiry, t.source
+}
+
+// CredentialStatus describes what is known about the expiry of the active
+// credential. Known is false when the credential carries no expiry
+// information (opaque tokens, basic auth, or nothing observed yet).
+type CredentialStatus struct {
+	Known     bool      `json:"known"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	ExpiresIn int64     `json:"expiresInSeconds,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Expired   bool      `json:"expired"`
+	Warning   string    `json:"warning,omitempty"`
+}
+
+func credentialWarnThreshold() time.Duration {
+	if v := os.Getenv("KUBE_BROWSER_CREDENTIAL_WARN_SEC"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return time.Duration(parsed) * time.Second
+		}
+	}
+	return 5 * time.Minute
+}
+
+// CredentialStatus reports the expiry of the credential used by this client.
+func (c *Client) CredentialStatus() CredentialStatus {
+	if c.credentials == nil {
+		return CredentialStatus{}
+	}
+	expiry, source := c.credentials.get()
+	return buildCredentialStatus(expiry, source, time.Now(), credentialWarnThreshold())
+}
+
+func buildCredentialStatus(expiry time.Time, source string, now time.Time, warnBefore time.Duration) CredentialStatus {
+	if expiry.IsZero() {
+		return CredentialStatus{}
+	}
+	remaining := expiry.Sub(now)
+	st := CredentialStatus{
+		Known:     true,
+		ExpiresAt: expiry.UTC(),
+		Source:    source,
+	}
+	if remaining <= 0 {
+		st.Expired = true
+		st.Warning = "Cluster credentials have expired. Refresh your login and reconnect."
+		return st
+	}
+	st.ExpiresIn = int64(remaining.Seconds())
+	if remaining <= warnBefore {
+		st.Warning = "Cluster credentials expire in " + remaining.Round(time.Second).String() +
+			". Refresh your login before starting long transfers."
+	}
+	return st
+}
+
+// trackCredentials inspects the static credentials in config and installs a
+// transport wrapper that observes bearer tokens issued by exec/auth plugins.
+func trackCredentials(config *rest.Config) *credentialTracker {
+	t := &credentialTracker{}
+
+	if config.BearerToken != "" {
+		t.set(tokenExpiry(config.BearerToken), "token")
+	} else if config.BearerTokenFile != "" {
+		if data, err := os.ReadFile(config.BearerTokenFile); err == nil {
+			t.set(tokenExpiry(strings.TrimSpace(string(data))), "token-file")
+		}
+	}
+
+	certData := config.TLSClientConfig.CertData
+	if len(certData) == 0 && config.TLSClientConfig.CertFile != "" {
+		certData, _ = os.ReadFile(config.TLSClientConfig.CertFile)
+	}
+	if len(certData) > 0 {
+		t.set(certificateExpiry(certData), "client-certificate")
+	}
+
+	if config.ExecProvider != nil || config.AuthProvider != nil {
+		source := "auth-provider"
+		if config.ExecProvider != nil {
+			source = "exec-plugin"
+		}
+		prev := config.WrapTransport
+		config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			if prev != nil {
+				rt = prev(rt)
+			}
+			return &tokenObservingTransport{next: rt, tracker: t, source: source}
+		}
+	}
+
+	return t
+}
+
+type tokenObservingTransport struct {
+	next    http.RoundTripper
+	tracker *credentialTracker
+	source  string
+}
+
+func (o *tokenObservingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		o.tracker.set(tokenExpiry(strings.TrimPrefix(auth, "Bearer ")), o.source)
+	}
+	return o.next.RoundTrip(req)
+}
+
+// tokenExpiry extracts the expiry from a bearer token. It understands JWTs
+// (OIDC id-tokens, service account tokens) and EKS presigned-URL tokens;
+// any other format yields the zero time.
+func tokenExpiry(token string) time.Time {
+	if strings.HasPrefix(token, "k8s-aws-v1.") {
+		return eksTokenExpiry(strings.TrimPrefix(token, "k8s-aws-v1."))
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == "" {
+		return time.Time{}
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil || exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
+func eksTokenExpiry(encoded string) time.Time {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}
+	}
+	u, err := url.Parse(string(raw))
+	if err != nil {
+		return time.Time{}
+	}
+	q := u.Query()
+	signed, err := time.Parse("20060102T150405Z", q.Get("X-Amz-Date"))
+	if err != nil {
+		return time.Time{}
+	}
+	// aws-iam-authenticator tokens are accepted for 15 minutes regardless
+	// of the presign duration embedded in the URL.
+	validity := 15 * time.Minute
+	if secs, err := strconv.Atoi(q.Get("X-Amz-Expires")); err == nil && secs > 0 && time.Duration(secs)*time.Second < validity {
+		validity = time.Duration(secs) * time.Second
+	}
+	return signed.Add(validity)
+}
+
+func certificateExpiry(data []byte) time.Time {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return time.Time{}
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}
+		}
+		return cert.NotAfter
+	}
+}
@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func fakeJWT(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestTokenExpiryJWT(t *testing.T) {
+	got := tokenExpiry(fakeJWT(`{"sub":"me","exp":1700000000}`))
+	if !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("expected exp 1700000000, got %v", got)
+	}
+}
+
+func TestTokenExpiryOpaqueToken(t *testing.T) {
+	for _, tok := range []string{"abcdef123456", "a.b", fakeJWT(`{"sub":"me"}`), "x.!!!.y"} {
+		if got := tokenExpiry(tok); !got.IsZero() {
+			t.Errorf("tokenExpiry(%q) = %v, want zero", tok, got)
+		}
+	}
+}
+
+func TestTokenExpiryEKS(t *testing.T) {
+	presigned := "https://sts.amazonaws.com/?Action=GetCallerIdentity&X-Amz-Date=20240115T103000Z&X-Amz-Expires=60"
+	tok := "k8s-aws-v1." + base64.RawURLEncoding.EncodeToString([]byte(presigned))
+	want := time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)
+	if got := tokenExpiry(tok); !got.Equal(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "user"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if got := certificateExpiry(pemData); !got.Equal(notAfter) {
+		t.Errorf("expected %v, got %v", notAfter, got)
+	}
+	if got := certificateExpiry([]byte("not a pem")); !got.IsZero() {
+		t.Errorf("expected zero time for garbage, got %v", got)
+	}
+}
+
+func TestBuildCredentialStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if st := buildCredentialStatus(time.Time{}, "", now, time.Minute); st.Known {
+		t.Error("expected unknown status for zero expiry")
+	}
+
+	st := buildCredentialStatus(now.Add(time.Hour), "token", now, 5*time.Minute)
+	if !st.Known || st.Expired || st.Warning != "" || st.ExpiresIn != 3600 {
+		t.Errorf("unexpected status for far expiry: %+v", st)
+	}
+
+	st = buildCredentialStatus(now.Add(2*time.Minute), "exec-plugin", now, 5*time.Minute)
+	if st.Warning == "" || st.Expired {
+		t.Errorf("expected expiring-soon warning, got %+v", st)
+	}
+
+	st = buildCredentialStatus(now.Add(-time.Second), "token", now, 5*time.Minute)
+	if !st.Expired || !strings.Contains(st.Warning, "expired") {
+		t.Errorf("expected expired status, got %+v", st)
+	}
+}
+
+type recordingRoundTripper struct{ calls int }
+
+func (r *recordingRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	r.calls++
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestTrackCredentialsObservesExecPluginToken(t *testing.T) {
+	cfg := &rest.Config{ExecProvider: &clientcmdapi.ExecConfig{Command: "plugin"}}
+	tracker := trackCredentials(cfg)
+	if cfg.WrapTransport == nil {
+		t.Fatal("expected transport wrapper for exec plugin credentials")
+	}
+
+	inner := &recordingRoundTripper{}
+	rt := cfg.WrapTransport(inner)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.invalid/api", nil)
+	req.Header.Set("Authorization", "Bearer "+fakeJWT(`{"exp":1800000000}`))
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	expiry, source := tracker.get()
+	if !expiry.Equal(time.Unix(1800000000, 0)) || source != "exec-plugin" {
+		t.Errorf("expected observed expiry from exec plugin, got %v (%s)", expiry, source)
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected request to be forwarded once, got %d", inner.calls)
+	}
+}
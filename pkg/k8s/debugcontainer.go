@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// debugContainerPrefix starts the name of the ephemeral containers
+// KubeBrowser adds to pods.
+const debugContainerPrefix = "kube-browser-"
+
+// runningDebugContainer returns an ephemeral container KubeBrowser added
+// to pod earlier that is still running with volumeName mounted, or "".
+func runningDebugContainer(pod *corev1.Pod, volumeName string) string {
+	running := map[string]bool{}
+	for _, st := range pod.Status.EphemeralContainerStatuses {
+		running[st.Name] = st.State.Running != nil
+	}
+	for _, ec := range pod.Spec.EphemeralContainers {
+		if !strings.HasPrefix(ec.Name, debugContainerPrefix) || !running[ec.Name] {
+			continue
+		}
+		for _, m := range ec.VolumeMounts {
+			if m.Name == volumeName && m.MountPath == helperMountPath {
+				return ec.Name
+			}
+		}
+	}
+	return ""
+}
+
+// addDebugContainer adds an ephemeral container of the helper image to a
+// running pod, with one of its volumes mounted at helperMountPath, and
+// waits for it to run. One added earlier and still running is reused:
+// ephemeral containers cannot be removed, so every new one stays in the
+// pod's spec, stopped, until the pod is replaced.
+func (c *Client) addDebugContainer(ctx context.Context, namespace, podName, volumeName string) (string, error) {
+	pods := c.clientset.CoreV1().Pods(namespace)
+	pod, err := pods.Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", classifyApiError(err)
+	}
+	if name := runningDebugContainer(pod, volumeName); name != "" {
+		return name, nil
+	}
+
+	name := debugContainerPrefix + strconv.FormatInt(time.Now().UnixNano(), 16)
+	image := c.helperImage()
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:            name,
+			Image:           image,
+			Command:         []string{"sleep", strconv.Itoa(int(helperPodLifetime.Seconds()))},
+			SecurityContext: helperSecurityContext(),
+			VolumeMounts:    []corev1.VolumeMount{{Name: volumeName, MountPath: helperMountPath}},
+		},
+	})
+	log.Printf("Adding ephemeral container %s to %s/%s (image: %s)", name, namespace, podName, image)
+	if _, err := pods.UpdateEphemeralContainers(ctx, podName, pod, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsForbidden(err) {
+			return "", &K8sError{Kind: ErrKindRBAC, Message: "Permission denied: your kubeconfig cannot update pods/ephemeralcontainers. Add 'pods/ephemeralcontainers' update RBAC permission.", Cause: err}
+		}
+		return "", classifyApiError(err)
+	}
+
+	wait := helperWaitSettings()
+	deadline := time.Now().Add(wait.startup)
+	var reason string
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return "", classifyExecError(ctx.Err(), "")
+		case <-time.After(wait.poll):
+		}
+		p, err := pods.Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("Error polling ephemeral container %s: %v", name, err)
+			continue
+		}
+		for _, st := range p.Status.EphemeralContainerStatuses {
+			if st.Name != name {
+				continue
+			}
+			switch {
+			case st.State.Running != nil:
+				return name, nil
+			case st.State.Terminated != nil:
+				return "", &K8sError{Kind: ErrKindHelperPending, Message: fmt.Sprintf("Ephemeral container %s exited (%s) before it could be used.", name, st.State.Terminated.Reason)}
+			case st.State.Waiting != nil:
+				reason = st.State.Waiting.Reason
+			}
+		}
+	}
+	return "", &K8sError{Kind: ErrKindHelperPending, Message: fmt.Sprintf("Ephemeral container %s did not start within %s (reason: %s).", name, wait.startup, reason)}
+}
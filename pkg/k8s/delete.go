@@ -0,0 +1,62 @@
+package k8s
+
+import "context"
+
+// deleteDirScript removes the directory $1, recursively when $2 is "-r".
+// rm -r alone would just as happily remove a file or a symlink, so the
+// type is checked first.
+const deleteDirScript = `if [ ! -e "$1" ] && [ ! -L "$1" ]; then echo "$1: No such file or directory" >&2; exit 1; fi
+if [ -L "$1" ] || [ ! -d "$1" ]; then echo "$1: Not a directory" >&2; exit 1; fi
+if [ "$2" = "-r" ]; then exec rm -r -- "$1"; fi
+exec rmdir -- "$1"`
+
+// checkDeletable refuses to delete the root of a claim: the mount point
+// itself cannot be removed, and emptying it is never what a click on a
+// single entry meant.
+func checkDeletable(p string) error {
+	if relativePVCPath(p) == "." {
+		return &K8sError{Kind: ErrKindUnknown, Message: "Cannot delete the root of a PVC; select the entries inside it."}
+	}
+	return nil
+}
+
+// DeleteFile removes a single file (or symlink) from the PVC. Unlike
+// RemoveFile, a missing file is an error, and so is a directory.
+func (c *Client) DeleteFile(ctx context.Context, namespace, pvcName, filePath string) error {
+	if err := checkDeletable(filePath); err != nil {
+		return err
+	}
+	_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"rm", "--", pvcPath(mountPath, filePath)}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return streamError(ke, stderr)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteDirectory removes a directory from the PVC. Without recursive only
+// an empty directory is removed, like rmdir; with it, everything below it
+// goes too.
+func (c *Client) DeleteDirectory(ctx context.Context, namespace, pvcName, dirPath string, recursive bool) error {
+	if err := checkDeletable(dirPath); err != nil {
+		return err
+	}
+	flag := ""
+	if recursive {
+		flag = "-r"
+	}
+	_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"sh", "-c", deleteDirScript, "sh", pvcPath(mountPath, dirPath), flag}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return streamError(ke, stderr)
+		}
+		return err
+	}
+	return nil
+}
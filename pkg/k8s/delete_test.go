@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDeleteCommands(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", nil)
+	mock.pushExec("", "", nil)
+	mock.pushExec("", "", nil)
+	c := newTransferClient(mock)
+	ctx := context.Background()
+
+	if err := c.DeleteFile(ctx, "default", "my-pvc", "/logs/a.log"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteDirectory(ctx, "default", "my-pvc", "/logs", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteDirectory(ctx, "default", "my-pvc", "/empty", false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"rm -- /data/logs/a.log",
+		"sh -c " + deleteDirScript + " sh /data/logs -r",
+		"sh -c " + deleteDirScript + " sh /data/empty ",
+	}
+	for i, w := range want {
+		if got := strings.Join(mock.execCalls[i].cmd, " "); got != w {
+			t.Errorf("call %d: got %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestDeleteRefusesPVCRoot(t *testing.T) {
+	mock := &mockPodExecutor{}
+	c := newTransferClient(mock)
+
+	for _, p := range []string{"/", "", "."} {
+		if err := c.DeleteDirectory(context.Background(), "default", "my-pvc", p, true); err == nil {
+			t.Errorf("expected deleting %q to be refused", p)
+		}
+	}
+	if err := c.DeleteFile(context.Background(), "default", "my-pvc", "/"); err == nil {
+		t.Error("expected deleting the root as a file to be refused")
+	}
+	if len(mock.execCalls) != 0 {
+		t.Errorf("expected no exec, got %d", len(mock.execCalls))
+	}
+}
+
+func TestDeleteDirectoryNotEmpty(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "rmdir: '/data/logs': Directory not empty\n", errors.New("command terminated with exit code 1"))
+	c := newTransferClient(mock)
+
+	err := c.DeleteDirectory(context.Background(), "default", "my-pvc", "/logs", false)
+	if err == nil || !strings.Contains(err.Error(), "Directory not empty") {
+		t.Errorf("expected the rmdir error to be surfaced, got %v", err)
+	}
+}
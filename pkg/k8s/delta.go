@@ -0,0 +1,269 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A delta download fetches only the parts of a file that a local copy
+// lacks, as rsync does, without needing anything in the pod beyond dd,
+// cksum and md5sum. The pod describes the file block by block (see
+// FileSignature); the local copy is scanned with a rolling checksum for
+// those blocks at any offset, so data that moved because bytes were
+// inserted earlier in the file is found too (see MatchBlocks); and only
+// the blocks found nowhere are read from the pod (see ReadFileBlocks).
+
+// BlockSignature describes a file block by block: every BlockSize bytes,
+// the last block possibly shorter.
+type BlockSignature struct {
+	Size      int64      `json:"size"`
+	ModTime   time.Time  `json:"modTime,omitempty"`
+	BlockSize int64      `json:"blockSize"`
+	Blocks    []BlockSum `json:"blocks"`
+}
+
+// BlockSum is the checksum of a block as POSIX cksum prints it, cheap to
+// roll over a file, and its MD5, to confirm a match.
+type BlockSum struct {
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+// BlockLen returns the length of block i.
+func (s *BlockSignature) BlockLen(i int) int64 {
+	return min(s.BlockSize, s.Size-int64(i)*s.BlockSize)
+}
+
+// signatureScript prints the size of $1 and its modification time in
+// seconds since the epoch, then the cksum and md5sum lines of each of its
+// blocks of $2 bytes.
+const signatureScript = `size=$(wc -c < "$1") || exit
+echo "$size $(date -r "$1" +%s 2>/dev/null)"
+n=$(( (size + $2 - 1) / $2 ))
+i=0
+while [ "$i" -lt "$n" ]; do
+  dd if="$1" bs="$2" skip="$i" count=1 2>/dev/null | cksum || exit
+  dd if="$1" bs="$2" skip="$i" count=1 2>/dev/null | md5sum || exit
+  i=$((i + 1))
+done`
+
+// FileSignature reads the block signature of a file of the PVC in the pod.
+// It reads the file twice over, so it costs the pod about as much disk
+// time as downloading it, but sends only a few dozen bytes per block.
+func (c *Client) FileSignature(ctx context.Context, namespace, pvcName, filePath string, blockSize int64) (*BlockSignature, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	stdout, _, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"sh", "-c", signatureScript, "sh", pvcPath(mountPath, filePath), strconv.FormatInt(blockSize, 10)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseSignature(stdout, blockSize)
+}
+
+// parseSignature reads the output of signatureScript.
+func parseSignature(out string, blockSize int64) (*BlockSignature, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	head := strings.Fields(lines[0])
+	if len(head) == 0 {
+		return nil, fmt.Errorf("unexpected file size %q", lines[0])
+	}
+	size, err := strconv.ParseInt(head[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected file size %q", lines[0])
+	}
+	sig := &BlockSignature{Size: size, BlockSize: blockSize}
+	if len(head) > 1 {
+		// A date without -r leaves the time out.
+		if secs, err := strconv.ParseInt(head[1], 10, 64); err == nil {
+			sig.ModTime = time.Unix(secs, 0)
+		}
+	}
+	n := int((size + blockSize - 1) / blockSize)
+	if len(lines) != 1+2*n {
+		return nil, fmt.Errorf("expected checksums of %d blocks, got %d lines", n, len(lines)-1)
+	}
+	for i := 0; i < n; i++ {
+		crc := strings.Fields(lines[1+2*i])
+		sum := strings.Fields(lines[2+2*i])
+		if len(crc) < 2 || len(sum) < 1 {
+			return nil, fmt.Errorf("unexpected checksums of block %d", i)
+		}
+		weak, err := strconv.ParseUint(crc[0], 10, 32)
+		if err != nil || crc[1] != strconv.FormatInt(sig.BlockLen(i), 10) {
+			return nil, fmt.Errorf("unexpected cksum of block %d: %q", i, lines[1+2*i])
+		}
+		sig.Blocks = append(sig.Blocks, BlockSum{Weak: uint32(weak), Strong: strings.ToLower(sum[0])})
+	}
+	return sig, nil
+}
+
+// ReadFileBlocks writes count blocks of blockSize bytes of a file of the
+// PVC, starting at block first, to w.
+func (c *Client) ReadFileBlocks(ctx context.Context, namespace, pvcName, filePath string, blockSize, first, count int64, w io.Writer) error {
+	return c.streamOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"dd", "if=" + pvcPath(mountPath, filePath), "bs=" + strconv.FormatInt(blockSize, 10),
+			"skip=" + strconv.FormatInt(first, 10), "count=" + strconv.FormatInt(count, 10)}
+	}, nil, w)
+}
+
+// SignBlocks computes the block signature of r as FileSignature would.
+func SignBlocks(r io.Reader, blockSize int64) (*BlockSignature, error) {
+	sig := &BlockSignature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := md5.Sum(buf[:n])
+			sig.Blocks = append(sig.Blocks, BlockSum{Weak: Cksum(buf[:n]), Strong: hex.EncodeToString(sum[:])})
+			sig.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cksumTable is the CRC-32 table of POSIX cksum: polynomial 0x04C11DB7,
+// most significant bit first.
+var cksumTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04C11DB7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+func cksumUpdate(crc uint32, b byte) uint32 {
+	return crc<<8 ^ cksumTable[byte(crc>>24)^b]
+}
+
+// cksumFinish turns the CRC of n bytes into what cksum prints, which
+// also covers n.
+func cksumFinish(crc uint32, n int64) uint32 {
+	for ; n > 0; n >>= 8 {
+		crc = cksumUpdate(crc, byte(n))
+	}
+	return ^crc
+}
+
+// Cksum returns the checksum POSIX cksum prints for data.
+func Cksum(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = cksumUpdate(crc, b)
+	}
+	return cksumFinish(crc, int64(len(data)))
+}
+
+// MatchBlocks finds the full blocks of sig in old, a local copy of size
+// bytes, returning for each block its offset in old, or -1. The shorter
+// last block is never looked for. A window of BlockSize bytes rolls over
+// old one byte at a time; its cksum is updated in constant time, since
+// the CRC is linear, and only a window whose cksum is that of a block has
+// its MD5 computed.
+func MatchBlocks(old io.ReaderAt, size int64, sig *BlockSignature) ([]int64, error) {
+	found := make([]int64, len(sig.Blocks))
+	byWeak := map[uint32][]int{}
+	for i := range sig.Blocks {
+		found[i] = -1
+		if sig.BlockLen(i) == sig.BlockSize {
+			byWeak[sig.Blocks[i].Weak] = append(byWeak[sig.Blocks[i].Weak], i)
+		}
+	}
+	w := sig.BlockSize
+	if len(byWeak) == 0 || size < w {
+		return found, nil
+	}
+
+	// out[b] takes byte b leaving the window out of its CRC: the CRC of b
+	// followed by w zero bytes, which is the XOR of that of its bits.
+	var bits [8]uint32
+	for k := range bits {
+		crc := cksumUpdate(0, byte(1)<<k)
+		for i := int64(0); i < w; i++ {
+			crc = cksumUpdate(crc, 0)
+		}
+		bits[k] = crc
+	}
+	var out [256]uint32
+	for b := range out {
+		for k := range bits {
+			if b&(1<<k) != 0 {
+				out[b] ^= bits[k]
+			}
+		}
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(old, 0, size), 1<<20)
+	window := make([]byte, w)
+	head := 0 // index in window of the oldest byte
+	var crc uint32
+	fill := func() bool {
+		if _, err := io.ReadFull(r, window); err != nil {
+			return false
+		}
+		head, crc = 0, 0
+		for _, b := range window {
+			crc = cksumUpdate(crc, b)
+		}
+		return true
+	}
+	if !fill() {
+		return found, nil
+	}
+	h := md5.New()
+	for pos := int64(0); ; {
+		if candidates, ok := byWeak[cksumFinish(crc, w)]; ok {
+			h.Reset()
+			h.Write(window[head:])
+			h.Write(window[:head])
+			strong := hex.EncodeToString(h.Sum(nil))
+			matched := false
+			for _, i := range candidates {
+				if found[i] < 0 && sig.Blocks[i].Strong == strong {
+					found[i], matched = pos, true
+				}
+			}
+			if matched {
+				// Blocks rarely overlap: look for the next one after
+				// this one.
+				pos += w
+				if !fill() {
+					return found, nil
+				}
+				continue
+			}
+		}
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		crc = cksumUpdate(crc, b) ^ out[window[head]]
+		window[head] = b
+		head = (head + 1) % len(window)
+		pos++
+	}
+}
@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCksum(t *testing.T) {
+	// As printed by cksum for "hello\n" and for nothing.
+	for in, want := range map[string]uint32{"hello\n": 3015617425, "": 4294967295} {
+		if got := Cksum([]byte(in)); got != want {
+			t.Errorf("%q: expected %d, got %d", in, want, got)
+		}
+	}
+}
+
+func TestMatchBlocks(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	old := make([]byte, 10*64)
+	rng.Read(old)
+
+	// Bytes inserted into block 2 and appended at the end: blocks 0, 1 and
+	// 3 to 9 are still in the old copy, the last ones shifted by 5 bytes.
+	edited := append(append([]byte{}, old[:150]...), "12345"...)
+	edited = append(append(edited, old[150:]...), "tail"...)
+	sig, err := SignBlocks(bytes.NewReader(edited), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Size != int64(len(edited)) || len(sig.Blocks) != 11 || sig.BlockLen(10) != 9 {
+		t.Fatalf("unexpected signature: size %d, %d blocks", sig.Size, len(sig.Blocks))
+	}
+
+	found, err := MatchBlocks(bytes.NewReader(old), int64(len(old)), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, off := range found {
+		want := int64(-1)
+		switch {
+		case i < 2:
+			want = int64(i * 64)
+		case i >= 3 && i < 10:
+			want = int64(i*64 - 5)
+		}
+		if off != want {
+			t.Errorf("block %d: expected offset %d, got %d", i, want, off)
+		}
+		if off >= 0 && !bytes.Equal(old[off:off+64], edited[i*64:i*64+64]) {
+			t.Errorf("block %d matched different data at %d", i, off)
+		}
+	}
+}
+
+func TestFileSignature(t *testing.T) {
+	data := "0123456789abcdefXYZ"
+	want, _ := SignBlocks(strings.NewReader(data), 8)
+	want.ModTime = time.Unix(1700000000, 0)
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d 1700000000\n", len(data))
+	for i, b := range want.Blocks {
+		fmt.Fprintf(&out, "%d %d\n%s  -\n", b.Weak, want.BlockLen(i), b.Strong)
+	}
+
+	mock := &mockPodExecutor{}
+	mock.pushExec(out.String(), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+	sig, err := c.FileSignature(context.Background(), "default", "my-pvc", "/dumps/db.sql", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sig) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, sig)
+	}
+	cmd := mock.execCalls[0].cmd
+	if cmd[0] != "sh" || strings.Join(cmd[3:], " ") != "sh /data/dumps/db.sql 8" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+
+	mock.pushExec("19\n1 8\nabc  -\n", "", nil)
+	if _, err := c.FileSignature(context.Background(), "default", "my-pvc", "/dumps/db.sql", 8); err == nil {
+		t.Error("expected a truncated signature to be refused")
+	}
+}
+
+func TestReadFileBlocks(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("block", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+	var buf bytes.Buffer
+	if err := c.ReadFileBlocks(context.Background(), "default", "my-pvc", "/dumps/db.sql", 1048576, 3, 2, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "block" {
+		t.Errorf("got %q", buf.String())
+	}
+	want := "dd if=/data/dumps/db.sql bs=1048576 skip=3 count=2"
+	if got := strings.Join(mock.streamCalls[0].cmd, " "); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,1214 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DemoContext is the context name a DemoCluster reports.
+const DemoContext = "demo"
+
+// DemoCluster is an in-memory stand-in for a cluster: namespaces, PVCs and
+// the files on them. It serves --demo, where the UI runs without any
+// cluster, and handler tests. Operations that only make sense against real
+// pods (containers, archives, migrations) return an error.
+type DemoCluster struct {
+	mu         sync.Mutex
+	namespaces map[string]bool
+	volumes    map[PVCRef]*demoVolume
+	// snapshots are keyed by namespace and snapshot name.
+	snapshots map[PVCRef]*demoSnapshot
+	now       func() time.Time
+}
+
+type demoVolume struct {
+	info  PVCInfo
+	files map[string]*demoFile
+}
+
+// demoSnapshot is a copy of a claim's files at one point in time.
+type demoSnapshot struct {
+	source  string
+	created time.Time
+	info    PVCInfo
+	files   map[string]*demoFile
+}
+
+type demoFile struct {
+	data  []byte
+	dir   bool
+	mode  string
+	owner string
+	mod   time.Time
+}
+
+// NewDemoCluster returns an empty DemoCluster.
+func NewDemoCluster() *DemoCluster {
+	return &DemoCluster{
+		namespaces: make(map[string]bool),
+		volumes:    make(map[PVCRef]*demoVolume),
+		snapshots:  make(map[PVCRef]*demoSnapshot),
+		now:        time.Now,
+	}
+}
+
+// NewSampleDemoCluster returns a DemoCluster with a few namespaces, PVCs
+// and files worth clicking through.
+func NewSampleDemoCluster() *DemoCluster {
+	c := NewDemoCluster()
+	c.AddNamespace("kube-system")
+	c.AddPVC(PVCInfo{Namespace: "default", Name: "web-content", Capacity: "1Gi", StorageClass: "standard", Labels: map[string]string{"team": "web"}})
+	c.AddPVC(PVCInfo{Namespace: "analytics", Name: "notebooks", Capacity: "10Gi", StorageClass: "fast-ssd", Labels: map[string]string{"team": "data"}})
+	c.AddPVC(PVCInfo{Namespace: "analytics", Name: "postgres-data", Capacity: "20Gi", StorageClass: "fast-ssd", Labels: map[string]string{"team": "data", "tier": "db"}})
+
+	samples := []struct {
+		ns, pvc, path, content string
+	}{
+		{"default", "web-content", "/README.md", "# Web content\n\nStatic files served by the **nginx** deployment.\n\n- `html/` holds the pages\n- `config/` holds the site settings\n"},
+		{"default", "web-content", "/html/index.html", "<!doctype html>\n<title>Hello</title>\n<h1>Hello from KubeBrowser</h1>\n"},
+		{"default", "web-content", "/html/about.html", "<!doctype html>\n<title>About</title>\n<p>About this demo.</p>\n"},
+		{"default", "web-content", "/config/site.json", `{"title":"Demo site","languages":["en","pt"],"cache":{"enabled":true,"ttl":300}}`},
+		{"default", "web-content", "/config/nginx.yaml", "server:\n  listen: 8080\n  root: /usr/share/nginx/html\n  gzip: true\n"},
+		{"analytics", "notebooks", "/reports/summary.md", "# Monthly summary\n\n| Metric | Value |\n|---|---|\n| Users | 1204 |\n| Sessions | 5310 |\n"},
+		{"analytics", "notebooks", "/reports/2024-01.csv", "day,users\n1,40\n2,38\n3,45\n"},
+		{"analytics", "notebooks", "/scratch/.keep", ""},
+		{"analytics", "postgres-data", "/PG_VERSION", "16\n"},
+		{"analytics", "postgres-data", "/postgresql.conf", "max_connections = 100\nshared_buffers = 128MB\n"},
+		{"analytics", "postgres-data", "/base/1/1259", strings.Repeat("\x00", 8192)},
+	}
+	for _, s := range samples {
+		c.WriteFile(s.ns, s.pvc, s.path, []byte(s.content))
+	}
+	// Last night's snapshot still has the old page.
+	c.AddSnapshot("default", "web-content", "web-content-nightly", c.now().Add(-12*time.Hour))
+	c.WriteFile("default", "web-content", "/html/index.html", []byte("<!doctype html>\n<title>Hello</title>\n<h1>Hello from KubeBrowser</h1>\n<p>Now with a broken <b>tag\n"))
+	return c
+}
+
+// AddNamespace adds an empty namespace.
+func (c *DemoCluster) AddNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.namespaces[namespace] = true
+}
+
+// AddPVC adds a bound, empty claim (and its namespace). Unset fields get
+// the defaults of a claim mounted at /data by a running pod.
+func (c *DemoCluster) AddPVC(info PVCInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addPVC(info)
+}
+
+func (c *DemoCluster) addPVC(info PVCInfo) *demoVolume {
+	if info.Status == "" {
+		info.Status = "Bound"
+	}
+	if info.AccessModes == "" {
+		info.AccessModes = "ReadWriteOnce"
+	}
+	if info.MountedBy == "" {
+		info.MountedBy = info.Name + "-0"
+	}
+	if info.MountPath == "" {
+		info.MountPath = "/data"
+	}
+	c.namespaces[info.Namespace] = true
+	vol := &demoVolume{
+		info:  info,
+		files: map[string]*demoFile{"/": {dir: true, mode: "755", owner: "root:root", mod: c.now()}},
+	}
+	c.volumes[PVCRef{Namespace: info.Namespace, PVC: info.Name}] = vol
+	return vol
+}
+
+// WriteFile stores data at filePath on a PVC, creating parent directories
+// like mkdir -p.
+func (c *DemoCluster) WriteFile(namespace, pvcName, filePath string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(vol, demoPath(filePath), data)
+}
+
+func (c *DemoCluster) writeFile(vol *demoVolume, p string, data []byte) error {
+	if p == "/" {
+		return fmt.Errorf("cannot write to the root of a PVC")
+	}
+	if err := c.mkdirAll(vol, gopath.Dir(p)); err != nil {
+		return err
+	}
+	if f, ok := vol.files[p]; ok && f.dir {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	vol.files[p] = &demoFile{data: append([]byte(nil), data...), mode: "644", owner: "root:root", mod: c.now()}
+	return nil
+}
+
+func (c *DemoCluster) mkdirAll(vol *demoVolume, dir string) error {
+	if f, ok := vol.files[dir]; ok {
+		if !f.dir {
+			return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is not a directory.", dir)}
+		}
+		return nil
+	}
+	if err := c.mkdirAll(vol, gopath.Dir(dir)); err != nil {
+		return err
+	}
+	vol.files[dir] = &demoFile{dir: true, mode: "755", owner: "root:root", mod: c.now()}
+	return nil
+}
+
+func (c *DemoCluster) volume(namespace, pvcName string) (*demoVolume, error) {
+	vol, ok := c.volumes[PVCRef{Namespace: namespace, PVC: pvcName}]
+	if !ok {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("PVC %s not found in namespace %s.", pvcName, namespace)}
+	}
+	return vol, nil
+}
+
+func (c *DemoCluster) lookup(namespace, pvcName, filePath string) (*demoVolume, string, *demoFile, error) {
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	p := demoPath(filePath)
+	f, ok := vol.files[p]
+	if !ok {
+		return vol, p, nil, &K8sError{Kind: ErrKindPathNotFound, Message: fmt.Sprintf("%s: no such file or directory.", p)}
+	}
+	return vol, p, f, nil
+}
+
+// demoPath normalizes a PVC-relative path to the absolute form used as a
+// map key.
+func demoPath(p string) string {
+	return gopath.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+}
+
+// subtree returns p and every path below it, sorted.
+func (v *demoVolume) subtree(p string) []string {
+	var paths []string
+	for q := range v.files {
+		if q == p || p == "/" || strings.HasPrefix(q, p+"/") {
+			paths = append(paths, q)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// info describes the entry at p as a listing or search rooted at root
+// would, with buildFilePath's path form.
+func (f *demoFile) info(p, root string) FileInfo {
+	size := strconv.Itoa(len(f.data))
+	if f.dir {
+		size = "4096"
+	}
+	mode, _ := strconv.ParseUint(f.mode, 8, 32)
+	m := fs.FileMode(mode) & fs.ModePerm
+	if f.dir {
+		m |= fs.ModeDir
+	}
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	owner, group, _ := strings.Cut(f.owner, ":")
+	return FileInfo{
+		Name:    gopath.Base(p),
+		Size:    size,
+		ModTime: formatModTime(f.mod),
+		IsDir:   f.dir,
+		Path:    buildFilePath(root, strings.TrimPrefix(p, strings.TrimSuffix(root, "/")+"/")),
+		Mode:    FormatMode(m),
+		UID:     demoID(owner),
+		GID:     demoID(group),
+	}
+}
+
+// demoID is the numeric form of a demo file's owner or group, which the
+// sample data gives by name.
+func demoID(name string) string {
+	if name == "root" {
+		return "0"
+	}
+	return name
+}
+
+func demoUnsupported(op string) error {
+	return &K8sError{Kind: ErrKindUnknown, Message: op + " is not available in demo mode."}
+}
+
+func (c *DemoCluster) Connection() (kubeconfigPath, contextName string) {
+	return "", DemoContext
+}
+
+func (c *DemoCluster) RegistryMirror() string { return "" }
+
+func (c *DemoCluster) CredentialStatus() CredentialStatus { return CredentialStatus{} }
+
+func (c *DemoCluster) ExecSessions() (inUse, limit int) { return 0, 0 }
+
+func (c *DemoCluster) ListNamespaces(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var namespaces []string
+	for ns := range c.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (c *DemoCluster) ListPVCs(ctx context.Context, namespace string) ([]PVCInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pvcs []PVCInfo
+	for ref, vol := range c.volumes {
+		if namespace == "" || ref.Namespace == namespace {
+			pvcs = append(pvcs, vol.info)
+		}
+	}
+	sortPVCs(pvcs)
+	return pvcs, nil
+}
+
+func (c *DemoCluster) SelectPVCs(ctx context.Context, selector string) ([]PVCInfo, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pvcs := []PVCInfo{}
+	for _, vol := range c.volumes {
+		if sel.Matches(labels.Set(vol.info.Labels)) {
+			pvcs = append(pvcs, vol.info)
+		}
+	}
+	sortPVCs(pvcs)
+	return pvcs, nil
+}
+
+func (c *DemoCluster) StorageClasses(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := map[string]bool{"standard": true}
+	for _, vol := range c.volumes {
+		if vol.info.StorageClass != "" {
+			seen[vol.info.StorageClass] = true
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (c *DemoCluster) ListFiles(ctx context.Context, namespace, pvcName, path string) ([]FileInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, p, f, err := c.lookup(namespace, pvcName, path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.dir {
+		return []FileInfo{f.info(p, gopath.Dir(p))}, nil
+	}
+	files := []FileInfo{}
+	for q, child := range vol.files {
+		if q != "/" && gopath.Dir(q) == p {
+			files = append(files, child.info(q, p))
+		}
+	}
+	return files, nil
+}
+
+// StreamFiles hands the entries of ListFiles to fn one by one.
+func (c *DemoCluster) StreamFiles(ctx context.Context, namespace, pvcName, path string, fn func(FileInfo) error) error {
+	files, err := c.ListFiles(ctx, namespace, pvcName, path)
+	if err != nil {
+		return err
+	}
+	return emitFiles(files, fn)
+}
+
+func (c *DemoCluster) DownloadFile(ctx context.Context, namespace, pvcName, filePath string) (io.ReadCloser, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, p, f, err := c.lookup(namespace, pvcName, filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	if f.dir {
+		return nil, "", &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), gopath.Base(p), nil
+}
+
+func (c *DemoCluster) ReadFileHead(ctx context.Context, namespace, pvcName, filePath string, limit int) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, p, f, err := c.lookup(namespace, pvcName, filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	if f.dir {
+		return nil, false, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	if len(f.data) > limit {
+		return append([]byte(nil), f.data[:limit]...), true, nil
+	}
+	return append([]byte(nil), f.data...), false, nil
+}
+
+func (c *DemoCluster) FileChecksum(ctx context.Context, namespace, pvcName, filePath, algo string) (*FileChecksum, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := c.DownloadFile(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	io.Copy(h, rc)
+	return &FileChecksum{Path: filePath, Algorithm: algo, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// VerifyReadBack reads the files back at once: the demo cluster has a
+// single node and no cache to be late.
+func (c *DemoCluster) VerifyReadBack(ctx context.Context, namespace, pvcName, algo string, files []ReadBackFile, wait time.Duration) (*ReadBackReport, error) {
+	if _, err := NewHash(algo); err != nil {
+		return nil, err
+	}
+	report := &ReadBackReport{Algorithm: algo, WriterNode: "demo-node", Node: "demo-node"}
+	report.Files = checkReadBack(ctx, files, 0, 0, func(ctx context.Context, p string) (string, error) {
+		sum, err := c.FileChecksum(ctx, namespace, pvcName, p, algo)
+		if err != nil {
+			return "", err
+		}
+		return sum.Checksum, nil
+	})
+	return report, nil
+}
+
+func (c *DemoCluster) FileSignature(ctx context.Context, namespace, pvcName, filePath string, blockSize int64) (*BlockSignature, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	rc, _, err := c.DownloadFile(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	sig, err := SignBlocks(rc, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, _, f, err := c.lookup(namespace, pvcName, filePath); err == nil {
+		sig.ModTime = f.mod
+	}
+	return sig, nil
+}
+
+func (c *DemoCluster) ReadFileBlocks(ctx context.Context, namespace, pvcName, filePath string, blockSize, first, count int64, w io.Writer) error {
+	rc, _, err := c.DownloadFile(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if _, err := io.CopyN(io.Discard, rc, first*blockSize); err != nil && err != io.EOF {
+		return err
+	}
+	_, err = io.CopyN(w, rc, count*blockSize)
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+func (c *DemoCluster) UploadFile(ctx context.Context, namespace, pvcName, destPath string, data io.Reader) error {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return c.WriteFile(namespace, pvcName, destPath, content)
+}
+
+// SaveFile replaces a file's contents, keeping its mode and owner.
+func (c *DemoCluster) SaveFile(ctx context.Context, namespace, pvcName, filePath string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	p := demoPath(filePath)
+	old := vol.files[p]
+	if err := c.writeFile(vol, p, data); err != nil {
+		return err
+	}
+	if old != nil {
+		vol.files[p].mode, vol.files[p].owner = old.mode, old.owner
+	}
+	return nil
+}
+
+func (c *DemoCluster) RemoveFile(ctx context.Context, namespace, pvcName, filePath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	p := demoPath(filePath)
+	if f, ok := vol.files[p]; ok && !f.dir {
+		delete(vol.files, p)
+	}
+	return nil
+}
+
+func (c *DemoCluster) DeleteFile(ctx context.Context, namespace, pvcName, filePath string) error {
+	if err := checkDeletable(filePath); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, p, f, err := c.lookup(namespace, pvcName, filePath)
+	if err != nil {
+		return err
+	}
+	if f.dir {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	delete(vol.files, p)
+	return nil
+}
+
+func (c *DemoCluster) DeleteDirectory(ctx context.Context, namespace, pvcName, dirPath string, recursive bool) error {
+	if err := checkDeletable(dirPath); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, p, f, err := c.lookup(namespace, pvcName, dirPath)
+	if err != nil {
+		return err
+	}
+	if !f.dir {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is not a directory.", p)}
+	}
+	tree := vol.subtree(p)
+	if len(tree) > 1 && !recursive {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s: directory not empty.", p)}
+	}
+	for _, q := range tree {
+		delete(vol.files, q)
+	}
+	return nil
+}
+
+func (c *DemoCluster) ApplyPermissions(ctx context.Context, namespace, pvcName, filePath string, perms FilePermissions, isDir bool) (FilePermissions, error) {
+	if err := perms.Validate(); err != nil {
+		return perms, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _, f, err := c.lookup(namespace, pvcName, filePath)
+	if err != nil {
+		return perms, err
+	}
+	f.apply(perms)
+	return perms, nil
+}
+
+// apply changes f's mode and owner as chmod and chown would.
+func (f *demoFile) apply(perms FilePermissions) {
+	if perms.Mode != "" {
+		now, _ := strconv.ParseUint(f.mode, 8, 32)
+		f.mode = fmt.Sprintf("%o", ApplyChmod(uint32(now), perms.Mode, f.dir))
+	}
+	if perms.Owner != "" {
+		user, group, _ := strings.Cut(f.owner, ":")
+		newUser, newGroup, hasGroup := strings.Cut(perms.Owner, ":")
+		if newUser != "" {
+			user = newUser
+		}
+		if hasGroup && newGroup != "" {
+			group = newGroup
+		}
+		f.owner = user + ":" + group
+	}
+}
+
+func (c *DemoCluster) ChangePermissions(ctx context.Context, namespace, pvcName, filePath string, perms FilePermissions, recursive bool) error {
+	if err := perms.ValidateChange(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, p, f, err := c.lookup(namespace, pvcName, filePath)
+	if err != nil {
+		return err
+	}
+	if !recursive {
+		f.apply(perms)
+		return nil
+	}
+	for _, q := range vol.subtree(p) {
+		vol.files[q].apply(perms)
+	}
+	return nil
+}
+
+func (c *DemoCluster) PathsExist(ctx context.Context, namespace, pvcName string, paths []string) ([]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	exist := make([]bool, len(paths))
+	for i, p := range paths {
+		_, exist[i] = vol.files[demoPath(p)]
+	}
+	return exist, nil
+}
+
+func (c *DemoCluster) ResolvePath(ctx context.Context, namespace, pvcName, filePath string) (*PathInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, p, f, err := c.lookup(namespace, pvcName, filePath)
+	if f == nil {
+		if ke, ok := err.(*K8sError); !ok || ke.Kind != ErrKindPathNotFound {
+			return nil, err
+		}
+		dir := gopath.Dir(p)
+		for dir != "/" {
+			if d, ok := vol.files[dir]; ok && d.dir {
+				break
+			}
+			dir = gopath.Dir(dir)
+		}
+		return &PathInfo{Path: p, NavigatePath: dir}, nil
+	}
+
+	owner, group, _ := strings.Cut(f.owner, ":")
+	info := &PathInfo{
+		Path:       p,
+		Exists:     true,
+		IsDir:      f.dir,
+		Readable:   true,
+		Writable:   true,
+		Executable: f.dir,
+		Mode:       f.mode,
+		Owner:      owner,
+		Group:      group,
+		Size:       int64(len(f.data)),
+	}
+	if f.dir {
+		info.NavigatePath = p
+	} else {
+		info.NavigatePath = gopath.Dir(p)
+		info.FileName = gopath.Base(p)
+	}
+	return info, nil
+}
+
+func (c *DemoCluster) CompletePath(ctx context.Context, namespace, pvcName, prefix string) (*PathCompletion, error) {
+	return CompleteFromListing(prefix, func(dir string) ([]FileInfo, error) {
+		return c.ListFiles(ctx, namespace, pvcName, dir)
+	})
+}
+
+func (c *DemoCluster) SearchFiles(ctx context.Context, namespace, pvcName string, q SearchQuery) (*SearchResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, root, f, err := c.lookup(namespace, pvcName, q.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := []FileInfo{}
+	if f.dir {
+		for _, p := range vol.subtree(root) {
+			entry := vol.files[p]
+			rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+			if p != root && q.Match(rel, entry.dir, int64(len(entry.data)), entry.mod, now) {
+				files = append(files, entry.info(p, root))
+			}
+		}
+	}
+
+	result := &SearchResult{Files: files}
+	if len(files) > limit {
+		result.Files = files[:limit]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// StreamSearch hands the matches of SearchFiles to fn one by one.
+func (c *DemoCluster) StreamSearch(ctx context.Context, namespace, pvcName string, q SearchQuery, fn func(FileInfo) error) (bool, error) {
+	result, err := c.SearchFiles(ctx, namespace, pvcName, q)
+	return emitSearch(result, err, fn)
+}
+
+// FilesystemUsage reports the claim's capacity as the filesystem size and
+// the files on it as used.
+func (c *DemoCluster) FilesystemUsage(ctx context.Context, namespace, pvcName string) (*FilesystemUsage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, _, _, err := c.lookup(namespace, pvcName, "/")
+	if err != nil {
+		return nil, err
+	}
+	usage := &FilesystemUsage{}
+	for _, f := range vol.files {
+		usage.UsedBytes += int64(len(f.data))
+		if f.dir {
+			usage.UsedBytes += 4096
+		}
+		usage.InodesUsed++
+	}
+	usage.TotalBytes = usage.UsedBytes
+	if q, err := resource.ParseQuantity(vol.info.Capacity); err == nil && q.Value() > usage.UsedBytes {
+		usage.TotalBytes = q.Value()
+	}
+	usage.AvailableBytes = usage.TotalBytes - usage.UsedBytes
+	return usage, nil
+}
+
+func (c *DemoCluster) DiskUsage(ctx context.Context, namespace, pvcName string, paths []string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for _, path := range paths {
+		vol, p, _, err := c.lookup(namespace, pvcName, path)
+		if err != nil {
+			return 0, err
+		}
+		for _, q := range vol.subtree(p) {
+			total += int64(len(vol.files[q].data))
+		}
+	}
+	return total, nil
+}
+
+// StreamDiskUsage reports the total of each of paths, as DiskUsage counts
+// it; maxDepth is ignored.
+func (c *DemoCluster) StreamDiskUsage(ctx context.Context, namespace, pvcName string, paths []string, maxDepth int, fn func(DirUsage) error) (int64, error) {
+	var total int64
+	for _, p := range paths {
+		n, err := c.DiskUsage(ctx, namespace, pvcName, []string{p})
+		if err != nil {
+			return 0, err
+		}
+		total += n
+		if err := fn(DirUsage{Path: p, Bytes: n}); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+func (c *DemoCluster) MeasurePaths(ctx context.Context, namespace, pvcName string, paths []string) (*PathUsage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	usage := &PathUsage{}
+	for _, path := range paths {
+		vol, p, _, err := c.lookup(namespace, pvcName, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range vol.subtree(p) {
+			if f := vol.files[q]; !f.dir {
+				usage.Bytes += int64(len(f.data))
+				usage.Files++
+			}
+		}
+	}
+	return usage, nil
+}
+
+// StreamArchive writes a gzip-compressed tar of paths, with the same
+// PVC-relative names tar produces in a pod and the same exclusions.
+func (c *DemoCluster) StreamArchive(ctx context.Context, namespace, pvcName string, paths, exclude []string, w io.Writer) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths to archive")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, path := range paths {
+		vol, p, _, err := c.lookup(namespace, pvcName, path)
+		if err != nil {
+			return err
+		}
+		for _, q := range vol.subtree(p) {
+			if ExcludedPath(exclude, q) {
+				continue
+			}
+			f := vol.files[q]
+			mode, _ := strconv.ParseInt(f.mode, 8, 64)
+			hdr := &tar.Header{Name: relativePVCPath(q), Mode: mode, ModTime: f.mod, Typeflag: tar.TypeReg, Size: int64(len(f.data))}
+			if f.dir {
+				hdr.Name += "/"
+				hdr.Typeflag = tar.TypeDir
+				hdr.Size = 0
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(f.data); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (c *DemoCluster) UnpackArchive(ctx context.Context, namespace, pvcName, destDir string, r io.Reader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	destDir = demoPath(destDir)
+	if err := c.mkdirAll(vol, destDir); err != nil {
+		return err
+	}
+	return ReadArchive(r, func(name string, hdr *tar.Header, body io.Reader) error {
+		target := gopath.Join(destDir, name)
+		if hdr.Typeflag == tar.TypeDir {
+			return c.mkdirAll(vol, target)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if err := c.writeFile(vol, target, data); err != nil {
+			return err
+		}
+		f := vol.files[target]
+		if hdr.Mode&0o777 != 0 {
+			f.mode = strconv.FormatInt(hdr.Mode&0o777, 8)
+		}
+		if !hdr.ModTime.IsZero() {
+			f.mod = hdr.ModTime
+		}
+		return nil
+	})
+}
+
+// Move renames src to dst within one PVC, like mv.
+func (c *DemoCluster) Move(ctx context.Context, namespace, pvcName, src, dst string) error {
+	if err := checkRename(src, dst); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, from, _, err := c.lookup(namespace, pvcName, src)
+	if err != nil {
+		return err
+	}
+	to := demoPath(dst)
+	if _, ok := vol.files[to]; ok {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s: file exists.", to)}
+	}
+	if err := c.mkdirAll(vol, gopath.Dir(to)); err != nil {
+		return err
+	}
+	for _, q := range vol.subtree(from) {
+		vol.files[to+strings.TrimPrefix(q, from)] = vol.files[q]
+		delete(vol.files, q)
+	}
+	return nil
+}
+
+// MoveBetweenPVCs moves paths into destDir on dst. Like the real move, the
+// source is only removed once everything has been copied.
+func (c *DemoCluster) MoveBetweenPVCs(ctx context.Context, src PVCRef, paths []string, dst PVCRef, destDir string, stage func(MoveStage), progress func(int64)) (int, error) {
+	if src == dst {
+		return 0, fmt.Errorf("source and destination are the same PVC; move between two claims")
+	}
+	for _, p := range paths {
+		if relativePVCPath(p) == "." {
+			return 0, fmt.Errorf("cannot move the root of a PVC; select the entries inside it")
+		}
+	}
+	if stage == nil {
+		stage = func(MoveStage) {}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stage(MoveCopying)
+	files, err := c.copyTree(src, paths, dst, destDir, progress)
+	if err != nil {
+		return 0, err
+	}
+	stage(MoveVerifying)
+	stage(MoveDeleting)
+	vol := c.volumes[src]
+	for _, p := range paths {
+		for _, q := range vol.subtree(demoPath(p)) {
+			delete(vol.files, q)
+		}
+	}
+	return files, nil
+}
+
+// ClonePVC copies a claim and its files into another namespace.
+func (c *DemoCluster) ClonePVC(ctx context.Context, req CloneRequest, progress func(int64)) (*CloneResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.TargetName == "" {
+		req.TargetName = req.PVC
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	src, err := c.volume(req.Namespace, req.PVC)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{req.TargetName}
+	if req.OnConflict == CloneConflictRename {
+		candidates = append(candidates, req.TargetName+"-clone")
+		for i := 2; i <= 20; i++ {
+			candidates = append(candidates, fmt.Sprintf("%s-clone-%d", req.TargetName, i))
+		}
+	}
+	name := ""
+	renamed := false
+	for i, candidate := range candidates {
+		if _, taken := c.volumes[PVCRef{Namespace: req.TargetNamespace, PVC: candidate}]; !taken {
+			name, renamed = candidate, i > 0
+			break
+		}
+	}
+	if name == "" {
+		if req.OnConflict == CloneConflictRename {
+			return nil, fmt.Errorf("no free name for the clone of %s in %s", req.PVC, req.TargetNamespace)
+		}
+		return nil, fmt.Errorf("PVC %s already exists in %s; choose another name or rename on conflict", req.TargetName, req.TargetNamespace)
+	}
+
+	info := src.info
+	info.Namespace, info.Name, info.MountedBy, info.MountPath = req.TargetNamespace, name, "", ""
+	if req.StorageClass != "" {
+		info.StorageClass = req.StorageClass
+	}
+	c.addPVC(info)
+	target := PVCRef{Namespace: req.TargetNamespace, PVC: name}
+	if _, err := c.copyTree(PVCRef{Namespace: req.Namespace, PVC: req.PVC}, []string{"/"}, target, "/", progress); err != nil {
+		delete(c.volumes, target)
+		return nil, err
+	}
+	return &CloneResult{Target: target, Renamed: renamed, StorageClass: info.StorageClass, Size: info.Capacity}, nil
+}
+
+// copyTree copies paths from src into destDir on dst and returns the
+// number of regular files copied. c.mu must be held.
+func (c *DemoCluster) copyTree(src PVCRef, paths []string, dst PVCRef, destDir string, progress func(int64)) (int, error) {
+	from, err := c.volume(src.Namespace, src.PVC)
+	if err != nil {
+		return 0, err
+	}
+	to, err := c.volume(dst.Namespace, dst.PVC)
+	if err != nil {
+		return 0, err
+	}
+	destDir = demoPath(destDir)
+	if err := c.mkdirAll(to, destDir); err != nil {
+		return 0, err
+	}
+
+	files := 0
+	var copied int64
+	for _, path := range paths {
+		p := demoPath(path)
+		if _, ok := from.files[p]; !ok {
+			return files, &K8sError{Kind: ErrKindPathNotFound, Message: fmt.Sprintf("%s: no such file or directory.", p)}
+		}
+		parent := gopath.Dir(p)
+		if p == "/" {
+			parent = "/"
+		}
+		for _, q := range from.subtree(p) {
+			f := from.files[q]
+			target := gopath.Join(destDir, strings.TrimPrefix(q, parent))
+			if f.dir {
+				if err := c.mkdirAll(to, target); err != nil {
+					return files, err
+				}
+				continue
+			}
+			if err := c.writeFile(to, target, f.data); err != nil {
+				return files, err
+			}
+			files++
+			copied += int64(len(f.data))
+			if progress != nil {
+				progress(copied)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (c *DemoCluster) ResolvePVCPath(ctx context.Context, namespace, pvcName, filePath string) (*PVCTarget, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	return &PVCTarget{
+		Namespace: namespace,
+		PVC:       pvcName,
+		Pod:       vol.info.MountedBy,
+		Container: "app",
+		MountPath: vol.info.MountPath,
+		FullPath:  gopath.Join(vol.info.MountPath, filePath),
+	}, nil
+}
+
+func (c *DemoCluster) KubectlCommands(target *PVCTarget, isDir bool) KubectlCommands {
+	return (&Client{ContextName: DemoContext}).KubectlCommands(target, isDir)
+}
+
+// ListPods reports the pods that mount the demo claims.
+func (c *DemoCluster) ListPods(ctx context.Context, namespace string) ([]PodInfo, error) {
+	pvcs, _ := c.ListPVCs(ctx, namespace)
+	pods := []PodInfo{}
+	for _, pvc := range pvcs {
+		pods = append(pods, PodInfo{Name: pvc.MountedBy, Namespace: pvc.Namespace, Phase: "Running", NodeName: "demo-node", Containers: []string{"app"}})
+	}
+	return pods, nil
+}
+
+func (c *DemoCluster) ListContainerFiles(ctx context.Context, namespace, podName, containerName, path string) (*ContainerListing, error) {
+	return nil, demoUnsupported("Browsing container filesystems")
+}
+
+func (c *DemoCluster) ReadContainerFile(ctx context.Context, namespace, podName, containerName, path string, reveal bool) (*ContainerFile, error) {
+	return nil, demoUnsupported("Reading container files")
+}
+
+func (c *DemoCluster) ListArchive(ctx context.Context, namespace, pvcName, filePath string, limit int) (*ArchiveListing, error) {
+	return nil, demoUnsupported("Listing archives")
+}
+
+func (c *DemoCluster) StreamArchiveMember(ctx context.Context, namespace, pvcName, archivePath, member string, w io.Writer) error {
+	return demoUnsupported("Reading archive members")
+}
+
+func (c *DemoCluster) ExtractArchiveMembers(ctx context.Context, namespace, pvcName, archivePath string, members []string, destDir string, overwrite bool) error {
+	return demoUnsupported("Extracting archives")
+}
+
+func (c *DemoCluster) MigratePVC(ctx context.Context, req MigrationRequest, stage func(MigrationStage)) (*MigrationReport, error) {
+	return nil, demoUnsupported("Storage-class migration")
+}
+
+func (c *DemoCluster) StartMaintenance(ctx context.Context, namespace, pvcName string, d time.Duration) (*Maintenance, error) {
+	return nil, demoUnsupported("Maintenance mode")
+}
+
+func (c *DemoCluster) EndMaintenance(ctx context.Context, namespace, pvcName string) (*Maintenance, error) {
+	return nil, demoUnsupported("Maintenance mode")
+}
+
+// ListMaintenance reports no sessions: the demo has no workloads to scale.
+func (c *DemoCluster) ListMaintenance(ctx context.Context, namespace string) ([]Maintenance, error) {
+	return []Maintenance{}, nil
+}
+
+// AddSnapshot records the files a claim has now as snapshot name, taken at
+// created.
+func (c *DemoCluster) AddSnapshot(namespace, pvcName, name string, created time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	c.snapshots[PVCRef{Namespace: namespace, PVC: name}] = &demoSnapshot{
+		source:  pvcName,
+		created: created,
+		info:    vol.info,
+		files:   copyDemoFiles(vol.files),
+	}
+	return nil
+}
+
+func copyDemoFiles(files map[string]*demoFile) map[string]*demoFile {
+	out := make(map[string]*demoFile, len(files))
+	for p, f := range files {
+		dup := *f
+		dup.data = append([]byte(nil), f.data...)
+		out[p] = &dup
+	}
+	return out
+}
+
+func (c *DemoCluster) ListSnapshots(ctx context.Context, namespace, pvcName string) ([]Snapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshots := []Snapshot{}
+	for ref, snap := range c.snapshots {
+		if ref.Namespace != namespace || snap.source != pvcName {
+			continue
+		}
+		s := Snapshot{Name: ref.PVC, Namespace: namespace, PVC: pvcName, Created: snap.created, ReadyToUse: true, RestoreSize: snap.info.Capacity}
+		if _, ok := c.volumes[PVCRef{Namespace: namespace, PVC: SnapshotClaimName(ref.PVC)}]; ok {
+			s.Claim = SnapshotClaimName(ref.PVC)
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created.After(snapshots[j].Created) })
+	return snapshots, nil
+}
+
+// BrowseSnapshot restores a snapshot's files into a claim of their own.
+func (c *DemoCluster) BrowseSnapshot(ctx context.Context, namespace, snapshotName string) (*SnapshotClaim, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap, ok := c.snapshots[PVCRef{Namespace: namespace, PVC: snapshotName}]
+	if !ok {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("Snapshot %s not found in namespace %s.", snapshotName, namespace)}
+	}
+	name := SnapshotClaimName(snapshotName)
+	claim := &SnapshotClaim{Namespace: namespace, PVC: name, Snapshot: snapshotName, Source: snap.source, Expires: time.Now().Add(snapshotClaimTTL)}
+	if vol, ok := c.volumes[PVCRef{Namespace: namespace, PVC: name}]; ok {
+		if vol.info.Labels[snapshotOfLabel] != snap.source {
+			return nil, fmt.Errorf("PVC %s already exists and was not restored from snapshot %s", name, snapshotName)
+		}
+		claim.Existing = true
+		return claim, nil
+	}
+	info := snap.info
+	info.Name, info.MountedBy, info.MountPath = name, "", ""
+	info.Labels = map[string]string{"managed-by": "kube-browser", snapshotOfLabel: snap.source}
+	vol := c.addPVC(info)
+	vol.files = copyDemoFiles(snap.files)
+	return claim, nil
+}
+
+func (c *DemoCluster) ReleaseSnapshot(ctx context.Context, namespace, claimName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vol, err := c.volume(namespace, claimName)
+	if err != nil {
+		return err
+	}
+	if vol.info.Labels[snapshotOfLabel] == "" {
+		return fmt.Errorf("PVC %s was not restored from a snapshot by KubeBrowser", claimName)
+	}
+	delete(c.volumes, PVCRef{Namespace: namespace, PVC: claimName})
+	return nil
+}
+
+func (c *DemoCluster) RestoreFromSnapshot(ctx context.Context, req SnapshotRestoreRequest, progress func(int64)) (*SnapshotRestoreResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	claim, err := c.BrowseSnapshot(ctx, req.Namespace, req.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if !claim.Existing {
+		defer c.ReleaseSnapshot(ctx, req.Namespace, claim.PVC)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	from, err := c.volume(req.Namespace, claim.PVC)
+	if err != nil {
+		return nil, err
+	}
+	to, err := c.volume(req.Namespace, claim.Source)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planSnapshotRestore(req, func(p string) (bool, error) {
+		_, ok := to.files[demoPath(p)]
+		return ok, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var copied int64
+	for _, entry := range plan {
+		if _, ok := from.files[entry.Path]; !ok {
+			return nil, &K8sError{Kind: ErrKindPathNotFound, Message: fmt.Sprintf("%s: no such file or directory.", entry.Path)}
+		}
+		if err := c.mkdirAll(to, gopath.Dir(entry.Target)); err != nil {
+			return nil, err
+		}
+		for _, q := range from.subtree(entry.Path) {
+			f := from.files[q]
+			target := entry.Target + strings.TrimPrefix(q, entry.Path)
+			if f.dir {
+				if err := c.mkdirAll(to, target); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := c.writeFile(to, target, f.data); err != nil {
+				return nil, err
+			}
+			copied += int64(len(f.data))
+			if progress != nil {
+				progress(copied)
+			}
+		}
+	}
+	return &SnapshotRestoreResult{Namespace: req.Namespace, PVC: claim.Source, Claim: claim.PVC, Restored: plan}, nil
+}
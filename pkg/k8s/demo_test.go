@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDemoClusterMove(t *testing.T) {
+	ctx := context.Background()
+	c := NewDemoCluster()
+	c.AddPVC(PVCInfo{Namespace: "default", Name: "src"})
+	c.AddPVC(PVCInfo{Namespace: "default", Name: "dst"})
+	c.WriteFile("default", "src", "/logs/a.log", []byte("aaa"))
+	c.WriteFile("default", "src", "/logs/sub/b.log", []byte("bb"))
+
+	var stages []MoveStage
+	files, err := c.MoveBetweenPVCs(ctx, PVCRef{"default", "src"}, []string{"logs"}, PVCRef{"default", "dst"}, "/archive",
+		func(s MoveStage) { stages = append(stages, s) }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 || len(stages) != 3 {
+		t.Errorf("expected 2 files in 3 stages, got %d, %v", files, stages)
+	}
+	data, _, err := c.ReadFileHead(ctx, "default", "dst", "/archive/logs/sub/b.log", 10)
+	if err != nil || string(data) != "bb" {
+		t.Errorf("expected the moved file, got %q, %v", data, err)
+	}
+	_, err = c.ListFiles(ctx, "default", "src", "/logs")
+	var ke *K8sError
+	if !errors.As(err, &ke) || ke.Kind != ErrKindPathNotFound {
+		t.Errorf("expected the source to be gone, got %v", err)
+	}
+}
+
+func TestDemoClusterClone(t *testing.T) {
+	ctx := context.Background()
+	c := NewSampleDemoCluster()
+
+	req := CloneRequest{Namespace: "default", PVC: "web-content", TargetNamespace: "default", OnConflict: CloneConflictRename}
+	result, err := c.ClonePVC(ctx, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Target.PVC != "web-content-clone" || !result.Renamed {
+		t.Errorf("unexpected clone target %+v", result)
+	}
+	data, _, err := c.ReadFileHead(ctx, "default", "web-content-clone", "/html/index.html", 1024)
+	if err != nil || !strings.Contains(string(data), "Hello") {
+		t.Errorf("expected the cloned data, got %q, %v", data, err)
+	}
+
+	req.OnConflict = ""
+	req.TargetNamespace = "analytics"
+	req.TargetName = "notebooks"
+	if _, err := c.ClonePVC(ctx, req, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+}
+
+func TestDemoClusterSearchAndResolve(t *testing.T) {
+	ctx := context.Background()
+	c := NewSampleDemoCluster()
+
+	result, err := c.SearchFiles(ctx, "default", "web-content", SearchQuery{Path: "/", Pattern: "*.html", Type: "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range result.Files {
+		paths = append(paths, f.Path)
+	}
+	if got := strings.Join(paths, ","); got != "html/about.html,html/index.html" {
+		t.Errorf("unexpected matches %q", got)
+	}
+
+	files, err := c.ListFiles(ctx, "default", "web-content", "/html")
+	if err != nil || len(files) != 2 || files[0].Path != "/html/"+files[0].Name {
+		t.Errorf("expected listing paths like ls gives, got %+v, %v", files, err)
+	}
+
+	info, err := c.ResolvePath(ctx, "default", "web-content", "/html/missing/deeper.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Exists || info.NavigatePath != "/html" {
+		t.Errorf("expected to navigate to the nearest ancestor, got %+v", info)
+	}
+	info, err = c.ResolvePath(ctx, "default", "web-content", "/README.md")
+	if err != nil || !info.Exists || info.NavigatePath != "/" || info.FileName != "README.md" {
+		t.Errorf("unexpected resolution %+v, %v", info, err)
+	}
+}
+
+func TestDemoClusterStreamArchive(t *testing.T) {
+	c := NewSampleDemoCluster()
+	var buf bytes.Buffer
+	if err := c.StreamArchive(context.Background(), "default", "web-content", []string{"config"}, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if got := strings.Join(names, ","); got != "config/,config/nginx.yaml,config/site.json" {
+		t.Errorf("unexpected archive entries %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FilesystemUsage is what df reports for the filesystem a PVC is mounted
+// from. It often differs from the claim's requested capacity: volumes are
+// rounded up by the provisioner, expanded without the claim being updated,
+// or shared with other claims (NFS, hostPath). Inode counts are zero when
+// the filesystem or df does not report them.
+type FilesystemUsage struct {
+	TotalBytes     int64 `json:"totalBytes"`
+	UsedBytes      int64 `json:"usedBytes"`
+	AvailableBytes int64 `json:"availableBytes"`
+	Inodes         int64 `json:"inodes,omitempty"`
+	InodesUsed     int64 `json:"inodesUsed,omitempty"`
+	InodesFree     int64 `json:"inodesFree,omitempty"`
+}
+
+// dfScript prints POSIX df output for $1 in KiB, then for inodes, which
+// not every df supports; the marker separates the two.
+const dfScript = `df -Pk "$1" && echo -- && (df -Pi "$1" 2>/dev/null || true)`
+
+// dfLine returns the three numbers (total, used, available) of the last
+// line of POSIX df output.
+func dfLine(output string) ([3]int64, bool) {
+	var nums [3]int64
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return nums, false
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return nums, false
+	}
+	// The filesystem name comes first and the mount point last, and
+	// either may contain spaces: the numbers precede the capacity column.
+	for i, f := range fields {
+		if strings.HasSuffix(f, "%") && i >= 4 {
+			for j := range nums {
+				n, err := strconv.ParseInt(fields[i-3+j], 10, 64)
+				if err != nil {
+					return nums, false
+				}
+				nums[j] = n
+			}
+			return nums, true
+		}
+	}
+	return nums, false
+}
+
+// parseDf parses the output of dfScript.
+func parseDf(output string) (*FilesystemUsage, error) {
+	blocks, inodes, _ := strings.Cut(output, "\n--\n")
+	kib, ok := dfLine(blocks)
+	if !ok {
+		return nil, fmt.Errorf("unexpected df output: %q", strings.TrimSpace(blocks))
+	}
+	usage := &FilesystemUsage{TotalBytes: kib[0] << 10, UsedBytes: kib[1] << 10, AvailableBytes: kib[2] << 10}
+	if n, ok := dfLine(inodes); ok {
+		usage.Inodes, usage.InodesUsed, usage.InodesFree = n[0], n[1], n[2]
+	}
+	return usage, nil
+}
+
+// FilesystemUsage runs df on the PVC's mount point.
+func (c *Client) FilesystemUsage(ctx context.Context, namespace, pvcName string) (*FilesystemUsage, error) {
+	stdout, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"sh", "-c", dfScript, "sh", mountPath}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, streamError(ke, stderr)
+		}
+		return nil, err
+	}
+	return parseDf(stdout)
+}
@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseDf(t *testing.T) {
+	gnu := "Filesystem     1024-blocks    Used Available Capacity Mounted on\n" +
+		"/dev/sdb          10255636 2621440   7617812      26% /data\n" +
+		"--\n" +
+		"Filesystem      Inodes IUsed   IFree IUse% Mounted on\n" +
+		"/dev/sdb        655360  1200  654160    1% /data\n"
+	usage, err := parseDf(gnu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FilesystemUsage{TotalBytes: 10255636 << 10, UsedBytes: 2621440 << 10, AvailableBytes: 7617812 << 10, Inodes: 655360, InodesUsed: 1200, InodesFree: 654160}
+	if *usage != want {
+		t.Errorf("got %+v, want %+v", *usage, want)
+	}
+
+	// busybox df has no -i, and an NFS export name may contain spaces.
+	busybox := "Filesystem           1024-blocks      Used Available Capacity Mounted on\n" +
+		"nfs server:/exports/my share 1048576 524288 524288 50% /data\n" +
+		"--\n"
+	usage, err = parseDf(busybox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.TotalBytes != 1048576<<10 || usage.AvailableBytes != 524288<<10 || usage.Inodes != 0 {
+		t.Errorf("unexpected usage %+v", *usage)
+	}
+
+	if _, err := parseDf("df: /data: No such file or directory\n"); err == nil {
+		t.Error("expected unparsable output to fail")
+	}
+}
+
+func TestFilesystemUsage(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sdb 100 40 60 40% /data\n--\n", "", nil)
+	c := newTransferClient(mock)
+
+	usage, err := c.FilesystemUsage(context.Background(), "default", "my-pvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.UsedBytes != 40<<10 {
+		t.Errorf("unexpected usage %+v", *usage)
+	}
+	want := "sh -c " + dfScript + " sh /data"
+	if got := strings.Join(mock.execCalls[0].cmd, " "); got != want {
+		t.Errorf("unexpected command %q", got)
+	}
+}
@@ -0,0 +1,283 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// CheckStatus is the outcome of one doctor check.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+	CheckSkip CheckStatus = "skip"
+)
+
+// DoctorCheck is one line of the readiness report.
+type DoctorCheck struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail"`
+}
+
+// DoctorReport is the result of Doctor. It is ready when no check failed;
+// warnings mark features that will not work (such as helper pods) without
+// blocking the rest.
+type DoctorReport struct {
+	Context   string        `json:"context"`
+	Namespace string        `json:"namespace"`
+	Checks    []DoctorCheck `json:"checks"`
+}
+
+func (r *DoctorReport) Add(name string, status CheckStatus, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *DoctorReport) Ready() bool {
+	for _, c := range r.Checks {
+		if c.Status == CheckFail {
+			return false
+		}
+	}
+	return true
+}
+
+// DoctorOptions selects what Doctor exercises.
+type DoctorOptions struct {
+	// Namespace is where RBAC is checked and the test pod runs.
+	Namespace string
+	// SkipPod skips starting a pod, and with it the image pull and exec
+	// transport checks.
+	SkipPod bool
+	// PodTimeout bounds how long the test pod may take to start.
+	PodTimeout time.Duration
+}
+
+// doctorPollInterval is how often the test pod's status is checked.
+var doctorPollInterval = 2 * time.Second
+
+// Doctor checks that this connection can do what KubeBrowser needs: reach
+// the API server, hold each RBAC permission, pull the helper image and
+// exec into a pod over SPDY (and, for information, WebSocket). The test
+// pod it starts carries the helper labels, so one left behind by an
+// interrupted run is cleaned up like any orphaned helper.
+func (c *Client) Doctor(ctx context.Context, opts DoctorOptions) *DoctorReport {
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+	if opts.PodTimeout <= 0 {
+		opts.PodTimeout = 90 * time.Second
+	}
+	r := &DoctorReport{Context: c.ContextName, Namespace: opts.Namespace}
+
+	version, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		r.Add("API server", CheckFail, "cannot reach the API server: %v", err)
+		return r
+	}
+	r.Add("API server", CheckPass, "reachable, Kubernetes %s", version.GitVersion)
+
+	c.checkRBAC(ctx, r, opts.Namespace)
+	c.checkPullSecrets(ctx, r, opts.Namespace)
+
+	if opts.SkipPod {
+		r.Add("Helper image", CheckSkip, "pod checks skipped")
+		return r
+	}
+	image := c.helperImage()
+	pod, err := c.startDoctorPod(ctx, opts.Namespace, image, opts.PodTimeout)
+	if err != nil {
+		r.Add("Helper image", CheckFail, "%s could not be started: %v", image, err)
+		r.Add("Exec (SPDY)", CheckSkip, "no test pod")
+		return r
+	}
+	defer c.removeDoctorPod(opts.Namespace, pod)
+	r.Add("Helper image", CheckPass, "%s pulled and running", image)
+
+	if err := c.execTransport(ctx, opts.Namespace, pod, false); err != nil {
+		r.Add("Exec (SPDY)", CheckFail, "%v", err)
+	} else {
+		r.Add("Exec (SPDY)", CheckPass, "exec works")
+	}
+	if err := c.execTransport(ctx, opts.Namespace, pod, true); err != nil {
+		r.Add("Exec (WebSocket)", CheckWarn, "unavailable (KubeBrowser uses SPDY): %v", err)
+	} else {
+		r.Add("Exec (WebSocket)", CheckPass, "exec works")
+	}
+	return r
+}
+
+// checkRBAC asks the API server, with SelfSubjectAccessReviews, for every
+// verb KubeBrowser uses. Missing helper-pod verbs are warnings: browsing
+// still works with --minimal.
+func (c *Client) checkRBAC(ctx context.Context, r *DoctorReport, namespace string) {
+	core := make(map[string]bool)
+	for _, rule := range pvcAccessRules(RBACOptions{}) {
+		for _, res := range rule.Resources {
+			for _, verb := range rule.Verbs {
+				core[res+":"+verb] = true
+			}
+		}
+	}
+
+	check := func(rule rbacv1.PolicyRule, ns string) {
+		for _, res := range rule.Resources {
+			resource, sub, _ := strings.Cut(res, "/")
+			for _, verb := range rule.Verbs {
+				name := "RBAC " + verb + " " + res
+				review := &authorizationv1.SelfSubjectAccessReview{
+					Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+						ResourceAttributes: &authorizationv1.ResourceAttributes{
+							Namespace:   ns,
+							Verb:        verb,
+							Group:       rule.APIGroups[0],
+							Resource:    resource,
+							Subresource: sub,
+						},
+					},
+				}
+				result, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+				switch {
+				case err != nil:
+					r.Add(name, CheckWarn, "could not be checked: %v", err)
+				case result.Status.Allowed:
+					r.Add(name, CheckPass, "allowed")
+				case core[res+":"+verb] || ns == "":
+					r.Add(name, CheckFail, "denied%s", reviewReason(result))
+				default:
+					r.Add(name, CheckWarn, "denied%s; helper pods will not work (use --minimal)", reviewReason(result))
+				}
+			}
+		}
+	}
+
+	check(namespaceListRule, "")
+	for _, rule := range pvcAccessRules(RBACOptions{HelperPods: true}) {
+		check(rule, namespace)
+	}
+}
+
+func reviewReason(review *authorizationv1.SelfSubjectAccessReview) string {
+	if review.Status.Reason == "" {
+		return ""
+	}
+	return ": " + review.Status.Reason
+}
+
+// startDoctorPod starts a volume-less pod from image and waits for it to
+// run, which proves the image can be pulled.
+func (c *Client) startDoctorPod(ctx context.Context, namespace, image string, timeout time.Duration) (string, error) {
+	spec := corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name:            "helper",
+			Image:           image,
+			Command:         []string{"sleep", "300"},
+			Resources:       helperResourceRequirements(),
+			SecurityContext: helperSecurityContext(),
+		}},
+		RestartPolicy:         corev1.RestartPolicyNever,
+		ActiveDeadlineSeconds: helperActiveDeadline(),
+	}
+	c.applyHelperScheduling(&spec)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-browser-doctor-" + strconv.FormatInt(time.Now().UnixNano(), 16),
+			Namespace: namespace,
+			Labels:    helperLabels("kube-browser-helper"),
+		},
+		Spec: spec,
+	}
+	if _, err := c.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return "", classifyApiError(err)
+	}
+
+	var phase, reason string
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		p, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err == nil {
+			phase = string(p.Status.Phase)
+			if len(p.Status.ContainerStatuses) > 0 && p.Status.ContainerStatuses[0].State.Waiting != nil {
+				reason = p.Status.ContainerStatuses[0].State.Waiting.Reason
+			}
+			switch p.Status.Phase {
+			case corev1.PodRunning:
+				return pod.Name, nil
+			case corev1.PodFailed, corev1.PodSucceeded:
+				c.removeDoctorPod(namespace, pod.Name)
+				return "", classifyPodError(phase, reason)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			c.removeDoctorPod(namespace, pod.Name)
+			return "", ctx.Err()
+		case <-time.After(doctorPollInterval):
+		}
+	}
+	c.removeDoctorPod(namespace, pod.Name)
+	return "", classifyPodError(phase, reason)
+}
+
+// removeDoctorPod deletes the test pod without waiting: doctor runs as a
+// one-shot command, so there is no cleanup worker to retry later.
+func (c *Client) removeDoctorPod(namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grace := int64(0)
+	if err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &grace}); err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Could not delete doctor pod %s/%s: %v", namespace, name, err)
+	}
+}
+
+// execTransport runs "true" in the test pod over SPDY or WebSocket.
+func (c *Client) execTransport(ctx context.Context, namespace, pod string, websocket bool) error {
+	if c.restConfig == nil {
+		return fmt.Errorf("no REST config for this connection")
+	}
+	u := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{Container: "helper", Command: []string{"true"}, Stdout: true, Stderr: true}, scheme.ParameterCodec).
+		URL()
+
+	var exec remotecommand.Executor
+	var err error
+	if websocket {
+		exec, err = remotecommand.NewWebSocketExecutor(c.restConfig, "GET", u.String())
+	} else {
+		exec, err = remotecommand.NewSPDYExecutor(c.restConfig, "POST", u)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	if err := exec.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	return nil
+}
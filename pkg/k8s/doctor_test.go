@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// doctorClientset allows every access review except those in denied
+// ("verb resource[/subresource]") and starts pods as Running.
+func doctorClientset(denied ...string) *fake.Clientset {
+	cs := fake.NewSimpleClientset()
+	cs.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.2"}
+	cs.PrependReactor("create", "selfsubjectaccessreviews", func(action ktesting.Action) (bool, runtime.Object, error) {
+		review := action.(ktesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		key := attrs.Verb + " " + attrs.Resource
+		if attrs.Subresource != "" {
+			key += "/" + attrs.Subresource
+		}
+		review.Status.Allowed = true
+		for _, d := range denied {
+			if d == key {
+				review.Status.Allowed = false
+			}
+		}
+		return true, review, nil
+	})
+	cs.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		action.(ktesting.CreateAction).GetObject().(*corev1.Pod).Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+	return cs
+}
+
+func checkStatuses(r *DoctorReport) map[string]CheckStatus {
+	m := make(map[string]CheckStatus)
+	for _, c := range r.Checks {
+		m[c.Name] = c.Status
+	}
+	return m
+}
+
+func TestDoctorRBAC(t *testing.T) {
+	c := &Client{clientset: doctorClientset("create pods", "create pods/exec"), ContextName: "dev"}
+	r := c.Doctor(context.Background(), DoctorOptions{Namespace: "apps", SkipPod: true})
+
+	got := checkStatuses(r)
+	want := map[string]CheckStatus{
+		"API server":                      CheckPass,
+		"RBAC list namespaces":            CheckPass,
+		"RBAC get persistentvolumeclaims": CheckPass,
+		"RBAC create pods":                CheckWarn,
+		"RBAC delete pods":                CheckPass,
+		"RBAC create pods/exec":           CheckFail,
+		"Helper image":                    CheckSkip,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s: got %q, want %q", name, got[name], status)
+		}
+	}
+	if r.Ready() {
+		t.Error("a report with a failed check must not be ready")
+	}
+	if r.Context != "dev" || r.Namespace != "apps" {
+		t.Errorf("unexpected report header: %+v", r)
+	}
+}
+
+func TestDoctorUnreachableAPI(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	cs.Discovery().(*fakediscovery.FakeDiscovery).PrependReactor("get", "version", func(ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	r := (&Client{clientset: cs}).Doctor(context.Background(), DoctorOptions{})
+	if len(r.Checks) != 1 || r.Checks[0].Status != CheckFail || r.Ready() {
+		t.Errorf("expected a single failed API check, got %+v", r.Checks)
+	}
+}
+
+func TestDoctorPod(t *testing.T) {
+	defer func(d time.Duration) { doctorPollInterval = d }(doctorPollInterval)
+	doctorPollInterval = time.Millisecond
+
+	cs := doctorClientset()
+	r := (&Client{clientset: cs}).Doctor(context.Background(), DoctorOptions{Namespace: "apps"})
+
+	got := checkStatuses(r)
+	if got["Helper image"] != CheckPass {
+		t.Errorf("helper image: got %q", got["Helper image"])
+	}
+	// The fake clientset has no REST config to exec with.
+	if got["Exec (SPDY)"] != CheckFail || got["Exec (WebSocket)"] != CheckWarn {
+		t.Errorf("unexpected exec checks: %v", got)
+	}
+	pods, _ := cs.CoreV1().Pods("apps").List(context.Background(), metav1.ListOptions{})
+	if len(pods.Items) != 0 {
+		t.Errorf("doctor pod was not deleted: %d pods left", len(pods.Items))
+	}
+}
+
+func TestDoctorPullSecrets(t *testing.T) {
+	cs := doctorClientset()
+	cs.CoreV1().Secrets("apps").Create(context.Background(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mirror-creds", Namespace: "apps"}}, metav1.CreateOptions{})
+	c := &Client{clientset: cs}
+
+	if err := c.SetImagePullSecrets("mirror-creds"); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkStatuses(c.Doctor(context.Background(), DoctorOptions{Namespace: "apps", SkipPod: true})); got["Image pull secrets"] != CheckPass {
+		t.Errorf("expected the secret to be found, got %v", got)
+	}
+	c.SetImagePullSecrets("mirror-creds, other-creds")
+	r := c.Doctor(context.Background(), DoctorOptions{Namespace: "apps", SkipPod: true})
+	if got := checkStatuses(r); got["Image pull secrets"] != CheckWarn || !r.Ready() {
+		t.Errorf("expected a missing secret to be a warning, got %v", got)
+	}
+}
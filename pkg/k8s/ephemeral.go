@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// volumeClaimName returns the claim behind a pod volume: the claimName of
+// a persistentVolumeClaim volume or, for a generic ephemeral volume, the
+// PVC Kubernetes creates from its volumeClaimTemplate, named
+// <pod>-<volume>. It is "" for any other volume, including CSI inline
+// volumes, which have no claim.
+func volumeClaimName(pod *corev1.Pod, vol corev1.Volume) string {
+	switch {
+	case vol.PersistentVolumeClaim != nil:
+		return vol.PersistentVolumeClaim.ClaimName
+	case vol.Ephemeral != nil:
+		return pod.Name + "-" + vol.Name
+	}
+	return ""
+}
+
+// ephemeralOwner returns the pod a generic ephemeral volume's claim
+// belongs to, or "" for a claim that outlives pods. Such a claim is
+// deleted with its pod.
+func ephemeralOwner(pvc *corev1.PersistentVolumeClaim) string {
+	for _, ref := range pvc.OwnerReferences {
+		if ref.Kind == "Pod" && ref.Controller != nil && *ref.Controller {
+			return ref.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// ephemeralFixtures is a running pod with a generic ephemeral volume
+// "scratch" and the claim Kubernetes created for it.
+func ephemeralFixtures() (*corev1.Pod, *corev1.PersistentVolumeClaim) {
+	pod := runningPodWithPVC("unused")
+	pod.Name = "worker-0"
+	pod.Spec.Volumes = []corev1.Volume{{
+		Name: "scratch",
+		VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{
+			VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{},
+		}},
+	}}
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "scratch", MountPath: "/scratch"}}
+	isController := true
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "worker-0-scratch",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Pod", Name: "worker-0", Controller: &isController}},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+	return pod, pvc
+}
+
+func TestListPVCsLabelsEphemeralVolumes(t *testing.T) {
+	pod, pvc := ephemeralFixtures()
+	c := &Client{clientset: fake.NewSimpleClientset(pod, pvc)}
+
+	pvcs, err := c.ListPVCs(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvcs) != 1 || pvcs[0].OwnerPod != "worker-0" || pvcs[0].MountedBy != "worker-0" || pvcs[0].MountPath != "/scratch" {
+		t.Errorf("expected the ephemeral claim mounted by its pod, got %+v", pvcs)
+	}
+}
+
+func TestFindPodForEphemeralVolume(t *testing.T) {
+	pod, pvc := ephemeralFixtures()
+	c := &Client{clientset: fake.NewSimpleClientset(pod, pvc)}
+
+	info, err := c.findPodForPVC(context.Background(), "default", "worker-0-scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.podName != "worker-0" || info.mountPath != "/scratch" || info.volumeName != "scratch" {
+		t.Errorf("unexpected pod %+v", info)
+	}
+}
+
+func TestMigratePVCRefusesEphemeralVolumes(t *testing.T) {
+	pod, pvc := ephemeralFixtures()
+	c := &Client{clientset: fake.NewSimpleClientset(pod, pvc)}
+
+	_, err := c.MigratePVC(context.Background(), MigrationRequest{Namespace: "default", PVC: "worker-0-scratch", StorageClass: "fast"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "ephemeral") {
+		t.Errorf("expected an ephemeral claim not to be migrated, got %v", err)
+	}
+}
@@ -12,13 +12,20 @@ import (
 type ErrorKind string
 
 const (
-	ErrKindRBAC          ErrorKind = "RBAC"
-	ErrKindNoShell       ErrorKind = "NoShell"
-	ErrKindTimeout       ErrorKind = "Timeout"
-	ErrKindHelperPending ErrorKind = "HelperPending"
-	ErrKindPathNotFound  ErrorKind = "PathNotFound"
-	ErrKindPermDenied    ErrorKind = "PermDenied"
-	ErrKindUnknown       ErrorKind = "Unknown"
+	ErrKindRBAC           ErrorKind = "RBAC"
+	ErrKindNoShell        ErrorKind = "NoShell"
+	ErrKindTimeout        ErrorKind = "Timeout"
+	ErrKindHelperPending  ErrorKind = "HelperPending"
+	ErrKindPathNotFound   ErrorKind = "PathNotFound"
+	ErrKindPermDenied     ErrorKind = "PermDenied"
+	ErrKindHelperDisabled ErrorKind = "HelperDisabled"
+	ErrKindSecretHidden   ErrorKind = "SecretHidden"
+	ErrKindOutOfScope     ErrorKind = "OutOfScope"
+	ErrKindIOError        ErrorKind = "IOError"
+	ErrKindReadOnlyFS     ErrorKind = "ReadOnlyFS"
+	ErrKindStaleHandle    ErrorKind = "StaleHandle"
+	ErrKindQuotaExceeded  ErrorKind = "QuotaExceeded"
+	ErrKindUnknown        ErrorKind = "Unknown"
 )
 
 type K8sError struct {
@@ -42,9 +49,9 @@ func kindPriority(kind ErrorKind) int {
 	switch kind {
 	case ErrKindRBAC:
 		return 5
-	case ErrKindTimeout:
+	case ErrKindTimeout, ErrKindIOError, ErrKindReadOnlyFS, ErrKindStaleHandle:
 		return 4
-	case ErrKindHelperPending:
+	case ErrKindHelperPending, ErrKindHelperDisabled, ErrKindQuotaExceeded:
 		return 3
 	case ErrKindPermDenied:
 		return 2
@@ -70,12 +77,48 @@ func mostActionableError(errs ...*K8sError) *K8sError {
 	return best
 }
 
+// isFilesystemError reports whether kind is a fault of the volume itself
+// rather than of the pod reading it. A helper pod mounts the same volume
+// and fails the same way, so these are not worth retrying in one.
+func isFilesystemError(kind ErrorKind) bool {
+	return kind == ErrKindIOError || kind == ErrKindReadOnlyFS || kind == ErrKindStaleHandle
+}
+
+// classifyFilesystemError recognises the errors the kernel returns when the
+// filesystem on a volume is failing, in stderr from ls, cat, tar and the
+// like. It returns nil for anything else.
+func classifyFilesystemError(err error, stderrLower string) *K8sError {
+	switch {
+	case strings.Contains(stderrLower, "stale file handle") || strings.Contains(stderrLower, "stale nfs file handle") ||
+		strings.Contains(stderrLower, "transport endpoint is not connected"):
+		return &K8sError{
+			Kind:    ErrKindStaleHandle,
+			Message: "Stale file handle: the network filesystem behind this volume changed or went away under the pod. Restart the pod so it remounts the volume, and check the NFS/CSI server.",
+			Cause:   err,
+		}
+	case strings.Contains(stderrLower, "read-only file system"):
+		return &K8sError{
+			Kind:    ErrKindReadOnlyFS,
+			Message: "The volume is mounted read-only. The kernel remounts a filesystem read-only after it detects errors; check the node's kernel log (dmesg) and repair the volume with fsck, or check that the PVC and the pod's volumeMount are not read-only.",
+			Cause:   err,
+		}
+	case strings.Contains(stderrLower, "input/output error"):
+		return &K8sError{
+			Kind:    ErrKindIOError,
+			Message: "I/O error reading the volume: the disk behind it is failing or was detached from the node. Check the node's kernel log (dmesg) and the storage provider before writing to it.",
+			Cause:   err,
+		}
+	}
+	return nil
+}
+
 func isToolNotFound(stderrLower string) bool {
-	tools := []string{"ls", "find", "sh", "stat", "busybox"}
+	tools := []string{"ls", "find", "sh", "stat", "busybox", "tar", "du", "df", "sha256sum", "sha1sum", "sha512sum", "md5sum"}
 	for _, tool := range tools {
 		if strings.Contains(stderrLower, tool+": not found") ||
 			strings.Contains(stderrLower, "/"+tool+": not found") ||
-			strings.Contains(stderrLower, tool+": no such file or directory") {
+			strings.Contains(stderrLower, tool+": no such file or directory") ||
+			strings.Contains(stderrLower, "'"+tool+"': no such file or directory") {
 			return true
 		}
 	}
@@ -114,6 +157,10 @@ func classifyExecError(err error, stderr string) *K8sError {
 		}
 	}
 
+	if fsErr := classifyFilesystemError(err, stderrLower); fsErr != nil {
+		return fsErr
+	}
+
 	if strings.Contains(errStr, "executable file not found") ||
 		strings.Contains(stderrLower, "executable file not found") ||
 		isToolNotFound(stderrLower) {
@@ -154,9 +201,13 @@ func classifyPodError(phase, reason string) *K8sError {
 	if phaseLower == "pending" || phaseLower == "" {
 		msg := "Helper pod stuck in Pending. Possible causes: ImagePullBackOff, PodSecurityPolicy blocking alpine:3.19, no node available, or NetworkPolicy restriction."
 		if strings.Contains(reasonLower, "imagepull") || strings.Contains(reasonLower, "errimagepull") {
-			msg = "Helper pod failed to start: ImagePullBackOff — the cluster cannot pull the helper image. Set HELPER_IMAGE to an accessible image."
+			msg = "Helper pod failed to start: ImagePullBackOff — the cluster cannot pull the helper image. Set HELPER_IMAGE to an accessible image, or a registry mirror for the connection."
+		} else if reasonLower == "invalidimagename" || reasonLower == "errimageneverpull" {
+			msg = fmt.Sprintf("Helper pod failed to start (%s): the helper image cannot be used. Check HELPER_IMAGE and the registry mirror for the connection.", reason)
+		} else if reasonLower == "multiattach" {
+			msg = "Helper pod cannot mount the volume: it is ReadWriteOnce and attached to another node. Scale down the workload using it, or wait for the volume to detach, then try again."
 		} else if strings.Contains(reasonLower, "unschedulable") {
-			msg = "Helper pod stuck in Pending: no node is available to schedule it. Check node resources and taints."
+			msg = "Helper pod stuck in Pending: no node is available to schedule it. Check node resources and taints, or set KUBE_BROWSER_PRIORITY_CLASS."
 		}
 		return &K8sError{
 			Kind:    ErrKindHelperPending,
@@ -167,7 +218,9 @@ func classifyPodError(phase, reason string) *K8sError {
 	if phaseLower == "failed" {
 		msg := "Helper pod failed to start."
 		if strings.Contains(reasonLower, "imagepull") || strings.Contains(reasonLower, "errimagepull") {
-			msg = "Helper pod failed: ImagePullBackOff — the cluster cannot pull the helper image. Set HELPER_IMAGE to an accessible image."
+			msg = "Helper pod failed: ImagePullBackOff — the cluster cannot pull the helper image. Set HELPER_IMAGE to an accessible image, or a registry mirror for the connection."
+		} else if strings.HasPrefix(reasonLower, "outof") {
+			msg = fmt.Sprintf("Helper pod was rejected by the node (reason: %s): the node is out of resources. Lower the HELPER_*_REQUEST values or set KUBE_BROWSER_PRIORITY_CLASS.", reason)
 		} else if reason != "" {
 			msg = fmt.Sprintf("Helper pod failed to start (reason: %s). Check cluster events for details.", reason)
 		}
@@ -71,6 +71,30 @@ func TestClassifyExecError(t *testing.T) {
 			stderr:   "ls: /nonexistent: No such file or directory",
 			wantKind: ErrKindPathNotFound,
 		},
+		{
+			name:     "input/output error in stderr → IOError",
+			err:      fmt.Errorf("command terminated with exit code 2"),
+			stderr:   "ls: reading directory '/data': Input/output error",
+			wantKind: ErrKindIOError,
+		},
+		{
+			name:     "read-only file system in stderr → ReadOnlyFS",
+			err:      fmt.Errorf("command terminated with exit code 1"),
+			stderr:   "mkdir: can't create directory '/data/new': Read-only file system",
+			wantKind: ErrKindReadOnlyFS,
+		},
+		{
+			name:     "stale file handle in stderr → StaleHandle",
+			err:      fmt.Errorf("command terminated with exit code 1"),
+			stderr:   "ls: cannot access '/data/share': Stale file handle",
+			wantKind: ErrKindStaleHandle,
+		},
+		{
+			name:     "stale file handle wins over no such file",
+			err:      fmt.Errorf("command terminated with exit code 1"),
+			stderr:   "ls: /data/a: No such file or directory\nls: /data/b: Stale NFS file handle",
+			wantKind: ErrKindStaleHandle,
+		},
 		{
 			name:     "generic error → Unknown",
 			err:      fmt.Errorf("some random error"),
@@ -157,6 +181,13 @@ func TestClassifyPodError(t *testing.T) {
 			wantKind: ErrKindHelperPending,
 			wantMsg:  "ImagePullBackOff",
 		},
+		{
+			name:     "failed outofcpu → HelperPending with resources message",
+			phase:    "Failed",
+			reason:   "OutOfcpu",
+			wantKind: ErrKindHelperPending,
+			wantMsg:  "KUBE_BROWSER_PRIORITY_CLASS",
+		},
 		{
 			name:     "empty phase → HelperPending generic",
 			phase:    "",
@@ -255,6 +286,11 @@ func TestMostActionableError(t *testing.T) {
 			errs:     []*K8sError{unknown, pathNotFound},
 			wantKind: ErrKindPathNotFound,
 		},
+		{
+			name:     "ReadOnlyFS beats PathNotFound",
+			errs:     []*K8sError{pathNotFound, {Kind: ErrKindReadOnlyFS, Message: "readonly"}},
+			wantKind: ErrKindReadOnlyFS,
+		},
 		{
 			name:     "nil entries skipped",
 			errs:     []*K8sError{nil, noShell, nil},
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"fmt"
+	gopath "path"
+	"strings"
+)
+
+// maxExcludePatterns bounds the --exclude arguments added to one command.
+const maxExcludePatterns = 64
+
+// CleanExcludes validates .gitignore-style exclude patterns and returns
+// them in the form the tar commands and ExcludedPath use. A pattern
+// without a slash, such as "node_modules" or "*.tmp", matches an entry of
+// that name at any depth; one with a slash, such as "build/cache",
+// matches that sequence of names at any depth. Excluding a directory
+// excludes everything below it. Blank lines and "#" comments are skipped,
+// and a trailing "/" is dropped: tar cannot restrict a pattern to
+// directories. Negations ("!keep") and anchored patterns ("/dist") have no
+// tar equivalent and are rejected rather than silently ignored.
+func CleanExcludes(patterns []string) ([]string, error) {
+	var out []string
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		switch {
+		case strings.ContainsAny(p, "\n\r\x00"):
+			return nil, fmt.Errorf("exclude pattern %q contains a control character", p)
+		case strings.HasPrefix(p, "!"):
+			return nil, fmt.Errorf("exclude pattern %q: negated patterns are not supported", p)
+		case strings.HasPrefix(p, "/"):
+			return nil, fmt.Errorf("exclude pattern %q: anchored patterns are not supported; drop the leading /", p)
+		}
+		p = strings.TrimRight(p, "/")
+		if p == "" || p == "." || p == "**" {
+			return nil, fmt.Errorf("exclude pattern %q would exclude everything", p)
+		}
+		if _, err := gopath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", p, err)
+		}
+		out = append(out, p)
+	}
+	if len(out) > maxExcludePatterns {
+		return nil, fmt.Errorf("too many exclude patterns (%d, at most %d)", len(out), maxExcludePatterns)
+	}
+	return out, nil
+}
+
+// excludeArgs returns the tar options for patterns. tar matches an
+// --exclude pattern against every trailing part of a member name, which
+// is the unanchored behavior CleanExcludes describes; both GNU and busybox
+// tar accept the --exclude=PATTERN form.
+func excludeArgs(patterns []string) []string {
+	args := make([]string, len(patterns))
+	for i, p := range patterns {
+		args[i] = "--exclude=" + p
+	}
+	return args
+}
+
+// ExcludedPath reports whether the volume-relative path p, or a directory
+// above it, matches one of patterns. Backends that build archives
+// themselves use it to mirror what tar --exclude does in a pod.
+func ExcludedPath(patterns []string, p string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	names := strings.Split(strings.Trim(gopath.Clean("/"+p), "/"), "/")
+	for _, pattern := range patterns {
+		depth := strings.Count(pattern, "/") + 1
+		for i := 0; i+depth <= len(names); i++ {
+			if ok, _ := gopath.Match(pattern, strings.Join(names[i:i+depth], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
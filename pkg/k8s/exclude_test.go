@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCleanExcludes(t *testing.T) {
+	got, err := CleanExcludes([]string{"# build output", "", " node_modules/ ", "*.tmp", "build/cache"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"node_modules", "*.tmp", "build/cache"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"!keep.tmp", "/dist", "**", "/", "[a-", "a\nb"} {
+		if _, err := CleanExcludes([]string{bad}); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestExcludedPath(t *testing.T) {
+	patterns := []string{"node_modules", "*.tmp", "build/cache"}
+	tests := map[string]bool{
+		"app/node_modules":            true,
+		"app/node_modules/x/index.js": true,
+		"/node_modules":               true,
+		"app/src/main.tmp":            true,
+		"app/build/cache/obj":         true,
+		"app/cache":                   false,
+		"app/src/main.go":             false,
+		"app/node_modules_old/a":      false,
+	}
+	for p, want := range tests {
+		if got := ExcludedPath(patterns, p); got != want {
+			t.Errorf("ExcludedPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if ExcludedPath(nil, "app/x.tmp") {
+		t.Error("no patterns must exclude nothing")
+	}
+}
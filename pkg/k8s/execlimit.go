@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const defaultMaxExecSessions = 10
+
+// maxExecSessions reads KUBE_BROWSER_MAX_EXEC_SESSIONS. Zero or a negative
+// value disables the limit.
+func maxExecSessions() int {
+	if v := os.Getenv("KUBE_BROWSER_MAX_EXEC_SESSIONS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		log.Printf("Warning: invalid KUBE_BROWSER_MAX_EXEC_SESSIONS %q, using %d", v, defaultMaxExecSessions)
+	}
+	return defaultMaxExecSessions
+}
+
+// newExecSlots returns the semaphore bounding concurrent exec sessions on
+// one connection, or nil for no limit. Every exec is a SPDY stream held open
+// by the API server for its whole duration, so a user with many tabs could
+// otherwise trip the server's inflight request limits.
+func newExecSlots() chan struct{} {
+	n := maxExecSessions()
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// limitedExecutor holds an exec slot for the duration of each stream.
+type limitedExecutor struct {
+	remotecommand.Executor
+	slots chan struct{}
+}
+
+func (e *limitedExecutor) acquire(ctx context.Context) error {
+	select {
+	case e.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	log.Printf("  all %d exec sessions in use, waiting for a free slot", cap(e.slots))
+	select {
+	case e.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *limitedExecutor) Stream(options remotecommand.StreamOptions) error {
+	return e.StreamWithContext(context.Background(), options)
+}
+
+func (e *limitedExecutor) StreamWithContext(ctx context.Context, options remotecommand.StreamOptions) error {
+	if held, _ := ctx.Value(heldExecSlots{}).(chan struct{}); held == e.slots {
+		return e.Executor.StreamWithContext(ctx, options)
+	}
+	if err := e.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() { <-e.slots }()
+	return e.Executor.StreamWithContext(ctx, options)
+}
+
+// heldExecSlots marks a context whose execs run on the slots
+// ReserveExecSlots took for them.
+type heldExecSlots struct{}
+
+// ReserveExecSlots takes n exec slots at once for execs that only make
+// progress together, such as the two legs of a copy joined by a pipe:
+// taken one exec at a time, as many copies as there are slots could each
+// hold one for their source and wait forever for another for their
+// destination. Execs under the returned context use the reserved slots
+// instead of taking their own, and release gives the slots back. Only one
+// reservation waits for slots at a time, so two never hold part of what
+// they need.
+func (c *Client) ReserveExecSlots(ctx context.Context, n int) (context.Context, func(), error) {
+	slots := c.execSlots
+	if held, _ := ctx.Value(heldExecSlots{}).(chan struct{}); slots == nil || held == slots {
+		return ctx, func() {}, nil
+	}
+	n = min(n, cap(slots))
+
+	c.execReserveMu.Lock()
+	defer c.execReserveMu.Unlock()
+	taken := 0
+	release := func() {
+		for ; taken > 0; taken-- {
+			<-slots
+		}
+	}
+	e := &limitedExecutor{slots: slots}
+	for taken < n {
+		if err := e.acquire(ctx); err != nil {
+			release()
+			return ctx, nil, err
+		}
+		taken++
+	}
+	return context.WithValue(ctx, heldExecSlots{}, slots), release, nil
+}
+
+// newExecutor creates the SPDY executor for an exec URL, bounded by the
+// client's exec session limit.
+func (c *Client) newExecutor(u *url.URL) (remotecommand.Executor, error) {
+	exec, err := remotecommand.NewSPDYExecutor(c.restConfig, "POST", u)
+	if err != nil || c.execSlots == nil {
+		return exec, err
+	}
+	return &limitedExecutor{Executor: exec, slots: c.execSlots}, nil
+}
+
+// ExecSessions reports the exec sessions currently open on this connection
+// and the configured limit (0 when unlimited).
+func (c *Client) ExecSessions() (inUse, limit int) {
+	return len(c.execSlots), cap(c.execSlots)
+}
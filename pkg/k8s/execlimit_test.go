@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+type blockingExecutor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingExecutor) Stream(opts remotecommand.StreamOptions) error {
+	return b.StreamWithContext(context.Background(), opts)
+}
+
+func (b *blockingExecutor) StreamWithContext(ctx context.Context, _ remotecommand.StreamOptions) error {
+	b.started <- struct{}{}
+	<-b.release
+	return nil
+}
+
+func TestLimitedExecutorBoundsConcurrentStreams(t *testing.T) {
+	inner := &blockingExecutor{started: make(chan struct{}, 4), release: make(chan struct{})}
+	exec := &limitedExecutor{Executor: inner, slots: make(chan struct{}, 1)}
+
+	done := make(chan error, 2)
+	go func() { done <- exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{}) }()
+	<-inner.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := exec.StreamWithContext(ctx, remotecommand.StreamOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second stream should wait for a slot and give up with the context, got %v", err)
+	}
+
+	go func() { done <- exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{}) }()
+	close(inner.release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(exec.slots) != 0 {
+		t.Errorf("slots not released: %d in use", len(exec.slots))
+	}
+}
+
+func TestReserveExecSlotsForPairedStreams(t *testing.T) {
+	inner := &blockingExecutor{started: make(chan struct{}, 4), release: make(chan struct{})}
+	c := &Client{execSlots: make(chan struct{}, 2)}
+	exec := &limitedExecutor{Executor: inner, slots: c.execSlots}
+
+	// Both legs of a copy run on the slots reserved for it, even though a
+	// third exec could not start meanwhile.
+	ctx, release, err := c.ReserveExecSlots(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- exec.StreamWithContext(ctx, remotecommand.StreamOptions{}) }()
+		<-inner.started
+	}
+	if nested, _, _ := c.ReserveExecSlots(ctx, 2); nested != ctx {
+		t.Error("a reservation inside a reservation should reuse its slots")
+	}
+
+	// A second copy waits for the first instead of taking one slot of it.
+	waitCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.ReserveExecSlots(waitCtx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the second reservation to wait, got %v", err)
+	}
+	if len(c.execSlots) != 2 {
+		t.Errorf("a reservation that gave up should hold no slot, %d in use", len(c.execSlots))
+	}
+
+	inner.release <- struct{}{}
+	inner.release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	release()
+	if len(c.execSlots) != 0 {
+		t.Errorf("slots not released: %d in use", len(c.execSlots))
+	}
+
+	// More slots than the limit are never waited for.
+	small := &Client{execSlots: make(chan struct{}, 1)}
+	_, release, err = small.ReserveExecSlots(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestMaxExecSessions(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_MAX_EXEC_SESSIONS", "0")
+	if newExecSlots() != nil {
+		t.Error("0 should disable the limit")
+	}
+	t.Setenv("KUBE_BROWSER_MAX_EXEC_SESSIONS", "3")
+	if got := cap(newExecSlots()); got != 3 {
+		t.Errorf("limit = %d, want 3", got)
+	}
+	t.Setenv("KUBE_BROWSER_MAX_EXEC_SESSIONS", "many")
+	if got := cap(newExecSlots()); got != defaultMaxExecSessions {
+		t.Errorf("invalid value should fall back to %d, got %d", defaultMaxExecSessions, got)
+	}
+}
@@ -1,9 +1,14 @@
 package k8s
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 type PodExecutor interface {
 	execInPod(ctx context.Context, namespace, podName, containerName string, cmd []string) (string, string, error)
+	execInPodStream(ctx context.Context, namespace, podName, containerName string, cmd []string, stdin io.Reader, stdout io.Writer) (string, error)
 	createHelperPod(ctx context.Context, namespace, pvcName, volumeName, nodeName string) (string, error)
-	deleteHelperPod(ctx context.Context, namespace, podName string)
+	addDebugContainer(ctx context.Context, namespace, podName, volumeName string) (string, error)
+	deleteHelperPod(ctx context.Context, namespace, podName string) error
 }
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// modTimeDisplayLayout renders modification times for people, in UTC so
+// every client shows the same string.
+const modTimeDisplayLayout = "2006-01-02 15:04:05 UTC"
+
+// FormatSize renders a size in bytes the way the UI does: "512 B",
+// "1.5 KB", "3.2 GB", in powers of 1024.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n) / unit
+	for _, suffix := range []string{"KB", "MB", "GB", "TB"} {
+		if v < unit || suffix == "TB" {
+			return fmt.Sprintf("%.1f %s", v, suffix)
+		}
+		v /= unit
+	}
+	return ""
+}
+
+// MarshalJSON adds typed and display forms of Size and ModTime, which are
+// kept as strings for existing clients: "sizeBytes" and "sizeDisplay",
+// and, when the time is known, "modTimeUnix" (seconds since the epoch)
+// and "modTimeDisplay".
+func (f FileInfo) MarshalJSON() ([]byte, error) {
+	type plain FileInfo
+	out := struct {
+		plain
+		SizeBytes      int64  `json:"sizeBytes"`
+		SizeDisplay    string `json:"sizeDisplay"`
+		ModTimeUnix    int64  `json:"modTimeUnix,omitempty"`
+		ModTimeDisplay string `json:"modTimeDisplay,omitempty"`
+	}{plain: plain(f)}
+	if n, err := strconv.ParseInt(f.Size, 10, 64); err == nil {
+		out.SizeBytes = n
+	}
+	out.SizeDisplay = FormatSize(out.SizeBytes)
+	if t, err := time.Parse(time.RFC3339, f.ModTime); err == nil {
+		out.ModTimeUnix = t.Unix()
+		out.ModTimeDisplay = t.UTC().Format(modTimeDisplayLayout)
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,42 @@
+package k8s
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KB", 5 << 20: "5.0 MB", 3 << 30: "3.0 GB", 2 << 40: "2.0 TB", 4096 << 40: "4096.0 TB"} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestFileInfoJSON(t *testing.T) {
+	data, err := json.Marshal(FileInfo{Name: "a.log", Size: "1536", ModTime: "2024-01-15T10:30:00Z", Path: "logs/a.log"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	if got["name"] != "a.log" || got["size"] != "1536" || got["modTime"] != "2024-01-15T10:30:00Z" {
+		t.Errorf("expected the string fields to be kept, got %s", data)
+	}
+	if got["sizeBytes"] != float64(1536) || got["sizeDisplay"] != "1.5 KB" ||
+		got["modTimeUnix"] != float64(1705314600) || got["modTimeDisplay"] != "2024-01-15 10:30:00 UTC" {
+		t.Errorf("unexpected typed fields: %s", data)
+	}
+
+	var back FileInfo
+	if err := json.Unmarshal(data, &back); err != nil || back.Size != "1536" || back.ModTime != "2024-01-15T10:30:00Z" {
+		t.Errorf("expected the entry to read back, got %+v, %v", back, err)
+	}
+
+	data, _ = json.Marshal(FileInfo{Name: "new", Size: "0"})
+	got = nil
+	json.Unmarshal(data, &got)
+	if _, ok := got["modTimeUnix"]; ok {
+		t.Errorf("expected no time fields for an unknown time, got %s", data)
+	}
+}
@@ -0,0 +1,275 @@
+package k8s
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	gopath "path"
+	"sync/atomic"
+	"time"
+)
+
+// Files cross the exec channel as single-entry tar archives rather than as
+// raw cat/tee output. The channel itself carries bytes unchanged, but a
+// bare byte stream cannot tell a file that ended from a transfer that was
+// cut short, and it loses the file's mode and modification time. A tar
+// entry declares its size up front, so both ends notice truncation, and it
+// carries the metadata along.
+
+// FileHeader is implemented by the readers DownloadFile returns. Once the
+// first Read has returned, Header describes the file as tar recorded it in
+// the pod: size, mode and modification time. It is nil when the transfer
+// failed before the file started.
+type FileHeader interface {
+	Header() *tar.Header
+}
+
+// DownloadFile streams a file from the PVC. tar runs in the pod while the
+// returned reader is consumed, through a pipe: nothing is buffered beyond a
+// single write, and a slow reader slows the exec down instead of piling up
+// memory. Errors, including a missing file or one that ends short of the
+// size tar announced, surface from Read. Close the reader to stop the exec
+// early, e.g. when the browser goes away. The transfer is compressed as
+// KUBE_BROWSER_TRANSFER_COMPRESSION says; see DownloadFileCompressed.
+func (c *Client) DownloadFile(ctx context.Context, namespace, pvcName, filePath string) (io.ReadCloser, string, error) {
+	return c.DownloadFileCompressed(ctx, namespace, pvcName, filePath, DefaultTransferCompression())
+}
+
+// DownloadFileCompressed is DownloadFile with the tar stream compressed in
+// the pod with compression, falling back to gzip and then to none when
+// the pod lacks the tool, and decompressed here (see TransferInfo).
+// Windows pods send their files uncompressed.
+func (c *Client) DownloadFileCompressed(ctx context.Context, namespace, pvcName, filePath string, compression TransferCompression) (io.ReadCloser, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	archive, archiveW := io.Pipe()
+	pr, pw := io.Pipe()
+	d := &downloadReader{PipeReader: pr, cancel: cancel}
+
+	go func() {
+		defer cancel()
+		info, err := c.findPodForPVC(ctx, namespace, pvcName)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		unpack := d.unpack
+		if info.windows {
+			// PowerShell sends the file as base64 lines rather than tar.
+			unpack = func(r io.Reader, w io.Writer) error {
+				return d.unpackWindows(r, w, gopath.Base(filePath))
+			}
+		}
+		compressed := compression != CompressionNone && !info.windows
+		go func() {
+			var err error
+			if info.windows {
+				err = c.streamFileWindows(ctx, namespace, info, filePath, archiveW)
+			} else {
+				err = c.streamOnPod(ctx, namespace, pvcName, info, func(mountPath string) []string {
+					p := pvcPath(mountPath, filePath)
+					cmd := []string{"tar", "-chf", "-", "-C", gopath.Dir(p), "--", gopath.Base(p)}
+					if compressed {
+						return compressedCommand(cmd, compression)
+					}
+					return cmd
+				}, nil, archiveW)
+			}
+			archiveW.CloseWithError(err)
+		}()
+		var src io.Reader = archive
+		used := CompressionNone
+		if compressed {
+			src, used, err = decompressTransfer(archive)
+		}
+		d.compression.Store(used)
+		if err == nil {
+			err = unpack(src, pw)
+		}
+		// Stops the exec if the archive was abandoned early.
+		archive.CloseWithError(err)
+		pw.CloseWithError(err)
+	}()
+
+	return d, gopath.Base(filePath), nil
+}
+
+// downloadReader cancels the exec feeding a download when it is closed.
+type downloadReader struct {
+	*io.PipeReader
+	cancel      context.CancelFunc
+	header      atomic.Pointer[tar.Header]
+	compression atomic.Value
+}
+
+func (d *downloadReader) Close() error {
+	d.cancel()
+	return d.PipeReader.Close()
+}
+
+func (d *downloadReader) Header() *tar.Header {
+	return d.header.Load()
+}
+
+func (d *downloadReader) Compression() TransferCompression {
+	c, _ := d.compression.Load().(TransferCompression)
+	if c == "" {
+		return CompressionNone
+	}
+	return c
+}
+
+// unpack copies the single file in archive to w.
+func (d *downloadReader) unpack(archive io.Reader, w io.Writer) error {
+	tr := tar.NewReader(archive)
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return fmt.Errorf("download produced an empty archive")
+	}
+	if err != nil {
+		return err
+	}
+	if hdr.FileInfo().IsDir() {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is a directory; download it as an archive instead", hdr.Name)}
+	}
+	if !hdr.FileInfo().Mode().IsRegular() {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is not a regular file", hdr.Name)}
+	}
+	d.header.Store(hdr)
+
+	n, err := io.Copy(w, tr)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("download of %s ended after %d of %d bytes", hdr.Name, n, hdr.Size)
+	}
+	if err != nil {
+		return err
+	}
+	// Read up to the end of the stream so a failing exec still reports.
+	_, err = io.Copy(io.Discard, archive)
+	return err
+}
+
+// UploadSource is an upload whose length is known before it starts, such
+// as a browser upload that declares the file size. UploadFile sends it as a
+// tar entry, so a body that ends early or runs long fails the upload
+// instead of leaving a file of the wrong size, and ModTime is kept. Plain
+// readers of unknown length are written with tee.
+type UploadSource struct {
+	io.Reader
+	Size    int64
+	ModTime time.Time
+}
+
+// UploadFile streams data into destPath on the PVC through the exec's
+// stdin, so the upload is read only as fast as the pod accepts it and is
+// never held in memory. As with downloads, the helper pod fallback is only
+// tried while none of data has been consumed. The stream is sent
+// compressed as WithTransferCompression says.
+func (c *Client) UploadFile(ctx context.Context, namespace, pvcName, destPath string, data io.Reader) error {
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	if info.windows {
+		return c.uploadFileWindows(ctx, namespace, pvcName, info, destPath, data)
+	}
+	build := func(mountPath string) []string {
+		return []string{"tee", "--", pvcPath(mountPath, destPath)}
+	}
+	stdin := data
+	var archive *io.PipeReader
+	var framing chan error
+
+	if src, ok := data.(*UploadSource); ok {
+		name := gopath.Base(pvcPath("/", destPath))
+		if name == "/" || name == "." || name == ".." {
+			return fmt.Errorf("invalid upload path %q", destPath)
+		}
+		build = func(mountPath string) []string {
+			return []string{"tar", "-xof", "-", "-C", gopath.Dir(pvcPath(mountPath, destPath)), "--", name}
+		}
+		var archiveW *io.PipeWriter
+		archive, archiveW = io.Pipe()
+		framing = make(chan error, 1)
+		go func() {
+			err := writeTarEntry(archiveW, name, src)
+			archiveW.CloseWithError(err)
+			framing <- err
+		}()
+		stdin = archive
+	}
+
+	var stdout io.Writer = io.Discard
+	if compression := transferCompressionFrom(ctx); compression != CompressionNone {
+		compressed, out := compressingStdin(ctx, stdin, stdout)
+		defer compressed.Close()
+		plain := build
+		build = func(mountPath string) []string { return decompressedCommand(plain(mountPath)) }
+		stdin, stdout = compressed, out
+	}
+
+	in := &countingReader{r: stdin}
+	err = c.streamOnPod(ctx, namespace, pvcName, info, build, in, stdout)
+	if archive != nil {
+		// The archive's own error explains a failed exec better than
+		// tar's complaint about the stream it was given.
+		archive.CloseWithError(io.ErrClosedPipe)
+		if ferr := <-framing; ferr != nil && !errors.Is(ferr, io.ErrClosedPipe) {
+			err = ferr
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if in.n > 0 {
+		// The pod had started writing destPath when the upload broke off,
+		// so the earlier version is gone either way; don't leave a file
+		// that looks complete but isn't.
+		c.schedulePartialUploadRemoval(namespace, pvcName, destPath)
+	}
+	return fmt.Errorf("failed to upload file: %w", err)
+}
+
+// writeTarEntry writes src to w as a tar archive holding one regular file.
+func writeTarEntry(w io.Writer, name string, src *UploadSource) error {
+	modTime := src.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	tw := tar.NewWriter(w)
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     src.Size,
+		Mode:     0o644,
+		// Whole seconds keep the header plain ustar, which every tar
+		// understands.
+		ModTime: modTime.Truncate(time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	if err := copyUploadBody(tw, src); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// copyUploadBody copies src to w, failing unless it holds exactly the
+// src.Size bytes announced.
+func copyUploadBody(w io.Writer, src *UploadSource) error {
+	n, err := io.CopyN(w, src.Reader, src.Size)
+	if err == io.EOF {
+		return fmt.Errorf("upload ended after %d of %d bytes", n, src.Size)
+	}
+	if err != nil {
+		return err
+	}
+	if extra, err := io.CopyN(io.Discard, src.Reader, 1); extra > 0 {
+		return fmt.Errorf("upload is longer than the %d bytes announced", src.Size)
+	} else if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HelperEvent is one step of a helper pod's startup: a Kubernetes event
+// for the pod ("Pulling image alpine:3.19"), a change of its waiting
+// reason, or a line of its log after it failed. Operations that wait on a
+// helper pod report them as they happen, so the UI can show what the
+// cluster is doing instead of a bare spinner.
+type HelperEvent struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	PVC       string    `json:"pvc"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Warning   bool      `json:"warning,omitempty"`
+}
+
+// helperLogTail is how many log lines of a failed helper pod are reported.
+const helperLogTail = 20
+
+// SetHelperEvents makes the client report helper pod startup events to fn.
+// fn is called from the goroutine waiting on the pod and must not block.
+func (c *Client) SetHelperEvents(fn func(HelperEvent)) {
+	c.helperEvents = fn
+}
+
+// helperWatch follows one helper pod while it starts.
+type helperWatch struct {
+	c         *Client
+	namespace string
+	pod       string
+	pvc       string
+	// seen holds the events already reported, by UID and count, since a
+	// repeated event (BackOff) is updated in place.
+	seen          map[string]int32
+	lastReason    string
+	lastWarning   string
+	eventsAllowed bool
+
+	// pullFailures counts failed pulls of the helper image, from the
+	// kubelet's events or, without them, the waiting reasons seen.
+	pullFailures int
+	// scaleUp and noScaleUp record the cluster autoscaler's verdict on
+	// an unschedulable pod.
+	scaleUp, noScaleUp bool
+	// unschedulableSince is when the pod was first seen unschedulable.
+	unschedulableSince time.Time
+	// multiAttach is the Multi-Attach event of a pod whose ReadWriteOnce
+	// volume is attached to another node.
+	multiAttach string
+}
+
+func (c *Client) watchHelper(namespace, pod, pvc string) *helperWatch {
+	return &helperWatch{c: c, namespace: namespace, pod: pod, pvc: pvc, seen: map[string]int32{}, eventsAllowed: true}
+}
+
+func (w *helperWatch) report(reason, message string, warning bool) {
+	if warning {
+		w.lastWarning = message
+	}
+	if w.c.helperEvents == nil {
+		return
+	}
+	w.c.helperEvents(HelperEvent{
+		Time:      time.Now(),
+		Namespace: w.namespace,
+		Pod:       w.pod,
+		PVC:       w.pvc,
+		Reason:    reason,
+		Message:   message,
+		Warning:   warning,
+	})
+}
+
+// poll reports the pod's new events and, when it changed, the reason its
+// container is waiting. The pod itself has just been fetched by the caller.
+func (w *helperWatch) poll(ctx context.Context, p *corev1.Pod) {
+	if w.eventsAllowed {
+		list, err := w.c.clientset.CoreV1().Events(w.namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("involvedObject.kind=Pod,involvedObject.name=%s", w.pod),
+		})
+		if err != nil {
+			// Listing events is optional (see RBACOptions); the waiting
+			// reasons below still tell most of the story.
+			log.Printf("Cannot list events of helper pod %s, reporting its status only: %v", w.pod, err)
+			w.eventsAllowed = false
+		} else {
+			items := list.Items
+			sortEvents(items)
+			for _, ev := range items {
+				if ev.InvolvedObject.Name != w.pod {
+					continue
+				}
+				key := string(ev.UID) + "/" + ev.Name
+				if count, ok := w.seen[key]; ok && count >= ev.Count {
+					continue
+				}
+				w.seen[key] = ev.Count
+				w.note(ev)
+				w.report(ev.Reason, ev.Message, ev.Type == corev1.EventTypeWarning)
+			}
+		}
+	}
+
+	if len(p.Status.ContainerStatuses) > 0 {
+		if waiting := p.Status.ContainerStatuses[0].State.Waiting; waiting != nil && waiting.Reason != w.lastReason {
+			w.lastReason = waiting.Reason
+			if waiting.Reason == "ErrImagePull" && !w.eventsAllowed {
+				w.pullFailures++
+			}
+			message := waiting.Reason
+			if waiting.Message != "" {
+				message += ": " + waiting.Message
+			}
+			w.report(waiting.Reason, message, waiting.Reason != "ContainerCreating")
+		}
+	}
+}
+
+// note records what an event says about the pod's chances to start.
+func (w *helperWatch) note(ev corev1.Event) {
+	switch ev.Reason {
+	case "Failed":
+		if strings.Contains(ev.Message, "pull") && int(ev.Count) > w.pullFailures {
+			w.pullFailures = int(ev.Count)
+		}
+	case "TriggeredScaleUp":
+		w.scaleUp = true
+	case "NotTriggerScaleUp":
+		w.noScaleUp = true
+	case "FailedAttachVolume":
+		if strings.Contains(ev.Message, "Multi-Attach") {
+			w.multiAttach = ev.Message
+		}
+	}
+}
+
+// reportLogs reports the last lines a failed helper pod wrote, which
+// usually say why its command did not run.
+func (w *helperWatch) reportLogs(ctx context.Context) {
+	tail := int64(helperLogTail)
+	raw, err := w.c.clientset.CoreV1().Pods(w.namespace).GetLogs(w.pod, &corev1.PodLogOptions{Container: "helper", TailLines: &tail}).DoRaw(ctx)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.report("Log", line, true)
+		}
+	}
+}
+
+// explain adds the last warning seen to err, which would otherwise only
+// name the pod's phase and reason.
+func (w *helperWatch) explain(err *K8sError) *K8sError {
+	if w.lastWarning != "" && !strings.Contains(err.Message, w.lastWarning) {
+		err.Message += " Last event: " + w.lastWarning
+	}
+	return err
+}
+
+// sortEvents orders events oldest first; the API returns them unordered.
+func sortEvents(items []corev1.Event) {
+	stamp := func(ev corev1.Event) time.Time {
+		if !ev.LastTimestamp.IsZero() {
+			return ev.LastTimestamp.Time
+		}
+		if !ev.EventTime.IsZero() {
+			return ev.EventTime.Time
+		}
+		return ev.CreationTimestamp.Time
+	}
+	sort.SliceStable(items, func(i, j int) bool { return stamp(items[i]).Before(stamp(items[j])) })
+}
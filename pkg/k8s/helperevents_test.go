@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func helperPodEvent(name, reason, message, eventType string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "kube-browser-helper-x", Namespace: "default"},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Count:          1,
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func TestHelperWatchReportsEventsOnce(t *testing.T) {
+	now := time.Now()
+	clientset := fake.NewSimpleClientset(
+		helperPodEvent("b", "Pulling", `Pulling image "alpine:3.19"`, corev1.EventTypeNormal, now),
+		helperPodEvent("a", "Scheduled", "Successfully assigned default/kube-browser-helper-x to node-1", corev1.EventTypeNormal, now.Add(-time.Second)),
+	)
+	var got []HelperEvent
+	c := &Client{clientset: clientset}
+	c.SetHelperEvents(func(ev HelperEvent) { got = append(got, ev) })
+
+	w := c.watchHelper("default", "kube-browser-helper-x", "my-pvc")
+	pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	w.poll(context.Background(), pod)
+	w.poll(context.Background(), pod)
+	if len(got) != 2 || got[0].Reason != "Scheduled" || got[1].Reason != "Pulling" || got[1].PVC != "my-pvc" {
+		t.Fatalf("expected both events once, oldest first, got %+v", got)
+	}
+
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{State: corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "manifest unknown"},
+	}}}
+	w.poll(context.Background(), pod)
+	w.poll(context.Background(), pod)
+	if len(got) != 3 || !got[2].Warning || got[2].Message != "ErrImagePull: manifest unknown" {
+		t.Fatalf("expected the waiting reason to be reported once, got %+v", got)
+	}
+
+	err := w.explain(classifyPodError("Pending", "ErrImagePull"))
+	if !strings.HasSuffix(err.Message, "Last event: ErrImagePull: manifest unknown") {
+		t.Errorf("expected the error to name the last warning, got %q", err.Message)
+	}
+}
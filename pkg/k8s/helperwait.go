@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// helperWaitConfig bounds how long createHelperPod waits for a helper pod
+// and when it gives up before that.
+type helperWaitConfig struct {
+	// startup is the longest wait for the pod to run
+	// (HELPER_STARTUP_TIMEOUT_SEC).
+	startup time.Duration
+	// poll is the interval between status checks.
+	poll time.Duration
+	// unschedulableGrace is how long a pod the scheduler rejected may stay
+	// Pending before the wait is abandoned, unless the cluster autoscaler
+	// is adding a node for it (HELPER_UNSCHEDULABLE_GRACE_SEC).
+	unschedulableGrace time.Duration
+	// pullRetries is how many failed pulls of the helper image end the
+	// wait (HELPER_IMAGE_PULL_RETRIES): the kubelet retries a registry
+	// hiccup, but a missing image fails every time.
+	pullRetries int
+}
+
+// helperPollInterval is how often a starting helper pod is checked.
+var helperPollInterval = 2 * time.Second
+
+// envSeconds reads a duration in whole seconds, falling back to def when
+// the variable is unset or invalid. zeroOK admits 0.
+func envSeconds(key string, def time.Duration, zeroOK bool) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || (n == 0 && !zeroOK) {
+		log.Printf("Warning: invalid %s %q, using %s", key, v, def)
+		return def
+	}
+	return time.Duration(n) * time.Second
+}
+
+func helperWaitSettings() helperWaitConfig {
+	cfg := helperWaitConfig{
+		startup:            envSeconds("HELPER_STARTUP_TIMEOUT_SEC", 60*time.Second, false),
+		poll:               helperPollInterval,
+		unschedulableGrace: envSeconds("HELPER_UNSCHEDULABLE_GRACE_SEC", 15*time.Second, true),
+		pullRetries:        3,
+	}
+	if v := os.Getenv("HELPER_IMAGE_PULL_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
+			cfg.pullRetries = n
+		} else {
+			log.Printf("Warning: invalid HELPER_IMAGE_PULL_RETRIES %q, using %d", v, cfg.pullRetries)
+		}
+	}
+	return cfg
+}
+
+// helperOperationContext bounds an operation that falls back to a helper
+// pod, from starting the pod to the end of its last command, by
+// KUBE_BROWSER_HELPER_OPERATION_TIMEOUT_SEC. Unset, only the caller's
+// context applies.
+func helperOperationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := envSeconds("KUBE_BROWSER_HELPER_OPERATION_TIMEOUT_SEC", 0, true)
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// unschedulable returns the scheduler's message when it has rejected p.
+func unschedulable(p *corev1.Pod) (string, bool) {
+	for _, cond := range p.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return cond.Message, true
+		}
+	}
+	return "", false
+}
+
+// terminal reports whether p, still not running, clearly never will: its
+// image name is invalid or its image failed to pull cfg.pullRetries times,
+// or the scheduler has rejected it for longer than cfg.unschedulableGrace
+// without the cluster autoscaler adding a node for it.
+func (w *helperWatch) terminal(p *corev1.Pod, cfg helperWaitConfig, now time.Time) *K8sError {
+	if len(p.Status.ContainerStatuses) > 0 {
+		if waiting := p.Status.ContainerStatuses[0].State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "InvalidImageName", "ErrImageNeverPull":
+				return classifyPodError(string(corev1.PodPending), waiting.Reason)
+			case "ErrImagePull", "ImagePullBackOff":
+				if w.pullFailures >= cfg.pullRetries {
+					return classifyPodError(string(corev1.PodPending), waiting.Reason)
+				}
+			}
+		}
+	}
+
+	message, ok := unschedulable(p)
+	if !ok {
+		w.unschedulableSince = time.Time{}
+		return nil
+	}
+	if w.unschedulableSince.IsZero() {
+		w.unschedulableSince = now
+	}
+	switch {
+	case w.scaleUp:
+		return nil
+	case w.noScaleUp, now.Sub(w.unschedulableSince) >= cfg.unschedulableGrace:
+		err := classifyPodError(string(corev1.PodPending), corev1.PodReasonUnschedulable)
+		if message != "" {
+			err.Message += fmt.Sprintf(" Scheduler: %s", message)
+		}
+		return err
+	}
+	return nil
+}
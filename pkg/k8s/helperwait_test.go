@@ -0,0 +1,130 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func waitingPod(reason string) *corev1.Pod {
+	return &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodPending,
+		ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: reason},
+		}}},
+	}}
+}
+
+func unschedulablePod() *corev1.Pod {
+	return &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodPending,
+		Conditions: []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Reason:  corev1.PodReasonUnschedulable,
+			Message: "0/3 nodes are available: 3 Insufficient cpu.",
+		}},
+	}}
+}
+
+func TestHelperWatchTerminal(t *testing.T) {
+	cfg := helperWaitConfig{unschedulableGrace: 10 * time.Second, pullRetries: 3}
+	now := time.Now()
+	w := (&Client{}).watchHelper("default", "helper", "data")
+
+	if err := w.terminal(waitingPod("ContainerCreating"), cfg, now); err != nil {
+		t.Errorf("a creating container must be waited for, got %v", err)
+	}
+	if err := w.terminal(waitingPod("InvalidImageName"), cfg, now); err == nil || !strings.Contains(err.Message, "HELPER_IMAGE") {
+		t.Errorf("an invalid image name must end the wait, got %v", err)
+	}
+
+	w.pullFailures = 2
+	if err := w.terminal(waitingPod("ImagePullBackOff"), cfg, now); err != nil {
+		t.Errorf("a pull may be retried, got %v", err)
+	}
+	w.pullFailures = 3
+	if err := w.terminal(waitingPod("ImagePullBackOff"), cfg, now); err == nil || err.Kind != ErrKindHelperPending {
+		t.Errorf("repeated pull failures must end the wait, got %v", err)
+	}
+
+	if err := w.terminal(unschedulablePod(), cfg, now); err != nil {
+		t.Errorf("an unschedulable pod gets a grace period, got %v", err)
+	}
+	err := w.terminal(unschedulablePod(), cfg, now.Add(10*time.Second))
+	if err == nil || !strings.Contains(err.Message, "Insufficient cpu") {
+		t.Errorf("an unschedulable pod must be given up after the grace period, got %v", err)
+	}
+
+	w = (&Client{}).watchHelper("default", "helper", "data")
+	w.note(corev1.Event{Reason: "TriggeredScaleUp"})
+	w.terminal(unschedulablePod(), cfg, now)
+	if err := w.terminal(unschedulablePod(), cfg, now.Add(time.Hour)); err != nil {
+		t.Errorf("a pod the autoscaler is adding a node for must be waited for, got %v", err)
+	}
+
+	w = (&Client{}).watchHelper("default", "helper", "data")
+	w.note(corev1.Event{Reason: "NotTriggerScaleUp"})
+	if err := w.terminal(unschedulablePod(), cfg, now); err == nil {
+		t.Error("a pod no node can be added for must be given up at once")
+	}
+}
+
+func TestCreateHelperPodGivesUpWhenUnschedulable(t *testing.T) {
+	t.Setenv("HELPER_UNSCHEDULABLE_GRACE_SEC", "0")
+	t.Setenv("HELPER_STARTUP_TIMEOUT_SEC", "30")
+	defer func(d time.Duration) { helperPollInterval = d }(helperPollInterval)
+	helperPollInterval = 10 * time.Millisecond
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := unschedulablePod()
+		pod.Name = action.(k8stesting.GetAction).GetName()
+		return true, pod, nil
+	})
+	c := &Client{clientset: clientset, executor: &mockPodExecutor{}}
+
+	start := time.Now()
+	_, err := c.createHelperPod(context.Background(), "default", "data", "", "")
+	ke, ok := err.(*K8sError)
+	if !ok || ke.Kind != ErrKindHelperPending || !strings.Contains(ke.Message, "no node is available") {
+		t.Fatalf("expected an unschedulable error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected to give up early, waited %s", time.Since(start))
+	}
+}
+
+func TestCreateHelperPodStopsWhenCanceled(t *testing.T) {
+	defer func(d time.Duration) { helperPollInterval = d }(helperPollInterval)
+	helperPollInterval = time.Hour
+
+	c := &Client{clientset: fake.NewSimpleClientset(), executor: &mockPodExecutor{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.createHelperPod(ctx, "default", "data", "", "")
+	if ke, ok := err.(*K8sError); !ok || ke.Kind != ErrKindTimeout {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestHelperOperationContext(t *testing.T) {
+	ctx, cancel := helperOperationContext(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline by default")
+	}
+	cancel()
+
+	t.Setenv("KUBE_BROWSER_HELPER_OPERATION_TIMEOUT_SEC", "90")
+	ctx, cancel = helperOperationContext(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > 90*time.Second {
+		t.Errorf("expected a 90s deadline, got %v", deadline)
+	}
+}
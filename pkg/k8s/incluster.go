@@ -0,0 +1,41 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// InClusterContext is the pseudo context name offered when KubeBrowser runs
+// in a pod. Connecting to it authenticates as the pod's ServiceAccount.
+const InClusterContext = "in-cluster"
+
+// RunningInCluster reports whether KubeBrowser runs inside a pod with a
+// mounted ServiceAccount token.
+func RunningInCluster() bool {
+	_, err := rest.InClusterConfig()
+	return err == nil
+}
+
+// NewInClusterClient connects with the pod's ServiceAccount. Its token is a
+// projected, auto-rotated file that client-go re-reads, so unlike kubeconfig
+// credentials its expiry is not tracked.
+func NewInClusterClient() (*Client, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return &Client{
+		clientset:   clientset,
+		restConfig:  config,
+		ContextName: InClusterContext,
+		execSlots:   newExecSlots(),
+	}, nil
+}
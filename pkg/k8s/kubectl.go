@@ -0,0 +1,120 @@
+package k8s
+
+import (
+	"context"
+	gopath "path"
+	"strings"
+)
+
+// PVCTarget identifies where a path on a PVC can be reached from outside
+// KubeBrowser: the running pod and container that mount the claim and the
+// absolute path inside that container.
+type PVCTarget struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	MountPath string `json:"mountPath"`
+	FullPath  string `json:"fullPath"`
+}
+
+// KubectlCommands holds shell-ready kubectl invocations equivalent to the
+// operations KubeBrowser performs on a single remote path.
+type KubectlCommands struct {
+	Exec     string `json:"exec"`
+	List     string `json:"list"`
+	Cat      string `json:"cat"`
+	CopyFrom string `json:"copyFrom"`
+	CopyTo   string `json:"copyTo"`
+}
+
+func (c *Client) ResolvePVCPath(ctx context.Context, namespace, pvcName, filePath string) (*PVCTarget, error) {
+	filePath = strings.ReplaceAll(filePath, "\\", "/")
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	return &PVCTarget{
+		Namespace: namespace,
+		PVC:       pvcName,
+		Pod:       info.podName,
+		Container: info.containerName,
+		MountPath: info.mountPath,
+		FullPath:  gopath.Join(info.mountPath, filePath),
+	}, nil
+}
+
+// KubectlCommands renders kubectl commands for target using this client's
+// kubeconfig and context, so they can be pasted into a terminal or script
+// as-is.
+func (c *Client) KubectlCommands(target *PVCTarget, isDir bool) KubectlCommands {
+	kubectl := c.kubectlBase()
+	exec := concatArgs(kubectl, "-n", target.Namespace, "exec", target.Pod, "-c", target.Container, "--")
+
+	listDir := target.FullPath
+	if !isDir {
+		listDir = gopath.Dir(target.FullPath)
+	}
+	localName := gopath.Base(target.FullPath)
+	if localName == "/" || localName == "." {
+		localName = target.PVC
+	}
+	remote := target.Namespace + "/" + target.Pod + ":" + target.FullPath
+
+	cmds := KubectlCommands{
+		Exec:     shellJoin(concatArgs(exec, "sh")),
+		List:     shellJoin(concatArgs(exec, "ls", "-la", listDir)),
+		CopyFrom: shellJoin(concatArgs(kubectl, "cp", "-c", target.Container, remote, "./"+localName)),
+		CopyTo:   shellJoin(concatArgs(kubectl, "cp", "-c", target.Container, "./"+localName, remote)),
+	}
+	if !isDir {
+		cmds.Cat = shellJoin(concatArgs(exec, "cat", target.FullPath))
+	}
+	return cmds
+}
+
+// kubectlBase is "kubectl" with the --kubeconfig and --context flags that
+// point it at the cluster this client is connected to.
+func (c *Client) kubectlBase() []string {
+	kubectl := []string{"kubectl"}
+	if c.KubeconfigPath != "" && c.KubeconfigPath != DefaultKubeconfigPath() {
+		kubectl = append(kubectl, "--kubeconfig", c.KubeconfigPath)
+	}
+	if c.ContextName != "" {
+		kubectl = append(kubectl, "--context", c.ContextName)
+	}
+	return kubectl
+}
+
+func concatArgs(base []string, extra ...string) []string {
+	out := make([]string, 0, len(base)+len(extra))
+	out = append(out, base...)
+	return append(out, extra...)
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s for POSIX shells, leaving common safe words bare so
+// the generated commands stay readable.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"/data/file.txt": "/data/file.txt",
+		"":               "''",
+		"my file.txt":    "'my file.txt'",
+		"it's":           `'it'\''s'`,
+		"$(rm -rf /)":    "'$(rm -rf /)'",
+		"ns/pod:/data/x": "ns/pod:/data/x",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestKubectlCommandsForFile(t *testing.T) {
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), ContextName: "prod"}
+	target, err := c.ResolvePVCPath(context.Background(), "default", "my-pvc", "/logs/app 1.log")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.FullPath != "/data/logs/app 1.log" || target.Pod != "app-pod" || target.Container != "app" {
+		t.Fatalf("unexpected target: %+v", target)
+	}
+
+	cmds := c.KubectlCommands(target, false)
+	if want := "kubectl --context prod -n default exec app-pod -c app -- cat '/data/logs/app 1.log'"; cmds.Cat != want {
+		t.Errorf("Cat = %q, want %q", cmds.Cat, want)
+	}
+	if want := "kubectl --context prod -n default exec app-pod -c app -- ls -la /data/logs"; cmds.List != want {
+		t.Errorf("List = %q, want %q", cmds.List, want)
+	}
+	if want := "kubectl --context prod cp -c app 'default/app-pod:/data/logs/app 1.log' './app 1.log'"; cmds.CopyFrom != want {
+		t.Errorf("CopyFrom = %q, want %q", cmds.CopyFrom, want)
+	}
+}
+
+func TestKubectlCommandsForDirectoryOmitsCat(t *testing.T) {
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc"))}
+	target, err := c.ResolvePVCPath(context.Background(), "default", "my-pvc", "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cmds := c.KubectlCommands(target, true)
+	if cmds.Cat != "" {
+		t.Errorf("expected no cat command for a directory, got %q", cmds.Cat)
+	}
+	if want := "kubectl -n default exec app-pod -c app -- ls -la /data"; cmds.List != want {
+		t.Errorf("List = %q, want %q", cmds.List, want)
+	}
+}
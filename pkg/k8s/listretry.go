@@ -0,0 +1,160 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// While the API server restarts, or a load balancer in front of it moves
+// to another replica, requests fail for a few seconds with errors that go
+// away on their own. The list calls the UI is built on (namespaces, claims,
+// pods) are retried through that window with a jittered exponential
+// backoff, so browsing slows down instead of failing.
+
+// listRetryBase and listRetryMax bound the wait between two attempts; the
+// first waits up to listRetryBase, each one after up to twice as long.
+var (
+	listRetryBase = 250 * time.Millisecond
+	listRetryMax  = 4 * time.Second
+)
+
+// apiDegradedFor is how long after a retried or failed list the API server
+// is reported degraded.
+const apiDegradedFor = time.Minute
+
+// listRetries reads KUBE_BROWSER_LIST_RETRIES, how many times a list call
+// failing with a transient error is tried again (default 4, 0 to never).
+func listRetries() int {
+	if v := os.Getenv("KUBE_BROWSER_LIST_RETRIES"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			return parsed
+		}
+		log.Printf("Warning: invalid KUBE_BROWSER_LIST_RETRIES %q, using 4", v)
+	}
+	return 4
+}
+
+// isTransientAPIError reports whether err is one a retry may well not
+// see: the API server unreachable or restarting, a dropped connection, or
+// a 5xx or 429 answer. Refusals such as 403 and 404 are final.
+func isTransientAPIError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	if apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection refused") || strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "http2: client connection lost") || strings.HasSuffix(msg, "EOF")
+}
+
+// listBackoff returns how long to wait before retry n (from 0): a random
+// time up to listRetryBase·2ⁿ, capped at listRetryMax, so that clients
+// that failed together do not all come back at once.
+func listBackoff(n int) time.Duration {
+	d := listRetryBase << n
+	if d <= 0 || d > listRetryMax {
+		d = listRetryMax
+	}
+	return time.Duration(rand.Int63n(int64(d))) + time.Millisecond
+}
+
+// APIHealth tells whether list calls have needed retries lately.
+type APIHealth struct {
+	Degraded bool `json:"degraded"`
+	// Retries counts the retries made since the client connected.
+	Retries   int64     `json:"retries"`
+	LastError string    `json:"lastError,omitempty"`
+	LastRetry time.Time `json:"lastRetry,omitempty"`
+	Warning   string    `json:"warning,omitempty"`
+}
+
+// apiHealthTracker records the retries of a client's list calls.
+type apiHealthTracker struct {
+	mu        sync.Mutex
+	retries   int64
+	lastError string
+	lastRetry time.Time
+}
+
+func (t *apiHealthTracker) retried(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retries++
+	t.lastError = err.Error()
+	t.lastRetry = time.Now()
+}
+
+func (t *apiHealthTracker) status(now time.Time) APIHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := APIHealth{Retries: t.retries, LastError: t.lastError, LastRetry: t.lastRetry}
+	if !t.lastRetry.IsZero() && now.Sub(t.lastRetry) < apiDegradedFor {
+		h.Degraded = true
+		h.Warning = "The Kubernetes API server is answering with errors; lists are being retried and may be slow."
+	}
+	return h
+}
+
+// APIHealth reports whether the cluster's API server has needed list calls
+// retried within the last minute.
+func (c *Client) APIHealth() APIHealth {
+	return c.apiHealth.status(time.Now())
+}
+
+// withListRetry runs list, and runs it again while it fails with a
+// transient error, up to listRetries times, waiting longer each time.
+// The last error is returned once the retries are spent or ctx is done.
+func withListRetry[T any](ctx context.Context, c *Client, what string, list func(context.Context) (T, error)) (T, error) {
+	retries := listRetries()
+	for n := 0; ; n++ {
+		out, err := list(ctx)
+		if err == nil || n >= retries || !isTransientAPIError(err) {
+			return out, err
+		}
+		c.apiHealth.retried(err)
+		wait := listBackoff(n)
+		log.Printf("Listing %s failed (%v), retrying in %s (%d/%d)", what, err, wait.Round(time.Millisecond), n+1, retries)
+		select {
+		case <-ctx.Done():
+			return out, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// listPods lists the pods of a namespace, retrying through transient
+// errors.
+func (c *Client) listPods(ctx context.Context, namespace string) (*corev1.PodList, error) {
+	return withListRetry(ctx, c, "pods in "+namespace, func(ctx context.Context) (*corev1.PodList, error) {
+		return c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	})
+}
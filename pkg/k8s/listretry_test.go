@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestIsTransientAPIError(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("Get \"https://10.0.0.1:6443/api/v1/pods\": %w", syscall.ECONNREFUSED), true},
+		{fmt.Errorf("Get \"https://10.0.0.1:6443/api/v1/pods\": %w", io.EOF), true},
+		{errors.New("Get \"https://10.0.0.1:6443/api/v1/namespaces\": dial tcp 10.0.0.1:6443: connect: connection refused"), true},
+		{apierrors.NewServiceUnavailable("apiserver is shutting down"), true},
+		{apierrors.NewInternalError(errors.New("etcdserver: leader changed")), true},
+		{apierrors.NewTooManyRequests("slow down", 1), true},
+		{apierrors.NewForbidden(pods, "", errors.New("no")), false},
+		{apierrors.NewNotFound(pods, "web"), false},
+		{context.Canceled, false},
+		{errors.New("invalid label selector"), false},
+	} {
+		if got := isTransientAPIError(tt.err); got != tt.want {
+			t.Errorf("isTransientAPIError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestListRetry(t *testing.T) {
+	listRetryBase, listRetryMax = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { listRetryBase, listRetryMax = 250*time.Millisecond, 4*time.Second })
+
+	clientset := fake.NewSimpleClientset(runningPodWithPVC("my-pvc"))
+	failures := 2
+	clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, apierrors.NewServiceUnavailable("apiserver is restarting")
+		}
+		return false, nil, nil
+	})
+	c := &Client{clientset: clientset}
+
+	pods, err := c.ListPods(context.Background(), "default")
+	if err != nil || len(pods) != 1 {
+		t.Fatalf("expected the list to succeed on the third try, got %v, %v", pods, err)
+	}
+	if h := c.APIHealth(); !h.Degraded || h.Retries != 2 || h.Warning == "" {
+		t.Errorf("expected the API server to be reported degraded, got %+v", h)
+	}
+	if h := c.apiHealth.status(time.Now().Add(2 * apiDegradedFor)); h.Degraded {
+		t.Errorf("expected the degradation to wear off, got %+v", h)
+	}
+
+	// Retries are bounded, and a final error is not retried at all.
+	t.Setenv("KUBE_BROWSER_LIST_RETRIES", "1")
+	failures = 5
+	if _, err := c.ListPods(context.Background(), "default"); !apierrors.IsServiceUnavailable(err) || failures != 3 {
+		t.Errorf("expected one retry before giving up, got %v with %d failures left", err, failures)
+	}
+	calls := 0
+	clientset.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "", errors.New("no"))
+	})
+	if _, err := c.ListNamespaces(context.Background()); err == nil || calls != 1 {
+		t.Errorf("expected a forbidden list not to be retried, got %v after %d calls", err, calls)
+	}
+}
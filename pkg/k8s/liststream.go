@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// findPrintfDecoder parses findPrintfFormat records as the exec output
+// arrives and hands each entry to emit, so a huge directory is not held
+// in memory as one string.
+type findPrintfDecoder struct {
+	path string
+	emit func(FileInfo) error
+
+	buf     []byte
+	fields  []string
+	records int
+	// err is the error emit returned, which stops the listing.
+	err error
+}
+
+func (d *findPrintfDecoder) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.buf = append(d.buf, p...)
+	for {
+		end := bytes.IndexByte(d.buf, 0)
+		if end < 0 {
+			break
+		}
+		d.fields = append(d.fields, string(d.buf[:end]))
+		d.buf = d.buf[end+1:]
+		if len(d.fields) < findPrintfFields {
+			continue
+		}
+		f, ok := findPrintfEntry(d.fields, d.path)
+		d.fields = d.fields[:0]
+		d.records++
+		if !ok {
+			continue
+		}
+		if err := d.emit(f); err != nil {
+			d.err = err
+			return 0, err
+		}
+	}
+	// Compact what is left of a record cut between two writes.
+	d.buf = append([]byte(nil), d.buf...)
+	return len(p), nil
+}
+
+// close reports a listing that ended in the middle of a record.
+func (d *findPrintfDecoder) close() error {
+	if len(d.buf) > 0 || len(d.fields) > 0 {
+		return &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("listing ended in the middle of an entry after %d entries", d.records)}
+	}
+	return nil
+}
+
+// StreamFiles lists path like ListFiles but hands each entry to fn as soon
+// as find prints it, for directories too large to wait for. Entries come in
+// directory order. An error from fn stops the listing and is returned.
+//
+// Only GNU find streams; where it is missing, or on Windows nodes, the
+// directory is listed as ListFiles does and the entries are handed over
+// once it is done.
+func (c *Client) StreamFiles(ctx context.Context, namespace, pvcName, path string, fn func(FileInfo) error) error {
+	path = strings.ReplaceAll(path, "\\", "/")
+	path = strings.TrimSuffix(path, "/")
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	if !info.windows {
+		dec := &findPrintfDecoder{path: path, emit: fn}
+		err = c.streamOnPod(ctx, namespace, pvcName, info, func(mountPath string) []string {
+			return []string{"env", "LC_ALL=C", "find", listingPath(mountPath, path), "-mindepth", "1", "-maxdepth", "1", "-printf", findPrintfFormat}
+		}, nil, dec)
+		switch {
+		case dec.err != nil:
+			return dec.err
+		case err == nil:
+			return dec.close()
+		case dec.records > 0:
+			return err
+		}
+		if k, ok := err.(*K8sError); ok && isFinalListingError(k.Kind) {
+			return k
+		}
+		log.Printf("Streaming %s/%s:%s with GNU find failed (%v), listing it instead", namespace, pvcName, path, err)
+	}
+	files, err := c.ListFiles(ctx, namespace, pvcName, path)
+	if err != nil {
+		return err
+	}
+	return emitFiles(files, fn)
+}
+
+// emitFiles hands a finished listing to fn, for backends that cannot
+// stream.
+func emitFiles(files []FileInfo, fn func(FileInfo) error) error {
+	for _, f := range files {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindPrintfDecoderAcrossWrites(t *testing.T) {
+	var names []string
+	d := &findPrintfDecoder{path: "/logs", emit: func(f FileInfo) error {
+		names = append(names, f.Path)
+		return nil
+	}}
+	out := findPrintfRecord("f", "-rw-r--r--", "1", "a\nb", "") + findPrintfRecord("d", "drwxr-xr-x", "0", "dir", "")
+	for i := 0; i < len(out); i++ {
+		d.Write([]byte{out[i]})
+	}
+	if err := d.close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "/logs/a\nb" || names[1] != "/logs/dir" {
+		t.Errorf("unexpected entries %q", names)
+	}
+
+	d.Write([]byte("f\x00-rw"))
+	if d.close() == nil {
+		t.Error("expected a listing cut in the middle of an entry to fail")
+	}
+}
+
+func TestStreamFiles(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream(findPrintfRecord("f", "-rw-r--r--", "42", "a.txt", "")+findPrintfRecord("f", "-rw-r--r--", "7", "b.txt", ""), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var names []string
+	err := c.StreamFiles(context.Background(), "default", "my-pvc", "/", func(f FileInfo) error {
+		names = append(names, f.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "a.txt" || names[1] != "b.txt" {
+		t.Errorf("unexpected entries %q", names)
+	}
+
+	stop := errors.New("client went away")
+	mock.pushStream(findPrintfRecord("f", "-rw-r--r--", "42", "a.txt", "")+findPrintfRecord("f", "-rw-r--r--", "7", "b.txt", ""), "", nil)
+	calls := 0
+	err = c.StreamFiles(context.Background(), "default", "my-pvc", "/", func(FileInfo) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected the callback's error to stop the listing, got %v after %d entries", err, calls)
+	}
+}
+
+func TestStreamFilesWithoutFindPrintf(t *testing.T) {
+	mock := &mockPodExecutor{}
+	exitErr := fmt.Errorf("command terminated with exit code 1")
+	mock.pushStream("", "find: unrecognized: -printf", exitErr)
+	mock.pushExec("", "find: unrecognized: -printf", exitErr)
+	mock.pushExec("regular file|-rw-r--r--|10|1705314600|0|0\n\x00./a.txt\x00\x00", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var names []string
+	err := c.StreamFiles(context.Background(), "default", "my-pvc", "/", func(f FileInfo) error {
+		names = append(names, f.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "a.txt" {
+		t.Errorf("expected the directory to be listed instead, got %q", names)
+	}
+}
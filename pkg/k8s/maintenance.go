@@ -0,0 +1,391 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maintenanceAnnotation records, on each workload scaled down for a
+// maintenance session and on the session's helper pod, which claim the
+// session is for, when it ends and, on workloads, the replica count to
+// restore. The cluster is the only record of a session, so one outlives a
+// restart of KubeBrowser.
+const maintenanceAnnotation = "kube-browser/maintenance"
+
+// maintenanceApp labels the helper pod of a maintenance session. Unlike
+// the ordinary helpers, it is left alone by CleanupOrphanedHelperPods
+// until its session is over.
+const maintenanceApp = "kube-browser-maintenance"
+
+// maintenanceGrace keeps the helper pod of a session running a little past
+// its end, so the workloads are back before it exits.
+const maintenanceGrace = 5 * time.Minute
+
+// MaintenanceWorkload is a workload scaled to zero for a session.
+type MaintenanceWorkload struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Replicas int32  `json:"replicas"`
+}
+
+// Maintenance is a maintenance session: the workloads using a claim are
+// scaled to zero and a helper pod has the volume to itself until the
+// session ends, when their replica counts are restored.
+type Maintenance struct {
+	Namespace string                `json:"namespace"`
+	PVC       string                `json:"pvc"`
+	Until     time.Time             `json:"until"`
+	Workloads []MaintenanceWorkload `json:"workloads"`
+	HelperPod string                `json:"helperPod,omitempty"`
+}
+
+// maintenanceRecord is the value of maintenanceAnnotation.
+type maintenanceRecord struct {
+	PVC      string    `json:"pvc"`
+	Until    time.Time `json:"until"`
+	Replicas int32     `json:"replicas,omitempty"`
+}
+
+// maintenanceDrainTimeout reads KUBE_BROWSER_MAINTENANCE_DRAIN_TIMEOUT_SEC:
+// how long StartMaintenance waits for the workloads' pods to go away.
+func maintenanceDrainTimeout() time.Duration {
+	if v := os.Getenv("KUBE_BROWSER_MAINTENANCE_DRAIN_TIMEOUT_SEC"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return time.Duration(parsed) * time.Second
+		}
+		log.Printf("Warning: invalid KUBE_BROWSER_MAINTENANCE_DRAIN_TIMEOUT_SEC %q, using 120", v)
+	}
+	return 120 * time.Second
+}
+
+// StartMaintenance gives a helper pod exclusive access to pvcName for d:
+// the Deployments and StatefulSets whose pods mount the claim are scaled
+// to zero, their pods are waited out, and a helper pod is started on the
+// node they ran on. Any other kind of workload, a bare pod or a DaemonSet,
+// cannot be scaled down and makes it fail before anything changes. If a
+// later step fails, the workloads are scaled back up.
+//
+// Starting again for a claim already in maintenance keeps the replica
+// counts recorded the first time, so a retried start cannot restore zero.
+func (c *Client) StartMaintenance(ctx context.Context, namespace, pvcName string, d time.Duration) (*Maintenance, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	if c.helperDisabled {
+		return nil, &K8sError{Kind: ErrKindHelperDisabled, Message: "Maintenance mode needs a helper pod, and helper pods are disabled (minimal mode)."}
+	}
+	if !c.allows(namespace, StrategyHelper) {
+		return nil, &K8sError{Kind: ErrKindHelperDisabled, Message: fmt.Sprintf("Maintenance mode needs a helper pod, and helper pods are not allowed in namespace %s (%s).", namespace, accessStrategiesEnv)}
+	}
+	if d <= 0 {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: "A maintenance session needs a duration."}
+	}
+
+	users, err := c.claimWorkloads(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.maintenanceFor(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 && existing == nil {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("No workload is using %s; it can be browsed without maintenance mode.", pvcName)}
+	}
+	var node string
+	for _, u := range users {
+		if u.kind != "Deployment" && u.kind != "StatefulSet" {
+			return nil, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s %s uses %s and cannot be scaled down; only Deployments and StatefulSets can.", u.kind, u.name, pvcName)}
+		}
+		if node == "" {
+			node = u.node
+		}
+	}
+
+	until := time.Now().Add(d).UTC().Truncate(time.Second)
+	var prior, scaled []MaintenanceWorkload
+	if existing != nil {
+		prior = existing.Workloads
+		if existing.HelperPod != "" {
+			c.scheduleHelperDeletion(namespace, existing.HelperPod)
+		}
+	}
+	recorded := map[string]bool{}
+	for _, w := range prior {
+		recorded[w.Kind+"/"+w.Name] = true
+	}
+	for _, u := range users {
+		if recorded[u.kind+"/"+u.name] {
+			continue
+		}
+		replicas, err := c.workloadReplicas(ctx, namespace, u.kind, u.name)
+		if err != nil {
+			c.restoreWorkloads(namespace, scaled)
+			return nil, err
+		}
+		w := MaintenanceWorkload{Kind: u.kind, Name: u.name, Replicas: replicas}
+		if err := c.scaleForMaintenance(ctx, namespace, w, &maintenanceRecord{PVC: pvcName, Until: until, Replicas: replicas}, 0); err != nil {
+			c.restoreWorkloads(namespace, scaled)
+			return nil, err
+		}
+		log.Printf("Maintenance of %s/%s: scaled %s %s from %d to 0", namespace, pvcName, u.kind, u.name, replicas)
+		scaled = append(scaled, w)
+	}
+	// Workloads scaled down by an earlier start get the new end time.
+	for _, w := range prior {
+		if err := c.scaleForMaintenance(ctx, namespace, w, &maintenanceRecord{PVC: pvcName, Until: until, Replicas: w.Replicas}, 0); err != nil {
+			c.restoreWorkloads(namespace, scaled)
+			return nil, err
+		}
+	}
+	m := &Maintenance{Namespace: namespace, PVC: pvcName, Until: until, Workloads: append(prior, scaled...)}
+
+	if err := c.waitForClaimRelease(ctx, namespace, pvcName); err != nil {
+		c.restoreWorkloads(namespace, m.Workloads)
+		return nil, err
+	}
+
+	record, _ := json.Marshal(maintenanceRecord{PVC: pvcName, Until: until})
+	helper, err := c.createHelperPodWith(ctx, namespace, pvcName, "pvc-data", node, helperPodOptions{
+		app:         maintenanceApp,
+		lifetime:    time.Until(until) + maintenanceGrace,
+		annotations: map[string]string{maintenanceAnnotation: string(record)},
+	})
+	if err != nil {
+		c.restoreWorkloads(namespace, m.Workloads)
+		return nil, err
+	}
+	m.HelperPod = helper
+	return m, nil
+}
+
+// EndMaintenance ends the session for pvcName: the helper pod is deleted
+// and the workloads get their replica counts back.
+func (c *Client) EndMaintenance(ctx context.Context, namespace, pvcName string) (*Maintenance, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	m, err := c.maintenanceFor(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, &K8sError{Kind: ErrKindPathNotFound, Message: fmt.Sprintf("%s is not in maintenance.", pvcName)}
+	}
+	if m.HelperPod != "" {
+		// The deletion is retried in the background; the workloads'
+		// pods wait for the volume meanwhile.
+		c.scheduleHelperDeletion(namespace, m.HelperPod)
+	}
+	var failed []string
+	for _, w := range m.Workloads {
+		if err := c.scaleForMaintenance(ctx, namespace, w, nil, w.Replicas); err != nil {
+			failed = append(failed, fmt.Sprintf("%s %s: %v", w.Kind, w.Name, err))
+			continue
+		}
+		log.Printf("Maintenance of %s/%s over: scaled %s %s back to %d", namespace, pvcName, w.Kind, w.Name, w.Replicas)
+	}
+	if len(failed) > 0 {
+		return m, &K8sError{Kind: ErrKindUnknown, Message: "Could not restore " + strings.Join(failed, "; ")}
+	}
+	return m, nil
+}
+
+// ListMaintenance returns the maintenance sessions in namespace, read
+// from the workloads' annotations.
+func (c *Client) ListMaintenance(ctx context.Context, namespace string) ([]Maintenance, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	sessions := map[string]*Maintenance{}
+	add := func(kind, name string, annotations map[string]string) {
+		var rec maintenanceRecord
+		v, ok := annotations[maintenanceAnnotation]
+		if !ok || json.Unmarshal([]byte(v), &rec) != nil || rec.PVC == "" {
+			return
+		}
+		m := sessions[rec.PVC]
+		if m == nil {
+			m = &Maintenance{Namespace: namespace, PVC: rec.PVC, Until: rec.Until}
+			sessions[rec.PVC] = m
+		}
+		if rec.Until.After(m.Until) {
+			m.Until = rec.Until
+		}
+		m.Workloads = append(m.Workloads, MaintenanceWorkload{Kind: kind, Name: name, Replicas: rec.Replicas})
+	}
+
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	for _, d := range deployments.Items {
+		add("Deployment", d.Name, d.Annotations)
+	}
+	statefulSets, err := c.clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	for _, s := range statefulSets.Items {
+		add("StatefulSet", s.Name, s.Annotations)
+	}
+
+	if len(sessions) > 0 {
+		pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + maintenanceApp})
+		if err != nil {
+			return nil, classifyApiError(err)
+		}
+		for _, p := range pods.Items {
+			var rec maintenanceRecord
+			if json.Unmarshal([]byte(p.Annotations[maintenanceAnnotation]), &rec) != nil || p.DeletionTimestamp != nil {
+				continue
+			}
+			if m := sessions[rec.PVC]; m != nil && p.Status.Phase != corev1.PodSucceeded && p.Status.Phase != corev1.PodFailed {
+				m.HelperPod = p.Name
+			}
+		}
+	}
+
+	out := make([]Maintenance, 0, len(sessions))
+	for _, m := range sessions {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PVC < out[j].PVC })
+	return out, nil
+}
+
+func (c *Client) maintenanceFor(ctx context.Context, namespace, pvcName string) (*Maintenance, error) {
+	sessions, err := c.ListMaintenance(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if sessions[i].PVC == pvcName {
+			return &sessions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Client) workloadReplicas(ctx context.Context, namespace, kind, name string) (int32, error) {
+	var replicas *int32
+	switch kind {
+	case "Deployment":
+		d, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return 0, classifyApiError(err)
+		}
+		replicas = d.Spec.Replicas
+	case "StatefulSet":
+		s, err := c.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return 0, classifyApiError(err)
+		}
+		replicas = s.Spec.Replicas
+	}
+	if replicas == nil {
+		return 1, nil
+	}
+	return *replicas, nil
+}
+
+// scaleForMaintenance sets a workload's replica count and, with rec, its
+// maintenance annotation, or removes the annotation when rec is nil.
+func (c *Client) scaleForMaintenance(ctx context.Context, namespace string, w MaintenanceWorkload, rec *maintenanceRecord, replicas int32) error {
+	var annotation interface{}
+	if rec != nil {
+		v, _ := json.Marshal(rec)
+		annotation = string(v)
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{maintenanceAnnotation: annotation}},
+		"spec":     map[string]interface{}{"replicas": replicas},
+	})
+	var err error
+	switch w.Kind {
+	case "Deployment":
+		_, err = c.clientset.AppsV1().Deployments(namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = c.clientset.AppsV1().StatefulSets(namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	default:
+		return fmt.Errorf("cannot scale %s %s", w.Kind, w.Name)
+	}
+	if apierrors.IsForbidden(err) {
+		return &K8sError{
+			Kind:    ErrKindRBAC,
+			Message: fmt.Sprintf("Permission denied: your kubeconfig cannot patch %ss. Add 'patch' on %ss to use maintenance mode.", strings.ToLower(w.Kind), strings.ToLower(w.Kind)),
+			Cause:   err,
+		}
+	}
+	if err != nil {
+		return classifyApiError(err)
+	}
+	return nil
+}
+
+// restoreWorkloads scales workloads back after a failed start. It runs on
+// its own context, since the start's may be what failed.
+func (c *Client) restoreWorkloads(namespace string, workloads []MaintenanceWorkload) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, w := range workloads {
+		if err := c.scaleForMaintenance(ctx, namespace, w, nil, w.Replicas); err != nil {
+			log.Printf("Warning: could not scale %s %s back to %d: %v", w.Kind, w.Name, w.Replicas, err)
+		}
+	}
+}
+
+// waitForClaimRelease waits until no pod but KubeBrowser's mounts the
+// claim.
+func (c *Client) waitForClaimRelease(ctx context.Context, namespace, pvcName string) error {
+	timeout := maintenanceDrainTimeout()
+	deadline := time.Now().Add(timeout)
+	for {
+		pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return classifyApiError(err)
+		}
+		var holding []string
+		for _, p := range pods.Items {
+			if p.Labels["managed-by"] == "kube-browser" || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			if podUsesClaim(p.Spec, pvcName) {
+				holding = append(holding, p.Name)
+			}
+		}
+		if len(holding) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &K8sError{Kind: ErrKindTimeout, Message: fmt.Sprintf("Pods still using %s after %s (KUBE_BROWSER_MAINTENANCE_DRAIN_TIMEOUT_SEC): %s.", pvcName, timeout, strings.Join(holding, ", "))}
+		}
+		select {
+		case <-ctx.Done():
+			return classifyApiError(ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// maintenanceHelperActive reports whether pod is the helper of a
+// maintenance session that has not ended yet.
+func maintenanceHelperActive(pod *corev1.Pod, now time.Time) bool {
+	if pod.Labels["app"] != maintenanceApp {
+		return false
+	}
+	var rec maintenanceRecord
+	return json.Unmarshal([]byte(pod.Annotations[maintenanceAnnotation]), &rec) == nil && rec.Until.After(now)
+}
@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// maintenanceCluster is a Deployment with two replicas whose pod mounts
+// my-pvc. Scaling it down deletes the pod; helper pods read back running.
+func maintenanceCluster(t *testing.T) *fake.Clientset {
+	t.Setenv("HELPER_STARTUP_TIMEOUT_SEC", "5")
+	objs := migrationFixtures()
+	two := int32(2)
+	for _, o := range objs {
+		if d, ok := o.(*appsv1.Deployment); ok {
+			d.Spec.Replicas = &two
+		}
+	}
+	cs := fake.NewSimpleClientset(objs...)
+	cs.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if strings.Contains(string(action.(k8stesting.PatchAction).GetPatch()), `"replicas":0`) {
+			cs.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), "default", "app-pod")
+		}
+		return false, nil, nil
+	})
+	cs.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		if !strings.HasPrefix(name, maintenanceApp) {
+			return false, nil, nil
+		}
+		return true, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}, nil
+	})
+	return cs
+}
+
+func TestMaintenanceScalesDownAndRestores(t *testing.T) {
+	cs := maintenanceCluster(t)
+	c := &Client{clientset: cs}
+	ctx := context.Background()
+
+	m, err := c.StartMaintenance(ctx, "default", "my-pvc", 30*time.Minute)
+	if err != nil {
+		t.Fatalf("StartMaintenance: %v", err)
+	}
+	if !strings.HasPrefix(m.HelperPod, maintenanceApp+"-my-pvc-") {
+		t.Errorf("HelperPod = %q", m.HelperPod)
+	}
+	if len(m.Workloads) != 1 || m.Workloads[0] != (MaintenanceWorkload{Kind: "Deployment", Name: "web", Replicas: 2}) {
+		t.Fatalf("Workloads = %+v", m.Workloads)
+	}
+	d, _ := cs.AppsV1().Deployments("default").Get(ctx, "web", metav1.GetOptions{})
+	if *d.Spec.Replicas != 0 || d.Annotations[maintenanceAnnotation] == "" {
+		t.Fatalf("deployment not scaled down: replicas %d, annotations %v", *d.Spec.Replicas, d.Annotations)
+	}
+	helper, err := cs.CoreV1().Pods("default").List(ctx, metav1.ListOptions{LabelSelector: "app=" + maintenanceApp})
+	if err != nil || len(helper.Items) != 1 {
+		t.Fatalf("helper pods = %v, %v", helper, err)
+	}
+	if pod := helper.Items[0]; pod.Spec.NodeName != "node-1" || !maintenanceHelperActive(&pod, time.Now()) {
+		t.Errorf("helper pod on %q, active %v", pod.Spec.NodeName, maintenanceHelperActive(&pod, time.Now()))
+	}
+
+	// A retried start keeps the replica count recorded the first time.
+	again, err := c.StartMaintenance(ctx, "default", "my-pvc", time.Hour)
+	if err != nil {
+		t.Fatalf("second StartMaintenance: %v", err)
+	}
+	if len(again.Workloads) != 1 || again.Workloads[0].Replicas != 2 {
+		t.Fatalf("Workloads after retry = %+v", again.Workloads)
+	}
+
+	sessions, err := c.ListMaintenance(ctx, "default")
+	if err != nil || len(sessions) != 1 || sessions[0].PVC != "my-pvc" || !sessions[0].Until.Equal(again.Until) {
+		t.Fatalf("ListMaintenance = %+v, %v", sessions, err)
+	}
+
+	if _, err := c.EndMaintenance(ctx, "default", "my-pvc"); err != nil {
+		t.Fatalf("EndMaintenance: %v", err)
+	}
+	d, _ = cs.AppsV1().Deployments("default").Get(ctx, "web", metav1.GetOptions{})
+	if *d.Spec.Replicas != 2 {
+		t.Errorf("replicas after end = %d, want 2", *d.Spec.Replicas)
+	}
+	if _, ok := d.Annotations[maintenanceAnnotation]; ok {
+		t.Errorf("maintenance annotation left on deployment: %v", d.Annotations)
+	}
+	if sessions, _ := c.ListMaintenance(ctx, "default"); len(sessions) != 0 {
+		t.Errorf("sessions after end = %+v", sessions)
+	}
+	if _, err := c.EndMaintenance(ctx, "default", "my-pvc"); err == nil {
+		t.Error("ending a session twice should fail")
+	}
+}
+
+func TestMaintenanceRefusesBarePods(t *testing.T) {
+	cs := fake.NewSimpleClientset(runningPodWithPVC("my-pvc"))
+	c := &Client{clientset: cs}
+	_, err := c.StartMaintenance(context.Background(), "default", "my-pvc", time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "cannot be scaled down") {
+		t.Fatalf("err = %v, want a refusal", err)
+	}
+	if pods, _ := cs.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{}); len(pods.Items) != 1 {
+		t.Errorf("pods = %d, want the workload's only", len(pods.Items))
+	}
+}
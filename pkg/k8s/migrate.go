@@ -0,0 +1,484 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// migratedFromLabel marks a PVC created by a storage-class migration with
+// the name of the claim it was copied from, so a resumed migration can
+// reuse it instead of failing on "already exists".
+const migratedFromLabel = "kube-browser/migrated-from"
+
+// MigrationRequest describes a storage-class migration of one claim.
+// Target defaults to "<pvc>-<storageClass>" and Size to the source
+// capacity.
+type MigrationRequest struct {
+	Namespace    string `json:"namespace"`
+	PVC          string `json:"pvc"`
+	StorageClass string `json:"storageClass"`
+	Target       string `json:"target,omitempty"`
+	Size         string `json:"size,omitempty"`
+}
+
+// WorkloadPatch is the change needed for one workload to use the new
+// claim. Command is empty when the workload cannot be patched in place.
+type WorkloadPatch struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Command string `json:"command,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+// MigrationReport is the outcome of a successful migration.
+type MigrationReport struct {
+	Source       string          `json:"source"`
+	Target       string          `json:"target"`
+	StorageClass string          `json:"storageClass"`
+	Size         string          `json:"size"`
+	Files        int             `json:"files"`
+	Workloads    []WorkloadPatch `json:"workloads"`
+}
+
+// MigrationStage is reported while MigratePVC runs.
+type MigrationStage string
+
+const (
+	MigrationCreatingClaim MigrationStage = "creating-claim"
+	MigrationCopying       MigrationStage = "copying"
+	MigrationReporting     MigrationStage = "reporting"
+)
+
+// migrationScript copies /src into /dst and checks every file against a
+// checksum manifest of the source. The last line of output is
+// "verified <n> files".
+const migrationScript = `set -e
+cd /src
+tar cf - . | tar xf - -C /dst
+find . -type f -exec sha256sum {} + | sort > /tmp/src.sha256
+cd /dst
+if ! sha256sum -c /tmp/src.sha256 > /tmp/check.log 2>&1; then
+  grep -v ': OK$' /tmp/check.log | head -n 20
+  echo "checksum verification failed" >&2
+  exit 1
+fi
+echo "verified $(wc -l < /tmp/src.sha256) files"`
+
+// StorageClasses lists the cluster's storage class names.
+func (c *Client) StorageClasses(ctx context.Context) ([]string, error) {
+	list, err := c.clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, sc := range list.Items {
+		names = append(names, sc.Name)
+	}
+	return names, nil
+}
+
+// MigratePVC creates a claim on another storage class, copies the source
+// claim into it with an in-cluster Job, verifies the copy by checksum and
+// reports how to point the workloads at the new claim. The source claim is
+// never modified. Workloads should be scaled down first: writes made
+// during the copy are not carried over.
+func (c *Client) MigratePVC(ctx context.Context, req MigrationRequest, stage func(MigrationStage)) (*MigrationReport, error) {
+	if c.helperDisabled {
+		return nil, &K8sError{Kind: ErrKindHelperDisabled, Message: "Storage-class migration runs a Job and is not available when helper pods are disabled (minimal mode)."}
+	}
+	if !c.allows(req.Namespace, StrategyJob) {
+		return nil, &K8sError{Kind: ErrKindHelperDisabled, Message: fmt.Sprintf("Storage-class migration runs a Job, and Jobs are not allowed in namespace %s (%s).", req.Namespace, accessStrategiesEnv)}
+	}
+	if err := c.inScope(req.Namespace); err != nil {
+		return nil, err
+	}
+	if stage == nil {
+		stage = func(MigrationStage) {}
+	}
+	pvcs := c.clientset.CoreV1().PersistentVolumeClaims(req.Namespace)
+
+	src, err := pvcs.Get(ctx, req.PVC, metav1.GetOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	if owner := ephemeralOwner(src); owner != "" {
+		return nil, fmt.Errorf("%s is the ephemeral volume of pod %s and is deleted with it; change the volumeClaimTemplate of the pod instead", req.PVC, owner)
+	}
+	if src.Spec.StorageClassName != nil && *src.Spec.StorageClassName == req.StorageClass {
+		return nil, fmt.Errorf("%s already uses storage class %s", req.PVC, req.StorageClass)
+	}
+	if _, err := c.clientset.StorageV1().StorageClasses().Get(ctx, req.StorageClass, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("storage class %s does not exist", req.StorageClass)
+		}
+		return nil, classifyApiError(err)
+	}
+	if req.Target == "" {
+		req.Target = req.PVC + "-" + req.StorageClass
+	}
+
+	size, err := migrationSize(src, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	stage(MigrationCreatingClaim)
+	if err := c.createMigrationTarget(ctx, src, req, size); err != nil {
+		return nil, err
+	}
+
+	stage(MigrationCopying)
+	var nodeName string
+	if info, err := c.findPodForPVC(ctx, req.Namespace, req.PVC); err == nil {
+		// A ReadWriteOnce claim in use can only be mounted on its node.
+		nodeName = info.nodeName
+	}
+	files, err := c.runMigrationJob(ctx, req, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	stage(MigrationReporting)
+	workloads, err := c.workloadPatches(ctx, req.Namespace, req.PVC, req.Target)
+	if err != nil {
+		return nil, err
+	}
+	return &MigrationReport{
+		Source:       req.Namespace + "/" + req.PVC,
+		Target:       req.Namespace + "/" + req.Target,
+		StorageClass: req.StorageClass,
+		Size:         size.String(),
+		Files:        files,
+		Workloads:    workloads,
+	}, nil
+}
+
+// migrationSize is the requested size, or the source capacity (falling
+// back to its request). A smaller size than the source is rejected.
+func migrationSize(src *corev1.PersistentVolumeClaim, requested string) (resource.Quantity, error) {
+	current, ok := src.Status.Capacity[corev1.ResourceStorage]
+	if !ok {
+		current = src.Spec.Resources.Requests[corev1.ResourceStorage]
+	}
+	if requested == "" {
+		if current.IsZero() {
+			return current, fmt.Errorf("cannot determine the size of %s; pass a size", src.Name)
+		}
+		return current, nil
+	}
+	q, err := resource.ParseQuantity(requested)
+	if err != nil {
+		return q, fmt.Errorf("invalid size %q: %v", requested, err)
+	}
+	if q.Cmp(current) < 0 {
+		return q, fmt.Errorf("size %s is smaller than the current capacity %s", q.String(), current.String())
+	}
+	return q, nil
+}
+
+func (c *Client) createMigrationTarget(ctx context.Context, src *corev1.PersistentVolumeClaim, req MigrationRequest, size resource.Quantity) error {
+	pvcs := c.clientset.CoreV1().PersistentVolumeClaims(req.Namespace)
+	if existing, err := pvcs.Get(ctx, req.Target, metav1.GetOptions{}); err == nil {
+		if existing.Labels[migratedFromLabel] != req.PVC {
+			return fmt.Errorf("PVC %s already exists and was not created by a migration of %s", req.Target, req.PVC)
+		}
+		log.Printf("Reusing migration target %s/%s", req.Namespace, req.Target)
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return classifyApiError(err)
+	}
+
+	storageClass := req.StorageClass
+	target := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      req.Target,
+			Namespace: req.Namespace,
+			Labels: map[string]string{
+				"managed-by":      "kube-browser",
+				migratedFromLabel: req.PVC,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      src.Spec.AccessModes,
+			StorageClassName: &storageClass,
+			VolumeMode:       src.Spec.VolumeMode,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+	log.Printf("Creating migration target %s/%s (%s, %s)", req.Namespace, req.Target, storageClass, size.String())
+	if _, err := pvcs.Create(ctx, target, metav1.CreateOptions{}); err != nil {
+		if apierrors.IsForbidden(err) {
+			return &K8sError{Kind: ErrKindRBAC, Message: "Permission denied: your kubeconfig cannot create persistentvolumeclaims.", Cause: err}
+		}
+		return classifyApiError(err)
+	}
+	c.noteClaimCreated(req.Namespace, req.Target)
+	return nil
+}
+
+// migrationJobTimeout bounds how long MigratePVC waits for the copy Job,
+// from KUBE_BROWSER_MIGRATION_TIMEOUT_SEC (default 6 hours).
+func migrationJobTimeout() time.Duration {
+	if v := os.Getenv("KUBE_BROWSER_MIGRATION_TIMEOUT_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 6 * time.Hour
+}
+
+// migrationPollInterval is a variable so tests do not wait.
+var migrationPollInterval = 5 * time.Second
+
+// runMigrationJob runs the copy-and-verify Job and returns the number of
+// files verified. The Job is deleted when it finishes or ctx ends.
+func (c *Client) runMigrationJob(ctx context.Context, req MigrationRequest, nodeName string) (int, error) {
+	name := fmt.Sprintf("kube-browser-migrate-%s-%s", req.PVC, strconv.FormatInt(time.Now().UnixNano(), 16))
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	name = strings.TrimRight(name, "-.")
+	image := c.helperImage()
+	backoff := int32(0)
+	ttl := int32(3600)
+	deadline := int64(migrationJobTimeout().Seconds())
+
+	podSpec := corev1.PodSpec{
+		NodeName:      nodeName,
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers: []corev1.Container{{
+			Name:            "migrate",
+			Image:           image,
+			Command:         []string{"sh", "-c", migrationScript},
+			Resources:       helperResourceRequirements(),
+			SecurityContext: helperSecurityContext(),
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "src", MountPath: "/src", ReadOnly: true},
+				{Name: "dst", MountPath: "/dst"},
+				{Name: "scratch", MountPath: "/tmp"},
+			},
+		}},
+		Volumes: []corev1.Volume{
+			{Name: "src", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: req.PVC, ReadOnly: true}}},
+			{Name: "dst", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: req.Target}}},
+			{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+	}
+	c.applyHelperScheduling(&podSpec)
+	if err := c.fitHelperToNamespace(ctx, req.Namespace, &podSpec); err != nil {
+		return 0, err
+	}
+
+	labels := helperLabels("kube-browser-migrate")
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   req.Namespace,
+			Labels:      labels,
+			Annotations: parseKeyValuePairs(os.Getenv("KUBE_BROWSER_EXTRA_ANNOTATIONS")),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoff,
+			TTLSecondsAfterFinished: &ttl,
+			ActiveDeadlineSeconds:   &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+
+	jobs := c.clientset.BatchV1().Jobs(req.Namespace)
+	log.Printf("Starting migration job %s/%s: %s -> %s", req.Namespace, name, req.PVC, req.Target)
+	if _, err := jobs.Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		if apierrors.IsForbidden(err) {
+			return 0, &K8sError{Kind: ErrKindRBAC, Message: "Permission denied: your kubeconfig cannot create jobs in the batch API group.", Cause: err}
+		}
+		return 0, classifyApiError(err)
+	}
+	defer func() {
+		dctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		policy := metav1.DeletePropagationBackground
+		if err := jobs.Delete(dctx, name, metav1.DeleteOptions{PropagationPolicy: &policy}); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Failed to delete migration job %s/%s (it expires after %ds): %v", req.Namespace, name, ttl, err)
+		}
+	}()
+
+	ticker := time.NewTicker(migrationPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+		j, err := jobs.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("Error polling migration job %s: %v", name, err)
+			continue
+		}
+		if j.Status.Succeeded > 0 {
+			return parseVerifiedFiles(c.jobLogs(ctx, req.Namespace, name))
+		}
+		if j.Status.Failed > 0 {
+			msg := strings.TrimSpace(c.jobLogs(ctx, req.Namespace, name))
+			if msg == "" {
+				msg = "see kubectl describe job " + name
+			}
+			return 0, fmt.Errorf("migration job %s failed: %s", name, msg)
+		}
+	}
+}
+
+// jobLogs returns the logs of the Job's pod, or "" if they are not
+// available.
+func (c *Client) jobLogs(ctx context.Context, namespace, jobName string) string {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	if err != nil || len(pods.Items) == 0 {
+		return ""
+	}
+	tail := int64(40)
+	raw, err := c.clientset.CoreV1().Pods(namespace).GetLogs(pods.Items[0].Name, &corev1.PodLogOptions{TailLines: &tail}).DoRaw(ctx)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+func parseVerifiedFiles(logs string) (int, error) {
+	lines := strings.Split(strings.TrimSpace(logs), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	var n int
+	if _, err := fmt.Sscanf(last, "verified %d files", &n); err != nil {
+		// The Job succeeded, which already means every checksum matched.
+		log.Printf("Could not read the verified file count from migration logs: %q", last)
+		return 0, nil
+	}
+	return n, nil
+}
+
+// workloadPatches finds the workloads whose pods mount pvcName and renders
+// the kubectl command that switches each one to target.
+func (c *Client) workloadPatches(ctx context.Context, namespace, pvcName, target string) ([]WorkloadPatch, error) {
+	users, err := c.claimWorkloads(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	patches := []WorkloadPatch{}
+	for _, u := range users {
+		patches = append(patches, c.workloadPatch(ctx, namespace, u.kind, u.name, pvcName, target))
+	}
+	return patches, nil
+}
+
+// claimWorkload is a workload whose pods mount a claim: the controller of
+// those pods, or a bare pod.
+type claimWorkload struct {
+	kind, name string
+	// node is where one of its pods is scheduled, if any is.
+	node string
+}
+
+// claimWorkloads finds the workloads whose pods mount pvcName, resolving
+// ReplicaSets to their Deployment. Pods KubeBrowser created are left out.
+func (c *Client) claimWorkloads(ctx context.Context, namespace, pvcName string) ([]claimWorkload, error) {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	index := map[string]int{}
+	var users []claimWorkload
+	for _, pod := range pods.Items {
+		if !podUsesClaim(pod.Spec, pvcName) || pod.Labels["managed-by"] == "kube-browser" {
+			continue
+		}
+		kind, name := "Pod", pod.Name
+		if owner := metav1.GetControllerOf(&pod); owner != nil {
+			kind, name = owner.Kind, owner.Name
+			if kind == "ReplicaSet" {
+				if rs, err := c.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+					if d := metav1.GetControllerOf(rs); d != nil && d.Kind == "Deployment" {
+						kind, name = d.Kind, d.Name
+					}
+				}
+			}
+		}
+		key := kind + "/" + name
+		if i, ok := index[key]; ok {
+			if users[i].node == "" {
+				users[i].node = pod.Spec.NodeName
+			}
+			continue
+		}
+		index[key] = len(users)
+		users = append(users, claimWorkload{kind: kind, name: name, node: pod.Spec.NodeName})
+	}
+	return users, nil
+}
+
+func podUsesClaim(spec corev1.PodSpec, pvcName string) bool {
+	return claimVolumeIndex(spec, pvcName) >= 0
+}
+
+func claimVolumeIndex(spec corev1.PodSpec, pvcName string) int {
+	for i, v := range spec.Volumes {
+		if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == pvcName {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Client) workloadPatch(ctx context.Context, namespace, kind, name, pvcName, target string) WorkloadPatch {
+	wp := WorkloadPatch{Kind: kind, Name: name}
+	var template *corev1.PodSpec
+	var kindArg string
+	switch kind {
+	case "Deployment":
+		if d, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template, kindArg = &d.Spec.Template.Spec, "deployment"
+		}
+	case "StatefulSet":
+		if s, err := c.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template, kindArg = &s.Spec.Template.Spec, "statefulset"
+		}
+	case "DaemonSet":
+		if d, err := c.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template, kindArg = &d.Spec.Template.Spec, "daemonset"
+		}
+	case "Pod":
+		wp.Note = "Bare pod: recreate it with spec.volumes[].persistentVolumeClaim.claimName set to " + target + "."
+		return wp
+	default:
+		wp.Note = fmt.Sprintf("Update the %s's pod template to use claim %s.", kind, target)
+		return wp
+	}
+	if template == nil {
+		wp.Note = fmt.Sprintf("Could not read %s %s; update its pod template to use claim %s.", kind, name, target)
+		return wp
+	}
+	i := claimVolumeIndex(*template, pvcName)
+	if i < 0 {
+		// StatefulSet claims come from volumeClaimTemplates, which are
+		// immutable.
+		wp.Note = fmt.Sprintf("%s comes from a volumeClaimTemplate, which cannot be patched; recreate the %s or rename the claims.", pvcName, kind)
+		return wp
+	}
+	patch := fmt.Sprintf(`[{"op":"replace","path":"/spec/template/spec/volumes/%d/persistentVolumeClaim/claimName","value":%q}]`, i, target)
+	wp.Command = shellJoin(concatArgs(c.kubectlBase(), "-n", namespace, "patch", kindArg, name, "--type=json", "-p", patch))
+	return wp
+}
@@ -0,0 +1,169 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func migrationFixtures() []runtime.Object {
+	old := "standard"
+	src := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pvc", Namespace: "default"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &old,
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+		},
+	}
+	isController := true
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{Name: "config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				{Name: "data-vol", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "my-pvc"}}},
+			},
+		}}},
+	}
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "web-5d4f", Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &isController}},
+	}}
+	pod := runningPodWithPVC("my-pvc")
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d4f", Controller: &isController}}
+	return []runtime.Object{
+		src, deploy, rs, pod,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}},
+	}
+}
+
+// finishJobs makes every Job read back with the given outcome.
+func finishJobs(cs *fake.Clientset, succeeded bool) {
+	cs.PrependReactor("get", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: action.(k8stesting.GetAction).GetName()}}
+		if succeeded {
+			job.Status.Succeeded = 1
+		} else {
+			job.Status.Failed = 1
+		}
+		return true, job, nil
+	})
+}
+
+func TestMigratePVC(t *testing.T) {
+	defer func(d time.Duration) { migrationPollInterval = d }(migrationPollInterval)
+	migrationPollInterval = time.Millisecond
+
+	cs := fake.NewSimpleClientset(migrationFixtures()...)
+	finishJobs(cs, true)
+	c := &Client{clientset: cs, ContextName: "prod"}
+
+	var stages []string
+	report, err := c.MigratePVC(context.Background(), MigrationRequest{Namespace: "default", PVC: "my-pvc", StorageClass: "fast"},
+		func(s MigrationStage) { stages = append(stages, string(s)) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(stages, ","); got != "creating-claim,copying,reporting" {
+		t.Errorf("unexpected stages: %s", got)
+	}
+	if report.Target != "default/my-pvc-fast" || report.Size != "5Gi" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	target, err := cs.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "my-pvc-fast", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("target claim not created: %v", err)
+	}
+	if *target.Spec.StorageClassName != "fast" || target.Labels[migratedFromLabel] != "my-pvc" ||
+		target.Spec.AccessModes[0] != corev1.ReadWriteOnce {
+		t.Errorf("unexpected target claim: %+v", target)
+	}
+
+	var created *batchv1.Job
+	deleted := false
+	for _, a := range cs.Actions() {
+		if a.GetResource().Resource != "jobs" {
+			continue
+		}
+		switch a.GetVerb() {
+		case "create":
+			created = a.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		case "delete":
+			deleted = true
+		}
+	}
+	if created == nil || !deleted {
+		t.Fatalf("expected the migration job to be created and deleted (created=%v, deleted=%v)", created != nil, deleted)
+	}
+	spec := created.Spec.Template.Spec
+	if spec.NodeName != "node-1" || spec.Volumes[0].PersistentVolumeClaim.ClaimName != "my-pvc" || spec.Volumes[1].PersistentVolumeClaim.ClaimName != "my-pvc-fast" {
+		t.Errorf("unexpected job pod spec: %+v", spec)
+	}
+
+	if len(report.Workloads) != 1 {
+		t.Fatalf("expected one workload, got %+v", report.Workloads)
+	}
+	want := `kubectl --context prod -n default patch deployment web --type=json -p '[{"op":"replace","path":"/spec/template/spec/volumes/1/persistentVolumeClaim/claimName","value":"my-pvc-fast"}]'`
+	if w := report.Workloads[0]; w.Kind != "Deployment" || w.Command != want {
+		t.Errorf("unexpected workload patch: %+v", w)
+	}
+}
+
+func TestMigratePVCJobFailure(t *testing.T) {
+	defer func(d time.Duration) { migrationPollInterval = d }(migrationPollInterval)
+	migrationPollInterval = time.Millisecond
+
+	cs := fake.NewSimpleClientset(migrationFixtures()...)
+	finishJobs(cs, false)
+	c := &Client{clientset: cs}
+
+	_, err := c.MigratePVC(context.Background(), MigrationRequest{Namespace: "default", PVC: "my-pvc", StorageClass: "fast"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected job failure, got %v", err)
+	}
+}
+
+func TestMigratePVCRejectsInvalidRequests(t *testing.T) {
+	cs := fake.NewSimpleClientset(migrationFixtures()...)
+	cs.CoreV1().PersistentVolumeClaims("default").Create(context.Background(), &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "taken", Namespace: "default"},
+	}, metav1.CreateOptions{})
+	c := &Client{clientset: cs}
+
+	tests := []struct {
+		name string
+		req  MigrationRequest
+	}{
+		{"same class", MigrationRequest{StorageClass: "standard"}},
+		{"unknown class", MigrationRequest{StorageClass: "nope"}},
+		{"shrinking", MigrationRequest{StorageClass: "fast", Size: "1Gi"}},
+		{"existing target", MigrationRequest{StorageClass: "fast", Target: "taken"}},
+	}
+	for _, tt := range tests {
+		tt.req.Namespace, tt.req.PVC = "default", "my-pvc"
+		if _, err := c.MigratePVC(context.Background(), tt.req, nil); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+
+	c.DisableHelperPods()
+	if _, err := c.MigratePVC(context.Background(), MigrationRequest{Namespace: "default", PVC: "my-pvc", StorageClass: "fast"}, nil); err == nil {
+		t.Error("expected migration to be refused with helper pods disabled")
+	}
+}
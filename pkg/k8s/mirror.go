@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const defaultHelperImage = "alpine:3.19"
+
+// dockerHub is the registry images without an explicit host are pulled from.
+const dockerHub = "docker.io"
+
+// helperImage is the image used for helper pods and migration Jobs: the
+// HELPER_IMAGE setting, pulled through the connection's registry mirror
+// (or KUBE_BROWSER_REGISTRY_MIRROR when the connection sets none).
+func (c *Client) helperImage() string {
+	mirror := c.registryMirror
+	if mirror == "" {
+		mirror = os.Getenv("KUBE_BROWSER_REGISTRY_MIRROR")
+	}
+	return MirrorImage(getEnvWithDefault("HELPER_IMAGE", defaultHelperImage), mirror)
+}
+
+// SetRegistryMirror makes this connection pull helper images through a
+// mirror. See MirrorImage for the format; "" falls back to
+// KUBE_BROWSER_REGISTRY_MIRROR.
+func (c *Client) SetRegistryMirror(mirror string) error {
+	if err := ValidateRegistryMirror(mirror); err != nil {
+		return err
+	}
+	c.registryMirror = strings.TrimSpace(mirror)
+	return nil
+}
+
+// RegistryMirror returns the mirror set for this connection.
+func (c *Client) RegistryMirror() string {
+	return c.registryMirror
+}
+
+// mirrorRules parses "mirror" or "registry=mirror,registry=mirror". A rule
+// without "registry=" applies to Docker Hub.
+func mirrorRules(mirrors string) map[string]string {
+	rules := make(map[string]string)
+	for _, rule := range strings.Split(mirrors, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		registry, target := dockerHub, rule
+		if i := strings.Index(rule, "="); i >= 0 {
+			registry, target = strings.TrimSpace(rule[:i]), strings.TrimSpace(rule[i+1:])
+		}
+		rules[registry] = strings.TrimSuffix(target, "/")
+	}
+	return rules
+}
+
+// ValidateRegistryMirror checks a mirror setting without applying it.
+func ValidateRegistryMirror(mirrors string) error {
+	for registry, target := range mirrorRules(mirrors) {
+		if registry == "" || target == "" {
+			return fmt.Errorf("invalid registry mirror rule %q=%q", registry, target)
+		}
+		if strings.Contains(target, "://") {
+			return fmt.Errorf("registry mirror %q must not include a scheme", target)
+		}
+		host, path, _ := strings.Cut(target, "/")
+		if host == "" || strings.ContainsAny(target, " @") || strings.Contains(path, ":") {
+			return fmt.Errorf("registry mirror %q must be a host with an optional path, without tag or digest", target)
+		}
+	}
+	return nil
+}
+
+// MirrorImage rewrites an image reference so it is pulled through a
+// mirror. "alpine:3.19" with the mirror "mirror.company.com" becomes
+// "mirror.company.com/library/alpine:3.19"; a mirror with a path
+// ("mirror.company.com/dockerhub") keeps it as a prefix. Images from
+// registries without a rule are returned unchanged.
+func MirrorImage(image, mirrors string) string {
+	rules := mirrorRules(mirrors)
+	if len(rules) == 0 {
+		return image
+	}
+	registry, repo := splitImage(image)
+	target, ok := rules[registry]
+	if !ok {
+		return image
+	}
+	return target + "/" + repo
+}
+
+// splitImage separates the registry host from the rest of an image
+// reference, normalizing Docker Hub shorthand ("alpine" is
+// "docker.io/library/alpine").
+func splitImage(image string) (registry, repo string) {
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry, repo = first, rest
+	} else {
+		registry, repo = dockerHub, image
+	}
+	if registry == "index.docker.io" || registry == "registry-1.docker.io" {
+		registry = dockerHub
+	}
+	if registry == dockerHub && !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return registry, repo
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMirrorImage(t *testing.T) {
+	tests := []struct {
+		image, mirrors, want string
+	}{
+		{"alpine:3.19", "", "alpine:3.19"},
+		{"alpine:3.19", "mirror.company.com", "mirror.company.com/library/alpine:3.19"},
+		{"alpine:3.19", "mirror.company.com/dockerhub/", "mirror.company.com/dockerhub/library/alpine:3.19"},
+		{"docker.io/bitnami/kubectl:1.30", "mirror.company.com", "mirror.company.com/bitnami/kubectl:1.30"},
+		{"busybox@sha256:abc", "mirror:5000", "mirror:5000/library/busybox@sha256:abc"},
+		{"quay.io/prometheus/busybox", "mirror.company.com", "quay.io/prometheus/busybox"},
+		{"quay.io/prometheus/busybox", "mirror.company.com, quay.io=mirror.company.com/quay", "mirror.company.com/quay/prometheus/busybox"},
+		{"localhost/tools:1", "docker.io=mirror.company.com", "localhost/tools:1"},
+	}
+	for _, tt := range tests {
+		if got := MirrorImage(tt.image, tt.mirrors); got != tt.want {
+			t.Errorf("MirrorImage(%q, %q) = %q, want %q", tt.image, tt.mirrors, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRegistryMirror(t *testing.T) {
+	for _, ok := range []string{"", "mirror.company.com", "mirror:5000/hub", "docker.io=a.example, quay.io=b.example/quay"} {
+		if err := ValidateRegistryMirror(ok); err != nil {
+			t.Errorf("ValidateRegistryMirror(%q): unexpected error %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"https://mirror.company.com", "mirror.company.com/alpine:3.19", "=mirror", "quay.io=", "mirror company"} {
+		if err := ValidateRegistryMirror(bad); err == nil {
+			t.Errorf("ValidateRegistryMirror(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestHelperImageUsesConnectionMirror(t *testing.T) {
+	t.Setenv("HELPER_IMAGE", "")
+	t.Setenv("KUBE_BROWSER_REGISTRY_MIRROR", "env-mirror.example")
+
+	c := &Client{}
+	if got := c.helperImage(); got != "env-mirror.example/library/alpine:3.19" {
+		t.Errorf("helperImage() = %q, want the environment mirror", got)
+	}
+	if err := c.SetRegistryMirror("conn-mirror.example"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.helperImage(); got != "conn-mirror.example/library/alpine:3.19" {
+		t.Errorf("helperImage() = %q, want the connection mirror", got)
+	}
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	names, err := ParseImagePullSecrets(" mirror-creds, hub-creds,,mirror-creds ")
+	if err != nil || len(names) != 2 || names[0] != "mirror-creds" || names[1] != "hub-creds" {
+		t.Errorf("ParseImagePullSecrets = %v, %v", names, err)
+	}
+	if _, err := ParseImagePullSecrets("Mirror_Creds"); err == nil {
+		t.Error("expected an invalid secret name to be refused")
+	}
+
+	t.Setenv("KUBE_BROWSER_IMAGE_PULL_SECRET", "env-creds")
+	c := &Client{}
+	var spec corev1.PodSpec
+	c.applyHelperScheduling(&spec)
+	if len(spec.ImagePullSecrets) != 1 || spec.ImagePullSecrets[0].Name != "env-creds" {
+		t.Errorf("expected the environment secret, got %v", spec.ImagePullSecrets)
+	}
+	if err := c.SetImagePullSecrets("mirror-creds,hub-creds"); err != nil {
+		t.Fatal(err)
+	}
+	c.applyHelperScheduling(&spec)
+	if len(spec.ImagePullSecrets) != 2 || spec.ImagePullSecrets[1].Name != "hub-creds" {
+		t.Errorf("expected the connection's secrets, got %v", spec.ImagePullSecrets)
+	}
+}
@@ -3,6 +3,7 @@ package k8s
 import (
 	"context"
 	"errors"
+	"io"
 	"sync"
 )
 
@@ -23,10 +24,22 @@ type mockPodExecutor struct {
 	}
 	execCalls []execCall
 
+	streamResults []struct {
+		stdout string
+		stderr string
+		err    error
+	}
+	streamCalls []execCall
+	streamStdin [][]byte
+
 	createResult string
 	createErr    error
 	createCalled int
 
+	debugResult string
+	debugErr    error
+	debugCalled int
+
 	deleteCalled int
 	deleteArgs   []struct{ ns, pod string }
 }
@@ -43,6 +56,27 @@ func (m *mockPodExecutor) execInPod(_ context.Context, namespace, podName, conta
 	return r.stdout, r.stderr, r.err
 }
 
+func (m *mockPodExecutor) execInPodStream(_ context.Context, namespace, podName, containerName string, cmd []string, stdin io.Reader, stdout io.Writer) (string, error) {
+	var in []byte
+	if stdin != nil {
+		in, _ = io.ReadAll(stdin)
+	}
+	m.mu.Lock()
+	m.streamCalls = append(m.streamCalls, execCall{namespace, podName, containerName, cmd})
+	m.streamStdin = append(m.streamStdin, in)
+	if len(m.streamResults) == 0 {
+		m.mu.Unlock()
+		return "", errors.New("no mock stream result configured")
+	}
+	r := m.streamResults[0]
+	m.streamResults = m.streamResults[1:]
+	m.mu.Unlock()
+	if r.stdout != "" && stdout != nil {
+		io.WriteString(stdout, r.stdout)
+	}
+	return r.stderr, r.err
+}
+
 func (m *mockPodExecutor) createHelperPod(_ context.Context, _, _, _, _ string) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -50,11 +84,19 @@ func (m *mockPodExecutor) createHelperPod(_ context.Context, _, _, _, _ string)
 	return m.createResult, m.createErr
 }
 
-func (m *mockPodExecutor) deleteHelperPod(_ context.Context, ns, pod string) {
+func (m *mockPodExecutor) addDebugContainer(_ context.Context, _, _, _ string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.debugCalled++
+	return m.debugResult, m.debugErr
+}
+
+func (m *mockPodExecutor) deleteHelperPod(_ context.Context, ns, pod string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.deleteCalled++
 	m.deleteArgs = append(m.deleteArgs, struct{ ns, pod string }{ns, pod})
+	return nil
 }
 
 func (m *mockPodExecutor) pushExec(stdout, stderr string, err error) {
@@ -66,3 +108,13 @@ func (m *mockPodExecutor) pushExec(stdout, stderr string, err error) {
 		err    error
 	}{stdout, stderr, err})
 }
+
+func (m *mockPodExecutor) pushStream(stdout, stderr string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streamResults = append(m.streamResults, struct {
+		stdout string
+		stderr string
+		err    error
+	}{stdout, stderr, err})
+}
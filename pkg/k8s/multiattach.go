@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// multiAttachPods returns the pods a Multi-Attach event names:
+//
+//	Multi-Attach error for volume "pvc-1" Volume is already used by pod(s) web-0, web-1
+//
+// The other form, "Volume is already exclusively attached to one node and
+// can't be attached to another", names none.
+func multiAttachPods(message string) []string {
+	_, list, ok := strings.Cut(message, "used by pod(s) ")
+	if !ok {
+		return nil
+	}
+	var pods []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			pods = append(pods, name)
+		}
+	}
+	return pods
+}
+
+// attachedNode finds the node a ReadWriteOnce claim is attached to, and the
+// pods using it there: first the pods the Multi-Attach event named, then
+// any scheduled pod of the namespace that mounts the claim, then the
+// claim's VolumeAttachment, which outlives a deleted pod until the volume
+// is detached. It returns "" when none of them tells.
+func (c *Client) attachedNode(ctx context.Context, namespace, pvcName string, named []string) (string, []string) {
+	for _, name := range named {
+		p, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil && p.Spec.NodeName != "" {
+			return p.Spec.NodeName, named
+		}
+	}
+
+	if list, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+		node := ""
+		var users []string
+		for _, p := range list.Items {
+			if p.Spec.NodeName == "" || p.Labels["managed-by"] == "kube-browser" ||
+				p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			for _, vol := range p.Spec.Volumes {
+				if volumeClaimName(&p, vol) == pvcName && (node == "" || node == p.Spec.NodeName) {
+					node = p.Spec.NodeName
+					users = append(users, p.Name)
+					break
+				}
+			}
+		}
+		if node != "" {
+			return node, users
+		}
+	}
+
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil || pvc.Spec.VolumeName == "" {
+		return "", named
+	}
+	// Listing VolumeAttachments needs a ClusterRole; without it the
+	// workload's pods above are all there is to go on.
+	attachments, err := c.clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Cannot list volume attachments to locate PVC %s: %v", pvcName, err)
+		return "", named
+	}
+	for _, va := range attachments.Items {
+		if pv := va.Spec.Source.PersistentVolumeName; pv != nil && *pv == pvc.Spec.VolumeName && va.Status.Attached {
+			return va.Spec.NodeName, named
+		}
+	}
+	return "", named
+}
+
+// retryOnAttachedNode handles a helper pod that cannot mount its claim
+// because the ReadWriteOnce volume is attached to another node: the pod is
+// removed and, when that node is known and not the one just tried, a new
+// helper is started pinned to it. Otherwise the error says which pods hold
+// the volume, so the workload can be scaled down.
+func (c *Client) retryOnAttachedNode(ctx context.Context, w *helperWatch, helperName, namespace, pvcName, volumeName, nodeName string, opts helperPodOptions) (string, error) {
+	c.scheduleHelperDeletion(namespace, helperName)
+	node, users := c.attachedNode(ctx, namespace, pvcName, multiAttachPods(w.multiAttach))
+	if node != "" && node != nodeName {
+		log.Printf("PVC %s is attached to node %s, retrying helper pod there", pvcName, node)
+		w.report("MultiAttach", fmt.Sprintf("The volume is attached to node %s; starting the helper pod there", node), false)
+		return c.createHelperPodWith(ctx, namespace, pvcName, volumeName, node, opts)
+	}
+
+	err := classifyPodError(string(corev1.PodPending), "MultiAttach")
+	if len(users) > 0 {
+		err.Message += fmt.Sprintf(" In use by: %s.", strings.Join(users, ", "))
+	}
+	w.report("GaveUp", "Not waiting any longer: "+err.Message, true)
+	return "", err
+}
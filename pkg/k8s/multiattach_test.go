@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMultiAttachPods(t *testing.T) {
+	got := multiAttachPods(`Multi-Attach error for volume "pvc-1" Volume is already used by pod(s) web-0, web-1`)
+	if want := []string{"web-0", "web-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := multiAttachPods(`Multi-Attach error for volume "pvc-1" Volume is already exclusively attached to one node and can't be attached to another`); got != nil {
+		t.Errorf("expected no pods, got %v", got)
+	}
+}
+
+// multiAttachCluster fakes a cluster where helper pods not pinned to
+// node-2 cannot attach the claim, and pinned ones start.
+func multiAttachCluster(objects ...runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+	podsGVR := corev1.SchemeGroupVersion.WithResource("pods")
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		if !strings.HasPrefix(name, "kube-browser-helper-") {
+			return false, nil, nil
+		}
+		obj, err := clientset.Tracker().Get(podsGVR, action.GetNamespace(), name)
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*corev1.Pod).DeepCopy()
+		if pod.Spec.NodeName == "node-2" {
+			pod.Status.Phase = corev1.PodRunning
+		} else {
+			pod.Status = waitingPod("ContainerCreating").Status
+		}
+		return true, pod, nil
+	})
+	clientset.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj, _ := clientset.Tracker().List(podsGVR, corev1.SchemeGroupVersion.WithKind("Pod"), action.GetNamespace())
+		events := &corev1.EventList{}
+		for _, pod := range obj.(*corev1.PodList).Items {
+			if strings.HasPrefix(pod.Name, "kube-browser-helper-") && pod.Spec.NodeName == "" {
+				events.Items = append(events.Items, corev1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Name: pod.Name + ".1"},
+					InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod.Name},
+					Reason:         "FailedAttachVolume",
+					Type:           corev1.EventTypeWarning,
+					Count:          1,
+					Message:        `Multi-Attach error for volume "pvc-1" Volume is already used by pod(s) web-0`,
+				})
+			}
+		}
+		return true, events, nil
+	})
+	return clientset
+}
+
+func TestCreateHelperPodRetriesOnAttachedNode(t *testing.T) {
+	t.Setenv("HELPER_STARTUP_TIMEOUT_SEC", "30")
+	defer func(d time.Duration) { helperPollInterval = d }(helperPollInterval)
+	helperPollInterval = 10 * time.Millisecond
+
+	web := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node-2"},
+	}
+	c := &Client{clientset: multiAttachCluster(web), executor: &mockPodExecutor{}}
+
+	name, err := c.createHelperPod(context.Background(), "default", "data", "", "")
+	if err != nil {
+		t.Fatalf("expected the helper to start on the attached node, got %v", err)
+	}
+	pod, err := c.clientset.CoreV1().Pods("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil || pod.Spec.NodeName != "node-2" {
+		t.Errorf("expected the helper pinned to node-2, got %+v, %v", pod, err)
+	}
+}
+
+func TestCreateHelperPodMultiAttachWithoutNode(t *testing.T) {
+	t.Setenv("HELPER_STARTUP_TIMEOUT_SEC", "30")
+	defer func(d time.Duration) { helperPollInterval = d }(helperPollInterval)
+	helperPollInterval = 10 * time.Millisecond
+
+	c := &Client{clientset: multiAttachCluster(), executor: &mockPodExecutor{}}
+
+	start := time.Now()
+	_, err := c.createHelperPod(context.Background(), "default", "data", "", "")
+	ke, ok := err.(*K8sError)
+	if !ok || ke.Kind != ErrKindHelperPending || !strings.Contains(ke.Message, "Scale down") || !strings.Contains(ke.Message, "web-0") {
+		t.Fatalf("expected a Multi-Attach error naming the pod, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected to give up early, waited %s", time.Since(start))
+	}
+}
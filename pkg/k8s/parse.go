@@ -1,132 +1,302 @@
 package k8s
 
-import "strings"
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
 
-func parseGNUlsOutput(stdout, path string) []FileInfo {
-	var files []FileInfo
-	lines := strings.Split(stdout, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "total") {
-			continue
-		}
+// formatModTime renders a modification time as ISO 8601 in UTC, or "" when
+// it is unknown.
+func formatModTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
 
-		fields := strings.Fields(line)
-		if len(fields) < 8 {
-			continue
-		}
+// findPrintfFormat is the -printf format of the GNU find listing: type,
+// mode, size, mtime, owner, group, name and link target, each ended by a
+// NUL. A NUL cannot occur in a file name, so every legal name, spaces,
+// tabs and newlines included, comes back exactly as it is on disk.
+// shellListScript prints the same records where find has no -printf.
+const findPrintfFormat = `%y\0%M\0%s\0%T@\0%U\0%G\0%P\0%l\0`
 
-		name := strings.Join(fields[7:], " ")
-		if name == "." || name == ".." {
-			continue
-		}
+// findPrintfFields is the number of fields findPrintfFormat prints per entry.
+const findPrintfFields = 8
 
-		isDir := strings.HasPrefix(fields[0], "d")
-		filePath := buildFilePath(path, name)
+// parseFindPrintfOutput parses findPrintfFormat records, as find -printf or
+// shellListScript prints them.
+// Output that does not split into whole records is an error, so the next
+// listing method is tried.
+func parseFindPrintfOutput(stdout, path string) ([]FileInfo, error) {
+	if stdout == "" {
+		return nil, nil
+	}
+	fields := strings.Split(strings.TrimSuffix(stdout, "\x00"), "\x00")
+	if len(fields)%findPrintfFields != 0 {
+		return nil, fmt.Errorf("listing printed %d fields, not records of %d", len(fields), findPrintfFields)
+	}
+	var files []FileInfo
+	for i := 0; i < len(fields); i += findPrintfFields {
+		if f, ok := findPrintfEntry(fields[i:i+findPrintfFields], path); ok {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
 
-		files = append(files, FileInfo{
-			Name:    name,
-			Size:    fields[4],
-			ModTime: fields[5] + " " + fields[6],
-			IsDir:   isDir,
-			Path:    filePath,
-		})
+// findPrintfEntry reads the findPrintfFields fields of one record. It
+// reports false for the entries a listing skips.
+func findPrintfEntry(r []string, path string) (FileInfo, bool) {
+	name := r[6]
+	if name == "" || name == "." || name == ".." {
+		return FileInfo{}, false
 	}
-	return files
+	return FileInfo{
+		Name:       name,
+		Size:       r[2],
+		ModTime:    formatModTime(epochTime(r[3])),
+		IsDir:      r[0] == "d",
+		Path:       buildFilePath(path, name),
+		Mode:       lsMode(r[1]),
+		UID:        r[4],
+		GID:        r[5],
+		Symlink:    r[0] == "l",
+		LinkTarget: r[7],
+	}, true
 }
 
-func parseBusyboxOutput(stdout, path string) []FileInfo {
+// statBatchFormat is the stat(1) format of the POSIX listing; none of its
+// fields can contain a newline or "|".
+const statBatchFormat = "%F|%A|%s|%Y|%u|%g"
+
+// parseStatBatchOutput parses what statListBatch prints for each batch of
+// entries find hands it: one statBatchFormat line per entry, a NUL, then
+// each entry's name and link target, NUL-terminated, in the same order.
+func parseStatBatchOutput(stdout, path string) ([]FileInfo, error) {
 	var files []FileInfo
-	lines := strings.Split(stdout, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "total") {
-			continue
+	rest := stdout
+	for rest != "" {
+		end := strings.IndexByte(rest, 0)
+		if end < 0 {
+			return nil, fmt.Errorf("stat listing ended without its names")
 		}
+		lines := strings.Split(strings.TrimSuffix(rest[:end], "\n"), "\n")
+		rest = rest[end+1:]
+		for _, line := range lines {
+			meta := strings.Split(line, "|")
+			if len(meta) != 6 {
+				return nil, fmt.Errorf("unexpected stat line %q", line)
+			}
+			name, next, ok := strings.Cut(rest, "\x00")
+			if !ok {
+				return nil, fmt.Errorf("stat listing has more entries than names")
+			}
+			target, next, ok := strings.Cut(next, "\x00")
+			if !ok {
+				return nil, fmt.Errorf("stat listing has more entries than link targets")
+			}
+			rest = next
+			name = strings.TrimPrefix(name, "./")
+			if name == "" || name == "." || name == ".." {
+				continue
+			}
+			files = append(files, FileInfo{
+				Name:       name,
+				Size:       meta[2],
+				ModTime:    formatModTime(epochTime(meta[3])),
+				IsDir:      meta[0] == "directory",
+				Path:       buildFilePath(path, name),
+				Mode:       lsMode(meta[1]),
+				UID:        meta[4],
+				GID:        meta[5],
+				Symlink:    meta[0] == "symbolic link",
+				LinkTarget: target,
+			})
+		}
+	}
+	return files, nil
+}
 
-		fields := strings.Fields(line)
-		if len(fields) < 6 {
-			continue
+// epochTime parses seconds since the epoch, with or without the fraction
+// find's %T@ adds. It returns the zero time when s is not a number.
+func epochTime(s string) time.Time {
+	secs, _, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(n, 0)
+}
+
+// splitLsFields returns the first n whitespace-separated fields of an ls
+// line and the remainder verbatim, so runs of spaces inside a file name
+// survive.
+func splitLsFields(line string, n int) ([]string, string) {
+	var fields []string
+	rest := line
+	for len(fields) < n {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			return fields, ""
 		}
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return append(fields, rest), ""
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	return fields, strings.TrimLeftFunc(rest, unicode.IsSpace)
+}
 
-		isDir := strings.HasPrefix(fields[0], "d")
-
-		var name, size, modTime string
-		if len(fields) >= 9 {
-			size = fields[4]
-			modTime = fields[5] + " " + fields[6] + " " + fields[7]
-			name = strings.Join(fields[8:], " ")
-		} else if len(fields) >= 8 {
-			size = fields[4]
-			modTime = fields[5] + " " + fields[6]
-			name = strings.Join(fields[7:], " ")
+// FormatMode renders m the way ls -l prints it, for backends that report
+// modes rather than listing with ls: "drwxr-sr-x", "lrwxrwxrwx".
+func FormatMode(m fs.FileMode) string {
+	b := []byte("----------")
+	switch {
+	case m.IsDir():
+		b[0] = 'd'
+	case m&fs.ModeSymlink != 0:
+		b[0] = 'l'
+	case m&fs.ModeNamedPipe != 0:
+		b[0] = 'p'
+	case m&fs.ModeSocket != 0:
+		b[0] = 's'
+	case m&fs.ModeCharDevice != 0:
+		b[0] = 'c'
+	case m&fs.ModeDevice != 0:
+		b[0] = 'b'
+	}
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if m&(1<<uint(8-i)) != 0 {
+			b[i+1] = rwx[i]
+		}
+	}
+	special := func(bit fs.FileMode, i int, set, unset byte) {
+		if m&bit == 0 {
+			return
+		}
+		if b[i] == 'x' || b[i] == 't' {
+			b[i] = set
 		} else {
-			size = fields[3]
-			modTime = fields[4]
-			name = strings.Join(fields[5:], " ")
+			b[i] = unset
 		}
+	}
+	special(fs.ModeSetuid, 3, 's', 'S')
+	special(fs.ModeSetgid, 6, 's', 'S')
+	special(fs.ModeSticky, 9, 't', 'T')
+	return string(b)
+}
 
-		if name == "." || name == ".." || name == "" {
+// lsMode is the permission column of ls -l without the trailing marker
+// for an ACL ("+") or security context (".").
+func lsMode(s string) string {
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
+
+// looksLikeLsMode reports whether s is the permission column of an ls -l
+// line, e.g. "-rw-r--r--" or "drwxr-xr-x.".
+func looksLikeLsMode(s string) bool {
+	return len(s) >= 10 && strings.ContainsRune("-dlbcps", rune(s[0]))
+}
+
+// statFormat is the stat(1) format used with find by SearchFiles. The name comes last so
+// that records can be told apart even when a name contains a newline.
+const statFormat = "%s|%Y|%F|%A|%u|%g|%n"
+
+// parseStatOutput parses "size|mtime|type|mode|uid|gid|name" records
+// printed by find -exec stat -c statFormat. A line only starts a new record
+// when it has the metadata prefix followed by fullPath; any other line
+// continues the previous name, which contained a newline.
+func parseStatOutput(stdout, fullPath, path string) []FileInfo {
+	type record struct{ size, mtime, kind, mode, uid, gid, name string }
+	var records []record
+	for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		parts := strings.SplitN(line, "|", 7)
+		if len(parts) == 7 && isDigits(parts[0]) && isDigits(parts[1]) && isDigits(parts[4]) && isDigits(parts[5]) && strings.HasPrefix(parts[6], fullPath) {
+			records = append(records, record{parts[0], parts[1], parts[2], parts[3], parts[4], parts[5], parts[6]})
 			continue
 		}
+		if len(records) > 0 {
+			records[len(records)-1].name += "\n" + line
+		}
+	}
 
+	var files []FileInfo
+	for _, r := range records {
+		name := findEntryName(r.name, fullPath)
+		if name == "" {
+			continue
+		}
+		var modTime time.Time
+		if secs, err := strconv.ParseInt(r.mtime, 10, 64); err == nil {
+			modTime = time.Unix(secs, 0)
+		}
 		files = append(files, FileInfo{
 			Name:    name,
-			Size:    size,
-			ModTime: modTime,
-			IsDir:   isDir,
+			Size:    r.size,
+			ModTime: formatModTime(modTime),
+			IsDir:   strings.Contains(r.kind, "directory"),
 			Path:    buildFilePath(path, name),
+			Mode:    r.mode,
+			UID:     r.uid,
+			GID:     r.gid,
+			Symlink: r.kind == "symbolic link",
 		})
 	}
 	return files
 }
 
-func parseFindOutput(stdout, fullPath, path string) []FileInfo {
+// parsePrint0Output parses NUL-separated names from find -print0, used when
+// stat is unavailable.
+func parsePrint0Output(stdout, fullPath, path string) []FileInfo {
 	var files []FileInfo
-	lines := strings.Split(stdout, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	for _, entry := range strings.Split(stdout, "\x00") {
+		name := findEntryName(entry, fullPath)
+		if name == "" {
 			continue
 		}
+		files = append(files, FileInfo{
+			Name:    name,
+			Size:    "0",
+			ModTime: "",
+			IsDir:   false,
+			Path:    buildFilePath(path, name),
+		})
+	}
+	return files
+}
 
-		parts := strings.SplitN(line, "|", 4)
-		if len(parts) == 4 {
-			name := parts[0]
-			if strings.HasPrefix(name, fullPath) {
-				name = strings.TrimPrefix(name, fullPath)
-				name = strings.TrimPrefix(name, "/")
-			}
-			if name == "" || name == "." || name == ".." {
-				continue
-			}
-			isDir := strings.Contains(parts[3], "directory")
-			files = append(files, FileInfo{
-				Name:    name,
-				Size:    parts[1],
-				ModTime: parts[2],
-				IsDir:   isDir,
-				Path:    buildFilePath(path, name),
-			})
-		} else {
-			name := line
-			if strings.HasPrefix(name, fullPath) {
-				name = strings.TrimPrefix(name, fullPath)
-				name = strings.TrimPrefix(name, "/")
-			}
-			if name == "" || name == "." || name == ".." {
-				continue
-			}
-			files = append(files, FileInfo{
-				Name:    name,
-				Size:    "0",
-				ModTime: "-",
-				IsDir:   false,
-				Path:    buildFilePath(path, name),
-			})
+// findEntryName strips fullPath from a path printed by find. It returns ""
+// for entries that should be skipped.
+func findEntryName(p, fullPath string) string {
+	name := strings.TrimPrefix(p, fullPath)
+	name = strings.TrimPrefix(name, "/")
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
 		}
 	}
-	return files
+	return true
 }
 
 func buildFilePath(parent, name string) string {
@@ -4,182 +4,7 @@ import (
 	"testing"
 )
 
-func TestParseGNUlsOutput(t *testing.T) {
-	tests := []struct {
-		name     string
-		stdout   string
-		path     string
-		wantLen  int
-		wantFile FileInfo
-	}{
-		{
-			name: "regular file and directory",
-			stdout: `total 8
--rw-r--r-- 1 root root  123 2024-01-15 10:30 myfile.txt
-drwxr-xr-x 2 root root 4096 2024-01-15 10:30 mydir`,
-			path:    "/data",
-			wantLen: 2,
-			wantFile: FileInfo{
-				Name:    "myfile.txt",
-				Size:    "123",
-				ModTime: "2024-01-15 10:30",
-				IsDir:   false,
-				Path:    "/data/myfile.txt",
-			},
-		},
-		{
-			name: "file with spaces in name",
-			stdout: `total 4
--rw-r--r-- 1 root root 42 2024-01-15 10:30 my file with spaces.txt`,
-			path:    "/",
-			wantLen: 1,
-			wantFile: FileInfo{
-				Name:    "my file with spaces.txt",
-				Size:    "42",
-				ModTime: "2024-01-15 10:30",
-				IsDir:   false,
-				Path:    "my file with spaces.txt",
-			},
-		},
-		{
-			name: "root path yields flat filePath",
-			stdout: `total 4
-drwxr-xr-x 2 root root 4096 2024-01-15 10:30 subdir`,
-			path:    "",
-			wantLen: 1,
-			wantFile: FileInfo{
-				Name:  "subdir",
-				IsDir: true,
-				Path:  "subdir",
-			},
-		},
-		{
-			name:    "empty output",
-			stdout:  "",
-			path:    "/data",
-			wantLen: 0,
-		},
-		{
-			name: "dot and dotdot are skipped",
-			stdout: `total 8
-drwxr-xr-x 2 root root 4096 2024-01-15 10:30 .
-drwxr-xr-x 8 root root 4096 2024-01-15 10:30 ..
--rw-r--r-- 1 root root   10 2024-01-15 10:30 actual.txt`,
-			path:    "/data",
-			wantLen: 1,
-		},
-		{
-			name: "malformed lines skipped",
-			stdout: `total 4
-this is a malformed line
--rw-r--r-- 1 root root 10 2024-01-15 10:30 ok.txt`,
-			path:    "/data",
-			wantLen: 1,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parseGNUlsOutput(tt.stdout, tt.path)
-			if len(got) != tt.wantLen {
-				t.Errorf("got %d files, want %d", len(got), tt.wantLen)
-			}
-			if tt.wantLen > 0 && (tt.wantFile.Name != "" || tt.wantFile.Path != "") {
-				f := got[0]
-				if tt.wantFile.Name != "" && f.Name != tt.wantFile.Name {
-					t.Errorf("Name: got %q, want %q", f.Name, tt.wantFile.Name)
-				}
-				if tt.wantFile.Size != "" && f.Size != tt.wantFile.Size {
-					t.Errorf("Size: got %q, want %q", f.Size, tt.wantFile.Size)
-				}
-				if tt.wantFile.Path != "" && f.Path != tt.wantFile.Path {
-					t.Errorf("Path: got %q, want %q", f.Path, tt.wantFile.Path)
-				}
-				if tt.wantFile.IsDir != f.IsDir {
-					t.Errorf("IsDir: got %v, want %v", f.IsDir, tt.wantFile.IsDir)
-				}
-			}
-		})
-	}
-}
-
-func TestParseBusyboxOutput(t *testing.T) {
-	tests := []struct {
-		name     string
-		stdout   string
-		path     string
-		wantLen  int
-		wantFile *FileInfo
-	}{
-		{
-			name: "standard busybox ls output (8 fields)",
-			stdout: `total 8
--rw-r--r--    1 root     root           42 Jan 15 10:30 notes.txt
-drwxr-xr-x    2 root     root         4096 Jan 15 10:30 configs`,
-			path:    "/data",
-			wantLen: 2,
-			wantFile: &FileInfo{
-				Name:  "notes.txt",
-				Size:  "42",
-				IsDir: false,
-				Path:  "/data/notes.txt",
-			},
-		},
-		{
-			name: "file with spaces in name",
-			stdout: `total 4
--rw-r--r--    1 root     root           10 Jan 15 10:30 my data file.csv`,
-			path:    "/",
-			wantLen: 1,
-			wantFile: &FileInfo{
-				Name:  "my data file.csv",
-				Path:  "my data file.csv",
-				IsDir: false,
-			},
-		},
-		{
-			name:    "empty",
-			stdout:  "",
-			path:    "/data",
-			wantLen: 0,
-		},
-		{
-			name: "dot entries skipped",
-			stdout: `total 4
-drwxr-xr-x    2 root     root         4096 Jan 15 10:30 .
-drwxr-xr-x    8 root     root         4096 Jan 15 10:30 ..
--rw-r--r--    1 root     root           10 Jan 15 10:30 real.txt`,
-			path:    "/data",
-			wantLen: 1,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parseBusyboxOutput(tt.stdout, tt.path)
-			if len(got) != tt.wantLen {
-				t.Errorf("got %d files, want %d", len(got), tt.wantLen)
-			}
-			if tt.wantFile != nil && len(got) > 0 {
-				f := got[0]
-				if tt.wantFile.Name != "" && f.Name != tt.wantFile.Name {
-					t.Errorf("Name: got %q, want %q", f.Name, tt.wantFile.Name)
-				}
-				if tt.wantFile.Size != "" && f.Size != tt.wantFile.Size {
-					t.Errorf("Size: got %q, want %q", f.Size, tt.wantFile.Size)
-				}
-				if tt.wantFile.Path != "" && f.Path != tt.wantFile.Path {
-					t.Errorf("Path: got %q, want %q", f.Path, tt.wantFile.Path)
-				}
-				if tt.wantFile.IsDir != f.IsDir {
-					t.Errorf("IsDir: got %v, want %v", f.IsDir, tt.wantFile.IsDir)
-				}
-			}
-		})
-	}
-}
-
-func TestParseFindOutput(t *testing.T) {
+func TestParseStatOutput(t *testing.T) {
 	fullPath := "/data"
 
 	tests := []struct {
@@ -191,7 +16,7 @@ func TestParseFindOutput(t *testing.T) {
 	}{
 		{
 			name:   "stat pipe format",
-			stdout: "/data/myfile.txt|1234|1705310400|regular file\n/data/subdir|0|1705310400|directory\n",
+			stdout: "1234|1705310400|regular file|-rw-r--r--|0|0|/data/myfile.txt\n0|1705310400|directory|drwxr-xr-x|0|0|/data/subdir\n",
 			path:   "/data",
 			wantLen: 2,
 			wantFile: &FileInfo{
@@ -201,18 +26,6 @@ func TestParseFindOutput(t *testing.T) {
 				Path:  "/data/myfile.txt",
 			},
 		},
-		{
-			name:   "plain find output (no stat)",
-			stdout: "/data/a.txt\n/data/b.txt\n",
-			path:   "/data",
-			wantLen: 2,
-			wantFile: &FileInfo{
-				Name:  "a.txt",
-				Size:  "0",
-				IsDir: false,
-				Path:  "/data/a.txt",
-			},
-		},
 		{
 			name:    "empty output",
 			stdout:  "",
@@ -221,7 +34,7 @@ func TestParseFindOutput(t *testing.T) {
 		},
 		{
 			name:   "directory entry",
-			stdout: "/data/mydir|0|1705310400|directory\n",
+			stdout: "0|1705310400|directory|drwxr-xr-x|0|0|/data/mydir\n",
 			path:   "/",
 			wantLen: 1,
 			wantFile: &FileInfo{
@@ -232,7 +45,7 @@ func TestParseFindOutput(t *testing.T) {
 		},
 		{
 			name:   "root path produces flat filePath",
-			stdout: "/data/file.txt|100|1705310400|regular file\n",
+			stdout: "100|1705310400|regular file|-rw-r--r--|0|0|/data/file.txt\n",
 			path:   "",
 			wantLen: 1,
 			wantFile: &FileInfo{
@@ -244,7 +57,7 @@ func TestParseFindOutput(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := parseFindOutput(tt.stdout, fullPath, tt.path)
+			got := parseStatOutput(tt.stdout, fullPath, tt.path)
 			if len(got) != tt.wantLen {
 				t.Errorf("got %d files, want %d; entries: %v", len(got), tt.wantLen, got)
 			}
@@ -267,47 +80,40 @@ func TestParseFindOutput(t *testing.T) {
 	}
 }
 
-func TestParseGNUlsSymlink(t *testing.T) {
-	stdout := `total 4
-lrwxrwxrwx 1 root root 11 2024-01-15 10:30 link -> /etc/hosts
--rw-r--r-- 1 root root 42 2024-01-15 10:30 file.txt`
-	got := parseGNUlsOutput(stdout, "/data")
-	if len(got) != 2 {
-		t.Fatalf("expected 2 entries, got %d", len(got))
+func TestParseFindSymlink(t *testing.T) {
+	stdout := "0|1705310400|symbolic link|lrwxrwxrwx|0|0|/data/mylink\n"
+	got := parseStatOutput(stdout, "/data", "/data")
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
 	}
 	if got[0].IsDir {
-		t.Error("symlink should not be marked as directory")
+		t.Error("symbolic link should not be marked as directory")
 	}
-	if got[0].Name != "link -> /etc/hosts" {
-		t.Errorf("symlink name: got %q, want %q", got[0].Name, "link -> /etc/hosts")
+	if got[0].Name != "mylink" || !got[0].Symlink || got[0].Mode != "lrwxrwxrwx" || got[0].UID != "0" {
+		t.Errorf("unexpected entry: %+v", got[0])
 	}
 }
 
-func TestParseGNUlsMalformedVariants(t *testing.T) {
+func TestParseFindMalformedVariants(t *testing.T) {
 	tests := []struct {
 		name    string
 		stdout  string
 		wantLen int
 	}{
 		{
-			name:    "too few fields skipped",
-			stdout:  "-rw-r--r-- 1 root root 42 2024-01-15",
-			wantLen: 0,
-		},
-		{
-			name:    "only total line",
-			stdout:  "total 0",
-			wantLen: 0,
+			name:    "blank line skipped",
+			stdout:  "\n\n10|1705310400|regular file|-rw-r--r--|0|0|/data/ok.txt\n",
+			wantLen: 1,
 		},
 		{
-			name:    "whitespace-only lines ignored",
-			stdout:  "   \n\t\n-rw-r--r-- 1 root root 10 2024-01-15 10:30 ok.txt",
+			name:    "root fullPath entry itself skipped",
+			stdout:  "0|1705310400|directory|drwxr-xr-x|0|0|/data\n0|1705310400|directory|drwxr-xr-x|0|0|/data/sub\n",
 			wantLen: 1,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := parseGNUlsOutput(tt.stdout, "/data")
+			got := parseStatOutput(tt.stdout, "/data", "/data")
 			if len(got) != tt.wantLen {
 				t.Errorf("got %d, want %d; entries: %v", len(got), tt.wantLen, got)
 			}
@@ -315,92 +121,125 @@ func TestParseGNUlsMalformedVariants(t *testing.T) {
 	}
 }
 
-func TestParseBusyboxSymlink(t *testing.T) {
-	stdout := `total 4
-lrwxrwxrwx    1 root     root           7 Jan 15 10:30 mylink -> target1
--rw-r--r--    1 root     root          10 Jan 15 10:30 real.txt`
-	got := parseBusyboxOutput(stdout, "/data")
+
+func TestParseStatOutputNamesWithNewlines(t *testing.T) {
+	stdout := "12|1705310400|regular file|-rw-r--r--|0|0|/data/two\nlines.txt\n" +
+		"0|1705310400|directory|drwxr-xr-x|0|0|/data/\x1b[31mred\n" +
+		"3|1705310400|regular file|-rw-r--r--|0|0|/data/trailing\n\n\n" +
+		"5|1705310400|regular file|-rw-r--r--|0|0|/data/plain.txt\n"
+	got := parseStatOutput(stdout, "/data", "/")
+	want := []string{"two\nlines.txt", "\x1b[31mred", "trailing\n\n", "plain.txt"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %d: %+v", len(want), len(got), got)
+	}
+	for i, name := range want {
+		if got[i].Name != name || got[i].Path != name {
+			t.Errorf("entry %d: got name %q path %q, want %q", i, got[i].Name, got[i].Path, name)
+		}
+	}
+	if !got[1].IsDir || got[0].Size != "12" {
+		t.Errorf("metadata not preserved: %+v", got)
+	}
+}
+
+func TestParsePrint0Output(t *testing.T) {
+	got := parsePrint0Output("/data/a.txt\x00/data/my file\nwith newline\x00", "/data", "/data")
 	if len(got) != 2 {
-		t.Fatalf("expected 2 entries, got %d", len(got))
+		t.Fatalf("expected 2 entries, got %d: %+v", len(got), got)
 	}
-	if got[0].IsDir {
-		t.Error("symlink should not be marked as directory")
+	if got[1].Name != "my file\nwith newline" || got[1].Path != "/data/my file\nwith newline" {
+		t.Errorf("unexpected entry: %+v", got[1])
 	}
-	if got[0].Name != "mylink -> target1" {
-		t.Errorf("symlink name: got %q, want %q", got[0].Name, "mylink -> target1")
+	if got[0].Size != "0" || got[0].ModTime != "" {
+		t.Errorf("expected placeholder metadata, got %+v", got[0])
 	}
 }
 
-func TestParseBusyboxMalformedVariants(t *testing.T) {
-	tests := []struct {
-		name    string
-		stdout  string
-		wantLen int
-	}{
-		{
-			name:    "fewer than 6 fields skipped",
-			stdout:  "-rw-r--r-- 1 root root 10",
-			wantLen: 0,
-		},
-		{
-			name:    "blank lines ignored",
-			stdout:  "\n\n-rw-r--r--    1 root     root           10 Jan 15 10:30 f.txt\n\n",
-			wantLen: 1,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parseBusyboxOutput(tt.stdout, "/data")
-			if len(got) != tt.wantLen {
-				t.Errorf("got %d, want %d; entries: %v", len(got), tt.wantLen, got)
-			}
-		})
+func TestParseStatOutputModTimeIsUTC(t *testing.T) {
+	got := parseStatOutput("1|1705314600|regular file|-rw-r--r--|0|0|/data/a\n", "/data", "/")
+	if len(got) != 1 || got[0].ModTime != "2024-01-15T10:30:00Z" {
+		t.Errorf("unexpected entries: %+v", got)
 	}
 }
 
-func TestParseFindSymlink(t *testing.T) {
-	stdout := "/data/mylink|0|1705310400|symbolic link\n"
-	got := parseFindOutput(stdout, "/data", "/data")
-	if len(got) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(got))
+// awkwardNames are legal file names that line-based ls parsing mangles.
+var awkwardNames = []string{
+	"two  spaces",
+	"trailing space ",
+	"tab\there",
+	"new\nline",
+	"-rw-r--r-- 1 root root 0 fake",
+	"arrow -> inside",
+	"ünïcödé 文件.txt",
+	"\"quoted\"",
+}
+
+func TestParseFindPrintfOutputRoundTripsNames(t *testing.T) {
+	var out string
+	for _, name := range awkwardNames {
+		out += "f\x00-rw-r--r--\x000\x001705314600.0000000000\x001000\x001000\x00" + name + "\x00\x00"
 	}
-	if got[0].IsDir {
-		t.Error("symbolic link should not be marked as directory")
+	out += "d\x00drwxr-sr-x\x004096\x001705314600.0000000000\x000\x000\x00dir\x00\x00"
+	out += "l\x00lrwxrwxrwx\x003\x001705314600.0000000000\x000\x000\x00link\x00a\nb\x00"
+
+	files, err := parseFindPrintfOutput(out, "/sub")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if got[0].Name != "mylink" {
-		t.Errorf("Name: got %q, want %q", got[0].Name, "mylink")
+	if len(files) != len(awkwardNames)+2 {
+		t.Fatalf("got %d entries, want %d: %+v", len(files), len(awkwardNames)+2, files)
+	}
+	for i, name := range awkwardNames {
+		if files[i].Name != name || files[i].Path != "/sub/"+name || files[i].IsDir {
+			t.Errorf("entry %d = %+v, want %q", i, files[i], name)
+		}
+	}
+	dir, link := files[len(awkwardNames)], files[len(awkwardNames)+1]
+	if !dir.IsDir || dir.Mode != "drwxr-sr-x" || dir.ModTime != "2024-01-15T10:30:00Z" {
+		t.Errorf("unexpected directory entry: %+v", dir)
+	}
+	if !link.Symlink || link.IsDir || link.LinkTarget != "a\nb" {
+		t.Errorf("unexpected link entry: %+v", link)
 	}
-}
 
-func TestParseFindMalformedVariants(t *testing.T) {
-	tests := []struct {
-		name    string
-		stdout  string
-		wantLen int
-	}{
-		{
-			name:    "blank line skipped",
-			stdout:  "\n\n/data/ok.txt|10|1705310400|regular file\n",
-			wantLen: 1,
-		},
-		{
-			name:    "root fullPath entry itself skipped",
-			stdout:  "/data|0|1705310400|directory\n/data/sub|0|1705310400|directory\n",
-			wantLen: 1,
-		},
-		{
-			name:    "plain path with spaces treated as name",
-			stdout:  "/data/my file.txt\n",
-			wantLen: 1,
-		},
+	if files, err := parseFindPrintfOutput("", "/"); err != nil || len(files) != 0 {
+		t.Errorf("empty directory: %+v, %v", files, err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parseFindOutput(tt.stdout, "/data", "/data")
-			if len(got) != tt.wantLen {
-				t.Errorf("got %d, want %d; entries: %v", len(got), tt.wantLen, got)
-			}
-		})
+	if _, err := parseFindPrintfOutput("f\x00-rw-r--r--\x00", "/"); err == nil {
+		t.Error("expected an error for a truncated record")
 	}
 }
 
+func TestParseStatBatchOutputRoundTripsNames(t *testing.T) {
+	// Two batches, as find -exec ... + may run the script more than once.
+	var meta, names string
+	for _, name := range awkwardNames {
+		meta += "regular file|-rw-r--r--|5|1705314600|0|0\n"
+		names += "./" + name + "\x00\x00"
+	}
+	out := meta + "\x00" + names +
+		"symbolic link|lrwxrwxrwx|4|1705314600|0|0\n\x00./ln\x00../target dir\x00"
+
+	files, err := parseStatBatchOutput(out, "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != len(awkwardNames)+1 {
+		t.Fatalf("got %d entries, want %d: %+v", len(files), len(awkwardNames)+1, files)
+	}
+	for i, name := range awkwardNames {
+		if files[i].Name != name || files[i].Path != name || files[i].Size != "5" {
+			t.Errorf("entry %d = %+v, want %q", i, files[i], name)
+		}
+	}
+	if ln := files[len(awkwardNames)]; !ln.Symlink || ln.LinkTarget != "../target dir" {
+		t.Errorf("unexpected link entry: %+v", ln)
+	}
+
+	if _, err := parseStatBatchOutput("regular file|-rw-r--r--|5|1705314600|0|0\n\x00", "/"); err == nil {
+		t.Error("expected an error when names are missing")
+	}
+	if _, err := parseStatBatchOutput("garbage\n\x00./a\x00\x00", "/"); err == nil {
+		t.Error("expected an error for an unexpected stat line")
+	}
+}
@@ -0,0 +1,230 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FilePermissions is the mode and ownership applied to files and
+// directories KubeBrowser creates on a PVC. Empty fields leave whatever the
+// creating command produced.
+type FilePermissions struct {
+	Mode  string `json:"mode,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+var (
+	modePattern = regexp.MustCompile(`^[0-7]{3,4}$`)
+	// ownerPattern matches "user", "user:group" and ":group". Names do
+	// not start with "-", so that an owner never reads as an option.
+	ownerPattern = regexp.MustCompile(`^([A-Za-z0-9_.][A-Za-z0-9_.-]*)?(:([A-Za-z0-9_.][A-Za-z0-9_.-]*)?)?$`)
+	// symbolicModePattern matches chmod's symbolic modes, such as
+	// "g+rwX" or "u=rw,go=r". A leading "-" would read as an option.
+	symbolicModePattern = regexp.MustCompile(`^[ugoa]*([+=-][rwxXst]*)+(,[ugoa]*([+=-][rwxXst]*)+)*$`)
+)
+
+// Validate rejects anything that is not an octal mode or a "user[:group]"
+// owner, since both end up as arguments to chmod/chown.
+func (p FilePermissions) Validate() error {
+	if p.Mode != "" && !modePattern.MatchString(p.Mode) {
+		return fmt.Errorf("invalid mode %q: expected octal such as 0664", p.Mode)
+	}
+	if p.Owner != "" && (p.Owner == ":" || !ownerPattern.MatchString(p.Owner)) {
+		return fmt.Errorf("invalid owner %q: expected user, user:group or :group", p.Owner)
+	}
+	return nil
+}
+
+// ValidateChange is Validate for ChangePermissions, which also takes
+// symbolic modes: a recursive "g+rwX" fixes a tree where no single octal
+// mode fits both files and directories.
+func (p FilePermissions) ValidateChange() error {
+	if p.Mode != "" && !modePattern.MatchString(p.Mode) {
+		if !symbolicModePattern.MatchString(p.Mode) || p.Mode[0] == '-' {
+			return fmt.Errorf("invalid mode %q: expected octal such as 0664 or symbolic such as g+rwX", p.Mode)
+		}
+		return FilePermissions{Owner: p.Owner}.Validate()
+	}
+	return p.Validate()
+}
+
+// DefaultUploadPermissions reads KUBE_BROWSER_UPLOAD_MODE and
+// KUBE_BROWSER_UPLOAD_OWNER.
+func DefaultUploadPermissions() FilePermissions {
+	return FilePermissions{
+		Mode:  os.Getenv("KUBE_BROWSER_UPLOAD_MODE"),
+		Owner: os.Getenv("KUBE_BROWSER_UPLOAD_OWNER"),
+	}
+}
+
+// withFSGroup fills in what is unset in p for a pod that declares an
+// fsGroup: files become group-owned by it and group-writable (directories
+// also setgid), matching what the kubelet does to the volume itself. Without
+// this, files written through a root exec are root:root 644 and unwritable
+// by an app running as a non-root member of fsGroup.
+func (p FilePermissions) withFSGroup(fsGroup *int64, isDir bool) FilePermissions {
+	if fsGroup == nil {
+		return p
+	}
+	if p.Owner == "" {
+		p.Owner = ":" + strconv.FormatInt(*fsGroup, 10)
+	}
+	if p.Mode == "" {
+		if isDir {
+			p.Mode = "2775"
+		} else {
+			p.Mode = "0664"
+		}
+	}
+	return p
+}
+
+// ApplyPermissions chmods/chowns filePath on the PVC according to perms,
+// completed with the mounting pod's fsGroup. It returns the permissions
+// that were actually requested so callers can report them.
+func (c *Client) ApplyPermissions(ctx context.Context, namespace, pvcName, filePath string, perms FilePermissions, isDir bool) (FilePermissions, error) {
+	if err := perms.Validate(); err != nil {
+		return perms, err
+	}
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return perms, err
+	}
+	perms = perms.withFSGroup(info.fsGroup, isDir)
+
+	if perms.Mode != "" {
+		_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+			return []string{"chmod", perms.Mode, "--", pvcPath(mountPath, filePath)}
+		})
+		if err != nil {
+			return perms, permissionError("chmod", err, stderr)
+		}
+	}
+	if perms.Owner != "" {
+		_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+			return []string{"chown", perms.Owner, "--", pvcPath(mountPath, filePath)}
+		})
+		if err != nil {
+			return perms, permissionError("chown", err, stderr)
+		}
+	}
+	if perms != (FilePermissions{}) {
+		log.Printf("Applied mode=%q owner=%q to %s/%s:%s", perms.Mode, perms.Owner, namespace, pvcName, filePath)
+	}
+	return perms, nil
+}
+
+func permissionError(op string, err error, stderr string) error {
+	if ke, ok := err.(*K8sError); ok {
+		err = streamError(ke, stderr)
+	}
+	return fmt.Errorf("%s failed: %w", op, err)
+}
+
+// ChangePermissions sets the mode and owner of filePath exactly as given,
+// and with recursive those of everything below it. Unlike
+// ApplyPermissions nothing is filled in from the pod's fsGroup: this is
+// for fixing ownership by hand, e.g. "chown -R :2000" and "chmod -R g+rwX"
+// after an fsGroup change.
+func (c *Client) ChangePermissions(ctx context.Context, namespace, pvcName, filePath string, perms FilePermissions, recursive bool) error {
+	if err := perms.ValidateChange(); err != nil {
+		return err
+	}
+	run := func(op, arg string) error {
+		_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+			cmd := []string{op}
+			if recursive {
+				cmd = append(cmd, "-R")
+			}
+			return append(cmd, arg, "--", pvcPath(mountPath, filePath))
+		})
+		if err != nil {
+			return permissionError(op, err, stderr)
+		}
+		return nil
+	}
+	if perms.Owner != "" {
+		// chown clears setuid and setgid bits, so it goes first.
+		if err := run("chown", perms.Owner); err != nil {
+			return err
+		}
+	}
+	if perms.Mode != "" {
+		if err := run("chmod", perms.Mode); err != nil {
+			return err
+		}
+	}
+	log.Printf("Changed mode=%q owner=%q recursive=%v on %s/%s:%s", perms.Mode, perms.Owner, recursive, namespace, pvcName, filePath)
+	return nil
+}
+
+// ApplyChmod returns the permission bits (including setuid, setgid and
+// sticky, as in 02775) that chmod with mode would give a file that has
+// mode now. Backends without a chmod command use it to accept the same
+// modes; mode must have passed ValidateChange.
+func ApplyChmod(now uint32, mode string, isDir bool) uint32 {
+	if modePattern.MatchString(mode) {
+		v, _ := strconv.ParseUint(mode, 8, 32)
+		return uint32(v)
+	}
+	orig := now
+	for _, clause := range strings.Split(mode, ",") {
+		i := strings.IndexAny(clause, "+-=")
+		who := clause[:i]
+		if who == "" || strings.Contains(who, "a") {
+			who = "ugo"
+		}
+		var mask, special uint32
+		for _, w := range who {
+			switch w {
+			case 'u':
+				mask, special = mask|0700, special|04000
+			case 'g':
+				mask, special = mask|0070, special|02000
+			case 'o':
+				mask, special = mask|0007, special|01000
+			}
+		}
+		for rest := clause[i:]; rest != ""; {
+			op, perms := rest[0], rest[1:]
+			if j := strings.IndexAny(perms, "+-="); j >= 0 {
+				perms, rest = perms[:j], perms[j:]
+			} else {
+				rest = ""
+			}
+			var bits uint32
+			for _, p := range perms {
+				switch p {
+				case 'r':
+					bits |= 0444 & mask
+				case 'w':
+					bits |= 0222 & mask
+				case 'x':
+					bits |= 0111 & mask
+				case 'X':
+					if isDir || orig&0111 != 0 {
+						bits |= 0111 & mask
+					}
+				case 's':
+					bits |= special & 06000
+				case 't':
+					bits |= special & 01000
+				}
+			}
+			switch op {
+			case '+':
+				now |= bits
+			case '-':
+				now &^= bits
+			case '=':
+				now = now&^(mask|special) | bits
+			}
+		}
+	}
+	return now
+}
@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFilePermissionsValidate(t *testing.T) {
+	tests := []struct {
+		perms   FilePermissions
+		wantErr bool
+	}{
+		{FilePermissions{}, false},
+		{FilePermissions{Mode: "0664", Owner: "1000:2000"}, false},
+		{FilePermissions{Mode: "775", Owner: ":2000"}, false},
+		{FilePermissions{Owner: "app"}, false},
+		{FilePermissions{Mode: "0999"}, true},
+		{FilePermissions{Mode: "u+w"}, true},
+		{FilePermissions{Owner: ":"}, true},
+		{FilePermissions{Owner: "root; rm -rf /"}, true},
+		{FilePermissions{Owner: "-R"}, true},
+		{FilePermissions{Owner: "--reference=/etc/shadow"}, true},
+		{FilePermissions{Owner: "app:-staff"}, true},
+		{FilePermissions{Owner: "app-user:app-group"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.perms.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.perms, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyPermissionsUsesFSGroup(t *testing.T) {
+	fsGroup := int64(2000)
+	pod := runningPodWithPVC("my-pvc")
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{FSGroup: &fsGroup}
+
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", nil)
+	mock.pushExec("", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(pod), executor: mock}
+
+	applied, err := c.ApplyPermissions(context.Background(), "default", "my-pvc", "/up/a.txt", FilePermissions{}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied != (FilePermissions{Mode: "0664", Owner: ":2000"}) {
+		t.Errorf("unexpected permissions: %+v", applied)
+	}
+	want := [][]string{
+		{"chmod", "0664", "--", "/data/up/a.txt"},
+		{"chown", ":2000", "--", "/data/up/a.txt"},
+	}
+	for i, call := range mock.execCalls {
+		if !reflect.DeepEqual(call.cmd, want[i]) {
+			t.Errorf("call %d = %v, want %v", i, call.cmd, want[i])
+		}
+	}
+}
+
+func TestApplyPermissionsExplicitOverridesFSGroup(t *testing.T) {
+	fsGroup := int64(2000)
+	pod := runningPodWithPVC("my-pvc")
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{FSGroup: &fsGroup}
+
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", nil)
+	mock.pushExec("", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(pod), executor: mock}
+
+	applied, err := c.ApplyPermissions(context.Background(), "default", "my-pvc", "/d", FilePermissions{Owner: "1000:1000"}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied != (FilePermissions{Mode: "2775", Owner: "1000:1000"}) {
+		t.Errorf("unexpected permissions: %+v", applied)
+	}
+}
+
+func TestApplyPermissionsNoopWithoutConfigOrFSGroup(t *testing.T) {
+	mock := &mockPodExecutor{}
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	if _, err := c.ApplyPermissions(context.Background(), "default", "my-pvc", "/a.txt", FilePermissions{}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.execCalls) != 0 {
+		t.Errorf("expected no exec calls, got %v", mock.execCalls)
+	}
+}
+
+func TestFilePermissionsValidateChange(t *testing.T) {
+	for mode, ok := range map[string]bool{
+		"0664":      true,
+		"g+rwX":     true,
+		"u=rw,go=r": true,
+		"+x":        true,
+		"a-w":       true,
+		"-w":        false,
+		"g+q":       false,
+		"u+w;ls":    false,
+	} {
+		if err := (FilePermissions{Mode: mode}).ValidateChange(); (err == nil) != ok {
+			t.Errorf("ValidateChange(%q) error = %v, want ok %v", mode, err, ok)
+		}
+	}
+	if err := (FilePermissions{Mode: "g+w", Owner: "root; rm -rf /"}).ValidateChange(); err == nil {
+		t.Error("a symbolic mode must not skip the owner check")
+	}
+}
+
+func TestApplyChmod(t *testing.T) {
+	tests := []struct {
+		now   uint32
+		mode  string
+		isDir bool
+		want  uint32
+	}{
+		{0644, "0600", false, 0600},
+		{0644, "2775", true, 02775},
+		{0644, "g+rwX", false, 0664},
+		{0744, "g+rwX", false, 0774},
+		{0755, "g+rwX", true, 0775},
+		{0775, "o-rwx", true, 0770},
+		{0777, "u=rw,go=r", false, 0644},
+		{0755, "g+s", true, 02755},
+		{02775, "g=rx", true, 0755},
+		{0644, "+x", false, 0755},
+		{0755, "a-x+t", true, 01644},
+	}
+	for _, tt := range tests {
+		if got := ApplyChmod(tt.now, tt.mode, tt.isDir); got != tt.want {
+			t.Errorf("ApplyChmod(%o, %q, %v) = %o, want %o", tt.now, tt.mode, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestChangePermissionsRecursive(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", nil)
+	mock.pushExec("", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	perms := FilePermissions{Mode: "g+rwX", Owner: ":2000"}
+	if err := c.ChangePermissions(context.Background(), "default", "my-pvc", "/app", perms, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]string{
+		{"chown", "-R", ":2000", "--", "/data/app"},
+		{"chmod", "-R", "g+rwX", "--", "/data/app"},
+	}
+	if len(mock.execCalls) != len(want) {
+		t.Fatalf("got %d exec calls, want %d", len(mock.execCalls), len(want))
+	}
+	for i, call := range mock.execCalls {
+		if !reflect.DeepEqual(call.cmd, want[i]) {
+			t.Errorf("call %d = %v, want %v", i, call.cmd, want[i])
+		}
+	}
+}
@@ -1,9 +1,6 @@
 package k8s
 
 import (
-        "context"
-        "errors"
-        "fmt"
         "reflect"
         "testing"
 
@@ -150,118 +147,3 @@ func TestParseTolerations(t *testing.T) {
                 })
         }
 }
-
-func TestListFilesFindStatNotFound(t *testing.T) {
-	exitErr := fmt.Errorf("command terminated with exit code 127")
-	findPrintOut := "/data/\n/data/file.txt\n/data/subdir\n"
-
-	mock := &mockPodExecutor{}
-	mock.pushExec("", "stat: not found", exitErr)
-	mock.pushExec(findPrintOut, "", nil)
-	c := newMockClient(mock)
-
-	files, err := c.listFilesFind(context.Background(), "ns", "pod", "ctr", "/data", "")
-	if err != nil {
-		t.Fatalf("expected success after fallback, got error: %v", err)
-	}
-	if len(files) == 0 {
-		t.Error("expected files from find -print fallback, got none")
-	}
-	names := make(map[string]bool)
-	for _, f := range files {
-		names[f.Name] = true
-	}
-	if !names["file.txt"] {
-		t.Errorf("expected file.txt in results; got %v", files)
-	}
-}
-
-func TestListFilesFindStatInvalidOption(t *testing.T) {
-	exitErr := fmt.Errorf("command terminated with exit code 1")
-	findPrintOut := "/data/\n/data/important.log\n"
-
-	mock := &mockPodExecutor{}
-	mock.pushExec("", "stat: invalid option -- 'c'", exitErr)
-	mock.pushExec(findPrintOut, "", nil)
-	c := newMockClient(mock)
-
-	files, err := c.listFilesFind(context.Background(), "ns", "pod", "ctr", "/data", "")
-	if err != nil {
-		t.Fatalf("expected success after fallback for invalid option, got: %v", err)
-	}
-	found := false
-	for _, f := range files {
-		if f.Name == "important.log" {
-			found = true
-		}
-	}
-	if !found {
-		t.Errorf("expected important.log in fallback results; got %v", files)
-	}
-}
-
-func TestListFilesFindUnsupportedExec(t *testing.T) {
-	exitErr := fmt.Errorf("command terminated with exit code 1")
-	findPrintOut := "/data/\n/data/config.yaml\n"
-
-	mock := &mockPodExecutor{}
-	mock.pushExec("", "find: unrecognized: -exec", exitErr)
-	mock.pushExec(findPrintOut, "", nil)
-	c := newMockClient(mock)
-
-	files, err := c.listFilesFind(context.Background(), "ns", "pod", "ctr", "/data", "")
-	if err != nil {
-		t.Fatalf("expected success after fallback for unrecognized exec, got: %v", err)
-	}
-	found := false
-	for _, f := range files {
-		if f.Name == "config.yaml" {
-			found = true
-		}
-	}
-	if !found {
-		t.Errorf("expected config.yaml in fallback results; got %v", files)
-	}
-}
-
-func TestListFilesFindPathNotFoundNoFallback(t *testing.T) {
-	exitErr := fmt.Errorf("command terminated with exit code 1")
-
-	mock := &mockPodExecutor{}
-	mock.pushExec("", "find: /nonexistent: No such file or directory", exitErr)
-	c := newMockClient(mock)
-
-	_, err := c.listFilesFind(context.Background(), "ns", "pod", "ctr", "/data", "/nonexistent")
-	if err == nil {
-		t.Fatal("expected error for path not found, got nil")
-	}
-	var k8sErr *K8sError
-	if !errors.As(err, &k8sErr) {
-		t.Fatalf("expected *K8sError, got %T: %v", err, err)
-	}
-	if k8sErr.Kind != ErrKindPathNotFound {
-		t.Errorf("expected PathNotFound kind, got %q", k8sErr.Kind)
-	}
-	if len(mock.execCalls) != 1 {
-		t.Errorf("expected exactly 1 exec call (no fallback), got %d", len(mock.execCalls))
-	}
-}
-
-func TestListFilesFindStatSucceeds(t *testing.T) {
-	statOut := "/data//file.txt|1024|1705314600|regular file\n/data//subdir|4096|1705314600|directory\n"
-
-	mock := &mockPodExecutor{}
-	mock.pushExec(statOut, "", nil)
-	c := newMockClient(mock)
-
-	files, err := c.listFilesFind(context.Background(), "ns", "pod", "ctr", "/data", "")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if len(files) != 2 {
-		t.Fatalf("expected 2 files, got %d: %v", len(files), files)
-	}
-	if len(mock.execCalls) != 1 {
-		t.Errorf("expected exactly 1 exec call when stat succeeds, got %d", len(mock.execCalls))
-	}
-}
@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParseImagePullSecrets checks a comma-separated list of Secret names, as
+// KUBE_BROWSER_IMAGE_PULL_SECRET and the connect dialog take it. Each must
+// be a valid object name; duplicates are dropped.
+func ParseImagePullSecrets(s string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid image pull secret %q: %s", name, strings.Join(errs, "; "))
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// SetImagePullSecrets makes the pods this connection creates pull their
+// image with the named Secrets, e.g. the credentials of a private mirror
+// set with SetRegistryMirror. "" falls back to
+// KUBE_BROWSER_IMAGE_PULL_SECRET.
+func (c *Client) SetImagePullSecrets(names string) error {
+	parsed, err := ParseImagePullSecrets(names)
+	if err != nil {
+		return err
+	}
+	c.pullSecrets = parsed
+	return nil
+}
+
+// ImagePullSecrets returns the Secrets helper pods are pulled with: the
+// connection's, or those of KUBE_BROWSER_IMAGE_PULL_SECRET. An invalid
+// environment setting is ignored, as the API would refuse every pod.
+func (c *Client) ImagePullSecrets() []string {
+	if len(c.pullSecrets) > 0 {
+		return c.pullSecrets
+	}
+	names, err := ParseImagePullSecrets(os.Getenv("KUBE_BROWSER_IMAGE_PULL_SECRET"))
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+func (c *Client) pullSecretRefs() []corev1.LocalObjectReference {
+	var refs []corev1.LocalObjectReference
+	for _, name := range c.ImagePullSecrets() {
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+	return refs
+}
+
+// checkPullSecrets reports whether the pull Secrets exist in namespace. A
+// Secret is namespaced, and the kubelet pulls without one it cannot find,
+// so a missing one only shows as an image pull failure later.
+func (c *Client) checkPullSecrets(ctx context.Context, r *DoctorReport, namespace string) {
+	names := c.ImagePullSecrets()
+	if len(names) == 0 {
+		return
+	}
+	var missing []string
+	for _, name := range names {
+		_, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			missing = append(missing, name)
+		case apierrors.IsForbidden(err):
+			r.Add("Image pull secrets", CheckSkip, "cannot read secrets in %s to check %s", namespace, strings.Join(names, ", "))
+			return
+		case err != nil:
+			r.Add("Image pull secrets", CheckWarn, "could not check %s: %v", name, err)
+			return
+		}
+	}
+	if len(missing) > 0 {
+		r.Add("Image pull secrets", CheckWarn, "%s not found in %s; create them there or the helper image is pulled without credentials", strings.Join(missing, ", "), namespace)
+		return
+	}
+	r.Add("Image pull secrets", CheckPass, "%s present in %s", strings.Join(names, ", "), namespace)
+}
@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// A claim KubeBrowser creates (a clone, a restored snapshot, a migration
+// target) is not usable until it is Bound. With a slow provisioner, or a
+// class that waits for the first consumer, that can take minutes, so the
+// claims are watched and the UI is told when they get there.
+
+// Outcomes of watching a claim, in PVCBinding.Phase besides the claim's
+// own phases (Bound, Lost).
+const (
+	PVCPhaseDeleted  = "Deleted"
+	PVCPhaseTimedOut = "TimedOut"
+)
+
+// PVCBinding tells how waiting for a claim to be provisioned ended.
+type PVCBinding struct {
+	Context      string `json:"context,omitempty"`
+	Namespace    string `json:"namespace"`
+	PVC          string `json:"pvc"`
+	Phase        string `json:"phase"`
+	Volume       string `json:"volume,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+	// WaitForFirstConsumer is set when the class only provisions once a
+	// pod uses the claim.
+	WaitForFirstConsumer bool      `json:"waitForFirstConsumer,omitempty"`
+	Created              time.Time `json:"created"`
+	Finished             time.Time `json:"finished"`
+}
+
+// Bound reports whether the claim was provisioned.
+func (b *PVCBinding) Bound() bool {
+	return b.Phase == string(corev1.ClaimBound)
+}
+
+// SetClaimCreated makes the client call fn with each claim it creates. fn
+// is called from the request or job that created it and must not block.
+func (c *Client) SetClaimCreated(fn func(namespace, pvc string)) {
+	c.claimCreated = fn
+}
+
+func (c *Client) noteClaimCreated(namespace, pvc string) {
+	if c.claimCreated != nil {
+		c.claimCreated(namespace, pvc)
+	}
+}
+
+// WaitForBound watches a claim until it is Bound or Lost, is deleted, or
+// ctx is done, which ends the wait with PVCPhaseTimedOut. Errors are only
+// returned when the claim cannot be read or watched at all.
+func (c *Client) WaitForBound(ctx context.Context, namespace, name string) (*PVCBinding, error) {
+	pvcs := c.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	pvc, err := pvcs.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return c.pvcBinding(ctx, namespace, name, nil, PVCPhaseDeleted), nil
+		}
+		return nil, classifyApiError(err)
+	}
+	for {
+		if done, phase := pvcSettled(pvc); done {
+			return c.pvcBinding(ctx, namespace, name, pvc, phase), nil
+		}
+		w, err := pvcs.Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+			ResourceVersion: pvc.ResourceVersion,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return c.pvcBinding(ctx, namespace, name, pvc, PVCPhaseTimedOut), nil
+			}
+			return nil, classifyApiError(err)
+		}
+		deleted, err := watchClaim(ctx, w, &pvc)
+		w.Stop()
+		switch {
+		case deleted:
+			return c.pvcBinding(ctx, namespace, name, pvc, PVCPhaseDeleted), nil
+		case ctx.Err() != nil:
+			return c.pvcBinding(ctx, namespace, name, pvc, PVCPhaseTimedOut), nil
+		case err != nil:
+			// The watch expired (410 Gone): start over from a fresh read.
+			if pvc, err = pvcs.Get(ctx, name, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+				return c.pvcBinding(ctx, namespace, name, nil, PVCPhaseDeleted), nil
+			} else if err != nil {
+				return nil, classifyApiError(err)
+			}
+		}
+	}
+}
+
+// watchClaim follows w until the claim settles, is deleted, the watch
+// closes or fails, or ctx is done, keeping *pvc up to date.
+func watchClaim(ctx context.Context, w watch.Interface, pvc **corev1.PersistentVolumeClaim) (deleted bool, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			switch ev.Type {
+			case watch.Deleted:
+				return true, nil
+			case watch.Error:
+				return false, apierrors.FromObject(ev.Object)
+			}
+			if p, ok := ev.Object.(*corev1.PersistentVolumeClaim); ok {
+				*pvc = p
+				if done, _ := pvcSettled(p); done {
+					return false, nil
+				}
+			}
+		}
+	}
+}
+
+// pvcSettled reports whether the claim left Pending for good.
+func pvcSettled(pvc *corev1.PersistentVolumeClaim) (bool, string) {
+	switch pvc.Status.Phase {
+	case corev1.ClaimBound, corev1.ClaimLost:
+		return true, string(pvc.Status.Phase)
+	}
+	return false, ""
+}
+
+func (c *Client) pvcBinding(ctx context.Context, namespace, name string, pvc *corev1.PersistentVolumeClaim, phase string) *PVCBinding {
+	b := &PVCBinding{Context: c.ContextName, Namespace: namespace, PVC: name, Phase: phase, Finished: time.Now()}
+	if pvc == nil {
+		return b
+	}
+	b.Volume = pvc.Spec.VolumeName
+	b.Created = pvc.CreationTimestamp.Time
+	if pvc.Spec.StorageClassName != nil {
+		b.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if b.StorageClass != "" {
+		// The binding mode only explains a long wait; reading it is not
+		// worth failing over.
+		readCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if sc, err := c.clientset.StorageV1().StorageClasses().Get(readCtx, b.StorageClass, metav1.GetOptions{}); err == nil {
+			b.WaitForFirstConsumer = sc.VolumeBindingMode != nil && *sc.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer
+		}
+	}
+	return b
+}
+
+// String describes the outcome for logs and notifications.
+func (b *PVCBinding) String() string {
+	switch b.Phase {
+	case string(corev1.ClaimBound):
+		return fmt.Sprintf("PVC %s/%s is bound to %s", b.Namespace, b.PVC, b.Volume)
+	case string(corev1.ClaimLost):
+		return fmt.Sprintf("PVC %s/%s lost its volume %s", b.Namespace, b.PVC, b.Volume)
+	case PVCPhaseDeleted:
+		return fmt.Sprintf("PVC %s/%s was deleted before it was bound", b.Namespace, b.PVC)
+	}
+	msg := fmt.Sprintf("PVC %s/%s is still pending", b.Namespace, b.PVC)
+	if b.WaitForFirstConsumer {
+		msg += "; its storage class waits for a pod to use it"
+	}
+	return msg
+}
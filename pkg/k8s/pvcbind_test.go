@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWaitForBound(t *testing.T) {
+	class := "local-path"
+	mode := storagev1.VolumeBindingWaitForFirstConsumer
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-clone", Namespace: "apps"},
+		Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &class},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+	}
+	cs := fake.NewSimpleClientset(pvc, &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: class}, VolumeBindingMode: &mode})
+	fw := watch.NewFake()
+	cs.PrependWatchReactor("persistentvolumeclaims", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, fw, nil
+	})
+	c := &Client{clientset: cs, ContextName: "prod"}
+
+	go func() {
+		still := pvc.DeepCopy()
+		fw.Modify(still)
+		bound := pvc.DeepCopy()
+		bound.Spec.VolumeName = "pvc-123"
+		bound.Status.Phase = corev1.ClaimBound
+		fw.Modify(bound)
+	}()
+	b, err := c.WaitForBound(context.Background(), "apps", "data-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Bound() || b.Volume != "pvc-123" || !b.WaitForFirstConsumer || b.Context != "prod" {
+		t.Errorf("unexpected binding %+v", b)
+	}
+
+	// A claim deleted while pending, or still pending when ctx ends, is
+	// reported as such.
+	fw = watch.NewFake()
+	go fw.Delete(pvc.DeepCopy())
+	if b, err := c.WaitForBound(context.Background(), "apps", "data-clone"); err != nil || b.Phase != PVCPhaseDeleted {
+		t.Errorf("expected the claim to be reported deleted, got %+v, %v", b, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cs.PrependReactor("get", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, pvc, nil
+	})
+	if b, err := c.WaitForBound(ctx, "apps", "data-clone"); err != nil || b.Phase != PVCPhaseTimedOut {
+		t.Errorf("expected the wait to time out, got %+v, %v", b, err)
+	}
+}
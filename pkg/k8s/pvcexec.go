@@ -0,0 +1,204 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const helperMountPath = "/data"
+
+// shouldRetryInHelper reports whether a failed direct exec is worth
+// repeating in a helper pod. Only missing tools and permission problems in
+// the app container are fixed by switching to the helper image; RBAC,
+// timeouts and missing paths would fail there too.
+func shouldRetryInHelper(err *K8sError) bool {
+	return err.Kind == ErrKindNoShell || err.Kind == ErrKindPermDenied
+}
+
+// execOnPVC runs the command produced by build, first in the pod that
+// already mounts the PVC and then, if the container lacks the tools, in a
+// helper pod. build receives the mount path of the PVC in whichever pod the
+// command ends up running in.
+func (c *Client) execOnPVC(ctx context.Context, namespace, pvcName string, build func(mountPath string) []string) (string, string, error) {
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return "", "", err
+	}
+	return c.execOnPod(ctx, namespace, pvcName, info, build)
+}
+
+// execOnPod is execOnPVC once the pod mounting the PVC is known. The
+// strategies allowed in the namespace are tried in turn; see withAccess.
+func (c *Client) execOnPod(ctx context.Context, namespace, pvcName string, info *podPVCInfo, build func(mountPath string) []string) (string, string, error) {
+	ex := c.getExecutor()
+	var stdout, stderr string
+	err := c.withAccess(ctx, namespace, pvcName, info, func(ctx context.Context, t accessTarget) (bool, error) {
+		var err error
+		stdout, stderr, err = ex.execInPod(ctx, namespace, t.pod, t.container, build(t.mountPath))
+		if err == nil {
+			return false, nil
+		}
+		kerr := classifyExecError(err, stderr)
+		if t.strategy != StrategyExec {
+			return false, kerr
+		}
+		if info.windows {
+			return false, windowsExecError(info, kerr)
+		}
+		// Output means the tools ran; a permission error on part of the
+		// tree (e.g. find hitting an unreadable directory) is not fixed by
+		// a helper.
+		if !shouldRetryInHelper(kerr) || stdout != "" {
+			return false, kerr
+		}
+		log.Printf("Direct exec on PVC %s failed (%s), trying the next access strategy", pvcName, kerr.Kind)
+		return true, kerr
+	})
+	return stdout, stderr, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// streamOnPVC is the streaming counterpart of execOnPVC: stdin (optional)
+// is fed to the command and its stdout is copied to stdout as it arrives.
+// The helper pod fallback is only attempted while nothing has been read
+// from stdin or written to stdout, so a partially transferred stream is
+// never silently restarted.
+func (c *Client) streamOnPVC(ctx context.Context, namespace, pvcName string, build func(mountPath string) []string, stdin io.Reader, stdout io.Writer) error {
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	return c.streamOnPod(ctx, namespace, pvcName, info, build, stdin, stdout)
+}
+
+// streamOnPod is streamOnPVC once the pod mounting the PVC is known.
+func (c *Client) streamOnPod(ctx context.Context, namespace, pvcName string, info *podPVCInfo, build func(mountPath string) []string, stdin io.Reader, stdout io.Writer) error {
+	var in *countingReader
+	var inReader io.Reader
+	if stdin != nil {
+		in = &countingReader{r: stdin}
+		inReader = in
+	}
+	out := &countingWriter{w: stdout}
+
+	ex := c.getExecutor()
+	return c.withAccess(ctx, namespace, pvcName, info, func(ctx context.Context, t accessTarget) (bool, error) {
+		stderr, err := ex.execInPodStream(ctx, namespace, t.pod, t.container, build(t.mountPath), inReader, out)
+		if err == nil {
+			return false, nil
+		}
+		kerr := classifyExecError(err, stderr)
+		if t.strategy != StrategyExec {
+			return false, streamError(kerr, stderr)
+		}
+		if info.windows {
+			return false, streamError(windowsExecError(info, kerr), stderr)
+		}
+		consumed := out.n > 0 || (in != nil && in.n > 0)
+		if consumed || !shouldRetryInHelper(kerr) {
+			return false, streamError(kerr, stderr)
+		}
+		log.Printf("Direct stream on PVC %s failed (%s), trying the next access strategy", pvcName, kerr.Kind)
+		return true, kerr
+	})
+}
+
+func streamError(err *K8sError, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if err.Kind == ErrKindUnknown && stderr != "" {
+		return &K8sError{Kind: err.Kind, Message: fmt.Sprintf("%s: %s", err.Message, stderr), Cause: err.Cause}
+	}
+	return err
+}
+
+// pvcPath joins a path relative to the PVC root onto mountPath.
+func pvcPath(mountPath, p string) string {
+	p = strings.TrimPrefix(strings.ReplaceAll(p, "\\", "/"), "/")
+	if p == "" {
+		return mountPath
+	}
+	return strings.TrimSuffix(mountPath, "/") + "/" + p
+}
+
+// relativePVCPath turns a sanitized PVC path ("/a/b") into the form tar
+// expects relative to the mount root ("a/b", or "." for the root).
+func relativePVCPath(p string) string {
+	p = strings.Trim(strings.ReplaceAll(p, "\\", "/"), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// RemoveFile deletes a single file from the PVC. It is used to discard
+// uploads that were rejected after they had already been written.
+func (c *Client) RemoveFile(ctx context.Context, namespace, pvcName, filePath string) error {
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	if info.windows {
+		return c.removeFileWindows(ctx, namespace, info, filePath)
+	}
+	_, stderr, err := c.execOnPod(ctx, namespace, pvcName, info, func(mountPath string) []string {
+		return []string{"rm", "-f", "--", pvcPath(mountPath, filePath)}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return streamError(ke, stderr)
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadFileHead returns at most limit bytes from the start of a file on the
+// PVC, and whether the file was longer than that. It is meant for previews,
+// which must not pull a whole multi-gigabyte file through the API server.
+func (c *Client) ReadFileHead(ctx context.Context, namespace, pvcName, filePath string, limit int) ([]byte, bool, error) {
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, false, err
+	}
+	if info.windows {
+		return c.readFileHeadWindows(ctx, namespace, info, filePath, limit)
+	}
+	stdout, stderr, err := c.execOnPod(ctx, namespace, pvcName, info, func(mountPath string) []string {
+		return []string{"head", "-c", strconv.Itoa(limit + 1), "--", pvcPath(mountPath, filePath)}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, false, streamError(ke, stderr)
+		}
+		return nil, false, err
+	}
+	if len(stdout) > limit {
+		return []byte(stdout[:limit]), true, nil
+	}
+	return []byte(stdout), false, nil
+}
@@ -0,0 +1,274 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fitHelperToNamespace checks a helper pod against the namespace's
+// LimitRanges and ResourceQuotas before it is created. Requests and limits
+// outside a LimitRange are moved into it, instead of the API rejecting the
+// pod; a quota the pod would exceed fails with ErrKindQuotaExceeded naming
+// it, instead of a generic failure once the startup timeout runs out.
+// Where KubeBrowser may not list them, the pod is created as it is.
+func (c *Client) fitHelperToNamespace(ctx context.Context, namespace string, spec *corev1.PodSpec) error {
+	core := c.clientset.CoreV1()
+	var ranges []corev1.LimitRange
+	if list, err := core.LimitRanges(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+		ranges = list.Items
+	} else if !apierrors.IsForbidden(err) {
+		log.Printf("Could not list LimitRanges in %s: %v", namespace, err)
+	}
+
+	quotas, err := core.ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err == nil {
+		requireQuotaResources(quotas.Items, ranges, spec)
+	}
+	for i := range spec.Containers {
+		fitLimitRanges(ranges, &spec.Containers[i].Resources)
+	}
+	if err != nil {
+		if !apierrors.IsForbidden(err) {
+			log.Printf("Could not list ResourceQuotas in %s: %v", namespace, err)
+		}
+		return nil
+	}
+	if kerr := checkQuotas(quotas.Items, podQuotaUsage(spec), spec.ActiveDeadlineSeconds != nil); kerr != nil {
+		return kerr
+	}
+	return nil
+}
+
+// requireQuotaResources gives the containers of spec an ephemeral storage
+// request and limit where a quota covering the helper tracks them: the API
+// rejects a pod that leaves out a resource its namespace's quota tracks,
+// unless a LimitRange supplies a default.
+func requireQuotaResources(quotas []corev1.ResourceQuota, ranges []corev1.LimitRange, spec *corev1.PodSpec) {
+	const storage = corev1.ResourceEphemeralStorage
+	var needRequest, needLimit bool
+	for _, quota := range quotas {
+		if !quotaCoversHelper(quota.Spec, spec.ActiveDeadlineSeconds != nil) {
+			continue
+		}
+		for name := range quota.Spec.Hard {
+			switch name {
+			case storage, "requests." + storage:
+				needRequest = true
+			case "limits." + storage:
+				// A limit alone would make the request default to it.
+				needRequest, needLimit = true, true
+			}
+		}
+	}
+	for _, lr := range ranges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			if _, ok := item.Default[storage]; ok {
+				needRequest, needLimit = false, false
+			}
+			if _, ok := item.DefaultRequest[storage]; ok {
+				needRequest = false
+			}
+		}
+	}
+	for i := range spec.Containers {
+		res := &spec.Containers[i].Resources
+		if _, ok := res.Requests[storage]; needRequest && !ok {
+			if res.Requests == nil {
+				res.Requests = corev1.ResourceList{}
+			}
+			res.Requests[storage] = parseQuantityWithDefault("HELPER_EPHEMERAL_STORAGE_REQUEST", helperEphemeralRequestDefault)
+			log.Printf("Helper pod ephemeral-storage request set to %s for a ResourceQuota that tracks it", res.Requests.StorageEphemeral().String())
+		}
+		if _, ok := res.Limits[storage]; needLimit && !ok {
+			if res.Limits == nil {
+				res.Limits = corev1.ResourceList{}
+			}
+			res.Limits[storage] = parseQuantityWithDefault("HELPER_EPHEMERAL_STORAGE_LIMIT", helperEphemeralLimitDefault)
+		}
+	}
+}
+
+// quotaRejection explains a pod the API refused because of a quota that
+// fitHelperToNamespace could not see or match, such as one scoped to a
+// priority class. It answers 403 like a missing permission, so without
+// this it would read as an RBAC problem. It returns nil for other errors.
+func quotaRejection(err error) *K8sError {
+	const marker = "exceeded quota: "
+	msg := err.Error()
+	i := strings.Index(msg, marker)
+	if !apierrors.IsForbidden(err) || i < 0 {
+		return nil
+	}
+	return &K8sError{Kind: ErrKindQuotaExceeded, Message: "quota exceeded: " + msg[i+len(marker):], Cause: err}
+}
+
+// priorityClassRejection explains a pod refused because the priority class
+// it names does not exist. The API answers 403 for it, which would
+// otherwise read as a missing permission. It returns nil for other errors.
+func priorityClassRejection(err error, class string) *K8sError {
+	if class == "" || !apierrors.IsForbidden(err) || !strings.Contains(err.Error(), "no PriorityClass with name") {
+		return nil
+	}
+	return &K8sError{
+		Kind:    ErrKindUnknown,
+		Message: fmt.Sprintf("The helper pod was refused: PriorityClass %q, set by KUBE_BROWSER_PRIORITY_CLASS, does not exist in the cluster.", class),
+		Cause:   err,
+	}
+}
+
+// fitLimitRanges moves the CPU and memory of res into the bounds of every
+// Container or Pod limit in ranges: above Max is lowered to it, below Min
+// raised to it, and a request too small for MaxLimitRequestRatio raised.
+// A helper has one container, so Pod limits bound it the same way.
+func fitLimitRanges(ranges []corev1.LimitRange, res *corev1.ResourceRequirements) {
+	for _, lr := range ranges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer && item.Type != corev1.LimitTypePod {
+				continue
+			}
+			for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				req, hasReq := res.Requests[name]
+				lim, hasLim := res.Limits[name]
+				if max, ok := item.Max[name]; ok {
+					if hasLim && lim.Cmp(max) > 0 {
+						lim = max.DeepCopy()
+					}
+					if hasReq && req.Cmp(max) > 0 {
+						req = max.DeepCopy()
+					}
+				}
+				if min, ok := item.Min[name]; ok {
+					if hasReq && req.Cmp(min) < 0 {
+						req = min.DeepCopy()
+					}
+					if hasLim && lim.Cmp(min) < 0 {
+						lim = min.DeepCopy()
+					}
+				}
+				if ratio, ok := item.MaxLimitRequestRatio[name]; ok && hasReq && hasLim && ratio.MilliValue() > 0 {
+					least := (lim.MilliValue()*1000 + ratio.MilliValue() - 1) / ratio.MilliValue()
+					if req.MilliValue() < least {
+						req = *resource.NewMilliQuantity(least, req.Format)
+					}
+				}
+				if hasReq && hasLim && req.Cmp(lim) > 0 {
+					req = lim.DeepCopy()
+				}
+				if was := res.Requests[name]; hasReq && req.Cmp(was) != 0 {
+					log.Printf("Helper pod %s request adjusted from %s to %s to fit LimitRange %s/%s", name, was.String(), req.String(), lr.Namespace, lr.Name)
+					res.Requests[name] = req
+				}
+				if was := res.Limits[name]; hasLim && lim.Cmp(was) != 0 {
+					log.Printf("Helper pod %s limit adjusted from %s to %s to fit LimitRange %s/%s", name, was.String(), lim.String(), lr.Namespace, lr.Name)
+					res.Limits[name] = lim
+				}
+			}
+		}
+	}
+}
+
+// podQuotaUsage is what a pod adds to the resources a ResourceQuota
+// tracks: itself, and its containers' requests and limits.
+func podQuotaUsage(spec *corev1.PodSpec) corev1.ResourceList {
+	usage := corev1.ResourceList{
+		corev1.ResourcePods:               resource.MustParse("1"),
+		corev1.ResourceName("count/pods"): resource.MustParse("1"),
+	}
+	add := func(name corev1.ResourceName, q resource.Quantity) {
+		sum := usage[name]
+		sum.Add(q)
+		usage[name] = sum
+	}
+	for _, container := range spec.Containers {
+		for name, q := range container.Resources.Requests {
+			add("requests."+name, q)
+			if name == corev1.ResourceCPU || name == corev1.ResourceMemory {
+				// Quotas on plain cpu and memory count requests.
+				add(name, q)
+			}
+		}
+		for name, q := range container.Resources.Limits {
+			add("limits."+name, q)
+		}
+	}
+	return usage
+}
+
+// checkQuotas reports the first quota that usage would take past its hard
+// limit, counting only quotas whose scopes cover the pod. terminating is
+// whether the pod has activeDeadlineSeconds.
+func checkQuotas(quotas []corev1.ResourceQuota, usage corev1.ResourceList, terminating bool) *K8sError {
+	for _, quota := range quotas {
+		if !quotaCoversHelper(quota.Spec, terminating) {
+			continue
+		}
+		hard := quota.Status.Hard
+		if len(hard) == 0 {
+			hard = quota.Spec.Hard
+		}
+		for name, limit := range hard {
+			need, ok := usage[name]
+			if !ok {
+				continue
+			}
+			used := quota.Status.Used[name]
+			total := used.DeepCopy()
+			total.Add(need)
+			if total.Cmp(limit) <= 0 {
+				continue
+			}
+			msg := fmt.Sprintf("quota exceeded: %s %s/%s (ResourceQuota %s in %s). ", name, used.String(), limit.String(), quota.Name, quota.Namespace)
+			if name == corev1.ResourcePods || name == "count/pods" {
+				msg += "The helper pod cannot be created until other pods finish or the quota is raised."
+			} else {
+				msg += fmt.Sprintf("The helper pod needs %s more; free some up, raise the quota or lower the HELPER_*_REQUEST and HELPER_*_LIMIT values.", need.String())
+			}
+			return &K8sError{Kind: ErrKindQuotaExceeded, Message: msg}
+		}
+	}
+	return nil
+}
+
+// quotaCoversHelper reports whether a quota with spec's scopes counts a
+// helper pod, which has requests and limits and no priority class of its
+// own choosing. A quota scoped in ways a helper cannot be matched against
+// is skipped; the API still enforces it when the pod is created.
+func quotaCoversHelper(spec corev1.ResourceQuotaSpec, terminating bool) bool {
+	scopes := append([]corev1.ResourceQuotaScope(nil), spec.Scopes...)
+	if spec.ScopeSelector != nil {
+		for _, expr := range spec.ScopeSelector.MatchExpressions {
+			switch expr.Operator {
+			case corev1.ScopeSelectorOpExists:
+				scopes = append(scopes, expr.ScopeName)
+			default:
+				return false
+			}
+		}
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case corev1.ResourceQuotaScopeTerminating:
+			if !terminating {
+				return false
+			}
+		case corev1.ResourceQuotaScopeNotTerminating:
+			if terminating {
+				return false
+			}
+		case corev1.ResourceQuotaScopeNotBestEffort:
+		default:
+			return false
+		}
+	}
+	return true
+}
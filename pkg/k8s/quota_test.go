@@ -0,0 +1,163 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestFitLimitRanges(t *testing.T) {
+	res := helperResourceRequirements()
+	ranges := []corev1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "team"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type: corev1.LimitTypeContainer,
+			Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m"), corev1.ResourceMemory: resource.MustParse("32Mi")},
+			Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("48Mi")},
+			// A limit at most twice the request.
+			MaxLimitRequestRatio: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+		}}},
+	}}
+	fitLimitRanges(ranges, &res)
+
+	for _, c := range []struct {
+		got  resource.Quantity
+		want string
+	}{
+		{res.Requests[corev1.ResourceCPU], "50m"},
+		{res.Limits[corev1.ResourceCPU], "100m"},
+		{res.Requests[corev1.ResourceMemory], "32Mi"},
+		{res.Limits[corev1.ResourceMemory], "48Mi"},
+	} {
+		if want := resource.MustParse(c.want); c.got.Cmp(want) != 0 {
+			t.Errorf("expected %s, got %s", c.want, c.got.String())
+		}
+	}
+}
+
+func TestCheckQuotas(t *testing.T) {
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Resources: helperResourceRequirements()}}}
+	quota := func(name string, hard, used corev1.ResourceList, scopes ...corev1.ResourceQuotaScope) corev1.ResourceQuota {
+		return corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team"},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard, Scopes: scopes},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+		}
+	}
+	pods := func(n string) corev1.ResourceList { return corev1.ResourceList{corev1.ResourcePods: resource.MustParse(n)} }
+
+	if err := checkQuotas([]corev1.ResourceQuota{quota("compute", pods("10"), pods("9"))}, podQuotaUsage(spec), false); err != nil {
+		t.Errorf("expected room for one more pod, got %v", err)
+	}
+	err := checkQuotas([]corev1.ResourceQuota{quota("compute", pods("10"), pods("10"))}, podQuotaUsage(spec), false)
+	if err == nil || err.Kind != ErrKindQuotaExceeded || !strings.HasPrefix(err.Message, "quota exceeded: pods 10/10 (ResourceQuota compute in team)") {
+		t.Errorf("expected the pods quota to be reported, got %v", err)
+	}
+
+	memory := quota("memory",
+		corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("1Gi")},
+		corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("1000Mi")})
+	if err := checkQuotas([]corev1.ResourceQuota{memory}, podQuotaUsage(spec), false); err == nil || !strings.Contains(err.Message, "limits.memory 1000Mi/1Gi") || !strings.Contains(err.Message, "needs 64Mi more") {
+		t.Errorf("expected the memory limit quota to be reported, got %v", err)
+	}
+
+	// Scoped to pods without a deadline, or to best-effort pods: not the helper.
+	full := []corev1.ResourceQuota{
+		quota("long-running", pods("1"), pods("1"), corev1.ResourceQuotaScopeNotTerminating),
+		quota("best-effort", pods("1"), pods("1"), corev1.ResourceQuotaScopeBestEffort),
+	}
+	if err := checkQuotas(full, podQuotaUsage(spec), true); err != nil {
+		t.Errorf("expected scoped quotas not to count the helper, got %v", err)
+	}
+	if err := checkQuotas(full, podQuotaUsage(spec), false); err == nil || !strings.Contains(err.Message, "long-running") {
+		t.Errorf("expected the NotTerminating quota to count a helper without a deadline, got %v", err)
+	}
+}
+
+func TestCreateHelperPodQuotaExceeded(t *testing.T) {
+	full := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "default"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")},
+			Used: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")},
+		},
+	}
+	client := fake.NewSimpleClientset(full)
+	c := &Client{clientset: client}
+	_, err := c.createHelperPod(context.Background(), "default", "my-pvc", "vol", "node1")
+	kerr, ok := err.(*K8sError)
+	if !ok || kerr.Kind != ErrKindQuotaExceeded || !strings.Contains(kerr.Message, "pods 10/10") {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if pods, _ := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{}); len(pods.Items) != 0 {
+		t.Errorf("expected no helper pod to be created, got %d", len(pods.Items))
+	}
+
+	// A quota the pre-check cannot match is still told from missing RBAC.
+	client = fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "helper",
+			fmt.Errorf("exceeded quota: high-priority, requested: pods=1, used: pods=2, limited: pods=2"))
+	})
+	c = &Client{clientset: client}
+	_, err = c.createHelperPod(context.Background(), "default", "my-pvc", "vol", "node1")
+	if kerr, ok := err.(*K8sError); !ok || kerr.Kind != ErrKindQuotaExceeded || kerr.Message != "quota exceeded: high-priority, requested: pods=1, used: pods=2, limited: pods=2" {
+		t.Errorf("expected the API's quota rejection to be reported as such, got %v", err)
+	}
+
+	// So is a priority class that does not exist.
+	t.Setenv("KUBE_BROWSER_PRIORITY_CLASS", "kube-browser-high")
+	client = fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "helper",
+			fmt.Errorf("no PriorityClass with name kube-browser-high was found"))
+	})
+	c = &Client{clientset: client}
+	_, err = c.createHelperPod(context.Background(), "default", "my-pvc", "vol", "node1")
+	if kerr, ok := err.(*K8sError); !ok || kerr.Kind == ErrKindRBAC || !strings.Contains(kerr.Message, `PriorityClass "kube-browser-high"`) {
+		t.Errorf("expected the missing priority class to be named, got %v", err)
+	}
+}
+
+func TestRequireQuotaResources(t *testing.T) {
+	quota := corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "storage", Namespace: "team"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"limits.ephemeral-storage": resource.MustParse("10Gi")}},
+	}
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Resources: helperResourceRequirements()}}}
+	if _, ok := spec.Containers[0].Resources.Limits[corev1.ResourceEphemeralStorage]; ok {
+		t.Fatal("expected no ephemeral storage by default")
+	}
+
+	requireQuotaResources([]corev1.ResourceQuota{quota}, nil, spec)
+	res := spec.Containers[0].Resources
+	if req, lim := res.Requests[corev1.ResourceEphemeralStorage], res.Limits[corev1.ResourceEphemeralStorage]; req.String() != "64Mi" || lim.String() != "1Gi" {
+		t.Errorf("expected the default ephemeral storage, got %s/%s", req.String(), lim.String())
+	}
+
+	// A LimitRange default is left to the API, and settings win.
+	spec = &corev1.PodSpec{Containers: []corev1.Container{{Resources: helperResourceRequirements()}}}
+	ranges := []corev1.LimitRange{{Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+		Type:    corev1.LimitTypeContainer,
+		Default: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("2Gi")},
+	}}}}}
+	requireQuotaResources([]corev1.ResourceQuota{quota}, ranges, spec)
+	if _, ok := spec.Containers[0].Resources.Limits[corev1.ResourceEphemeralStorage]; ok {
+		t.Error("expected the LimitRange default to be left to apply")
+	}
+	t.Setenv("HELPER_EPHEMERAL_STORAGE_LIMIT", "500Mi")
+	if lim := helperResourceRequirements().Limits[corev1.ResourceEphemeralStorage]; lim.String() != "500Mi" {
+		t.Errorf("expected the configured limit, got %s", lim.String())
+	}
+}
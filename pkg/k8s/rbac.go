@@ -0,0 +1,215 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// RBACOptions describes the ServiceAccount KubeBrowser runs as in-cluster
+// and what it must be allowed to do.
+type RBACOptions struct {
+	// Name is used for the ServiceAccount, role and binding.
+	Name string
+	// Namespace is where the ServiceAccount (and KubeBrowser) lives.
+	Namespace string
+	// TargetNamespaces limits PVC access to these namespaces with a Role
+	// per namespace. Empty means every namespace, via a ClusterRole.
+	TargetNamespaces []string
+	// HelperPods grants pod create/delete, needed for the helper pod
+	// fallback, and event listing to follow their startup. Without it,
+	// run KubeBrowser with --minimal.
+	HelperPods bool
+	// Migrations grants what the storage-class migration assistant needs:
+	// creating claims and Jobs, reading their logs and the workloads to
+	// patch, and listing storage classes.
+	Migrations bool
+	// Maintenance grants what maintenance mode needs: reading and scaling
+	// the Deployments and StatefulSets using a claim.
+	Maintenance bool
+	// Snapshots grants what browsing snapshots needs: reading
+	// VolumeSnapshots, and creating, watching and deleting the claims they
+	// are restored to.
+	Snapshots bool
+	// Clone grants what cloning a claim needs on top of HelperPods:
+	// creating the target claim, watching it until bound, and deleting it
+	// again if the copy fails.
+	Clone bool
+	// EphemeralContainers grants what the "ephemeral" access strategy
+	// needs: adding ephemeral containers to the pods mounting a claim.
+	EphemeralContainers bool
+}
+
+func (o RBACOptions) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if o.Namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	return nil
+}
+
+// pvcAccessRules are the permissions KubeBrowser needs in each namespace it
+// browses.
+func pvcAccessRules(opts RBACOptions) []rbacv1.PolicyRule {
+	podVerbs := []string{"get", "list"}
+	if opts.HelperPods {
+		podVerbs = append(podVerbs, "create", "delete")
+	}
+	pvcVerbs := []string{"get", "list"}
+	if opts.Migrations {
+		// Created claims are watched until bound (see WaitForBound).
+		pvcVerbs = addVerbs(pvcVerbs, "create", "watch")
+	}
+	if opts.Snapshots {
+		// Restored claims are deleted again when done (see ReleaseSnapshot).
+		pvcVerbs = addVerbs(pvcVerbs, "create", "watch", "delete")
+	}
+	if opts.Clone {
+		// A target claim is deleted if its copy fails (see ClonePVC).
+		pvcVerbs = addVerbs(pvcVerbs, "create", "watch", "delete")
+	}
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"persistentvolumeclaims"}, Verbs: pvcVerbs},
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: podVerbs},
+		{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create"}},
+	}
+	if opts.EphemeralContainers {
+		// See addDebugContainer.
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods/ephemeralcontainers"}, Verbs: []string{"update"}})
+	}
+	if opts.HelperPods {
+		// Followed while a helper pod starts (see HelperEvent).
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"list"}})
+		// Checked before a helper pod is created (see fitHelperToNamespace).
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"resourcequotas", "limitranges"}, Verbs: []string{"list"}})
+	}
+	if opts.Migrations {
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}},
+			rbacv1.PolicyRule{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: []string{"get", "create", "delete"}},
+			rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets", "daemonsets", "replicasets"}, Verbs: []string{"get"}},
+		)
+	}
+	if opts.Maintenance {
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}, Verbs: []string{"get", "list", "patch"}},
+			rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"replicasets"}, Verbs: []string{"get"}},
+		)
+	}
+	if opts.Snapshots {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{"snapshot.storage.k8s.io"}, Resources: []string{"volumesnapshots"}, Verbs: []string{"get", "list"}})
+	}
+	return rules
+}
+
+// addVerbs appends the verbs not already in verbs.
+func addVerbs(verbs []string, more ...string) []string {
+	for _, v := range more {
+		found := false
+		for _, have := range verbs {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			verbs = append(verbs, v)
+		}
+	}
+	return verbs
+}
+
+// namespaceListRule is always cluster-scoped: connecting lists namespaces.
+var namespaceListRule = rbacv1.PolicyRule{
+	APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"list"},
+}
+
+// RBACObjects returns the least-privilege ServiceAccount, roles and
+// bindings for opts.
+func RBACObjects(opts RBACOptions) ([]interface{}, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{"app.kubernetes.io/name": "kube-browser"}
+	subject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: opts.Name, Namespace: opts.Namespace}
+	typeMeta := func(kind string) metav1.TypeMeta {
+		return metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: kind}
+	}
+
+	objs := []interface{}{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Namespace: opts.Namespace, Labels: labels},
+		},
+	}
+
+	clusterRules := []rbacv1.PolicyRule{namespaceListRule}
+	if opts.Migrations || opts.Snapshots || opts.Clone {
+		// Migrations pick a target class; all read the binding mode of the
+		// claims they create (see WaitForBound).
+		clusterRules = append(clusterRules, rbacv1.PolicyRule{
+			APIGroups: []string{"storage.k8s.io"}, Resources: []string{"storageclasses"}, Verbs: []string{"get", "list"},
+		})
+	}
+	if len(opts.TargetNamespaces) == 0 {
+		clusterRules = append(clusterRules, pvcAccessRules(opts)...)
+	}
+	objs = append(objs,
+		&rbacv1.ClusterRole{
+			TypeMeta:   typeMeta("ClusterRole"),
+			ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Labels: labels},
+			Rules:      clusterRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   typeMeta("ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: opts.Name},
+			Subjects:   []rbacv1.Subject{subject},
+		},
+	)
+
+	for _, ns := range opts.TargetNamespaces {
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   typeMeta("Role"),
+				ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Namespace: ns, Labels: labels},
+				Rules:      pvcAccessRules(opts),
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   typeMeta("RoleBinding"),
+				ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Namespace: ns, Labels: labels},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: opts.Name},
+				Subjects:   []rbacv1.Subject{subject},
+			},
+		)
+	}
+	return objs, nil
+}
+
+// RBACManifests renders RBACObjects as a multi-document YAML stream that can
+// be piped to kubectl apply -f -.
+func RBACManifests(opts RBACOptions) ([]byte, error) {
+	objs, err := RBACObjects(opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func hasVerb(rules []rbacv1.PolicyRule, resource, verb string) bool {
+	for _, r := range rules {
+		for _, res := range r.Resources {
+			if res != resource {
+				continue
+			}
+			for _, v := range r.Verbs {
+				if v == verb {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestRBACObjectsClusterWide(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", HelperPods: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 3 {
+		t.Fatalf("expected ServiceAccount, ClusterRole and binding, got %d objects", len(objs))
+	}
+	role := objs[1].(*rbacv1.ClusterRole)
+	for _, want := range [][2]string{
+		{"namespaces", "list"},
+		{"persistentvolumeclaims", "list"},
+		{"pods/exec", "create"},
+		{"pods", "create"},
+		{"events", "list"},
+		{"pods", "delete"},
+	} {
+		if !hasVerb(role.Rules, want[0], want[1]) {
+			t.Errorf("ClusterRole is missing %s %s", want[1], want[0])
+		}
+	}
+	binding := objs[2].(*rbacv1.ClusterRoleBinding)
+	if s := binding.Subjects[0]; s.Name != "kb" || s.Namespace != "tools" {
+		t.Errorf("unexpected subject %+v", s)
+	}
+}
+
+func TestRBACObjectsScopedWithoutHelperPods(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", TargetNamespaces: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := objs[1].(*rbacv1.ClusterRole)
+	if len(cluster.Rules) != 1 || !hasVerb(cluster.Rules, "namespaces", "list") {
+		t.Errorf("scoped ClusterRole should only list namespaces, got %+v", cluster.Rules)
+	}
+
+	var roles []*rbacv1.Role
+	for _, obj := range objs {
+		if r, ok := obj.(*rbacv1.Role); ok {
+			roles = append(roles, r)
+		}
+	}
+	if len(roles) != 2 || roles[0].Namespace != "a" || roles[1].Namespace != "b" {
+		t.Fatalf("expected one Role per target namespace, got %d", len(roles))
+	}
+	if hasVerb(roles[0].Rules, "pods", "create") {
+		t.Error("pods create granted without helper pods")
+	}
+	if !hasVerb(roles[0].Rules, "pods/exec", "create") {
+		t.Error("pods/exec create missing")
+	}
+}
+
+func TestRBACObjectsWithMigrations(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", TargetNamespaces: []string{"a"}, Migrations: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster := objs[1].(*rbacv1.ClusterRole); !hasVerb(cluster.Rules, "storageclasses", "list") {
+		t.Error("ClusterRole is missing list storageclasses")
+	}
+	role := objs[3].(*rbacv1.Role)
+	for _, want := range [][2]string{
+		{"persistentvolumeclaims", "create"},
+		{"persistentvolumeclaims", "watch"},
+		{"jobs", "create"},
+		{"jobs", "delete"},
+		{"pods/log", "get"},
+		{"deployments", "get"},
+	} {
+		if !hasVerb(role.Rules, want[0], want[1]) {
+			t.Errorf("Role is missing %s %s", want[1], want[0])
+		}
+	}
+}
+
+func TestRBACObjectsWithMaintenance(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", Maintenance: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := objs[1].(*rbacv1.ClusterRole)
+	for _, want := range [][2]string{
+		{"deployments", "patch"},
+		{"statefulsets", "list"},
+		{"replicasets", "get"},
+	} {
+		if !hasVerb(cluster.Rules, want[0], want[1]) {
+			t.Errorf("ClusterRole is missing %s %s", want[1], want[0])
+		}
+	}
+}
+
+func TestRBACObjectsWithSnapshots(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", TargetNamespaces: []string{"a"}, Snapshots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster := objs[1].(*rbacv1.ClusterRole); !hasVerb(cluster.Rules, "storageclasses", "get") {
+		t.Error("ClusterRole is missing get storageclasses")
+	}
+	role := objs[3].(*rbacv1.Role)
+	for _, want := range [][2]string{
+		{"volumesnapshots", "get"},
+		{"volumesnapshots", "list"},
+		{"persistentvolumeclaims", "create"},
+		{"persistentvolumeclaims", "watch"},
+		{"persistentvolumeclaims", "delete"},
+	} {
+		if !hasVerb(role.Rules, want[0], want[1]) {
+			t.Errorf("Role is missing %s %s", want[1], want[0])
+		}
+	}
+
+	objs, _ = RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", TargetNamespaces: []string{"a"}})
+	if role := objs[3].(*rbacv1.Role); hasVerb(role.Rules, "persistentvolumeclaims", "delete") || hasVerb(role.Rules, "volumesnapshots", "list") {
+		t.Error("snapshot permissions granted without Snapshots")
+	}
+}
+
+func TestRBACObjectsWithClone(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", HelperPods: true, Clone: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := objs[1].(*rbacv1.ClusterRole)
+	for _, want := range [][2]string{
+		{"persistentvolumeclaims", "create"},
+		{"persistentvolumeclaims", "watch"},
+		{"persistentvolumeclaims", "delete"},
+		{"storageclasses", "get"},
+		{"pods", "create"},
+	} {
+		if !hasVerb(cluster.Rules, want[0], want[1]) {
+			t.Errorf("ClusterRole is missing %s %s", want[1], want[0])
+		}
+	}
+	for _, r := range cluster.Rules {
+		if len(r.Resources) == 1 && r.Resources[0] == "persistentvolumeclaims" && len(r.Verbs) != 5 {
+			t.Errorf("expected each claim verb once, got %v", r.Verbs)
+		}
+	}
+}
+
+func TestRBACObjectsWithEphemeralContainers(t *testing.T) {
+	objs, err := RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", TargetNamespaces: []string{"a"}, EphemeralContainers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := objs[3].(*rbacv1.Role)
+	if !hasVerb(role.Rules, "pods/ephemeralcontainers", "update") {
+		t.Error("Role is missing update pods/ephemeralcontainers")
+	}
+	if hasVerb(role.Rules, "pods", "create") {
+		t.Error("pods create granted for ephemeral containers alone")
+	}
+
+	objs, _ = RBACObjects(RBACOptions{Name: "kb", Namespace: "tools", TargetNamespaces: []string{"a"}, HelperPods: true})
+	if hasVerb(objs[3].(*rbacv1.Role).Rules, "pods/ephemeralcontainers", "update") {
+		t.Error("pods/ephemeralcontainers granted without EphemeralContainers")
+	}
+}
+
+func TestRBACManifests(t *testing.T) {
+	out, err := RBACManifests(RBACOptions{Name: "kb", Namespace: "tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := strings.Split(string(out), "---\n")
+	if len(docs) != 3 {
+		t.Fatalf("expected 3 YAML documents, got %d:\n%s", len(docs), out)
+	}
+	if !strings.Contains(docs[0], "kind: ServiceAccount") {
+		t.Errorf("first document is not the ServiceAccount:\n%s", docs[0])
+	}
+
+	if _, err := RBACManifests(RBACOptions{Name: "kb"}); err == nil {
+		t.Error("expected an error without a namespace")
+	}
+}
@@ -0,0 +1,167 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A network filesystem such as NFS can acknowledge a write that other
+// clients do not see yet, or ever: attribute caches, a server that lost
+// the write, a mount option that broke close-to-open consistency. A
+// read-after-write check reads files back through a helper pod on another
+// node than the pod that wrote them, whose cache knows nothing of the
+// write, and compares their checksums with what was sent.
+
+// readBackApp names the helper pods of read-after-write checks.
+const readBackApp = "kube-browser-verify"
+
+// readBackInterval is how long a check waits before reading a file that
+// did not match again.
+const readBackInterval = 2 * time.Second
+
+// ReadBackFile is one file of a read-after-write check: the checksum it
+// should have, and what was read back.
+type ReadBackFile struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Match    bool   `json:"match"`
+	Attempts int    `json:"attempts"`
+	// ConsistentAfterMS is how long after the first read the file
+	// matched, 0 when it matched at once.
+	ConsistentAfterMS int64  `json:"consistentAfterMs,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// ReadBackReport is the outcome of a read-after-write check.
+type ReadBackReport struct {
+	Algorithm string `json:"algorithm"`
+	// WriterNode runs the pod that mounts the claim, when one does, and
+	// Node the pod that read the files back.
+	WriterNode string         `json:"writerNode,omitempty"`
+	Node       string         `json:"node"`
+	Files      []ReadBackFile `json:"files"`
+}
+
+// Mismatched returns the files that did not read back as expected.
+func (r *ReadBackReport) Mismatched() []ReadBackFile {
+	var out []ReadBackFile
+	for _, f := range r.Files {
+		if !f.Match {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// sharedAccessModes let more than one node mount a claim.
+var sharedAccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany, corev1.ReadOnlyMany}
+
+// VerifyReadBack reads files of a claim back from a helper pod kept off
+// the node of the pod that mounts it, and compares their algo checksums
+// with those expected. A file that does not match, or cannot be read, is
+// read again every few seconds until wait has passed, since a cache on
+// the way may only be late. The claim must be mountable by several nodes.
+func (c *Client) VerifyReadBack(ctx context.Context, namespace, pvcName, algo string, files []ReadBackFile, wait time.Duration) (*ReadBackReport, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	if _, err := NewHash(algo); err != nil {
+		return nil, err
+	}
+	if c.helperDisabled || !c.allows(namespace, StrategyHelper) {
+		return nil, &K8sError{Kind: ErrKindHelperDisabled, Message: "A read-after-write check reads through a helper pod, and helper pods are not allowed here."}
+	}
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	shared := false
+	for _, mode := range pvc.Spec.AccessModes {
+		for _, m := range sharedAccessModes {
+			shared = shared || mode == m
+		}
+	}
+	if !shared {
+		return nil, fmt.Errorf("a read-after-write check needs a claim several nodes can mount, such as an NFS share; %s is %s", pvcName, pvcInfo(pvc).AccessModes)
+	}
+
+	report := &ReadBackReport{Algorithm: algo}
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	switch {
+	case err == nil:
+		report.WriterNode = info.nodeName
+	case !errors.Is(err, errNoMountingPod):
+		return nil, err
+	}
+
+	helper, err := c.createHelperPodWith(ctx, namespace, pvcName, "pvc-data", "", helperPodOptions{app: readBackApp, avoidNode: report.WriterNode})
+	if err != nil {
+		return nil, err
+	}
+	defer c.scheduleHelperDeletion(namespace, helper)
+	if p, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, helper, metav1.GetOptions{}); err == nil {
+		report.Node = p.Spec.NodeName
+	}
+	log.Printf("Reading %d file(s) of PVC %s back on node %s (written from %q)", len(files), pvcName, report.Node, report.WriterNode)
+
+	ex := c.getExecutor()
+	h, _ := NewHash(algo)
+	report.Files = checkReadBack(ctx, files, wait, readBackInterval, func(ctx context.Context, p string) (string, error) {
+		stdout, stderr, err := ex.execInPod(ctx, namespace, helper, "helper", []string{"sh", "-c", checksumFileScript, "sh", pvcPath(helperMountPath, p), algo})
+		if err != nil {
+			return "", streamError(classifyExecError(err, stderr), stderr)
+		}
+		sum, ok := parseChecksum(stdout, h.Size())
+		if !ok {
+			return "", fmt.Errorf("unexpected %ssum output: %q", algo, strings.TrimSpace(stdout))
+		}
+		return sum, nil
+	})
+	return report, nil
+}
+
+// checkReadBack reads the checksum of each file with sum until it matches
+// or wait has passed, trying those still pending every interval.
+func checkReadBack(ctx context.Context, files []ReadBackFile, wait, interval time.Duration, sum func(context.Context, string) (string, error)) []ReadBackFile {
+	out := append([]ReadBackFile{}, files...)
+	start := time.Now()
+	for {
+		pending := 0
+		for i := range out {
+			f := &out[i]
+			if f.Match {
+				continue
+			}
+			f.Attempts++
+			actual, err := sum(ctx, f.Path)
+			f.Actual, f.Error = actual, ""
+			if err != nil {
+				f.Error = err.Error()
+			}
+			if f.Match = err == nil && strings.EqualFold(actual, f.Expected); f.Match {
+				f.ConsistentAfterMS = time.Since(start).Milliseconds()
+				if f.Attempts == 1 {
+					f.ConsistentAfterMS = 0
+				}
+			} else {
+				pending++
+			}
+		}
+		if pending == 0 || time.Since(start)+interval > wait {
+			return out
+		}
+		select {
+		case <-ctx.Done():
+			return out
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckReadBack(t *testing.T) {
+	files := []ReadBackFile{
+		{Path: "/a", Expected: "aaa"},
+		{Path: "/late", Expected: "bbb"},
+		{Path: "/lost", Expected: "ccc"},
+	}
+	reads := map[string]int{}
+	sum := func(_ context.Context, p string) (string, error) {
+		reads[p]++
+		switch {
+		case p == "/a":
+			return "AAA", nil
+		case p == "/late" && reads[p] > 1:
+			return "bbb", nil
+		case p == "/late":
+			return "stale", nil
+		}
+		return "", errors.New("No such file or directory")
+	}
+
+	got := checkReadBack(context.Background(), files, 50*time.Millisecond, 10*time.Millisecond, sum)
+	if !got[0].Match || got[0].Attempts != 1 || got[0].ConsistentAfterMS != 0 {
+		t.Errorf("expected /a to match at once, got %+v", got[0])
+	}
+	if !got[1].Match || got[1].Attempts != 2 || got[1].ConsistentAfterMS == 0 {
+		t.Errorf("expected /late to match on the second read, got %+v", got[1])
+	}
+	if got[2].Match || got[2].Attempts < 3 || !strings.Contains(got[2].Error, "No such file") {
+		t.Errorf("expected /lost to be read until the wait ran out, got %+v", got[2])
+	}
+	if files[1].Attempts != 0 {
+		t.Error("expected the files passed in to be left alone")
+	}
+	report := &ReadBackReport{Files: got}
+	if bad := report.Mismatched(); len(bad) != 1 || bad[0].Path != "/lost" {
+		t.Errorf("unexpected mismatches %+v", bad)
+	}
+}
+
+func TestVerifyReadBackNeedsSharedClaim(t *testing.T) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pvc", Namespace: "default"},
+		Spec:       corev1.PersistentVolumeClaimSpec{AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}},
+	}
+	mock := &mockPodExecutor{}
+	c := &Client{clientset: fake.NewSimpleClientset(pvc, runningPodWithPVC("my-pvc")), executor: mock}
+
+	_, err := c.VerifyReadBack(context.Background(), "default", "my-pvc", "sha256", []ReadBackFile{{Path: "/a", Expected: "aaa"}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "several nodes") {
+		t.Fatalf("expected a ReadWriteOnce claim to be refused, got %v", err)
+	}
+	if mock.createCalled != 0 {
+		t.Error("expected no helper pod to be started")
+	}
+}
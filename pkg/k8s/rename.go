@@ -0,0 +1,47 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+)
+
+// renameScript moves $1 to $2, creating $2's parent directories. mv would
+// move into an existing directory or replace an existing file, so a taken
+// destination is refused instead.
+const renameScript = `if [ ! -e "$1" ] && [ ! -L "$1" ]; then echo "$1: No such file or directory" >&2; exit 1; fi
+if [ -e "$2" ] || [ -L "$2" ]; then echo "$2: File exists" >&2; exit 1; fi
+mkdir -p -- "$(dirname "$2")" && exec mv -- "$1" "$2"`
+
+// checkRename refuses renames mv would get wrong or that make no sense:
+// the root of the claim, a no-op, or moving a directory into itself.
+func checkRename(src, dst string) error {
+	from, to := relativePVCPath(src), relativePVCPath(dst)
+	switch {
+	case from == "." || to == ".":
+		return &K8sError{Kind: ErrKindUnknown, Message: "Cannot move the root of a PVC, or onto it."}
+	case from == to:
+		return &K8sError{Kind: ErrKindUnknown, Message: "Source and destination are the same path."}
+	case strings.HasPrefix(to, from+"/"):
+		return &K8sError{Kind: ErrKindUnknown, Message: "Cannot move a directory into itself."}
+	}
+	return nil
+}
+
+// Move renames src to dst within one PVC with mv, in the pod mounting it
+// or a helper pod. dst is the full new path, not a directory to move into;
+// it must not exist yet, and missing parent directories are created.
+func (c *Client) Move(ctx context.Context, namespace, pvcName, src, dst string) error {
+	if err := checkRename(src, dst); err != nil {
+		return err
+	}
+	_, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"sh", "-c", renameScript, "sh", pvcPath(mountPath, src), pvcPath(mountPath, dst)}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return streamError(ke, stderr)
+		}
+		return err
+	}
+	return nil
+}
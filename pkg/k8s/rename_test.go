@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMoveCommand(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "", nil)
+	c := newTransferClient(mock)
+
+	if err := c.Move(context.Background(), "default", "my-pvc", "/logs/a.log", "/archive/2024/a.log"); err != nil {
+		t.Fatal(err)
+	}
+	want := "sh -c " + renameScript + " sh /data/logs/a.log /data/archive/2024/a.log"
+	if got := strings.Join(mock.execCalls[0].cmd, " "); got != want {
+		t.Errorf("unexpected command %q", got)
+	}
+}
+
+func TestMoveRefusesInvalidRenames(t *testing.T) {
+	mock := &mockPodExecutor{}
+	c := newTransferClient(mock)
+
+	for _, tc := range [][2]string{
+		{"/", "/backup"},
+		{"/logs", "/"},
+		{"/logs", "/logs"},
+		{"/logs", "/logs/old"},
+	} {
+		if err := c.Move(context.Background(), "default", "my-pvc", tc[0], tc[1]); err == nil {
+			t.Errorf("expected moving %s to %s to be refused", tc[0], tc[1])
+		}
+	}
+	if len(mock.execCalls) != 0 {
+		t.Errorf("expected no exec, got %d", len(mock.execCalls))
+	}
+	// A sibling sharing the prefix is not inside the source.
+	if err := checkRename("/logs", "/logs-old"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMoveReportsExistingDestination(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "/data/b: File exists\n", errors.New("command terminated with exit code 1"))
+	c := newTransferClient(mock)
+
+	err := c.Move(context.Background(), "default", "my-pvc", "/a", "/b")
+	if err == nil || !strings.Contains(err.Error(), "File exists") {
+		t.Errorf("expected the conflict to be reported, got %v", err)
+	}
+}
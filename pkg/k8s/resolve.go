@@ -0,0 +1,195 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	gopath "path"
+	"strconv"
+	"strings"
+)
+
+// PathInfo describes a typed PVC path and where the UI should navigate to
+// show it. Access flags are evaluated as the user the exec runs as, which is
+// the same user every other KubeBrowser operation on this PVC uses.
+type PathInfo struct {
+	Path       string `json:"path"`
+	Exists     bool   `json:"exists"`
+	IsDir      bool   `json:"isDir"`
+	Readable   bool   `json:"readable"`
+	Writable   bool   `json:"writable"`
+	Executable bool   `json:"executable"`
+	Mode       string `json:"mode,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	// NavigatePath is the directory to open: the path itself for a
+	// directory, its parent for a file, and the nearest existing ancestor
+	// for a path that does not exist.
+	NavigatePath string `json:"navigatePath"`
+	FileName     string `json:"fileName,omitempty"`
+	// RealPath is where Path leads once symbolic links are followed, when
+	// that is somewhere else. NavigatePath and FileName are then based on
+	// it, so the UI shows the entry where it really is and a link to one
+	// of its own ancestors cannot nest forever.
+	RealPath string `json:"realPath,omitempty"`
+	// LinkTarget is set when Path itself is a symbolic link.
+	LinkTarget string `json:"linkTarget,omitempty"`
+}
+
+// resolvePathScript prints "dir"/"file", an rwx access triple, "mode owner
+// group size", the path and the mount root with symbolic links resolved,
+// and the path's own link target for an existing path; "broken" and the
+// target for a link that leads nowhere or loops; or "missing" followed by
+// the nearest existing ancestor directory (bounded by the mount root $2).
+const resolvePathScript = `p="$1"; root="$2"
+if [ -e "$p" ]; then
+  if [ -d "$p" ]; then echo dir; else echo file; fi
+  a=; [ -r "$p" ] && a=${a}r || a=${a}-; [ -w "$p" ] && a=${a}w || a=${a}-; [ -x "$p" ] && a=${a}x || a=${a}-
+  echo "$a"
+  stat -L -c '%a %U %G %s' -- "$p" 2>/dev/null || echo
+  readlink -f -- "$p" 2>/dev/null || echo
+  readlink -f -- "$root" 2>/dev/null || echo
+  if [ -L "$p" ]; then readlink -- "$p"; fi
+elif [ -L "$p" ]; then
+  echo broken
+  readlink -- "$p"
+else
+  echo missing
+  q="$p"
+  while [ "$q" != "$root" ] && [ ! -d "$q" ]; do q="${q%/*}"; [ -z "$q" ] && q="$root"; done
+  echo "$q"
+fi`
+
+// ResolvePath checks an arbitrary PVC path in a single exec and returns
+// normalized navigation info for it.
+func (c *Client) ResolvePath(ctx context.Context, namespace, pvcName, filePath string) (*PathInfo, error) {
+	filePath = gopath.Clean("/" + strings.ReplaceAll(filePath, "\\", "/"))
+
+	var usedMount string
+	stdout, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		usedMount = strings.TrimSuffix(mountPath, "/")
+		return []string{"sh", "-c", resolvePathScript, "sh", pvcPath(mountPath, filePath), mountPath}
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, streamError(ke, stderr)
+		}
+		return nil, err
+	}
+	return parseResolveOutput(stdout, usedMount, filePath)
+}
+
+func parseResolveOutput(out, mountPath, filePath string) (*PathInfo, error) {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	info := &PathInfo{Path: filePath}
+
+	switch lines[0] {
+	case "broken":
+		target := ""
+		if len(lines) > 1 {
+			target = lines[1]
+		}
+		return nil, &K8sError{
+			Kind:    ErrKindPathNotFound,
+			Message: fmt.Sprintf("%s is a symbolic link to %s, which does not exist or loops back on itself.", filePath, target),
+		}
+	case "missing":
+		info.NavigatePath = "/"
+		if len(lines) > 1 {
+			rel := strings.TrimPrefix(strings.TrimSpace(lines[1]), mountPath)
+			info.NavigatePath = gopath.Clean("/" + rel)
+		}
+		return info, nil
+	case "dir", "file":
+	default:
+		return nil, fmt.Errorf("unexpected output while resolving %s: %q", filePath, out)
+	}
+
+	info.Exists = true
+	info.IsDir = lines[0] == "dir"
+	if len(lines) > 1 && len(lines[1]) == 3 {
+		info.Readable = lines[1][0] == 'r'
+		info.Writable = lines[1][1] == 'w'
+		info.Executable = lines[1][2] == 'x'
+	}
+	if len(lines) > 2 {
+		if fields := strings.Fields(lines[2]); len(fields) == 4 {
+			info.Mode, info.Owner, info.Group = fields[0], fields[1], fields[2]
+			info.Size, _ = strconv.ParseInt(fields[3], 10, 64)
+		}
+	}
+
+	if len(lines) > 4 && lines[3] != "" && lines[4] != "" {
+		real, ok := pathWithin(lines[4], lines[3])
+		if !ok {
+			return nil, &K8sError{
+				Kind:    ErrKindOutOfScope,
+				Message: fmt.Sprintf("%s leads outside the volume, to %s. KubeBrowser does not follow symbolic links out of a PVC.", filePath, lines[3]),
+			}
+		}
+		if real != filePath {
+			info.RealPath = real
+		}
+	}
+	if len(lines) > 5 {
+		info.LinkTarget = lines[5]
+	}
+
+	shown := filePath
+	if info.RealPath != "" {
+		shown = info.RealPath
+	}
+	if info.IsDir {
+		info.NavigatePath = shown
+	} else {
+		info.NavigatePath = gopath.Dir(shown)
+		info.FileName = gopath.Base(shown)
+	}
+	return info, nil
+}
+
+// pathsExistScript prints 1 for each argument that exists, a dangling
+// symbolic link included, and 0 for each that does not.
+const pathsExistScript = `for p; do
+  if [ -e "$p" ] || [ -L "$p" ]; then echo 1; else echo 0; fi
+done`
+
+// PathsExist reports, in one exec, which of paths exist on the PVC, as a
+// pre-flight check before writing to them.
+func (c *Client) PathsExist(ctx context.Context, namespace, pvcName string, paths []string) ([]bool, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	stdout, _, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		cmd := []string{"sh", "-c", pathsExistScript, "sh"}
+		for _, p := range paths {
+			cmd = append(cmd, pvcPath(mountPath, p))
+		}
+		return cmd
+	})
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Fields(stdout)
+	if len(lines) != len(paths) {
+		return nil, fmt.Errorf("expected %d answers checking paths, got %d", len(paths), len(lines))
+	}
+	exist := make([]bool, len(paths))
+	for i, l := range lines {
+		exist[i] = l == "1"
+	}
+	return exist, nil
+}
+
+// pathWithin returns p relative to root, as an absolute PVC path, and
+// whether p is inside root at all.
+func pathWithin(root, p string) (string, bool) {
+	root = strings.TrimSuffix(root, "/")
+	if p == root {
+		return "/", true
+	}
+	if !strings.HasPrefix(p, root+"/") {
+		return "", false
+	}
+	return gopath.Clean(p[len(root):]), true
+}
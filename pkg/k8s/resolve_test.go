@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolvePathFile(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("file\nrw-\n644 root root 42\n", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	info, err := c.ResolvePath(context.Background(), "default", "my-pvc", "logs//app/../app.log")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := PathInfo{
+		Path: "/logs/app.log", Exists: true, Readable: true, Writable: true,
+		Mode: "644", Owner: "root", Group: "root", Size: 42,
+		NavigatePath: "/logs", FileName: "app.log",
+	}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+
+	cmd := mock.execCalls[0].cmd
+	if cmd[0] != "sh" || cmd[4] != "/data/logs/app.log" || cmd[5] != "/data" {
+		t.Errorf("unexpected command: %v", cmd)
+	}
+}
+
+func TestParseResolveOutput(t *testing.T) {
+	dir, err := parseResolveOutput("dir\nr-x\n\n", "/data", "/cache")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dir.Exists || !dir.IsDir || dir.Writable || dir.NavigatePath != "/cache" || dir.Mode != "" {
+		t.Errorf("unexpected dir info: %+v", dir)
+	}
+
+	missing, err := parseResolveOutput("missing\n/data/a\n", "/data", "/a/b/c")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if missing.Exists || missing.NavigatePath != "/a" {
+		t.Errorf("unexpected missing info: %+v", missing)
+	}
+
+	root, _ := parseResolveOutput("missing\n/data\n", "/data", "/nope")
+	if root.NavigatePath != "/" {
+		t.Errorf("expected navigation to PVC root, got %q", root.NavigatePath)
+	}
+
+	if _, err := parseResolveOutput("garbage", "/data", "/x"); err == nil {
+		t.Error("expected error for unexpected output")
+	}
+}
+
+func TestParseResolveOutputSymlinks(t *testing.T) {
+	// /current -> releases/v2, a directory inside the volume.
+	dir, err := parseResolveOutput("dir\nr-x\n755 root root 4096\n/data/releases/v2\n/data\nreleases/v2\n", "/data", "/current")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dir.RealPath != "/releases/v2" || dir.LinkTarget != "releases/v2" || dir.NavigatePath != "/releases/v2" {
+		t.Errorf("unexpected link info: %+v", dir)
+	}
+
+	// A file reached through a linked directory opens where it really is.
+	file, err := parseResolveOutput("file\nrw-\n644 root root 3\n/data/releases/v2/app.log\n/data\n", "/data", "/current/app.log")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file.RealPath != "/releases/v2/app.log" || file.LinkTarget != "" || file.NavigatePath != "/releases/v2" || file.FileName != "app.log" {
+		t.Errorf("unexpected file info: %+v", file)
+	}
+
+	// A link to its own parent resolves to the parent, not /loop/loop.
+	loop, _ := parseResolveOutput("dir\nr-x\n\n/data\n/data\n..\n", "/data", "/sub/loop")
+	if loop.NavigatePath != "/" {
+		t.Errorf("expected navigation to PVC root, got %q", loop.NavigatePath)
+	}
+
+	plain, _ := parseResolveOutput("dir\nr-x\n\n/data/cache\n/data\n", "/data", "/cache")
+	if plain.RealPath != "" || plain.NavigatePath != "/cache" {
+		t.Errorf("unexpected info for a plain directory: %+v", plain)
+	}
+
+	_, err = parseResolveOutput("dir\nr-x\n\n/etc\n/data\n/etc\n", "/data", "/escape")
+	if ke, ok := err.(*K8sError); !ok || ke.Kind != ErrKindOutOfScope {
+		t.Errorf("expected OutOfScope for a link out of the volume, got %v", err)
+	}
+
+	_, err = parseResolveOutput("broken\nb\n", "/data", "/a")
+	if ke, ok := err.(*K8sError); !ok || ke.Kind != ErrKindPathNotFound || !strings.Contains(ke.Message, "symbolic link to b") {
+		t.Errorf("expected PathNotFound for a dangling link, got %v", err)
+	}
+}
+
+func TestPathsExist(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("1\n0\n", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	exist, err := c.PathsExist(context.Background(), "default", "my-pvc", []string{"/in/a.txt", "/in/a (1).txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exist) != 2 || !exist[0] || exist[1] {
+		t.Errorf("unexpected answer %v", exist)
+	}
+	if cmd := mock.execCalls[0].cmd; strings.Join(cmd[3:], "|") != "sh|/data/in/a.txt|/data/in/a (1).txt" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+
+	mock.pushExec("1\n", "", nil)
+	if _, err := c.PathsExist(context.Background(), "default", "my-pvc", []string{"/a", "/b"}); err == nil {
+		t.Error("expected a short answer to be refused")
+	}
+}
@@ -0,0 +1,166 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	gopath "path"
+	"sort"
+	"strings"
+)
+
+// inventoryScript describes what exists under the given paths, relative to
+// $1: "d <name>" for directories, "l <name>" for anything else that is not
+// a regular file (symlinks, mostly), and sha256sum's "<sum>  <name>" for
+// regular files. Paths that do not exist are skipped, and a missing $1
+// prints nothing, so it also answers whether a copy has started at all.
+const inventoryScript = `cd -- "$1" 2>/dev/null || exit 0
+shift
+for p; do
+  if [ -e "$p" ] || [ -L "$p" ]; then
+    find "$p" -type d -exec printf 'd %s\n' {} +
+    find "$p" ! -type d ! -type f -exec printf 'l %s\n' {} +
+    find "$p" -type f -exec sha256sum {} +
+  fi
+done`
+
+// partialTarScript tars the newline-separated names read from stdin,
+// relative to $1.
+const partialTarScript = `cd -- "$1" && exec tar cf - -T -`
+
+// inventory is a parsed inventoryScript listing.
+type inventory struct {
+	dirs  map[string]bool
+	other map[string]bool
+	sums  map[string]string
+}
+
+// parseInventory parses inventoryScript output. ok is false when a name
+// could not be read back unambiguously: one containing a newline splits
+// into unparseable lines, and sha256sum escapes such names with a leading
+// backslash.
+func parseInventory(stdout string) (inv inventory, ok bool) {
+	inv = inventory{dirs: map[string]bool{}, other: map[string]bool{}, sums: map[string]string{}}
+	for _, line := range strings.Split(stdout, "\n") {
+		if line == "" {
+			continue
+		}
+		if name, found := strings.CutPrefix(line, "d "); found {
+			inv.dirs[name] = true
+			continue
+		}
+		if name, found := strings.CutPrefix(line, "l "); found {
+			inv.other[name] = true
+			continue
+		}
+		sum, name, found := strings.Cut(line, "  ")
+		if !found || len(sum) != 64 {
+			return inv, false
+		}
+		inv.sums[name] = sum
+	}
+	return inv, true
+}
+
+// inventory runs inventoryScript for rel under dir. Like the copy itself it
+// works on claims no pod mounts, which is where an interrupted clone leaves
+// its target.
+func (c *Client) inventory(ctx context.Context, ref PVCRef, dir string, rel []string) (string, error) {
+	var out strings.Builder
+	err := c.streamOnClaim(ctx, ref, func(mountPath string) []string {
+		return concatArgs([]string{"sh", "-c", inventoryScript, "sh", pvcPath(mountPath, dir)}, rel...)
+	}, nil, &out)
+	return out.String(), err
+}
+
+// pendingEntries returns what is on src but not yet, or not identically,
+// on dst: directories missing on dst (which tar copies with everything
+// below them), other entries missing on dst, and regular files that are
+// missing or whose checksum differs. skipped counts the regular files that
+// are already in place.
+func pendingEntries(src, dst inventory) (pending []string, skipped int) {
+	var missingDirs []string
+	for name := range src.dirs {
+		if !dst.dirs[name] {
+			missingDirs = append(missingDirs, name)
+		}
+	}
+	sort.Strings(missingDirs)
+	under := func(name string) bool {
+		for dir := gopath.Dir(name); dir != "." && dir != "/"; dir = gopath.Dir(dir) {
+			if !dst.dirs[dir] && src.dirs[dir] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, dir := range missingDirs {
+		if !under(dir) {
+			pending = append(pending, dir)
+		}
+	}
+	var rest []string
+	for name := range src.other {
+		if !dst.other[name] && !under(name) {
+			rest = append(rest, name)
+		}
+	}
+	for name, sum := range src.sums {
+		switch {
+		case dst.sums[name] == sum:
+			skipped++
+		case !under(name):
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(pending, rest...), skipped
+}
+
+// resumeCopy is CopyBetweenPVCs for a copy that may have been interrupted
+// before: when destDir on dst already holds part of paths, only what is
+// missing or differs (by sha256) is sent again. It returns the number of
+// regular files that were already in place. A destination without any of
+// paths costs one extra exec and is copied in full.
+func (c *Client) resumeCopy(ctx context.Context, src PVCRef, paths []string, dst PVCRef, destDir string, progress func(int64)) (int, error) {
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		rel[i] = relativePVCPath(p)
+	}
+	full := func() (int, error) {
+		return 0, c.CopyBetweenPVCs(ctx, src, paths, dst, destDir, progress)
+	}
+
+	dstOut, err := c.inventory(ctx, dst, destDir, rel)
+	if err != nil {
+		log.Printf("Could not inspect %s for an earlier partial copy, copying everything: %v", dst, err)
+		return full()
+	}
+	if strings.TrimSpace(dstOut) == "" {
+		return full()
+	}
+	srcOut, err := c.inventory(ctx, src, "/", rel)
+	if err != nil {
+		return 0, fmt.Errorf("checksumming source on %s: %w", src, err)
+	}
+	srcInv, srcOK := parseInventory(srcOut)
+	dstInv, dstOK := parseInventory(dstOut)
+	if !srcOK || !dstOK {
+		log.Printf("File names on %s cannot be listed unambiguously, copying everything", src)
+		return full()
+	}
+
+	pending, skipped := pendingEntries(srcInv, dstInv)
+	log.Printf("Resuming copy from %s to %s: %d file(s) already in place, %d entries to send", src, dst, skipped, len(pending))
+	if len(pending) == 0 {
+		return skipped, nil
+	}
+	list := make([]string, len(pending))
+	for i, name := range pending {
+		// tar would take a leading "-" for an option.
+		list[i] = "./" + name
+	}
+	return skipped, c.copyStream(ctx, src, func(mountPath string) []string {
+		return []string{"sh", "-c", partialTarScript, "sh", mountPath}
+	}, strings.NewReader(strings.Join(list, "\n")+"\n"), dst, destDir, progress)
+}
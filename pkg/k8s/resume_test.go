@@ -0,0 +1,91 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func sum(c byte) string { return strings.Repeat(string(c), 64) }
+
+func TestPendingEntries(t *testing.T) {
+	src, ok := parseInventory("d logs\nd logs/old\nd cache\nl logs/current\n" +
+		sum('a') + "  logs/a.log\n" + sum('b') + "  logs/b.log\n" + sum('c') + "  logs/old/c.log\n" + sum('d') + "  cache/x\n")
+	if !ok {
+		t.Fatal("source inventory rejected")
+	}
+	dst, ok := parseInventory("d logs\n" + sum('a') + "  logs/a.log\n" + sum('0') + "  logs/b.log\n")
+	if !ok {
+		t.Fatal("destination inventory rejected")
+	}
+
+	pending, skipped := pendingEntries(src, dst)
+	if skipped != 1 {
+		t.Errorf("expected logs/a.log to be skipped, skipped=%d", skipped)
+	}
+	want := "cache,logs/old,logs/b.log,logs/current"
+	if got := strings.Join(pending, ","); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseInventoryRejectsEscapedNames(t *testing.T) {
+	if _, ok := parseInventory("\\" + sum('a') + "  logs/a\\nb\n"); ok {
+		t.Error("expected an escaped sha256sum line to be rejected")
+	}
+	if _, ok := parseInventory("d logs\nstray line\n"); ok {
+		t.Error("expected a stray line to be rejected")
+	}
+}
+
+func TestMoveBetweenPVCsResumes(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("d logs\n"+sum('a')+"  logs/a.log\n", "", nil)
+	mock.pushStream("d logs\n"+sum('a')+"  logs/a.log\n"+sum('b')+"  logs/-b.log\n", "", nil)
+	mock.pushStream("tar-stream", "", nil)
+	mock.pushStream("tar-stream", "", nil)
+	mock.pushExec(sum('a')+"  logs/a.log\n"+sum('b')+"  logs/-b.log\n", "", nil)
+	mock.pushExec(sum('a')+"  logs/a.log\n"+sum('b')+"  logs/-b.log\n", "", nil)
+	mock.pushExec("", "", nil)
+	c := newTransferClient(mock)
+
+	files, err := c.MoveBetweenPVCs(context.Background(), srcRef, []string{"/logs"}, dstRef, "/archive", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files != 2 {
+		t.Errorf("files=%d", files)
+	}
+	if len(mock.streamCalls) != 4 {
+		t.Fatalf("expected two inventories and one copy, got %d streams", len(mock.streamCalls))
+	}
+	if cmd := mock.streamCalls[1].cmd; mock.streamCalls[1].podName == "other-pod" || cmd[4] != "/data" {
+		t.Errorf("expected the source inventory second, got %v", cmd)
+	}
+	for i, call := range mock.streamCalls[2:] {
+		if call.podName == "other-pod" {
+			continue
+		}
+		if cmd := strings.Join(call.cmd, " "); cmd != "sh -c "+partialTarScript+" sh /data" {
+			t.Errorf("unexpected source command: %s", cmd)
+		}
+		if got := string(mock.streamStdin[i+2]); got != "./logs/-b.log\n" {
+			t.Errorf("expected only the missing file to be sent, got %q", got)
+		}
+	}
+}
+
+func TestResumeCopyNothingLeft(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("d logs\n"+sum('a')+"  logs/a.log\n", "", nil)
+	mock.pushStream("d logs\n"+sum('a')+"  logs/a.log\n", "", nil)
+	c := newTransferClient(mock)
+
+	skipped, err := c.resumeCopy(context.Background(), srcRef, []string{"/logs"}, dstRef, "/", nil)
+	if err != nil || skipped != 1 {
+		t.Fatalf("skipped=%d err=%v", skipped, err)
+	}
+	if len(mock.streamCalls) != 2 {
+		t.Errorf("expected no copy, got %d streams", len(mock.streamCalls))
+	}
+}
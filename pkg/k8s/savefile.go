@@ -0,0 +1,39 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// saveScript writes stdin to a temporary file next to $1 and renames it
+// over $1, so a reader of $1 sees either the old contents or the new ones,
+// never half of each, and an interrupted save leaves $1 alone. The
+// replaced file's mode, owner and group are kept; chown failing, as it
+// does for a user who is not root, still saves the file as that user's.
+const saveScript = `set -e
+if [ -d "$1" ]; then echo "$1: Is a directory" >&2; exit 1; fi
+tmp="$(dirname "$1")/.kube-browser-save.$$"
+trap 'rm -f -- "$tmp"' EXIT
+cat > "$tmp"
+if [ -e "$1" ]; then
+  chmod "$(stat -c %a "$1")" "$tmp"
+  chown "$(stat -c %u:%g "$1")" "$tmp" 2>/dev/null || :
+fi
+mv -f -- "$tmp" "$1"`
+
+// SaveFile replaces the contents of filePath with data atomically, for
+// edits made in the browser. Unlike UploadFile, which writes in place, the
+// file is never seen partly written. Its directory must exist.
+func (c *Client) SaveFile(ctx context.Context, namespace, pvcName, filePath string, data []byte) error {
+	if relativePVCPath(filePath) == "." {
+		return &K8sError{Kind: ErrKindUnknown, Message: "Cannot write to the root of a PVC."}
+	}
+	err := c.streamOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		return []string{"sh", "-c", saveScript, "sh", pvcPath(mountPath, filePath)}
+	}, bytes.NewReader(data), &bytes.Buffer{})
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSaveFileCommand(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("", "", nil)
+	c := newTransferClient(mock)
+
+	if err := c.SaveFile(context.Background(), "default", "my-pvc", "/config/app.env", []byte("DEBUG=1\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := "sh -c " + saveScript + " sh /data/config/app.env"
+	if got := strings.Join(mock.streamCalls[0].cmd, " "); got != want {
+		t.Errorf("unexpected command %q", got)
+	}
+	if got := string(mock.streamStdin[0]); got != "DEBUG=1\n" {
+		t.Errorf("expected the text on stdin, got %q", got)
+	}
+
+	if err := c.SaveFile(context.Background(), "default", "my-pvc", "/", nil); err == nil {
+		t.Error("expected saving over the root to be refused")
+	}
+}
+
+func TestSaveScriptKeepsModeAndOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing a file's owner needs root")
+	}
+	file := filepath.Join(t.TempDir(), "app.env")
+	os.WriteFile(file, []byte("DEBUG=0\n"), 0o640)
+	os.Chown(file, 1234, 5678)
+
+	cmd := exec.Command("sh", "-c", saveScript, "sh", file)
+	cmd.Stdin = strings.NewReader("DEBUG=1\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	if info.Mode().Perm() != 0o640 || st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("expected mode 0640 and owner 1234:5678, got %v and %d:%d", info.Mode().Perm(), st.Uid, st.Gid)
+	}
+	if got, _ := os.ReadFile(file); string(got) != "DEBUG=1\n" {
+		t.Errorf("unexpected contents %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod KubeBrowser
+// runs in.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// SetNamespace scopes the client to a single namespace, for users whose
+// RBAC stops at namespace boundaries: ListNamespaces returns it without
+// asking the API server, and every operation on another namespace fails
+// with ErrKindOutOfScope before any request is made. Empty lifts the scope.
+func (c *Client) SetNamespace(namespace string) {
+	c.namespace = namespace
+}
+
+// Namespace returns the namespace the client is scoped to, or "".
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// inScope fails for a namespace outside the client's scope.
+func (c *Client) inScope(namespaces ...string) error {
+	if c.namespace == "" {
+		return nil
+	}
+	for _, ns := range namespaces {
+		if ns != c.namespace {
+			return &K8sError{
+				Kind:    ErrKindOutOfScope,
+				Message: fmt.Sprintf("This connection is scoped to namespace %q; %q is out of scope.", c.namespace, ns),
+			}
+		}
+	}
+	return nil
+}
+
+// ContextNamespace returns the default namespace of a kubeconfig context
+// (the current one when contextName is empty) or, for InClusterContext,
+// of the pod's ServiceAccount. It is "" when the context sets none.
+func ContextNamespace(kubeconfigPath, contextName string) (string, error) {
+	if contextName == InClusterContext && RunningInCluster() {
+		data, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the pod's namespace: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if kubeconfigPath == "" {
+		kubeconfigPath = DefaultKubeconfigPath()
+	}
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	kctx, ok := config.Contexts[contextName]
+	if !ok {
+		return "", fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	return kctx.Namespace, nil
+}
@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestScopedClient(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockPodExecutor{}
+	c := &Client{clientset: fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		runningPodWithPVC("my-pvc"),
+	), executor: mock}
+	c.SetNamespace("default")
+
+	namespaces, err := c.ListNamespaces(ctx)
+	if err != nil || !reflect.DeepEqual(namespaces, []string{"default"}) {
+		t.Errorf("expected only the scoped namespace, got %v, %v", namespaces, err)
+	}
+
+	outOfScope := func(what string, err error) {
+		t.Helper()
+		var ke *K8sError
+		if !errors.As(err, &ke) || ke.Kind != ErrKindOutOfScope {
+			t.Errorf("%s: expected an out-of-scope error, got %v", what, err)
+		}
+	}
+	_, err = c.ListPVCs(ctx, "kube-system")
+	outOfScope("ListPVCs", err)
+	_, err = c.ListFiles(ctx, "kube-system", "my-pvc", "/")
+	outOfScope("ListFiles", err)
+	_, err = c.ListPods(ctx, "kube-system")
+	outOfScope("ListPods", err)
+	_, err = c.ClonePVC(ctx, CloneRequest{Namespace: "default", PVC: "my-pvc", TargetNamespace: "kube-system"}, nil)
+	outOfScope("ClonePVC", err)
+	outOfScope("CopyBetweenPVCs", c.CopyBetweenPVCs(ctx, PVCRef{Namespace: "default", PVC: "my-pvc"}, []string{"/a"}, PVCRef{Namespace: "kube-system", PVC: "x"}, "/", nil))
+	_, err = c.createHelperPod(ctx, "kube-system", "x", "", "")
+	outOfScope("createHelperPod", err)
+	if len(mock.execCalls)+len(mock.streamCalls) != 0 {
+		t.Errorf("expected nothing to run out of scope, got %d execs", len(mock.execCalls)+len(mock.streamCalls))
+	}
+
+	if _, err := c.ListPVCs(ctx, "default"); err != nil {
+		t.Errorf("expected the scoped namespace to work, got %v", err)
+	}
+}
+
+func TestContextNamespace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	kubeconfig := `apiVersion: v1
+kind: Config
+current-context: team
+clusters:
+- name: c
+  cluster: {server: "https://example.invalid"}
+users:
+- name: u
+  user: {token: t}
+contexts:
+- name: team
+  context: {cluster: c, user: u, namespace: team-a}
+- name: admin
+  context: {cluster: c, user: u}
+`
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ns, err := ContextNamespace(path, ""); err != nil || ns != "team-a" {
+		t.Errorf("expected the current context's namespace, got %q, %v", ns, err)
+	}
+	if ns, err := ContextNamespace(path, "admin"); err != nil || ns != "" {
+		t.Errorf("expected no namespace, got %q, %v", ns, err)
+	}
+	if _, err := ContextNamespace(path, "missing"); err == nil {
+		t.Error("expected an unknown context to fail")
+	}
+}
+
+func TestListNamespacesForbidden(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "", errors.New("no"))
+	})
+	c := &Client{clientset: clientset}
+
+	_, err := c.ListNamespaces(context.Background())
+	var ke *K8sError
+	if !errors.As(err, &ke) || ke.Kind != ErrKindRBAC {
+		t.Errorf("expected an RBAC error, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	gopath "path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSearchLimit = 1000
+
+// SearchQuery is a recursive find under a PVC path. Zero values disable a
+// filter.
+type SearchQuery struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+	// Patterns are further name globs; an entry matching any of them, or
+	// Pattern, is kept.
+	Patterns []string `json:"patterns,omitempty"`
+	MaxDepth int      `json:"maxDepth,omitempty"`
+	// Type restricts matches to files ("f") or directories ("d").
+	Type string `json:"type,omitempty"`
+	// MinSize and MaxSize bound the size in bytes, inclusive. Either one
+	// restricts matches to files.
+	MinSize int64 `json:"minSize,omitempty"`
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// ModifiedWithin keeps entries modified in the last duration, e.g.
+	// "24h" for "yesterday's outputs"; OlderThan keeps those not modified
+	// in it.
+	ModifiedWithin string `json:"modifiedWithin,omitempty"`
+	OlderThan      string `json:"olderThan,omitempty"`
+	Limit          int    `json:"limit,omitempty"`
+}
+
+// SearchResult holds the matches of a search. Truncated is set when more
+// than Limit entries matched.
+type SearchResult struct {
+	Files     []FileInfo `json:"files"`
+	Truncated bool       `json:"truncated"`
+}
+
+func (q SearchQuery) Validate() error {
+	if q.MaxDepth < 0 {
+		return fmt.Errorf("maxDepth must not be negative")
+	}
+	if q.Type != "" && q.Type != "f" && q.Type != "d" {
+		return fmt.Errorf("type must be \"f\" or \"d\"")
+	}
+	if q.MinSize < 0 || q.MaxSize < 0 {
+		return fmt.Errorf("minSize and maxSize must not be negative")
+	}
+	if q.MaxSize > 0 && q.MinSize > q.MaxSize {
+		return fmt.Errorf("minSize must not exceed maxSize")
+	}
+	if q.Type == "d" && q.sized() {
+		return fmt.Errorf("size filters only match files")
+	}
+	for _, p := range q.names() {
+		if _, err := gopath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid name pattern %q", p)
+		}
+	}
+	for _, f := range [][2]string{{"modifiedWithin", q.ModifiedWithin}, {"olderThan", q.OlderThan}} {
+		if f[1] == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(f[1]); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q: expected a duration such as 24h", f[0], f[1])
+		}
+	}
+	return nil
+}
+
+// names returns the name globs of the query, Pattern first.
+func (q SearchQuery) names() []string {
+	var names []string
+	for _, p := range append([]string{q.Pattern}, q.Patterns...) {
+		if p != "" {
+			names = append(names, p)
+		}
+	}
+	return names
+}
+
+func (q SearchQuery) sized() bool {
+	return q.MinSize > 0 || q.MaxSize > 0
+}
+
+// minutes renders a validated duration for find -mmin, rounded to at least
+// a minute.
+func minutes(duration string) string {
+	d, _ := time.ParseDuration(duration)
+	if m := int(d.Minutes()); m > 1 {
+		return strconv.Itoa(m)
+	}
+	return "1"
+}
+
+// findArgs renders the query as find(1) arguments rooted at fullPath,
+// without the trailing action.
+func (q SearchQuery) findArgs(fullPath string) []string {
+	args := []string{"find", fullPath, "-mindepth", "1"}
+	if q.MaxDepth > 0 {
+		args = append(args, "-maxdepth", strconv.Itoa(q.MaxDepth))
+	}
+	switch {
+	case q.Type != "":
+		args = append(args, "-type", q.Type)
+	case q.sized():
+		args = append(args, "-type", "f")
+	}
+	switch names := q.names(); len(names) {
+	case 0:
+	case 1:
+		args = append(args, "-name", names[0])
+	default:
+		args = append(args, "(")
+		for i, p := range names {
+			if i > 0 {
+				args = append(args, "-o")
+			}
+			args = append(args, "-name", p)
+		}
+		args = append(args, ")")
+	}
+	// -size with the c suffix counts bytes; +N and -N are strict.
+	if q.MinSize > 0 {
+		args = append(args, "-size", "+"+strconv.FormatInt(q.MinSize-1, 10)+"c")
+	}
+	if q.MaxSize > 0 {
+		args = append(args, "-size", "-"+strconv.FormatInt(q.MaxSize+1, 10)+"c")
+	}
+	if q.ModifiedWithin != "" {
+		args = append(args, "-mmin", "-"+minutes(q.ModifiedWithin))
+	}
+	if q.OlderThan != "" {
+		args = append(args, "-mmin", "+"+minutes(q.OlderThan))
+	}
+	return args
+}
+
+// Match reports whether an entry at rel, its path below the search root,
+// is selected by a validated query, for backends that walk the tree
+// themselves instead of running find. now anchors the age filters.
+func (q SearchQuery) Match(rel string, isDir bool, size int64, mod, now time.Time) bool {
+	switch {
+	case rel == "" || rel == ".":
+		return false
+	case q.MaxDepth > 0 && strings.Count(rel, "/")+1 > q.MaxDepth:
+		return false
+	case q.Type == "f" && isDir, q.Type == "d" && !isDir:
+		return false
+	case q.sized() && isDir:
+		return false
+	case q.MinSize > 0 && size < q.MinSize, q.MaxSize > 0 && size > q.MaxSize:
+		return false
+	}
+	if q.ModifiedWithin != "" {
+		d, _ := time.ParseDuration(q.ModifiedWithin)
+		if mod.Before(now.Add(-d)) {
+			return false
+		}
+	}
+	if q.OlderThan != "" {
+		d, _ := time.ParseDuration(q.OlderThan)
+		if !mod.Before(now.Add(-d)) {
+			return false
+		}
+	}
+	names := q.names()
+	if len(names) == 0 {
+		return true
+	}
+	base := gopath.Base(rel)
+	for _, p := range names {
+		if ok, _ := gopath.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchFiles runs the query with find+stat on the PVC, falling back to
+// plain find -print0 when stat is unavailable, like the directory listing
+// does.
+func (c *Client) SearchFiles(ctx context.Context, namespace, pvcName string, q SearchQuery) (*SearchResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	q.Path = gopath.Clean("/" + strings.ReplaceAll(q.Path, "\\", "/"))
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	var root string
+	printOnly := false
+	stdout, stderr, err := c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+		root = pvcPath(mountPath, q.Path)
+		return append(q.findArgs(root), "-exec", "stat", "-c", statFormat, "{}", "+")
+	})
+	if err != nil && strings.TrimSpace(stdout) != "" {
+		// find exits non-zero when it cannot read some subdirectory; the
+		// matches it did print are still valid.
+		log.Printf("  search under %s finished with errors: %s", q.Path, strings.TrimSpace(stderr))
+		err = nil
+	}
+	if err != nil {
+		ke, ok := err.(*K8sError)
+		if !ok {
+			return nil, err
+		}
+		switch ke.Kind {
+		case ErrKindPathNotFound, ErrKindRBAC, ErrKindTimeout, ErrKindHelperDisabled, ErrKindHelperPending, ErrKindQuotaExceeded:
+			return nil, ke
+		}
+		log.Printf("  find+stat search failed (kind=%s), retrying with find -print0", ke.Kind)
+		printOnly = true
+		stdout, stderr, err = c.execOnPVC(ctx, namespace, pvcName, func(mountPath string) []string {
+			root = pvcPath(mountPath, q.Path)
+			return append(q.findArgs(root), "-print0")
+		})
+		if err != nil {
+			if ke, ok := err.(*K8sError); ok {
+				return nil, streamError(ke, stderr)
+			}
+			return nil, err
+		}
+	}
+
+	relRoot := strings.TrimSuffix(q.Path, "/")
+	var files []FileInfo
+	if printOnly {
+		files = parsePrint0Output(stdout, root, relRoot)
+	} else {
+		files = parseStatOutput(stdout, root, relRoot)
+	}
+	for i := range files {
+		files[i].Name = gopath.Base(files[i].Name)
+	}
+
+	result := &SearchResult{Files: files}
+	if len(files) > limit {
+		result.Files = files[:limit]
+		result.Truncated = true
+	}
+	return result, nil
+}
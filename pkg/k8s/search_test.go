@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSearchQueryFindArgs(t *testing.T) {
+	q := SearchQuery{Pattern: "*.log", MaxDepth: 3, Type: "f", ModifiedWithin: "24h"}
+	want := []string{"find", "/data/jobs", "-mindepth", "1", "-maxdepth", "3", "-type", "f", "-name", "*.log", "-mmin", "-1440"}
+	if got := q.findArgs("/data/jobs"); !reflect.DeepEqual(got, want) {
+		t.Errorf("findArgs = %v, want %v", got, want)
+	}
+}
+
+func TestSearchQueryFindArgsNamesAndSizes(t *testing.T) {
+	q := SearchQuery{Pattern: "*.log", Patterns: []string{"*.txt"}, MinSize: 1024, MaxSize: 2048, OlderThan: "48h"}
+	want := []string{"find", "/data", "-mindepth", "1", "-type", "f", "(", "-name", "*.log", "-o", "-name", "*.txt", ")",
+		"-size", "+1023c", "-size", "-2049c", "-mmin", "+2880"}
+	if got := q.findArgs("/data"); !reflect.DeepEqual(got, want) {
+		t.Errorf("findArgs = %v, want %v", got, want)
+	}
+}
+
+func TestSearchQueryMatch(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	q := SearchQuery{Patterns: []string{"*.log", "*.err"}, MaxDepth: 2, MinSize: 10, OlderThan: "1h"}
+	cases := []struct {
+		rel   string
+		isDir bool
+		size  int64
+		mod   time.Time
+		want  bool
+	}{
+		{"a/out.log", false, 10, now.Add(-2 * time.Hour), true},
+		{"a/out.err", false, 50, now.Add(-2 * time.Hour), true},
+		{"a/out.csv", false, 50, now.Add(-2 * time.Hour), false},
+		{"a/b/out.log", false, 50, now.Add(-2 * time.Hour), false},
+		{"a/out.log", false, 9, now.Add(-2 * time.Hour), false},
+		{"a/out.log", false, 50, now.Add(-time.Minute), false},
+		{"a.log", true, 4096, now.Add(-2 * time.Hour), false},
+	}
+	for _, c := range cases {
+		if got := q.Match(c.rel, c.isDir, c.size, c.mod, now); got != c.want {
+			t.Errorf("Match(%q, dir=%v, %d, %s) = %v, want %v", c.rel, c.isDir, c.size, c.mod, got, c.want)
+		}
+	}
+}
+
+func TestSearchQueryValidate(t *testing.T) {
+	invalid := []SearchQuery{
+		{MaxDepth: -1},
+		{Type: "l"},
+		{ModifiedWithin: "yesterday"},
+		{ModifiedWithin: "-1h"},
+		{OlderThan: "old"},
+		{MinSize: -1},
+		{MinSize: 10, MaxSize: 5},
+		{Type: "d", MinSize: 1},
+		{Patterns: []string{"[a"}},
+	}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", q)
+		}
+	}
+	if err := (SearchQuery{Pattern: "*.csv", ModifiedWithin: "90m"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSearchFiles(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("42|1705314600|regular file|-rw-r--r--|0|0|/data/jobs/a/out.log\n7|1705314600|regular file|-rw-r--r--|0|0|/data/jobs/b/out.log\n", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	result, err := c.SearchFiles(context.Background(), "default", "my-pvc", SearchQuery{Path: "/jobs", Pattern: "*.log", Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Truncated || len(result.Files) != 1 {
+		t.Fatalf("expected 1 truncated result, got %+v", result)
+	}
+	if f := result.Files[0]; f.Name != "out.log" || f.Path != "/jobs/a/out.log" || f.Size != "42" {
+		t.Errorf("unexpected file: %+v", f)
+	}
+}
+
+func TestSearchFilesFallsBackToPrint(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", "find: unrecognized: -exec", fmt.Errorf("command terminated with exit code 1"))
+	mock.pushExec("/data/x.csv\x00", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	result, err := c.SearchFiles(context.Background(), "default", "my-pvc", SearchQuery{Path: "/", Pattern: "*.csv"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Path != "x.csv" {
+		t.Errorf("unexpected files: %+v", result.Files)
+	}
+	if last := mock.execCalls[1].cmd; last[len(last)-1] != "-print0" {
+		t.Errorf("expected -print0 fallback, got %v", last)
+	}
+}
+
+func TestSearchFilesKeepsPartialResults(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("1|1705314600|regular file|-rw-r--r--|0|0|/data/ok/a.txt\n", "find: /data/secret: Permission denied", fmt.Errorf("command terminated with exit code 1"))
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	result, err := c.SearchFiles(context.Background(), "default", "my-pvc", SearchQuery{Path: "/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Files) != 1 || len(mock.execCalls) != 1 {
+		t.Errorf("expected partial results from a single exec, got %+v (%d calls)", result.Files, len(mock.execCalls))
+	}
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"log"
+	gopath "path"
+	"strings"
+)
+
+// errSearchLimit stops a streamed search at the first match past its
+// limit.
+var errSearchLimit = errors.New("search limit reached")
+
+// StreamSearch runs the query like SearchFiles but hands each match to fn
+// as soon as find prints it, so the first results of a search over a huge
+// volume show up while it goes on. It reports whether more than the
+// query's limit matched; find is stopped at the first match past it. An
+// error from fn stops the search and is returned.
+//
+// Only GNU find streams; where it is missing, or on Windows nodes, the
+// search runs as SearchFiles does and the matches are handed over once it
+// is done.
+func (c *Client) StreamSearch(ctx context.Context, namespace, pvcName string, q SearchQuery, fn func(FileInfo) error) (bool, error) {
+	if err := q.Validate(); err != nil {
+		return false, err
+	}
+	q.Path = gopath.Clean("/" + strings.ReplaceAll(q.Path, "\\", "/"))
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	info, err := c.findPodForPVC(ctx, namespace, pvcName)
+	if err != nil {
+		return false, err
+	}
+	if !info.windows {
+		sent := 0
+		dec := &findPrintfDecoder{path: strings.TrimSuffix(q.Path, "/"), emit: func(f FileInfo) error {
+			if sent == limit {
+				return errSearchLimit
+			}
+			sent++
+			f.Name = gopath.Base(f.Name)
+			return fn(f)
+		}}
+		err = c.streamOnPod(ctx, namespace, pvcName, info, func(mountPath string) []string {
+			return append(q.findArgs(pvcPath(mountPath, q.Path)), "-printf", findPrintfFormat)
+		}, nil, dec)
+		switch {
+		case dec.err == errSearchLimit:
+			return true, nil
+		case dec.err != nil:
+			return false, dec.err
+		case err == nil:
+			return false, dec.close()
+		case ctx.Err() != nil:
+			return false, err
+		case dec.records > 0:
+			// find exits non-zero when it cannot read some subdirectory;
+			// the matches it did print are still valid.
+			log.Printf("  search under %s finished with errors: %v", q.Path, err)
+			return false, nil
+		}
+		if k, ok := err.(*K8sError); ok && (isFinalListingError(k.Kind) || k.Kind == ErrKindHelperDisabled || k.Kind == ErrKindHelperPending || k.Kind == ErrKindQuotaExceeded) {
+			return false, k
+		}
+		log.Printf("Streaming a search of %s/%s:%s with GNU find failed (%v), searching without it", namespace, pvcName, q.Path, err)
+	}
+	result, err := c.SearchFiles(ctx, namespace, pvcName, q)
+	return emitSearch(result, err, fn)
+}
+
+// emitSearch hands a finished search to fn, for backends that cannot
+// stream.
+func emitSearch(result *SearchResult, err error, fn func(FileInfo) error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return result.Truncated, emitFiles(result.Files, fn)
+}
@@ -0,0 +1,48 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStreamSearch(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream(findPrintfRecord("f", "-rw-r--r--", "10", "a/one.log", "")+
+		findPrintfRecord("f", "-rw-r--r--", "20", "two.log", ""), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var got []FileInfo
+	truncated, err := c.StreamSearch(context.Background(), "default", "my-pvc", SearchQuery{Path: "/logs", Pattern: "*.log", Limit: 1}, func(f FileInfo) error {
+		got = append(got, f)
+		return nil
+	})
+	if err != nil || !truncated {
+		t.Fatalf("expected the search to stop past its limit, got %v, %v", truncated, err)
+	}
+	if len(got) != 1 || got[0].Name != "one.log" || got[0].Path != "/logs/a/one.log" {
+		t.Errorf("unexpected matches %+v", got)
+	}
+	if cmd := strings.Join(mock.streamCalls[0].cmd, " "); !strings.HasPrefix(cmd, "find /data/logs -mindepth 1 -name *.log -printf") {
+		t.Errorf("unexpected command %q", cmd)
+	}
+}
+
+func TestStreamSearchFallsBackWithoutGNUFind(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("", "find: unrecognized: -printf", fmt.Errorf("command terminated with exit code 1"))
+	mock.pushExec("5|1705314600|regular file|-rw-r--r--|0|0|/data/x.log\n", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	var got []FileInfo
+	truncated, err := c.StreamSearch(context.Background(), "default", "my-pvc", SearchQuery{Path: "/"}, func(f FileInfo) error {
+		got = append(got, f)
+		return nil
+	})
+	if err != nil || truncated || len(got) != 1 || got[0].Name != "x.log" {
+		t.Errorf("expected the search to run without streaming, got %+v, %v, %v", got, truncated, err)
+	}
+}
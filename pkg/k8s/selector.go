@@ -0,0 +1,54 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ParseSelector checks a label selector ("team=payments",
+// "tier in (db,cache),!legacy") as kubectl -l takes it.
+func ParseSelector(selector string) (labels.Selector, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("invalid label selector %q: %v", selector, err), Cause: err}
+	}
+	return sel, nil
+}
+
+// SelectPVCs returns the claims whose labels match selector, across every
+// namespace or, for a client scoped to one, in that namespace only. Unlike
+// ListPVCs it does not look for the pods mounting them, so it stays a
+// single request however many namespaces there are.
+func (c *Client) SelectPVCs(ctx context.Context, selector string) ([]PVCInfo, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := withListRetry(ctx, c, "PVCs matching "+sel.String(), func(ctx context.Context) (*corev1.PersistentVolumeClaimList, error) {
+		return c.clientset.CoreV1().PersistentVolumeClaims(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	})
+	if err != nil {
+		return nil, err
+	}
+	pvcs := make([]PVCInfo, 0, len(list.Items))
+	for i := range list.Items {
+		pvcs = append(pvcs, pvcInfo(&list.Items[i]))
+	}
+	sortPVCs(pvcs)
+	return pvcs, nil
+}
+
+// sortPVCs orders claims by namespace, then name.
+func sortPVCs(pvcs []PVCInfo) {
+	sort.Slice(pvcs, func(i, j int) bool {
+		if pvcs[i].Namespace != pvcs[j].Namespace {
+			return pvcs[i].Namespace < pvcs[j].Namespace
+		}
+		return pvcs[i].Name < pvcs[j].Name
+	})
+}
@@ -0,0 +1,51 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func labelledPVC(namespace, name string, labels map[string]string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+}
+
+func TestSelectPVCsAcrossNamespaces(t *testing.T) {
+	c := &Client{clientset: fake.NewSimpleClientset(
+		labelledPVC("payments", "ledger", map[string]string{"team": "payments"}),
+		labelledPVC("billing", "invoices", map[string]string{"team": "payments", "tier": "archive"}),
+		labelledPVC("web", "assets", map[string]string{"team": "web"}),
+	)}
+
+	pvcs, err := c.SelectPVCs(context.Background(), "team=payments")
+	if err != nil {
+		t.Fatalf("SelectPVCs: %v", err)
+	}
+	if len(pvcs) != 2 || pvcs[0].Namespace != "billing" || pvcs[1].Name != "ledger" {
+		t.Fatalf("got %+v", pvcs)
+	}
+	if pvcs[0].Status != "Bound" || pvcs[0].Labels["tier"] != "archive" {
+		t.Errorf("expected the claim's status and labels, got %+v", pvcs[0])
+	}
+
+	c.SetNamespace("payments")
+	if pvcs, err := c.SelectPVCs(context.Background(), "team=payments"); err != nil || len(pvcs) != 1 || pvcs[0].Name != "ledger" {
+		t.Errorf("a scoped client should only select in its namespace, got %+v, %v", pvcs, err)
+	}
+}
+
+func TestSelectPVCsRejectsInvalidSelector(t *testing.T) {
+	c := &Client{clientset: fake.NewSimpleClientset()}
+	_, err := c.SelectPVCs(context.Background(), "team in (")
+	var kerr *K8sError
+	if !errors.As(err, &kerr) {
+		t.Fatalf("expected a K8sError, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	gopath "path"
+	"time"
+)
+
+const (
+	// RestoreConflictFail refuses to restore onto an existing path.
+	RestoreConflictFail = "fail"
+	// RestoreConflictOverwrite unpacks over an existing path: files are
+	// replaced and directories merged.
+	RestoreConflictOverwrite = "overwrite"
+	// RestoreConflictRename picks the first free "<name>.restored[-N]".
+	RestoreConflictRename = "rename"
+)
+
+// SnapshotRestoreRequest copies entries of a snapshot back onto the claim
+// it was taken of. Paths are as in the snapshot; each is restored under
+// DestDir, or by default into the directory it was in. OnConflict defaults
+// to RestoreConflictFail.
+type SnapshotRestoreRequest struct {
+	Namespace  string   `json:"namespace"`
+	Snapshot   string   `json:"snapshot"`
+	Paths      []string `json:"paths"`
+	DestDir    string   `json:"destDir,omitempty"`
+	OnConflict string   `json:"onConflict,omitempty"`
+}
+
+func (r SnapshotRestoreRequest) Validate() error {
+	if r.Namespace == "" || r.Snapshot == "" || len(r.Paths) == 0 {
+		return fmt.Errorf("namespace, snapshot and paths are required")
+	}
+	switch r.OnConflict {
+	case "", RestoreConflictFail, RestoreConflictOverwrite, RestoreConflictRename:
+	default:
+		return fmt.Errorf("onConflict must be %q, %q or %q", RestoreConflictFail, RestoreConflictOverwrite, RestoreConflictRename)
+	}
+	for _, p := range r.Paths {
+		if relativePVCPath(p) == "." {
+			return fmt.Errorf("cannot restore the root of a snapshot; select the entries inside it")
+		}
+	}
+	return nil
+}
+
+// RestoredPath is one entry restored: where it was in the snapshot and
+// where it now is on the live claim.
+type RestoredPath struct {
+	Path        string `json:"path"`
+	Target      string `json:"target"`
+	Renamed     bool   `json:"renamed,omitempty"`
+	Overwritten bool   `json:"overwritten,omitempty"`
+}
+
+// SnapshotRestoreResult describes a finished restore.
+type SnapshotRestoreResult struct {
+	Namespace string `json:"namespace"`
+	// PVC is the live claim restored onto, Claim the one the snapshot
+	// was restored into to read from.
+	PVC      string         `json:"pvc"`
+	Claim    string         `json:"claim"`
+	Restored []RestoredPath `json:"restored"`
+}
+
+// planSnapshotRestore works out where each path of req goes, before
+// anything is copied, so a conflict refuses the whole restore. exists
+// reports whether a path is on the live claim.
+func planSnapshotRestore(req SnapshotRestoreRequest, exists func(string) (bool, error)) ([]RestoredPath, error) {
+	plan := make([]RestoredPath, 0, len(req.Paths))
+	taken := map[string]bool{}
+	for _, p := range req.Paths {
+		p = gopath.Clean("/" + p)
+		dir := gopath.Dir(p)
+		if req.DestDir != "" {
+			dir = gopath.Clean("/" + req.DestDir)
+		}
+		target := gopath.Join(dir, gopath.Base(p))
+		candidates := []string{target}
+		if req.OnConflict == RestoreConflictRename {
+			candidates = append(candidates, target+".restored")
+			for i := 2; i <= 20; i++ {
+				candidates = append(candidates, fmt.Sprintf("%s.restored-%d", target, i))
+			}
+		}
+
+		entry := RestoredPath{Path: p}
+		for i, candidate := range candidates {
+			if taken[candidate] {
+				if req.OnConflict != RestoreConflictRename {
+					return nil, fmt.Errorf("two of the entries would be restored to %s", candidate)
+				}
+				continue
+			}
+			found, err := exists(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if found && req.OnConflict != RestoreConflictOverwrite {
+				continue
+			}
+			entry.Target, entry.Renamed, entry.Overwritten = candidate, i > 0, found
+			break
+		}
+		if entry.Target == "" {
+			if req.OnConflict == RestoreConflictRename {
+				return nil, fmt.Errorf("no free name to restore %s to", target)
+			}
+			return nil, fmt.Errorf("%s already exists; overwrite it or rename on conflict", target)
+		}
+		taken[entry.Target] = true
+		plan = append(plan, entry)
+	}
+	return plan, nil
+}
+
+// RestoreFromSnapshot copies entries of a snapshot back onto the claim it
+// was taken of. The snapshot is restored into a claim as BrowseSnapshot
+// does, and each entry streamed across with a tar exec on either side. A
+// renamed entry is unpacked into a staging directory next to its target
+// and moved into place. The restored claim is deleted afterwards unless it
+// was already being browsed.
+func (c *Client) RestoreFromSnapshot(ctx context.Context, req SnapshotRestoreRequest, progress func(int64)) (*SnapshotRestoreResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.inScope(req.Namespace); err != nil {
+		return nil, err
+	}
+	claim, err := c.BrowseSnapshot(ctx, req.Namespace, req.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if !claim.Existing {
+		defer c.deleteClaim(req.Namespace, claim.PVC, "after restoring files from it")
+	}
+	src := PVCRef{Namespace: req.Namespace, PVC: claim.PVC}
+	dst := PVCRef{Namespace: req.Namespace, PVC: claim.Source}
+
+	plan, err := planSnapshotRestore(req, func(p string) (bool, error) {
+		info, err := c.ResolvePath(ctx, dst.Namespace, dst.PVC, p)
+		if err != nil {
+			return false, err
+		}
+		return info.Exists, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var done int64
+	for _, entry := range plan {
+		base := done
+		step := func(n int64) {
+			done = base + n
+			if progress != nil {
+				progress(done)
+			}
+		}
+		build := func(mountPath string) []string {
+			return []string{"tar", "cf", "-", "-C", pvcPath(mountPath, gopath.Dir(entry.Path)), "--", gopath.Base(entry.Path)}
+		}
+		if !entry.Renamed {
+			err = c.copyStream(ctx, src, build, nil, dst, gopath.Dir(entry.Target), step)
+		} else {
+			staging := gopath.Join(gopath.Dir(entry.Target), fmt.Sprintf(".kb-restore-%d", time.Now().UnixNano()))
+			err = c.copyStream(ctx, src, build, nil, dst, staging, step)
+			if err == nil {
+				err = c.Move(ctx, dst.Namespace, dst.PVC, gopath.Join(staging, gopath.Base(entry.Path)), entry.Target)
+			}
+			if cleanupErr := c.DeleteDirectory(context.Background(), dst.Namespace, dst.PVC, staging, true); cleanupErr != nil {
+				log.Printf("Could not remove %s from %s: %v", staging, dst, cleanupErr)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("restoring %s: %w", entry.Path, err)
+		}
+	}
+	return &SnapshotRestoreResult{Namespace: req.Namespace, PVC: dst.PVC, Claim: claim.PVC, Restored: plan}, nil
+}
@@ -0,0 +1,36 @@
+package k8s
+
+import "testing"
+
+func TestPlanSnapshotRestore(t *testing.T) {
+	live := map[string]bool{"/conf/app.conf": true, "/conf/app.conf.restored": true, "/html": true}
+	exists := func(p string) (bool, error) { return live[p], nil }
+
+	if _, err := planSnapshotRestore(SnapshotRestoreRequest{Paths: []string{"/new.txt", "/conf/app.conf"}}, exists); err == nil {
+		t.Error("expected an existing path to refuse the whole restore")
+	}
+
+	plan, err := planSnapshotRestore(SnapshotRestoreRequest{Paths: []string{"conf/app.conf", "/new.txt"}, OnConflict: RestoreConflictRename}, exists)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan) != 2 || plan[0].Path != "/conf/app.conf" || plan[0].Target != "/conf/app.conf.restored-2" || !plan[0].Renamed ||
+		plan[1].Target != "/new.txt" || plan[1].Renamed {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+
+	plan, err = planSnapshotRestore(SnapshotRestoreRequest{Paths: []string{"/old/html", "/a/x"}, DestDir: "/", OnConflict: RestoreConflictOverwrite}, exists)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan[0].Target != "/html" || !plan[0].Overwritten || plan[1].Target != "/x" || plan[1].Overwritten {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+	if _, err := planSnapshotRestore(SnapshotRestoreRequest{Paths: []string{"/a/x", "/b/x"}, DestDir: "/", OnConflict: RestoreConflictOverwrite}, exists); err == nil {
+		t.Error("expected two entries restored onto one path to be refused")
+	}
+
+	if err := (SnapshotRestoreRequest{Namespace: "default", Snapshot: "nightly", Paths: []string{"/"}}).Validate(); err == nil {
+		t.Error("expected the root to be refused")
+	}
+}
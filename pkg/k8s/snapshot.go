@@ -0,0 +1,272 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// snapshotGVR is the VolumeSnapshot resource of the CSI snapshot
+// controller.
+var snapshotGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+
+const (
+	// snapshotOfLabel marks a claim restored from a snapshot so it can be
+	// browsed, with the claim the snapshot was taken of.
+	snapshotOfLabel = "kube-browser/snapshot-of"
+	// snapshotAnnotation names the snapshot such a claim was restored from.
+	snapshotAnnotation = "kube-browser/snapshot"
+)
+
+// snapshotClaimTTL is how long a claim restored for browsing is kept, for
+// tabs closed without releasing it (see SnapshotClaim.Expires).
+const snapshotClaimTTL = 6 * time.Hour
+
+// Snapshot is a VolumeSnapshot of a claim.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	PVC       string    `json:"pvc"`
+	Created   time.Time `json:"created"`
+	// ReadyToUse is set once the snapshot can be restored.
+	ReadyToUse    bool   `json:"readyToUse"`
+	RestoreSize   string `json:"restoreSize,omitempty"`
+	SnapshotClass string `json:"snapshotClass,omitempty"`
+	Error         string `json:"error,omitempty"`
+	// Claim is the claim restored from the snapshot for browsing, when
+	// there is one.
+	Claim string `json:"claim,omitempty"`
+}
+
+// SnapshotClaim is a claim restored from a snapshot, browsed like any
+// other claim, with a helper pod.
+type SnapshotClaim struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+	Snapshot  string `json:"snapshot"`
+	// Source is the claim the snapshot was taken of.
+	Source string `json:"source"`
+	// Existing is set when the claim was already there, restored by an
+	// earlier request.
+	Existing bool `json:"existing"`
+	// Expires is when the claim has been kept long enough to be released
+	// even if nobody did.
+	Expires time.Time `json:"expires"`
+}
+
+// SnapshotClaimName is the claim a snapshot is restored into, by
+// BrowseSnapshot and RestoreFromSnapshot.
+func SnapshotClaimName(snapshot string) string {
+	return "kb-snap-" + snapshot
+}
+
+func (c *Client) dynamicClient() (dynamic.Interface, error) {
+	c.dynamicMu.Lock()
+	defer c.dynamicMu.Unlock()
+	if c.dynamic != nil {
+		return c.dynamic, nil
+	}
+	if c.restConfig == nil {
+		return nil, fmt.Errorf("no cluster configuration")
+	}
+	d, err := dynamic.NewForConfig(c.restConfig)
+	if err != nil {
+		return nil, err
+	}
+	c.dynamic = d
+	return d, nil
+}
+
+// classifySnapshotError explains the errors of the VolumeSnapshot API,
+// which many clusters do not have.
+func classifySnapshotError(err error, namespace string) error {
+	switch {
+	case apierrors.IsNotFound(err) && isMissingResource(err):
+		return &K8sError{Kind: ErrKindUnknown, Message: "This cluster has no VolumeSnapshot API: install the CSI snapshot controller and its snapshot.storage.k8s.io CRDs.", Cause: err}
+	case apierrors.IsForbidden(err):
+		return &K8sError{Kind: ErrKindRBAC, Message: fmt.Sprintf("Permission denied: your kubeconfig cannot list volumesnapshots in %s.", namespace), Cause: err}
+	}
+	return classifyApiError(err)
+}
+
+// isMissingResource tells a 404 for the whole resource, when the CRD is
+// not installed, from one for a single snapshot.
+func isMissingResource(err error) bool {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok {
+		return false
+	}
+	details := status.Status().Details
+	return details == nil || details.Name == ""
+}
+
+// snapshotFromObject reads the fields of a VolumeSnapshot.
+func snapshotFromObject(obj *unstructured.Unstructured) Snapshot {
+	s := Snapshot{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		Created:   obj.GetCreationTimestamp().Time,
+	}
+	s.PVC, _, _ = unstructured.NestedString(obj.Object, "spec", "source", "persistentVolumeClaimName")
+	s.SnapshotClass, _, _ = unstructured.NestedString(obj.Object, "spec", "volumeSnapshotClassName")
+	s.ReadyToUse, _, _ = unstructured.NestedBool(obj.Object, "status", "readyToUse")
+	s.RestoreSize, _, _ = unstructured.NestedString(obj.Object, "status", "restoreSize")
+	s.Error, _, _ = unstructured.NestedString(obj.Object, "status", "error", "message")
+	if taken, _, _ := unstructured.NestedString(obj.Object, "status", "creationTime"); taken != "" {
+		if t, err := time.Parse(time.RFC3339, taken); err == nil {
+			s.Created = t
+		}
+	}
+	return s
+}
+
+// ListSnapshots returns the VolumeSnapshots of a claim, newest first, each
+// with the claim restored from it for browsing if there is one.
+func (c *Client) ListSnapshots(ctx context.Context, namespace, pvcName string) ([]Snapshot, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	d, err := c.dynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	list, err := d.Resource(snapshotGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, classifySnapshotError(err, namespace)
+	}
+
+	claims, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: snapshotOfLabel + "=" + pvcName})
+	if err != nil {
+		return nil, classifyApiError(err)
+	}
+	restored := map[string]string{}
+	for _, claim := range claims.Items {
+		restored[claim.Annotations[snapshotAnnotation]] = claim.Name
+	}
+
+	snapshots := []Snapshot{}
+	for i := range list.Items {
+		s := snapshotFromObject(&list.Items[i])
+		if s.PVC != pvcName {
+			continue
+		}
+		s.Claim = restored[s.Name]
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created.After(snapshots[j].Created) })
+	return snapshots, nil
+}
+
+// BrowseSnapshot restores a snapshot into a new claim next to it, with the
+// storage class and access modes of the claim it was taken of, so it can
+// be listed and downloaded from like that claim. A claim already restored
+// from the snapshot is reused. The volume is provisioned when the helper
+// pod that browses it first mounts it.
+func (c *Client) BrowseSnapshot(ctx context.Context, namespace, snapshotName string) (*SnapshotClaim, error) {
+	if err := c.inScope(namespace); err != nil {
+		return nil, err
+	}
+	d, err := c.dynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := d.Resource(snapshotGVR).Namespace(namespace).Get(ctx, snapshotName, metav1.GetOptions{})
+	if err != nil {
+		return nil, classifySnapshotError(err, namespace)
+	}
+	snap := snapshotFromObject(obj)
+	if !snap.ReadyToUse {
+		return nil, fmt.Errorf("snapshot %s is not ready to use yet", snapshotName)
+	}
+
+	name := SnapshotClaimName(snapshotName)
+	claim := &SnapshotClaim{Namespace: namespace, PVC: name, Snapshot: snapshotName, Source: snap.PVC, Expires: time.Now().Add(snapshotClaimTTL)}
+	pvcs := c.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	if existing, err := pvcs.Get(ctx, name, metav1.GetOptions{}); err == nil {
+		if existing.Annotations[snapshotAnnotation] != snapshotName {
+			return nil, fmt.Errorf("PVC %s already exists and was not restored from snapshot %s", name, snapshotName)
+		}
+		claim.Existing = true
+		if !existing.CreationTimestamp.IsZero() {
+			claim.Expires = existing.CreationTimestamp.Add(snapshotClaimTTL)
+		}
+		return claim, nil
+	} else if !apierrors.IsNotFound(err) {
+		return nil, classifyApiError(err)
+	}
+
+	spec := corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		DataSource: &corev1.TypedLocalObjectReference{
+			APIGroup: &snapshotGVR.Group,
+			Kind:     "VolumeSnapshot",
+			Name:     snapshotName,
+		},
+	}
+	var size resource.Quantity
+	if src, err := pvcs.Get(ctx, snap.PVC, metav1.GetOptions{}); err == nil {
+		spec.AccessModes = src.Spec.AccessModes
+		spec.VolumeMode = src.Spec.VolumeMode
+		spec.StorageClassName = src.Spec.StorageClassName
+		size, _ = migrationSize(src, "")
+	}
+	if snap.RestoreSize != "" {
+		if q, err := resource.ParseQuantity(snap.RestoreSize); err == nil && q.Cmp(size) > 0 {
+			size = q
+		}
+	}
+	if size.IsZero() {
+		return nil, fmt.Errorf("cannot determine the size of snapshot %s", snapshotName)
+	}
+	spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: size}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{"managed-by": "kube-browser", snapshotOfLabel: snap.PVC},
+			Annotations: map[string]string{snapshotAnnotation: snapshotName},
+		},
+		Spec: spec,
+	}
+	log.Printf("Restoring snapshot %s/%s of %s into %s (%s)", namespace, snapshotName, snap.PVC, name, size.String())
+	if _, err := pvcs.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		if apierrors.IsForbidden(err) {
+			return nil, &K8sError{Kind: ErrKindRBAC, Message: fmt.Sprintf("Permission denied: your kubeconfig cannot create persistentvolumeclaims in %s.", namespace), Cause: err}
+		}
+		return nil, classifyApiError(err)
+	}
+	c.noteClaimCreated(namespace, name)
+	return claim, nil
+}
+
+// ReleaseSnapshot deletes a claim BrowseSnapshot restored. Other claims
+// are refused.
+func (c *Client) ReleaseSnapshot(ctx context.Context, namespace, claimName string) error {
+	if err := c.inScope(namespace); err != nil {
+		return err
+	}
+	pvcs := c.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	pvc, err := pvcs.Get(ctx, claimName, metav1.GetOptions{})
+	if err != nil {
+		return classifyApiError(err)
+	}
+	if pvc.Labels[snapshotOfLabel] == "" {
+		return fmt.Errorf("PVC %s was not restored from a snapshot by KubeBrowser", claimName)
+	}
+	if err := pvcs.Delete(ctx, claimName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return classifyApiError(err)
+	}
+	log.Printf("Released %s/%s, restored from snapshot %s", namespace, claimName, pvc.Annotations[snapshotAnnotation])
+	return nil
+}
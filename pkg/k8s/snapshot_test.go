@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func volumeSnapshot(name, pvc, created string, ready bool) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec": map[string]interface{}{
+			"source":                  map[string]interface{}{"persistentVolumeClaimName": pvc},
+			"volumeSnapshotClassName": "csi-snapclass",
+		},
+		"status": map[string]interface{}{"readyToUse": ready, "restoreSize": "3Gi", "creationTime": created},
+	}}
+}
+
+func snapshotClient(objects ...runtime.Object) *Client {
+	d := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{snapshotGVR: "VolumeSnapshotList"}, objects...)
+	return &Client{clientset: cloneFixtures(), dynamic: d}
+}
+
+func TestListSnapshots(t *testing.T) {
+	c := snapshotClient(
+		volumeSnapshot("nightly-1", "my-pvc", "2024-05-01T02:00:00Z", true),
+		volumeSnapshot("nightly-2", "my-pvc", "2024-05-02T02:00:00Z", false),
+		volumeSnapshot("other", "other-pvc", "2024-05-03T02:00:00Z", true),
+	)
+	snapshots, err := c.ListSnapshots(context.Background(), "default", "my-pvc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != "nightly-2" || snapshots[1].Name != "nightly-1" {
+		t.Fatalf("expected the claim's snapshots, newest first, got %+v", snapshots)
+	}
+	if snapshots[0].ReadyToUse || !snapshots[1].ReadyToUse || snapshots[1].RestoreSize != "3Gi" || snapshots[1].SnapshotClass != "csi-snapclass" {
+		t.Errorf("unexpected snapshot fields: %+v", snapshots)
+	}
+}
+
+func TestBrowseAndReleaseSnapshot(t *testing.T) {
+	c := snapshotClient(
+		volumeSnapshot("nightly-1", "my-pvc", "2024-05-01T02:00:00Z", true),
+		volumeSnapshot("pending", "my-pvc", "2024-05-02T02:00:00Z", false),
+	)
+	ctx := context.Background()
+	var created []string
+	c.SetClaimCreated(func(namespace, pvc string) { created = append(created, namespace+"/"+pvc) })
+
+	if _, err := c.BrowseSnapshot(ctx, "default", "pending"); err == nil {
+		t.Error("expected a snapshot that is not ready to be refused")
+	}
+	claim, err := c.BrowseSnapshot(ctx, "default", "nightly-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claim.PVC != "kb-snap-nightly-1" || claim.Source != "my-pvc" || claim.Existing {
+		t.Errorf("unexpected claim: %+v", claim)
+	}
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims("default").Get(ctx, claim.PVC, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("claim not created: %v", err)
+	}
+	size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if pvc.Spec.DataSource == nil || pvc.Spec.DataSource.Kind != "VolumeSnapshot" || pvc.Spec.DataSource.Name != "nightly-1" ||
+		*pvc.Spec.StorageClassName != "standard" || size.String() != "3Gi" || pvc.Labels[snapshotOfLabel] != "my-pvc" {
+		t.Errorf("unexpected claim spec: %+v", pvc)
+	}
+
+	if again, err := c.BrowseSnapshot(ctx, "default", "nightly-1"); err != nil || !again.Existing {
+		t.Errorf("expected the restored claim to be reused, got %+v, %v", again, err)
+	}
+	if len(created) != 1 || created[0] != "default/kb-snap-nightly-1" {
+		t.Errorf("expected only the new claim to be reported, got %v", created)
+	}
+	snapshots, _ := c.ListSnapshots(ctx, "default", "my-pvc")
+	if len(snapshots) != 2 || snapshots[1].Claim != claim.PVC {
+		t.Errorf("expected the listing to name the restored claim, got %+v", snapshots)
+	}
+
+	if err := c.ReleaseSnapshot(ctx, "default", "my-pvc"); err == nil {
+		t.Error("expected a claim KubeBrowser did not restore to be refused")
+	}
+	if err := c.ReleaseSnapshot(ctx, "default", claim.PVC); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.clientset.CoreV1().PersistentVolumeClaims("default").Get(ctx, claim.PVC, metav1.GetOptions{}); err == nil {
+		t.Error("expected the restored claim to be deleted")
+	}
+}
@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type SortMode string
+
+const (
+	// SortName orders names byte-wise (or case-folded), like ls.
+	SortName SortMode = "name"
+	// SortNatural compares runs of digits by value, so file2 comes
+	// before file10.
+	SortNatural SortMode = "natural"
+	// SortSize orders by size, smallest first, then naturally by name.
+	SortSize SortMode = "size"
+	// SortModTime orders by modification time, oldest first, then
+	// naturally by name. Entries without a time come first.
+	SortModTime SortMode = "mtime"
+)
+
+// SortOptions controls the order of a listing.
+type SortOptions struct {
+	Mode            SortMode
+	CaseInsensitive bool
+	DirsFirst       bool
+	// Descending reverses the order Mode gives; directories still come
+	// first with DirsFirst.
+	Descending bool
+}
+
+// DefaultSortOptions is the order used when a request does not ask for
+// one: natural, case-insensitive, directories first.
+func DefaultSortOptions() SortOptions {
+	return SortOptions{Mode: SortNatural, CaseInsensitive: true, DirsFirst: true}
+}
+
+func (o SortOptions) Validate() error {
+	switch o.Mode {
+	case SortName, SortNatural, SortSize, SortModTime:
+		return nil
+	}
+	return fmt.Errorf("sort must be %q, %q, %q or %q", SortName, SortNatural, SortSize, SortModTime)
+}
+
+// SortFiles orders files in place. Ties (e.g. names differing only in case)
+// fall back to a byte-wise comparison so the order is stable across calls.
+func SortFiles(files []FileInfo, o SortOptions) {
+	less := strings.Compare
+	if o.Mode != SortName {
+		less = naturalCompare
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if o.DirsFirst && a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		an, bn := a.Name, b.Name
+		if o.CaseInsensitive {
+			an, bn = strings.ToLower(an), strings.ToLower(bn)
+		}
+		c := 0
+		switch o.Mode {
+		case SortSize:
+			c = cmp.Compare(sizeOf(a), sizeOf(b))
+		case SortModTime:
+			// ModTime is RFC 3339 in UTC, which orders as text.
+			c = strings.Compare(a.ModTime, b.ModTime)
+		}
+		if c == 0 {
+			c = less(an, bn)
+		}
+		if c == 0 {
+			c = strings.Compare(a.Name, b.Name)
+		}
+		if o.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// sizeOf returns f's size in bytes, or -1 when the listing did not give
+// one.
+func sizeOf(f FileInfo) int64 {
+	n, err := strconv.ParseInt(f.Size, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// ValidateFilter reports whether pattern is a glob FilterFiles can use.
+func ValidateFilter(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("filter %q is not a valid glob", pattern)
+	}
+	return nil
+}
+
+// FilterFiles returns the files whose name matches the glob pattern, as
+// path.Match reads it, folding case when caseInsensitive is set. An empty
+// pattern keeps them all.
+func FilterFiles(files []FileInfo, pattern string, caseInsensitive bool) []FileInfo {
+	if pattern == "" {
+		return files
+	}
+	out := []FileInfo{}
+	for _, f := range files {
+		if MatchFilter(f, pattern, caseInsensitive) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// MatchFilter reports whether f is kept by FilterFiles.
+func MatchFilter(f FileInfo, pattern string, caseInsensitive bool) bool {
+	if pattern == "" {
+		return true
+	}
+	name := f.Name
+	if caseInsensitive {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// naturalCompare compares a and b treating each run of ASCII digits as a
+// number. Equal numbers with different zero padding ("07" vs "7") order
+// the shorter run first.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			da, db := digitPrefix(a), digitPrefix(b)
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) - len(nb)
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			if len(da) != len(db) {
+				return len(da) - len(db)
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sortedNames(files []FileInfo, o SortOptions) []string {
+	SortFiles(files, o)
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func filesNamed(names ...string) []FileInfo {
+	files := make([]FileInfo, len(names))
+	for i, n := range names {
+		files[i] = FileInfo{Name: n}
+	}
+	return files
+}
+
+func TestSortFilesNatural(t *testing.T) {
+	got := sortedNames(filesNamed("file10", "file2", "file1", "file02", "file"), SortOptions{Mode: SortNatural})
+	want := []string{"file", "file1", "file2", "file02", "file10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortFilesByName(t *testing.T) {
+	got := sortedNames(filesNamed("file10", "file2", "file1"), SortOptions{Mode: SortName})
+	want := []string{"file1", "file10", "file2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortFilesCaseInsensitive(t *testing.T) {
+	names := []string{"beta", "Alpha", "alpha", "Gamma"}
+	if got, want := sortedNames(filesNamed(names...), SortOptions{Mode: SortName}), []string{"Alpha", "Gamma", "alpha", "beta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("case-sensitive: got %v, want %v", got, want)
+	}
+	if got, want := sortedNames(filesNamed(names...), SortOptions{Mode: SortName, CaseInsensitive: true}), []string{"Alpha", "alpha", "beta", "Gamma"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("case-insensitive: got %v, want %v", got, want)
+	}
+}
+
+func TestSortFilesDirsFirst(t *testing.T) {
+	files := []FileInfo{{Name: "b.txt"}, {Name: "z-dir", IsDir: true}, {Name: "a.txt"}}
+	if got, want := sortedNames(append([]FileInfo{}, files...), SortOptions{Mode: SortName, DirsFirst: true}), []string{"z-dir", "a.txt", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dirs first: got %v, want %v", got, want)
+	}
+	if got, want := sortedNames(append([]FileInfo{}, files...), SortOptions{Mode: SortName}), []string{"a.txt", "b.txt", "z-dir"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mixed: got %v, want %v", got, want)
+	}
+}
+
+func TestSortOptionsValidate(t *testing.T) {
+	if err := (SortOptions{Mode: "color"}).Validate(); err == nil {
+		t.Error("expected unknown mode to be rejected")
+	}
+	if err := DefaultSortOptions().Validate(); err != nil {
+		t.Errorf("default options invalid: %v", err)
+	}
+}
+
+func TestSortFilesBySizeAndModTime(t *testing.T) {
+	files := []FileInfo{
+		{Name: "big", Size: "2048", ModTime: "2024-01-02T00:00:00Z"},
+		{Name: "small", Size: "12", ModTime: "2024-03-01T00:00:00Z"},
+		{Name: "dir", IsDir: true, Size: "4096", ModTime: "2023-01-01T00:00:00Z"},
+		{Name: "unknown", Size: "", ModTime: ""},
+	}
+	if got, want := sortedNames(append([]FileInfo{}, files...), SortOptions{Mode: SortSize, DirsFirst: true}), []string{"dir", "unknown", "small", "big"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("size: got %v, want %v", got, want)
+	}
+	if got, want := sortedNames(append([]FileInfo{}, files...), SortOptions{Mode: SortModTime, Descending: true}), []string{"small", "big", "dir", "unknown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("newest first: got %v, want %v", got, want)
+	}
+}
+
+func TestFilterFiles(t *testing.T) {
+	files := filesNamed("app.log", "App.LOG.1", "data.csv", "error.log")
+	names := func(files []FileInfo) []string {
+		out := []string{}
+		for _, f := range files {
+			out = append(out, f.Name)
+		}
+		return out
+	}
+	if got, want := names(FilterFiles(files, "*.log", false)), []string{"app.log", "error.log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := names(FilterFiles(files, "app.log*", true)), []string{"app.log", "App.LOG.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("case-insensitive: got %v, want %v", got, want)
+	}
+	if got := FilterFiles(files, "", false); len(got) != len(files) {
+		t.Errorf("an empty filter should keep everything, got %v", names(got))
+	}
+	if err := ValidateFilter("[a-"); err == nil {
+		t.Error("expected a malformed glob to be rejected")
+	}
+}
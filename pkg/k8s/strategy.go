@@ -0,0 +1,234 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// AccessStrategy is a way of reaching the files on a claim.
+type AccessStrategy string
+
+const (
+	// StrategyExec runs commands in the container that mounts the claim.
+	StrategyExec AccessStrategy = "exec"
+	// StrategyEphemeral adds an ephemeral container of the helper image
+	// to the pod that mounts the claim and runs commands there. It
+	// creates no pod, but the container stays in the pod's spec until
+	// the pod is replaced, so it is off unless configured.
+	StrategyEphemeral AccessStrategy = "ephemeral"
+	// StrategyHelper starts a helper pod that mounts the claim.
+	StrategyHelper AccessStrategy = "helper"
+	// StrategyJob runs a Job, for storage-class migrations.
+	StrategyJob AccessStrategy = "job"
+)
+
+// describe names where commands of s run, for errors.
+func (s AccessStrategy) describe() string {
+	switch s {
+	case StrategyEphemeral:
+		return "an ephemeral container"
+	case StrategyHelper:
+		return "helper pod"
+	}
+	return string(s)
+}
+
+// accessStrategiesEnv names the variable configuring the strategies:
+// "exec,helper" for every namespace, or a JSON object of lists by
+// namespace, with "*" for the others.
+const accessStrategiesEnv = "KUBE_BROWSER_ACCESS_STRATEGIES"
+
+// defaultAccessStrategies are tried when nothing is configured.
+var defaultAccessStrategies = []AccessStrategy{StrategyExec, StrategyHelper, StrategyJob}
+
+// parseAccessStrategies reads accessStrategiesEnv into lists by namespace,
+// "*" holding the default.
+func parseAccessStrategies(v string) (map[string][]AccessStrategy, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return map[string][]AccessStrategy{"*": defaultAccessStrategies}, nil
+	}
+	lists := map[string][]string{}
+	if strings.HasPrefix(v, "{") {
+		if err := json.Unmarshal([]byte(v), &lists); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		lists["*"] = strings.Split(v, ",")
+	}
+	if _, ok := lists["*"]; !ok {
+		lists["*"] = nil
+		for _, s := range defaultAccessStrategies {
+			lists["*"] = append(lists["*"], string(s))
+		}
+	}
+
+	config := map[string][]AccessStrategy{}
+	for namespace, names := range lists {
+		seen := map[AccessStrategy]bool{}
+		strategies := []AccessStrategy{}
+		for _, name := range names {
+			s := AccessStrategy(strings.ToLower(strings.TrimSpace(name)))
+			switch s {
+			case StrategyExec, StrategyEphemeral, StrategyHelper, StrategyJob:
+			case "":
+				continue
+			default:
+				return nil, fmt.Errorf("unknown strategy %q for %q; use exec, ephemeral, helper or job", name, namespace)
+			}
+			if seen[s] {
+				return nil, fmt.Errorf("strategy %q is listed twice for %q", s, namespace)
+			}
+			seen[s] = true
+			strategies = append(strategies, s)
+		}
+		config[namespace] = strategies
+	}
+	return config, nil
+}
+
+var accessStrategiesCache struct {
+	sync.Mutex
+	raw    string
+	config map[string][]AccessStrategy
+}
+
+// configuredAccessStrategies returns the strategies accessStrategiesEnv
+// allows in namespace, in order. An invalid setting is logged once and
+// allows only exec, so a typo never lets KubeBrowser create pods an admin
+// meant to forbid.
+func configuredAccessStrategies(namespace string) []AccessStrategy {
+	raw := os.Getenv(accessStrategiesEnv)
+	cache := &accessStrategiesCache
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.config == nil || cache.raw != raw {
+		config, err := parseAccessStrategies(raw)
+		if err != nil {
+			log.Printf("Warning: invalid %s (%v); only exec is allowed", accessStrategiesEnv, err)
+			config = map[string][]AccessStrategy{"*": {StrategyExec}}
+		}
+		cache.raw, cache.config = raw, config
+	}
+	if strategies, ok := cache.config[namespace]; ok {
+		return strategies
+	}
+	return cache.config["*"]
+}
+
+// AccessStrategies returns the strategies allowed in namespace, in the
+// order they are tried. In minimal mode only exec is left.
+func (c *Client) AccessStrategies(namespace string) []AccessStrategy {
+	strategies := configuredAccessStrategies(namespace)
+	if !c.helperDisabled {
+		return strategies
+	}
+	for _, s := range strategies {
+		if s == StrategyExec {
+			return []AccessStrategy{StrategyExec}
+		}
+	}
+	return []AccessStrategy{}
+}
+
+// allows reports whether s is allowed in namespace.
+func (c *Client) allows(namespace string, s AccessStrategy) bool {
+	for _, allowed := range c.AccessStrategies(namespace) {
+		if allowed == s {
+			return true
+		}
+	}
+	return false
+}
+
+// noAccessError is the error of an operation none of the strategies
+// allowed in namespace could run; cause is that of direct exec, if it was
+// tried.
+func (c *Client) noAccessError(namespace string, cause error) *K8sError {
+	if c.helperDisabled {
+		return &K8sError{Kind: ErrKindHelperDisabled, Message: "The container could not be accessed directly and helper pods are disabled (minimal mode).", Cause: cause}
+	}
+	var names []string
+	for _, s := range c.AccessStrategies(namespace) {
+		names = append(names, string(s))
+	}
+	allowed := strings.Join(names, ", ")
+	if allowed == "" {
+		allowed = "none"
+	}
+	msg := fmt.Sprintf("No access strategy allowed in namespace %s can reach this claim (%s: %s).", namespace, accessStrategiesEnv, allowed)
+	if cause != nil {
+		msg = fmt.Sprintf("The container could not be accessed directly, and no other access strategy is allowed in namespace %s (%s: %s).", namespace, accessStrategiesEnv, allowed)
+	}
+	return &K8sError{Kind: ErrKindHelperDisabled, Message: msg, Cause: cause}
+}
+
+// accessTarget is where a command on a claim runs.
+type accessTarget struct {
+	strategy  AccessStrategy
+	pod       string
+	container string
+	mountPath string
+}
+
+// withAccess runs try on the claim through each strategy allowed in
+// namespace, in order, until one succeeds or fails in a way the next would
+// not fix: try returns whether to move on. Ephemeral containers and helper
+// pods are only started once a strategy before them gave up, and a helper
+// pod is deleted once try is done with it. Windows pods are only reached
+// by exec.
+func (c *Client) withAccess(ctx context.Context, namespace, pvcName string, info *podPVCInfo, try func(ctx context.Context, t accessTarget) (next bool, err error)) error {
+	var execErr, startErr error
+	for _, s := range c.AccessStrategies(namespace) {
+		var next bool
+		var err error
+		switch s {
+		case StrategyExec:
+			next, err = try(ctx, accessTarget{strategy: s, pod: info.podName, container: info.containerName, mountPath: info.mountPath})
+			execErr = err
+		case StrategyEphemeral, StrategyHelper:
+			if info.windows {
+				continue
+			}
+			next, err = c.tryStarted(ctx, s, namespace, pvcName, info, execErr, try)
+			startErr = err
+		default:
+			continue
+		}
+		if err == nil || !next {
+			return err
+		}
+	}
+	if startErr != nil {
+		return startErr
+	}
+	return c.noAccessError(namespace, execErr)
+}
+
+// tryStarted starts an ephemeral container or a helper pod for the claim
+// and runs try in it. Failing to start moves on to the next strategy.
+func (c *Client) tryStarted(ctx context.Context, s AccessStrategy, namespace, pvcName string, info *podPVCInfo, cause error, try func(ctx context.Context, t accessTarget) (bool, error)) (bool, error) {
+	ctx, cancel := helperOperationContext(ctx)
+	defer cancel()
+	if s == StrategyEphemeral {
+		container, err := c.getExecutor().addDebugContainer(ctx, namespace, info.podName, info.volumeName)
+		if err != nil {
+			log.Printf("Could not add an ephemeral container to %s/%s: %v", namespace, info.podName, err)
+			return true, err
+		}
+		_, err = try(ctx, accessTarget{strategy: s, pod: info.podName, container: container, mountPath: helperMountPath})
+		return false, err
+	}
+	helperName, err := c.startHelperPod(ctx, namespace, pvcName, info.volumeName, info.nodeName, cause)
+	if err != nil {
+		return true, err
+	}
+	defer c.scheduleHelperDeletion(namespace, helperName)
+	_, err = try(ctx, accessTarget{strategy: s, pod: helperName, container: "helper", mountPath: helperMountPath})
+	return false, err
+}
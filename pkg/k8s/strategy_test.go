@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseAccessStrategies(t *testing.T) {
+	config, err := parseAccessStrategies(" exec, Helper ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []AccessStrategy{StrategyExec, StrategyHelper}; !reflect.DeepEqual(config["*"], want) {
+		t.Errorf("expected %v, got %v", want, config["*"])
+	}
+
+	config, err = parseAccessStrategies(`{"prod": ["exec"], "batch": ["helper", "exec"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config["prod"], []AccessStrategy{StrategyExec}) ||
+		!reflect.DeepEqual(config["batch"], []AccessStrategy{StrategyHelper, StrategyExec}) ||
+		!reflect.DeepEqual(config["*"], defaultAccessStrategies) {
+		t.Errorf("unexpected config %v", config)
+	}
+
+	for _, bad := range []string{"exec,sudo", "exec,exec", `{"prod": "exec"}`} {
+		if _, err := parseAccessStrategies(bad); err == nil {
+			t.Errorf("expected %q to be refused", bad)
+		}
+	}
+
+	t.Setenv(accessStrategiesEnv, "exec,helpr")
+	if got := configuredAccessStrategies("default"); !reflect.DeepEqual(got, []AccessStrategy{StrategyExec}) {
+		t.Errorf("expected an invalid setting to allow only exec, got %v", got)
+	}
+}
+
+func TestExecOnPVCHelperOnly(t *testing.T) {
+	t.Setenv(accessStrategiesEnv, "helper")
+	mock := &mockPodExecutor{createResult: "helper-1"}
+	mock.pushExec("ok", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	out, _, err := c.execOnPVC(context.Background(), "default", "my-pvc", func(mountPath string) []string { return []string{"true", mountPath} })
+	if err != nil || out != "ok" {
+		t.Fatalf("unexpected result %q, %v", out, err)
+	}
+	if len(mock.execCalls) != 1 || mock.execCalls[0].podName != "helper-1" {
+		t.Errorf("expected the app container not to be exec'd into, got %+v", mock.execCalls)
+	}
+}
+
+func TestExecOnPVCExecOnlyCreatesNoPod(t *testing.T) {
+	t.Setenv(accessStrategiesEnv, `{"default": ["exec"]}`)
+	mock := &mockPodExecutor{createResult: "helper-1"}
+	mock.pushExec("", "sh: find: not found", fmt.Errorf("command terminated with exit code 127"))
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	_, _, err := c.execOnPVC(context.Background(), "default", "my-pvc", func(mountPath string) []string { return []string{"find", mountPath} })
+	if kerr, ok := err.(*K8sError); !ok || kerr.Kind != ErrKindHelperDisabled {
+		t.Fatalf("expected a HelperDisabled error, got %v", err)
+	}
+	if mock.createCalled != 0 {
+		t.Errorf("expected no helper pod, got %d", mock.createCalled)
+	}
+	if _, err := c.StartMaintenance(context.Background(), "default", "my-pvc", 1); err == nil {
+		t.Error("expected maintenance mode to be refused without helper pods")
+	}
+}
+
+func TestExecOnPVCEphemeralContainer(t *testing.T) {
+	t.Setenv(accessStrategiesEnv, "exec,ephemeral,helper")
+	mock := &mockPodExecutor{debugResult: "kube-browser-1", createResult: "helper-1"}
+	mock.pushExec("", "sh: find: not found", fmt.Errorf("command terminated with exit code 127"))
+	mock.pushExec("ok", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc")), executor: mock}
+
+	if _, _, err := c.execOnPVC(context.Background(), "default", "my-pvc", func(mountPath string) []string { return []string{"find", mountPath} }); err != nil {
+		t.Fatal(err)
+	}
+	call := mock.execCalls[1]
+	if call.podName != "app-pod" || call.containerName != "kube-browser-1" || call.cmd[1] != helperMountPath {
+		t.Errorf("expected the retry in the ephemeral container, got %+v", call)
+	}
+	if mock.debugCalled != 1 || mock.createCalled != 0 {
+		t.Errorf("expected no helper pod once the ephemeral container worked, got %d", mock.createCalled)
+	}
+}
+
+func TestRunningDebugContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-pod"},
+		Spec: corev1.PodSpec{EphemeralContainers: []corev1.EphemeralContainer{
+			{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "kube-browser-1", VolumeMounts: []corev1.VolumeMount{{Name: "data-vol", MountPath: helperMountPath}}}},
+			{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "kube-browser-2", VolumeMounts: []corev1.VolumeMount{{Name: "data-vol", MountPath: helperMountPath}}}},
+		}},
+		Status: corev1.PodStatus{EphemeralContainerStatuses: []corev1.ContainerStatus{
+			{Name: "kube-browser-1", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+			{Name: "kube-browser-2", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}},
+	}
+	if got := runningDebugContainer(pod, "data-vol"); got != "kube-browser-2" {
+		t.Errorf("expected the running container to be reused, got %q", got)
+	}
+	if got := runningDebugContainer(pod, "other-vol"); got != "" {
+		t.Errorf("expected no container for another volume, got %q", got)
+	}
+}
@@ -0,0 +1,286 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// PVCRef names a PVC in the connected cluster.
+type PVCRef struct {
+	Namespace string `json:"namespace"`
+	PVC       string `json:"pvc"`
+}
+
+func (r PVCRef) String() string { return r.Namespace + "/" + r.PVC }
+
+// progressWriter reports the running byte count after every write.
+type progressWriter struct {
+	w        io.Writer
+	n        int64
+	progress func(int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.n += int64(n)
+	if pw.progress != nil {
+		pw.progress(pw.n)
+	}
+	return n, err
+}
+
+// unpackScript creates the destination directory ($1) and unpacks the tar
+// stream on stdin into it, with the modes and modification times the
+// archive records: p keeps the pod's umask from clearing mode bits when
+// it does not run as root.
+const unpackScript = `mkdir -p -- "$1" && tar xpf - -C "$1"`
+
+// CopyBetweenPVCs streams paths (PVC-relative) from src into destDir on
+// dst through two execs joined by a pipe: tar runs in a pod mounting each
+// claim, and the data passes through KubeBrowser without touching its disk.
+// Each leg is compressed as WithTransferCompression says: the source's
+// with zstd or gzip, decompressed here, and the destination's with gzip.
+// progress, if set, receives the number of tar bytes copied so far.
+func (c *Client) CopyBetweenPVCs(ctx context.Context, src PVCRef, paths []string, dst PVCRef, destDir string, progress func(int64)) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths to copy")
+	}
+	if err := c.inScope(src.Namespace, dst.Namespace); err != nil {
+		return err
+	}
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		rel[i] = relativePVCPath(p)
+	}
+
+	return c.copyStream(ctx, src, func(mountPath string) []string {
+		return concatArgs([]string{"tar", "cf", "-", "-C", mountPath, "--"}, rel...)
+	}, nil, dst, destDir, progress)
+}
+
+// copyStream joins the tar stream that build produces on src to an unpack
+// into destDir on dst. stdin, if set, is fed to the source command.
+func (c *Client) copyStream(ctx context.Context, src PVCRef, build func(mountPath string) []string, stdin io.Reader, dst PVCRef, destDir string, progress func(int64)) error {
+	ctx, release, err := c.ReserveExecSlots(ctx, 2)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	compression := transferCompressionFrom(ctx)
+
+	pr, pw := io.Pipe()
+	srcErr := make(chan error, 1)
+	go func() {
+		err := c.streamCompressedOut(ctx, src, build, stdin, &progressWriter{w: pw, progress: progress}, compression)
+		pw.CloseWithError(err)
+		srcErr <- err
+	}()
+
+	dstErr := c.streamCompressedIn(ctx, dst, func(mountPath string) []string {
+		return []string{"sh", "-c", unpackScript, "sh", pvcPath(mountPath, destDir)}
+	}, pr, io.Discard, compression)
+	if dstErr != nil {
+		// Stop the source side instead of letting it block on the pipe.
+		pr.CloseWithError(dstErr)
+		cancel()
+	}
+	if err := <-srcErr; err != nil && dstErr == nil {
+		return fmt.Errorf("reading from %s: %w", src, err)
+	}
+	if dstErr != nil {
+		return fmt.Errorf("writing to %s: %w", dst, dstErr)
+	}
+	return nil
+}
+
+// UnpackArchive extracts the tar stream r into destDir on the PVC,
+// creating destDir first. With StreamArchive on the other end it copies
+// data from any connection onto a claim. The stream is sent compressed as
+// WithTransferCompression says.
+func (c *Client) UnpackArchive(ctx context.Context, namespace, pvcName, destDir string, r io.Reader) error {
+	return c.streamCompressedIn(ctx, PVCRef{Namespace: namespace, PVC: pvcName}, func(mountPath string) []string {
+		return []string{"sh", "-c", unpackScript, "sh", pvcPath(mountPath, destDir)}
+	}, r, io.Discard, transferCompressionFrom(ctx))
+}
+
+// streamOnClaim is streamOnPVC for claims that may not be mounted by any
+// pod, such as an idle source or a claim KubeBrowser just created: a helper
+// pod is started for them instead.
+func (c *Client) streamOnClaim(ctx context.Context, ref PVCRef, build func(mountPath string) []string, stdin io.Reader, stdout io.Writer) error {
+	err := c.streamOnPVC(ctx, ref.Namespace, ref.PVC, build, stdin, stdout)
+	if !errors.Is(err, errNoMountingPod) {
+		return err
+	}
+	ctx, cancel := helperOperationContext(ctx)
+	defer cancel()
+	helperName, err := c.startHelperPod(ctx, ref.Namespace, ref.PVC, "", "", err)
+	if err != nil {
+		return err
+	}
+	defer c.scheduleHelperDeletion(ref.Namespace, helperName)
+
+	stderr, err := c.getExecutor().execInPodStream(ctx, ref.Namespace, helperName, "helper", build(helperMountPath), stdin, stdout)
+	if err != nil {
+		return streamError(classifyExecError(err, stderr), stderr)
+	}
+	return nil
+}
+
+// checksumScript prints "sha256  path" for every regular file under the
+// given paths, relative to the directory in $1, and a line for every other
+// entry tar copies: "dir:", "fifo:" or "dev:" for its type, and
+// "link:<sha256 of the target>" for a symbolic link. Sockets, which tar
+// skips, are left out.
+const checksumScript = `set -e
+cd -- "$1"
+shift
+find "$@" -type f -exec sha256sum {} +
+find "$@" ! -type f ! -type s | while IFS= read -r p; do
+  if [ -L "$p" ]; then sum="link:$(readlink "$p" | sha256sum | cut -d' ' -f1)"
+  elif [ -d "$p" ]; then sum="dir:"
+  elif [ -p "$p" ]; then sum="fifo:"
+  else sum="dev:"
+  fi
+  printf '%s  %s\n' "$sum" "$p"
+done`
+
+// checksums returns the sorted checksumScript lines of the entries under
+// rel (relative to dir on the PVC).
+func (c *Client) checksums(ctx context.Context, ref PVCRef, dir string, rel []string) ([]string, error) {
+	stdout, stderr, err := c.execOnPVC(ctx, ref.Namespace, ref.PVC, func(mountPath string) []string {
+		return concatArgs([]string{"sh", "-c", checksumScript, "sh", pvcPath(mountPath, dir)}, rel...)
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			return nil, streamError(ke, stderr)
+		}
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines, nil
+}
+
+// VerifyCopy checks that every entry under paths on src has a copy under
+// destDir on dst: regular files with the same content, links to the same
+// target, and directories, FIFOs and devices of the same type. It returns
+// the number of regular files compared.
+func (c *Client) VerifyCopy(ctx context.Context, src PVCRef, paths []string, dst PVCRef, destDir string) (int, error) {
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		rel[i] = relativePVCPath(p)
+	}
+	want, err := c.checksums(ctx, src, "/", rel)
+	if err != nil {
+		return 0, fmt.Errorf("checksumming source on %s: %w", src, err)
+	}
+	got, err := c.checksums(ctx, dst, destDir, rel)
+	if err != nil {
+		return 0, fmt.Errorf("checksumming copy on %s: %w", dst, err)
+	}
+	if missing, differ := diffChecksums(want, got); missing != "" || differ != "" {
+		if missing != "" {
+			return 0, fmt.Errorf("verification failed: %s is missing on %s", missing, dst)
+		}
+		return 0, fmt.Errorf("verification failed: %s differs on %s", differ, dst)
+	}
+	files := 0
+	for _, line := range want {
+		if sum, _, _ := strings.Cut(line, "  "); !strings.Contains(sum, ":") {
+			files++
+		}
+	}
+	return files, nil
+}
+
+// diffChecksums returns the first entry of want that is absent from got, or
+// the first whose checksum or type differs. Extra files in got are ignored: the
+// destination directory may already hold other data.
+func diffChecksums(want, got []string) (missing, differ string) {
+	byPath := make(map[string]string, len(got))
+	for _, line := range got {
+		if sum, name, ok := strings.Cut(line, "  "); ok {
+			byPath[name] = sum
+		}
+	}
+	for _, line := range want {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		other, found := byPath[name]
+		switch {
+		case !found:
+			return name, ""
+		case other != sum:
+			return "", name
+		}
+	}
+	return "", ""
+}
+
+// MoveStage is reported through the progress callbacks of MoveBetweenPVCs.
+type MoveStage string
+
+const (
+	MoveCopying   MoveStage = "copying"
+	MoveVerifying MoveStage = "verifying"
+	MoveDeleting  MoveStage = "deleting"
+)
+
+// MoveBetweenPVCs copies paths from src into destDir on dst, verifies every
+// entry with VerifyCopy and only then deletes the originals. A failure at any
+// stage leaves the source untouched, and running the move again resumes
+// the copy: files already on dst with a matching checksum are not resent.
+func (c *Client) MoveBetweenPVCs(ctx context.Context, src PVCRef, paths []string, dst PVCRef, destDir string, stage func(MoveStage), progress func(int64)) (int, error) {
+	if src == dst {
+		return 0, fmt.Errorf("source and destination are the same PVC; move between two claims")
+	}
+	if err := c.inScope(src.Namespace, dst.Namespace); err != nil {
+		return 0, err
+	}
+	for _, p := range paths {
+		if relativePVCPath(p) == "." {
+			return 0, fmt.Errorf("cannot move the root of a PVC; select the entries inside it")
+		}
+	}
+	if stage == nil {
+		stage = func(MoveStage) {}
+	}
+
+	stage(MoveCopying)
+	if _, err := c.resumeCopy(ctx, src, paths, dst, destDir, progress); err != nil {
+		return 0, err
+	}
+	stage(MoveVerifying)
+	files, err := c.VerifyCopy(ctx, src, paths, dst, destDir)
+	if err != nil {
+		return 0, err
+	}
+	stage(MoveDeleting)
+	_, stderr, err := c.execOnPVC(ctx, src.Namespace, src.PVC, func(mountPath string) []string {
+		cmd := []string{"rm", "-rf", "--"}
+		for _, p := range paths {
+			cmd = append(cmd, pvcPath(mountPath, p))
+		}
+		return cmd
+	})
+	if err != nil {
+		if ke, ok := err.(*K8sError); ok {
+			err = streamError(ke, stderr)
+		}
+		return files, fmt.Errorf("copy verified but deleting the source failed: %w", err)
+	}
+	return files, nil
+}
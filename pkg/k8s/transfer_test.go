@@ -0,0 +1,191 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTransferClient(mock *mockPodExecutor) *Client {
+	dst := runningPodWithPVC("new-pvc")
+	dst.Name = "other-pod"
+	dst.Spec.Containers[0].VolumeMounts[0].MountPath = "/mnt"
+	return &Client{clientset: fake.NewSimpleClientset(runningPodWithPVC("my-pvc"), dst), executor: mock}
+}
+
+var (
+	srcRef = PVCRef{Namespace: "default", PVC: "my-pvc"}
+	dstRef = PVCRef{Namespace: "default", PVC: "new-pvc"}
+)
+
+func TestMoveBetweenPVCs(t *testing.T) {
+	mock := &mockPodExecutor{}
+	// Nothing of an earlier attempt on the destination: a full copy.
+	mock.pushStream("", "", nil)
+	// Both ends of the copy run concurrently, so either may pick up either
+	// result; the source's stdout is what reaches the destination's stdin.
+	mock.pushStream("tar-stream", "", nil)
+	mock.pushStream("tar-stream", "", nil)
+	mock.pushExec("aaa  logs/a.log\nbbb  logs/b.log\n", "", nil)
+	mock.pushExec("bbb  logs/b.log\naaa  logs/a.log\nccc  unrelated\n", "", nil)
+	mock.pushExec("", "", nil)
+	c := newTransferClient(mock)
+
+	var stages []MoveStage
+	var copied int64
+	files, err := c.MoveBetweenPVCs(context.Background(), srcRef, []string{"/logs"}, dstRef, "/archive",
+		func(s MoveStage) { stages = append(stages, s) }, func(n int64) { copied = n })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files != 2 || copied != int64(len("tar-stream")) {
+		t.Errorf("files=%d copied=%d", files, copied)
+	}
+	if got := strings.Join([]string{string(stages[0]), string(stages[1]), string(stages[2])}, ","); got != "copying,verifying,deleting" {
+		t.Errorf("unexpected stages: %s", got)
+	}
+
+	var unpack *execCall
+	if cmd := mock.streamCalls[0].cmd; cmd[2] != inventoryScript || cmd[4] != "/mnt/archive" || cmd[5] != "logs" {
+		t.Errorf("unexpected resume check: %v", cmd)
+	}
+	for i, call := range mock.streamCalls[1:] {
+		i++
+		if call.podName == "other-pod" {
+			unpack = &mock.streamCalls[i]
+			if string(mock.streamStdin[i]) != "tar-stream" {
+				t.Errorf("destination received %q", mock.streamStdin[i])
+			}
+		} else if cmd := strings.Join(call.cmd, " "); cmd != "tar cf - -C /data -- logs" {
+			t.Errorf("unexpected source command: %s", cmd)
+		}
+	}
+	if unpack == nil || unpack.cmd[4] != "/mnt/archive" {
+		t.Fatalf("unexpected destination command: %+v", unpack)
+	}
+	if cmd := strings.Join(mock.execCalls[1].cmd, " "); !strings.HasSuffix(cmd, "sh /mnt/archive logs") {
+		t.Errorf("unexpected destination checksum command: %s", cmd)
+	}
+	if cmd := strings.Join(mock.execCalls[2].cmd, " "); cmd != "rm -rf -- /data/logs" {
+		t.Errorf("unexpected delete command: %s", cmd)
+	}
+}
+
+func TestMoveBetweenPVCsKeepsSourceOnMismatch(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("", "", nil)
+	mock.pushStream("", "", nil)
+	mock.pushStream("", "", nil)
+	mock.pushExec("aaa  logs/a.log\n", "", nil)
+	mock.pushExec("zzz  logs/a.log\n", "", nil)
+	c := newTransferClient(mock)
+
+	_, err := c.MoveBetweenPVCs(context.Background(), srcRef, []string{"/logs"}, dstRef, "/", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "logs/a.log differs") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if len(mock.execCalls) != 2 {
+		t.Errorf("source must not be deleted after a failed verification, exec calls: %+v", mock.execCalls)
+	}
+}
+
+func TestMoveBetweenPVCsRejectsInvalidRequests(t *testing.T) {
+	c := newTransferClient(&mockPodExecutor{})
+	if _, err := c.MoveBetweenPVCs(context.Background(), srcRef, []string{"/a"}, srcRef, "/b", nil, nil); err == nil {
+		t.Error("expected move within the same PVC to be rejected")
+	}
+	if _, err := c.MoveBetweenPVCs(context.Background(), srcRef, []string{"/"}, dstRef, "/", nil, nil); err == nil {
+		t.Error("expected move of the PVC root to be rejected")
+	}
+}
+
+func TestDiffChecksums(t *testing.T) {
+	want := []string{"a  x", "b  y"}
+	if m, d := diffChecksums(want, []string{"a  x"}); m != "y" || d != "" {
+		t.Errorf("missing: got %q, %q", m, d)
+	}
+	if m, d := diffChecksums(want, []string{"a  x", "c  y"}); m != "" || d != "y" {
+		t.Errorf("differ: got %q, %q", m, d)
+	}
+	if m, d := diffChecksums(want, []string{"b  y", "a  x", "z  extra"}); m != "" || d != "" {
+		t.Errorf("match: got %q, %q", m, d)
+	}
+}
+
+func TestChecksumScriptCoversEveryEntryType(t *testing.T) {
+	checksum := func(dir string) []string {
+		out, err := exec.Command("sh", "-c", checksumScript, "sh", dir, "logs").CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+	tree := func() string {
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "logs", "empty"), 0o755)
+		os.WriteFile(filepath.Join(dir, "logs", "a.log"), []byte("a"), 0o644)
+		os.Symlink("a.log", filepath.Join(dir, "logs", "current"))
+		syscall.Mkfifo(filepath.Join(dir, "logs", "pipe"), 0o644)
+		return dir
+	}
+
+	src := tree()
+	want := checksum(src)
+	kinds := map[string]string{}
+	for _, line := range want {
+		sum, name, _ := strings.Cut(line, "  ")
+		if kind, _, ok := strings.Cut(sum, ":"); ok {
+			sum = kind
+		}
+		kinds[name] = sum
+	}
+	if len(kinds) != 5 || kinds["logs"] != "dir" || kinds["logs/empty"] != "dir" || kinds["logs/current"] != "link" || kinds["logs/pipe"] != "fifo" ||
+		kinds["logs/a.log"] != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Errorf("unexpected entries: %v", want)
+	}
+	if m, d := diffChecksums(want, checksum(tree())); m != "" || d != "" {
+		t.Errorf("identical trees reported %q missing, %q differing", m, d)
+	}
+
+	// A link missing or pointing elsewhere, or an empty directory left out,
+	// fails the verification.
+	dst := tree()
+	os.Remove(filepath.Join(dst, "logs", "current"))
+	if m, _ := diffChecksums(want, checksum(dst)); m != "logs/current" {
+		t.Errorf("expected the missing link to be reported, got %q", m)
+	}
+	os.Symlink("b.log", filepath.Join(dst, "logs", "current"))
+	if _, d := diffChecksums(want, checksum(dst)); d != "logs/current" {
+		t.Errorf("expected the changed link to be reported, got %q", d)
+	}
+	dst = tree()
+	os.Remove(filepath.Join(dst, "logs", "empty"))
+	if m, _ := diffChecksums(want, checksum(dst)); m != "logs/empty" {
+		t.Errorf("expected the missing directory to be reported, got %q", m)
+	}
+}
+
+func TestUnpackArchiveCommand(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("", "", nil)
+	c := newTransferClient(mock)
+
+	if err := c.UnpackArchive(context.Background(), "default", "new-pvc", "/import", strings.NewReader("tar-stream")); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(mock.streamCalls[0].cmd, " "); got != "sh -c "+unpackScript+" sh /mnt/import" {
+		t.Errorf("unexpected command: %s", got)
+	}
+	if string(mock.streamStdin[0]) != "tar-stream" {
+		t.Errorf("expected the archive on stdin, got %q", mock.streamStdin[0])
+	}
+}
@@ -0,0 +1,427 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	gopath "path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Windows containers have none of the POSIX tools the other strategies
+// rely on, and a helper pod cannot help: its image is Linux and the volume
+// is attached to a Windows node. Pods on Windows nodes are therefore
+// browsed with PowerShell in the container itself: Get-ChildItem piped to
+// ConvertTo-Json lists a directory, and Get-Content -Encoding Byte reads a
+// file. PowerShell re-encodes whatever it writes to the console in the
+// container's code page, so every script prints base64 only, which
+// survives any code page, and decodes its arguments from the script text.
+// Listing, previews, downloads and uploads work this way; anything else
+// fails with an error that says so.
+
+// powerShells are tried in turn: Windows PowerShell ships with Server Core
+// images, while Nano Server images only have PowerShell 7 if they add it.
+var powerShells = []string{"powershell", "pwsh"}
+
+// windowsReadChunk is how many bytes Get-Content hands the pipeline at a
+// time, and so how many each base64 line of a download carries. A multiple
+// of 3 keeps every line a complete base64 block.
+const windowsReadChunk = 48 << 10
+
+// podIsWindows reports whether pod runs on a Windows node, by its declared
+// OS or else by the node selector that schedules it there.
+func podIsWindows(pod *corev1.Pod) bool {
+	if pod.Spec.OS != nil {
+		return pod.Spec.OS.Name == corev1.Windows
+	}
+	return pod.Spec.NodeSelector[corev1.LabelOSStable] == string(corev1.Windows)
+}
+
+// powerShellCommand runs script with shell. -EncodedCommand takes the
+// script as base64 UTF-16, so no quoting in it is touched by the Windows
+// command line on the way in.
+func powerShellCommand(shell, script string) []string {
+	units := utf16.Encode([]rune(script))
+	raw := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(raw[2*i:], u)
+	}
+	return []string{shell, "-NoLogo", "-NoProfile", "-NonInteractive", "-EncodedCommand", base64.StdEncoding.EncodeToString(raw)}
+}
+
+// psString is s as a PowerShell expression. The string is decoded from
+// base64 in the script, so names in any alphabet and with any quote
+// characters arrive unchanged.
+func psString(s string) string {
+	return "([Text.Encoding]::UTF8.GetString([Convert]::FromBase64String('" + base64.StdEncoding.EncodeToString([]byte(s)) + "')))"
+}
+
+// windowsListScript prints the entries of directory %[1]s as a base64
+// JSON array.
+const windowsListScript = `$ErrorActionPreference = 'Stop'
+$dir = Get-Item -LiteralPath %[1]s -Force
+if (-not $dir.PSIsContainer) { throw "Not a directory: $($dir.FullName)" }
+$items = @(Get-ChildItem -LiteralPath $dir.FullName -Force | ForEach-Object {
+	$target = ''
+	if ($_.LinkType) { $target = [string](@($_.Target)[0]) }
+	[pscustomobject]@{
+		name = $_.Name
+		dir = [bool]$_.PSIsContainer
+		size = $(if ($_.PSIsContainer) { 0 } else { $_.Length })
+		mtime = $_.LastWriteTimeUtc.ToString('o')
+		linkType = [string]$_.LinkType
+		target = $target
+	}
+})
+$json = ConvertTo-Json -InputObject $items -Compress
+[Console]::Out.Write([Convert]::ToBase64String([Text.Encoding]::UTF8.GetBytes($json)))`
+
+// windowsReadScript prints a JSON line describing file %[1]s, then, for a
+// regular file, its first %[2]d bytes (all of them when negative) as lines
+// of base64.
+const windowsReadScript = `$ErrorActionPreference = 'Stop'
+$file = Get-Item -LiteralPath %[1]s -Force
+$size = 0
+if (-not $file.PSIsContainer) { $size = $file.Length }
+$header = [pscustomobject]@{ dir = [bool]$file.PSIsContainer; size = $size; mtime = $file.LastWriteTimeUtc.ToString('o') }
+[Console]::Out.WriteLine((ConvertTo-Json -InputObject $header -Compress))
+if ($file.PSIsContainer) { exit 0 }
+$read = @{ Encoding = 'Byte' }
+if ($PSVersionTable.PSVersion.Major -ge 6) { $read = @{ AsByteStream = $true } }
+if (%[2]d -ge 0) { $read.TotalCount = %[2]d }
+Get-Content -LiteralPath $file.FullName -ReadCount %[3]d @read | ForEach-Object {
+	[Console]::Out.WriteLine([Convert]::ToBase64String([byte[]]$_))
+}`
+
+// windowsWriteScript writes its standard input to file %[1]s. When %[2]d
+// is not negative the file must end up that long, or it is removed, and
+// its modification time is set to %[3]s.
+const windowsWriteScript = `$ErrorActionPreference = 'Stop'
+$path = %[1]s
+$out = [IO.File]::Create($path)
+try { [Console]::OpenStandardInput().CopyTo($out) } finally { $out.Close() }
+if (%[2]d -ge 0) {
+	$written = (Get-Item -LiteralPath $path -Force).Length
+	if ($written -ne %[2]d) {
+		Remove-Item -LiteralPath $path -Force
+		throw "upload ended after $written of %[2]d bytes"
+	}
+	[IO.File]::SetLastWriteTimeUtc($path, [DateTime]::Parse(%[3]s, $null, 'RoundtripKind'))
+}`
+
+// windowsRemoveScript deletes file %[1]s if it exists.
+const windowsRemoveScript = `$ErrorActionPreference = 'Stop'
+Remove-Item -LiteralPath %[1]s -Force -ErrorAction SilentlyContinue`
+
+// classifyWindowsError is classifyExecError for PowerShell, whose errors
+// are worded differently from the POSIX tools'.
+func classifyWindowsError(err error, stderr string) *K8sError {
+	kerr := classifyExecError(err, stderr)
+	if kerr.Kind != ErrKindUnknown {
+		return kerr
+	}
+	lower := strings.ToLower(stderr)
+	switch {
+	case strings.Contains(lower, "because it does not exist"):
+		return &K8sError{Kind: ErrKindPathNotFound, Message: "Path not found inside the Windows container.", Cause: err}
+	case strings.Contains(lower, "is denied"):
+		return &K8sError{Kind: ErrKindPermDenied, Message: "Access to the path is denied inside the Windows container.", Cause: err}
+	case strings.TrimSpace(stderr) == "" && strings.Contains(strings.ToLower(err.Error()), "cannot find the file specified"):
+		// The container runtime could not start the executable.
+		return &K8sError{Kind: ErrKindNoShell, Message: "executable not found", Cause: err}
+	}
+	return kerr
+}
+
+// windowsExecError explains why an operation that needs POSIX tools failed
+// in a Windows container, rather than promising a helper pod.
+func windowsExecError(info *podPVCInfo, err *K8sError) *K8sError {
+	if err.Kind != ErrKindNoShell {
+		return err
+	}
+	return &K8sError{
+		Kind:    ErrKindNoShell,
+		Message: fmt.Sprintf("Pod %s runs on Windows, where KubeBrowser can only list, preview, download and upload files. Helper pods need a Linux node.", info.podName),
+		Cause:   err.Cause,
+	}
+}
+
+// noPowerShellError is returned when none of powerShells could be started.
+func noPowerShellError(info *podPVCInfo, err *K8sError) *K8sError {
+	return &K8sError{
+		Kind:    ErrKindNoShell,
+		Message: fmt.Sprintf("Pod %s runs on Windows but has neither powershell nor pwsh, which KubeBrowser needs to browse it. Helper pods need a Linux node.", info.podName),
+		Cause:   err.Cause,
+	}
+}
+
+// runPowerShell runs script in the pod mounting the PVC and returns what
+// it printed.
+func (c *Client) runPowerShell(ctx context.Context, namespace string, info *podPVCInfo, script string) (string, error) {
+	if !c.allows(namespace, StrategyExec) {
+		return "", c.noAccessError(namespace, nil)
+	}
+	var kerr *K8sError
+	for _, shell := range powerShells {
+		stdout, stderr, err := c.getExecutor().execInPod(ctx, namespace, info.podName, info.containerName, powerShellCommand(shell, script))
+		if err == nil {
+			return stdout, nil
+		}
+		kerr = classifyWindowsError(err, stderr)
+		if kerr.Kind != ErrKindNoShell {
+			return "", streamError(kerr, stderr)
+		}
+	}
+	return "", noPowerShellError(info, kerr)
+}
+
+// streamPowerShell is runPowerShell with the script's input and output
+// streamed. The next shell is only tried while neither has moved a byte.
+func (c *Client) streamPowerShell(ctx context.Context, namespace string, info *podPVCInfo, script string, stdin io.Reader, stdout io.Writer) error {
+	if !c.allows(namespace, StrategyExec) {
+		return c.noAccessError(namespace, nil)
+	}
+	var in *countingReader
+	var inReader io.Reader
+	if stdin != nil {
+		in = &countingReader{r: stdin}
+		inReader = in
+	}
+	out := &countingWriter{w: stdout}
+
+	var kerr *K8sError
+	for _, shell := range powerShells {
+		stderr, err := c.getExecutor().execInPodStream(ctx, namespace, info.podName, info.containerName, powerShellCommand(shell, script), inReader, out)
+		if err == nil {
+			return nil
+		}
+		kerr = classifyWindowsError(err, stderr)
+		if kerr.Kind != ErrKindNoShell || out.n > 0 || (in != nil && in.n > 0) {
+			return streamError(kerr, stderr)
+		}
+	}
+	return noPowerShellError(info, kerr)
+}
+
+// windowsEntry is one element of the array windowsListScript prints.
+type windowsEntry struct {
+	Name     string `json:"name"`
+	Dir      bool   `json:"dir"`
+	Size     int64  `json:"size"`
+	MTime    string `json:"mtime"`
+	LinkType string `json:"linkType"`
+	Target   string `json:"target"`
+}
+
+// parseWindowsListing parses what windowsListScript prints for the
+// directory path. Windows reports a link to a directory (or a junction)
+// as a directory and Get-ChildItem lists through it, so such entries are
+// marked IsDir as well as Symlink. Windows has no mode bits or numeric
+// owners to report.
+func parseWindowsListing(stdout, path string) ([]FileInfo, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected PowerShell listing: %w", err)
+	}
+	var entries []windowsEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("unexpected PowerShell listing: %w", err)
+	}
+	files := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.Name == "" || e.Name == "." || e.Name == ".." {
+			continue
+		}
+		mtime, _ := time.Parse(time.RFC3339Nano, e.MTime)
+		link := e.LinkType == "SymbolicLink" || e.LinkType == "Junction"
+		f := FileInfo{
+			Name:    e.Name,
+			Size:    strconv.FormatInt(e.Size, 10),
+			ModTime: formatModTime(mtime),
+			IsDir:   e.Dir,
+			Path:    buildFilePath(path, e.Name),
+			Symlink: link,
+		}
+		if link {
+			f.LinkTarget = e.Target
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// listFilesWindows lists path in a Windows container.
+func (c *Client) listFilesWindows(ctx context.Context, namespace string, info *podPVCInfo, path string) ([]FileInfo, error) {
+	log.Printf("Listing files on %s/%s with PowerShell (container: %s, mount: %s, path: %q)", namespace, info.podName, info.containerName, info.mountPath, path)
+	stdout, err := c.runPowerShell(ctx, namespace, info, fmt.Sprintf(windowsListScript, psString(pvcPath(info.mountPath, path))))
+	if err != nil {
+		return nil, err
+	}
+	files, err := parseWindowsListing(stdout, path)
+	if err != nil {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: err.Error()}
+	}
+	return files, nil
+}
+
+// windowsFileHeader is the first line windowsReadScript prints.
+type windowsFileHeader struct {
+	Dir   bool   `json:"dir"`
+	Size  int64  `json:"size"`
+	MTime string `json:"mtime"`
+}
+
+// readWindowsHeader reads the header line windowsReadScript starts with.
+func readWindowsHeader(br *bufio.Reader, name string) (*windowsFileHeader, error) {
+	line, err := br.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, fmt.Errorf("download of %s produced no output", name)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var hdr windowsFileHeader
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &hdr); err != nil {
+		return nil, fmt.Errorf("unexpected PowerShell output: %q", strings.TrimSpace(line))
+	}
+	if hdr.Dir {
+		return nil, &K8sError{Kind: ErrKindUnknown, Message: fmt.Sprintf("%s is a directory; download it as an archive instead", name)}
+	}
+	return &hdr, nil
+}
+
+// copyBase64Lines decodes the base64 lines that follow the header into w
+// and returns how many bytes it wrote.
+func copyBase64Lines(w io.Writer, br *bufio.Reader) (int64, error) {
+	var n int64
+	for {
+		line, err := br.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			chunk, derr := base64.StdEncoding.DecodeString(line)
+			if derr != nil {
+				return n, fmt.Errorf("unexpected PowerShell output: %w", derr)
+			}
+			m, werr := w.Write(chunk)
+			n += int64(m)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// streamFileWindows streams windowsReadScript's output for the whole of
+// filePath to w.
+func (c *Client) streamFileWindows(ctx context.Context, namespace string, info *podPVCInfo, filePath string, w io.Writer) error {
+	script := fmt.Sprintf(windowsReadScript, psString(pvcPath(info.mountPath, filePath)), -1, windowsReadChunk)
+	return c.streamPowerShell(ctx, namespace, info, script, nil, w)
+}
+
+// unpackWindows is unpack for the output of streamFileWindows. The header
+// line plays the part of the tar header, so a transfer cut short is caught
+// the same way.
+func (d *downloadReader) unpackWindows(r io.Reader, w io.Writer, name string) error {
+	br := bufio.NewReaderSize(r, 2*windowsReadChunk)
+	hdr, err := readWindowsHeader(br, name)
+	if err != nil {
+		return err
+	}
+	mtime, _ := time.Parse(time.RFC3339Nano, hdr.MTime)
+	d.header.Store(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: hdr.Size, Mode: 0o644, ModTime: mtime})
+
+	n, err := copyBase64Lines(w, br)
+	if err != nil {
+		return err
+	}
+	if n != hdr.Size {
+		return fmt.Errorf("download of %s ended after %d of %d bytes", name, n, hdr.Size)
+	}
+	return nil
+}
+
+// readFileHeadWindows is ReadFileHead for a Windows container.
+func (c *Client) readFileHeadWindows(ctx context.Context, namespace string, info *podPVCInfo, filePath string, limit int) ([]byte, bool, error) {
+	script := fmt.Sprintf(windowsReadScript, psString(pvcPath(info.mountPath, filePath)), limit+1, windowsReadChunk)
+	stdout, err := c.runPowerShell(ctx, namespace, info, script)
+	if err != nil {
+		return nil, false, err
+	}
+	br := bufio.NewReader(strings.NewReader(stdout))
+	if _, err := readWindowsHeader(br, gopath.Base(filePath)); err != nil {
+		return nil, false, err
+	}
+	var data strings.Builder
+	if _, err := copyBase64Lines(&data, br); err != nil {
+		return nil, false, err
+	}
+	if data.Len() > limit {
+		return []byte(data.String()[:limit]), true, nil
+	}
+	return []byte(data.String()), false, nil
+}
+
+// uploadFileWindows is UploadFile for a Windows container. The file is
+// written from stdin as it arrives; for an UploadSource the script checks
+// the length and keeps ModTime, as tar does elsewhere.
+func (c *Client) uploadFileWindows(ctx context.Context, namespace, pvcName string, info *podPVCInfo, destPath string, data io.Reader) error {
+	size, modTime := int64(-1), time.Now()
+	stdin := data
+	var body *io.PipeReader
+	var framing chan error
+	if src, ok := data.(*UploadSource); ok {
+		size = src.Size
+		if !src.ModTime.IsZero() {
+			modTime = src.ModTime
+		}
+		var bodyW *io.PipeWriter
+		body, bodyW = io.Pipe()
+		framing = make(chan error, 1)
+		go func() {
+			err := copyUploadBody(bodyW, src)
+			bodyW.CloseWithError(err)
+			framing <- err
+		}()
+		stdin = body
+	}
+
+	in := &countingReader{r: stdin}
+	script := fmt.Sprintf(windowsWriteScript, psString(pvcPath(info.mountPath, destPath)), size, psString(modTime.UTC().Format(time.RFC3339Nano)))
+	err := c.streamPowerShell(ctx, namespace, info, script, in, io.Discard)
+	if body != nil {
+		body.CloseWithError(io.ErrClosedPipe)
+		if ferr := <-framing; ferr != nil && !errors.Is(ferr, io.ErrClosedPipe) {
+			err = ferr
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if in.n > 0 {
+		c.schedulePartialUploadRemoval(namespace, pvcName, destPath)
+	}
+	return fmt.Errorf("failed to upload file: %w", err)
+}
+
+// removeFileWindows is RemoveFile for a Windows container.
+func (c *Client) removeFileWindows(ctx context.Context, namespace string, info *podPVCInfo, filePath string) error {
+	_, err := c.runPowerShell(ctx, namespace, info, fmt.Sprintf(windowsRemoveScript, psString(pvcPath(info.mountPath, filePath))))
+	return err
+}
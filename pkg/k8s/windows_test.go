@@ -0,0 +1,214 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// windowsPodWithPVC is runningPodWithPVC scheduled on a Windows node.
+func windowsPodWithPVC(pvcName string) *corev1.Pod {
+	pod := runningPodWithPVC(pvcName)
+	pod.Spec.OS = &corev1.PodOS{Name: corev1.Windows}
+	pod.Spec.Containers[0].VolumeMounts[0].MountPath = `C:\data`
+	return pod
+}
+
+// decodedScript returns the script a powerShellCommand carries.
+func decodedScript(t *testing.T, cmd []string) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(cmd[len(cmd)-1])
+	if err != nil || len(raw)%2 != 0 {
+		t.Fatalf("bad -EncodedCommand %q: %v", cmd[len(cmd)-1], err)
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// windowsFileOutput is what windowsReadScript prints for content, split
+// into lines of chunk bytes.
+func windowsFileOutput(content string, size int, chunk int) string {
+	out := fmt.Sprintf("{\"dir\":false,\"size\":%d,\"mtime\":\"2024-05-01T10:00:00.1234567Z\"}\r\n", size)
+	for len(content) > 0 {
+		n := min(chunk, len(content))
+		out += base64.StdEncoding.EncodeToString([]byte(content[:n])) + "\r\n"
+		content = content[n:]
+	}
+	return out
+}
+
+func TestPodIsWindows(t *testing.T) {
+	pod := runningPodWithPVC("my-pvc")
+	if podIsWindows(pod) {
+		t.Error("a pod without an OS is not Windows")
+	}
+	pod.Spec.NodeSelector = map[string]string{"kubernetes.io/os": "windows"}
+	if !podIsWindows(pod) {
+		t.Error("a pod selecting Windows nodes is Windows")
+	}
+	pod.Spec.OS = &corev1.PodOS{Name: corev1.Linux}
+	if podIsWindows(pod) {
+		t.Error("the declared OS wins over the node selector")
+	}
+}
+
+func TestListFilesWindows(t *testing.T) {
+	listing := `[{"name":"report ’24.txt","dir":false,"size":12,"mtime":"2024-05-01T10:00:00.1234567Z","linkType":"","target":""},` +
+		`{"name":"logs","dir":true,"size":0,"mtime":"2024-05-01T10:00:00Z","linkType":"","target":""},` +
+		`{"name":"current","dir":true,"size":0,"mtime":"2024-05-01T10:00:00Z","linkType":"Junction","target":"C:\\data\\logs"}]`
+	mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+	mock.pushExec("", "'powershell': executable file not found in %PATH%", errors.New("exec failed"))
+	mock.pushExec(base64.StdEncoding.EncodeToString([]byte(listing)), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	files, err := c.ListFiles(context.Background(), "default", "my-pvc", "/in box")
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(mock.execCalls) != 2 || mock.execCalls[0].cmd[0] != "powershell" || mock.execCalls[1].cmd[0] != "pwsh" {
+		t.Fatalf("expected powershell, then pwsh, got %v", mock.execCalls)
+	}
+	script := decodedScript(t, mock.execCalls[1].cmd)
+	if !strings.Contains(script, "Get-ChildItem") || !strings.Contains(script, psString(`C:\data/in box`)) {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %+v", files)
+	}
+	if f := files[0]; f.Name != "report ’24.txt" || f.Path != "/in box/report ’24.txt" || f.Size != "12" || f.ModTime != "2024-05-01T10:00:00Z" || f.IsDir {
+		t.Errorf("file = %+v", f)
+	}
+	if f := files[2]; !f.IsDir || !f.Symlink || f.LinkTarget != `C:\data\logs` {
+		t.Errorf("junction = %+v", f)
+	}
+	if mock.createCalled != 0 {
+		t.Error("a Windows pod must not get a helper pod")
+	}
+}
+
+func TestListFilesWindowsWithoutPowerShell(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+	for range powerShells {
+		mock.pushExec("", "", errors.New("failed to create process: The system cannot find the file specified."))
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	_, err := c.ListFiles(context.Background(), "default", "my-pvc", "/")
+	var kerr *K8sError
+	if !errors.As(err, &kerr) || kerr.Kind != ErrKindNoShell || !strings.Contains(kerr.Message, "neither powershell nor pwsh") {
+		t.Fatalf("err = %v", err)
+	}
+	if mock.createCalled != 0 {
+		t.Error("a Windows pod must not get a helper pod")
+	}
+}
+
+func TestListFilesWindowsMissingPath(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec("", `Get-Item : Cannot find path 'C:\data\nope' because it does not exist.`, errors.New("command terminated with exit code 1"))
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	_, err := c.ListFiles(context.Background(), "default", "my-pvc", "/nope")
+	var kerr *K8sError
+	if !errors.As(err, &kerr) || kerr.Kind != ErrKindPathNotFound {
+		t.Fatalf("err = %v", err)
+	}
+	if len(mock.execCalls) != 1 {
+		t.Errorf("a missing path should not try the next shell, got %d calls", len(mock.execCalls))
+	}
+}
+
+func TestDownloadFileWindows(t *testing.T) {
+	content := "\x00\xff\r\n binary, and more than one chunk of it"
+	mock := &mockPodExecutor{}
+	mock.pushStream(windowsFileOutput(content, len(content), 9), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	reader, name, err := c.DownloadFile(context.Background(), "default", "my-pvc", "/logs/app.log")
+	if err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil || string(data) != content || name != "app.log" {
+		t.Fatalf("got %q (%s, err=%v)", data, name, err)
+	}
+	if script := decodedScript(t, mock.streamCalls[0].cmd); !strings.Contains(script, "Get-Content") {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+	if hdr := reader.(FileHeader).Header(); hdr == nil || hdr.Size != int64(len(content)) || hdr.ModTime.Year() != 2024 {
+		t.Errorf("expected the file's metadata, got %+v", hdr)
+	}
+}
+
+func TestDownloadFileWindowsDetectsTruncation(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream(windowsFileOutput("first half", 20, 48), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	reader, _, _ := c.DownloadFile(context.Background(), "default", "my-pvc", "/big.bin")
+	defer reader.Close()
+	if data, err := io.ReadAll(reader); err == nil || !strings.Contains(err.Error(), "ended after 10 of 20 bytes") {
+		t.Errorf("expected a short stream to fail, got %q, %v", data, err)
+	}
+}
+
+func TestReadFileHeadWindows(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushExec(windowsFileOutput("0123456789a", 100, 4), "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	data, truncated, err := c.ReadFileHead(context.Background(), "default", "my-pvc", "/notes.txt", 10)
+	if err != nil || string(data) != "0123456789" || !truncated {
+		t.Errorf("got %q (truncated=%v, err=%v)", data, truncated, err)
+	}
+	if script := decodedScript(t, mock.execCalls[0].cmd); !strings.Contains(script, "if (11 -ge 0)") {
+		t.Errorf("expected the read limited to 11 bytes:\n%s", script)
+	}
+}
+
+func TestUploadFileWindows(t *testing.T) {
+	mock := &mockPodExecutor{}
+	mock.pushStream("", "", nil)
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	content := "\x00\xff\r\n binary"
+	src := &UploadSource{Reader: strings.NewReader(content), Size: int64(len(content))}
+	if err := c.UploadFile(context.Background(), "default", "my-pvc", "/in box/photo.jpg", src); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	if string(mock.streamStdin[0]) != content {
+		t.Errorf("expected the raw bytes on stdin, got %q", mock.streamStdin[0])
+	}
+	script := decodedScript(t, mock.streamCalls[0].cmd)
+	if !strings.Contains(script, psString(`C:\data/in box/photo.jpg`)) || !strings.Contains(script, fmt.Sprintf("if (%d -ge 0)", len(content))) {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+}
+
+func TestWindowsPodRefusesPOSIXOperations(t *testing.T) {
+	mock := &mockPodExecutor{createResult: "kube-browser-helper-abc"}
+	mock.pushExec("", "", errors.New(`exec: "sh": executable file not found in %PATH%`))
+	c := &Client{clientset: fake.NewSimpleClientset(windowsPodWithPVC("my-pvc")), executor: mock}
+
+	_, err := c.ResolvePath(context.Background(), "default", "my-pvc", "/logs")
+	var kerr *K8sError
+	if !errors.As(err, &kerr) || !strings.Contains(kerr.Message, "runs on Windows") {
+		t.Fatalf("err = %v", err)
+	}
+	if mock.createCalled != 0 {
+		t.Error("a Windows pod must not get a helper pod")
+	}
+}
@@ -0,0 +1,477 @@
+package preview
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Markdown renders the common subset of CommonMark/GFM found in READMEs
+// and docs: headings, paragraphs, emphasis, code, lists, block quotes,
+// tables, rules and links. Raw HTML in the source is escaped, and links
+// are only emitted for http, https and mailto URLs.
+func Markdown(src []byte) string {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(text, "\n"))
+	return b.String()
+}
+
+var (
+	atxHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	thematic     = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	setextH1     = regexp.MustCompile(`^ {0,3}=+\s*$`)
+	setextH2     = regexp.MustCompile(`^ {0,3}-+\s*$`)
+	fenceOpen    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})\\s*([^`\\s]*)")
+	listItem     = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(\s+|$)`)
+	tableDivider = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	fenceLang    = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+)
+
+func renderBlocks(b *strings.Builder, lines []string) {
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>")
+			b.WriteString(renderInline(strings.TrimRight(strings.Join(para, "\n"), " ")))
+			b.WriteString("</p>\n")
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+
+		case len(para) > 0 && setextH1.MatchString(line):
+			heading(b, 1, strings.Join(para, " "))
+			para = nil
+
+		case len(para) > 0 && setextH2.MatchString(line):
+			heading(b, 2, strings.Join(para, " "))
+			para = nil
+
+		case fenceOpen.MatchString(line):
+			flush()
+			m := fenceOpen.FindStringSubmatch(line)
+			i = codeBlock(b, lines, i+1, m[2], m[3])
+
+		case atxHeading.MatchString(line):
+			flush()
+			m := atxHeading.FindStringSubmatch(line)
+			heading(b, len(m[1]), m[2])
+
+		case thematic.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i], " "), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted)
+			b.WriteString("</blockquote>\n")
+
+		case listItem.MatchString(line):
+			flush()
+			i = list(b, lines, i)
+
+		case len(para) == 0 && strings.Contains(line, "|") && i+1 < len(lines) && tableDivider.MatchString(lines[i+1]):
+			i = table(b, lines, i)
+
+		default:
+			// Trailing spaces are kept: two of them mark a hard line break.
+			para = append(para, strings.TrimLeft(line, " "))
+		}
+	}
+	flush()
+}
+
+func heading(b *strings.Builder, level int, text string) {
+	tag := string(rune('0' + level))
+	b.WriteString("<h" + tag + ">")
+	b.WriteString(renderInline(strings.TrimSpace(text)))
+	b.WriteString("</h" + tag + ">\n")
+}
+
+// codeBlock writes a fenced block starting at lines[start] and returns
+// the index of its closing fence (or the last line when unterminated).
+func codeBlock(b *strings.Builder, lines []string, start int, fence, lang string) int {
+	i := start
+	var body []string
+	for ; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(t, fence[:3]) && strings.Trim(t, fence[:1]) == "" && len(t) >= len(fence) {
+			break
+		}
+		body = append(body, lines[i])
+	}
+	b.WriteString("<pre><code")
+	if fenceLang.MatchString(lang) {
+		b.WriteString(` class="language-` + lang + `"`)
+	}
+	b.WriteString(">")
+	b.WriteString(html.EscapeString(strings.Join(body, "\n")))
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// list writes the list starting at lines[start] and returns the index of
+// its last line. Items are rendered recursively, so nested lists and
+// multi-paragraph items work as long as they are indented.
+func list(b *strings.Builder, lines []string, start int) int {
+	first := listItem.FindStringSubmatch(lines[start])
+	indent := len(first[1])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag + ">\n")
+
+	var item []string
+	offset := len(first[0])
+	loose := false
+	emit := func() {
+		if item == nil {
+			return
+		}
+		b.WriteString("<li>")
+		if len(item) == 1 || !loose && !needsBlocks(item) {
+			b.WriteString(renderInline(strings.Join(item, "\n")))
+		} else {
+			b.WriteString("\n")
+			renderBlocks(b, item)
+		}
+		b.WriteString("</li>\n")
+		item = nil
+	}
+
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := listItem.FindStringSubmatch(line); m != nil && len(m[1]) == indent {
+			isOrdered := m[2][0] >= '0' && m[2][0] <= '9'
+			if isOrdered != ordered {
+				break
+			}
+			emit()
+			item = []string{strings.TrimSpace(line[len(m[0]):])}
+			offset = len(m[0])
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			// A blank line ends the list unless an indented line or another
+			// item follows it.
+			if i+1 < len(lines) && (leadingSpaces(lines[i+1]) > indent || listItem.MatchString(lines[i+1])) {
+				item = append(item, "")
+				loose = true
+				continue
+			}
+			break
+		}
+		if leadingSpaces(line) > indent {
+			item = append(item, dedent(line, offset))
+			continue
+		}
+		if thematic.MatchString(line) || atxHeading.MatchString(line) || fenceOpen.MatchString(line) {
+			break
+		}
+		// Lazy continuation of the item's paragraph.
+		item = append(item, strings.TrimSpace(line))
+	}
+	emit()
+	b.WriteString("</" + tag + ">\n")
+	return i - 1
+}
+
+func needsBlocks(lines []string) bool {
+	for _, l := range lines[1:] {
+		if listItem.MatchString(l) || fenceOpen.MatchString(l) || strings.HasPrefix(strings.TrimSpace(l), ">") {
+			return true
+		}
+	}
+	return false
+}
+
+func leadingSpaces(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " "))
+}
+
+func dedent(s string, n int) string {
+	if k := leadingSpaces(s); k < n {
+		n = k
+	}
+	return s[n:]
+}
+
+// table writes a GFM table whose header is lines[start] and returns the
+// index of its last row.
+func table(b *strings.Builder, lines []string, start int) int {
+	header := tableCells(lines[start])
+	var align []string
+	for _, d := range tableCells(lines[start+1]) {
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			align = append(align, "center")
+		case strings.HasSuffix(d, ":"):
+			align = append(align, "right")
+		case strings.HasPrefix(d, ":"):
+			align = append(align, "left")
+		default:
+			align = append(align, "")
+		}
+	}
+	row := func(cells []string, cellTag string) {
+		b.WriteString("<tr>")
+		for c := range header {
+			b.WriteString("<" + cellTag)
+			if c < len(align) && align[c] != "" {
+				b.WriteString(` style="text-align:` + align[c] + `"`)
+			}
+			b.WriteString(">")
+			if c < len(cells) {
+				b.WriteString(renderInline(cells[c]))
+			}
+			b.WriteString("</" + cellTag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	row(header, "th")
+	b.WriteString("</thead>\n<tbody>\n")
+	i := start + 2
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+		row(tableCells(lines[i]), "td")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i - 1
+}
+
+// tableCells splits a table row on unescaped pipes.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+const escapable = "\\`*_{}[]()#+-.!|~<>\""
+
+// renderInline renders emphasis, code spans, links and line breaks in
+// text, escaping everything else.
+func renderInline(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte(escapable, text[i+1]) >= 0:
+			b.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			if n, ok := codeSpan(&b, text[i:]); ok {
+				i += n
+				continue
+			}
+
+		case c == '!' && i+1 < len(text) && text[i+1] == '[':
+			// Images are shown as links: previews never fetch remote content.
+			if n, ok := link(&b, text[i+1:]); ok {
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if n, ok := link(&b, text[i:]); ok {
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(text[i:], '>'); end > 0 {
+				if target := text[i+1 : i+end]; safeURL(target) && !strings.ContainsAny(target, " \n") {
+					writeLink(&b, target, html.EscapeString(target))
+					i += end + 1
+					continue
+				}
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if n, ok := emphasis(&b, text, i); ok {
+				i += n
+				continue
+			}
+
+		case c == ' ' && strings.HasPrefix(text[i:], "  \n"):
+			b.WriteString("<br>\n")
+			i += 3
+			continue
+		}
+		b.WriteString(html.EscapeString(text[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// codeSpan renders a `code` span at the start of s and returns its length.
+func codeSpan(b *strings.Builder, s string) (int, bool) {
+	n := len(s) - len(strings.TrimLeft(s, "`"))
+	fence := s[:n]
+	rest := s[n:]
+	for off := 0; ; {
+		j := strings.Index(rest[off:], fence)
+		if j < 0 {
+			return 0, false
+		}
+		j += off
+		// The closing run must be exactly as long as the opening one.
+		if run := len(rest[j:]) - len(strings.TrimLeft(rest[j:], "`")); run != n {
+			off = j + run
+			continue
+		}
+		code := strings.ReplaceAll(rest[:j], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+			code = code[1 : len(code)-1]
+		}
+		b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		return n + j + n, true
+	}
+}
+
+// link renders [text](url "title") at the start of s and returns its
+// length. Unsafe targets keep the text but drop the link.
+func link(b *strings.Builder, s string) (int, bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return 0, false
+	}
+	end := strings.IndexByte(s[closeText+2:], ')')
+	if end < 0 {
+		return 0, false
+	}
+	dest := strings.TrimSpace(s[closeText+2 : closeText+2+end])
+	if sp := strings.IndexAny(dest, " \n"); sp >= 0 {
+		dest = dest[:sp] // drop an optional "title"
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+
+	label := renderInline(s[1:closeText])
+	if safeURL(dest) {
+		writeLink(b, dest, label)
+	} else {
+		b.WriteString(label)
+	}
+	return closeText + 2 + end + 1, true
+}
+
+func writeLink(b *strings.Builder, href, label string) {
+	b.WriteString(`<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer nofollow">`)
+	b.WriteString(label)
+	b.WriteString("</a>")
+}
+
+// safeURL accepts absolute http, https and mailto URLs. Relative links
+// are rejected too: they would resolve against KubeBrowser, not the PVC.
+func safeURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// emphasis renders *em*, **strong**, _em_, __strong__ and ~~del~~ at
+// text[i] and returns the length consumed.
+func emphasis(b *strings.Builder, text string, i int) (int, bool) {
+	c := text[i]
+	n := 1
+	if i+1 < len(text) && text[i+1] == c {
+		n = 2
+	}
+	if c == '~' && n != 2 {
+		return 0, false
+	}
+	delim := text[i : i+n]
+	start := i + n
+	if start >= len(text) || text[start] == ' ' || text[start] == '\n' {
+		return 0, false
+	}
+	// Underscores inside words (snake_case) are not emphasis.
+	if c == '_' && i > 0 && isWordByte(text[i-1]) {
+		return 0, false
+	}
+	for j := start + 1; j <= len(text)-n; j++ {
+		if text[j:j+n] != delim || text[j-1] == ' ' || text[j-1] == '\\' {
+			continue
+		}
+		if n == 1 && j+1 < len(text) && text[j+1] == c {
+			j++ // skip over a strong delimiter inside an em span
+			continue
+		}
+		if c == '_' && j+n < len(text) && isWordByte(text[j+n]) {
+			continue
+		}
+		tag := "em"
+		switch {
+		case c == '~':
+			tag = "del"
+		case n == 2:
+			tag = "strong"
+		}
+		b.WriteString("<" + tag + ">" + renderInline(text[start:j]) + "</" + tag + ">")
+		return j + n - i, true
+	}
+	return 0, false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,62 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownBlocks(t *testing.T) {
+	src := "# Title\n\nSome *em* and **strong** text\nwith `code`.\n\n" +
+		"- one\n- two\n  - nested\n\n1. first\n2. second\n\n" +
+		"> quoted\n\n```go\nfmt.Println(\"<hi>\")\n```\n\n---\n\n" +
+		"| a | b |\n|:--|--:|\n| 1 | 2 |\n\nSub\n===\n"
+	want := "<h1>Title</h1>\n" +
+		"<p>Some <em>em</em> and <strong>strong</strong> text\nwith <code>code</code>.</p>\n" +
+		"<ul>\n<li>one</li>\n<li>\n<p>two</p>\n<ul>\n<li>nested</li>\n</ul>\n</li>\n</ul>\n" +
+		"<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n" +
+		"<blockquote>\n<p>quoted</p>\n</blockquote>\n" +
+		"<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)</code></pre>\n" +
+		"<hr>\n" +
+		"<table>\n<thead>\n<tr><th style=\"text-align:left\">a</th><th style=\"text-align:right\">b</th></tr>\n</thead>\n" +
+		"<tbody>\n<tr><td style=\"text-align:left\">1</td><td style=\"text-align:right\">2</td></tr>\n</tbody>\n</table>\n" +
+		"<h1>Sub</h1>\n"
+	if got := Markdown([]byte(src)); got != want {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMarkdownInline(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"snake_case_name", "<p>snake_case_name</p>\n"},
+		{"_em_ and __strong__ and ~~gone~~", "<p><em>em</em> and <strong>strong</strong> and <del>gone</del></p>\n"},
+		{`\*not em\*`, "<p>*not em*</p>\n"},
+		{"``a ` b``", "<p><code>a ` b</code></p>\n"},
+		{"[docs](https://example.com/a?b=1&c=2 \"title\")",
+			`<p><a href="https://example.com/a?b=1&amp;c=2" target="_blank" rel="noopener noreferrer nofollow">docs</a></p>` + "\n"},
+		{"![logo](https://example.com/logo.png)",
+			`<p><a href="https://example.com/logo.png" target="_blank" rel="noopener noreferrer nofollow">logo</a></p>` + "\n"},
+		{"<https://example.com>", `<p><a href="https://example.com" target="_blank" rel="noopener noreferrer nofollow">https://example.com</a></p>` + "\n"},
+		{"line  \nbreak", "<p>line<br>\nbreak</p>\n"},
+	}
+	for _, tt := range tests {
+		if got := Markdown([]byte(tt.in)); got != tt.want {
+			t.Errorf("Markdown(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownSanitizes(t *testing.T) {
+	src := "<script>alert(1)</script>\n\n" +
+		"[x](javascript:alert(1)) [y](java\tscript:alert(1)) [z](data:text/html,hi) [rel](../other.md)\n\n" +
+		"<img src=x onerror=alert(1)>\n\n" +
+		"```\" onmouseover=\"alert(1)\n```\n"
+	got := Markdown([]byte(src))
+	for _, bad := range []string{"<script", "<img", "href=\"javascript", "href=\"data", "href=\"../", "onmouseover=\""} {
+		if strings.Contains(got, bad) {
+			t.Errorf("output contains %q:\n%s", bad, got)
+		}
+	}
+	if !strings.Contains(got, "&lt;script&gt;") {
+		t.Errorf("raw HTML should be escaped, got:\n%s", got)
+	}
+}
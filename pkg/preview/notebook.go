@@ -0,0 +1,182 @@
+package preview
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type notebook struct {
+	NBFormat int `json:"nbformat"`
+	Metadata struct {
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType       string           `json:"cell_type"`
+	Source         multiline        `json:"source"`
+	ExecutionCount *int             `json:"execution_count"`
+	Outputs        []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType     string                     `json:"output_type"`
+	Name           string                     `json:"name"`
+	Text           multiline                  `json:"text"`
+	Data           map[string]json.RawMessage `json:"data"`
+	ExecutionCount *int                       `json:"execution_count"`
+	EName          string                     `json:"ename"`
+	EValue         string                     `json:"evalue"`
+	Traceback      []string                   `json:"traceback"`
+}
+
+// multiline is nbformat's text field: a string or a list of lines.
+type multiline string
+
+func (m *multiline) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = multiline(s)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err != nil {
+		return err
+	}
+	*m = multiline(strings.Join(lines, ""))
+	return nil
+}
+
+// ansiEscape matches the color codes IPython puts in tracebacks.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// Notebook renders a notebook's cells and stored outputs as HTML without
+// executing anything. Markdown cells and outputs go through Markdown;
+// HTML, SVG and JavaScript outputs are never embedded (their text/plain
+// form is shown instead), and images are only inlined as validated
+// base64 PNG, JPEG or GIF data.
+func Notebook(src []byte) (string, *ParseError) {
+	var nb notebook
+	if err := json.Unmarshal(src, &nb); err != nil {
+		_, perr := prettyJSON(src)
+		if perr == nil {
+			perr = &ParseError{Line: 1, Message: err.Error()}
+		}
+		return "", perr
+	}
+	if nb.NBFormat < 4 {
+		return "", &ParseError{Line: 1, Message: fmt.Sprintf("nbformat %d is not supported; only version 4 notebooks can be previewed", nb.NBFormat)}
+	}
+	lang := nb.Metadata.KernelSpec.Language
+	if lang == "" {
+		lang = nb.Metadata.LanguageInfo.Name
+	}
+
+	var b strings.Builder
+	for _, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			b.WriteString(`<div class="nb-cell nb-markdown">` + "\n")
+			b.WriteString(Markdown([]byte(cell.Source)))
+			b.WriteString("</div>\n")
+		case "code":
+			b.WriteString(`<div class="nb-cell nb-code">` + "\n")
+			b.WriteString(`<div class="nb-prompt">` + prompt("In", cell.ExecutionCount) + "</div>")
+			b.WriteString("<pre><code")
+			if fenceLang.MatchString(lang) {
+				b.WriteString(` class="language-` + lang + `"`)
+			}
+			b.WriteString(">" + html.EscapeString(string(cell.Source)) + "</code></pre>\n")
+			for _, out := range cell.Outputs {
+				renderOutput(&b, out)
+			}
+			b.WriteString("</div>\n")
+		default:
+			b.WriteString(`<div class="nb-cell nb-raw"><pre>` + html.EscapeString(string(cell.Source)) + "</pre></div>\n")
+		}
+	}
+	return b.String(), nil
+}
+
+func prompt(label string, count *int) string {
+	if count == nil {
+		return label + " [ ]:"
+	}
+	return fmt.Sprintf("%s [%d]:", label, *count)
+}
+
+// notebookImages are the image types inlined as data URIs. SVG is left
+// out: it can carry scripts.
+var notebookImages = []string{"image/png", "image/jpeg", "image/gif"}
+
+func renderOutput(b *strings.Builder, out notebookOutput) {
+	switch out.OutputType {
+	case "stream":
+		class := "nb-stream"
+		if out.Name == "stderr" {
+			class += " nb-stderr"
+		}
+		b.WriteString(`<pre class="` + class + `">` + html.EscapeString(string(out.Text)) + "</pre>\n")
+
+	case "error":
+		text := out.EName + ": " + out.EValue
+		if len(out.Traceback) > 0 {
+			text = ansiEscape.ReplaceAllString(strings.Join(out.Traceback, "\n"), "")
+		}
+		b.WriteString(`<pre class="nb-error">` + html.EscapeString(text) + "</pre>\n")
+
+	case "execute_result", "display_data":
+		b.WriteString(`<div class="nb-output">`)
+		if out.OutputType == "execute_result" {
+			b.WriteString(`<div class="nb-prompt">` + prompt("Out", out.ExecutionCount) + "</div>")
+		}
+		b.WriteString(richOutput(out.Data))
+		b.WriteString("</div>\n")
+	}
+}
+
+// richOutput picks the safest useful representation of a display output.
+func richOutput(data map[string]json.RawMessage) string {
+	text := func(mime string) (string, bool) {
+		var v multiline
+		if raw, ok := data[mime]; !ok || json.Unmarshal(raw, &v) != nil {
+			return "", false
+		}
+		return string(v), true
+	}
+	for _, mime := range notebookImages {
+		if v, ok := text(mime); ok {
+			encoded := strings.Join(strings.Fields(v), "")
+			if _, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+				return `<img alt="output" src="data:` + mime + ";base64," + encoded + `">`
+			}
+		}
+	}
+	if v, ok := text("text/markdown"); ok {
+		return Markdown([]byte(v))
+	}
+	if raw, ok := data["application/json"]; ok {
+		pretty, _ := prettyJSON(raw)
+		return "<pre>" + html.EscapeString(pretty) + "</pre>"
+	}
+	if v, ok := text("text/plain"); ok {
+		return "<pre>" + html.EscapeString(v) + "</pre>"
+	}
+	var types []string
+	for t := range data {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return `<pre class="nb-omitted">` + html.EscapeString("[output not shown: "+strings.Join(types, ", ")+"]") + "</pre>"
+}
@@ -0,0 +1,74 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleNotebook = `{
+ "nbformat": 4,
+ "nbformat_minor": 5,
+ "metadata": {"kernelspec": {"name": "python3", "language": "python"}},
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Training\n", "Loss *drops*."]},
+  {"cell_type": "code", "execution_count": 3, "metadata": {}, "source": "print('<ok>')\nmodel",
+   "outputs": [
+    {"output_type": "stream", "name": "stdout", "text": ["<ok>\n"]},
+    {"output_type": "execute_result", "execution_count": 3, "metadata": {},
+     "data": {"text/plain": ["Model(layers=3)"], "text/html": ["<script>alert(1)</script>"]}},
+    {"output_type": "display_data", "metadata": {},
+     "data": {"image/png": "iVBORw0KGgo=\n", "text/plain": ["<Figure>"]}},
+    {"output_type": "display_data", "metadata": {},
+     "data": {"application/json": {"a": 1}}},
+    {"output_type": "display_data", "metadata": {},
+     "data": {"application/javascript": "alert(1)"}}
+   ]},
+  {"cell_type": "code", "execution_count": null, "metadata": {}, "source": "1/0",
+   "outputs": [{"output_type": "error", "ename": "ZeroDivisionError", "evalue": "division by zero",
+     "traceback": ["\u001b[0;31mZeroDivisionError\u001b[0m: division by zero"]}]}
+ ]
+}`
+
+func TestNotebook(t *testing.T) {
+	r := Render(KindFor("train.ipynb"), []byte(sampleNotebook))
+	if r.Kind != KindNotebook || r.Error != nil {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	for _, want := range []string{
+		"<h1>Training</h1>",
+		"<em>drops</em>",
+		`<div class="nb-prompt">In [3]:</div><pre><code class="language-python">print(&#39;&lt;ok&gt;&#39;)`,
+		`<pre class="nb-stream">&lt;ok&gt;`,
+		`Out [3]:</div><pre>Model(layers=3)</pre>`,
+		`<img alt="output" src="data:image/png;base64,iVBORw0KGgo=">`,
+		"&#34;a&#34;: 1",
+		"[output not shown: application/javascript]",
+		"In [ ]:",
+		`<pre class="nb-error">ZeroDivisionError: division by zero</pre>`,
+	} {
+		if !strings.Contains(r.HTML, want) {
+			t.Errorf("rendered notebook is missing %q:\n%s", want, r.HTML)
+		}
+	}
+	if strings.Contains(r.HTML, "<script") {
+		t.Errorf("HTML output was embedded:\n%s", r.HTML)
+	}
+}
+
+func TestNotebookErrors(t *testing.T) {
+	r := Render(KindNotebook, []byte("{\n \"cells\": [,]\n}"))
+	if r.Error == nil || r.Error.Line != 2 || r.HTML != "" {
+		t.Errorf("expected a located parse error, got %+v", r)
+	}
+
+	r = Render(KindNotebook, []byte(`{"nbformat": 3, "worksheets": []}`))
+	if r.Error == nil || !strings.Contains(r.Error.Message, "nbformat 3") {
+		t.Errorf("expected an unsupported-version error, got %+v", r.Error)
+	}
+
+	r = Render(KindNotebook, []byte(`{"nbformat": 4, "cells": [{"cell_type": "code", "source": "x",
+		"outputs": [{"output_type": "display_data", "data": {"image/png": "not base64!", "text/plain": "fallback"}}]}]}`))
+	if r.Error != nil || strings.Contains(r.HTML, "<img") || !strings.Contains(r.HTML, "fallback") {
+		t.Errorf("invalid image data should fall back to text: %+v", r)
+	}
+}
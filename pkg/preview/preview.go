@@ -0,0 +1,144 @@
+// Package preview renders file contents for inline display in the UI.
+// Renderers produce either HTML built from escaped text or plain text:
+// nothing a file contains is ever passed through as markup.
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind selects a renderer.
+type Kind string
+
+const (
+	KindText     Kind = "text"
+	KindMarkdown Kind = "markdown"
+	KindJSON     Kind = "json"
+	KindYAML     Kind = "yaml"
+	KindNotebook Kind = "notebook"
+)
+
+// ParseError locates a syntax error in a JSON or YAML file. Line and
+// Column are 1-based; Column is 0 when the parser does not report one.
+type ParseError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Result is a rendered preview. HTML is set for Markdown and notebooks,
+// Text for every other kind. When a JSON, YAML or notebook file does not
+// parse, Text holds it unchanged and Error says where it went wrong.
+type Result struct {
+	Kind  Kind        `json:"kind"`
+	HTML  string      `json:"html,omitempty"`
+	Text  string      `json:"text,omitempty"`
+	Error *ParseError `json:"error,omitempty"`
+}
+
+// KindFor picks a renderer from a file name.
+func KindFor(name string) Kind {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		return KindMarkdown
+	case ".json":
+		return KindJSON
+	case ".yaml", ".yml":
+		return KindYAML
+	case ".ipynb":
+		return KindNotebook
+	}
+	return KindText
+}
+
+// Render renders data as kind. Unknown kinds are shown as text.
+func Render(kind Kind, data []byte) Result {
+	switch kind {
+	case KindMarkdown:
+		return Result{Kind: kind, HTML: Markdown(data)}
+	case KindJSON:
+		text, perr := prettyJSON(data)
+		return Result{Kind: kind, Text: text, Error: perr}
+	case KindYAML:
+		text, perr := prettyYAML(data)
+		return Result{Kind: kind, Text: text, Error: perr}
+	case KindNotebook:
+		html, perr := Notebook(data)
+		if perr != nil {
+			return Result{Kind: kind, Text: string(data), Error: perr}
+		}
+		return Result{Kind: kind, HTML: html}
+	}
+	return Result{Kind: KindText, Text: string(data)}
+}
+
+func prettyJSON(data []byte) (string, *ParseError) {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, data, "", "  ")
+	if err == nil {
+		return buf.String(), nil
+	}
+	perr := &ParseError{Line: 1, Message: err.Error()}
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		// Offset counts the bytes read, including the offending one.
+		perr.Line, perr.Column = lineColumn(data, max(se.Offset-1, 0))
+	}
+	return string(data), perr
+}
+
+// lineColumn returns the 1-based line and column of the byte at offset.
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, len(before) - bytes.LastIndexByte(before, '\n')
+}
+
+// yamlErrorLine matches the "yaml: line N: message" errors of yaml.v3.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// prettyYAML re-indents every document of a YAML stream, keeping key
+// order and comments.
+func prettyYAML(data []byte) (string, *ParseError) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return string(data), yamlParseError(err)
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return string(data), &ParseError{Line: 1, Message: err.Error()}
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return string(data), &ParseError{Line: 1, Message: err.Error()}
+	}
+	return out.String(), nil
+}
+
+func yamlParseError(err error) *ParseError {
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &ParseError{Line: line, Message: m[2]}
+	}
+	return &ParseError{Line: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
@@ -0,0 +1,60 @@
+package preview
+
+import "testing"
+
+func TestKindFor(t *testing.T) {
+	tests := map[string]Kind{
+		"README.md":        KindMarkdown,
+		"notes.MARKDOWN":   KindMarkdown,
+		"config.json":      KindJSON,
+		"values.yaml":      KindYAML,
+		"deploy.yml":       KindYAML,
+		"train.ipynb":      KindNotebook,
+		"app.log":          KindText,
+		"Makefile":         KindText,
+		"archive.json.bak": KindText,
+	}
+	for name, want := range tests {
+		if got := KindFor(name); got != want {
+			t.Errorf("KindFor(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	r := Render(KindJSON, []byte(`{"a":[1,2],"b":{"c":null}}`))
+	want := "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {\n    \"c\": null\n  }\n}"
+	if r.Error != nil || r.Text != want {
+		t.Errorf("Render(json) = %q, %+v", r.Text, r.Error)
+	}
+
+	src := "{\n  \"a\": 1,\n  \"b\": 2,,\n}"
+	r = Render(KindJSON, []byte(src))
+	if r.Error == nil || r.Error.Line != 3 || r.Error.Column != 10 {
+		t.Fatalf("expected error at 3:10, got %+v", r.Error)
+	}
+	if r.Text != src {
+		t.Error("invalid JSON should be returned unchanged")
+	}
+}
+
+func TestRenderYAML(t *testing.T) {
+	src := "# settings\nb:    2\na:\n    - x   # first\n---\nkind: Service\n"
+	r := Render(KindYAML, []byte(src))
+	want := "# settings\nb: 2\na:\n  - x # first\n---\nkind: Service\n"
+	if r.Error != nil || r.Text != want {
+		t.Errorf("Render(yaml) = %q, %+v", r.Text, r.Error)
+	}
+
+	r = Render(KindYAML, []byte("a: 1\nb: [2\nc: 3\n"))
+	if r.Error == nil || r.Error.Line == 0 || r.Error.Message == "" {
+		t.Fatalf("expected a located parse error, got %+v", r.Error)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	r := Render(KindText, []byte("<b>plain</b>"))
+	if r.Kind != KindText || r.Text != "<b>plain</b>" || r.HTML != "" {
+		t.Errorf("unexpected text result: %+v", r)
+	}
+}
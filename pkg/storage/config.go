@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Config selects and configures the backend of one connection.
+type Config struct {
+	// Type is "local", "s3" or "sftp".
+	Type string `json:"type"`
+	// Roots are the local directories served by a "local" connection, as
+	// "/path" or "name=/path".
+	Roots []string    `json:"roots,omitempty"`
+	S3    *S3Config   `json:"s3,omitempty"`
+	SFTP  *SFTPConfig `json:"sftp,omitempty"`
+}
+
+// Open connects to the backend cfg describes.
+func Open(ctx context.Context, cfg Config) (*Backend, error) {
+	switch cfg.Type {
+	case "local":
+		fs, err := NewLocalFS(cfg.Roots)
+		if err != nil {
+			return nil, err
+		}
+		return NewBackend(fs, "local", "local"), nil
+	case "s3":
+		if cfg.S3 == nil {
+			cfg.S3 = &S3Config{}
+		}
+		fs, err := NewS3FS(*cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fs.Volumes(ctx); err != nil {
+			return nil, fmt.Errorf("cannot reach %s: %w", fs.endpoint.Host, err)
+		}
+		return NewBackend(fs, "s3", "s3://"+fs.endpoint.Host), nil
+	case "sftp":
+		if cfg.SFTP == nil {
+			return nil, fmt.Errorf("sftp connections need an address and user")
+		}
+		fs, err := DialSFTP(ctx, *cfg.SFTP)
+		if err != nil {
+			return nil, err
+		}
+		return NewBackend(fs, "sftp", "sftp://"+cfg.SFTP.User+"@"+cfg.SFTP.Address), nil
+	}
+	return nil, fmt.Errorf("unknown backend type %q: expected local, s3 or sftp", cfg.Type)
+}
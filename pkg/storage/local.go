@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// LocalFS serves directories on the KubeBrowser host, each as a volume.
+// Files are reached through an os.Root per directory, so neither ".." nor
+// a symbolic link leads out of it.
+type LocalFS struct {
+	roots map[string]string
+	dirs  map[string]*os.Root
+	order []Volume
+}
+
+// NewLocalFS serves each root, given as "/path" or "name=/path", as a
+// volume. Roots must be existing directories.
+func NewLocalFS(roots []string) (*LocalFS, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("at least one local directory is required")
+	}
+	l := &LocalFS{roots: make(map[string]string), dirs: make(map[string]*os.Root)}
+	for _, root := range roots {
+		name, dir, _ := cutName(root)
+		dir = filepath.Clean(dir)
+		if !filepath.IsAbs(dir) {
+			l.Close()
+			return nil, fmt.Errorf("local directory %s must be an absolute path", dir)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			l.Close()
+			return nil, fmt.Errorf("local directory %s is not an existing directory", dir)
+		}
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		if _, dup := l.roots[name]; dup {
+			l.Close()
+			return nil, fmt.Errorf("local directory name %s is used twice; name them with name=/path", name)
+		}
+		opened, err := os.OpenRoot(dir)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("local directory %s: %w", dir, err)
+		}
+		l.roots[name] = dir
+		l.dirs[name] = opened
+		l.order = append(l.order, Volume{Name: name, Location: dir})
+	}
+	return l, nil
+}
+
+// cutName splits an optional "name=" prefix off a root.
+func cutName(root string) (name, dir string, found bool) {
+	i := strings.Index(root, "=")
+	if i <= 0 || strings.ContainsAny(root[:i], `/\`) {
+		return "", root, false
+	}
+	return root[:i], root[i+1:], true
+}
+
+// path maps a volume path onto the host, for RealPath. p is already clean
+// and absolute, so joining cannot escape the root; links still can, which
+// is why files are opened through in.
+func (l *LocalFS) path(volume, p string) (string, error) {
+	root, ok := l.roots[volume]
+	if !ok {
+		return "", fmt.Errorf("unknown local directory %s: %w", volume, iofs.ErrNotExist)
+	}
+	return filepath.Join(root, filepath.FromSlash(p)), nil
+}
+
+// in returns the volume's os.Root and p relative to it.
+func (l *LocalFS) in(volume, p string) (*os.Root, string, error) {
+	root, ok := l.dirs[volume]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown local directory %s: %w", volume, iofs.ErrNotExist)
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if rel == "" {
+		rel = "."
+	}
+	return root, filepath.FromSlash(rel), nil
+}
+
+// errPathEscapes ends the error os.Root gives for a path that leads out
+// of it.
+const errPathEscapes = "path escapes from parent"
+
+// escaped turns os.Root's refusal of p into the OutOfScope error
+// ResolvePath gives for a link out of the volume.
+func escaped(err error, volume, p string) error {
+	if err != nil && strings.HasSuffix(err.Error(), errPathEscapes) {
+		return &k8s.K8sError{Kind: k8s.ErrKindOutOfScope, Message: fmt.Sprintf("%s leads outside %s. KubeBrowser does not follow symbolic links out of a volume.", p, volume), Cause: err}
+	}
+	return err
+}
+
+func localEntry(info iofs.FileInfo) Entry {
+	return Entry{Name: info.Name(), Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+}
+
+func (l *LocalFS) Volumes(ctx context.Context) ([]Volume, error) {
+	return l.order, nil
+}
+
+func (l *LocalFS) Stat(ctx context.Context, volume, p string) (Entry, error) {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := root.Stat(name)
+	if err != nil && strings.HasSuffix(err.Error(), errPathEscapes) {
+		// A link out of the volume is the link itself: it can be listed
+		// and deleted, but not followed.
+		info, err = root.Lstat(name)
+	}
+	if err != nil {
+		return Entry{}, escaped(err, volume, p)
+	}
+	return localEntry(info), nil
+}
+
+func (l *LocalFS) ReadDir(ctx context.Context, volume, p string) ([]Entry, error) {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := root.Open(name)
+	if err != nil {
+		return nil, escaped(err, volume, p)
+	}
+	defer dir.Close()
+	dirents, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dirents, func(i, j int) bool { return dirents[i].Name() < dirents[j].Name() })
+	entries := make([]Entry, 0, len(dirents))
+	for _, d := range dirents {
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, localEntry(info))
+	}
+	return entries, nil
+}
+
+func (l *LocalFS) Open(ctx context.Context, volume, p string) (io.ReadCloser, error) {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, escaped(err, volume, p)
+	}
+	return f, nil
+}
+
+// Create writes through a temporary file in the target directory and
+// renames it into place, so a failed upload never leaves a partial file.
+func (l *LocalFS) Create(ctx context.Context, volume, p string, r io.Reader) error {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(name)
+	if err := root.MkdirAll(dir, 0o755); err != nil {
+		return escaped(err, volume, p)
+	}
+	tmpName := filepath.Join(dir, ".kube-browser-"+rand.Text()+".part")
+	tmp, err := root.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return escaped(err, volume, p)
+	}
+	defer root.Remove(tmpName)
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := root.Chmod(tmpName, 0o644); err != nil {
+		return err
+	}
+	return escaped(root.Rename(tmpName, name), volume, p)
+}
+
+func (l *LocalFS) MkdirAll(ctx context.Context, volume, p string) error {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return err
+	}
+	return escaped(root.MkdirAll(name, 0o755), volume, p)
+}
+
+func (l *LocalFS) Remove(ctx context.Context, volume, p string) error {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return err
+	}
+	return escaped(root.Remove(name), volume, p)
+}
+
+func (l *LocalFS) Rename(ctx context.Context, volume, from, to string) error {
+	root, src, err := l.in(volume, from)
+	if err != nil {
+		return err
+	}
+	_, dst, err := l.in(volume, to)
+	if err != nil {
+		return err
+	}
+	return escaped(root.Rename(src, dst), volume, to)
+}
+
+func (l *LocalFS) Chmod(ctx context.Context, volume, p string, mode iofs.FileMode) error {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return err
+	}
+	return escaped(root.Chmod(name, mode), volume, p)
+}
+
+func (l *LocalFS) Chtimes(ctx context.Context, volume, p string, mtime time.Time) error {
+	root, name, err := l.in(volume, p)
+	if err != nil {
+		return err
+	}
+	return escaped(root.Chtimes(name, mtime, mtime), volume, p)
+}
+
+// RealPath resolves p's links on the host and checks the result is still
+// under the volume's root.
+func (l *LocalFS) RealPath(ctx context.Context, volume, p string) (string, bool, error) {
+	full, err := l.path(volume, p)
+	if err != nil {
+		return "", false, err
+	}
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return "", false, err
+	}
+	root, err := filepath.EvalSymlinks(l.roots[volume])
+	if err != nil {
+		return "", false, err
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false, nil
+	}
+	return path.Clean("/" + filepath.ToSlash(rel)), true, nil
+}
+
+func (l *LocalFS) Close() error {
+	for _, root := range l.dirs {
+		root.Close()
+	}
+	return nil
+}
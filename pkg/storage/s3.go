@@ -0,0 +1,476 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Config describes an S3 (or S3-compatible) connection. Unset
+// credentials and region are read from the usual AWS_* variables.
+type S3Config struct {
+	// Endpoint is the service URL, e.g. http://minio:9000. It defaults to
+	// AWS in Region.
+	Endpoint     string `json:"endpoint,omitempty"`
+	Region       string `json:"region,omitempty"`
+	AccessKey    string `json:"accessKey,omitempty"`
+	SecretKey    string `json:"secretKey,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+	// Buckets limits the volumes to these buckets. When empty every bucket
+	// the credentials can list when connecting is shown.
+	Buckets []string `json:"buckets,omitempty"`
+}
+
+// S3FS serves buckets as volumes, with "/" in keys as the directory
+// separator. Directories are the common prefixes of keys; creating an
+// empty one writes a "dir/" marker object as the S3 console does.
+// Requests are signed with Signature Version 4 and use path-style URLs.
+type S3FS struct {
+	endpoint *url.URL
+	region   string
+	access   string
+	secret   string
+	token    string
+	http     *http.Client
+
+	mu      sync.Mutex
+	buckets []string
+	now     func() time.Time
+}
+
+// s3PartSize is the multipart upload part size; uploads smaller than one
+// part are sent with a single PUT.
+var s3PartSize = 16 << 20
+
+// NewS3FS checks cfg and fills in defaults; it does not contact the
+// service.
+func NewS3FS(cfg S3Config) (*S3FS, error) {
+	s := &S3FS{
+		region:  firstNonEmpty(cfg.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		access:  firstNonEmpty(cfg.AccessKey, os.Getenv("AWS_ACCESS_KEY_ID")),
+		secret:  firstNonEmpty(cfg.SecretKey, os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		token:   cfg.SessionToken,
+		buckets: cfg.Buckets,
+		http:    &http.Client{},
+		now:     time.Now,
+	}
+	if len(cfg.Buckets) == 0 {
+		s.buckets = nil
+	}
+	if cfg.AccessKey == "" {
+		s.token = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if s.access == "" || s.secret == "" {
+		return nil, fmt.Errorf("S3 needs an access key and a secret key")
+	}
+	endpoint := firstNonEmpty(cfg.Endpoint, "https://s3."+s.region+".amazonaws.com")
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: expected http(s)://host[:port]", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	s.endpoint = u
+	return s, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// s3Escape percent-encodes everything but unreserved characters (and "/"
+// in paths), as Signature Version 4 requires.
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (path && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// do sends a signed request for key in bucket (both may be empty) and
+// returns the response if its status is 2xx.
+func (s *S3FS) do(ctx context.Context, method, bucket, key string, query url.Values, body []byte) (*http.Response, error) {
+	p := s.endpoint.Path + "/"
+	if bucket != "" {
+		p += bucket + "/" + key
+	}
+	escaped := s3Escape(p, true)
+
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	rawQuery := strings.Join(pairs, "&")
+
+	u := *s.endpoint
+	u.Path, u.RawPath, u.RawQuery = p, escaped, rawQuery
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, escaped, rawQuery, body)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3Error(resp, bucket, key)
+	}
+	return resp, nil
+}
+
+func (s *S3FS) sign(req *http.Request, escapedPath, rawQuery string, body []byte) {
+	t := s.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payload)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{"host": req.URL.Host, "x-amz-content-sha256": payload, "x-amz-date": amzDate}
+	if s.token != "" {
+		req.Header.Set("x-amz-security-token", s.token)
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = s.token
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signed := strings.Join(headers, ";")
+
+	canonical := strings.Join([]string{req.Method, escapedPath, rawQuery, canonicalHeaders.String(), signed, payload}, "\n")
+	hashed := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + s.secret)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.access, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// s3Error maps an error response onto fs errors where one applies.
+func s3Error(resp *http.Response, bucket, key string) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	what := "s3://" + bucket + "/" + key
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", what, iofs.ErrNotExist)
+	case resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s: %s: %w", what, firstNonEmpty(body.Message, body.Code, "access denied"), iofs.ErrPermission)
+	case body.Code != "":
+		return fmt.Errorf("%s: %s: %s", what, body.Code, body.Message)
+	}
+	return fmt.Errorf("%s: %s", what, resp.Status)
+}
+
+// s3Key turns a volume path into an object key ("" for the root).
+func s3Key(p string) string {
+	return strings.TrimPrefix(p, "/")
+}
+
+func (s *S3FS) Volumes(ctx context.Context) ([]Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := s.buckets
+	if names == nil {
+		resp, err := s.do(ctx, http.MethodGet, "", "", nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Buckets []struct {
+				Name string `xml:"Name"`
+			} `xml:"Buckets>Bucket"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("listing buckets: %w", err)
+		}
+		names = []string{}
+		for _, b := range result.Buckets {
+			names = append(names, b.Name)
+		}
+		// Every request resolves its volume, so list the buckets once
+		// per connection.
+		s.buckets = names
+	}
+	volumes := make([]Volume, 0, len(names))
+	for _, name := range names {
+		volumes = append(volumes, Volume{Name: name, Location: "s3://" + name})
+	}
+	return volumes, nil
+}
+
+type s3Listing struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list pages through ListObjectsV2 for prefix, one level deep.
+func (s *S3FS) list(ctx context.Context, bucket, prefix string, max int, fn func(*s3Listing)) error {
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if max > 0 {
+			q.Set("max-keys", strconv.Itoa(max))
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, bucket, "", q, nil)
+		if err != nil {
+			return err
+		}
+		var page s3Listing
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("listing s3://%s/%s: %w", bucket, prefix, err)
+		}
+		fn(&page)
+		if !page.IsTruncated || max > 0 || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *S3FS) Stat(ctx context.Context, volume, p string) (Entry, error) {
+	key := s3Key(p)
+	if key == "" {
+		return Entry{Name: "/", Mode: iofs.ModeDir | 0o755}, nil
+	}
+	resp, err := s.do(ctx, http.MethodHead, volume, key, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		mod, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return Entry{Name: gopath.Base(p), Size: resp.ContentLength, Mode: 0o644, ModTime: mod}, nil
+	}
+	if !errors.Is(err, iofs.ErrNotExist) {
+		return Entry{}, err
+	}
+
+	found := false
+	err = s.list(ctx, volume, key+"/", 1, func(page *s3Listing) {
+		found = len(page.Contents) > 0 || len(page.CommonPrefixes) > 0
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+	if !found {
+		return Entry{}, fmt.Errorf("s3://%s/%s: %w", volume, key, iofs.ErrNotExist)
+	}
+	return Entry{Name: gopath.Base(p), Mode: iofs.ModeDir | 0o755}, nil
+}
+
+func (s *S3FS) ReadDir(ctx context.Context, volume, p string) ([]Entry, error) {
+	prefix := s3Key(p)
+	if prefix != "" {
+		prefix += "/"
+	}
+	entries := []Entry{}
+	err := s.list(ctx, volume, prefix, 0, func(page *s3Listing) {
+		for _, cp := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(cp.Prefix, prefix), "/")
+			if name != "" {
+				entries = append(entries, Entry{Name: name, Mode: iofs.ModeDir | 0o755})
+			}
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if name == "" {
+				continue // the directory's own marker
+			}
+			entries = append(entries, Entry{Name: name, Size: obj.Size, Mode: 0o644, ModTime: obj.LastModified})
+		}
+	})
+	return entries, err
+}
+
+func (s *S3FS) Open(ctx context.Context, volume, p string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, volume, s3Key(p), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Create sends r as one PUT when it fits in a part and as a multipart
+// upload otherwise, so at most one part is held in memory.
+func (s *S3FS) Create(ctx context.Context, volume, p string, r io.Reader) error {
+	key := s3Key(p)
+	part := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.put(ctx, volume, key, nil, part[:n])
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, volume, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("starting upload of s3://%s/%s: %w", volume, key, err)
+	}
+	if err := s.uploadParts(ctx, volume, key, initiated.UploadID, r, part[:n]); err != nil {
+		abort, _ := s.do(context.Background(), http.MethodDelete, volume, key, url.Values{"uploadId": {initiated.UploadID}}, nil)
+		if abort != nil {
+			abort.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *S3FS) uploadParts(ctx context.Context, volume, key, uploadID string, r io.Reader, first []byte) error {
+	type completed struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completed
+	buf := first
+	for number := 1; ; number++ {
+		q := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, volume, key, q, buf)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		parts = append(parts, completed{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		n, err := io.ReadFull(r, buf[:cap(buf)])
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		buf = buf[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name    `xml:"CompleteMultipartUpload"`
+		Parts   []completed `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPost, volume, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3FS) put(ctx context.Context, volume, key string, query url.Values, body []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, volume, key, query, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MkdirAll writes a marker for p so it shows up while empty; parents need
+// no markers since they are prefixes of it.
+func (s *S3FS) MkdirAll(ctx context.Context, volume, p string) error {
+	key := s3Key(p)
+	if key == "" {
+		return nil
+	}
+	if e, err := s.Stat(ctx, volume, p); err == nil {
+		if !e.IsDir() {
+			return fmt.Errorf("s3://%s/%s is a file", volume, key)
+		}
+		return nil
+	}
+	return s.put(ctx, volume, key+"/", nil, nil)
+}
+
+// Remove deletes an object, or a directory's marker.
+func (s *S3FS) Remove(ctx context.Context, volume, p string) error {
+	e, err := s.Stat(ctx, volume, p)
+	if err != nil {
+		return err
+	}
+	key := s3Key(p)
+	if e.IsDir() {
+		key += "/"
+	}
+	resp, err := s.do(ctx, http.MethodDelete, volume, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3FS) Close() error { return nil }
@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPConfig describes an SFTP connection. Host keys are checked against
+// KnownHosts (~/.ssh/known_hosts by default); there is no way to skip the
+// check.
+type SFTPConfig struct {
+	// Address is host or host:port; the port defaults to 22.
+	Address  string `json:"address"`
+	User     string `json:"user"`
+	Password string `json:"password,omitempty"`
+	// PrivateKey is the path of a private key on the KubeBrowser host,
+	// tried before Password.
+	PrivateKey string `json:"privateKey,omitempty"`
+	KnownHosts string `json:"knownHosts,omitempty"`
+	// Roots are the remote directories served as volumes, as "/path" or
+	// "name=/path". The default is the login directory.
+	Roots []string `json:"roots,omitempty"`
+}
+
+// SFTPFS serves directories on an SFTP host.
+type SFTPFS struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	roots  map[string]string
+	order  []Volume
+}
+
+// DialSFTP connects and authenticates to cfg.Address.
+func DialSFTP(ctx context.Context, cfg SFTPConfig) (*SFTPFS, error) {
+	if cfg.Address == "" || cfg.User == "" {
+		return nil, fmt.Errorf("SFTP address and user are required")
+	}
+	addr := cfg.Address
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		pem, err := os.ReadFile(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parsing private key %s: %w", cfg.PrivateKey, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SFTP needs a password or a private key")
+	}
+
+	knownHosts := cfg.KnownHosts
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("locating known_hosts: %w", err)
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("loading known hosts: %w", err)
+	}
+
+	dialer := net.Dialer{Timeout: 15 * time.Second}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(raw, addr, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         15 * time.Second,
+	})
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("SSH handshake with %s: %w", addr, err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("starting SFTP on %s: %w", addr, err)
+	}
+
+	s, err := newSFTPFS(client, cfg.Roots)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn = conn
+	return s, nil
+}
+
+func newSFTPFS(client *sftp.Client, roots []string) (*SFTPFS, error) {
+	s := &SFTPFS{client: client, roots: make(map[string]string)}
+	if err := s.addRoots(roots); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SFTPFS) addRoots(roots []string) error {
+	if len(roots) == 0 {
+		home, err := s.client.Getwd()
+		if err != nil {
+			return fmt.Errorf("finding the login directory: %w", err)
+		}
+		roots = []string{"home=" + home}
+	}
+	for _, root := range roots {
+		name, dir, ok := cutRoot(root)
+		if !ok {
+			return fmt.Errorf("remote directory %s must be an absolute path", dir)
+		}
+		if info, err := s.client.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("remote directory %s is not an existing directory", dir)
+		}
+		if _, dup := s.roots[name]; dup {
+			return fmt.Errorf("remote directory name %s is used twice; name them with name=/path", name)
+		}
+		s.roots[name] = dir
+		s.order = append(s.order, Volume{Name: name, Location: dir})
+	}
+	return nil
+}
+
+// cutRoot splits "name=/path" or "/path" into a volume name and a clean
+// absolute slash path.
+func cutRoot(root string) (name, dir string, ok bool) {
+	name, dir, found := cutName(root)
+	dir = gopath.Clean(dir)
+	if !found {
+		name = gopath.Base(dir)
+	}
+	return name, dir, gopath.IsAbs(dir)
+}
+
+func (s *SFTPFS) path(volume, p string) (string, error) {
+	root, ok := s.roots[volume]
+	if !ok {
+		return "", fmt.Errorf("unknown remote directory %s: %w", volume, iofs.ErrNotExist)
+	}
+	return gopath.Join(root, p), nil
+}
+
+func sftpEntry(info iofs.FileInfo) Entry {
+	e := Entry{Name: info.Name(), Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+	if st, ok := info.Sys().(*sftp.FileStat); ok {
+		e.UID, e.GID = strconv.FormatUint(uint64(st.UID), 10), strconv.FormatUint(uint64(st.GID), 10)
+	}
+	return e
+}
+
+func (s *SFTPFS) Volumes(ctx context.Context) ([]Volume, error) {
+	return s.order, nil
+}
+
+func (s *SFTPFS) Stat(ctx context.Context, volume, p string) (Entry, error) {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := s.client.Stat(full)
+	if err != nil {
+		return Entry{}, err
+	}
+	return sftpEntry(info), nil
+}
+
+func (s *SFTPFS) ReadDir(ctx context.Context, volume, p string) ([]Entry, error) {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.client.ReadDir(full)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, sftpEntry(info))
+	}
+	return entries, nil
+}
+
+func (s *SFTPFS) Open(ctx context.Context, volume, p string) (io.ReadCloser, error) {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Open(full)
+}
+
+// Create uploads to a temporary name next to p and renames it into place,
+// so a failed upload never leaves a partial file.
+func (s *SFTPFS) Create(ctx context.Context, volume, p string, r io.Reader) error {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return err
+	}
+	if err := s.client.MkdirAll(gopath.Dir(full)); err != nil {
+		return err
+	}
+	tmp := gopath.Join(gopath.Dir(full), fmt.Sprintf(".kube-browser-%d.part", time.Now().UnixNano()))
+	f, err := s.client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.ReadFrom(r); err != nil {
+		f.Close()
+		s.client.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		s.client.Remove(tmp)
+		return err
+	}
+	// posix-rename replaces the target atomically; servers without the
+	// extension only rename onto a free name.
+	if err := s.client.PosixRename(tmp, full); err != nil {
+		s.client.Remove(full)
+		if err := s.client.Rename(tmp, full); err != nil {
+			s.client.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SFTPFS) MkdirAll(ctx context.Context, volume, p string) error {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return err
+	}
+	return s.client.MkdirAll(full)
+}
+
+func (s *SFTPFS) Remove(ctx context.Context, volume, p string) error {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return err
+	}
+	return s.client.Remove(full)
+}
+
+func (s *SFTPFS) Rename(ctx context.Context, volume, from, to string) error {
+	src, err := s.path(volume, from)
+	if err != nil {
+		return err
+	}
+	dst, err := s.path(volume, to)
+	if err != nil {
+		return err
+	}
+	return s.client.Rename(src, dst)
+}
+
+func (s *SFTPFS) Chmod(ctx context.Context, volume, p string, mode iofs.FileMode) error {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return err
+	}
+	return s.client.Chmod(full, mode)
+}
+
+func (s *SFTPFS) Chtimes(ctx context.Context, volume, p string, mtime time.Time) error {
+	full, err := s.path(volume, p)
+	if err != nil {
+		return err
+	}
+	return s.client.Chtimes(full, mtime, mtime)
+}
+
+func (s *SFTPFS) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		err = s.conn.Close()
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+
+	"kube-browser/pkg/k8s"
+)
+
+// newPipeSFTP serves the local filesystem over an in-memory SFTP session,
+// which exercises SFTPFS without an SSH server.
+func newPipeSFTP(t *testing.T, roots ...string) *SFTPFS {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	server, err := sftp.NewServer(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	client, err := sftp.NewClientPipe(c2, c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSFTPFS(client, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSFTPBackend(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeLocal(t, dir, "reports/q1.csv", "a,b\n")
+	b := NewBackend(newPipeSFTP(t, "share="+filepath.ToSlash(dir)), "sftp", "sftp://test")
+
+	files, err := b.ListFiles(ctx, "sftp", "share", "/reports")
+	if err != nil || len(files) != 1 || files[0].Path != "/reports/q1.csv" || files[0].Size != "4" {
+		t.Fatalf("unexpected listing %+v, %v", files, err)
+	}
+
+	if err := b.UploadFile(ctx, "sftp", "share", "/out/new.txt", strings.NewReader("uploaded")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UploadFile(ctx, "sftp", "share", "/out/new.txt", strings.NewReader("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "out", "new.txt"))
+	if err != nil || string(got) != "replaced" {
+		t.Errorf("expected the upload to replace the file, got %q, %v", got, err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "out", ".kube-browser-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("expected no temporary files, found %v", leftovers)
+	}
+
+	rc, _, err := b.DownloadFile(ctx, "sftp", "share", "/reports/q1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "a,b\n" {
+		t.Errorf("unexpected download %q", data)
+	}
+
+	if _, err := b.ApplyPermissions(ctx, "sftp", "share", "/out/new.txt", k8s.FilePermissions{Mode: "600"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "out", "new.txt")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 600, got %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,1006 @@
+// Package storage serves file trees that are not PVCs (a local directory,
+// an SFTP host, an S3 bucket) through the same client interface as a
+// cluster, so the UI can connect to them like any other context.
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"kube-browser/pkg/k8s"
+)
+
+// Entry describes a file or directory.
+type Entry struct {
+	Name    string
+	Size    int64
+	Mode    iofs.FileMode
+	ModTime time.Time
+	// UID and GID are the numeric owner and group, when the FS has them.
+	UID, GID string
+}
+
+func (e Entry) IsDir() bool { return e.Mode.IsDir() }
+
+// Volume is a top-level root of an FS (a directory, a bucket), shown in
+// place of a PVC.
+type Volume struct {
+	Name string
+	// Location is where the volume lives, shown as the mount path.
+	Location string
+}
+
+// FS is the file tree a Backend serves. Paths are slash-separated and
+// absolute within a volume; "/" is the volume's root. Errors for missing
+// paths wrap fs.ErrNotExist, and denied access fs.ErrPermission.
+type FS interface {
+	Volumes(ctx context.Context) ([]Volume, error)
+	Stat(ctx context.Context, volume, p string) (Entry, error)
+	ReadDir(ctx context.Context, volume, p string) ([]Entry, error)
+	Open(ctx context.Context, volume, p string) (io.ReadCloser, error)
+	// Create writes r to p, replacing any file there and creating missing
+	// parent directories.
+	Create(ctx context.Context, volume, p string, r io.Reader) error
+	MkdirAll(ctx context.Context, volume, p string) error
+	// Remove removes a file or an empty directory.
+	Remove(ctx context.Context, volume, p string) error
+	Close() error
+}
+
+// Renamer is implemented by file systems that can rename in place.
+type Renamer interface {
+	// Rename moves from to to, which must not exist; its parent does.
+	Rename(ctx context.Context, volume, from, to string) error
+}
+
+// Chmoder is implemented by file systems that can change modes.
+type Chmoder interface {
+	Chmod(ctx context.Context, volume, p string, mode iofs.FileMode) error
+}
+
+// TimeSetter is implemented by file systems that can set modification
+// times.
+type TimeSetter interface {
+	Chtimes(ctx context.Context, volume, p string, mtime time.Time) error
+}
+
+// LinkResolver is implemented by file systems with symbolic links.
+type LinkResolver interface {
+	// RealPath follows the links in p and returns the volume path it
+	// leads to, and false if it leads out of the volume.
+	RealPath(ctx context.Context, volume, p string) (string, bool, error)
+}
+
+// Backend adapts an FS to the handlers' client interface. Its volumes are
+// listed as PVCs in a single namespace named after the backend type.
+// Operations that need pods (containers, archives, clones, migrations)
+// return an error.
+type Backend struct {
+	fs        FS
+	kind      string
+	name      string
+	namespace string
+	now       func() time.Time
+}
+
+// NewBackend serves fs as a connection called name. kind ("local", "s3",
+// "sftp") names the namespace and appears in errors.
+func NewBackend(fs FS, kind, name string) *Backend {
+	return &Backend{fs: fs, kind: kind, name: name, namespace: kind, now: time.Now}
+}
+
+// Kind is the backend type: "local", "s3" or "sftp".
+func (b *Backend) Kind() string { return b.kind }
+
+// Close releases the connection held by the underlying FS.
+func (b *Backend) Close() error {
+	return b.fs.Close()
+}
+
+func (b *Backend) unsupported(op string) error {
+	return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s is not available on %s connections.", op, b.kind)}
+}
+
+// classify turns FS errors into K8sErrors so responses carry a kind.
+func classify(err error, p string) error {
+	var ke *k8s.K8sError
+	switch {
+	case err == nil || errors.As(err, &ke) || errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, iofs.ErrNotExist):
+		return &k8s.K8sError{Kind: k8s.ErrKindPathNotFound, Message: fmt.Sprintf("%s: no such file or directory.", p), Cause: err}
+	case errors.Is(err, iofs.ErrPermission):
+		return &k8s.K8sError{Kind: k8s.ErrKindPermDenied, Message: fmt.Sprintf("%s: permission denied.", p), Cause: err}
+	case errors.Is(err, syscall.EROFS):
+		return &k8s.K8sError{Kind: k8s.ErrKindReadOnlyFS, Message: fmt.Sprintf("%s: the filesystem is mounted read-only.", p), Cause: err}
+	case errors.Is(err, syscall.EIO):
+		return &k8s.K8sError{Kind: k8s.ErrKindIOError, Message: fmt.Sprintf("%s: I/O error; the disk may be failing.", p), Cause: err}
+	case errors.Is(err, syscall.ESTALE):
+		return &k8s.K8sError{Kind: k8s.ErrKindStaleHandle, Message: fmt.Sprintf("%s: stale file handle; the network share changed or went away.", p), Cause: err}
+	}
+	return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: err.Error(), Cause: err}
+}
+
+// cleanPath normalizes a request path to the absolute form FS expects.
+func cleanPath(p string) string {
+	return gopath.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+}
+
+// relPath is p relative to root, with buildFilePath's form: "name" below
+// the volume root and "/dir/name" elsewhere.
+func relPath(root, p string) string {
+	if root == "/" {
+		return strings.TrimPrefix(p, "/")
+	}
+	return p
+}
+
+func (b *Backend) volume(ctx context.Context, namespace, pvcName string) (string, error) {
+	if namespace != b.namespace {
+		return "", &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("Namespace %s not found; this %s connection only has %s.", namespace, b.kind, b.namespace)}
+	}
+	volumes, err := b.fs.Volumes(ctx)
+	if err != nil {
+		return "", classify(err, pvcName)
+	}
+	for _, v := range volumes {
+		if v.Name == pvcName {
+			return v.Name, nil
+		}
+	}
+	return "", &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("Volume %s not found on this %s connection.", pvcName, b.kind)}
+}
+
+func (b *Backend) stat(ctx context.Context, namespace, pvcName, filePath string) (string, string, Entry, error) {
+	vol, err := b.volume(ctx, namespace, pvcName)
+	if err != nil {
+		return "", "", Entry{}, err
+	}
+	p := cleanPath(filePath)
+	e, err := b.fs.Stat(ctx, vol, p)
+	if err != nil {
+		return vol, p, Entry{}, classify(err, p)
+	}
+	return vol, p, e, nil
+}
+
+func fileInfo(e Entry, p, root string) k8s.FileInfo {
+	info := k8s.FileInfo{
+		Name:  gopath.Base(p),
+		Size:  strconv.FormatInt(e.Size, 10),
+		IsDir: e.IsDir(),
+		Path:  relPath(root, p),
+		Mode:  k8s.FormatMode(e.Mode),
+		UID:   e.UID,
+		GID:   e.GID,
+	}
+	info.Symlink = e.Mode&iofs.ModeSymlink != 0
+	if !e.ModTime.IsZero() {
+		info.ModTime = e.ModTime.UTC().Format(time.RFC3339)
+	}
+	return info
+}
+
+// walk calls fn for p and every entry below it, parents before children,
+// each directory's entries sorted by name. Returning errStopWalk from fn
+// ends the walk early.
+func (b *Backend) walk(ctx context.Context, vol, p string, e Entry, fn func(p string, e Entry) error) error {
+	if err := fn(p, e); err != nil || !e.IsDir() {
+		if err == errSkipDir {
+			return nil
+		}
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	children, err := b.fs.ReadDir(ctx, vol, p)
+	if err != nil {
+		return classify(err, p)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	for _, c := range children {
+		if err := b.walk(ctx, vol, gopath.Join(p, c.Name), c, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errStopWalk = errors.New("stop walk")
+
+// errSkipDir, returned by a walk callback for a directory, skips what is
+// below it.
+var errSkipDir = errors.New("skip directory")
+
+// defaultSearchLimit matches the cap searches in pods use.
+const defaultSearchLimit = 1000
+
+func (b *Backend) Connection() (kubeconfigPath, contextName string) {
+	return "", b.name
+}
+
+func (b *Backend) RegistryMirror() string { return "" }
+
+func (b *Backend) CredentialStatus() k8s.CredentialStatus { return k8s.CredentialStatus{} }
+
+func (b *Backend) ExecSessions() (inUse, limit int) { return 0, 0 }
+
+func (b *Backend) ListNamespaces(ctx context.Context) ([]string, error) {
+	return []string{b.namespace}, nil
+}
+
+func (b *Backend) ListPVCs(ctx context.Context, namespace string) ([]k8s.PVCInfo, error) {
+	pvcs := []k8s.PVCInfo{}
+	if namespace != "" && namespace != b.namespace {
+		return pvcs, nil
+	}
+	volumes, err := b.fs.Volumes(ctx)
+	if err != nil {
+		return nil, classify(err, b.name)
+	}
+	for _, v := range volumes {
+		pvcs = append(pvcs, k8s.PVCInfo{
+			Name:         v.Name,
+			Namespace:    b.namespace,
+			Status:       "Available",
+			AccessModes:  "ReadWriteMany",
+			StorageClass: b.kind,
+			MountPath:    v.Location,
+		})
+	}
+	sort.Slice(pvcs, func(i, j int) bool { return pvcs[i].Name < pvcs[j].Name })
+	return pvcs, nil
+}
+
+func (b *Backend) SelectPVCs(ctx context.Context, selector string) ([]k8s.PVCInfo, error) {
+	return nil, b.unsupported("Selecting PVCs by label")
+}
+
+func (b *Backend) StorageClasses(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func (b *Backend) ListFiles(ctx context.Context, namespace, pvcName, path string) ([]k8s.FileInfo, error) {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, path)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return []k8s.FileInfo{fileInfo(e, p, gopath.Dir(p))}, nil
+	}
+	entries, err := b.fs.ReadDir(ctx, vol, p)
+	if err != nil {
+		return nil, classify(err, p)
+	}
+	files := []k8s.FileInfo{}
+	for _, c := range entries {
+		files = append(files, fileInfo(c, gopath.Join(p, c.Name), p))
+	}
+	return files, nil
+}
+
+// StreamFiles hands the entries of ListFiles to fn one by one; a directory
+// is read in one call anyway.
+func (b *Backend) StreamFiles(ctx context.Context, namespace, pvcName, path string, fn func(k8s.FileInfo) error) error {
+	files, err := b.ListFiles(ctx, namespace, pvcName, path)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) DownloadFile(ctx context.Context, namespace, pvcName, filePath string) (io.ReadCloser, string, error) {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	if e.IsDir() {
+		return nil, "", &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	rc, err := b.fs.Open(ctx, vol, p)
+	if err != nil {
+		return nil, "", classify(err, p)
+	}
+	return rc, gopath.Base(p), nil
+}
+
+func (b *Backend) ReadFileHead(ctx context.Context, namespace, pvcName, filePath string, limit int) ([]byte, bool, error) {
+	rc, _, err := b.DownloadFile(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, int64(limit)+1))
+	if err != nil {
+		return nil, false, classify(err, filePath)
+	}
+	if len(data) > limit {
+		return data[:limit], true, nil
+	}
+	return data, false, nil
+}
+
+// FileChecksum reads the whole file, so on remote backends it costs a
+// download.
+func (b *Backend) FileChecksum(ctx context.Context, namespace, pvcName, filePath, algo string) (*k8s.FileChecksum, error) {
+	h, err := k8s.NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := b.DownloadFile(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if _, err := io.Copy(h, rc); err != nil {
+		return nil, classify(err, filePath)
+	}
+	return &k8s.FileChecksum{Path: filePath, Algorithm: algo, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func (b *Backend) UploadFile(ctx context.Context, namespace, pvcName, destPath string, data io.Reader) error {
+	vol, err := b.volume(ctx, namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	p := cleanPath(destPath)
+	if p == "/" {
+		return fmt.Errorf("cannot write to the root of a volume")
+	}
+	if err := b.fs.Create(ctx, vol, p, data); err != nil {
+		return classify(err, p)
+	}
+	return nil
+}
+
+// SaveFile replaces a file's contents. Every FS already writes a file
+// whole, through a temporary file or a single object upload, so only the
+// mode of the file replaced needs keeping.
+func (b *Backend) SaveFile(ctx context.Context, namespace, pvcName, filePath string, data []byte) error {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, filePath)
+	existed := err == nil
+	if existed && e.IsDir() {
+		return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	if err := b.UploadFile(ctx, namespace, pvcName, filePath, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if chmoder, ok := b.fs.(Chmoder); ok && existed && e.Mode.Perm() != 0 {
+		return classify(chmoder.Chmod(ctx, vol, p, e.Mode.Perm()), p)
+	}
+	return nil
+}
+
+// RemoveFile removes a file; like rm -f, a missing file is not an error.
+func (b *Backend) RemoveFile(ctx context.Context, namespace, pvcName, filePath string) error {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, filePath)
+	var ke *k8s.K8sError
+	if errors.As(err, &ke) && ke.Kind == k8s.ErrKindPathNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e.IsDir() {
+		return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	return classify(b.fs.Remove(ctx, vol, p), p)
+}
+
+// DeleteFile removes a file; a missing file or a directory is an error.
+func (b *Backend) DeleteFile(ctx context.Context, namespace, pvcName, filePath string) error {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return fmt.Errorf("cannot delete the root of a volume")
+	}
+	if e.IsDir() {
+		return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s is a directory.", p)}
+	}
+	return classify(b.fs.Remove(ctx, vol, p), p)
+}
+
+// DeleteDirectory removes a directory: only an empty one unless recursive
+// is set, in which case its contents are removed first, deepest first.
+func (b *Backend) DeleteDirectory(ctx context.Context, namespace, pvcName, dirPath string, recursive bool) error {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, dirPath)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return fmt.Errorf("cannot delete the root of a volume")
+	}
+	if !e.IsDir() {
+		return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s is not a directory.", p)}
+	}
+	var tree []string
+	if err := b.walk(ctx, vol, p, e, func(q string, _ Entry) error {
+		tree = append(tree, q)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(tree) > 1 && !recursive {
+		return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s: directory not empty.", p)}
+	}
+	for i := len(tree) - 1; i >= 0; i-- {
+		if err := b.fs.Remove(ctx, vol, tree[i]); err != nil {
+			return classify(err, tree[i])
+		}
+	}
+	return nil
+}
+
+func (b *Backend) ApplyPermissions(ctx context.Context, namespace, pvcName, filePath string, perms k8s.FilePermissions, isDir bool) (k8s.FilePermissions, error) {
+	if err := perms.Validate(); err != nil {
+		return perms, err
+	}
+	return perms, b.ChangePermissions(ctx, namespace, pvcName, filePath, perms, false)
+}
+
+// ChangePermissions changes modes on file systems that have them; none
+// has owners to change. Recursive changes skip symbolic links, like
+// chmod -R.
+func (b *Backend) ChangePermissions(ctx context.Context, namespace, pvcName, filePath string, perms k8s.FilePermissions, recursive bool) error {
+	if err := perms.ValidateChange(); err != nil {
+		return err
+	}
+	chmoder, ok := b.fs.(Chmoder)
+	if perms.Owner != "" || (perms.Mode != "" && !ok) {
+		return b.unsupported("Changing ownership and modes")
+	}
+	if perms.Mode == "" {
+		return nil
+	}
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, filePath)
+	if err != nil {
+		return err
+	}
+	chmod := func(q string, e Entry) error {
+		if e.Mode&iofs.ModeSymlink != 0 {
+			return nil
+		}
+		mode := fileMode(k8s.ApplyChmod(unixMode(e.Mode), perms.Mode, e.IsDir()))
+		return classify(chmoder.Chmod(ctx, vol, q, mode), q)
+	}
+	if !recursive {
+		return chmod(p, e)
+	}
+	return b.walk(ctx, vol, p, e, chmod)
+}
+
+// unixMode is m's permission bits as chmod numbers them.
+func unixMode(m iofs.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&iofs.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&iofs.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&iofs.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return mode
+}
+
+// fileMode is the inverse of unixMode.
+func fileMode(mode uint32) iofs.FileMode {
+	m := iofs.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		m |= iofs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= iofs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= iofs.ModeSticky
+	}
+	return m
+}
+
+func (b *Backend) PathsExist(ctx context.Context, namespace, pvcName string, paths []string) ([]bool, error) {
+	exist := make([]bool, len(paths))
+	for i, p := range paths {
+		_, _, _, err := b.stat(ctx, namespace, pvcName, p)
+		var ke *k8s.K8sError
+		if errors.As(err, &ke) && ke.Kind == k8s.ErrKindPathNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		exist[i] = true
+	}
+	return exist, nil
+}
+
+func (b *Backend) ResolvePath(ctx context.Context, namespace, pvcName, filePath string) (*k8s.PathInfo, error) {
+	vol, p, e, err := b.stat(ctx, namespace, pvcName, filePath)
+	var ke *k8s.K8sError
+	if errors.As(err, &ke) && ke.Kind == k8s.ErrKindPathNotFound {
+		dir := gopath.Dir(p)
+		for dir != "/" {
+			if d, err := b.fs.Stat(ctx, vol, dir); err == nil && d.IsDir() {
+				break
+			}
+			dir = gopath.Dir(dir)
+		}
+		return &k8s.PathInfo{Path: p, NavigatePath: dir}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &k8s.PathInfo{
+		Path:       p,
+		Exists:     true,
+		IsDir:      e.IsDir(),
+		Readable:   true,
+		Writable:   true,
+		Executable: e.IsDir(),
+		Mode:       fmt.Sprintf("%o", e.Mode.Perm()),
+		Size:       e.Size,
+	}
+	shown := p
+	if lr, ok := b.fs.(LinkResolver); ok {
+		real, inside, err := lr.RealPath(ctx, vol, p)
+		if err != nil {
+			return nil, classify(err, p)
+		}
+		if !inside {
+			return nil, &k8s.K8sError{Kind: k8s.ErrKindOutOfScope, Message: fmt.Sprintf("%s leads outside %s. KubeBrowser does not follow symbolic links out of a volume.", p, vol)}
+		}
+		if real != p {
+			info.RealPath, shown = real, real
+		}
+	}
+	if e.IsDir() {
+		info.NavigatePath = shown
+	} else {
+		info.NavigatePath = gopath.Dir(shown)
+		info.FileName = gopath.Base(shown)
+	}
+	return info, nil
+}
+
+func (b *Backend) CompletePath(ctx context.Context, namespace, pvcName, prefix string) (*k8s.PathCompletion, error) {
+	return k8s.CompleteFromListing(prefix, func(dir string) ([]k8s.FileInfo, error) {
+		return b.ListFiles(ctx, namespace, pvcName, dir)
+	})
+}
+
+// SearchFiles walks the tree below q.Path, so on remote backends it costs
+// one listing per directory.
+func (b *Backend) SearchFiles(ctx context.Context, namespace, pvcName string, q k8s.SearchQuery) (*k8s.SearchResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	now := b.now()
+
+	vol, root, e, err := b.stat(ctx, namespace, pvcName, q.Path)
+	if err != nil {
+		return nil, err
+	}
+	result := &k8s.SearchResult{Files: []k8s.FileInfo{}}
+	err = b.walk(ctx, vol, root, e, func(p string, e Entry) error {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		if p == root || !q.Match(rel, e.IsDir(), e.Size, e.ModTime, now) {
+			return nil
+		}
+		if len(result.Files) == limit {
+			result.Truncated = true
+			return errStopWalk
+		}
+		result.Files = append(result.Files, fileInfo(e, p, root))
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StreamSearch walks the tree like SearchFiles, handing each match to fn
+// as the walk reaches it.
+func (b *Backend) StreamSearch(ctx context.Context, namespace, pvcName string, q k8s.SearchQuery, fn func(k8s.FileInfo) error) (bool, error) {
+	if err := q.Validate(); err != nil {
+		return false, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	now := b.now()
+
+	vol, root, e, err := b.stat(ctx, namespace, pvcName, q.Path)
+	if err != nil {
+		return false, err
+	}
+	sent, truncated := 0, false
+	err = b.walk(ctx, vol, root, e, func(p string, e Entry) error {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		if p == root || !q.Match(rel, e.IsDir(), e.Size, e.ModTime, now) {
+			return nil
+		}
+		if sent == limit {
+			truncated = true
+			return errStopWalk
+		}
+		sent++
+		return fn(fileInfo(e, p, root))
+	})
+	if err != nil && err != errStopWalk {
+		return false, err
+	}
+	return truncated, nil
+}
+
+func (b *Backend) DiskUsage(ctx context.Context, namespace, pvcName string, paths []string) (int64, error) {
+	var total int64
+	for _, path := range paths {
+		vol, p, e, err := b.stat(ctx, namespace, pvcName, path)
+		if err != nil {
+			return 0, err
+		}
+		err = b.walk(ctx, vol, p, e, func(_ string, e Entry) error {
+			if !e.IsDir() {
+				total += e.Size
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// StreamDiskUsage reports the total of each of paths once it is walked;
+// maxDepth is ignored.
+func (b *Backend) StreamDiskUsage(ctx context.Context, namespace, pvcName string, paths []string, maxDepth int, fn func(k8s.DirUsage) error) (int64, error) {
+	var total int64
+	for _, p := range paths {
+		n, err := b.DiskUsage(ctx, namespace, pvcName, []string{p})
+		if err != nil {
+			return 0, err
+		}
+		total += n
+		if err := fn(k8s.DirUsage{Path: p, Bytes: n}); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+func (b *Backend) MeasurePaths(ctx context.Context, namespace, pvcName string, paths []string) (*k8s.PathUsage, error) {
+	usage := &k8s.PathUsage{}
+	for _, path := range paths {
+		vol, p, e, err := b.stat(ctx, namespace, pvcName, path)
+		if err != nil {
+			return nil, err
+		}
+		err = b.walk(ctx, vol, p, e, func(_ string, e Entry) error {
+			if !e.IsDir() {
+				usage.Bytes += e.Size
+				usage.Files++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
+
+// StreamArchive writes a gzip-compressed tar of paths, with the same
+// volume-relative names tar produces in a pod and the same exclusions.
+func (b *Backend) StreamArchive(ctx context.Context, namespace, pvcName string, paths, exclude []string, w io.Writer) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths to archive")
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, path := range paths {
+		vol, p, e, err := b.stat(ctx, namespace, pvcName, path)
+		if err != nil {
+			return err
+		}
+		err = b.walk(ctx, vol, p, e, func(p string, e Entry) error {
+			if k8s.ExcludedPath(exclude, p) {
+				if e.IsDir() {
+					return errSkipDir
+				}
+				return nil
+			}
+			name := strings.TrimPrefix(p, "/")
+			if name == "" {
+				name = "."
+			}
+			hdr := &tar.Header{Name: name, Mode: int64(e.Mode.Perm()), ModTime: e.ModTime, Typeflag: tar.TypeReg, Size: e.Size}
+			if e.IsDir() {
+				hdr.Name += "/"
+				hdr.Typeflag = tar.TypeDir
+				hdr.Size = 0
+			}
+			if err := tw.WriteHeader(hdr); err != nil || e.IsDir() {
+				return err
+			}
+			rc, err := b.fs.Open(ctx, vol, p)
+			if err != nil {
+				return classify(err, p)
+			}
+			defer rc.Close()
+			_, err = io.Copy(tw, rc)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// UnpackArchive writes the directories and regular files of the tar
+// stream r under destDir. Symlinks and other special entries are skipped.
+// Like tar, it gives entries the mode and modification time the archive
+// records, as far as the file system can set them; directories get theirs
+// last, once nothing more is written into them.
+func (b *Backend) UnpackArchive(ctx context.Context, namespace, pvcName, destDir string, r io.Reader) error {
+	vol, err := b.volume(ctx, namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	destDir = cleanPath(destDir)
+	if err := b.fs.MkdirAll(ctx, vol, destDir); err != nil {
+		return classify(err, destDir)
+	}
+	var dirs []*tar.Header
+	err = k8s.ReadArchive(r, func(name string, hdr *tar.Header, body io.Reader) error {
+		target := gopath.Join(destDir, name)
+		if hdr.Typeflag == tar.TypeDir {
+			if err := b.fs.MkdirAll(ctx, vol, target); err != nil {
+				return classify(err, target)
+			}
+			dirs = append(dirs, &tar.Header{Name: target, Mode: hdr.Mode, ModTime: hdr.ModTime})
+			return nil
+		}
+		if err := b.fs.Create(ctx, vol, target, body); err != nil {
+			return classify(err, target)
+		}
+		return b.setMetadata(ctx, vol, target, hdr.Mode, hdr.ModTime)
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := b.setMetadata(ctx, vol, dirs[i].Name, dirs[i].Mode, dirs[i].ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMetadata gives p the permission bits of mode and mtime, skipping
+// zero values and what the file system cannot set.
+func (b *Backend) setMetadata(ctx context.Context, vol, p string, mode int64, mtime time.Time) error {
+	if chmoder, ok := b.fs.(Chmoder); ok && mode&0o777 != 0 {
+		if err := chmoder.Chmod(ctx, vol, p, iofs.FileMode(mode).Perm()); err != nil {
+			return classify(err, p)
+		}
+	}
+	if setter, ok := b.fs.(TimeSetter); ok && !mtime.IsZero() {
+		if err := setter.Chtimes(ctx, vol, p, mtime); err != nil {
+			return classify(err, p)
+		}
+	}
+	return nil
+}
+
+// Move renames src to dst within a volume. It needs an FS that implements
+// Renamer; dst must not exist yet.
+func (b *Backend) Move(ctx context.Context, namespace, pvcName, src, dst string) error {
+	renamer, ok := b.fs.(Renamer)
+	if !ok {
+		return b.unsupported("Renaming")
+	}
+	vol, from, _, err := b.stat(ctx, namespace, pvcName, src)
+	if err != nil {
+		return err
+	}
+	to := cleanPath(dst)
+	switch {
+	case from == "/" || to == "/":
+		return fmt.Errorf("cannot move the root of a volume, or onto it")
+	case from == to:
+		return fmt.Errorf("source and destination are the same path")
+	case strings.HasPrefix(to, from+"/"):
+		return fmt.Errorf("cannot move a directory into itself")
+	}
+	if _, err := b.fs.Stat(ctx, vol, to); err == nil {
+		return &k8s.K8sError{Kind: k8s.ErrKindUnknown, Message: fmt.Sprintf("%s: file exists.", to)}
+	}
+	if err := b.fs.MkdirAll(ctx, vol, gopath.Dir(to)); err != nil {
+		return classify(err, gopath.Dir(to))
+	}
+	return classify(renamer.Rename(ctx, vol, from, to), from)
+}
+
+// MoveBetweenPVCs moves paths between two volumes of this connection.
+// Like the pod-based move, sources are only removed once everything has
+// been copied.
+func (b *Backend) MoveBetweenPVCs(ctx context.Context, src k8s.PVCRef, paths []string, dst k8s.PVCRef, destDir string, stage func(k8s.MoveStage), progress func(int64)) (int, error) {
+	if src == dst {
+		return 0, fmt.Errorf("source and destination are the same volume; move between two volumes")
+	}
+	for _, p := range paths {
+		if cleanPath(p) == "/" {
+			return 0, fmt.Errorf("cannot move the root of a volume; select the entries inside it")
+		}
+	}
+	if stage == nil {
+		stage = func(k8s.MoveStage) {}
+	}
+	from, err := b.volume(ctx, src.Namespace, src.PVC)
+	if err != nil {
+		return 0, err
+	}
+	to, err := b.volume(ctx, dst.Namespace, dst.PVC)
+	if err != nil {
+		return 0, err
+	}
+	destDir = cleanPath(destDir)
+	if err := b.fs.MkdirAll(ctx, to, destDir); err != nil {
+		return 0, classify(err, destDir)
+	}
+
+	stage(k8s.MoveCopying)
+	files := 0
+	var copied int64
+	var moved [][]string
+	for _, path := range paths {
+		p := cleanPath(path)
+		e, err := b.fs.Stat(ctx, from, p)
+		if err != nil {
+			return files, classify(err, p)
+		}
+		var tree []string
+		err = b.walk(ctx, from, p, e, func(q string, e Entry) error {
+			tree = append(tree, q)
+			target := gopath.Join(destDir, strings.TrimPrefix(q, gopath.Dir(p)))
+			if e.IsDir() {
+				return classify(b.fs.MkdirAll(ctx, to, target), target)
+			}
+			rc, err := b.fs.Open(ctx, from, q)
+			if err != nil {
+				return classify(err, q)
+			}
+			defer rc.Close()
+			if err := b.fs.Create(ctx, to, target, rc); err != nil {
+				return classify(err, target)
+			}
+			files++
+			copied += e.Size
+			if progress != nil {
+				progress(copied)
+			}
+			return nil
+		})
+		if err != nil {
+			return files, err
+		}
+		moved = append(moved, tree)
+	}
+
+	stage(k8s.MoveVerifying)
+	stage(k8s.MoveDeleting)
+	for _, tree := range moved {
+		for i := len(tree) - 1; i >= 0; i-- {
+			if err := b.fs.Remove(ctx, from, tree[i]); err != nil {
+				return files, classify(err, tree[i])
+			}
+		}
+	}
+	return files, nil
+}
+
+func (b *Backend) FilesystemUsage(ctx context.Context, namespace, pvcName string) (*k8s.FilesystemUsage, error) {
+	return nil, b.unsupported("Filesystem usage")
+}
+
+func (b *Backend) ClonePVC(ctx context.Context, req k8s.CloneRequest, progress func(int64)) (*k8s.CloneResult, error) {
+	return nil, b.unsupported("Cloning volumes")
+}
+
+func (b *Backend) ListSnapshots(ctx context.Context, namespace, pvcName string) ([]k8s.Snapshot, error) {
+	return nil, b.unsupported("Browsing snapshots")
+}
+
+func (b *Backend) BrowseSnapshot(ctx context.Context, namespace, snapshotName string) (*k8s.SnapshotClaim, error) {
+	return nil, b.unsupported("Browsing snapshots")
+}
+
+func (b *Backend) ReleaseSnapshot(ctx context.Context, namespace, claimName string) error {
+	return b.unsupported("Browsing snapshots")
+}
+
+func (b *Backend) RestoreFromSnapshot(ctx context.Context, req k8s.SnapshotRestoreRequest, progress func(int64)) (*k8s.SnapshotRestoreResult, error) {
+	return nil, b.unsupported("Restoring from snapshots")
+}
+
+func (b *Backend) MigratePVC(ctx context.Context, req k8s.MigrationRequest, stage func(k8s.MigrationStage)) (*k8s.MigrationReport, error) {
+	return nil, b.unsupported("Storage-class migration")
+}
+
+func (b *Backend) StartMaintenance(ctx context.Context, namespace, pvcName string, d time.Duration) (*k8s.Maintenance, error) {
+	return nil, b.unsupported("Maintenance mode")
+}
+
+func (b *Backend) EndMaintenance(ctx context.Context, namespace, pvcName string) (*k8s.Maintenance, error) {
+	return nil, b.unsupported("Maintenance mode")
+}
+
+func (b *Backend) ListMaintenance(ctx context.Context, namespace string) ([]k8s.Maintenance, error) {
+	return []k8s.Maintenance{}, nil
+}
+
+func (b *Backend) ResolvePVCPath(ctx context.Context, namespace, pvcName, filePath string) (*k8s.PVCTarget, error) {
+	return nil, b.unsupported("kubectl commands")
+}
+
+func (b *Backend) KubectlCommands(target *k8s.PVCTarget, isDir bool) k8s.KubectlCommands {
+	return k8s.KubectlCommands{}
+}
+
+func (b *Backend) ListPods(ctx context.Context, namespace string) ([]k8s.PodInfo, error) {
+	return []k8s.PodInfo{}, nil
+}
+
+func (b *Backend) ListContainerFiles(ctx context.Context, namespace, podName, containerName, path string) (*k8s.ContainerListing, error) {
+	return nil, b.unsupported("Browsing container filesystems")
+}
+
+func (b *Backend) ReadContainerFile(ctx context.Context, namespace, podName, containerName, path string, reveal bool) (*k8s.ContainerFile, error) {
+	return nil, b.unsupported("Reading container files")
+}
+
+func (b *Backend) ListArchive(ctx context.Context, namespace, pvcName, filePath string, limit int) (*k8s.ArchiveListing, error) {
+	return nil, b.unsupported("Listing archives")
+}
+
+func (b *Backend) StreamArchiveMember(ctx context.Context, namespace, pvcName, archivePath, member string, w io.Writer) error {
+	return b.unsupported("Reading archive members")
+}
+
+func (b *Backend) ExtractArchiveMembers(ctx context.Context, namespace, pvcName, archivePath string, members []string, destDir string, overwrite bool) error {
+	return b.unsupported("Extracting archives")
+}
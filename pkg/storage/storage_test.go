@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"kube-browser/pkg/k8s"
+)
+
+func newLocalBackend(t *testing.T, names ...string) (*Backend, map[string]string) {
+	t.Helper()
+	dirs := make(map[string]string)
+	var roots []string
+	for _, name := range names {
+		dir := t.TempDir()
+		dirs[name] = dir
+		roots = append(roots, name+"="+dir)
+	}
+	b, err := Open(context.Background(), Config{Type: "local", Roots: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, dirs
+}
+
+func writeLocal(t *testing.T, root, rel, content string) {
+	t.Helper()
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalBackendBrowse(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "html/index.html", "<h1>hi</h1>")
+	writeLocal(t, dirs["exports"], "README.md", "# readme")
+
+	pvcs, err := b.ListPVCs(ctx, "local")
+	if err != nil || len(pvcs) != 1 || pvcs[0].Name != "exports" || pvcs[0].MountPath != dirs["exports"] {
+		t.Fatalf("unexpected volumes %+v, %v", pvcs, err)
+	}
+
+	files, err := b.ListFiles(ctx, "local", "exports", "/")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("unexpected root listing %+v, %v", files, err)
+	}
+	files, err = b.ListFiles(ctx, "local", "exports", "/html")
+	if err != nil || len(files) != 1 || files[0].Path != "/html/index.html" {
+		t.Errorf("expected listing paths like ls gives, got %+v, %v", files, err)
+	}
+
+	data, truncated, err := b.ReadFileHead(ctx, "local", "exports", "/README.md", 4)
+	if err != nil || string(data) != "# re" || !truncated {
+		t.Errorf("unexpected head %q, %v, %v", data, truncated, err)
+	}
+
+	info, err := b.ResolvePath(ctx, "local", "exports", "/html/missing/deeper.txt")
+	if err != nil || info.Exists || info.NavigatePath != "/html" {
+		t.Errorf("expected to navigate to the nearest ancestor, got %+v, %v", info, err)
+	}
+
+	_, err = b.ListFiles(ctx, "local", "exports", "/nope")
+	var ke *k8s.K8sError
+	if !errors.As(err, &ke) || ke.Kind != k8s.ErrKindPathNotFound {
+		t.Errorf("expected PathNotFound, got %v", err)
+	}
+
+	outside := t.TempDir()
+	writeLocal(t, outside, "secret", "s3cr3t")
+	escape := "/../" + filepath.Base(outside) + "/secret"
+	if data, _, err := b.ReadFileHead(ctx, "local", "exports", escape, 100); err == nil {
+		t.Errorf("expected %s to stay inside the root, read %q", escape, data)
+	}
+}
+
+func TestLocalBackendResolveFollowsLinks(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "releases/v2/app.log", "ok")
+	outside := t.TempDir()
+	for name, target := range map[string]string{
+		"current": "releases/v2",
+		"up":      ".",
+		"escape":  outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(dirs["exports"], name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+
+	info, err := b.ResolvePath(ctx, "local", "exports", "/current")
+	if err != nil || info.RealPath != "/releases/v2" || info.NavigatePath != "/releases/v2" {
+		t.Errorf("expected /current to open /releases/v2, got %+v, %v", info, err)
+	}
+	info, err = b.ResolvePath(ctx, "local", "exports", "/up/up/current/app.log")
+	if err != nil || info.NavigatePath != "/releases/v2" || info.FileName != "app.log" {
+		t.Errorf("expected a looping link to collapse, got %+v, %v", info, err)
+	}
+	_, err = b.ResolvePath(ctx, "local", "exports", "/escape")
+	var ke *k8s.K8sError
+	if !errors.As(err, &ke) || ke.Kind != k8s.ErrKindOutOfScope {
+		t.Errorf("expected OutOfScope for a link out of the root, got %v", err)
+	}
+}
+
+func TestLocalBackendStaysInsideRoot(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	outside := t.TempDir()
+	writeLocal(t, outside, "secret", "s3cr3t")
+	for name, target := range map[string]string{
+		"escape": outside,
+		"leak":   filepath.Join(outside, "secret"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dirs["exports"], name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+
+	var ke *k8s.K8sError
+	if data, _, err := b.ReadFileHead(ctx, "local", "exports", "/leak", 100); !errors.As(err, &ke) || ke.Kind != k8s.ErrKindOutOfScope {
+		t.Errorf("expected reading through a link out of the root to be refused, read %q, %v", data, err)
+	}
+	if files, err := b.ListFiles(ctx, "local", "exports", "/escape"); err == nil && len(files) > 0 && files[0].Name == "secret" {
+		t.Errorf("expected listing through a link out of the root to be refused, got %+v", files)
+	}
+	if err := b.UploadFile(ctx, "local", "exports", "/escape/planted", strings.NewReader("x")); err == nil {
+		t.Error("expected writing through a link out of the root to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "planted")); err == nil {
+		t.Error("expected nothing to be written outside the root")
+	}
+	if err := b.RemoveFile(ctx, "local", "exports", "/escape/secret"); err == nil {
+		t.Error("expected removing through a link out of the root to be refused")
+	}
+
+	// The link itself is the volume's, and can be deleted.
+	if err := b.DeleteFile(ctx, "local", "exports", "/leak"); err != nil {
+		t.Fatalf("unexpected error deleting the link: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dirs["exports"], "leak")); err == nil {
+		t.Error("expected the link to be deleted")
+	}
+	if got, err := os.ReadFile(filepath.Join(outside, "secret")); err != nil || string(got) != "s3cr3t" {
+		t.Errorf("expected the file outside the root to be kept, got %q, %v", got, err)
+	}
+}
+
+func TestLocalBackendUploadAndRemove(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "data")
+
+	if err := b.UploadFile(ctx, "local", "data", "/new/dir/file.txt", strings.NewReader("payload")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dirs["data"], "new", "dir", "file.txt"))
+	if err != nil || string(got) != "payload" {
+		t.Fatalf("expected the uploaded file, got %q, %v", got, err)
+	}
+
+	rc, name, err := b.DownloadFile(ctx, "local", "data", "/new/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if name != "file.txt" || string(body) != "payload" {
+		t.Errorf("unexpected download %s %q", name, body)
+	}
+
+	if err := b.RemoveFile(ctx, "local", "data", "/new/dir/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RemoveFile(ctx, "local", "data", "/new/dir/file.txt"); err != nil {
+		t.Errorf("removing a missing file should succeed like rm -f, got %v", err)
+	}
+	if err := b.RemoveFile(ctx, "local", "data", "/new"); err == nil {
+		t.Errorf("expected removing a directory to fail")
+	}
+}
+
+func TestLocalBackendSearchAndArchive(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "site")
+	writeLocal(t, dirs["site"], "html/index.html", "index")
+	writeLocal(t, dirs["site"], "html/about.html", "about")
+	writeLocal(t, dirs["site"], "config/site.json", "{}")
+
+	result, err := b.SearchFiles(ctx, "local", "site", k8s.SearchQuery{Path: "/", Pattern: "*.html", Type: "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range result.Files {
+		paths = append(paths, f.Path)
+	}
+	if got := strings.Join(paths, ","); got != "html/about.html,html/index.html" {
+		t.Errorf("unexpected matches %q", got)
+	}
+	result, err = b.SearchFiles(ctx, "local", "site", k8s.SearchQuery{Path: "/", Limit: 1})
+	if err != nil || len(result.Files) != 1 || !result.Truncated {
+		t.Errorf("expected a truncated search, got %+v, %v", result, err)
+	}
+
+	size, err := b.DiskUsage(ctx, "local", "site", []string{"/html"})
+	if err != nil || size != 10 {
+		t.Errorf("expected 10 bytes, got %d, %v", size, err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.StreamArchive(ctx, "local", "site", []string{"html"}, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if got := strings.Join(names, ","); got != "html/,html/about.html,html/index.html" {
+		t.Errorf("unexpected archive entries %q", got)
+	}
+}
+
+func TestLocalBackendMove(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "src", "dst")
+	writeLocal(t, dirs["src"], "logs/a.log", "aaa")
+	writeLocal(t, dirs["src"], "logs/sub/b.log", "bb")
+
+	files, err := b.MoveBetweenPVCs(ctx, k8s.PVCRef{Namespace: "local", PVC: "src"}, []string{"logs"},
+		k8s.PVCRef{Namespace: "local", PVC: "dst"}, "/archive", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 {
+		t.Errorf("expected 2 files, got %d", files)
+	}
+	if got, err := os.ReadFile(filepath.Join(dirs["dst"], "archive", "logs", "sub", "b.log")); err != nil || string(got) != "bb" {
+		t.Errorf("expected the moved file, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirs["src"], "logs")); !os.IsNotExist(err) {
+		t.Errorf("expected the source to be gone, got %v", err)
+	}
+}
+
+func TestLocalBackendSaveFile(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "bin/run.sh", "echo old")
+	script := filepath.Join(dirs["exports"], "bin", "run.sh")
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SaveFile(ctx, "local", "exports", "/bin/run.sh", []byte("echo new")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(script); err != nil || string(got) != "echo new" {
+		t.Errorf("expected the new contents, got %q, %v", got, err)
+	}
+	if fi, err := os.Stat(script); err != nil || fi.Mode().Perm() != 0o755 {
+		t.Errorf("expected the mode to be kept, got %v, %v", fi.Mode(), err)
+	}
+	if err := b.SaveFile(ctx, "local", "exports", "/bin", []byte("x")); err == nil {
+		t.Error("expected saving over a directory to be refused")
+	}
+}
+
+func TestLocalBackendFileChecksum(t *testing.T) {
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "hello.txt", "hello")
+
+	sum, err := b.FileChecksum(context.Background(), "local", "exports", "/hello.txt", "md5")
+	if err != nil || sum.Checksum != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("unexpected checksum %+v, %v", sum, err)
+	}
+}
+
+func TestLocalBackendDelete(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "logs/2024/a.log", "a")
+	writeLocal(t, dirs["exports"], "logs/b.log", "b")
+
+	if err := b.DeleteFile(ctx, "local", "exports", "/logs"); err == nil {
+		t.Error("expected DeleteFile to refuse a directory")
+	}
+	if err := b.DeleteDirectory(ctx, "local", "exports", "/logs", false); err == nil {
+		t.Error("expected a non-recursive delete of a non-empty directory to fail")
+	}
+	if err := b.DeleteDirectory(ctx, "local", "exports", "/", true); err == nil {
+		t.Error("expected the volume root to be refused")
+	}
+	if err := b.DeleteFile(ctx, "local", "exports", "/logs/b.log"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteDirectory(ctx, "local", "exports", "/logs", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dirs["exports"], "logs")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected logs to be gone, got %v", err)
+	}
+}
+
+func TestLocalBackendRename(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "logs/a.log", "a")
+	writeLocal(t, dirs["exports"], "b.log", "b")
+
+	if err := b.Move(ctx, "local", "exports", "/logs", "/archive/2024"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dirs["exports"], "archive", "2024", "a.log")); err != nil || string(got) != "a" {
+		t.Errorf("expected the directory under its new name, got %q, %v", got, err)
+	}
+	if err := b.Move(ctx, "local", "exports", "/b.log", "/archive"); err == nil {
+		t.Error("expected an existing destination to be refused")
+	}
+	if err := b.Move(ctx, "local", "exports", "/archive", "/archive/nested"); err == nil {
+		t.Error("expected a move into itself to be refused")
+	}
+}
+
+func TestLocalBackendChangePermissions(t *testing.T) {
+	ctx := context.Background()
+	b, dirs := newLocalBackend(t, "exports")
+	writeLocal(t, dirs["exports"], "app/data/a.txt", "a")
+	if err := os.Chmod(filepath.Join(dirs["exports"], "app", "data"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.ChangePermissions(ctx, "local", "exports", "/app", k8s.FilePermissions{Mode: "g+rwX"}, true); err != nil {
+		t.Fatalf("ChangePermissions: %v", err)
+	}
+	for rel, want := range map[string]os.FileMode{"app": 0o775, "app/data": 0o770, "app/data/a.txt": 0o664} {
+		fi, err := os.Stat(filepath.Join(dirs["exports"], filepath.FromSlash(rel)))
+		if err != nil || fi.Mode().Perm() != want {
+			t.Errorf("%s: mode %v, want %v (%v)", rel, fi.Mode().Perm(), want, err)
+		}
+	}
+	if err := b.ChangePermissions(ctx, "local", "exports", "/app", k8s.FilePermissions{Owner: "1000"}, false); err == nil {
+		t.Error("chown should be unsupported on local directories")
+	}
+}
+
+func TestClassifyFilesystemErrors(t *testing.T) {
+	for errno, want := range map[syscall.Errno]k8s.ErrorKind{
+		syscall.EROFS:  k8s.ErrKindReadOnlyFS,
+		syscall.EIO:    k8s.ErrKindIOError,
+		syscall.ESTALE: k8s.ErrKindStaleHandle,
+	} {
+		err := classify(&os.PathError{Op: "open", Path: "/srv/a", Err: errno}, "/a")
+		var ke *k8s.K8sError
+		if !errors.As(err, &ke) || ke.Kind != want {
+			t.Errorf("classify(%v) = %v, want kind %s", errno, err, want)
+		}
+	}
+}
+
+func TestOpenRejectsBadConfig(t *testing.T) {
+	ctx := context.Background()
+	for _, cfg := range []Config{
+		{Type: "ftp"},
+		{Type: "local"},
+		{Type: "local", Roots: []string{"relative/dir"}},
+		{Type: "local", Roots: []string{t.TempDir(), t.TempDir() + "/missing"}},
+		{Type: "sftp"},
+	} {
+		if _, err := Open(ctx, cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
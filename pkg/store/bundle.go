@@ -0,0 +1,120 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BundleVersion is the format version Export writes and Import accepts.
+const BundleVersion = 1
+
+// Bundle is a portable copy of state files, to set KubeBrowser up the same
+// way on another machine. Files holds the contents of each state file by
+// name. Browser holds the web UI's preferences, which live in the browser,
+// and is carried along untouched.
+type Bundle struct {
+	Version  int                        `json:"version"`
+	Exported time.Time                  `json:"exported"`
+	Files    map[string]json.RawMessage `json:"files"`
+	Browser  json.RawMessage            `json:"browser,omitempty"`
+}
+
+// Export reads the named state files into a bundle. Missing files are left
+// out.
+func Export(names ...string) (*Bundle, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{Version: BundleVersion, Exported: time.Now().UTC(), Files: map[string]json.RawMessage{}}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("corrupt state file %s", name)
+		}
+		b.Files[name] = data
+	}
+	return b, nil
+}
+
+// Import writes the files of a bundle that are among names, and returns
+// the ones it wrote; any other file in the bundle is an error, so a bundle
+// cannot write outside the known state files. Unless replace is set, a
+// list of objects with an "id" is merged into the existing one, the
+// bundle's copy winning, instead of replacing it.
+func Import(b *Bundle, replace bool, names ...string) ([]string, error) {
+	if b.Version < 1 || b.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	allowed := map[string]bool{}
+	for _, name := range names {
+		allowed[name] = true
+	}
+	for name, data := range b.Files {
+		if !allowed[name] {
+			return nil, fmt.Errorf("unknown state file %q in bundle", name)
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("invalid contents for %s in bundle", name)
+		}
+	}
+
+	var imported []string
+	for _, name := range names {
+		data, ok := b.Files[name]
+		if !ok {
+			continue
+		}
+		if !replace {
+			var existing json.RawMessage
+			if err := Load(name, &existing); err != nil {
+				return imported, err
+			}
+			data = mergeByID(existing, data)
+		}
+		if err := Save(name, data); err != nil {
+			return imported, err
+		}
+		imported = append(imported, name)
+	}
+	return imported, nil
+}
+
+// mergeByID merges two JSON lists of objects keyed by "id": objects of
+// incoming replace those of existing with the same id, and the others are
+// appended. When either is not such a list, incoming wins.
+func mergeByID(existing, incoming json.RawMessage) json.RawMessage {
+	var have, add []map[string]json.RawMessage
+	if len(existing) == 0 || json.Unmarshal(existing, &have) != nil || json.Unmarshal(incoming, &add) != nil {
+		return incoming
+	}
+	index := map[string]int{}
+	for i, item := range have {
+		if id, ok := item["id"]; ok {
+			index[string(id)] = i
+		}
+	}
+	for _, item := range add {
+		id, ok := item["id"]
+		if i, seen := index[string(id)]; ok && seen {
+			have[i] = item
+			continue
+		}
+		have = append(have, item)
+	}
+	merged, err := json.Marshal(have)
+	if err != nil {
+		return incoming
+	}
+	return merged
+}
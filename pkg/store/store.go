@@ -0,0 +1,83 @@
+// Package store persists small pieces of KubeBrowser state (saved searches,
+// job records) as JSON files, so they survive a restart of the binary.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mu serializes writers so two handlers saving the same file cannot
+// interleave their temp-file/rename sequences.
+var mu sync.Mutex
+
+// Dir returns the state directory: KUBE_BROWSER_STATE_DIR if set, otherwise
+// "kube-browser" under the user's config directory.
+func Dir() (string, error) {
+	if d := os.Getenv("KUBE_BROWSER_STATE_DIR"); d != "" {
+		return d, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine state directory (set KUBE_BROWSER_STATE_DIR): %w", err)
+	}
+	return filepath.Join(base, "kube-browser"), nil
+}
+
+// Load decodes the named state file into v. A missing file is not an error
+// and leaves v untouched.
+func Load(name string, v interface{}) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("corrupt state file %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save writes v to the named state file atomically, so a crash mid-write
+// never leaves a truncated file behind.
+func Save(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("KUBE_BROWSER_STATE_DIR", filepath.Join(dir, "nested"))
+
+	type record struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	in := []record{{"a", 1}, {"b", 2}}
+	if err := Save("records.json", in); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var out []record
+	if err := Load("records.json", &out); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(out) != 2 || out[1] != in[1] {
+		t.Errorf("round trip mismatch: %+v", out)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "nested"))
+	if len(entries) != 1 {
+		t.Errorf("expected only the state file to remain, got %d entries", len(entries))
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+
+	out := []string{"unchanged"}
+	if err := Load("missing.json", &out); err != nil {
+		t.Fatalf("expected no error for missing file, got %v", err)
+	}
+	if len(out) != 1 || out[0] != "unchanged" {
+		t.Errorf("expected value to be untouched, got %v", out)
+	}
+}
+
+func TestLoadCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("KUBE_BROWSER_STATE_DIR", dir)
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600)
+
+	var out map[string]string
+	if err := Load("bad.json", &out); err == nil {
+		t.Error("expected error for corrupt file")
+	}
+}
+
+func TestExportImportBundle(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	if err := Save("searches.json", []map[string]string{{"id": "1", "name": "logs"}, {"id": "2", "name": "errors"}}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Export("searches.json", "missing.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Files) != 1 || b.Version != BundleVersion {
+		t.Fatalf("unexpected bundle %+v", b)
+	}
+
+	// Another machine with searches of its own.
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	if err := Save("searches.json", []map[string]string{{"id": "2", "name": "old errors"}, {"id": "3", "name": "local"}}); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := Import(b, false, "searches.json")
+	if err != nil || len(imported) != 1 {
+		t.Fatalf("Import = %v, %v", imported, err)
+	}
+	var merged []map[string]string
+	Load("searches.json", &merged)
+	var names []string
+	for _, s := range merged {
+		names = append(names, s["name"])
+	}
+	if got := strings.Join(names, ","); got != "errors,local,logs" {
+		t.Errorf("expected a merge by id, got %q", got)
+	}
+
+	if _, err := Import(b, true, "searches.json"); err != nil {
+		t.Fatal(err)
+	}
+	merged = nil
+	Load("searches.json", &merged)
+	if len(merged) != 2 {
+		t.Errorf("expected the bundle to replace the file, got %v", merged)
+	}
+}
+
+func TestImportRejectsUnknownFiles(t *testing.T) {
+	t.Setenv("KUBE_BROWSER_STATE_DIR", t.TempDir())
+	b := &Bundle{Version: BundleVersion, Files: map[string]json.RawMessage{"../escape.json": json.RawMessage(`[]`)}}
+	if _, err := Import(b, true, "searches.json"); err == nil {
+		t.Error("expected a file outside the known state files to be refused")
+	}
+	b = &Bundle{Version: BundleVersion + 1}
+	if _, err := Import(b, true, "searches.json"); err == nil {
+		t.Error("expected a newer bundle version to be refused")
+	}
+}